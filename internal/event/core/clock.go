@@ -0,0 +1,44 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock supplies the time at which events happen.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// clockHolder wraps the current Clock so that clocks of different types can be
+// stored in the same atomic.Value.
+type clockHolder struct{ clock Clock }
+
+var clock atomic.Value
+
+func init() {
+	clock.Store(clockHolder{systemClock{}})
+}
+
+// SetClock sets the clock used to timestamp events, and by the exporters that
+// need to know the current time.
+// Passing nil restores the system clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clock.Store(clockHolder{c})
+}
+
+// Now returns the current time according to the clock set by SetClock.
+func Now() time.Time {
+	return clock.Load().(clockHolder).clock.Now()
+}
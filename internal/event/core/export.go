@@ -7,8 +7,6 @@ package core
 import (
 	"context"
 	"sync/atomic"
-	"time"
-	"unsafe"
 
 	"golang.org/x/tools/internal/event/label"
 )
@@ -18,41 +16,84 @@ import (
 type Exporter func(context.Context, Event, label.Map) context.Context
 
 var (
-	exporter unsafe.Pointer
+	// exporter holds the global Exporter, it is only ever stored using an
+	// Exporter typed value so that it can be loaded with a type assertion.
+	exporter atomic.Value
+
+	// contextExporters is set once WithExporter has been called, so that Export
+	// only pays for the context lookup when it might find something.
+	contextExporters int32
 )
 
+type contextKeyType int
+
+const exporterKey = contextKeyType(0)
+
 // SetExporter sets the global exporter function that handles all events.
 // The exporter is called synchronously from the event call site, so it should
 // return quickly so as not to hold up user code.
 func SetExporter(e Exporter) {
-	p := unsafe.Pointer(&e)
-	if e == nil {
-		// &e is always valid, and so p is always valid, but for the early abort
-		// of ProcessEvent to be efficient it needs to make the nil check on the
-		// pointer without having to dereference it, so we make the nil function
-		// also a nil pointer
-		p = nil
+	exporter.Store(e)
+}
+
+// SwapExporter sets the global exporter function, and returns the one it
+// replaced, which will be nil if there was not one.
+func SwapExporter(e Exporter) Exporter {
+	old, _ := exporter.Swap(e).(Exporter)
+	return old
+}
+
+// WithExporter returns a context that delivers events to e rather than to the
+// global exporter.
+// Passing a nil exporter disables event delivery for the returned context.
+func WithExporter(ctx context.Context, e Exporter) context.Context {
+	atomic.StoreInt32(&contextExporters, 1)
+	return context.WithValue(ctx, exporterKey, e)
+}
+
+// getExporter returns the exporter that should handle events delivered to ctx,
+// or nil if there is not one.
+func getExporter(ctx context.Context) Exporter {
+	if atomic.LoadInt32(&contextExporters) != 0 {
+		if e, ok := ctx.Value(exporterKey).(Exporter); ok {
+			return e
+		}
 	}
-	atomic.StorePointer(&exporter, p)
+	e, _ := exporter.Load().(Exporter)
+	return e
+}
+
+// Enabled reports whether a global exporter is installed.
+// Callers that have a context should use EnabledContext instead, as the
+// context may carry an exporter of its own.
+func Enabled() bool {
+	return EnabledContext(context.Background())
+}
+
+// EnabledContext reports whether events delivered to ctx would reach an
+// exporter.
+func EnabledContext(ctx context.Context) bool {
+	return GetLevel() != LevelOff && getExporter(ctx) != nil
 }
 
 // deliver is called to deliver an event to the supplied exporter.
 // it will fill in the time.
 func deliver(ctx context.Context, exporter Exporter, ev Event) context.Context {
 	// add the current time to the event
-	ev.at = time.Now()
+	ev.at = Now()
 	// hand the event off to the current exporter
 	return exporter(ctx, ev, ev)
 }
 
-// Export is called to deliver an event to the global exporter if set.
+// Export is called to deliver an event to the exporter for the context, or the
+// global exporter if the context does not have one.
 func Export(ctx context.Context, ev Event) context.Context {
-	// get the global exporter and abort early if there is not one
-	exporterPtr := (*Exporter)(atomic.LoadPointer(&exporter))
-	if exporterPtr == nil {
+	// get the exporter and abort early if there is not one
+	exporter := getExporter(ctx)
+	if exporter == nil || !GetLevel().allowed(ev) {
 		return ctx
 	}
-	return deliver(ctx, *exporterPtr, ev)
+	return deliver(ctx, exporter, ev)
 }
 
 // ExportPair is called to deliver a start event to the supplied exporter.
@@ -60,11 +101,11 @@ func Export(ctx context.Context, ev Event) context.Context {
 // exporter.
 // It will fill in the time.
 func ExportPair(ctx context.Context, begin, end Event) (context.Context, func()) {
-	// get the global exporter and abort early if there is not one
-	exporterPtr := (*Exporter)(atomic.LoadPointer(&exporter))
-	if exporterPtr == nil {
+	// get the exporter and abort early if there is not one
+	exporter := getExporter(ctx)
+	if exporter == nil || !GetLevel().allowed(begin) {
 		return ctx, func() {}
 	}
-	ctx = deliver(ctx, *exporterPtr, begin)
-	return ctx, func() { deliver(ctx, *exporterPtr, end) }
+	ctx = deliver(ctx, exporter, begin)
+	return ctx, func() { deliver(ctx, exporter, end) }
 }
@@ -0,0 +1,73 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// Level controls which kinds of event are delivered to the exporter.
+// Each level includes all the events of the levels below it.
+type Level int32
+
+const (
+	// LevelOff delivers no events at all.
+	LevelOff = Level(iota)
+	// LevelMetrics delivers metric and label events.
+	LevelMetrics
+	// LevelSpans also delivers span events and error logs.
+	LevelSpans
+	// LevelVerbose delivers every event, it is the default.
+	LevelVerbose
+)
+
+// level holds the current Level, it is accessed atomically.
+var level = int32(LevelVerbose)
+
+// SetLevel changes the kinds of event that are delivered to exporters.
+// Spans that were started before the change still deliver their end event.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+// GetLevel returns the level set by SetLevel.
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&level))
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelOff:
+		return "off"
+	case LevelMetrics:
+		return "metrics"
+	case LevelSpans:
+		return "spans"
+	case LevelVerbose:
+		return "verbose"
+	}
+	return "unknown"
+}
+
+// allowed reports whether ev should be delivered at level l.
+func (l Level) allowed(ev Event) bool {
+	switch {
+	case l >= LevelVerbose:
+		return true
+	case l <= LevelOff:
+		return false
+	}
+	switch ev.Label(0).Key() {
+	case keys.Metric, keys.Label:
+		return true
+	case keys.Start, keys.End, keys.Detach:
+		return l >= LevelSpans
+	case keys.Msg:
+		return l >= LevelSpans && ev.Label(1).Key() == keys.Err
+	}
+	return false
+}
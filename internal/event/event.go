@@ -23,6 +23,69 @@ func SetExporter(e Exporter) {
 	core.SetExporter(core.Exporter(e))
 }
 
+// SwapExporter sets the global exporter function, and returns the previous
+// one so that it can be restored or shut down.
+// It returns nil if there was no previous exporter.
+func SwapExporter(e Exporter) Exporter {
+	return Exporter(core.SwapExporter(core.Exporter(e)))
+}
+
+// WithExporter returns a context that delivers all events to e instead of to
+// the global exporter.
+// This allows a request or session to route its telemetry somewhere other than
+// the rest of the process. A nil exporter disables telemetry for the context.
+func WithExporter(ctx context.Context, e Exporter) context.Context {
+	return core.WithExporter(ctx, core.Exporter(e))
+}
+
+// Enabled reports whether a global exporter is installed.
+// It allows instrumented code to skip building expensive labels when there is
+// nothing to deliver them to.
+func Enabled() bool {
+	return core.Enabled()
+}
+
+// EnabledContext reports whether events delivered to ctx would reach an
+// exporter, taking account of any exporter set by WithExporter.
+func EnabledContext(ctx context.Context) bool {
+	return core.EnabledContext(ctx)
+}
+
+// Level controls which kinds of event are delivered to the exporter.
+type Level = core.Level
+
+// The levels, from the least telemetry to the most.
+const (
+	LevelOff     = core.LevelOff
+	LevelMetrics = core.LevelMetrics
+	LevelSpans   = core.LevelSpans
+	LevelVerbose = core.LevelVerbose
+)
+
+// SetLevel changes the kinds of event that are delivered to the exporter,
+// without replacing the exporter itself.
+// This allows telemetry to be turned up while debugging a session, and back
+// down again afterwards.
+func SetLevel(l Level) {
+	core.SetLevel(l)
+}
+
+// GetLevel returns the level set by SetLevel, which is LevelVerbose unless it
+// has been changed.
+func GetLevel() Level {
+	return core.GetLevel()
+}
+
+// Clock supplies the time at which events happen.
+type Clock = core.Clock
+
+// SetClock sets the clock used to timestamp events, so that tests can produce
+// deterministic output.
+// Passing nil restores the system clock.
+func SetClock(c Clock) {
+	core.SetClock(c)
+}
+
 // Log takes a message and a label list and combines them into a single event
 // before delivering them to the exporter.
 func Log(ctx context.Context, message string, labels ...label.Label) {
@@ -0,0 +1,169 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// recorder is an exporter that remembers the messages of all the log events
+// it is handed.
+type recorder struct {
+	messages []string
+}
+
+func (r *recorder) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if event.IsLog(ev) {
+		r.messages = append(r.messages, keys.Msg.Get(lm))
+	}
+	return ctx
+}
+
+func TestWithExporter(t *testing.T) {
+	global, local := &recorder{}, &recorder{}
+	event.SetExporter(global.ProcessEvent)
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	event.Log(ctx, "to global")
+	localCtx := event.WithExporter(ctx, local.ProcessEvent)
+	event.Log(localCtx, "to local")
+	event.Log(event.WithExporter(ctx, nil), "to nobody")
+	event.Log(ctx, "to global again")
+
+	check := func(name string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s exporter got %v, want %v", name, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s exporter got %v, want %v", name, got, want)
+			}
+		}
+	}
+	check("global", global.messages, "to global", "to global again")
+	check("local", local.messages, "to local")
+}
+
+func TestSwapExporter(t *testing.T) {
+	first, second := &recorder{}, &recorder{}
+	event.SetExporter(nil)
+	if old := event.SwapExporter(first.ProcessEvent); old != nil {
+		t.Fatal("SwapExporter returned an exporter when none was set")
+	}
+	old := event.SwapExporter(second.ProcessEvent)
+	defer event.SetExporter(nil)
+	if old == nil {
+		t.Fatal("SwapExporter did not return the previous exporter")
+	}
+	ev := core.MakeEvent([3]label.Label{keys.Msg.Of("direct")}, nil)
+	old(context.Background(), ev, ev)
+	event.Log(context.Background(), "swapped")
+	if len(first.messages) != 1 || len(second.messages) != 1 {
+		t.Errorf("got messages %v and %v, want one each", first.messages, second.messages)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	event.SetExporter(nil)
+	ctx := context.Background()
+	if event.Enabled() || event.EnabledContext(ctx) {
+		t.Fatal("telemetry enabled with no exporter")
+	}
+	r := &recorder{}
+	local := event.WithExporter(ctx, r.ProcessEvent)
+	if event.Enabled() || !event.EnabledContext(local) {
+		t.Error("context exporter should only enable telemetry for its context")
+	}
+	event.SetExporter(r.ProcessEvent)
+	defer event.SetExporter(nil)
+	if !event.Enabled() || !event.EnabledContext(ctx) {
+		t.Error("telemetry disabled with a global exporter")
+	}
+	if event.EnabledContext(event.WithExporter(ctx, nil)) {
+		t.Error("telemetry enabled for a context with a nil exporter")
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var got []string
+	event.SetExporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsError(ev):
+			got = append(got, "error")
+		case event.IsLog(ev):
+			got = append(got, "log")
+		case event.IsStart(ev):
+			got = append(got, "start")
+		case event.IsEnd(ev):
+			got = append(got, "end")
+		case event.IsMetric(ev):
+			got = append(got, "metric")
+		}
+		return ctx
+	})
+	defer event.SetExporter(nil)
+	defer event.SetLevel(event.LevelVerbose)
+
+	ctx := context.Background()
+	for _, test := range []struct {
+		level event.Level
+		want  string
+	}{
+		{event.LevelVerbose, "[log error start end metric]"},
+		{event.LevelSpans, "[error start end metric]"},
+		{event.LevelMetrics, "[metric]"},
+		{event.LevelOff, "[]"},
+	} {
+		got = nil
+		event.SetLevel(test.level)
+		event.Log(ctx, "log")
+		event.Error(ctx, "error", nil)
+		_, done := event.Start(ctx, "span")
+		done()
+		event.Metric(ctx)
+		if s := fmt.Sprint(got); s != test.want {
+			t.Errorf("level %v: got %v, want %v", test.level, s, test.want)
+		}
+	}
+	if event.Enabled() {
+		t.Error("telemetry enabled at LevelOff")
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestClock(t *testing.T) {
+	at := time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)
+	var got time.Time
+	event.SetExporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		got = ev.At()
+		return ctx
+	})
+	defer event.SetExporter(nil)
+	event.SetClock(fixedClock(at))
+	defer event.SetClock(nil)
+
+	event.Log(context.Background(), "fixed")
+	if !got.Equal(at) {
+		t.Errorf("event happened at %v, want %v", got, at)
+	}
+	event.SetClock(nil)
+	event.Log(context.Background(), "system")
+	if got.Equal(at) {
+		t.Error("SetClock(nil) did not restore the system clock")
+	}
+}
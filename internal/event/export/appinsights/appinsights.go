@@ -0,0 +1,344 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package appinsights sends telemetry to Azure Application Insights using the
+// track API.
+//
+// Spans without a parent are sent as request telemetry and all other spans as
+// dependency telemetry, linked by their operation ID. Metrics are sent as
+// custom metrics, one for each group of label values.
+//
+// Importing the package registers an "appinsights" exporter whose options
+// are a connection string or instrumentation key.
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultIngestionEndpoint is used when the connection string does not name
+// one.
+const DefaultIngestionEndpoint = "https://dc.services.visualstudio.com"
+
+type Config struct {
+	// ConnectionString holds the instrumentation key and, optionally, the
+	// ingestion endpoint, as shown in the Azure portal.
+	ConnectionString string
+	// InstrumentationKey is used if there is no connection string.
+	InstrumentationKey string
+	// Service is the cloud role of the telemetry, it defaults to the name of
+	// the binary.
+	Service string
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+func init() {
+	export.Register("appinsights", func(options string) (event.Exporter, export.Shutdowner, error) {
+		config := &Config{ConnectionString: options}
+		if !strings.Contains(options, "=") {
+			config = &Config{InstrumentationKey: options}
+		}
+		exporter, err := New(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, batcher, nil
+	})
+}
+
+// Exporter is an export.BatchExporter that sends telemetry to Application
+// Insights.
+type Exporter struct {
+	key      string
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter for the configured resource.
+func New(config *Config) (*Exporter, error) {
+	e := &Exporter{
+		key:      config.InstrumentationKey,
+		endpoint: DefaultIngestionEndpoint,
+		service:  config.Service,
+		client:   config.Client,
+	}
+	for _, part := range strings.Split(config.ConnectionString, ";") {
+		k, v := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			k, v = part[:i], part[i+1:]
+		}
+		switch strings.TrimSpace(k) {
+		case "InstrumentationKey":
+			e.key = v
+		case "IngestionEndpoint":
+			e.endpoint = v
+		}
+	}
+	if e.key == "" {
+		return nil, fmt.Errorf("appinsights exporter needs an instrumentation key")
+	}
+	e.endpoint = strings.TrimSuffix(e.endpoint, "/")
+	if e.service == "" {
+		e.service = filepath.Base(os.Args[0])
+	}
+	if e.client == nil {
+		e.client = export.HTTPClient(nil)
+	}
+	return e, nil
+}
+
+// envelope is a single item of telemetry in the track API.
+type envelope struct {
+	Name string            `json:"name"`
+	Time string            `json:"time"`
+	IKey string            `json:"iKey"`
+	Tags map[string]string `json:"tags"`
+	Data envelopeData      `json:"data"`
+}
+
+type envelopeData struct {
+	BaseType string      `json:"baseType"`
+	BaseData interface{} `json:"baseData"`
+}
+
+type requestData struct {
+	Ver          int               `json:"ver"`
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Duration     string            `json:"duration"`
+	ResponseCode string            `json:"responseCode"`
+	Success      bool              `json:"success"`
+	Properties   map[string]string `json:"properties,omitempty"`
+}
+
+type dependencyData struct {
+	Ver        int               `json:"ver"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Duration   string            `json:"duration"`
+	ResultCode string            `json:"resultCode"`
+	Success    bool              `json:"success"`
+	Type       string            `json:"type"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type metricData struct {
+	Ver        int               `json:"ver"`
+	Metrics    []dataPoint       `json:"metrics"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// dataPoint kinds.
+const (
+	measurement = 0
+	aggregation = 1
+)
+
+type dataPoint struct {
+	Name  string   `json:"name"`
+	Kind  int      `json:"kind"`
+	Value float64  `json:"value"`
+	Count *int64   `json:"count,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// ExportSpans sends the spans in a single request.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	items := make([]*envelope, len(spans))
+	for i, s := range spans {
+		items[i] = e.convertSpan(s)
+	}
+	return e.track(ctx, items)
+}
+
+// ExportMetrics sends the current value of each group of the metrics in a
+// single request.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	var items []*envelope
+	now := core.Now()
+	for _, data := range metrics {
+		items = e.appendMetrics(items, data, now)
+	}
+	return e.track(ctx, items)
+}
+
+func (e *Exporter) track(ctx context.Context, items []*envelope) error {
+	if len(items) == 0 {
+		return nil
+	}
+	blob, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("appinsights failed to marshal telemetry: %v", err)
+	}
+	uri := e.endpoint + "/v2/track"
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("appinsights failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("appinsights failed to send telemetry: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("appinsights rejected telemetry for %v: %v", uri, res.Status)
+	}
+	return nil
+}
+
+func (e *Exporter) newEnvelope(kind string, at time.Time, baseType string, data interface{}) *envelope {
+	return &envelope{
+		Name: "Microsoft.ApplicationInsights." + strings.ReplaceAll(e.key, "-", "") + "." + kind,
+		Time: at.UTC().Format(time.RFC3339Nano),
+		IKey: e.key,
+		Tags: map[string]string{"ai.cloud.role": e.service},
+		Data: envelopeData{BaseType: baseType, BaseData: data},
+	}
+}
+
+func (e *Exporter) convertSpan(span *export.Span) *envelope {
+	start, end := span.Start().At(), span.Finish().At()
+	duration := time.Duration(0)
+	if !end.IsZero() {
+		duration = end.Sub(start)
+	}
+	properties := make(map[string]string)
+	for i := 1; span.Start().Valid(i); i++ {
+		addProperty(properties, span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		addProperty(properties, l)
+	}
+	success := true
+	for _, ev := range span.Events() {
+		if !event.IsError(ev) {
+			continue
+		}
+		success = false
+		msg := keys.Msg.From(ev.Label(0))
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		properties["error"] = msg
+	}
+	if len(properties) == 0 {
+		properties = nil
+	}
+	code := "0"
+	if !success {
+		code = "1"
+	}
+
+	var item *envelope
+	if span.ParentID.IsValid() {
+		item = e.newEnvelope("RemoteDependency", start, "RemoteDependencyData", &dependencyData{
+			Ver:        2,
+			ID:         span.ID.SpanID.String(),
+			Name:       span.Name,
+			Duration:   formatDuration(duration),
+			ResultCode: code,
+			Success:    success,
+			Type:       "InProc",
+			Properties: properties,
+		})
+		item.Tags["ai.operation.parentId"] = span.ParentID.String()
+	} else {
+		item = e.newEnvelope("Request", start, "RequestData", &requestData{
+			Ver:          2,
+			ID:           span.ID.SpanID.String(),
+			Name:         span.Name,
+			Duration:     formatDuration(duration),
+			ResponseCode: code,
+			Success:      success,
+			Properties:   properties,
+		})
+	}
+	item.Tags["ai.operation.id"] = span.ID.TraceID.String()
+	item.Tags["ai.operation.name"] = span.Name
+	return item
+}
+
+func (e *Exporter) appendMetrics(items []*envelope, data metric.Data, now time.Time) []*envelope {
+	add := func(group []label.Label, p dataPoint) {
+		properties := make(map[string]string)
+		for _, l := range group {
+			addProperty(properties, l)
+		}
+		if len(properties) == 0 {
+			properties = nil
+		}
+		p.Name = data.Handle()
+		items = append(items, e.newEnvelope("Metric", now, "MetricData", &metricData{
+			Ver:        2,
+			Metrics:    []dataPoint{p},
+			Properties: properties,
+		}))
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			add(group, dataPoint{Kind: measurement, Value: float64(data.Rows[i])})
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			add(group, dataPoint{Kind: measurement, Value: data.Rows[i]})
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			count, min, max := row.Count, float64(row.Min), float64(row.Max)
+			add(group, dataPoint{Kind: aggregation, Value: float64(row.Sum), Count: &count, Min: &min, Max: &max})
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			count, min, max := row.Count, row.Min, row.Max
+			add(group, dataPoint{Kind: aggregation, Value: row.Sum, Count: &count, Min: &min, Max: &max})
+		}
+	}
+	return items
+}
+
+func addProperty(properties map[string]string, l label.Label) {
+	if l.Valid() {
+		properties[l.Key().Name()] = fmt.Sprint(export.LabelValue(l))
+	}
+}
+
+// formatDuration formats d as days.hours:minutes:seconds.fraction, as the
+// track API expects.
+func formatDuration(d time.Duration) string {
+	ticks := int64(d / 100) // the fraction has a precision of 100ns
+	return fmt.Sprintf("%d.%02d:%02d:%02d.%07d",
+		ticks/(864e9),
+		ticks/(36e9)%24,
+		ticks/(6e8)%60,
+		ticks/(1e7)%60,
+		ticks%1e7)
+}
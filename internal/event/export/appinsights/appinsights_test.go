@@ -0,0 +1,133 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package appinsights_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/appinsights"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+// steppingClock moves forward by a second every time it is read.
+type steppingClock struct {
+	now time.Time
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func collector(t *testing.T) (*httptest.Server, *[]string) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/track" {
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, string(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func checkContains(t *testing.T, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("request %s\ndoes not contain %s", got, w)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	srv, got := collector(t)
+	f := &finished{}
+	event.SetClock(&steppingClock{now: time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)})
+	defer event.SetClock(nil)
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	_, childDone := event.Start(ctx, "parse")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	childDone()
+	done()
+	event.SetExporter(nil)
+
+	exporter, err := appinsights.New(&appinsights.Config{
+		ConnectionString: "InstrumentationKey=0000-1111;IngestionEndpoint=" + srv.URL + "/",
+		Service:          "gopls",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*got))
+	}
+	parent := f.spans[1]
+	checkContains(t, (*got)[0],
+		`"name":"Microsoft.ApplicationInsights.00001111.RemoteDependency"`,
+		`"baseType":"RemoteDependencyData","baseData":{"ver":2,"id":"`+f.spans[0].ID.SpanID.String()+`","name":"parse","duration":"0.00:00:02.0000000","resultCode":"0","success":true,"type":"InProc"}`,
+		`"ai.operation.parentId":"`+parent.ID.SpanID.String()+`"`,
+		`"name":"Microsoft.ApplicationInsights.00001111.Request","time":"2020-03-05T14:27:49Z","iKey":"0000-1111"`,
+		`"ai.cloud.role":"gopls"`,
+		`"ai.operation.id":"`+parent.ID.TraceID.String()+`"`,
+		`"duration":"0.00:00:04.0000000","responseCode":"1","success":false,"properties":{"error":"failed: timeout","file":"main.go"}`,
+	)
+}
+
+func TestMetrics(t *testing.T) {
+	srv, got := collector(t)
+	exporter, err := appinsights.New(&appinsights.Config{ConnectionString: "InstrumentationKey=key;IngestionEndpoint=" + srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.HistogramFloat64{Name: "latency_ms", Buckets: []float64{1, 10}}.Record(&m, latency)
+	var data []metric.Data
+	event.SetExporter(m.Exporter(export.MetricsOnly(metricsFunc(func(metrics []metric.Data) { data = metrics }))))
+	defer event.SetExporter(nil)
+	event.Metric(context.Background(), latency.Of(2))
+	event.Metric(context.Background(), latency.Of(4))
+
+	if err := exporter.ExportMetrics(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	checkContains(t, (*got)[0],
+		`"baseType":"MetricData","baseData":{"ver":2,"metrics":[{"name":"latency_ms","kind":1,"value":6,"count":2,"min":2,"max":4}]}`,
+	)
+}
+
+type metricsFunc func([]metric.Data)
+
+func (f metricsFunc) ProcessMetrics(ctx context.Context, metrics []metric.Data) { f(metrics) }
+
+func TestMissingKey(t *testing.T) {
+	if _, err := appinsights.New(&appinsights.Config{ConnectionString: "IngestionEndpoint=https://example.com"}); err == nil {
+		t.Error("exporter created without an instrumentation key")
+	}
+}
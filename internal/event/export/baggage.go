@@ -0,0 +1,114 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// WithBaggage returns a context holding the baggage of ctx with key set to
+// value.
+// Baggage is a set of values, such as the name of the editor or a hash of the
+// workspace, that are carried through every operation of a request, across
+// processes by the propagation package, and can be copied onto every span
+// with BaggageLabels.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	old := baggageOf(ctx)
+	entries := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		entries[k] = v
+	}
+	entries[key] = value
+	return context.WithValue(ctx, baggageKey, entries)
+}
+
+// BaggageValue returns the value of the baggage entry of ctx with the given
+// key, and whether there is one.
+func BaggageValue(ctx context.Context, key string) (string, bool) {
+	value, ok := baggageOf(ctx)[key]
+	return value, ok
+}
+
+// BaggageKeys returns the keys of the baggage entries of ctx, in sorted
+// order.
+func BaggageKeys(ctx context.Context) []string {
+	entries := baggageOf(ctx)
+	result := make([]string, 0, len(entries))
+	for k := range entries {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// baggageOf returns the baggage entries of ctx, which must not be modified.
+func baggageOf(ctx context.Context) map[string]string {
+	entries, _ := ctx.Value(baggageKey).(map[string]string)
+	return entries
+}
+
+var (
+	baggageKeysMu sync.Mutex
+	// baggageLabelKeys holds the label keys of the baggage entries copied
+	// onto spans, so that every span uses the same key for an entry.
+	baggageLabelKeys = make(map[string]*keys.String)
+)
+
+// baggageLabelKey returns the label key for the baggage entry with the given
+// key.
+func baggageLabelKey(key string) *keys.String {
+	baggageKeysMu.Lock()
+	defer baggageKeysMu.Unlock()
+	k, ok := baggageLabelKeys[key]
+	if !ok {
+		k = keys.NewString(key, "A baggage entry.")
+		baggageLabelKeys[key] = k
+	}
+	return k
+}
+
+// BaggageLabels returns middleware that copies the baggage entries with the
+// given keys, or all of them if none are given, onto every span as it starts,
+// as labels named by the keys, so that the backends can search the spans by
+// them.
+// It must be wrapped by Spans.
+func BaggageLabels(names ...string) Middleware {
+	return func(output event.Exporter) event.Exporter {
+		return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsStart(ev) {
+				if span := GetSpan(ctx); span != nil {
+					addBaggageLabels(ctx, span, names)
+				}
+			}
+			return output(ctx, ev, lm)
+		}
+	}
+}
+
+func addBaggageLabels(ctx context.Context, span *Span, names []string) {
+	entries := baggageOf(ctx)
+	if len(entries) == 0 {
+		return
+	}
+	if len(names) == 0 {
+		names = BaggageKeys(ctx)
+	}
+	var labels []label.Label
+	for _, name := range names {
+		if value, ok := entries[name]; ok {
+			labels = append(labels, baggageLabelKey(name).Of(value))
+		}
+	}
+	if len(labels) > 0 {
+		span.AddLabels(labels...)
+	}
+}
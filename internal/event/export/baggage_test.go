@@ -0,0 +1,48 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestBaggageLabels(t *testing.T) {
+	var spans []*export.Span
+	event.SetExporter(export.Wrap(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			spans = append(spans, export.GetSpan(ctx))
+		}
+		return ctx
+	}, export.Spans, export.BaggageLabels("client")))
+	defer event.SetExporter(nil)
+
+	ctx := export.WithBaggage(context.Background(), "client", "vscode")
+	ctx = export.WithBaggage(ctx, "secret", "hidden")
+	ctx, done := event.Start(ctx, "request")
+	_, childDone := event.Start(ctx, "child")
+	childDone()
+	done()
+	_, plainDone := event.Start(context.Background(), "plain")
+	plainDone()
+
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	for i, want := range []string{"[client=\"vscode\"]", "[client=\"vscode\"]", "[]"} {
+		if got := fmt.Sprint(spans[i].Labels()); got != want {
+			t.Errorf("%s has labels %s, want %s", spans[i].Name, got, want)
+		}
+	}
+	if got := export.BaggageKeys(ctx); len(got) != 2 || got[0] != "client" || got[1] != "secret" {
+		t.Errorf("BaggageKeys() = %v, want [client secret]", got)
+	}
+}
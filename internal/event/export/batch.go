@@ -0,0 +1,171 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// BatchExporter is implemented by backends that deliver many finished spans
+// or metrics at once.
+// Unlike an event.Exporter, a BatchExporter reports whether delivery
+// succeeded, which allows wrappers such as Retry to act on failures.
+type BatchExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+	ExportMetrics(ctx context.Context, metrics []metric.Data) error
+}
+
+// Batcher is an exporter that collects finished spans and metrics, and hands
+// them to a BatchExporter in batches.
+type Batcher struct {
+	exporter BatchExporter
+	maxBatch int
+	full     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	status StatusTracker
+
+	mu      sync.Mutex
+	spans   []*Span
+	metrics []metric.Data
+}
+
+// Batch returns a Batcher that delivers to exporter whenever maxBatch items
+// have been collected, or maxDelay has passed since the last delivery.
+// It must be wrapped by Spans, so that it can find the span that an end event
+// finishes, and by a metric.Config exporter if it is to see metrics.
+// All other events are ignored.
+// The Batcher is managed, so the package level Flush and Shutdown functions
+// will deliver whatever it is holding, and its status is reported by Statuses
+// until it is shut down.
+func Batch(exporter BatchExporter, maxBatch int, maxDelay time.Duration) *Batcher {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	b := &Batcher{
+		exporter: exporter,
+		maxBatch: maxBatch,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run(maxDelay)
+	Manage(b)
+	AddStatusReporter(b)
+	return b
+}
+
+// ProcessEvent implements event.Exporter.
+func (b *Batcher) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	switch {
+	case event.IsEnd(ev):
+		span := GetSpan(ctx)
+		if span == nil {
+			return ctx
+		}
+		b.mu.Lock()
+		b.spans = append(b.spans, span)
+		b.mu.Unlock()
+	case event.IsMetric(ev):
+		data, ok := metric.Entries.Get(lm).([]metric.Data)
+		if !ok || len(data) == 0 {
+			return ctx
+		}
+		b.mu.Lock()
+		b.metrics = append(b.metrics, data...)
+		b.mu.Unlock()
+	default:
+		return ctx
+	}
+	b.mu.Lock()
+	full := len(b.spans)+len(b.metrics) >= b.maxBatch
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return ctx
+}
+
+// Flush delivers everything collected so far.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	spans, metrics := b.spans, b.metrics
+	b.spans, b.metrics = nil, nil
+	b.mu.Unlock()
+	var firstErr error
+	if len(spans) > 0 {
+		start := core.Now()
+		firstErr = b.exporter.ExportSpans(ctx, spans)
+		b.observe(start, len(spans), firstErr)
+	}
+	if len(metrics) > 0 {
+		start := core.Now()
+		err := b.exporter.ExportMetrics(ctx, metrics)
+		if firstErr == nil {
+			firstErr = err
+		}
+		b.observe(start, len(metrics), err)
+	}
+	return firstErr
+}
+
+// Status implements StatusReporter.
+func (b *Batcher) Status() Status {
+	return b.status.Current("batch")
+}
+
+// observe records the size, delivery time and result of a batch that was
+// started at start.
+func (b *Batcher) observe(start time.Time, size int, err error) {
+	b.status.Record(err)
+	self.observe(
+		ExporterKind.Of("batch"),
+		BatchSize.Of(int64(size)),
+		ExportLatency.Of(float64(core.Now().Sub(start))/float64(time.Millisecond)),
+	)
+}
+
+// Shutdown stops the periodic delivery, and then delivers everything
+// collected so far.
+func (b *Batcher) Shutdown(ctx context.Context) error {
+	b.once.Do(func() { close(b.stop) })
+	<-b.done
+	Unmanage(b)
+	RemoveStatusReporter(b)
+	return b.Flush(ctx)
+}
+
+func (b *Batcher) run(maxDelay time.Duration) {
+	defer close(b.done)
+	var tick <-chan time.Time
+	if maxDelay > 0 {
+		ticker := time.NewTicker(maxDelay)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-b.full:
+		case <-tick:
+		case <-b.stop:
+			return
+		}
+		ctx, cancel := TimeoutContext(context.Background())
+		ReportError(b.Flush(ctx))
+		cancel()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+)
+
+// batchRecorder is a BatchExporter that records the size of each batch.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []int
+	err     error
+	sent    chan struct{}
+}
+
+func (r *batchRecorder) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	r.mu.Lock()
+	r.batches = append(r.batches, len(spans))
+	err := r.err
+	r.mu.Unlock()
+	if r.sent != nil {
+		r.sent <- struct{}{}
+	}
+	return err
+}
+
+func (r *batchRecorder) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+func (r *batchRecorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.batches...)
+}
+
+func TestBatch(t *testing.T) {
+	r := &batchRecorder{sent: make(chan struct{}, 10)}
+	b := export.Batch(r, 3, time.Hour)
+	event.SetExporter(export.Spans(b.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		_, done := event.Start(ctx, "span")
+		done()
+	}
+	select {
+	case <-r.sent:
+	case <-time.After(10 * time.Second):
+		t.Fatal("full batch was not delivered")
+	}
+	if err := b.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := r.sizes()
+	total := 0
+	for _, size := range got {
+		total += size
+	}
+	if total != 4 || got[0] < 3 {
+		t.Errorf("got batches of %v, want a batch of at least 3 and then the rest", got)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreaker while it is refusing to call
+// the exporter it wraps.
+var ErrCircuitOpen = errors.New("telemetry exporter circuit is open")
+
+// CircuitOpen is attached to the log event a CircuitBreaker emits when it
+// changes state.
+var CircuitOpen = keys.NewBoolean("circuit_open", "whether an exporter circuit breaker is open")
+
+// CircuitBreaker is a BatchExporter that stops calling the exporter it wraps
+// once it has failed too many times in a row.
+type CircuitBreaker struct {
+	exporter  BatchExporter
+	threshold int
+	probe     time.Duration
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	lastTry  time.Time
+}
+
+// Breaker returns a CircuitBreaker that opens after threshold consecutive
+// failures of exporter.
+// While it is open, batches are rejected with ErrCircuitOpen without calling
+// the exporter, except for a single probe every probe interval.
+// The circuit closes again as soon as a probe succeeds.
+// Each change of state is announced with a log event carrying the
+// CircuitOpen label.
+func Breaker(exporter BatchExporter, threshold int, probe time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{exporter: exporter, threshold: threshold, probe: probe}
+}
+
+// Open reports whether the circuit is currently open.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+func (b *CircuitBreaker) ExportSpans(ctx context.Context, spans []*Span) error {
+	return b.call(ctx, func() error { return b.exporter.ExportSpans(ctx, spans) })
+}
+
+func (b *CircuitBreaker) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return b.call(ctx, func() error { return b.exporter.ExportMetrics(ctx, metrics) })
+}
+
+func (b *CircuitBreaker) call(ctx context.Context, export func() error) error {
+	b.mu.Lock()
+	now := core.Now()
+	if b.open {
+		if now.Sub(b.lastTry) < b.probe {
+			b.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		// Claim the probe, so that concurrent callers are still rejected.
+		b.lastTry = now
+	}
+	b.mu.Unlock()
+
+	err := export()
+
+	b.mu.Lock()
+	wasOpen := b.open
+	if err == nil {
+		b.failures = 0
+		b.open = false
+	} else {
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open = true
+			b.lastTry = core.Now()
+		}
+	}
+	changed := b.open != wasOpen
+	b.mu.Unlock()
+
+	// The state change is logged without the lock held, as delivering the
+	// event may lead straight back into this exporter.
+	if changed {
+		if wasOpen {
+			event.Log(ctx, "telemetry exporter recovered", CircuitOpen.Of(false))
+		} else {
+			event.Log(ctx, "telemetry exporter failing, circuit opened", CircuitOpen.Of(true))
+		}
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestBreaker(t *testing.T) {
+	var changes []bool
+	event.SetExporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if lm.Find(export.CircuitOpen).Valid() {
+			changes = append(changes, export.CircuitOpen.Get(lm))
+		}
+		return ctx
+	})
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	f := &flakyExporter{failures: 3}
+	b := export.Breaker(f, 2, 20*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := b.ExportSpans(ctx, nil); err == nil || err == export.ErrCircuitOpen {
+			t.Fatalf("attempt %d: got %v, want the exporter's error", i, err)
+		}
+	}
+	if !b.Open() {
+		t.Fatal("circuit did not open after 2 failures")
+	}
+	if err := b.ExportSpans(ctx, nil); err != export.ErrCircuitOpen {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if f.attempts != 2 {
+		t.Fatalf("open circuit called the exporter, got %d attempts", f.attempts)
+	}
+
+	// The first probe fails, the second closes the circuit again.
+	for _, wantErr := range []bool{true, false} {
+		time.Sleep(30 * time.Millisecond)
+		if err := b.ExportMetrics(ctx, nil); (err != nil) != wantErr {
+			t.Fatalf("probe got %v, want error %v", err, wantErr)
+		}
+	}
+	if b.Open() {
+		t.Fatal("circuit did not close after a successful probe")
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("got state changes %v, want [true false]", changes)
+	}
+}
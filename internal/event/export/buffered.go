@@ -0,0 +1,194 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DropPolicy decides which events a Queue drops when it is full.
+type DropPolicy int
+
+const (
+	// DropNewest drops the event being added to a full queue.
+	DropNewest DropPolicy = iota
+	// DropOldest makes room in a full queue by dropping the event that has been
+	// waiting longest.
+	DropOldest
+)
+
+// Queue is an exporter that delivers events to another exporter from a
+// separate goroutine, so that a slow exporter does not hold up the code being
+// instrumented.
+type Queue struct {
+	output  event.Exporter
+	policy  DropPolicy
+	queue   chan queued
+	flushes chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	closed  int32 // accessed atomically
+	dropped int64 // accessed atomically
+	// sampled and reported describe the queue as last seen by sample.
+	sampled  int
+	reported int64
+}
+
+type queued struct {
+	ctx context.Context
+	ev  core.Event
+	lm  label.Map
+}
+
+// Buffered returns a Queue that holds up to size events waiting for delivery
+// to output.
+// Because output is called asynchronously, any context it returns is
+// discarded, so exporters that annotate the context (such as Spans and
+// Labels) must be wrapped around the Queue rather than be fed by it.
+// The Queue is managed, so the package level Flush and Shutdown functions
+// will drain it.
+func Buffered(output event.Exporter, size int, policy DropPolicy) *Queue {
+	if size < 1 {
+		size = 1
+	}
+	q := &Queue{
+		output:  output,
+		policy:  policy,
+		queue:   make(chan queued, size),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	Manage(q)
+	self.addSampler(q, q.sample)
+	return q
+}
+
+// ProcessEvent implements event.Exporter.
+func (q *Queue) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if atomic.LoadInt32(&q.closed) != 0 {
+		atomic.AddInt64(&q.dropped, 1)
+		return ctx
+	}
+	item := queued{ctx: ctx, ev: ev, lm: lm}
+	for {
+		select {
+		case q.queue <- item:
+			return ctx
+		default:
+		}
+		if q.policy != DropOldest {
+			atomic.AddInt64(&q.dropped, 1)
+			return ctx
+		}
+		select {
+		case <-q.queue:
+			atomic.AddInt64(&q.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Dropped returns the number of events dropped so far.
+func (q *Queue) Dropped() int64 {
+	return atomic.LoadInt64(&q.dropped)
+}
+
+// Len returns the number of events waiting to be delivered.
+func (q *Queue) Len() int {
+	return len(q.queue)
+}
+
+// sample describes the queue for the exporter metrics, if it has changed
+// since the last time it was called.
+// It is only called from the self reporting goroutine.
+func (q *Queue) sample() []label.Label {
+	depth, dropped := q.Len(), q.Dropped()
+	if depth == q.sampled && dropped == q.reported {
+		return nil
+	}
+	labels := []label.Label{
+		ExporterKind.Of("buffered"),
+		QueueDepth.Of(int64(depth)),
+		DroppedEvents.Of(dropped - q.reported),
+	}
+	q.sampled, q.reported = depth, dropped
+	return labels
+}
+
+// Flush waits until all the events queued before it was called have been
+// delivered, or the context is done.
+func (q *Queue) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case q.flushes <- flushed:
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown delivers all the queued events and then stops the delivery
+// goroutine.
+// Events that arrive after Shutdown has been called are dropped.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&q.closed, 1)
+	Unmanage(q)
+	self.removeSampler(q)
+	err := q.Flush(ctx)
+	q.once.Do(func() { close(q.stop) })
+	return err
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case item := <-q.queue:
+			q.deliver(item)
+		case flushed := <-q.flushes:
+			q.drain()
+			close(flushed)
+		case <-q.stop:
+			q.drain()
+			return
+		}
+	}
+}
+
+// drain delivers the events that were in the queue when it was called.
+// Events queued while it runs are left for later, so that steady traffic
+// cannot keep a flush from completing.
+func (q *Queue) drain() {
+	for n := len(q.queue); n > 0; n-- {
+		select {
+		case item := <-q.queue:
+			q.deliver(item)
+		default:
+			// DropOldest producers took the rest.
+			return
+		}
+	}
+}
+
+func (q *Queue) deliver(item queued) {
+	deliverIsolated(item.ctx, q.output, item.ev, item.lm)
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestBuffered(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		policy export.DropPolicy
+		want   []string
+	}{
+		{"newest", export.DropNewest, []string{"log 1", "log 2"}},
+		{"oldest", export.DropOldest, []string{"log 3", "log 4"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := &recorder{}
+			release := make(chan struct{})
+			blocked := make(chan struct{})
+			first := true
+			// the first event blocks the delivery goroutine until released
+			output := func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+				if first {
+					first = false
+					close(blocked)
+					<-release
+					return ctx
+				}
+				return r.ProcessEvent(ctx, ev, lm)
+			}
+			q := export.Buffered(output, 2, test.policy)
+			event.SetExporter(q.ProcessEvent)
+			defer event.SetExporter(nil)
+
+			ctx := context.Background()
+			event.Log(ctx, "0")
+			<-blocked
+			for _, msg := range []string{"1", "2", "3", "4"} {
+				event.Log(ctx, msg)
+			}
+			if got := q.Dropped(); got != 2 {
+				t.Errorf("Dropped() = %d, want 2", got)
+			}
+			close(release)
+			if err := q.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+			r.check(t, test.want...)
+
+			event.Log(ctx, "after shutdown")
+			if got := q.Dropped(); got != 3 {
+				t.Errorf("Dropped() after shutdown = %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestBufferedFlushUnderLoad(t *testing.T) {
+	var q *export.Queue
+	var refill int32 = 1
+	// every delivery queues another event, so the queue is never empty
+	output := func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if atomic.LoadInt32(&refill) != 0 {
+			q.ProcessEvent(ctx, ev, lm)
+		}
+		return ctx
+	}
+	q = export.Buffered(output, 10, export.DropNewest)
+	event.SetExporter(q.ProcessEvent)
+	defer event.SetExporter(nil)
+	defer func() {
+		atomic.StoreInt32(&refill, 0)
+		q.Shutdown(context.Background())
+	}()
+	ctx := context.Background()
+	event.Log(ctx, "busy")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("Flush of a busy queue returned %v", err)
+	}
+}
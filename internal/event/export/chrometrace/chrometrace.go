@@ -0,0 +1,294 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chrometrace writes spans in the Chrome trace event format, so that
+// a session can be opened in chrome://tracing or the Perfetto UI.
+//
+// Each trace is given a thread of its own, named after its root span, so
+// that concurrent requests are shown on separate rows. Spans are written as
+// complete ("X") events when they finish, or as begin and end ("B" and "E")
+// pairs. The labels of a span are its args, and log events are instant
+// events on the thread of their trace.
+// Events are written as a JSON array, which is closed when the exporter is
+// shut down; the viewers also accept a file whose array was never closed.
+//
+// Importing the package registers a "chrometrace" exporter whose options are
+// the name of the file to write.
+package chrometrace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Phases selects how spans are written.
+type Phases int
+
+const (
+	// Complete writes a single event for each span when it finishes.
+	Complete Phases = iota
+	// BeginEnd writes an event when each span starts and another when it
+	// finishes, so spans that never finish are still shown.
+	BeginEnd
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Phases selects how spans are written.
+	Phases Phases
+	// Process is the pid of the events, it defaults to the current process.
+	Process int
+}
+
+func init() {
+	export.Register("chrometrace", func(filename string) (event.Exporter, export.Shutdowner, error) {
+		if filename == "" {
+			return nil, nil, fmt.Errorf("chrometrace exporter needs the name of a file")
+		}
+		f, err := os.Create(filename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("chrometrace exporter: %v", err)
+		}
+		exporter := New(f, &Config{})
+		export.Manage(exporter)
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter writes trace events.
+// It must be wrapped by export.Spans.
+type Exporter struct {
+	config Config
+	closer io.Closer // the writer, if it needs closing
+	start  time.Time
+
+	mu      sync.Mutex
+	w       *bufio.Writer
+	written bool // whether any event has been written
+	closed  bool
+	threads map[export.TraceID]*thread
+}
+
+// thread is the thread that the events of a trace are written to.
+type thread struct {
+	id    int
+	named bool
+}
+
+// traceEvent is a single event of the trace event format.
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Duration  *float64               `json:"dur,omitempty"`
+	Process   int                    `json:"pid"`
+	Thread    int                    `json:"tid"`
+	Category  string                 `json:"cat,omitempty"`
+	Scope     string                 `json:"s,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// New returns an Exporter that writes to w.
+// If w is an io.Closer, it is closed by Shutdown.
+func New(w io.Writer, config *Config) *Exporter {
+	resolved := *config
+	if resolved.Process == 0 {
+		resolved.Process = os.Getpid()
+	}
+	e := &Exporter{
+		config:  resolved,
+		start:   core.Now(),
+		w:       bufio.NewWriter(w),
+		threads: make(map[export.TraceID]*thread),
+	}
+	e.closer, _ = w.(io.Closer)
+	return e
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	span := export.GetSpan(ctx)
+	switch {
+	case event.IsLog(ev):
+		e.write(span, e.logEvent(ev))
+	case span == nil:
+	case event.IsStart(ev):
+		if e.config.Phases == BeginEnd {
+			e.write(span, e.beginEvent(span))
+		}
+	case event.IsEnd(ev):
+		e.write(span, e.endEvent(span))
+	}
+	return ctx
+}
+
+// Flush writes any buffered events.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.w.Flush()
+}
+
+// Shutdown closes the JSON array, and then the writer.
+// Events that arrive after it are dropped.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if !e.written {
+		e.w.WriteByte('[')
+	}
+	e.w.WriteString("\n]\n")
+	err := e.w.Flush()
+	if e.closer != nil {
+		if cerr := e.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// microseconds returns the timestamp of t.
+func (e *Exporter) microseconds(t time.Time) float64 {
+	return float64(t.Sub(e.start)) / float64(time.Microsecond)
+}
+
+func (e *Exporter) beginEvent(span *export.Span) *traceEvent {
+	ev := &traceEvent{
+		Name:      span.Name,
+		Phase:     "B",
+		Timestamp: e.microseconds(span.Start().At()),
+		Args:      make(map[string]interface{}),
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		addArg(ev.Args, span.Start().Label(i))
+	}
+	return ev
+}
+
+func (e *Exporter) endEvent(span *export.Span) *traceEvent {
+	if e.config.Phases == BeginEnd {
+		ev := &traceEvent{
+			Name:      span.Name,
+			Phase:     "E",
+			Timestamp: e.microseconds(span.Finish().At()),
+			Args:      make(map[string]interface{}),
+		}
+		for _, l := range span.Labels() {
+			addArg(ev.Args, l)
+		}
+		return ev
+	}
+	ev := e.beginEvent(span)
+	ev.Phase = "X"
+	duration := float64(span.Finish().At().Sub(span.Start().At())) / float64(time.Microsecond)
+	ev.Duration = &duration
+	for _, l := range span.Labels() {
+		addArg(ev.Args, l)
+	}
+	return ev
+}
+
+func (e *Exporter) logEvent(ev core.Event) *traceEvent {
+	msg := keys.Msg.From(ev.Label(0))
+	result := &traceEvent{
+		Name:      msg,
+		Phase:     "i",
+		Scope:     "t",
+		Category:  "log",
+		Timestamp: e.microseconds(ev.At()),
+		Args:      make(map[string]interface{}),
+	}
+	first := 1
+	if event.IsError(ev) {
+		result.Category = "error"
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			result.Args["error"] = err.Error()
+			result.Name = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		first = 2
+	}
+	for i := first; ev.Valid(i); i++ {
+		addArg(result.Args, ev.Label(i))
+	}
+	return result
+}
+
+// write writes an event on the thread of the trace of span, or on thread 0
+// if there is no span.
+func (e *Exporter) write(span *export.Span, ev *traceEvent) {
+	ev.Process = e.config.Process
+	e.mu.Lock()
+	err := e.writeLocked(span, ev)
+	e.mu.Unlock()
+	export.ReportError(err)
+}
+
+func (e *Exporter) writeLocked(span *export.Span, ev *traceEvent) error {
+	if e.closed {
+		return nil
+	}
+	if span != nil {
+		t, ok := e.threads[span.ID.TraceID]
+		if !ok {
+			t = &thread{id: len(e.threads) + 1}
+			e.threads[span.ID.TraceID] = t
+		}
+		// Name the thread after the root span of its trace. Viewers apply the
+		// name to the whole thread, even though the root span is normally the
+		// last to finish.
+		if !t.named && !span.ParentID.IsValid() {
+			t.named = true
+			if err := e.encode(&traceEvent{
+				Name:    "thread_name",
+				Phase:   "M",
+				Process: e.config.Process,
+				Thread:  t.id,
+				Args:    map[string]interface{}{"name": span.Name},
+			}); err != nil {
+				return err
+			}
+		}
+		ev.Thread = t.id
+	}
+	return e.encode(ev)
+}
+
+func (e *Exporter) encode(ev *traceEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("chrometrace failed to marshal event: %v", err)
+	}
+	if e.written {
+		e.w.WriteString(",\n")
+	} else {
+		e.w.WriteString("[\n")
+		e.written = true
+	}
+	if _, err := e.w.Write(data); err != nil {
+		return fmt.Errorf("chrometrace failed to write event: %v", err)
+	}
+	return nil
+}
+
+func addArg(args map[string]interface{}, l label.Label) {
+	if l.Valid() {
+		args[l.Key().Name()] = export.LabelValue(l)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chrometrace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/chrometrace"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// steppingClock moves forward by a millisecond every time it is read.
+type steppingClock struct {
+	now time.Time
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.now = c.now.Add(time.Millisecond)
+	return c.now
+}
+
+// record writes a trace with a child span and an error, and returns the
+// JSON that was written.
+func record(t *testing.T, phases chrometrace.Phases) string {
+	event.SetClock(&steppingClock{now: time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)})
+	defer event.SetClock(nil)
+	var buf bytes.Buffer
+	exporter := chrometrace.New(&buf, &chrometrace.Config{Phases: phases, Process: 7})
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	child, childDone := event.Start(ctx, "parse")
+	event.Error(child, "failed", errors.New("timeout"))
+	childDone()
+	done()
+	event.SetExporter(nil)
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Check that the output is a valid array, and then compact it for
+	// comparison.
+	var events []json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, buf.Bytes())
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, buf.Bytes())
+	return compact.String()
+}
+
+func TestComplete(t *testing.T) {
+	got := record(t, chrometrace.Complete)
+	want := `[` +
+		`{"name":"failed: timeout","ph":"i","ts":3000,"pid":7,"tid":1,"cat":"error","s":"t","args":{"error":"timeout"}},` +
+		`{"name":"parse","ph":"X","ts":2000,"dur":2000,"pid":7,"tid":1},` +
+		`{"name":"thread_name","ph":"M","ts":0,"pid":7,"tid":1,"args":{"name":"hover"}},` +
+		`{"name":"hover","ph":"X","ts":1000,"dur":4000,"pid":7,"tid":1,"args":{"file":"main.go"}}` +
+		`]`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBeginEnd(t *testing.T) {
+	got := record(t, chrometrace.BeginEnd)
+	want := `[` +
+		`{"name":"thread_name","ph":"M","ts":0,"pid":7,"tid":1,"args":{"name":"hover"}},` +
+		`{"name":"hover","ph":"B","ts":1000,"pid":7,"tid":1,"args":{"file":"main.go"}},` +
+		`{"name":"parse","ph":"B","ts":2000,"pid":7,"tid":1},` +
+		`{"name":"failed: timeout","ph":"i","ts":3000,"pid":7,"tid":1,"cat":"error","s":"t","args":{"error":"timeout"}},` +
+		`{"name":"parse","ph":"E","ts":4000,"pid":7,"tid":1},` +
+		`{"name":"hover","ph":"E","ts":5000,"pid":7,"tid":1}` +
+		`]`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := chrometrace.New(&buf, &chrometrace.Config{})
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var events []json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil || len(events) != 0 {
+		t.Errorf("got %q, want an empty array", buf.String())
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package codec defines a stable wire representation of telemetry, so that
+// exporters, tools that record and replay telemetry, and programs outside
+// this module can exchange events, spans and metrics.
+//
+// The representation is the protocol buffer encoding of the messages in
+// telemetry.proto. A Batch records the version of the schema it was written
+// with, and Unmarshal rejects versions it does not know. Within a version
+// fields are only ever added, and Unmarshal skips fields it does not know, so
+// older readers can decode batches written by newer writers.
+package codec
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Version is the version of the schema written by Marshal.
+const Version = 1
+
+// Batch is a group of telemetry values that is encoded as one message.
+type Batch struct {
+	// Version is the version of the schema, Marshal writes Version if it is
+	// zero.
+	Version uint32
+	Events  []*Event
+	Spans   []*Span
+	Metrics []*Metric
+}
+
+// Label is a key and a value, which is one of string, int64, uint64, float64
+// or bool.
+type Label struct {
+	Key   string
+	Value interface{}
+}
+
+// EventKind is the kind of function an event was built by.
+type EventKind int32
+
+const (
+	UnknownEvent = EventKind(iota)
+	LogEvent
+	ErrorEvent
+	StartEvent
+	EndEvent
+	MetricEvent
+	LabelEvent
+	DetachEvent
+)
+
+// Event is a single event.
+type Event struct {
+	Time time.Time
+	Kind EventKind
+	// Message is the message of a log or error event, or the name of the span
+	// for a start event.
+	Message string
+	// Error is the message of the error of an error event.
+	Error  string
+	Labels []Label
+	// TraceID and SpanID identify the span the event happened in, they are
+	// zero if there is none.
+	TraceID export.TraceID
+	SpanID  export.SpanID
+}
+
+// Span is a span, along with the log events that happened within it.
+type Span struct {
+	TraceID  export.TraceID
+	SpanID   export.SpanID
+	ParentID export.SpanID
+	Name     string
+	Start    time.Time
+	// End is zero if the span has not finished.
+	End    time.Time
+	Labels []Label
+	Events []*Event
+}
+
+// MetricType is the kind of value a metric holds.
+type MetricType int32
+
+const (
+	UnknownMetric = MetricType(iota)
+	Counter
+	Gauge
+	Histogram
+	// UpDownCounter is a sum that may decrease.
+	UpDownCounter
+)
+
+// Metric is the latest value of every series of a metric.
+type Metric struct {
+	Name        string
+	Description string
+	// Unit is the unit of the values, such as metric.UnitMilliseconds.
+	Unit string
+	Type MetricType
+	Time time.Time
+	// Bounds are the inclusive upper bounds of the buckets of a histogram.
+	Bounds []float64
+	Series []*Series
+}
+
+// Series is the value of a metric for one group of labels.
+type Series struct {
+	Labels []Label
+	// Value is the value of a counter or gauge.
+	Value float64
+	// The remaining fields are only set for histograms, BucketCounts holds the
+	// number of values no greater than each of the bounds.
+	Count        int64
+	Sum          float64
+	Min          float64
+	Max          float64
+	BucketCounts []int64
+}
+
+// FromEvent converts an event, identifying its span from the context.
+func FromEvent(ctx context.Context, ev core.Event) *Event {
+	var id export.SpanContext
+	if span := export.GetSpan(ctx); span != nil {
+		id = span.ID
+	}
+	return fromEvent(ev, id)
+}
+
+func fromEvent(ev core.Event, id export.SpanContext) *Event {
+	e := &Event{Time: ev.At(), TraceID: id.TraceID, SpanID: id.SpanID}
+	first := 1
+	switch {
+	case event.IsError(ev):
+		e.Kind = ErrorEvent
+		e.Message = keys.Msg.From(ev.Label(0))
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			e.Error = err.Error()
+		}
+		first = 2
+	case event.IsLog(ev):
+		e.Kind = LogEvent
+		e.Message = keys.Msg.From(ev.Label(0))
+	case event.IsStart(ev):
+		e.Kind = StartEvent
+		e.Message = keys.Start.From(ev.Label(0))
+	case event.IsEnd(ev):
+		e.Kind = EndEvent
+	case event.IsMetric(ev):
+		e.Kind = MetricEvent
+	case event.IsLabel(ev):
+		e.Kind = LabelEvent
+	case event.IsDetach(ev):
+		e.Kind = DetachEvent
+	default:
+		first = 0
+	}
+	for i := first; ev.Valid(i); i++ {
+		e.Labels = appendLabel(e.Labels, ev.Label(i))
+	}
+	return e
+}
+
+// FromSpan converts a span and the events recorded in it.
+func FromSpan(span *export.Span) *Span {
+	s := &Span{
+		TraceID:  span.ID.TraceID,
+		SpanID:   span.ID.SpanID,
+		ParentID: span.ParentID,
+		Name:     span.Name,
+		Start:    span.Start().At(),
+		End:      span.Finish().At(),
+	}
+	start := span.Start()
+	for i := 1; start.Valid(i); i++ {
+		s.Labels = appendLabel(s.Labels, start.Label(i))
+	}
+	for _, l := range span.Labels() {
+		s.Labels = appendLabel(s.Labels, l)
+	}
+	for _, ev := range span.Events() {
+		s.Events = append(s.Events, fromEvent(ev, span.ID))
+	}
+	return s
+}
+
+// FromMetric converts the latest values of a metric.
+func FromMetric(data metric.Data) *Metric {
+	m := &Metric{Name: data.Handle(), Unit: metric.UnitOf(data)}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		m.Description, m.Type, m.Time = data.Info.Description, scalarType(data.IsGauge, data.IsUpDown), data.EndTime
+		for i, group := range groups {
+			m.Series = append(m.Series, &Series{Labels: fromGroup(group), Value: float64(data.Rows[i])})
+		}
+	case *metric.Float64Data:
+		m.Description, m.Type, m.Time = data.Info.Description, scalarType(data.IsGauge, data.IsUpDown), data.EndTime
+		for i, group := range groups {
+			m.Series = append(m.Series, &Series{Labels: fromGroup(group), Value: data.Rows[i]})
+		}
+	case *metric.HistogramInt64Data:
+		m.Description, m.Type, m.Time = data.Info.Description, Histogram, data.EndTime
+		for _, b := range data.Info.Buckets {
+			m.Bounds = append(m.Bounds, float64(b))
+		}
+		for i, group := range groups {
+			row := data.Rows[i]
+			m.Series = append(m.Series, &Series{
+				Labels:       fromGroup(group),
+				Count:        row.Count,
+				Sum:          float64(row.Sum),
+				Min:          float64(row.Min),
+				Max:          float64(row.Max),
+				BucketCounts: append([]int64(nil), row.Values...),
+			})
+		}
+	case *metric.HistogramFloat64Data:
+		m.Description, m.Type, m.Time = data.Info.Description, Histogram, data.EndTime
+		m.Bounds = append([]float64(nil), data.Info.Buckets...)
+		for i, group := range groups {
+			row := data.Rows[i]
+			m.Series = append(m.Series, &Series{
+				Labels:       fromGroup(group),
+				Count:        row.Count,
+				Sum:          row.Sum,
+				Min:          row.Min,
+				Max:          row.Max,
+				BucketCounts: append([]int64(nil), row.Values...),
+			})
+		}
+	}
+	return m
+}
+
+func scalarType(isGauge, isUpDown bool) MetricType {
+	switch {
+	case isGauge:
+		return Gauge
+	case isUpDown:
+		return UpDownCounter
+	}
+	return Counter
+}
+
+func fromGroup(group []label.Label) []Label {
+	var result []Label
+	for _, l := range group {
+		result = appendLabel(result, l)
+	}
+	return result
+}
+
+func appendLabel(labels []Label, l label.Label) []Label {
+	if !l.Valid() {
+		return labels
+	}
+	return append(labels, Label{Key: l.Key().Name(), Value: export.LabelValue(l)})
+}
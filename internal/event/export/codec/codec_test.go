@@ -0,0 +1,162 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codec_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/codec"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestRoundTrip(t *testing.T) {
+	at := time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)
+	event.SetClock(fixedClock(at))
+	defer event.SetClock(nil)
+
+	method := keys.NewString("method", "")
+	count := keys.NewInt64("count", "")
+	size := keys.NewUInt32("size", "")
+	ratio := keys.NewFloat64("ratio", "")
+	cached := keys.NewBoolean("cached", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "calls", Description: "Number of calls", Keys: []label.Key{method}}.SumInt64(&m, count)
+	metric.HistogramFloat64{Name: "latency_ms", Buckets: []float64{0.5, 10}}.Record(&m, latency)
+
+	var batch codec.Batch
+	var span *export.Span
+	exporter := func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsMetric(ev):
+			for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+				batch.Metrics = append(batch.Metrics, codec.FromMetric(data))
+			}
+		case event.IsEnd(ev):
+			span = export.GetSpan(ctx)
+		}
+		batch.Events = append(batch.Events, codec.FromEvent(ctx, ev))
+		return ctx
+	}
+	ctx := event.WithExporter(context.Background(), export.Spans(m.Exporter(exporter)))
+	ctx, done := event.Start(ctx, "hover", method.Of("textDocument/hover"))
+	event.Log(ctx, "cache hit", size.Of(42), ratio.Of(0.25), cached.Of(true))
+	event.Error(ctx, "failed", errors.New("no package"), count.Of(-3))
+	event.Metric(ctx, method.Of("hover"), count.Of(2), latency.Of(1.5))
+	done()
+	batch.Spans = append(batch.Spans, codec.FromSpan(span))
+
+	var got codec.Batch
+	if err := codec.Unmarshal(codec.Marshal(&batch), &got); err != nil {
+		t.Fatal(err)
+	}
+	batch.Version = codec.Version
+	// Times decode in the local time zone.
+	for _, ev := range got.Events {
+		ev.Time = ev.Time.UTC()
+	}
+	for _, s := range got.Spans {
+		s.Start, s.End = s.Start.UTC(), s.End.UTC()
+		for _, ev := range s.Events {
+			ev.Time = ev.Time.UTC()
+		}
+	}
+	for _, m := range got.Metrics {
+		m.Time = m.Time.UTC()
+	}
+	if !reflect.DeepEqual(got, batch) {
+		t.Errorf("round trip changed the batch:\ngot  %+v\nwant %+v", got, batch)
+	}
+
+	if n := len(got.Events); n != 5 {
+		t.Fatalf("got %d events, want 5", n)
+	}
+	log := got.Events[1]
+	wantLabels := []codec.Label{{"size", uint64(42)}, {"ratio", 0.25}, {"cached", true}}
+	if log.Kind != codec.LogEvent || log.Message != "cache hit" || !reflect.DeepEqual(log.Labels, wantLabels) {
+		t.Errorf("got log event %+v", log)
+	}
+	if log.TraceID != span.ID.TraceID || log.SpanID != span.ID.SpanID {
+		t.Errorf("log event is in span %v:%v, want %v", log.TraceID, log.SpanID, &span.ID)
+	}
+	if e := got.Events[2]; e.Kind != codec.ErrorEvent || e.Error != "no package" || !reflect.DeepEqual(e.Labels, []codec.Label{{"count", int64(-3)}}) {
+		t.Errorf("got error event %+v", e)
+	}
+	if s := got.Spans[0]; s.Name != "hover" || len(s.Events) != 2 || !reflect.DeepEqual(s.Labels, []codec.Label{{"method", "textDocument/hover"}}) {
+		t.Errorf("got span %+v", s)
+	}
+	h := got.Metrics[1]
+	if h.Type != codec.Histogram || !reflect.DeepEqual(h.Bounds, []float64{0.5, 10}) || !reflect.DeepEqual(h.Series[0].BucketCounts, []int64{0, 1}) {
+		t.Errorf("got histogram %+v", h)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	data := codec.Marshal(&codec.Batch{Events: []*codec.Event{{Message: "hello"}}})
+	// A later version of the schema may add fields of any wire type.
+	data = append(data,
+		0x48, 0x96, 0x01, // field 9, varint 150
+		0x51, 1, 2, 3, 4, 5, 6, 7, 8, // field 10, fixed64
+		0x5a, 2, 'h', 'i', // field 11, bytes
+		0x65, 1, 2, 3, 4, // field 12, fixed32
+	)
+	var got codec.Batch
+	if err := codec.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Events) != 1 || got.Events[0].Message != "hello" {
+		t.Errorf("got events %+v", got.Events)
+	}
+}
+
+func TestUnpackedRepeated(t *testing.T) {
+	// bounds 1 and 2 as separate fixed64 fields, within a metric (field 4).
+	metric := []byte{
+		0x29, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f,
+		0x29, 0, 0, 0, 0, 0, 0, 0, 0x40,
+	}
+	data := append([]byte{0x08, codec.Version, 0x22, byte(len(metric))}, metric...)
+	var got codec.Batch
+	if err := codec.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Metrics) != 1 || !reflect.DeepEqual(got.Metrics[0].Bounds, []float64{1, 2}) {
+		t.Errorf("got metrics %+v", got.Metrics)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	for _, test := range []struct {
+		version uint32
+		ok      bool
+	}{
+		{0, true}, // Marshal fills in the current version.
+		{codec.Version, true},
+		{codec.Version + 1, false},
+	} {
+		var got codec.Batch
+		err := codec.Unmarshal(codec.Marshal(&codec.Batch{Version: test.version}), &got)
+		if (err == nil) != test.ok {
+			t.Errorf("unmarshaling version %d: got error %v, want ok %v", test.version, err, test.ok)
+		}
+	}
+	var got codec.Batch
+	if err := codec.Unmarshal([]byte{0x12, 5, 1}, &got); err == nil {
+		t.Errorf("unmarshaling a truncated batch succeeded")
+	}
+}
@@ -0,0 +1,536 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+// This file encodes and decodes the messages of telemetry.proto in the
+// protocol buffer wire format. Fields holding their zero value are omitted,
+// except for the members of a oneof.
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Marshal returns the encoding of the batch.
+func Marshal(b *Batch) []byte {
+	var e encoder
+	version := b.Version
+	if version == 0 {
+		version = Version
+	}
+	e.uint(1, uint64(version))
+	for _, ev := range b.Events {
+		e.message(2, ev.encode)
+	}
+	for _, s := range b.Spans {
+		e.message(3, s.encode)
+	}
+	for _, m := range b.Metrics {
+		e.message(4, m.encode)
+	}
+	return e.buf
+}
+
+// Unmarshal decodes a batch written by Marshal into b, replacing its
+// contents.
+func Unmarshal(data []byte, b *Batch) error {
+	*b = Batch{}
+	err := decode(data, func(d *decoder, field, wireType int) error {
+		switch {
+		case field == 1 && wireType == wireVarint:
+			v, err := d.varint()
+			b.Version = uint32(v)
+			return err
+		case field == 2 && wireType == wireBytes:
+			ev := &Event{}
+			b.Events = append(b.Events, ev)
+			return d.message(ev.decode)
+		case field == 3 && wireType == wireBytes:
+			s := &Span{}
+			b.Spans = append(b.Spans, s)
+			return d.message(s.decode)
+		case field == 4 && wireType == wireBytes:
+			m := &Metric{}
+			b.Metrics = append(b.Metrics, m)
+			return d.message(m.decode)
+		}
+		return d.skip(wireType)
+	})
+	if err != nil {
+		return fmt.Errorf("codec failed to unmarshal batch: %v", err)
+	}
+	if b.Version != Version {
+		return fmt.Errorf("codec cannot unmarshal batch of version %d, only version %d is supported", b.Version, Version)
+	}
+	return nil
+}
+
+func (l *Label) encode(e *encoder) {
+	e.string(1, l.Key)
+	switch v := l.Value.(type) {
+	case string:
+		e.tag(2, wireBytes)
+		e.bytes([]byte(v))
+	case int64:
+		e.tag(3, wireVarint)
+		e.varint(uint64(v))
+	case uint64:
+		e.tag(4, wireVarint)
+		e.varint(v)
+	case float64:
+		e.tag(5, wireFixed64)
+		e.fixed64(math.Float64bits(v))
+	case bool:
+		e.tag(6, wireVarint)
+		if v {
+			e.varint(1)
+		} else {
+			e.varint(0)
+		}
+	}
+}
+
+func (l *Label) decode(d *decoder, field, wireType int) error {
+	var err error
+	switch {
+	case field == 1 && wireType == wireBytes:
+		l.Key, err = d.string()
+	case field == 2 && wireType == wireBytes:
+		l.Value, err = d.string()
+	case field == 3 && wireType == wireVarint:
+		var v uint64
+		v, err = d.varint()
+		l.Value = int64(v)
+	case field == 4 && wireType == wireVarint:
+		l.Value, err = d.varint()
+	case field == 5 && wireType == wireFixed64:
+		l.Value, err = d.double()
+	case field == 6 && wireType == wireVarint:
+		var v uint64
+		v, err = d.varint()
+		l.Value = v != 0
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+func (ev *Event) encode(e *encoder) {
+	e.time(1, ev.Time)
+	e.uint(2, uint64(ev.Kind))
+	e.string(3, ev.Message)
+	e.string(4, ev.Error)
+	e.labels(5, ev.Labels)
+	if ev.TraceID != (export.TraceID{}) {
+		e.tag(6, wireBytes)
+		e.bytes(ev.TraceID[:])
+	}
+	if ev.SpanID.IsValid() {
+		e.tag(7, wireBytes)
+		e.bytes(ev.SpanID[:])
+	}
+}
+
+func (ev *Event) decode(d *decoder, field, wireType int) error {
+	var err error
+	switch {
+	case field == 1 && wireType == wireFixed64:
+		ev.Time, err = d.time()
+	case field == 2 && wireType == wireVarint:
+		var v uint64
+		v, err = d.varint()
+		ev.Kind = EventKind(v)
+	case field == 3 && wireType == wireBytes:
+		ev.Message, err = d.string()
+	case field == 4 && wireType == wireBytes:
+		ev.Error, err = d.string()
+	case field == 5 && wireType == wireBytes:
+		ev.Labels, err = d.label(ev.Labels)
+	case field == 6 && wireType == wireBytes:
+		err = d.id(ev.TraceID[:])
+	case field == 7 && wireType == wireBytes:
+		err = d.id(ev.SpanID[:])
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+func (s *Span) encode(e *encoder) {
+	e.tag(1, wireBytes)
+	e.bytes(s.TraceID[:])
+	e.tag(2, wireBytes)
+	e.bytes(s.SpanID[:])
+	if s.ParentID.IsValid() {
+		e.tag(3, wireBytes)
+		e.bytes(s.ParentID[:])
+	}
+	e.string(4, s.Name)
+	e.time(5, s.Start)
+	e.time(6, s.End)
+	e.labels(7, s.Labels)
+	for _, ev := range s.Events {
+		e.message(8, ev.encode)
+	}
+}
+
+func (s *Span) decode(d *decoder, field, wireType int) error {
+	var err error
+	switch {
+	case field == 1 && wireType == wireBytes:
+		err = d.id(s.TraceID[:])
+	case field == 2 && wireType == wireBytes:
+		err = d.id(s.SpanID[:])
+	case field == 3 && wireType == wireBytes:
+		err = d.id(s.ParentID[:])
+	case field == 4 && wireType == wireBytes:
+		s.Name, err = d.string()
+	case field == 5 && wireType == wireFixed64:
+		s.Start, err = d.time()
+	case field == 6 && wireType == wireFixed64:
+		s.End, err = d.time()
+	case field == 7 && wireType == wireBytes:
+		s.Labels, err = d.label(s.Labels)
+	case field == 8 && wireType == wireBytes:
+		ev := &Event{}
+		s.Events = append(s.Events, ev)
+		err = d.message(ev.decode)
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+func (m *Metric) encode(e *encoder) {
+	e.string(1, m.Name)
+	e.string(2, m.Description)
+	e.uint(3, uint64(m.Type))
+	e.time(4, m.Time)
+	if len(m.Bounds) > 0 {
+		e.tag(5, wireBytes)
+		e.varint(uint64(8 * len(m.Bounds)))
+		for _, b := range m.Bounds {
+			e.fixed64(math.Float64bits(b))
+		}
+	}
+	for _, s := range m.Series {
+		e.message(6, s.encode)
+	}
+	e.string(7, m.Unit)
+}
+
+func (m *Metric) decode(d *decoder, field, wireType int) error {
+	var err error
+	switch {
+	case field == 1 && wireType == wireBytes:
+		m.Name, err = d.string()
+	case field == 2 && wireType == wireBytes:
+		m.Description, err = d.string()
+	case field == 3 && wireType == wireVarint:
+		var v uint64
+		v, err = d.varint()
+		m.Type = MetricType(v)
+	case field == 4 && wireType == wireFixed64:
+		m.Time, err = d.time()
+	case field == 5 && wireType == wireFixed64:
+		var v float64
+		v, err = d.double()
+		m.Bounds = append(m.Bounds, v)
+	case field == 5 && wireType == wireBytes:
+		err = d.packed(func(d *decoder) error {
+			v, err := d.double()
+			m.Bounds = append(m.Bounds, v)
+			return err
+		})
+	case field == 6 && wireType == wireBytes:
+		s := &Series{}
+		m.Series = append(m.Series, s)
+		err = d.message(s.decode)
+	case field == 7 && wireType == wireBytes:
+		m.Unit, err = d.string()
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+func (s *Series) encode(e *encoder) {
+	e.labels(1, s.Labels)
+	e.double(2, s.Value)
+	e.uint(3, uint64(s.Count))
+	e.double(4, s.Sum)
+	e.double(5, s.Min)
+	e.double(6, s.Max)
+	if len(s.BucketCounts) > 0 {
+		var packed encoder
+		for _, c := range s.BucketCounts {
+			packed.varint(uint64(c))
+		}
+		e.tag(7, wireBytes)
+		e.bytes(packed.buf)
+	}
+}
+
+func (s *Series) decode(d *decoder, field, wireType int) error {
+	var err error
+	switch {
+	case field == 1 && wireType == wireBytes:
+		s.Labels, err = d.label(s.Labels)
+	case field == 2 && wireType == wireFixed64:
+		s.Value, err = d.double()
+	case field == 3 && wireType == wireVarint:
+		var v uint64
+		v, err = d.varint()
+		s.Count = int64(v)
+	case field == 4 && wireType == wireFixed64:
+		s.Sum, err = d.double()
+	case field == 5 && wireType == wireFixed64:
+		s.Min, err = d.double()
+	case field == 6 && wireType == wireFixed64:
+		s.Max, err = d.double()
+	case field == 7 && wireType == wireVarint:
+		var v uint64
+		v, err = d.varint()
+		s.BucketCounts = append(s.BucketCounts, int64(v))
+	case field == 7 && wireType == wireBytes:
+		err = d.packed(func(d *decoder) error {
+			v, err := d.varint()
+			s.BucketCounts = append(s.BucketCounts, int64(v))
+			return err
+		})
+	default:
+		err = d.skip(wireType)
+	}
+	return err
+}
+
+// encoder appends the protocol buffer encoding of fields to buf.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) fixed64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// message encodes a nested message, whose fields are written by f.
+func (e *encoder) message(field int, f func(*encoder)) {
+	var nested encoder
+	f(&nested)
+	e.tag(field, wireBytes)
+	e.bytes(nested.buf)
+}
+
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.tag(field, wireBytes)
+		e.bytes([]byte(s))
+	}
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.varint(v)
+	}
+}
+
+func (e *encoder) double(field int, v float64) {
+	if v != 0 {
+		e.tag(field, wireFixed64)
+		e.fixed64(math.Float64bits(v))
+	}
+}
+
+// time writes a time as fixed64 nanoseconds since the Unix epoch, the zero
+// time is omitted.
+func (e *encoder) time(field int, t time.Time) {
+	if !t.IsZero() {
+		e.tag(field, wireFixed64)
+		e.fixed64(uint64(t.UnixNano()))
+	}
+}
+
+func (e *encoder) labels(field int, labels []Label) {
+	for i := range labels {
+		e.message(field, labels[i].encode)
+	}
+}
+
+// decoder reads protocol buffer encoded fields from buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode calls f for every field in data, f must consume the value of the
+// field.
+func decode(data []byte, f func(d *decoder, field, wireType int) error) error {
+	d := &decoder{buf: data}
+	for len(d.buf) > 0 {
+		tag, err := d.varint()
+		if err != nil {
+			return err
+		}
+		field, wireType := int(tag>>3), int(tag&7)
+		if field == 0 {
+			return fmt.Errorf("invalid field number 0")
+		}
+		if err := f(d, field, wireType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) varint() (uint64, error) {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		if i >= len(d.buf) {
+			return 0, fmt.Errorf("truncated varint")
+		}
+		b := d.buf[i]
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			d.buf = d.buf[i+1:]
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("varint overflows 64 bits")
+}
+
+func (d *decoder) fixed64() (uint64, error) {
+	if len(d.buf) < 8 {
+		return 0, fmt.Errorf("truncated fixed64")
+	}
+	v := binary.LittleEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)) {
+		return nil, fmt.Errorf("truncated field of %d bytes", n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *decoder) string() (string, error) {
+	b, err := d.bytes()
+	return string(b), err
+}
+
+func (d *decoder) double() (float64, error) {
+	v, err := d.fixed64()
+	return math.Float64frombits(v), err
+}
+
+func (d *decoder) time() (time.Time, error) {
+	v, err := d.fixed64()
+	if err != nil || v == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(v)), nil
+}
+
+// id reads an identifier into id, which must be exactly its length.
+func (d *decoder) id(id []byte) error {
+	b, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	if len(b) != len(id) {
+		return fmt.Errorf("identifier has %d bytes, want %d", len(b), len(id))
+	}
+	copy(id, b)
+	return nil
+}
+
+// message decodes a nested message by calling f for each of its fields.
+func (d *decoder) message(f func(d *decoder, field, wireType int) error) error {
+	b, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	return decode(b, f)
+}
+
+// packed calls f until the values of a packed repeated field are consumed.
+func (d *decoder) packed(f func(d *decoder) error) error {
+	b, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	nested := &decoder{buf: b}
+	for len(nested.buf) > 0 {
+		if err := f(nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) label(labels []Label) ([]Label, error) {
+	var l Label
+	err := d.message(l.decode)
+	return append(labels, l), err
+}
+
+// skip discards the value of a field that is not known.
+func (d *decoder) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case wireVarint:
+		_, err = d.varint()
+	case wireFixed64:
+		_, err = d.fixed64()
+	case wireBytes:
+		_, err = d.bytes()
+	case wireFixed32:
+		if len(d.buf) < 4 {
+			return fmt.Errorf("truncated fixed32")
+		}
+		d.buf = d.buf[4:]
+	default:
+		err = fmt.Errorf("unsupported wire type %d", wireType)
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package config builds exporter pipelines from a JSON description, and
+// can keep the global exporter in sync with a configuration file.
+//
+// A configuration file looks like
+//
+//	{
+//		"exporters": [
+//			{"type": "ocagent", "endpoint": "localhost:55678"},
+//			{"type": "log", "endpoint": "errors"}
+//		],
+//		"filter": {"denySpans": ["cache."]},
+//		"sampling": 0.1,
+//		"runtimeMetrics": true,
+//		"processMetrics": true
+//	}
+//
+// where each type is the name of an exporter registered with export.Register,
+// and the endpoint is the options string handed to its factory.
+// The optional filter holds the fields of export.FilterOptions, and
+// runtimeMetrics and processMetrics add the metrics of
+// export.RegisterRuntimeMetrics and export.RegisterProcessMetrics.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+// Config describes an exporter pipeline.
+type Config struct {
+	// Exporters is the list of backends that all events are delivered to.
+	Exporters []Exporter `json:"exporters"`
+	// Filter, if set, restricts the telemetry delivered to the exporters.
+	Filter *export.FilterOptions `json:"filter,omitempty"`
+	// Sampling, if set, is the fraction of traces to deliver.
+	Sampling *float64 `json:"sampling,omitempty"`
+	// RuntimeMetrics, if set, adds metrics describing the Go runtime.
+	RuntimeMetrics bool `json:"runtimeMetrics,omitempty"`
+	// ProcessMetrics, if set, adds metrics describing the resources used by
+	// the process.
+	ProcessMetrics bool `json:"processMetrics,omitempty"`
+}
+
+// Exporter describes a single backend of the pipeline.
+type Exporter struct {
+	// Type is the name the exporter was registered under.
+	Type string `json:"type"`
+	// Endpoint is the options string passed to the exporter factory.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Parse decodes a JSON configuration.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing telemetry config: %w", err)
+	}
+	for i, e := range cfg.Exporters {
+		if e.Type == "" {
+			return nil, fmt.Errorf("parsing telemetry config: exporter %d has no type", i)
+		}
+	}
+	return cfg, nil
+}
+
+// Load reads and decodes a JSON configuration file.
+func Load(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Build constructs the exporter pipeline described by the configuration.
+// The backends are wrapped with the Labels and Spans exporters, so they are
+// presented with the full span and label context.
+// Along with the pipeline it returns the Shutdowner of the backends, which
+// must be shut down after the pipeline once it is no longer needed, it is
+// nil if the backends hold nothing.
+// If a backend cannot be built, those already built are shut down before the
+// error is returned.
+func (cfg *Config) Build() (*export.Pipeline, export.Shutdowner, error) {
+	opts := make([]export.Option, 0, len(cfg.Exporters)+2)
+	var shutdowners []interface{}
+	for _, e := range cfg.Exporters {
+		backend, shutdown, err := export.New(e.Type, e.Endpoint)
+		if err != nil {
+			if built := export.ShutdownAll(shutdowners...); built != nil {
+				ctx, cancel := export.TimeoutContext(context.Background())
+				export.ReportError(built.Shutdown(ctx))
+				cancel()
+			}
+			return nil, nil, err
+		}
+		opts = append(opts, export.WithBackend(backend))
+		if shutdown != nil {
+			shutdowners = append(shutdowners, shutdown)
+		}
+	}
+	if cfg.Filter != nil {
+		opts = append(opts, export.WithFilter(*cfg.Filter))
+	}
+	if cfg.Sampling != nil {
+		opts = append(opts, export.WithSampling(*cfg.Sampling))
+	}
+	if cfg.RuntimeMetrics {
+		opts = append(opts, export.WithRuntimeMetrics())
+	}
+	if cfg.ProcessMetrics {
+		opts = append(opts, export.WithProcessMetrics())
+	}
+	return export.NewPipeline(opts...), export.ShutdownAll(shutdowners...), nil
+}
+
+// handoverTimeout bounds how long a reload waits for the telemetry buffered by
+// the old exporter to be delivered.
+const handoverTimeout = 5 * time.Second
+
+// Watcher keeps the global exporter in sync with a configuration file.
+type Watcher struct {
+	filename string
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	// modified and size describe the version of the file last loaded.
+	// config is the configuration that current, and the backends it feeds,
+	// were built from. They are only accessed from the polling goroutine
+	// after construction.
+	modified time.Time
+	size     int64
+	config   *Config
+	current  *export.Pipeline
+	backends export.Shutdowner
+}
+
+// Watch loads the configuration file and installs the exporter it describes
+// as the global exporter.
+// It then checks the file for changes every interval, and swaps in a new
+// exporter whenever it does, shutting down the old one and its backends
+// first so that the new backends can reuse what they held, such as the
+// address a prometheus exporter listens on. Events that happen during the
+// swap are dropped.
+// If a changed file cannot be loaded, the error is passed to
+// export.ReportError and the previous exporter is left in place. If its
+// backends cannot be built, the error is reported and the previous
+// configuration is built again.
+func Watch(filename string, interval time.Duration) (*Watcher, error) {
+	w := &Watcher{
+		filename: filename,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+	go w.run(interval)
+	return w, nil
+}
+
+// Close stops watching the file.
+// It does not change the global exporter, or shut down the pipeline that was
+// last installed.
+func (w *Watcher) Close() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+func (w *Watcher) run(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.reload(); err != nil {
+				export.ReportError(err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// reload installs a new exporter if the configuration file has changed since
+// it was last loaded.
+func (w *Watcher) reload() error {
+	info, err := os.Stat(w.filename)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(w.modified) && info.Size() == w.size {
+		return nil
+	}
+	// Remember the version even if it fails, so a broken file is only reported
+	// once.
+	w.modified, w.size = info.ModTime(), info.Size()
+	cfg, err := Load(w.filename)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handoverTimeout)
+	defer cancel()
+	if w.current == nil {
+		if err := w.build(cfg); err != nil {
+			return err
+		}
+		// The exporter replaced by the first load was not built here, so all
+		// the managed exporters are flushed instead.
+		_, err := export.Handover(ctx, w.current.ProcessEvent)
+		return err
+	}
+	// Deliver anything the old pipeline is still holding, and release it and
+	// its backends, before the new backends are built.
+	_, retireErr := export.Handover(ctx, nil, w.current, w.backends)
+	previous := w.config
+	w.config, w.current, w.backends = nil, nil, nil
+	if err = w.build(cfg); err != nil {
+		// Rather than go without telemetry until the file is fixed, go back
+		// to the configuration it replaced.
+		if prevErr := w.build(previous); prevErr != nil {
+			export.ReportError(prevErr)
+		}
+	}
+	if w.current != nil {
+		event.SetExporter(w.current.ProcessEvent)
+	}
+	if err != nil {
+		return err
+	}
+	return retireErr
+}
+
+// build builds the pipeline described by cfg, and records it as the current
+// one.
+func (w *Watcher) build(cfg *Config) error {
+	pipeline, backends, err := cfg.Build()
+	if err != nil {
+		return err
+	}
+	w.config, w.current, w.backends = cfg, pipeline, backends
+	return nil
+}
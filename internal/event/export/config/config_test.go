@@ -0,0 +1,238 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/config"
+	"golang.org/x/tools/internal/event/label"
+
+	_ "golang.org/x/tools/internal/event/export/prometheus"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"empty", `{}`, false},
+		{"log", `{"exporters":[{"type":"log","endpoint":"errors"}]}`, false},
+		{"filter", `{"exporters":[{"type":"log"}],"filter":{"denySpans":["cache."]}}`, false},
+		{"sampling", `{"exporters":[{"type":"log"}],"sampling":0.5}`, false},
+		{"health metrics", `{"exporters":[{"type":"log"}],"runtimeMetrics":true,"processMetrics":true}`, false},
+		{"missing type", `{"exporters":[{"endpoint":"errors"}]}`, true},
+		{"bad json", `{"exporters":`, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := config.Parse([]byte(test.data))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Parse error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if _, _, err := cfg.Build(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	// The exporters are also called by the watcher as it reloads.
+	var mu sync.Mutex
+	counts := map[string]int{}
+	count := func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return counts[name]
+	}
+	for _, name := range []string{"watch-a", "watch-b"} {
+		name := name
+		export.Register(name, func(string) (event.Exporter, export.Shutdowner, error) {
+			return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+				mu.Lock()
+				counts[name]++
+				mu.Unlock()
+				return ctx
+			}, nil, nil
+		})
+	}
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "telemetry.json")
+	write := func(data string, modified time.Time) {
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"exporters":[{"type":"watch-a"}]}`, start)
+
+	other := &flushCounter{}
+	export.Manage(other)
+	defer export.Unmanage(other)
+	w, err := config.Watch(filename, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer event.SetExporter(nil)
+	event.Log(context.Background(), "first")
+	flushed := other.count()
+
+	write(`{"exporters":[{"type":"watch-b"}]}`, start.Add(time.Minute))
+	deadline := time.Now().Add(10 * time.Second)
+	for count("watch-b") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("exporter was not swapped after the config file changed")
+		}
+		time.Sleep(time.Millisecond)
+		event.Log(context.Background(), "second")
+	}
+	w.Close()
+	before := count("watch-a")
+	event.Log(context.Background(), "third")
+	if count("watch-a") != before {
+		t.Errorf("replaced exporter still receives events")
+	}
+	// Only the replaced pipeline is retired by a reload.
+	if other.count() != flushed {
+		t.Errorf("reload flushed an exporter that was not part of the old pipeline")
+	}
+}
+
+// flushCounter is a Flusher that counts how often it is flushed.
+type flushCounter struct {
+	mu      sync.Mutex
+	flushes int
+}
+
+func (f *flushCounter) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes++
+	return nil
+}
+
+func (f *flushCounter) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flushes
+}
+
+func TestReloadListeningBackend(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	var built []string
+	export.SetErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+	defer export.SetErrorHandler(nil)
+	export.Register("reload-marker", func(options string) (event.Exporter, export.Shutdowner, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		built = append(built, options)
+		return export.Null(), nil, nil
+	})
+	// waitFor waits until the marker exporter has been built with options.
+	waitFor := func(options string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			mu.Lock()
+			last := ""
+			if len(built) > 0 {
+				last = built[len(built)-1]
+			}
+			mu.Unlock()
+			if last == options {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("config %s was not loaded", options)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "telemetry.json")
+	start := time.Now().Add(-time.Hour)
+	write := func(n int, exporters string) {
+		data := fmt.Sprintf(`{"exporters":[%s{"type":"reload-marker","endpoint":"%d"}]}`, exporters, n)
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := start.Add(time.Duration(n) * time.Minute)
+		if err := os.Chtimes(filename, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prometheus := fmt.Sprintf(`{"type":"prometheus","endpoint":%q},`, address)
+
+	write(1, prometheus)
+	w, err := config.Watch(filename, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer event.SetExporter(nil)
+	// The marker follows the prometheus exporter, so it is only built if the
+	// address could be listened on again.
+	write(2, prometheus)
+	waitFor("2")
+	res, err := http.Get("http://" + address + "/metrics")
+	if err != nil {
+		t.Fatalf("reloaded prometheus exporter is not serving: %v", err)
+	}
+	res.Body.Close()
+	write(3, "")
+	waitFor("3")
+	w.Close()
+
+	l, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("prometheus exporter was not shut down by the reload: %v", err)
+	}
+	l.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) > 0 {
+		t.Errorf("reloads reported %v", errs)
+	}
+	if want := []string{"1", "2", "3"}; fmt.Sprint(built) != fmt.Sprint(want) {
+		t.Errorf("configs built in the order %v, want %v", built, want)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package csv appends periodic snapshots of metrics to a CSV file, so that
+// they can be opened in a spreadsheet.
+//
+// Every row has the columns timestamp, metric, labels and value. The
+// timestamp is the RFC 3339 time of the snapshot, and the labels are the
+// grouping labels of the series as key=value pairs separated by semicolons.
+// A histogram is written as a metric_bucket row for each bucket, with an le
+// label holding its bound, followed by metric_count and metric_sum rows.
+// A header row is written when the file is empty.
+//
+// A snapshot holds the latest value of every series seen so far, it is
+// written once an interval, but only if some metric has changed since the
+// previous one.
+//
+// Importing the package registers a "csv" exporter whose options are the name
+// of the file.
+package csv
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Header is the first row of a new file.
+var Header = []string{"timestamp", "metric", "labels", "value"}
+
+// DefaultInterval is the time between snapshots if none is configured.
+const DefaultInterval = time.Minute
+
+// Config configures an Exporter.
+type Config struct {
+	// Filename is the file snapshots are appended to, it is created if it
+	// does not exist.
+	Filename string
+	// Interval is the time between snapshots.
+	Interval time.Duration
+	// OmitHeader stops the header row being written to an empty file.
+	OmitHeader bool
+}
+
+func init() {
+	export.Register("csv", func(filename string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := New(&Config{Filename: filename})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter appends snapshots of the metrics it is given to a file.
+// It must be wrapped by a metric.Config exporter.
+type Exporter struct {
+	config Config
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	file    *os.File
+	w       *csv.Writer
+	metrics map[string]metric.Data
+	changed bool
+	closed  bool
+}
+
+var _ export.MetricExporter = (*Exporter)(nil)
+
+// New opens the file and returns an Exporter that appends to it.
+// The Exporter is managed, so the package level Flush and Shutdown functions
+// write a final snapshot.
+func New(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Filename == "" {
+		return nil, fmt.Errorf("csv exporter needs the name of a file")
+	}
+	if resolved.Interval <= 0 {
+		resolved.Interval = DefaultInterval
+	}
+	file, err := os.OpenFile(resolved.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("csv failed to open %s: %v", resolved.Filename, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("csv failed to open %s: %v", resolved.Filename, err)
+	}
+	e := &Exporter{
+		config:  resolved,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		file:    file,
+		w:       csv.NewWriter(file),
+		metrics: make(map[string]metric.Data),
+	}
+	if info.Size() == 0 && !resolved.OmitHeader {
+		e.w.Write(Header)
+		e.w.Flush()
+		if err := e.w.Error(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("csv failed to write %s: %v", resolved.Filename, err)
+		}
+	}
+	go e.run()
+	export.Manage(e)
+	return e, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if event.IsMetric(ev) {
+		e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	}
+	return ctx
+}
+
+// ProcessMetrics records the latest values of the metrics, so that they are
+// written with the next snapshot.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, data := range metrics {
+		e.metrics[data.Handle()] = data
+		e.changed = true
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := export.TimeoutContext(context.Background())
+			export.ReportError(e.Flush(ctx))
+			cancel()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Flush appends a snapshot to the file if any metric has changed since the
+// last one.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed || !e.changed {
+		return nil
+	}
+	e.changed = false
+	at := core.Now().UTC().Format(time.RFC3339)
+	names := make([]string, 0, len(e.metrics))
+	for name := range e.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, row := range rows(e.metrics[name]) {
+			e.w.Write(append([]string{at}, row...))
+		}
+	}
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return fmt.Errorf("csv failed to write %s: %v", e.config.Filename, err)
+	}
+	return nil
+}
+
+// Shutdown stops the periodic snapshots, writes a final one, and closes the
+// file.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	export.Unmanage(e)
+	err := e.Flush(ctx)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return err
+	}
+	e.closed = true
+	if cerr := e.file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("csv failed to close %s: %v", e.config.Filename, cerr)
+	}
+	return err
+}
+
+// rows returns the metric, labels and value columns for each series of the
+// metric.
+func rows(data metric.Data) [][]string {
+	var result [][]string
+	add := func(name string, group []label.Label, extra, value string) {
+		labels := formatLabels(group)
+		if extra != "" {
+			if labels != "" {
+				labels += ";"
+			}
+			labels += extra
+		}
+		result = append(result, []string{name, labels, value})
+	}
+	name := data.Handle()
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			add(name, group, "", strconv.FormatInt(data.Rows[i], 10))
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			add(name, group, "", formatFloat(data.Rows[i]))
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			for j, b := range data.Info.Buckets {
+				add(name+"_bucket", group, "le="+strconv.FormatInt(b, 10), strconv.FormatInt(row.Values[j], 10))
+			}
+			add(name+"_count", group, "", strconv.FormatInt(row.Count, 10))
+			add(name+"_sum", group, "", strconv.FormatInt(row.Sum, 10))
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			for j, b := range data.Info.Buckets {
+				add(name+"_bucket", group, "le="+formatFloat(b), strconv.FormatInt(row.Values[j], 10))
+			}
+			add(name+"_count", group, "", strconv.FormatInt(row.Count, 10))
+			add(name+"_sum", group, "", formatFloat(row.Sum))
+		}
+	}
+	return result
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatLabels renders the valid labels as key=value pairs separated by
+// semicolons.
+func formatLabels(group []label.Label) string {
+	var b strings.Builder
+	for _, l := range group {
+		if !l.Valid() {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(';')
+		}
+		fmt.Fprintf(&b, "%s=%v", l.Key().Name(), export.LabelValue(l))
+	}
+	return b.String()
+}
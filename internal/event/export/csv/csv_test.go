@@ -0,0 +1,84 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/csv"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestSnapshots(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.csv")
+	method := keys.NewString("method", "")
+	count := keys.NewInt64("count", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "calls", Keys: []label.Key{method}}.SumInt64(&m, count)
+	metric.HistogramFloat64{Name: "latency_ms", Buckets: []float64{0.5, 10}}.Record(&m, latency)
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)))
+	defer event.SetClock(nil)
+
+	exporter, err := csv.New(&csv.Config{Filename: filename, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := event.WithExporter(context.Background(), m.Exporter(exporter.ProcessEvent))
+	event.Metric(ctx, method.Of("hover, quick"), count.Of(2))
+	event.Metric(ctx, latency.Of(1.5))
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing has changed, so there is no second snapshot.
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 28, 48, 0, time.UTC)))
+	event.Metric(ctx, method.Of("hover, quick"), count.Of(1))
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the file appends without another header.
+	exporter, err = csv.New(&csv.Config{Filename: filename, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `timestamp,metric,labels,value
+2020-03-05T14:27:48Z,calls,"method=hover, quick",2
+2020-03-05T14:27:48Z,latency_ms_bucket,le=0.5,0
+2020-03-05T14:27:48Z,latency_ms_bucket,le=10,1
+2020-03-05T14:27:48Z,latency_ms_count,,1
+2020-03-05T14:27:48Z,latency_ms_sum,,1.5
+2020-03-05T14:28:48Z,calls,"method=hover, quick",3
+2020-03-05T14:28:48Z,latency_ms_bucket,le=0.5,0
+2020-03-05T14:28:48Z,latency_ms_bucket,le=10,1
+2020-03-05T14:28:48Z,latency_ms_count,,1
+2020-03-05T14:28:48Z,latency_ms_sum,,1.5
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package datadog submits spans to a local datadog agent using its trace
+// intake API.
+//
+// Spans are named following the datadog conventions, where the operation name
+// is generic and the resource describes the specific work done:
+//
+//   - the service is the configured service, or the value of a "service" label
+//   - the operation name is the span name up to its last dot, so that the span
+//     "lsp.Server.hover" is the operation "lsp.Server"
+//   - the resource is the full span name, or the value of a "resource.name"
+//     label
+//   - the type is the value of a "span.type" label, if there is one
+//
+// Numeric labels are sent as span metrics and all other labels as span meta.
+//
+// Importing the package registers a "datadog" exporter whose options are the
+// address of the agent.
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultAddress is the address the datadog agent listens on for traces.
+const DefaultAddress = "http://localhost:8126"
+
+type Config struct {
+	// Address is the base URL of the agent.
+	Address string
+	// Service is the default service of the spans, it defaults to the name of
+	// the binary.
+	Service string
+	// Env, if set, is sent as the env tag of every span.
+	Env string
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+func init() {
+	export.Register("datadog", func(address string) (event.Exporter, export.Shutdowner, error) {
+		if address != "" && !strings.Contains(address, "://") {
+			address = "http://" + address
+		}
+		exporter := New(&Config{Address: address})
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, batcher, nil
+	})
+}
+
+// Exporter is an export.BatchExporter that submits spans to the agent.
+// Metrics are ignored.
+type Exporter struct {
+	config Config
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that submits to the configured agent.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.Address == "" {
+		resolved.Address = DefaultAddress
+	}
+	resolved.Address = strings.TrimSuffix(resolved.Address, "/")
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(nil)
+	}
+	return &Exporter{config: resolved}
+}
+
+// Span is a span in the datadog trace intake format.
+type Span struct {
+	TraceID  uint64             `json:"trace_id"`
+	SpanID   uint64             `json:"span_id"`
+	ParentID uint64             `json:"parent_id"`
+	Name     string             `json:"name"`
+	Resource string             `json:"resource"`
+	Service  string             `json:"service"`
+	Type     string             `json:"type,omitempty"`
+	Start    int64              `json:"start"`
+	Duration int64              `json:"duration"`
+	Error    int32              `json:"error"`
+	Meta     map[string]string  `json:"meta,omitempty"`
+	Metrics  map[string]float64 `json:"metrics,omitempty"`
+}
+
+// ExportSpans submits the spans, grouped into their traces, in a single
+// request.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	var traces [][]*Span
+	index := make(map[uint64]int)
+	for _, s := range spans {
+		converted := e.convertSpan(s)
+		i, found := index[converted.TraceID]
+		if !found {
+			i = len(traces)
+			index[converted.TraceID] = i
+			traces = append(traces, nil)
+		}
+		traces[i] = append(traces[i], converted)
+	}
+	blob, err := json.Marshal(traces)
+	if err != nil {
+		return fmt.Errorf("datadog failed to marshal traces: %v", err)
+	}
+	uri := e.config.Address + "/v0.4/traces"
+	req, err := http.NewRequestWithContext(ctx, "PUT", uri, bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("datadog failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Datadog-Trace-Count", strconv.Itoa(len(traces)))
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("datadog failed to send traces: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("datadog rejected traces for %v: %v", uri, res.Status)
+	}
+	return nil
+}
+
+// ExportMetrics does nothing, metrics should be sent using the dogstatsd
+// exporter.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+func (e *Exporter) convertSpan(span *export.Span) *Span {
+	start, end := span.Start().At(), span.Finish().At()
+	result := &Span{
+		TraceID:  binary.BigEndian.Uint64(span.ID.TraceID[8:]),
+		SpanID:   binary.BigEndian.Uint64(span.ID.SpanID[:]),
+		ParentID: binary.BigEndian.Uint64(span.ParentID[:]),
+		Name:     span.Name,
+		Resource: span.Name,
+		Service:  e.config.Service,
+		Start:    start.UnixNano(),
+	}
+	if i := strings.LastIndexByte(span.Name, '.'); i > 0 {
+		result.Name = span.Name[:i]
+	}
+	if !end.IsZero() {
+		result.Duration = int64(end.Sub(start))
+	}
+	if e.config.Env != "" {
+		result.setMeta("env", e.config.Env)
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		result.addLabel(span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		result.addLabel(l)
+	}
+	for _, ev := range span.Events() {
+		if !event.IsError(ev) {
+			continue
+		}
+		result.Error = 1
+		msg := keys.Msg.From(ev.Label(0))
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		result.setMeta("error.msg", msg)
+	}
+	return result
+}
+
+func (s *Span) addLabel(l label.Label) {
+	if !l.Valid() {
+		return
+	}
+	name := l.Key().Name()
+	value := export.LabelValue(l)
+	switch name {
+	case "service":
+		s.Service = fmt.Sprint(value)
+		return
+	case "resource.name":
+		s.Resource = fmt.Sprint(value)
+		return
+	case "span.type":
+		s.Type = fmt.Sprint(value)
+		return
+	}
+	switch v := value.(type) {
+	case int64:
+		s.setMetric(name, float64(v))
+	case uint64:
+		s.setMetric(name, float64(v))
+	case float64:
+		s.setMetric(name, v)
+	default:
+		s.setMeta(name, fmt.Sprint(v))
+	}
+}
+
+func (s *Span) setMeta(key, value string) {
+	if s.Meta == nil {
+		s.Meta = make(map[string]string)
+	}
+	s.Meta[key] = value
+}
+
+func (s *Span) setMetric(key string, value float64) {
+	if s.Metrics == nil {
+		s.Metrics = make(map[string]float64)
+	}
+	s.Metrics[key] = value
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package datadog_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/datadog"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestExportSpans(t *testing.T) {
+	var got [][]datadog.Span
+	var count string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/v0.4/traces" {
+			t.Errorf("got %s %s", r.Method, r.URL.Path)
+		}
+		count = r.Header.Get("X-Datadog-Trace-Count")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, done := event.Start(context.Background(), "lsp.Server.hover",
+		keys.NewString("resource.name", "").Of("hover main.go"),
+		keys.NewInt("line", "").Of(12))
+	_, childDone := event.Start(ctx, "parse", keys.NewString("service", "").Of("parser"))
+	event.Error(ctx, "failed", errors.New("timeout"))
+	childDone()
+	done()
+	_, otherDone := event.Start(context.Background(), "other")
+	otherDone()
+	event.SetExporter(nil)
+
+	exporter := datadog.New(&datadog.Config{Address: srv.URL, Service: "gopls", Env: "test"})
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if count != "2" || len(got) != 2 || len(got[0]) != 2 || len(got[1]) != 1 {
+		t.Fatalf("got traces %v with count %s, want two and one spans", got, count)
+	}
+	child, parent := got[0][0], got[0][1]
+	if child.ParentID != parent.SpanID || child.TraceID != parent.TraceID {
+		t.Errorf("child %+v is not a child of %+v", child, parent)
+	}
+	if child.Name != "parse" || child.Resource != "parse" || child.Service != "parser" {
+		t.Errorf("got child %s/%s/%s", child.Service, child.Name, child.Resource)
+	}
+	if parent.Name != "lsp.Server" || parent.Resource != "hover main.go" || parent.Service != "gopls" {
+		t.Errorf("got parent %s/%s/%s", parent.Service, parent.Name, parent.Resource)
+	}
+	if parent.Error != 1 || parent.Meta["error.msg"] != "failed: timeout" || parent.Meta["env"] != "test" {
+		t.Errorf("got error %d with meta %v", parent.Error, parent.Meta)
+	}
+	if parent.Metrics["line"] != 12 {
+		t.Errorf("got metrics %v", parent.Metrics)
+	}
+}
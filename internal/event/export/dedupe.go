@@ -0,0 +1,121 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Repeats is attached to the log event a Deduper delivers in place of the
+// repeats it suppressed, and holds how many there were.
+var Repeats = keys.NewInt("repeats", "The number of times an identical event was suppressed.")
+
+// Deduper is an exporter that collapses runs of identical log events.
+type Deduper struct {
+	output event.Exporter
+	window time.Duration
+
+	mu      sync.Mutex
+	key     string          // the identity of the last log event
+	first   time.Time       // when the run of identical events started
+	last    core.Event      // the most recent event of the run
+	lastCtx context.Context // the context it was delivered with
+	repeats int             // the number of events suppressed so far
+}
+
+// Dedupe returns a Deduper that delivers the first of a run of log events with
+// the same message and labels to output, and suppresses the rest of the run
+// until window has passed since the first.
+// When the run ends, the last suppressed event is delivered with a Repeats
+// label saying how many were suppressed.
+// A run that is still in progress is reported by Flush, and the Deduper is
+// managed so that the package level Flush and Shutdown functions do so.
+// Events other than logs are passed straight through, and do not interrupt
+// a run.
+func Dedupe(output event.Exporter, window time.Duration) *Deduper {
+	d := &Deduper{output: output, window: window}
+	Manage(d)
+	return d
+}
+
+// ProcessEvent implements event.Exporter.
+func (d *Deduper) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if !event.IsLog(ev) {
+		return d.output(ctx, ev, lm)
+	}
+	key := eventIdentity(ev)
+	d.mu.Lock()
+	if key == d.key && ev.At().Sub(d.first) < d.window {
+		d.last, d.lastCtx = ev, ctx
+		d.repeats++
+		d.mu.Unlock()
+		return ctx
+	}
+	summaryCtx, summary, ok := d.takeSummary()
+	d.key, d.first, d.repeats = key, ev.At(), 0
+	d.mu.Unlock()
+
+	if ok {
+		d.output(summaryCtx, summary, summary)
+	}
+	return d.output(ctx, ev, lm)
+}
+
+// Flush delivers the summary of the current run of identical events, if any
+// were suppressed.
+func (d *Deduper) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	summaryCtx, summary, ok := d.takeSummary()
+	d.key = ""
+	d.mu.Unlock()
+	if ok {
+		d.output(summaryCtx, summary, summary)
+	}
+	return nil
+}
+
+// takeSummary builds the event that reports the suppressed repeats of the
+// current run, and forgets them.
+// It must be called with d.mu held.
+func (d *Deduper) takeSummary() (context.Context, core.Event, bool) {
+	if d.repeats == 0 {
+		return nil, core.Event{}, false
+	}
+	var static [3]label.Label
+	var dynamic []label.Label
+	for i := 0; d.last.Valid(i); i++ {
+		if i < len(static) {
+			static[i] = d.last.Label(i)
+		} else {
+			dynamic = append(dynamic, d.last.Label(i))
+		}
+	}
+	dynamic = append(dynamic, Repeats.Of(d.repeats))
+	summary := core.CloneEvent(core.MakeEvent(static, dynamic), d.last.At())
+	ctx := d.lastCtx
+	d.repeats, d.lastCtx = 0, nil
+	return ctx, summary, true
+}
+
+// eventIdentity returns a string that is the same for events with the same
+// labels.
+func eventIdentity(ev core.Event) string {
+	var b strings.Builder
+	for i := 0; ev.Valid(i); i++ {
+		if l := ev.Label(i); l.Valid() {
+			fmt.Fprintf(&b, "%v\x00", l)
+		}
+	}
+	return b.String()
+}
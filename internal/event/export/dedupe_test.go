@@ -0,0 +1,50 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestDedupe(t *testing.T) {
+	var got []string
+	output := func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		s := keys.Msg.Get(lm)
+		if l := lm.Find(export.Repeats); l.Valid() {
+			s += fmt.Sprintf(" x%d", export.Repeats.From(l))
+		}
+		got = append(got, s)
+		return ctx
+	}
+	d := export.Dedupe(output, time.Hour)
+	defer export.Unmanage(d)
+	event.SetExporter(d.ProcessEvent)
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	file := keys.NewString("file", "")
+	for i := 0; i < 4; i++ {
+		event.Log(ctx, "watching", file.Of("a.go"))
+	}
+	event.Log(ctx, "watching", file.Of("b.go"))
+	event.Log(ctx, "done")
+	event.Log(ctx, "done")
+	if err := d.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := "[watching watching x3 watching done done x1]"
+	if s := fmt.Sprint(got); s != want {
+		t.Errorf("got %v, want %v", s, want)
+	}
+}
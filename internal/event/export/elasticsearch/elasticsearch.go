@@ -0,0 +1,350 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package elasticsearch indexes log events and finished spans as documents
+// using the Elasticsearch _bulk API, so they can be searched with Kibana.
+//
+// Every document has an @timestamp, a kind of "log", "error" or "span", and
+// the event labels in the labels object. Log documents also hold the message
+// and the trace and span they happened in; span documents hold the name, the
+// parent, and the duration in milliseconds.
+//
+// Importing the package registers an "elasticsearch" exporter whose options
+// are the URL of the cluster, which may include the basic auth credentials.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultURL is the address a local cluster normally listens on.
+const DefaultURL = "http://localhost:9200"
+
+// DefaultIndex puts the documents of each day in their own index.
+const DefaultIndex = "gopls-{2006.01.02}"
+
+// Config configures an Exporter.
+type Config struct {
+	// URL is the address of the cluster.
+	URL string
+	// Index is the name of the index documents are added to.
+	// Any text in braces is a time layout, replaced by the UTC timestamp of
+	// each document.
+	Index string
+	// Username and Password, if set, are sent as basic auth.
+	Username string
+	Password string
+	// TLS configures the connection to an https cluster.
+	// It is ignored if Client is set.
+	TLS *tls.Config
+	// Client sends the requests, it defaults to a client using TLS.
+	Client *http.Client
+	// MaxBatch is the number of documents that triggers a request, it
+	// defaults to 500.
+	MaxBatch int
+	// Interval is the longest documents are held before they are sent, it
+	// defaults to 5 seconds.
+	Interval time.Duration
+}
+
+func init() {
+	export.Register("elasticsearch", func(options string) (event.Exporter, export.Shutdowner, error) {
+		config := &Config{URL: options}
+		if options != "" {
+			u, err := url.Parse(options)
+			if err != nil {
+				return nil, nil, fmt.Errorf("elasticsearch exporter: %v", err)
+			}
+			if u.User != nil {
+				config.Username = u.User.Username()
+				config.Password, _ = u.User.Password()
+				u.User = nil
+				config.URL = u.String()
+			}
+		}
+		exporter := New(config)
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter collects documents and sends them to the cluster in bulk requests.
+// It must be wrapped by export.Spans.
+type Exporter struct {
+	config Config
+	full   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu   sync.Mutex
+	docs []document
+}
+
+// document is a document and the index it is added to.
+type document struct {
+	index  string
+	source map[string]interface{}
+}
+
+// New returns an Exporter for the configured cluster.
+// The Exporter is managed, so the package level Flush and Shutdown functions
+// send the documents it is holding.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.URL == "" {
+		resolved.URL = DefaultURL
+	}
+	resolved.URL = strings.TrimSuffix(resolved.URL, "/")
+	if resolved.Index == "" {
+		resolved.Index = DefaultIndex
+	}
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(resolved.TLS)
+	}
+	if resolved.MaxBatch <= 0 {
+		resolved.MaxBatch = 500
+	}
+	if resolved.Interval <= 0 {
+		resolved.Interval = 5 * time.Second
+	}
+	e := &Exporter{
+		config: resolved,
+		full:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	export.Manage(e)
+	return e
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	var doc document
+	switch {
+	case event.IsLog(ev):
+		doc = e.logDocument(ctx, ev)
+	case event.IsEnd(ev):
+		span := export.GetSpan(ctx)
+		if span == nil {
+			return ctx
+		}
+		doc = e.spanDocument(span)
+	default:
+		return ctx
+	}
+	e.mu.Lock()
+	e.docs = append(e.docs, doc)
+	full := len(e.docs) >= e.config.MaxBatch
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+	return ctx
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.full:
+		case <-e.stop:
+			return
+		}
+		ctx, cancel := export.TimeoutContext(context.Background())
+		export.ReportError(e.Flush(ctx))
+		cancel()
+	}
+}
+
+// Flush sends the documents collected so far in a single bulk request.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	docs := e.docs
+	e.docs = nil
+	e.mu.Unlock()
+	if len(docs) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		action := map[string]interface{}{"index": map[string]string{"_index": doc.index}}
+		if err := enc.Encode(action); err != nil {
+			return fmt.Errorf("elasticsearch failed to marshal action: %v", err)
+		}
+		if err := enc.Encode(doc.source); err != nil {
+			return fmt.Errorf("elasticsearch failed to marshal document: %v", err)
+		}
+	}
+	uri := e.config.URL + "/_bulk"
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, &body)
+	if err != nil {
+		return fmt.Errorf("elasticsearch failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.config.Username != "" || e.config.Password != "" {
+		req.SetBasicAuth(e.config.Username, e.config.Password)
+	}
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("elasticsearch failed to send documents: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("elasticsearch rejected documents: %v", res.Status)
+	}
+	return bulkError(res)
+}
+
+// Shutdown stops the periodic requests, and then sends the documents it is
+// holding.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	export.Unmanage(e)
+	return e.Flush(ctx)
+}
+
+// bulkError reports the documents that a successful bulk request failed to
+// index, as each is accepted or rejected on its own.
+func bulkError(res *http.Response) error {
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("elasticsearch failed to read response: %v", err)
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("elasticsearch failed to decode response: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first string
+	for _, item := range result.Items {
+		for _, r := range item {
+			if r.Error == nil {
+				continue
+			}
+			if failed == 0 {
+				first = r.Error.Type + ": " + r.Error.Reason
+			}
+			failed++
+		}
+	}
+	return fmt.Errorf("elasticsearch failed to index %d of %d documents: %s", failed, len(result.Items), first)
+}
+
+func (e *Exporter) logDocument(ctx context.Context, ev core.Event) document {
+	source := map[string]interface{}{
+		"@timestamp": ev.At().UTC().Format(time.RFC3339Nano),
+		"kind":       "log",
+		"message":    keys.Msg.From(ev.Label(0)),
+	}
+	first := 1
+	if event.IsError(ev) {
+		source["kind"] = "error"
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			source["error"] = err.Error()
+		}
+		first = 2
+	}
+	if span := export.GetSpan(ctx); span != nil {
+		source["trace.id"] = span.ID.TraceID.String()
+		source["span.id"] = span.ID.SpanID.String()
+	}
+	labels := make(map[string]interface{})
+	for i := first; ev.Valid(i); i++ {
+		addLabel(labels, ev.Label(i))
+	}
+	if len(labels) > 0 {
+		source["labels"] = labels
+	}
+	return document{index: e.index(ev.At()), source: source}
+}
+
+func (e *Exporter) spanDocument(span *export.Span) document {
+	start, end := span.Start().At(), span.Finish().At()
+	source := map[string]interface{}{
+		"@timestamp":  start.UTC().Format(time.RFC3339Nano),
+		"kind":        "span",
+		"name":        span.Name,
+		"trace.id":    span.ID.TraceID.String(),
+		"span.id":     span.ID.SpanID.String(),
+		"duration_ms": float64(end.Sub(start)) / float64(time.Millisecond),
+	}
+	if span.ParentID.IsValid() {
+		source["parent.id"] = span.ParentID.String()
+	}
+	labels := make(map[string]interface{})
+	for i := 1; span.Start().Valid(i); i++ {
+		addLabel(labels, span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		addLabel(labels, l)
+	}
+	if len(labels) > 0 {
+		source["labels"] = labels
+	}
+	return document{index: e.index(start), source: source}
+}
+
+// index expands the time layouts in the configured index name.
+func (e *Exporter) index(at time.Time) string {
+	at = at.UTC()
+	name := e.config.Index
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(name, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(name[open:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(name[:open])
+		b.WriteString(at.Format(name[open+1 : open+end]))
+		name = name[open+end+1:]
+	}
+	b.WriteString(name)
+	return b.String()
+}
+
+func addLabel(labels map[string]interface{}, l label.Label) {
+	if l.Valid() {
+		labels[l.Key().Name()] = export.LabelValue(l)
+	}
+}
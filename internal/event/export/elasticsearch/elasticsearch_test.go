@@ -0,0 +1,92 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/elasticsearch"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestBulk(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+		if user, password, _ := r.BasicAuth(); user != "elastic" || password != "changeme" {
+			t.Errorf("got basic auth %q %q", user, password)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer srv.Close()
+	exporter := elasticsearch.New(&elasticsearch.Config{
+		URL:      srv.URL,
+		Index:    "tools-{2006.01}",
+		Username: "elastic",
+		Password: "changeme",
+		Interval: time.Hour,
+	})
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)))
+	defer event.SetClock(nil)
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	event.Error(ctx, "failed", errors.New("timeout"), keys.NewInt("line", "").Of(3))
+	done()
+	event.SetExporter(nil)
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	span := export.GetSpan(ctx)
+	want := []string{
+		`{"index":{"_index":"tools-2020.03"}}`,
+		`{"@timestamp":"2020-03-05T14:27:48Z","error":"timeout","kind":"error","labels":{"line":3},"message":"failed","span.id":"` + span.ID.SpanID.String() + `","trace.id":"` + span.ID.TraceID.String() + `"}`,
+		`{"index":{"_index":"tools-2020.03"}}`,
+		`{"@timestamp":"2020-03-05T14:27:48Z","duration_ms":0,"kind":"span","labels":{"file":"main.go"},"name":"hover","span.id":"` + span.ID.SpanID.String() + `","trace.id":"` + span.ID.TraceID.String() + `"}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got line\n%s\nwant\n%s", got[i], want[i])
+		}
+	}
+}
+
+func TestBulkErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`))
+	}))
+	defer srv.Close()
+	exporter := elasticsearch.New(&elasticsearch.Config{URL: srv.URL, Interval: time.Hour})
+	defer exporter.Shutdown(context.Background())
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	event.Log(context.Background(), "first")
+	event.Log(context.Background(), "second")
+	event.SetExporter(nil)
+	err := exporter.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to index 1 of 2 documents: mapper_parsing_exception: failed to parse") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	errorHandlerMu sync.Mutex
+	errorHandler   = (&limitedErrorWriter{writer: os.Stderr, interval: time.Second}).report
+)
+
+// SetErrorHandler sets the function that is called when an exporter fails to
+// deliver telemetry.
+// Passing nil restores the default handler, which writes the errors to stderr
+// no more than once a second.
+// The handler may be called concurrently from several goroutines.
+func SetErrorHandler(h func(error)) {
+	if h == nil {
+		h = (&limitedErrorWriter{writer: os.Stderr, interval: time.Second}).report
+	}
+	errorHandlerMu.Lock()
+	defer errorHandlerMu.Unlock()
+	errorHandler = h
+}
+
+// ReportError hands an export failure to the current error handler.
+// Exporters should call this whenever they drop telemetry because of an
+// error, rather than failing silently.
+// It must not be called with the lock of an exporter held, as the handler is
+// free to deliver events of its own.
+func ReportError(err error) {
+	if err == nil {
+		return
+	}
+	errorHandlerMu.Lock()
+	h := errorHandler
+	errorHandlerMu.Unlock()
+	h(err)
+}
+
+// limitedErrorWriter writes errors to a writer, dropping any that arrive
+// within interval of the last one written.
+type limitedErrorWriter struct {
+	mu         sync.Mutex
+	writer     io.Writer
+	interval   time.Duration
+	last       time.Time
+	suppressed int
+}
+
+func (w *limitedErrorWriter) report(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if !w.last.IsZero() && now.Sub(w.last) < w.interval {
+		w.suppressed++
+		return
+	}
+	w.last = now
+	fmt.Fprintf(w.writer, "telemetry export error: %v", err)
+	if w.suppressed > 0 {
+		fmt.Fprintf(w.writer, " (%d more errors suppressed)", w.suppressed)
+		w.suppressed = 0
+	}
+	fmt.Fprintln(w.writer)
+}
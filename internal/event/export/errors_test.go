@@ -0,0 +1,28 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimitedErrorWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &limitedErrorWriter{writer: buf, interval: time.Hour}
+	w.report(errors.New("first"))
+	w.report(errors.New("second"))
+	w.report(errors.New("third"))
+	w.last = w.last.Add(-2 * time.Hour)
+	w.report(errors.New("fourth"))
+
+	const want = "telemetry export error: first\n" +
+		"telemetry export error: fourth (2 more errors suppressed)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
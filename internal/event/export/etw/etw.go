@@ -0,0 +1,383 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package etw emits spans and log events as Event Tracing for Windows events,
+// so they can be captured and correlated with system activity in tools such
+// as WPA and PerfView.
+//
+// The events are self describing TraceLogging events. Each span is a pair of
+// start and stop events sharing an activity ID, with the activity of the
+// parent span as the related activity of the start, so the tools show spans
+// as nested regions. Log events are written within the activity of their
+// span, at a level given by their severity. Spans use keyword 0x1 and log
+// events keyword 0x2.
+//
+// The exporter is only available on Windows, elsewhere New fails.
+//
+// Importing the package registers an "etw" exporter whose options are the
+// provider name, or its GUID in braces.
+package etw
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultProvider is the name of the provider if none is configured.
+const DefaultProvider = "GoTools-Telemetry"
+
+// Keywords of the events, which sessions can use to select them.
+const (
+	KeywordSpans = 0x1
+	KeywordLogs  = 0x2
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Provider is the name of the provider.
+	Provider string
+	// GUID identifies the provider to ETW sessions, it defaults to
+	// ProviderGUID(Provider).
+	GUID GUID
+}
+
+func init() {
+	export.Register("etw", func(options string) (event.Exporter, export.Shutdowner, error) {
+		config := &Config{Provider: options}
+		if strings.HasPrefix(options, "{") {
+			guid, err := ParseGUID(options)
+			if err != nil {
+				return nil, nil, err
+			}
+			config = &Config{GUID: guid}
+		}
+		exporter, err := New(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter writes spans and log events to ETW.
+// It must be wrapped by export.Spans.
+type Exporter struct {
+	provider provider
+}
+
+// provider is a registered ETW provider.
+type provider interface {
+	// enabled reports whether any session wants events of the level and
+	// keyword.
+	enabled(level uint8, keyword uint64) bool
+	write(d descriptor, activity, related *GUID, p *payload) error
+	close() error
+}
+
+// descriptor holds the parts of an event descriptor that vary.
+type descriptor struct {
+	level   uint8
+	opcode  uint8
+	keyword uint64
+}
+
+// New registers the configured provider with ETW.
+func New(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Provider == "" {
+		resolved.Provider = DefaultProvider
+	}
+	if resolved.GUID == (GUID{}) {
+		resolved.GUID = ProviderGUID(resolved.Provider)
+	}
+	p, err := register(resolved.Provider, resolved.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("etw exporter: %v", err)
+	}
+	return &Exporter{provider: p}, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	var err error
+	switch {
+	case event.IsLog(ev):
+		err = e.log(ctx, ev, lm)
+	case event.IsStart(ev):
+		if span := export.GetSpan(ctx); span != nil {
+			err = e.start(span)
+		}
+	case event.IsEnd(ev):
+		if span := export.GetSpan(ctx); span != nil {
+			err = e.stop(span)
+		}
+	}
+	export.ReportError(err)
+	return ctx
+}
+
+// Shutdown unregisters the provider.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.provider.close()
+}
+
+func (e *Exporter) start(span *export.Span) error {
+	d := descriptor{level: levelInfo, opcode: opcodeStart, keyword: KeywordSpans}
+	if !e.provider.enabled(d.level, d.keyword) {
+		return nil
+	}
+	p := newPayload(span.Name)
+	for i := 1; span.Start().Valid(i); i++ {
+		p.label(span.Start().Label(i))
+	}
+	p.finish()
+	activity := activityID(span.ID)
+	var related *GUID
+	if span.ParentID.IsValid() {
+		parent := activityID(export.SpanContext{TraceID: span.ID.TraceID, SpanID: span.ParentID})
+		related = &parent
+	}
+	return e.provider.write(d, &activity, related, p)
+}
+
+func (e *Exporter) stop(span *export.Span) error {
+	d := descriptor{level: levelInfo, opcode: opcodeStop, keyword: KeywordSpans}
+	if !e.provider.enabled(d.level, d.keyword) {
+		return nil
+	}
+	p := newPayload(span.Name)
+	for _, l := range span.Labels() {
+		p.label(l)
+	}
+	p.finish()
+	activity := activityID(span.ID)
+	return e.provider.write(d, &activity, nil, p)
+}
+
+func (e *Exporter) log(ctx context.Context, ev core.Event, lm label.Map) error {
+	level, ok := levels[export.SeverityOf(ev, lm)]
+	if !ok {
+		level = levelInfo
+	}
+	d := descriptor{level: level, opcode: opcodeInfo, keyword: KeywordLogs}
+	if !e.provider.enabled(d.level, d.keyword) {
+		return nil
+	}
+	name, first := "log", 1
+	if event.IsError(ev) {
+		name, first = "error", 2
+	}
+	p := newPayload(name)
+	p.string("message", keys.Msg.From(ev.Label(0)))
+	if event.IsError(ev) {
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			p.string("error", err.Error())
+		}
+	}
+	for i := first; ev.Valid(i); i++ {
+		if l := ev.Label(i); l.Key() != export.SeverityKey {
+			p.label(l)
+		}
+	}
+	p.finish()
+	var activity *GUID
+	if span := export.GetSpan(ctx); span != nil {
+		id := activityID(span.ID)
+		activity = &id
+	}
+	return e.provider.write(d, activity, nil, p)
+}
+
+// GUID is a Windows GUID, in its in memory layout.
+type GUID [16]byte
+
+// ParseGUID parses the registry form of a GUID, such as
+// {01234567-89ab-cdef-0123-456789abcdef}.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	parts := strings.Split(trimmed, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return g, fmt.Errorf("etw: invalid GUID %q", s)
+	}
+	b, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return g, fmt.Errorf("etw: invalid GUID %q", s)
+	}
+	// The first three groups are little endian integers.
+	g[0], g[1], g[2], g[3] = b[3], b[2], b[1], b[0]
+	g[4], g[5] = b[5], b[4]
+	g[6], g[7] = b[7], b[6]
+	copy(g[8:], b[8:])
+	return g, nil
+}
+
+func (g GUID) String() string {
+	return fmt.Sprintf("{%08x-%04x-%04x-%x-%x}",
+		binary.LittleEndian.Uint32(g[0:]),
+		binary.LittleEndian.Uint16(g[4:]),
+		binary.LittleEndian.Uint16(g[6:]),
+		g[8:10], g[10:])
+}
+
+// ProviderGUID returns the GUID that EventSource and TraceLogging derive from
+// a provider name, so that sessions can enable the provider by name, as in
+// "PerfView /Providers=*GoTools-Telemetry".
+func ProviderGUID(name string) GUID {
+	// The namespace used by EventSource, followed by the big endian UTF-16
+	// encoding of the upper cased name.
+	data := []byte{0x48, 0x2c, 0x2d, 0xb2, 0xc3, 0x90, 0x47, 0xc8, 0x87, 0xf8, 0x1a, 0x15, 0xbf, 0xc1, 0x30, 0xfb}
+	for _, c := range utf16.Encode([]rune(strings.ToUpper(name))) {
+		data = append(data, byte(c>>8), byte(c))
+	}
+	sum := sha1.Sum(data)
+	var g GUID
+	copy(g[:], sum[:16])
+	g[7] = (g[7] & 0x0f) | 0x50
+	return g
+}
+
+// activityID returns the activity ID of a span.
+func activityID(id export.SpanContext) GUID {
+	var g GUID
+	copy(g[:8], id.SpanID[:])
+	copy(g[8:], id.TraceID[:8])
+	return g
+}
+
+// Event levels.
+const (
+	levelError   = 2
+	levelWarning = 3
+	levelInfo    = 4
+	levelVerbose = 5
+)
+
+var levels = map[export.Severity]uint8{
+	export.SeverityDebug:   levelVerbose,
+	export.SeverityInfo:    levelInfo,
+	export.SeverityWarning: levelWarning,
+	export.SeverityError:   levelError,
+}
+
+// Event opcodes.
+const (
+	opcodeInfo  = 0
+	opcodeStart = 1
+	opcodeStop  = 2
+)
+
+// TraceLogging field in types and out types.
+const (
+	inANSIString = 2
+	inInt64      = 9
+	inUInt64     = 10
+	inDouble     = 12
+	inBool32     = 13
+	outUTF8      = 35
+	hasOutType   = 0x80
+)
+
+// providerMetadata returns the TraceLogging provider traits, which name the
+// provider.
+func providerMetadata(name string) []byte {
+	b := make([]byte, 2, 2+len(name)+1)
+	b = append(b, name...)
+	b = append(b, 0)
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	return b
+}
+
+// payload is a self describing TraceLogging event: the metadata describes
+// the name and type of each field, and data holds their values.
+type payload struct {
+	metadata []byte
+	data     []byte
+}
+
+func newPayload(name string) *payload {
+	p := &payload{metadata: make([]byte, 3, 3+len(name)+1)}
+	p.metadata = append(p.metadata, name...)
+	p.metadata = append(p.metadata, 0)
+	return p
+}
+
+// finish fills in the size of the metadata.
+func (p *payload) finish() {
+	binary.LittleEndian.PutUint16(p.metadata, uint16(len(p.metadata)))
+}
+
+func (p *payload) field(name string, inType uint8) {
+	p.metadata = append(p.metadata, name...)
+	p.metadata = append(p.metadata, 0, inType)
+}
+
+func (p *payload) string(name, value string) {
+	p.field(name, inANSIString|hasOutType)
+	p.metadata = append(p.metadata, outUTF8)
+	// The value is null terminated, so it cannot contain nulls.
+	p.data = append(p.data, strings.ReplaceAll(value, "\x00", "")...)
+	p.data = append(p.data, 0)
+}
+
+func (p *payload) int64(name string, value int64) {
+	p.field(name, inInt64)
+	p.data = appendUint64(p.data, uint64(value))
+}
+
+func (p *payload) uint64(name string, value uint64) {
+	p.field(name, inUInt64)
+	p.data = appendUint64(p.data, value)
+}
+
+func (p *payload) float64(name string, value float64) {
+	p.field(name, inDouble)
+	p.data = appendUint64(p.data, math.Float64bits(value))
+}
+
+func (p *payload) bool(name string, value bool) {
+	p.field(name, inBool32)
+	var v uint32
+	if value {
+		v = 1
+	}
+	p.data = append(p.data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// label adds a field for a label, using the type of its value.
+func (p *payload) label(l label.Label) {
+	if !l.Valid() {
+		return
+	}
+	name := l.Key().Name()
+	switch v := export.LabelValue(l).(type) {
+	case int64:
+		p.int64(name, v)
+	case uint64:
+		p.uint64(name, v)
+	case float64:
+		p.float64(name, v)
+	case bool:
+		p.bool(name, v)
+	default:
+		p.string(name, fmt.Sprint(v))
+	}
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
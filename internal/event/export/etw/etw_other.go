@@ -0,0 +1,14 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package etw
+
+import "errors"
+
+func register(name string, guid GUID) (provider, error) {
+	return nil, errors.New("ETW is only available on Windows")
+}
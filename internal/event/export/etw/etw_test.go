@@ -0,0 +1,134 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etw
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type written struct {
+	d        descriptor
+	activity *GUID
+	related  *GUID
+	p        *payload
+}
+
+// fakeProvider records the events written to it.
+type fakeProvider struct {
+	keywords uint64
+	events   []written
+}
+
+func (f *fakeProvider) enabled(level uint8, keyword uint64) bool { return f.keywords&keyword != 0 }
+
+func (f *fakeProvider) write(d descriptor, activity, related *GUID, p *payload) error {
+	f.events = append(f.events, written{d, activity, related, p})
+	return nil
+}
+
+func (f *fakeProvider) close() error { return nil }
+
+func TestGUID(t *testing.T) {
+	const s = "{01234567-89ab-cdef-0123-456789abcdef}"
+	g, err := ParseGUID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GUID{0x67, 0x45, 0x23, 0x01, 0xab, 0x89, 0xef, 0xcd, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	if g != want {
+		t.Errorf("ParseGUID(%s) = %x, want %x", s, g[:], want[:])
+	}
+	if got := g.String(); got != s {
+		t.Errorf("String() = %s, want %s", got, s)
+	}
+	if _, err := ParseGUID("{0123}"); err == nil {
+		t.Error("parsed a short GUID")
+	}
+}
+
+func TestProviderGUID(t *testing.T) {
+	g := ProviderGUID("GoTools-Telemetry")
+	if g != ProviderGUID("gotools-telemetry") {
+		t.Error("provider GUIDs depend on the case of the name")
+	}
+	if g[7]>>4 != 5 {
+		t.Errorf("provider GUID %v is not a version 5 GUID", g)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	f := &fakeProvider{keywords: KeywordSpans | KeywordLogs}
+	e := &Exporter{provider: f}
+	event.SetExporter(export.Spans(e.ProcessEvent))
+	defer event.SetExporter(nil)
+	ctx, done := event.Start(context.Background(), "hover", keys.NewInt64("line", "").Of(3))
+	child, childDone := event.Start(ctx, "parse")
+	event.Error(child, "failed", errors.New("timeout"), keys.NewBoolean("retry", "").Of(true))
+	childDone()
+	done()
+
+	if len(f.events) != 5 {
+		t.Fatalf("got %d events, want 5", len(f.events))
+	}
+	parent, span := export.GetSpan(ctx), export.GetSpan(child)
+	parentActivity, spanActivity := activityID(parent.ID), activityID(span.ID)
+
+	start := f.events[0]
+	if start.d != (descriptor{level: levelInfo, opcode: opcodeStart, keyword: KeywordSpans}) {
+		t.Errorf("start has descriptor %+v", start.d)
+	}
+	if *start.activity != parentActivity || start.related != nil {
+		t.Error("root span start has the wrong activities")
+	}
+	wantMetadata := "\x0f\x00\x00hover\x00line\x00\x09"
+	if got := string(start.p.metadata); got != wantMetadata {
+		t.Errorf("start metadata is %q, want %q", got, wantMetadata)
+	}
+	if got, want := string(start.p.data), "\x03\x00\x00\x00\x00\x00\x00\x00"; got != want {
+		t.Errorf("start data is %q, want %q", got, want)
+	}
+
+	if childStart := f.events[1]; *childStart.activity != spanActivity || *childStart.related != parentActivity {
+		t.Error("child span start has the wrong activities")
+	}
+
+	log := f.events[2]
+	if log.d != (descriptor{level: levelError, opcode: opcodeInfo, keyword: KeywordLogs}) {
+		t.Errorf("error has descriptor %+v", log.d)
+	}
+	if *log.activity != spanActivity {
+		t.Error("error is not in the activity of its span")
+	}
+	wantMetadata = "\x22\x00\x00error\x00message\x00\x82\x23error\x00\x82\x23retry\x00\x0d"
+	if got := string(log.p.metadata); got != wantMetadata {
+		t.Errorf("error metadata is %q, want %q", got, wantMetadata)
+	}
+	if got, want := string(log.p.data), "failed\x00timeout\x00\x01\x00\x00\x00"; got != want {
+		t.Errorf("error data is %q, want %q", got, want)
+	}
+
+	if stop := f.events[3]; stop.d.opcode != opcodeStop || *stop.activity != spanActivity {
+		t.Error("child span stop is wrong")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	f := &fakeProvider{keywords: KeywordLogs}
+	e := &Exporter{provider: f}
+	event.SetExporter(export.Spans(e.ProcessEvent))
+	defer event.SetExporter(nil)
+	ctx, done := event.Start(context.Background(), "hover")
+	event.Log(ctx, "hello")
+	done()
+	if len(f.events) != 1 || f.events[0].d.keyword != KeywordLogs {
+		t.Errorf("got %d events, want only the log event", len(f.events))
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etw
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32                 = windows.NewLazySystemDLL("advapi32.dll")
+	procEventRegister        = advapi32.NewProc("EventRegister")
+	procEventUnregister      = advapi32.NewProc("EventUnregister")
+	procEventSetInformation  = advapi32.NewProc("EventSetInformation")
+	procEventProviderEnabled = advapi32.NewProc("EventProviderEnabled")
+	procEventWriteTransfer   = advapi32.NewProc("EventWriteTransfer")
+)
+
+// eventDescriptor is EVENT_DESCRIPTOR.
+type eventDescriptor struct {
+	id      uint16
+	version uint8
+	channel uint8
+	level   uint8
+	opcode  uint8
+	task    uint16
+	keyword uint64
+}
+
+// eventDataDescriptor is EVENT_DATA_DESCRIPTOR.
+type eventDataDescriptor struct {
+	ptr  uint64
+	size uint32
+	kind uint8 // 0 for field values, 1 for event metadata, 2 for provider metadata
+	_    [3]byte
+}
+
+const (
+	// channelTraceLogging marks events as self describing on versions of
+	// Windows that predate TraceLogging.
+	channelTraceLogging = 11
+	// eventProviderSetTraits is the EVENT_INFO_CLASS that sets the provider
+	// metadata.
+	eventProviderSetTraits = 2
+)
+
+type windowsProvider struct {
+	handle uint64
+	traits []byte
+}
+
+func register(name string, guid GUID) (provider, error) {
+	p := &windowsProvider{traits: providerMetadata(name)}
+	if err := procEventRegister.Find(); err != nil {
+		return nil, err
+	}
+	r, _, _ := procEventRegister.Call(uintptr(unsafe.Pointer(&guid)), 0, 0, uintptr(unsafe.Pointer(&p.handle)))
+	if r != 0 {
+		return nil, fmt.Errorf("EventRegister failed: %v", windows.Errno(r))
+	}
+	// Older versions of Windows do not have EventSetInformation, and rely on
+	// the traits being passed with every event instead.
+	if procEventSetInformation.Find() == nil {
+		args := append(uint64Args(p.handle), eventProviderSetTraits, uintptr(unsafe.Pointer(&p.traits[0])), uintptr(len(p.traits)))
+		procEventSetInformation.Call(args...)
+		runtime.KeepAlive(p.traits)
+	}
+	return p, nil
+}
+
+func (p *windowsProvider) enabled(level uint8, keyword uint64) bool {
+	args := append(uint64Args(p.handle), uintptr(level))
+	args = append(args, uint64Args(keyword)...)
+	r, _, _ := procEventProviderEnabled.Call(args...)
+	return r&0xff != 0
+}
+
+func (p *windowsProvider) write(d descriptor, activity, related *GUID, payload *payload) error {
+	descriptor := eventDescriptor{
+		channel: channelTraceLogging,
+		level:   d.level,
+		opcode:  d.opcode,
+		keyword: d.keyword,
+	}
+	data := []eventDataDescriptor{
+		{ptr: uint64(uintptr(unsafe.Pointer(&p.traits[0]))), size: uint32(len(p.traits)), kind: 2},
+		{ptr: uint64(uintptr(unsafe.Pointer(&payload.metadata[0]))), size: uint32(len(payload.metadata)), kind: 1},
+	}
+	if len(payload.data) > 0 {
+		data = append(data, eventDataDescriptor{ptr: uint64(uintptr(unsafe.Pointer(&payload.data[0]))), size: uint32(len(payload.data))})
+	}
+	args := append(uint64Args(p.handle),
+		uintptr(unsafe.Pointer(&descriptor)),
+		uintptr(unsafe.Pointer(activity)),
+		uintptr(unsafe.Pointer(related)),
+		uintptr(len(data)),
+		uintptr(unsafe.Pointer(&data[0])),
+	)
+	r, _, _ := procEventWriteTransfer.Call(args...)
+	runtime.KeepAlive(p.traits)
+	runtime.KeepAlive(payload)
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(activity)
+	runtime.KeepAlive(related)
+	if r != 0 {
+		return fmt.Errorf("etw failed to write event: %v", windows.Errno(r))
+	}
+	return nil
+}
+
+func (p *windowsProvider) close() error {
+	r, _, _ := procEventUnregister.Call(uint64Args(p.handle)...)
+	if r != 0 {
+		return fmt.Errorf("EventUnregister failed: %v", windows.Errno(r))
+	}
+	return nil
+}
+
+// uint64Args returns the arguments that pass a 64 bit value, such as a
+// REGHANDLE, which takes two on 32 bit systems.
+func uint64Args(v uint64) []uintptr {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		return []uintptr{uintptr(v)}
+	}
+	return []uintptr{uintptr(v), uintptr(v >> 32)}
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Exemplars returns an exporter that labels each metric event emitted inside a
+// span with the metric.TraceID and metric.SpanID of the span, so that the
+// histograms of a metric.Config exporter in output keep the values as
+// exemplars.
+// Spans dropped by Sampled or Filter are not labelled, so exemplars only ever
+// refer to traces that are delivered.
+// It must be wrapped by Spans.
+func Exemplars(output event.Exporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			if span := GetSpan(ctx); span != nil && !spanDropped(ctx) {
+				lm = label.MergeMaps(label.NewMap(
+					metric.TraceID.Of(span.ID.TraceID.String()),
+					metric.SpanID.Of(span.ID.SpanID.String()),
+				), lm)
+			}
+		}
+		return output(ctx, ev, lm)
+	}
+}
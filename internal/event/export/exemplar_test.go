@@ -0,0 +1,62 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestExemplars(t *testing.T) {
+	latency := keys.NewInt64("exemplar_latency", "")
+	for _, test := range []struct {
+		name     string
+		fraction float64
+		want     bool
+	}{
+		{"sampled", 1, true},
+		{"dropped", 0, false},
+	} {
+		var m metric.Config
+		metric.HistogramInt64{Name: "latency", Buckets: []int64{10, 100}}.Record(&m, latency)
+		var latest *metric.HistogramInt64Data
+		event.SetExporter(export.Spans(export.Sampled(export.Exemplars(m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsMetric(ev) {
+				latest = metric.Entries.Get(lm).([]metric.Data)[0].(*metric.HistogramInt64Data)
+			}
+			return ctx
+		})), test.fraction)))
+
+		event.Metric(context.Background(), latency.Of(5))
+		ctx, done := event.Start(context.Background(), "request")
+		event.Metric(ctx, latency.Of(50))
+		span := export.GetSpan(ctx)
+		done()
+
+		exemplars := latest.Rows[0].Exemplars
+		if !test.want {
+			if len(exemplars) != 0 {
+				t.Errorf("%s: got exemplars %v, want none", test.name, exemplars)
+			}
+			continue
+		}
+		// Only the value recorded in the span has an exemplar, in the second
+		// bucket.
+		if len(exemplars) != 3 || exemplars[0] != nil || exemplars[1] == nil || exemplars[2] != nil {
+			t.Fatalf("%s: got exemplars %v, want one for the second bucket", test.name, exemplars)
+		}
+		if ex := exemplars[1]; ex.Value != 50 || ex.TraceID != span.ID.TraceID.String() || ex.SpanID != span.ID.SpanID.String() {
+			t.Errorf("%s: got exemplar %+v, want 50 in span %v", test.name, ex, span.ID)
+		}
+	}
+	event.SetExporter(nil)
+}
@@ -0,0 +1,12 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import "context"
+
+// SampleRuntimeMetrics and SampleProcessMetrics take a sample immediately,
+// rather than waiting for the collector interval.
+func SampleRuntimeMetrics(ctx context.Context) { runtimeMetrics.sample(ctx) }
+func SampleProcessMetrics(ctx context.Context) { processMetrics.sample(ctx) }
@@ -0,0 +1,200 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package expvar publishes the current values of metrics as expvar variables,
+// so that a process already serving /debug/vars shows them too.
+//
+// Each metric is published as <prefix>.<metric name>, where the prefix
+// defaults to "telemetry". The value of the variable is a JSON object with a
+// member for each series of the metric, named by its labels in the form
+// "key=value,key=value", or "" for a series without labels. Counters and
+// gauges have a number for each series; histograms have an object holding
+// the count, sum, min, max and the count of each bucket.
+//
+// Importing the package registers an "expvar" exporter whose options are the
+// prefix.
+package expvar
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultPrefix is the first part of the name of every variable.
+const DefaultPrefix = "telemetry"
+
+func init() {
+	export.Register("expvar", func(prefix string) (event.Exporter, export.Shutdowner, error) {
+		return New(prefix).ProcessEvent, nil, nil
+	})
+}
+
+// Exporter keeps the latest value of every metric it sees, and publishes it
+// as an expvar variable.
+// It must be wrapped by a metric.Config exporter.
+type Exporter struct {
+	prefix string
+
+	mu     sync.Mutex
+	series map[string]map[string]interface{}
+}
+
+// New returns an Exporter that publishes variables with the given prefix.
+// As expvar variables cannot be removed, a later Exporter with the same
+// prefix takes the variables over.
+func New(prefix string) *Exporter {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Exporter{prefix: prefix, series: make(map[string]map[string]interface{})}
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if !event.IsMetric(ev) {
+		return ctx
+	}
+	data, _ := metric.Entries.Get(lm).([]metric.Data)
+	for _, d := range data {
+		e.update(d)
+	}
+	return ctx
+}
+
+// update replaces the series of a metric, publishing its variable the first
+// time it is seen.
+func (e *Exporter) update(data metric.Data) {
+	series := convert(data)
+	if series == nil {
+		return
+	}
+	name := e.prefix + "." + data.Handle()
+	e.mu.Lock()
+	_, seen := e.series[name]
+	e.series[name] = series
+	e.mu.Unlock()
+	if !seen {
+		if err := publish(name, e); err != nil {
+			export.ReportError(err)
+		}
+	}
+}
+
+// value returns the JSON encoding of the named metric.
+func (e *Exporter) value(name string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	data, err := json.Marshal(e.series[name])
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
+
+// publishMu serializes the checks for an existing variable.
+var publishMu sync.Mutex
+
+// variable is an expvar.Var for a metric held by an Exporter.
+type variable struct {
+	name string
+
+	mu       sync.Mutex
+	exporter *Exporter
+}
+
+func (v *variable) String() string {
+	v.mu.Lock()
+	e := v.exporter
+	v.mu.Unlock()
+	return e.value(v.name)
+}
+
+// publish makes the named variable report the metric held by e, publishing it
+// if it does not already exist.
+func publish(name string, e *Exporter) error {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	switch existing := expvar.Get(name).(type) {
+	case nil:
+		expvar.Publish(name, &variable{name: name, exporter: e})
+	case *variable:
+		existing.mu.Lock()
+		existing.exporter = e
+		existing.mu.Unlock()
+	default:
+		return fmt.Errorf("expvar failed to publish %v: the name is already in use", name)
+	}
+	return nil
+}
+
+// histogram is the value of a series of a histogram.
+type histogram struct {
+	Count   int64            `json:"count"`
+	Sum     interface{}      `json:"sum"`
+	Min     interface{}      `json:"min"`
+	Max     interface{}      `json:"max"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+// convert returns the value of each series of the metric, keyed by its
+// labels.
+func convert(data metric.Data) map[string]interface{} {
+	series := make(map[string]interface{})
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			series[seriesName(group)] = data.Rows[i]
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			series[seriesName(group)] = data.Rows[i]
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			buckets := make(map[string]int64, len(row.Values))
+			for j, b := range data.Info.Buckets {
+				buckets[fmt.Sprint(b)] = row.Values[j]
+			}
+			series[seriesName(group)] = histogram{Count: row.Count, Sum: row.Sum, Min: row.Min, Max: row.Max, Buckets: buckets}
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			buckets := make(map[string]int64, len(row.Values))
+			for j, b := range data.Info.Buckets {
+				buckets[fmt.Sprint(b)] = row.Values[j]
+			}
+			series[seriesName(group)] = histogram{Count: row.Count, Sum: row.Sum, Min: row.Min, Max: row.Max, Buckets: buckets}
+		}
+	default:
+		return nil
+	}
+	return series
+}
+
+// seriesName renders the labels of a series as key=value pairs.
+func seriesName(group []label.Label) string {
+	var b strings.Builder
+	for _, l := range group {
+		if !l.Valid() {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%v", l.Key().Name(), export.LabelValue(l))
+	}
+	return b.String()
+}
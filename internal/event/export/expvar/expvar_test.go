@@ -0,0 +1,57 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package expvar_test
+
+import (
+	"context"
+	stdexpvar "expvar"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/expvar"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestPublish(t *testing.T) {
+	method := keys.NewString("method", "")
+	count := keys.NewInt64("count", "")
+	latency := keys.NewInt64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "calls", Keys: []label.Key{method}}.SumInt64(&m, count)
+	metric.HistogramInt64{Name: "latency_ms", Buckets: []int64{10, 100}}.Record(&m, latency)
+	exporter := expvar.New("test")
+	ctx := event.WithExporter(context.Background(), m.Exporter(exporter.ProcessEvent))
+
+	event.Metric(ctx, method.Of("hover"), count.Of(2))
+	event.Metric(ctx, method.Of("hover"), count.Of(3))
+	event.Metric(ctx, method.Of("definition"), count.Of(1))
+	event.Metric(ctx, latency.Of(42))
+
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"test.calls", `{"method=definition":1,"method=hover":5}`},
+		{"test.latency_ms", `{"":{"count":1,"sum":42,"min":42,"max":42,"buckets":{"10":0,"100":1}}}`},
+	} {
+		v := stdexpvar.Get(test.name)
+		if v == nil {
+			t.Errorf("%s was not published", test.name)
+			continue
+		}
+		if got := v.String(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	// A new exporter with the same prefix takes over the variables.
+	replacement := expvar.New("test")
+	ctx = event.WithExporter(context.Background(), m.Exporter(replacement.ProcessEvent))
+	event.Metric(ctx, method.Of("hover"), count.Of(7))
+	if got, want := stdexpvar.Get("test.calls").String(), `{"method=definition":1,"method=hover":12}`; got != want {
+		t.Errorf("after replacement test.calls = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// FilterOptions controls which telemetry is let through by Filter.
+// Allow lists are only applied if they are not empty, deny lists always win.
+type FilterOptions struct {
+	// AllowKeys restricts log events to those with a label for one of the
+	// named keys.
+	AllowKeys []string
+	// DenyKeys drops log and label events with a label for any of the named
+	// keys.
+	DenyKeys []string
+	// AllowSpans restricts spans to those whose name starts with one of the
+	// prefixes.
+	AllowSpans []string
+	// DenySpans drops spans whose name starts with any of the prefixes.
+	DenySpans []string
+	// AllowMetrics restricts metrics to those with one of the names.
+	AllowMetrics []string
+	// DenyMetrics drops metrics with any of the names.
+	DenyMetrics []string
+}
+
+// Filter returns an exporter that only delivers the events allowed by opts to
+// output.
+// Metrics are filtered by the names of the metric.Data attached by a
+// metric.Config exporter, so a Filter that names metrics must come after one.
+// When a span is dropped, both its start and end events are dropped; events
+// inside the span are still delivered, and appear to belong to the enclosing
+// span.
+func Filter(output event.Exporter, opts FilterOptions) event.Exporter {
+	f := &filter{opts: opts}
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsStart(ev):
+			name := keys.Start.Get(lm)
+			if !f.allowed(name, opts.AllowSpans, opts.DenySpans, strings.HasPrefix) {
+				return markSpan(ctx, true)
+			}
+			ctx = markSpan(ctx, false)
+		case event.IsEnd(ev):
+			if spanDropped(ctx) {
+				return ctx
+			}
+		case event.IsMetric(ev):
+			var ok bool
+			if lm, ok = f.filterMetrics(lm); !ok {
+				return ctx
+			}
+		case event.IsLog(ev), event.IsLabel(ev):
+			if !f.allowEvent(ev, event.IsLog(ev)) {
+				return ctx
+			}
+		}
+		return output(ctx, ev, lm)
+	}
+}
+
+type filter struct {
+	opts FilterOptions
+}
+
+// allowed reports whether name passes the allow and deny lists, where match
+// is used to compare a name against a list entry.
+func (f *filter) allowed(name string, allow, deny []string, match func(name, entry string) bool) bool {
+	for _, entry := range deny {
+		if match(name, entry) {
+			return false
+		}
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	for _, entry := range allow {
+		if match(name, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filter) allowEvent(ev core.Event, isLog bool) bool {
+	requireAllowed := isLog && len(f.opts.AllowKeys) > 0
+	found := false
+	for index := 0; ev.Valid(index); index++ {
+		l := ev.Label(index)
+		if !l.Valid() {
+			continue
+		}
+		name := l.Key().Name()
+		if contains(f.opts.DenyKeys, name) {
+			return false
+		}
+		if requireAllowed && contains(f.opts.AllowKeys, name) {
+			found = true
+		}
+	}
+	return found || !requireAllowed
+}
+
+// filterMetrics removes the disallowed metrics from the metric entries of lm.
+// It returns false if nothing is left to deliver.
+func (f *filter) filterMetrics(lm label.Map) (label.Map, bool) {
+	if len(f.opts.AllowMetrics) == 0 && len(f.opts.DenyMetrics) == 0 {
+		return lm, true
+	}
+	entries, ok := metric.Entries.Get(lm).([]metric.Data)
+	if !ok {
+		return lm, true
+	}
+	var kept []metric.Data
+	for _, data := range entries {
+		if f.allowed(data.Handle(), f.opts.AllowMetrics, f.opts.DenyMetrics, equal) {
+			kept = append(kept, data)
+		}
+	}
+	if len(kept) == 0 {
+		return lm, false
+	}
+	if len(kept) < len(entries) {
+		lm = label.MergeMaps(label.NewMap(metric.Entries.Of(kept)), lm)
+	}
+	return lm, true
+}
+
+func contains(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b string) bool { return a == b }
+
+// markSpan records in the context whether the span being started has been
+// dropped, so that the matching end event can also be dropped.
+func markSpan(ctx context.Context, dropped bool) context.Context {
+	if !dropped && !spanDropped(ctx) {
+		// nothing above us was dropped either, so no need to record anything
+		return ctx
+	}
+	return context.WithValue(ctx, droppedSpanKey, dropped)
+}
+
+// spanDropped reports whether the innermost span of ctx was dropped.
+func spanDropped(ctx context.Context) bool {
+	dropped, _ := ctx.Value(droppedSpanKey).(bool)
+	return dropped
+}
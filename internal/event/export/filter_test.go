@@ -0,0 +1,85 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// recorder is an exporter that keeps a short description of every event it
+// sees.
+type recorder struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (r *recorder) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	var s string
+	switch {
+	case event.IsStart(ev):
+		s = "start " + keys.Start.Get(lm)
+	case event.IsEnd(ev):
+		s = "end"
+		if span := export.GetSpan(ctx); span != nil {
+			s += " " + span.Name
+		}
+	case event.IsLog(ev):
+		s = "log " + keys.Msg.Get(lm)
+	case event.IsMetric(ev):
+		s = "metric"
+	default:
+		s = fmt.Sprintf("other %v", ev)
+	}
+	r.mu.Lock()
+	r.seen = append(r.seen, s)
+	r.mu.Unlock()
+	return ctx
+}
+
+func (r *recorder) check(t *testing.T, want ...string) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !reflect.DeepEqual(r.seen, want) {
+		t.Errorf("got events %q\nwant %q", r.seen, want)
+	}
+	r.seen = nil
+}
+
+func TestFilter(t *testing.T) {
+	noisy := keys.NewString("noisy", "")
+	important := keys.NewString("important", "")
+	r := &recorder{}
+	event.SetExporter(export.Spans(export.Filter(r.ProcessEvent, export.FilterOptions{
+		DenyKeys:  []string{"noisy"},
+		DenySpans: []string{"cache."},
+	})))
+	defer event.SetExporter(nil)
+
+	ctx, done := event.Start(context.Background(), "request")
+	inner, innerDone := event.Start(ctx, "cache.lookup")
+	event.Log(inner, "lookup", important.Of("yes"))
+	event.Log(inner, "chatter", noisy.Of("yes"))
+	innerDone()
+	done()
+	r.check(t, "start request", "log lookup", "end request")
+
+	event.SetExporter(export.Filter(r.ProcessEvent, export.FilterOptions{
+		AllowKeys: []string{"important"},
+	}))
+	event.Log(context.Background(), "dropped")
+	event.Log(context.Background(), "kept", important.Of("yes"))
+	r.check(t, "log kept")
+}
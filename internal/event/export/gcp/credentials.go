@@ -0,0 +1,269 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event/core"
+)
+
+// This file implements the subset of application default credentials needed
+// to call the Google Cloud APIs, without depending on golang.org/x/oauth2.
+// Credentials are found, in order, in the file named by
+// $GOOGLE_APPLICATION_CREDENTIALS, in the file written by
+// "gcloud auth application-default login", and from the metadata server of
+// the machine the program is running on.
+
+// TokenSource supplies the OAuth2 access tokens used to authenticate
+// requests.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// scope is the OAuth2 scope requested for all tokens.
+const scope = "https://www.googleapis.com/auth/cloud-platform"
+
+const (
+	metadataHost = "http://metadata.google.internal/computeMetadata/v1/"
+	googleToken  = "https://oauth2.googleapis.com/token"
+)
+
+// credentialsFile is the union of the fields of the service account and
+// authorized user credential files.
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// Service account fields.
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ProjectID    string `json:"project_id"`
+
+	// Authorized user fields.
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id"`
+}
+
+// DefaultCredentials finds the application default credentials, returning
+// them along with the project they belong to, if it is known.
+func DefaultCredentials(client *http.Client) (TokenSource, string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if filename := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); filename != "" {
+		return credentialsFromFile(client, filename)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		filename := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+		if _, err := os.Stat(filename); err == nil {
+			return credentialsFromFile(client, filename)
+		}
+	}
+	return &cachedToken{fetch: metadataToken(client)}, "", nil
+}
+
+func credentialsFromFile(client *http.Client, filename string) (TokenSource, string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading credentials: %v", err)
+	}
+	var f credentialsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, "", fmt.Errorf("parsing credentials %s: %v", filename, err)
+	}
+	switch f.Type {
+	case "service_account":
+		key, err := parseKey(f.PrivateKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("parsing credentials %s: %v", filename, err)
+		}
+		if f.TokenURI == "" {
+			f.TokenURI = googleToken
+		}
+		return &cachedToken{fetch: serviceAccountToken(client, &f, key)}, f.ProjectID, nil
+	case "authorized_user":
+		return &cachedToken{fetch: refreshToken(client, &f)}, f.QuotaProjectID, nil
+	default:
+		return nil, "", fmt.Errorf("credentials %s have unsupported type %q", filename, f.Type)
+	}
+}
+
+func parseKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// cachedToken reuses a token until shortly before it expires.
+type cachedToken struct {
+	fetch func(ctx context.Context) (string, time.Duration, error)
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (c *cachedToken) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := core.Now()
+	if c.token != "" && now.Before(c.expires) {
+		return c.token, nil
+	}
+	token, lifetime, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, now.Add(lifetime-time.Minute)
+	return token, nil
+}
+
+// tokenResponse is the response of both the token endpoints and the metadata
+// server.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func decodeToken(res *http.Response, err error) (string, time.Duration, error) {
+	if err != nil {
+		return "", 0, fmt.Errorf("fetching token: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("fetching token: %v", res.Status)
+	}
+	var t tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return "", 0, fmt.Errorf("decoding token: %v", err)
+	}
+	return t.AccessToken, time.Duration(t.ExpiresIn) * time.Second, nil
+}
+
+func postForm(ctx context.Context, client *http.Client, uri string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(req)
+}
+
+// serviceAccountToken exchanges a signed JWT assertion for a token.
+func serviceAccountToken(client *http.Client, f *credentialsFile, key *rsa.PrivateKey) func(context.Context) (string, time.Duration, error) {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		now := core.Now()
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": f.PrivateKeyID})
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss":   f.ClientEmail,
+			"scope": scope,
+			"aud":   f.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		})
+		enc := base64.RawURLEncoding
+		unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+		sum := sha256.Sum256([]byte(unsigned))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		if err != nil {
+			return "", 0, fmt.Errorf("signing token request: %v", err)
+		}
+		return decodeToken(postForm(ctx, client, f.TokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {unsigned + "." + enc.EncodeToString(sig)},
+		}))
+	}
+}
+
+// refreshToken uses the refresh token of a user to get a token.
+func refreshToken(client *http.Client, f *credentialsFile) func(context.Context) (string, time.Duration, error) {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		return decodeToken(postForm(ctx, client, googleToken, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {f.ClientID},
+			"client_secret": {f.ClientSecret},
+			"refresh_token": {f.RefreshToken},
+		}))
+	}
+}
+
+// metadataToken gets the token of the default service account of the machine.
+func metadataToken(client *http.Client) func(context.Context) (string, time.Duration, error) {
+	return func(ctx context.Context) (string, time.Duration, error) {
+		req, err := metadataRequest(ctx, "instance/service-accounts/default/token")
+		if err != nil {
+			return "", 0, err
+		}
+		return decodeToken(client.Do(req))
+	}
+}
+
+func metadataRequest(ctx context.Context, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataHost+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return req, nil
+}
+
+// DefaultProject returns the project to use when none is configured, from
+// $GOOGLE_CLOUD_PROJECT or the metadata server.
+func DefaultProject(ctx context.Context, client *http.Client) (string, error) {
+	if p := os.Getenv("GOOGLE_CLOUD_PROJECT"); p != "" {
+		return p, nil
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := metadataRequest(ctx, "project/project-id")
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("no project configured, and the metadata server is unavailable: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("no project configured, and the metadata server returned %v", res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
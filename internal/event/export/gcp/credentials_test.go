@@ -0,0 +1,88 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event/export/gcp"
+)
+
+func TestServiceAccountCredentials(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("assertion %q is not a JWT", r.Form.Get("assertion"))
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("bad signature: %v", err)
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"iss":"exporter@my-project.iam.gserviceaccount.com"`) {
+			t.Errorf("got claims %s", claims)
+		}
+		w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	der := x509.MarshalPKCS1PrivateKey(key)
+	creds, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "my-project",
+		"client_email": "exporter@my-project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL,
+	})
+	filename := filepath.Join(t.TempDir(), "credentials.json")
+	if err := ioutil.WriteFile(filename, creds, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filename)
+
+	source, project, err := gcp.DefaultCredentials(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project != "my-project" {
+		t.Errorf("got project %q, want my-project", project)
+	}
+	for i := 0; i < 2; i++ {
+		token, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "token" {
+			t.Errorf("got token %q", token)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("token fetched %d times, want it cached after the first", fetches)
+	}
+}
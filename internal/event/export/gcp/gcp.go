@@ -0,0 +1,116 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gcp exports telemetry to Google Cloud.
+//
+// TraceExporter writes spans to Cloud Trace, and MetricExporter writes
+// metrics to Cloud Monitoring, both authenticating with the application
+// default credentials unless others are configured.
+//
+// Importing the package registers "cloudtrace" and "cloudmonitoring"
+// exporters whose options are the project to export to, which defaults to the
+// project of the credentials.
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+// Config describes the project telemetry is exported to.
+type Config struct {
+	// ProjectID overrides the project found from the credentials or the
+	// environment.
+	ProjectID string
+	// Credentials authenticate the requests, they default to the application
+	// default credentials.
+	Credentials TokenSource
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+	// Endpoint overrides the base URL of the API, it is used for testing.
+	Endpoint string
+}
+
+func init() {
+	export.Register("cloudtrace", func(project string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := NewTraceExporter(&Config{ProjectID: project})
+		if err != nil {
+			return nil, nil, err
+		}
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, batcher, nil
+	})
+}
+
+// resolveTimeout bounds how long finding the credentials and project may
+// take, as it may involve the metadata server.
+const resolveTimeout = 5 * time.Second
+
+// resolve fills in the defaults of the configuration.
+func resolve(config *Config, endpoint string) (*Config, error) {
+	resolved := *config
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(nil)
+	}
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = endpoint
+	}
+	if resolved.Credentials == nil {
+		creds, project, err := DefaultCredentials(resolved.Client)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Credentials = creds
+		if resolved.ProjectID == "" {
+			resolved.ProjectID = project
+		}
+	}
+	if resolved.ProjectID == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+		project, err := DefaultProject(ctx, resolved.Client)
+		if err != nil {
+			return nil, err
+		}
+		resolved.ProjectID = project
+	}
+	return &resolved, nil
+}
+
+// post sends message as JSON to the path below the configured endpoint.
+func (c *Config) post(ctx context.Context, path string, message interface{}) error {
+	blob, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message for %v: %v", path, err)
+	}
+	token, err := c.Credentials.Token(ctx)
+	if err != nil {
+		return err
+	}
+	uri := c.Endpoint + path
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%v rejected message: %v", uri, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+const monitoringEndpoint = "https://monitoring.googleapis.com"
+
+// maxSeriesPerWrite is the most time series Cloud Monitoring accepts in a
+// single write.
+const maxSeriesPerWrite = 200
+
+func init() {
+	export.Register("cloudmonitoring", func(project string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := NewMetricExporter(&Config{ProjectID: project})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// MetricExporter writes metrics to Cloud Monitoring as custom metrics.
+// It writes the latest value of every metric at the start of each minute,
+// which is as often as Cloud Monitoring allows a series to be written, and
+// creates the descriptor of each metric before its first write.
+type MetricExporter struct {
+	config *Config
+	start  time.Time
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	latest    map[string]metric.Data
+	described map[string]bool
+}
+
+var _ export.MetricExporter = (*MetricExporter)(nil)
+
+// NewMetricExporter returns an exporter for the configured project.
+// The exporter is managed, so the package level Flush and Shutdown functions
+// write the current values.
+func NewMetricExporter(config *Config) (*MetricExporter, error) {
+	resolved, err := resolve(config, monitoringEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("cloudmonitoring exporter: %v", err)
+	}
+	e := &MetricExporter{
+		config:    resolved,
+		start:     core.Now(),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		latest:    make(map[string]metric.Data),
+		described: make(map[string]bool),
+	}
+	go e.run()
+	export.Manage(e)
+	return e, nil
+}
+
+func (e *MetricExporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if event.IsMetric(ev) {
+		e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	}
+	return ctx
+}
+
+// ProcessMetrics records the latest values of the metrics, so that they are
+// written at the start of the next minute.
+func (e *MetricExporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, data := range metrics {
+		e.latest[data.Handle()] = data
+	}
+}
+
+func (e *MetricExporter) run() {
+	defer close(e.done)
+	for {
+		now := core.Now()
+		wait := now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+		select {
+		case <-time.After(wait):
+			ctx, cancel := export.TimeoutContext(context.Background())
+			export.ReportError(e.Flush(ctx))
+			cancel()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Shutdown stops the periodic writes, and then writes the current values.
+func (e *MetricExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	export.Unmanage(e)
+	return e.Flush(ctx)
+}
+
+// Flush writes the current value of every metric, creating the descriptors of
+// any metrics that have not been written before.
+func (e *MetricExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.latest))
+	for name := range e.latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := core.Now()
+	var series []*timeSeries
+	var describe []*metricDescriptor
+	for _, name := range names {
+		data := e.latest[name]
+		if !e.described[name] {
+			describe = append(describe, e.descriptor(data))
+		}
+		series = append(series, e.convert(data, now)...)
+	}
+	e.mu.Unlock()
+
+	project := "/v3/projects/" + e.config.ProjectID
+	for _, d := range describe {
+		if err := e.config.post(ctx, project+"/metricDescriptors", d); err != nil {
+			return fmt.Errorf("cloudmonitoring exporter: creating %s: %v", d.Type, err)
+		}
+		e.mu.Lock()
+		e.described[d.name] = true
+		e.mu.Unlock()
+	}
+	for len(series) > 0 {
+		n := len(series)
+		if n > maxSeriesPerWrite {
+			n = maxSeriesPerWrite
+		}
+		if err := e.config.post(ctx, project+"/timeSeries", &createTimeSeries{TimeSeries: series[:n]}); err != nil {
+			return fmt.Errorf("cloudmonitoring exporter: %v", err)
+		}
+		series = series[n:]
+	}
+	return nil
+}
+
+// These types hold the subset of the Cloud Monitoring v3 API used by the
+// exporter.
+
+type metricDescriptor struct {
+	name        string
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Unit        string            `json:"unit,omitempty"`
+	MetricKind  string            `json:"metricKind"`
+	ValueType   string            `json:"valueType"`
+	Labels      []labelDescriptor `json:"labels,omitempty"`
+}
+
+type labelDescriptor struct {
+	Key       string `json:"key"`
+	ValueType string `json:"valueType"`
+}
+
+type createTimeSeries struct {
+	TimeSeries []*timeSeries `json:"timeSeries"`
+}
+
+type timeSeries struct {
+	Metric     *metricLabels `json:"metric"`
+	Resource   *resource     `json:"resource"`
+	MetricKind string        `json:"metricKind"`
+	ValueType  string        `json:"valueType"`
+	Points     []*point      `json:"points"`
+}
+
+type metricLabels struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type resource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+type point struct {
+	Interval *interval `json:"interval"`
+	Value    *value    `json:"value"`
+}
+
+type interval struct {
+	StartTime string `json:"startTime,omitempty"`
+	EndTime   string `json:"endTime"`
+}
+
+// value holds exactly one of its fields.
+type value struct {
+	Int64Value        string        `json:"int64Value,omitempty"`
+	DoubleValue       *float64      `json:"doubleValue,omitempty"`
+	DistributionValue *distribution `json:"distributionValue,omitempty"`
+}
+
+type distribution struct {
+	Count         string         `json:"count"`
+	Mean          float64        `json:"mean"`
+	BucketOptions *bucketOptions `json:"bucketOptions"`
+	BucketCounts  []string       `json:"bucketCounts"`
+}
+
+type bucketOptions struct {
+	ExplicitBuckets *explicitBuckets `json:"explicitBuckets"`
+}
+
+type explicitBuckets struct {
+	Bounds []float64 `json:"bounds"`
+}
+
+func metricType(name string) string {
+	return "custom.googleapis.com/" + strings.ReplaceAll(name, ".", "/")
+}
+
+// kinds returns the metric kind and value type of the data.
+func kinds(data metric.Data) (string, string) {
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		if data.IsGauge || data.IsUpDown {
+			return "GAUGE", "INT64"
+		}
+		return "CUMULATIVE", "INT64"
+	case *metric.Float64Data:
+		if data.IsGauge || data.IsUpDown {
+			return "GAUGE", "DOUBLE"
+		}
+		return "CUMULATIVE", "DOUBLE"
+	default:
+		return "CUMULATIVE", "DISTRIBUTION"
+	}
+}
+
+func (e *MetricExporter) descriptor(data metric.Data) *metricDescriptor {
+	d := &metricDescriptor{name: data.Handle(), Type: metricType(data.Handle()), Unit: metric.UnitOf(data)}
+	d.MetricKind, d.ValueType = kinds(data)
+	var keys []label.Key
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		d.Description, keys = data.Info.Description, data.Info.Keys
+	case *metric.Float64Data:
+		d.Description, keys = data.Info.Description, data.Info.Keys
+	case *metric.HistogramInt64Data:
+		d.Description, keys = data.Info.Description, data.Info.Keys
+	case *metric.HistogramFloat64Data:
+		d.Description, keys = data.Info.Description, data.Info.Keys
+	}
+	for _, k := range keys {
+		d.Labels = append(d.Labels, labelDescriptor{Key: labelKey(k.Name()), ValueType: "STRING"})
+	}
+	return d
+}
+
+func (e *MetricExporter) convert(data metric.Data, now time.Time) []*timeSeries {
+	kind, valueType := kinds(data)
+	span := &interval{EndTime: timestamp(now)}
+	if kind == "CUMULATIVE" {
+		span.StartTime = timestamp(e.start)
+	}
+	var series []*timeSeries
+	add := func(group []label.Label, v *value) {
+		s := &timeSeries{
+			Metric:     &metricLabels{Type: metricType(data.Handle())},
+			Resource:   &resource{Type: "global", Labels: map[string]string{"project_id": e.config.ProjectID}},
+			MetricKind: kind,
+			ValueType:  valueType,
+			Points:     []*point{{Interval: span, Value: v}},
+		}
+		for _, l := range group {
+			if l.Valid() {
+				if s.Metric.Labels == nil {
+					s.Metric.Labels = make(map[string]string)
+				}
+				s.Metric.Labels[labelKey(l.Key().Name())] = fmt.Sprint(export.LabelValue(l))
+			}
+		}
+		series = append(series, s)
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			add(group, &value{Int64Value: strconv.FormatInt(data.Rows[i], 10)})
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			v := data.Rows[i]
+			add(group, &value{DoubleValue: &v})
+		}
+	case *metric.HistogramInt64Data:
+		bounds := make([]float64, len(data.Info.Buckets))
+		for i, b := range data.Info.Buckets {
+			bounds[i] = float64(b)
+		}
+		for i, group := range groups {
+			row := data.Rows[i]
+			add(group, &value{DistributionValue: newDistribution(bounds, row.Values, row.Count, float64(row.Sum))})
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			add(group, &value{DistributionValue: newDistribution(data.Info.Buckets, row.Values, row.Count, row.Sum)})
+		}
+	}
+	return series
+}
+
+// newDistribution converts the cumulative bucket values of a histogram row
+// into the per bucket counts of a distribution, which has an underflow bucket
+// below the first bound and an overflow bucket above the last.
+// A histogram counts a value equal to a bound in the bucket below it, where a
+// distribution counts it in the bucket above, which the conversion ignores.
+func newDistribution(bounds []float64, values []int64, count int64, sum float64) *distribution {
+	d := &distribution{
+		Count:         strconv.FormatInt(count, 10),
+		BucketOptions: &bucketOptions{ExplicitBuckets: &explicitBuckets{Bounds: bounds}},
+	}
+	if count > 0 {
+		d.Mean = sum / float64(count)
+	}
+	var below int64
+	for _, v := range values {
+		d.BucketCounts = append(d.BucketCounts, strconv.FormatInt(v-below, 10))
+		below = v
+	}
+	d.BucketCounts = append(d.BucketCounts, strconv.FormatInt(count-below, 10))
+	return d
+}
+
+// labelKey replaces the characters not allowed in label keys with
+// underscores.
+func labelKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/gcp"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestMetricExporter(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, r.URL.Path+" "+string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	method := keys.NewString("Method", "")
+	calls := keys.NewInt64("calls", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "rpc.calls", Description: "calls by method", Keys: []label.Key{method}}.SumInt64(&m, calls)
+	metric.HistogramFloat64{Name: "rpc.latency", Buckets: []float64{1, 10}}.Record(&m, latency)
+
+	exporter, err := gcp.NewMetricExporter(&gcp.Config{
+		ProjectID:   "my-project",
+		Credentials: staticToken("token"),
+		Endpoint:    srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SetExporter(m.Exporter(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+	ctx := context.Background()
+	event.Metric(ctx, method.Of("get"), calls.Of(2))
+	for _, v := range []float64{0.5, 5, 50} {
+		event.Metric(ctx, latency.Of(v))
+	}
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 4 {
+		t.Fatalf("got requests %v, want two descriptors and two writes", requests)
+	}
+	for i, want := range [][]string{
+		{`/v3/projects/my-project/metricDescriptors`, `"type":"custom.googleapis.com/rpc/calls"`, `"metricKind":"CUMULATIVE","valueType":"INT64","labels":[{"key":"method","valueType":"STRING"}]`},
+		{`/v3/projects/my-project/metricDescriptors`, `"type":"custom.googleapis.com/rpc/latency"`, `"valueType":"DISTRIBUTION"`},
+		{`/v3/projects/my-project/timeSeries`, `"labels":{"method":"get"}`, `"int64Value":"2"`, `"count":"3","mean":18.5`, `"bounds":[1,10]}},"bucketCounts":["1","1","1"]`, `"resource":{"type":"global","labels":{"project_id":"my-project"}}`},
+		{`/v3/projects/my-project/timeSeries`},
+	} {
+		for _, w := range want {
+			if !strings.Contains(requests[i], w) {
+				t.Errorf("request %d %s\ndoes not contain %s", i, requests[i], w)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+const traceEndpoint = "https://cloudtrace.googleapis.com"
+
+// TraceExporter is an export.BatchExporter that writes spans to Cloud Trace.
+// Metrics are ignored.
+type TraceExporter struct {
+	config *Config
+}
+
+var _ export.BatchExporter = (*TraceExporter)(nil)
+
+// NewTraceExporter returns an exporter for the configured project.
+func NewTraceExporter(config *Config) (*TraceExporter, error) {
+	resolved, err := resolve(config, traceEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("cloudtrace exporter: %v", err)
+	}
+	return &TraceExporter{config: resolved}, nil
+}
+
+// ExportSpans writes the spans with a single batchWrite call.
+func (e *TraceExporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	request := &batchWrite{Spans: make([]*traceSpan, len(spans))}
+	for i, s := range spans {
+		request.Spans[i] = e.convertSpan(s)
+	}
+	if err := e.config.post(ctx, "/v2/projects/"+e.config.ProjectID+"/traces:batchWrite", request); err != nil {
+		return fmt.Errorf("cloudtrace exporter: %v", err)
+	}
+	return nil
+}
+
+// ExportMetrics does nothing, as Cloud Trace only accepts spans.
+func (e *TraceExporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+// These types hold the subset of the Cloud Trace v2 API used by the exporter.
+
+type batchWrite struct {
+	Spans []*traceSpan `json:"spans"`
+}
+
+type traceSpan struct {
+	Name         string           `json:"name"`
+	SpanID       string           `json:"spanId"`
+	ParentSpanID string           `json:"parentSpanId,omitempty"`
+	DisplayName  *truncatable     `json:"displayName"`
+	StartTime    string           `json:"startTime"`
+	EndTime      string           `json:"endTime,omitempty"`
+	Attributes   *traceAttributes `json:"attributes,omitempty"`
+	TimeEvents   *traceTimeEvents `json:"timeEvents,omitempty"`
+	Status       *traceSpanStatus `json:"status,omitempty"`
+}
+
+type truncatable struct {
+	Value string `json:"value"`
+}
+
+type traceAttributes struct {
+	AttributeMap map[string]*attributeValue `json:"attributeMap"`
+}
+
+// attributeValue holds exactly one of its fields.
+type attributeValue struct {
+	StringValue *truncatable `json:"stringValue,omitempty"`
+	IntValue    string       `json:"intValue,omitempty"`
+	BoolValue   *bool        `json:"boolValue,omitempty"`
+}
+
+type traceTimeEvents struct {
+	TimeEvent []*traceTimeEvent `json:"timeEvent"`
+}
+
+type traceTimeEvent struct {
+	Time       string      `json:"time"`
+	Annotation *annotation `json:"annotation"`
+}
+
+type annotation struct {
+	Description *truncatable     `json:"description"`
+	Attributes  *traceAttributes `json:"attributes,omitempty"`
+}
+
+// traceSpanStatus uses the google.rpc.Code values, where 2 is UNKNOWN.
+type traceSpanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (e *TraceExporter) convertSpan(span *export.Span) *traceSpan {
+	traceID, spanID := span.ID.TraceID.String(), span.ID.SpanID.String()
+	result := &traceSpan{
+		Name:        "projects/" + e.config.ProjectID + "/traces/" + traceID + "/spans/" + spanID,
+		SpanID:      spanID,
+		DisplayName: &truncatable{Value: span.Name},
+		StartTime:   timestamp(span.Start().At()),
+	}
+	if span.ParentID.IsValid() {
+		result.ParentSpanID = span.ParentID.String()
+	}
+	if end := span.Finish().At(); !end.IsZero() {
+		result.EndTime = timestamp(end)
+	}
+	var labels []label.Label
+	for i := 1; span.Start().Valid(i); i++ {
+		labels = append(labels, span.Start().Label(i))
+	}
+	result.Attributes = convertAttributes(append(labels, span.Labels()...))
+	for _, ev := range span.Events() {
+		if !event.IsLog(ev) {
+			continue
+		}
+		description := keys.Msg.From(ev.Label(0))
+		index := 1
+		if event.IsError(ev) {
+			index = 2
+			if err := keys.Err.From(ev.Label(1)); err != nil {
+				description = strings.TrimPrefix(description+": "+err.Error(), ": ")
+			}
+			result.Status = &traceSpanStatus{Code: 2, Message: description}
+		}
+		var evLabels []label.Label
+		for ; ev.Valid(index); index++ {
+			evLabels = append(evLabels, ev.Label(index))
+		}
+		if result.TimeEvents == nil {
+			result.TimeEvents = &traceTimeEvents{}
+		}
+		result.TimeEvents.TimeEvent = append(result.TimeEvents.TimeEvent, &traceTimeEvent{
+			Time: timestamp(ev.At()),
+			Annotation: &annotation{
+				Description: &truncatable{Value: description},
+				Attributes:  convertAttributes(evLabels),
+			},
+		})
+	}
+	return result
+}
+
+// convertAttributes maps labels to attributes, Cloud Trace has no floating
+// point attributes so they are sent as strings.
+func convertAttributes(labels []label.Label) *traceAttributes {
+	var attrs *traceAttributes
+	for _, l := range labels {
+		if !l.Valid() {
+			continue
+		}
+		var v attributeValue
+		switch value := export.LabelValue(l).(type) {
+		case int64:
+			v.IntValue = strconv.FormatInt(value, 10)
+		case uint64:
+			v.IntValue = strconv.FormatUint(value, 10)
+		case bool:
+			v.BoolValue = &value
+		default:
+			v.StringValue = &truncatable{Value: fmt.Sprint(value)}
+		}
+		if attrs == nil {
+			attrs = &traceAttributes{AttributeMap: make(map[string]*attributeValue)}
+		}
+		attrs.AttributeMap[l.Key().Name()] = &v
+	}
+	return attrs
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/gcp"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type staticToken string
+
+func (s staticToken) Token(ctx context.Context) (string, error) { return string(s), nil }
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestTraceExporter(t *testing.T) {
+	var got struct {
+		Spans []map[string]interface{} `json:"spans"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/projects/my-project/traces:batchWrite" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("got request for %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, done := event.Start(context.Background(), "hover",
+		keys.NewString("file", "").Of("main.go"),
+		keys.NewInt("line", "").Of(3),
+		keys.NewFloat64("ratio", "").Of(0.5))
+	event.Error(ctx, "failed", errors.New("timeout"))
+	done()
+	event.SetExporter(nil)
+
+	exporter, err := gcp.NewTraceExporter(&gcp.Config{
+		ProjectID:   "my-project",
+		Credentials: staticToken("token"),
+		Endpoint:    srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(got.Spans))
+	}
+	data, _ := json.Marshal(got.Spans[0])
+	span := string(data)
+	for _, want := range []string{
+		`"name":"projects/my-project/traces/` + f.spans[0].ID.TraceID.String() + `/spans/` + f.spans[0].ID.SpanID.String() + `"`,
+		`"displayName":{"value":"hover"}`,
+		`"file":{"stringValue":{"value":"main.go"}}`,
+		`"line":{"intValue":"3"}`,
+		`"ratio":{"stringValue":{"value":"0.5"}}`,
+		`"annotation":{"description":{"value":"failed: timeout"}}`,
+		`"status":{"code":2,"message":"failed: timeout"}`,
+	} {
+		if !strings.Contains(span, want) {
+			t.Errorf("span %s\ndoes not contain %s", span, want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package graphite sends metrics to a Graphite server using the plaintext
+// protocol over TCP.
+//
+// Every flush interval the latest value of each series is sent as
+// "path value timestamp", where the path is the prefix, the metric name and
+// then the label values, separated by dots. Histograms are sent as the count,
+// sum, min and max of each series, with a "le_<bound>" path for the
+// cumulative count of each bucket.
+//
+// Importing the package registers a "graphite" exporter whose options are the
+// address of the server.
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultAddress is the address carbon normally accepts plaintext records on.
+const DefaultAddress = "localhost:2003"
+
+// DefaultInterval is how often metrics are sent if no interval is configured.
+const DefaultInterval = 10 * time.Second
+
+// Config configures an Exporter.
+type Config struct {
+	// Address is the TCP address of the server.
+	Address string
+	// Prefix is prepended to every path, it should normally end with a dot.
+	Prefix string
+	// Interval is how often the metrics are sent.
+	Interval time.Duration
+}
+
+func init() {
+	export.Register("graphite", func(address string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := Dial(&Config{Address: address})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter is an export.MetricExporter that periodically sends the latest
+// value of every metric to a Graphite server.
+type Exporter struct {
+	config Config
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	latest map[string]metric.Data
+
+	// connMu is held while sending, so that flushes do not interleave.
+	connMu sync.Mutex
+	conn   net.Conn
+}
+
+var _ export.MetricExporter = (*Exporter)(nil)
+
+// Dial returns an Exporter that sends to the configured server.
+// If the connection is later lost, it is dialed again on the next flush.
+// The Exporter is managed, so the package level Flush and Shutdown functions
+// send the current values.
+func Dial(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Address == "" {
+		resolved.Address = DefaultAddress
+	}
+	if resolved.Interval <= 0 {
+		resolved.Interval = DefaultInterval
+	}
+	conn, err := net.Dial("tcp", resolved.Address)
+	if err != nil {
+		return nil, fmt.Errorf("graphite exporter: %v", err)
+	}
+	e := &Exporter{
+		config: resolved,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		latest: make(map[string]metric.Data),
+		conn:   conn,
+	}
+	go e.run()
+	export.Manage(e)
+	return e, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if event.IsMetric(ev) {
+		e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	}
+	return ctx
+}
+
+// ProcessMetrics records the latest values of the metrics, so that they are
+// sent on the next flush.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, data := range metrics {
+		e.latest[data.Handle()] = data
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := export.TimeoutContext(context.Background())
+			export.ReportError(e.Flush(ctx))
+			cancel()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Flush sends the current value of every series.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.latest))
+	for name := range e.latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	at := core.Now().Unix()
+	for _, name := range names {
+		e.appendRecords(&buf, e.latest[name], at)
+	}
+	e.mu.Unlock()
+	if buf.Len() == 0 {
+		return nil
+	}
+	return e.send(ctx, buf.Bytes())
+}
+
+// Shutdown stops the periodic flushes, sends the current values, and then
+// closes the connection.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	export.Unmanage(e)
+	err := e.Flush(ctx)
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+	return err
+}
+
+// send writes the records, dialing the server again if the connection has
+// been lost.
+func (e *Exporter) send(ctx context.Context, records []byte) error {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	if e.conn == nil {
+		conn, err := export.Dial(ctx, e.config.Address, nil)
+		if err != nil {
+			return fmt.Errorf("graphite failed to connect to %v: %v", e.config.Address, err)
+		}
+		e.conn = conn
+	}
+	deadline, _ := ctx.Deadline()
+	e.conn.SetWriteDeadline(deadline)
+	if _, err := e.conn.Write(records); err != nil {
+		// Start again with a new connection rather than risk a partial record
+		// being joined to the next one.
+		e.conn.Close()
+		e.conn = nil
+		return fmt.Errorf("graphite failed to send metrics: %v", err)
+	}
+	return nil
+}
+
+func (e *Exporter) appendRecords(buf *bytes.Buffer, data metric.Data, at int64) {
+	name := e.config.Prefix + export.GraphiteNames.Name(data.Handle())
+	record := func(group []label.Label, suffix string, value string) {
+		buf.WriteString(name)
+		for _, l := range group {
+			if l.Valid() {
+				buf.WriteByte('.')
+				buf.WriteString(export.GraphiteComponents.Clean(fmt.Sprint(export.LabelValue(l))))
+			}
+		}
+		buf.WriteString(suffix)
+		fmt.Fprintf(buf, " %s %d\n", value, at)
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			record(group, "", strconv.FormatInt(data.Rows[i], 10))
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			record(group, "", formatFloat(data.Rows[i]))
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			record(group, ".count", strconv.FormatInt(row.Count, 10))
+			record(group, ".sum", strconv.FormatInt(row.Sum, 10))
+			record(group, ".min", strconv.FormatInt(row.Min, 10))
+			record(group, ".max", strconv.FormatInt(row.Max, 10))
+			for j, b := range data.Info.Buckets {
+				record(group, ".le_"+strconv.FormatInt(b, 10), strconv.FormatInt(row.Values[j], 10))
+			}
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			record(group, ".count", strconv.FormatInt(row.Count, 10))
+			record(group, ".sum", formatFloat(row.Sum))
+			record(group, ".min", formatFloat(row.Min))
+			record(group, ".max", formatFloat(row.Max))
+			for j, b := range data.Info.Buckets {
+				record(group, ".le_"+export.GraphiteComponents.Clean(formatFloat(b)), strconv.FormatInt(row.Values[j], 10))
+			}
+		}
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package graphite_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/graphite"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestFlush(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	exporter, err := graphite.Dial(&graphite.Config{
+		Address:  ln.Addr().String(),
+		Prefix:   "tools.",
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SetClock(fixedClock(time.Unix(1583418468, 0)))
+	defer event.SetClock(nil)
+	method := keys.NewString("method", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "gopls.requests", Keys: []label.Key{method}}.Count(&m, latency)
+	metric.HistogramFloat64{Name: "latency", Buckets: []float64{1.5, 10}}.Record(&m, latency)
+	event.SetExporter(m.Exporter(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+	event.Metric(context.Background(), method.Of("textDocument/hover"), latency.Of(2))
+	event.Metric(context.Background(), method.Of("textDocument/hover"), latency.Of(4))
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"tools.gopls.requests.textDocument_hover 2 1583418468",
+		"tools.latency.count 2 1583418468",
+		"tools.latency.sum 6 1583418468",
+		"tools.latency.min 2 1583418468",
+		"tools.latency.max 4 1583418468",
+		"tools.latency.le_1_5 0 1583418468",
+		"tools.latency.le_10 2 1583418468",
+	}
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got records %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got record %q, want %q", got[i], want[i])
+		}
+	}
+}
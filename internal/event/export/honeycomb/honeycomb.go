@@ -0,0 +1,195 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package honeycomb sends spans to honeycomb as wide events, using the batch
+// API.
+//
+// Each span becomes one event, with a column for each of its labels, and
+// each log event within a span becomes a span event linked to it.
+//
+// Importing the package registers a "honeycomb" exporter whose options are
+// the dataset to send to. The API key is read from the HONEYCOMB_API_KEY
+// environment variable.
+package honeycomb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// DefaultAPIHost is the honeycomb API endpoint.
+const DefaultAPIHost = "https://api.honeycomb.io"
+
+// APIKeyEnv is the environment variable the registered exporter reads the API
+// key from.
+const APIKeyEnv = "HONEYCOMB_API_KEY"
+
+type Config struct {
+	// APIKey authenticates the requests.
+	APIKey string
+	// Dataset is the dataset the events are added to.
+	Dataset string
+	// APIHost is the base URL of the API.
+	APIHost string
+	// Service is the service.name column of every event, it defaults to the
+	// name of the binary.
+	Service string
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+func init() {
+	export.Register("honeycomb", func(dataset string) (event.Exporter, export.Shutdowner, error) {
+		key := os.Getenv(APIKeyEnv)
+		if key == "" {
+			return nil, nil, fmt.Errorf("honeycomb exporter needs an API key in $%s", APIKeyEnv)
+		}
+		if dataset == "" {
+			return nil, nil, fmt.Errorf("honeycomb exporter needs a dataset")
+		}
+		exporter := New(&Config{APIKey: key, Dataset: dataset})
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, batcher, nil
+	})
+}
+
+// Exporter is an export.BatchExporter that sends spans to honeycomb.
+// Metrics are ignored.
+type Exporter struct {
+	config Config
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that sends to the configured dataset.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.APIHost == "" {
+		resolved.APIHost = DefaultAPIHost
+	}
+	resolved.APIHost = strings.TrimSuffix(resolved.APIHost, "/")
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(nil)
+	}
+	return &Exporter{config: resolved}
+}
+
+// Event is a single row of the batch API.
+type Event struct {
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// ExportSpans sends the events for the spans in a single request.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	var events []Event
+	for _, s := range spans {
+		events = e.appendEvents(events, s)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	blob, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("honeycomb failed to marshal events: %v", err)
+	}
+	uri := e.config.APIHost + "/1/batch/" + url.PathEscape(e.config.Dataset)
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("honeycomb failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", e.config.APIKey)
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("honeycomb failed to send events: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("honeycomb rejected events for %v: %v", uri, res.Status)
+	}
+	return nil
+}
+
+// ExportMetrics does nothing, as only spans are sent.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+func (e *Exporter) appendEvents(events []Event, span *export.Span) []Event {
+	start, end := span.Start().At(), span.Finish().At()
+	row := map[string]interface{}{
+		"name":           span.Name,
+		"service.name":   e.config.Service,
+		"trace.trace_id": span.ID.TraceID.String(),
+		"trace.span_id":  span.ID.SpanID.String(),
+	}
+	if span.ParentID.IsValid() {
+		row["trace.parent_id"] = span.ParentID.String()
+	}
+	if !end.IsZero() {
+		row["duration_ms"] = float64(end.Sub(start)) / float64(time.Millisecond)
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		if l := span.Start().Label(i); l.Valid() {
+			row[l.Key().Name()] = export.LabelValue(l)
+		}
+	}
+	for _, l := range span.Labels() {
+		if l.Valid() {
+			row[l.Key().Name()] = export.LabelValue(l)
+		}
+	}
+	spanRow := len(events)
+	events = append(events, Event{Time: start, Data: row})
+
+	for _, ev := range span.Events() {
+		if !event.IsLog(ev) {
+			continue
+		}
+		name := keys.Msg.From(ev.Label(0))
+		data := map[string]interface{}{
+			"name":                 name,
+			"service.name":         e.config.Service,
+			"trace.trace_id":       span.ID.TraceID.String(),
+			"trace.parent_id":      span.ID.SpanID.String(),
+			"meta.annotation_type": "span_event",
+		}
+		index := 1
+		if event.IsError(ev) {
+			index = 2
+			msg := name
+			if err := keys.Err.From(ev.Label(1)); err != nil {
+				msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+			}
+			data["error"] = msg
+			events[spanRow].Data["error"] = msg
+		}
+		for ; ev.Valid(index); index++ {
+			if l := ev.Label(index); l.Valid() {
+				data[l.Key().Name()] = export.LabelValue(l)
+			}
+		}
+		events = append(events, Event{Time: ev.At(), Data: data})
+	}
+	return events
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package honeycomb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/honeycomb"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestExportSpans(t *testing.T) {
+	var got []honeycomb.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/batch/gopls" || r.Header.Get("X-Honeycomb-Team") != "secret" {
+			t.Errorf("got request for %s with key %q", r.URL.Path, r.Header.Get("X-Honeycomb-Team"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	event.Error(ctx, "failed", errors.New("timeout"), keys.NewInt("line", "").Of(3))
+	done()
+	event.SetExporter(nil)
+
+	exporter := honeycomb.New(&honeycomb.Config{APIKey: "secret", Dataset: "gopls", APIHost: srv.URL, Service: "tests"})
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want a span and a span event", len(got))
+	}
+	span, ev := got[0].Data, got[1].Data
+	if span["name"] != "hover" || span["file"] != "main.go" || span["service.name"] != "tests" || span["error"] != "failed: timeout" {
+		t.Errorf("got span row %v", span)
+	}
+	if _, ok := span["duration_ms"].(float64); !ok {
+		t.Errorf("span row has no duration: %v", span)
+	}
+	if ev["trace.parent_id"] != span["trace.span_id"] || ev["meta.annotation_type"] != "span_event" || ev["line"] != float64(3) {
+		t.Errorf("got span event row %v", ev)
+	}
+}
@@ -28,39 +28,102 @@ func (s SpanID) IsValid() bool {
 	return s != SpanID{}
 }
 
+// IDGenerator chooses the IDs of new traces and spans.
+// Backends that require IDs with a particular structure, such as the time
+// prefixed trace IDs of X-Ray, and tests that need deterministic IDs, can
+// install their own with SetIDGenerator.
+// The IDs are chosen as each span starts, the trace ID only for root spans,
+// so they identify the span to every exporter. Both methods may be called
+// concurrently, and must never return a zero ID.
+type IDGenerator interface {
+	NewTraceID() TraceID
+	NewSpanID() SpanID
+}
+
 var (
+	// seedOnce seeds the default generator the first time it is used.
+	seedOnce   sync.Once
+	nextSpanID uint64
+	spanIDInc  uint64
+
+	// generationMu guards traceIDRand, which is not safe for concurrent use.
 	generationMu sync.Mutex
-	nextSpanID   uint64
-	spanIDInc    uint64
+	traceIDAdd   [2]uint64
+	traceIDRand  *rand.Rand
 
-	traceIDAdd  [2]uint64
-	traceIDRand *rand.Rand
+	// generator holds the installedGenerator set by SetIDGenerator, so that
+	// starting a span does not take a lock to find it.
+	generator atomic.Value
 )
 
-func initGenerator() {
-	var rngSeed int64
-	for _, p := range []interface{}{
-		&rngSeed, &traceIDAdd, &nextSpanID, &spanIDInc,
-	} {
-		binary.Read(crand.Reader, binary.LittleEndian, p)
+// installedGenerator wraps the generator set by SetIDGenerator, as an
+// atomic.Value must always hold values of the same type.
+type installedGenerator struct{ IDGenerator }
+
+// SetIDGenerator sets the generator used to choose the IDs of new traces and
+// spans. Passing nil restores the default, which generates random IDs.
+func SetIDGenerator(g IDGenerator) {
+	generator.Store(installedGenerator{g})
+}
+
+// SetTraceIDGenerator sets the function used to choose the ID of each new
+// trace, for backends that require IDs with a particular structure, while
+// the span IDs are generated as by default.
+// Passing nil restores the default, which generates random IDs.
+func SetTraceIDGenerator(f func() TraceID) {
+	if f == nil {
+		SetIDGenerator(nil)
+		return
+	}
+	SetIDGenerator(traceIDFunc(f))
+}
+
+// traceIDFunc is the IDGenerator installed by SetTraceIDGenerator.
+type traceIDFunc func() TraceID
+
+func (f traceIDFunc) NewTraceID() TraceID { return f() }
+func (f traceIDFunc) NewSpanID() SpanID   { return randomIDs{}.NewSpanID() }
+
+func currentGenerator() IDGenerator {
+	if g, _ := generator.Load().(installedGenerator); g.IDGenerator != nil {
+		return g.IDGenerator
 	}
-	traceIDRand = rand.New(rand.NewSource(rngSeed))
-	spanIDInc |= 1
+	return randomIDs{}
+}
+
+func newTraceID() TraceID { return currentGenerator().NewTraceID() }
+func newSpanID() SpanID   { return currentGenerator().NewSpanID() }
+
+// randomIDs is the default IDGenerator.
+type randomIDs struct{}
+
+// seed seeds the default generator from crypto/rand, the first time it is
+// called.
+func seed() {
+	seedOnce.Do(func() {
+		var rngSeed int64
+		for _, p := range []interface{}{
+			&rngSeed, &traceIDAdd, &nextSpanID, &spanIDInc,
+		} {
+			binary.Read(crand.Reader, binary.LittleEndian, p)
+		}
+		traceIDRand = rand.New(rand.NewSource(rngSeed))
+		spanIDInc |= 1
+	})
 }
 
-func newTraceID() TraceID {
+func (randomIDs) NewTraceID() TraceID {
+	seed()
 	generationMu.Lock()
 	defer generationMu.Unlock()
-	if traceIDRand == nil {
-		initGenerator()
-	}
 	var tid [16]byte
 	binary.LittleEndian.PutUint64(tid[0:8], traceIDRand.Uint64()+traceIDAdd[0])
 	binary.LittleEndian.PutUint64(tid[8:16], traceIDRand.Uint64()+traceIDAdd[1])
 	return tid
 }
 
-func newSpanID() SpanID {
+func (randomIDs) NewSpanID() SpanID {
+	seed()
 	var id uint64
 	for id == 0 {
 		id = atomic.AddUint64(&nextSpanID, spanIDInc)
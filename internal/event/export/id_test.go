@@ -0,0 +1,74 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// sequentialIDs generates IDs that count up from one, so that tests can
+// predict them.
+type sequentialIDs struct{ traces, spans uint32 }
+
+func (g *sequentialIDs) NewTraceID() export.TraceID {
+	var id export.TraceID
+	id[15] = byte(atomic.AddUint32(&g.traces, 1))
+	return id
+}
+
+func (g *sequentialIDs) NewSpanID() export.SpanID {
+	var id export.SpanID
+	id[7] = byte(atomic.AddUint32(&g.spans, 1))
+	return id
+}
+
+func TestIDGenerator(t *testing.T) {
+	export.SetIDGenerator(&sequentialIDs{})
+	defer export.SetIDGenerator(nil)
+	var spans []*export.Span
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			spans = append(spans, export.GetSpan(ctx))
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	ctx, done := event.Start(context.Background(), "root")
+	_, childDone := event.Start(ctx, "child")
+	childDone()
+	done()
+	_, otherDone := event.Start(context.Background(), "other")
+	otherDone()
+
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	for i, want := range []struct {
+		trace, span, parent string
+	}{
+		{"00000000000000000000000000000001", "0000000000000001", "0000000000000000"},
+		{"00000000000000000000000000000001", "0000000000000002", "0000000000000001"},
+		{"00000000000000000000000000000002", "0000000000000003", "0000000000000000"},
+	} {
+		span := spans[i]
+		if got := span.ID.TraceID.String(); got != want.trace {
+			t.Errorf("%s: got trace %s, want %s", span.Name, got, want.trace)
+		}
+		if got := span.ID.SpanID.String(); got != want.span {
+			t.Errorf("%s: got span %s, want %s", span.Name, got, want.span)
+		}
+		if got := span.ParentID.String(); got != want.parent {
+			t.Errorf("%s: got parent %s, want %s", span.Name, got, want.parent)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package influx writes metrics in the InfluxDB line protocol, either to the
+// write API of a server or to a local file.
+//
+// Each metric is a measurement, its labels are tags, and its value is the
+// "value" field. Histograms have count, sum, min and max fields, and an
+// "le_<bound>" field holding the cumulative count of each bucket.
+//
+// Importing the package registers an "influx" exporter whose options are the
+// write URL, such as http://localhost:8086/api/v2/write?org=o&bucket=b, or the
+// name of a file to append to. The token for a server is read from
+// $INFLUX_TOKEN. It writes the latest value of every metric about every
+// ten seconds.
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// TokenEnv is the environment variable the registered exporter reads the API
+// token from.
+const TokenEnv = "INFLUX_TOKEN"
+
+// Config configures an Exporter, exactly one of URL and File must be set.
+type Config struct {
+	// URL is the write endpoint of the server.
+	URL string
+	// Token, if set, is sent as the authorization for the writes.
+	Token string
+	// File is the name of a file the lines are appended to.
+	File string
+	// Precision is the unit of the timestamps, one of time.Nanosecond,
+	// time.Microsecond, time.Millisecond or time.Second. It defaults to
+	// nanoseconds.
+	Precision time.Duration
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+func init() {
+	export.Register("influx", func(options string) (event.Exporter, export.Shutdowner, error) {
+		config := &Config{File: options}
+		if strings.HasPrefix(options, "http://") || strings.HasPrefix(options, "https://") {
+			config = &Config{URL: options, Token: os.Getenv(TokenEnv)}
+		}
+		exporter, err := New(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader := export.Periodic(exporter, 10*time.Second, time.Second)
+		// Managed after the reader, so the file is not closed until the last
+		// metrics have been written.
+		export.Manage(exporter)
+		return reader.ProcessEvent, export.ShutdownAll(reader, exporter), nil
+	})
+}
+
+// Exporter is an export.BatchExporter that writes line protocol.
+// Spans are ignored.
+type Exporter struct {
+	config    Config
+	precision string
+	endpoint  string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+var precisions = map[time.Duration]string{
+	time.Nanosecond:  "ns",
+	time.Microsecond: "us",
+	time.Millisecond: "ms",
+	time.Second:      "s",
+}
+
+// New returns an Exporter that writes to the configured server or file.
+func New(config *Config) (*Exporter, error) {
+	resolved := *config
+	if (resolved.URL == "") == (resolved.File == "") {
+		return nil, fmt.Errorf("influx exporter needs either a URL or a file")
+	}
+	if resolved.Precision == 0 {
+		resolved.Precision = time.Nanosecond
+	}
+	e := &Exporter{config: resolved, precision: precisions[resolved.Precision]}
+	if e.precision == "" {
+		return nil, fmt.Errorf("influx exporter cannot use a precision of %v", resolved.Precision)
+	}
+	if resolved.File != "" {
+		f, err := os.OpenFile(resolved.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("influx exporter: %v", err)
+		}
+		e.file = f
+		return e, nil
+	}
+	u, err := url.Parse(resolved.URL)
+	if err != nil {
+		return nil, fmt.Errorf("influx exporter: %v", err)
+	}
+	query := u.Query()
+	query.Set("precision", e.precision)
+	u.RawQuery = query.Encode()
+	e.endpoint = u.String()
+	if e.config.Client == nil {
+		e.config.Client = export.HTTPClient(nil)
+	}
+	return e, nil
+}
+
+// ExportSpans implements export.BatchExporter, it does nothing.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	return nil
+}
+
+// ExportMetrics writes a line for each series of the metrics.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	var buf bytes.Buffer
+	for _, data := range metrics {
+		e.appendLines(&buf, data)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	if e.file != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, err := e.file.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("influx failed to write metrics: %v", err)
+		}
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, &buf)
+	if err != nil {
+		return fmt.Errorf("influx failed to build request for %v: %v", e.endpoint, err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+e.config.Token)
+	}
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("influx failed to send metrics: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("influx rejected metrics: %v", res.Status)
+	}
+	return nil
+}
+
+// Shutdown closes the file being written to.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+func (e *Exporter) appendLines(w *bytes.Buffer, data metric.Data) {
+	name := data.Handle()
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			e.line(w, name, group, data.EndTime, "value="+strconv.FormatInt(data.Rows[i], 10)+"i")
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			e.line(w, name, group, data.EndTime, "value="+formatFloat(data.Rows[i]))
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			fields := fmt.Sprintf("count=%di,sum=%di,min=%di,max=%di", row.Count, row.Sum, row.Min, row.Max)
+			for j, b := range data.Info.Buckets {
+				fields += fmt.Sprintf(",le_%d=%di", b, row.Values[j])
+			}
+			e.line(w, name, group, data.EndTime, fields)
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			fields := fmt.Sprintf("count=%di,sum=%s,min=%s,max=%s", row.Count, formatFloat(row.Sum), formatFloat(row.Min), formatFloat(row.Max))
+			for j, b := range data.Info.Buckets {
+				fields += fmt.Sprintf(",le_%s=%di", formatFloat(b), row.Values[j])
+			}
+			e.line(w, name, group, data.EndTime, fields)
+		}
+	}
+}
+
+// line writes a single line, with the tags sorted by key as the server
+// prefers.
+func (e *Exporter) line(w io.Writer, name string, group []label.Label, at time.Time, fields string) {
+	var tags []string
+	for _, l := range group {
+		if !l.Valid() {
+			continue
+		}
+		// Empty tag values are not allowed, so such tags are left out.
+		value := fmt.Sprint(export.LabelValue(l))
+		if value == "" {
+			continue
+		}
+		tags = append(tags, tagEscaper.Replace(l.Key().Name())+"="+tagEscaper.Replace(value))
+	}
+	sort.Strings(tags)
+	fmt.Fprint(w, measurementEscaper.Replace(name))
+	for _, tag := range tags {
+		fmt.Fprint(w, ",", tag)
+	}
+	fmt.Fprintf(w, " %s %d\n", fields, at.UnixNano()/int64(e.config.Precision))
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
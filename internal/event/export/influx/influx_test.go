@@ -0,0 +1,117 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package influx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/influx"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+type metricsFunc func([]metric.Data)
+
+func (f metricsFunc) ProcessMetrics(ctx context.Context, metrics []metric.Data) { f(metrics) }
+
+// record returns the metrics delivered after recording a request count and
+// latency for two methods.
+func record(t *testing.T) []metric.Data {
+	event.SetClock(fixedClock(time.Unix(1583418468, 500000000)))
+	defer event.SetClock(nil)
+	method := keys.NewString("method", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "requests", Keys: []label.Key{method}}.Count(&m, latency)
+	metric.HistogramFloat64{Name: "latency ms", Buckets: []float64{1, 10}}.Record(&m, latency)
+	var data []metric.Data
+	event.SetExporter(m.Exporter(export.MetricsOnly(metricsFunc(func(metrics []metric.Data) { data = metrics }))))
+	defer event.SetExporter(nil)
+	event.Metric(context.Background(), method.Of("text document/hover"), latency.Of(2))
+	event.Metric(context.Background(), method.Of("text document/hover"), latency.Of(4))
+	return data
+}
+
+const wantLines = "requests,method=text\\ document/hover value=2i 1583418468\n" +
+	"latency\\ ms count=2i,sum=6,min=2,max=4,le_1=0i,le_10=2i 1583418468\n"
+
+func TestHTTP(t *testing.T) {
+	var got, query, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got, query, auth = string(body), r.URL.RawQuery, r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	exporter, err := influx.New(&influx.Config{
+		URL:       srv.URL + "/api/v2/write?bucket=gopls",
+		Token:     "secret",
+		Precision: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.ExportMetrics(context.Background(), record(t)); err != nil {
+		t.Fatal(err)
+	}
+	if got != wantLines {
+		t.Errorf("got lines\n%s\nwant\n%s", got, wantLines)
+	}
+	if query != "bucket=gopls&precision=s" {
+		t.Errorf("got query %q", query)
+	}
+	if auth != "Token secret" {
+		t.Errorf("got authorization %q", auth)
+	}
+}
+
+func TestFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.lp")
+	exporter, err := influx.New(&influx.Config{File: filename, Precision: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := record(t)
+	for i := 0; i < 2; i++ {
+		if err := exporter.ExportMetrics(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := wantLines + wantLines; string(got) != want {
+		t.Errorf("got file\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, config := range []*influx.Config{
+		{},
+		{URL: "http://localhost:8086/api/v2/write", File: "metrics.lp"},
+		{URL: "http://localhost:8086/api/v2/write", Precision: time.Minute},
+	} {
+		if _, err := influx.New(config); err == nil {
+			t.Errorf("New(%+v) succeeded", config)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jaeger sends spans to a local jaeger agent, using the thrift compact
+// protocol over UDP.
+//
+// Importing the package registers a "jaeger" exporter whose options are the
+// address of the agent.
+package jaeger
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultAddress is the address the jaeger agent listens on for the compact
+// protocol.
+const DefaultAddress = "localhost:6831"
+
+// DefaultMaxPacketSize is the largest packet the jaeger agent accepts by
+// default.
+const DefaultMaxPacketSize = 65000
+
+type Config struct {
+	// Address is the UDP address of the agent.
+	Address string
+	// Service is the name of the process, it defaults to the name of the
+	// binary.
+	Service string
+	// Tags are attached to the process, they default to the host name and
+	// process id.
+	Tags []label.Label
+	// MaxPacketSize bounds the size of each packet sent to the agent, spans
+	// are split across as many packets as needed.
+	MaxPacketSize int
+}
+
+func init() {
+	export.Register("jaeger", func(address string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := Connect(&Config{Address: address})
+		if err != nil {
+			return nil, nil, err
+		}
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, export.ShutdownAll(batcher, exporter), nil
+	})
+}
+
+// Process tags added when none are configured.
+var (
+	hostName   = keys.NewString("hostname", "")
+	processPID = keys.NewInt64("pid", "")
+)
+
+// Exporter is an export.BatchExporter that sends spans to the agent.
+// Metrics are ignored.
+type Exporter struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	max     int
+	process []byte
+	seq     int32
+	// overhead is the size of a packet holding no spans.
+	overhead int
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// Connect returns an Exporter that sends to the configured agent.
+func Connect(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Address == "" {
+		resolved.Address = DefaultAddress
+	}
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	if resolved.Tags == nil {
+		host, _ := os.Hostname()
+		resolved.Tags = []label.Label{hostName.Of(host), processPID.Of(int64(os.Getpid()))}
+	}
+	if resolved.MaxPacketSize <= 0 {
+		resolved.MaxPacketSize = DefaultMaxPacketSize
+	}
+	conn, err := net.Dial("udp", resolved.Address)
+	if err != nil {
+		return nil, fmt.Errorf("jaeger exporter: %v", err)
+	}
+	process := &encoder{}
+	process.structBody(func(e *encoder) {
+		e.stringField(1, resolved.Service)
+		e.tagsField(2, convertLabels(nil, resolved.Tags))
+	})
+	exporter := &Exporter{conn: conn, max: resolved.MaxPacketSize, process: process.buf}
+	// Allow for the sequence number and span count growing.
+	exporter.overhead = len(exporter.packet(0, nil)) + 8
+	return exporter, nil
+}
+
+// ExportSpans sends the spans to the agent, in as few packets as possible.
+// A span that does not fit in a packet on its own is dropped, and the error
+// returned once the remaining spans have been sent.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	overhead := e.overhead
+	var firstErr error
+	var batch [][]byte
+	size := overhead
+	for _, s := range spans {
+		encoded := encodeSpan(s)
+		if overhead+len(encoded) > e.max {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("jaeger exporter: span %q is too large for a packet", s.Name)
+			}
+			continue
+		}
+		if size+len(encoded) > e.max {
+			if err := e.send(ctx, batch); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			batch, size = nil, overhead
+		}
+		batch = append(batch, encoded)
+		size += len(encoded)
+	}
+	if len(batch) > 0 {
+		if err := e.send(ctx, batch); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ExportMetrics does nothing, as jaeger only accepts spans.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+// Shutdown closes the connection to the agent.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.conn.Close()
+}
+
+func (e *Exporter) send(ctx context.Context, spans [][]byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		e.conn.SetWriteDeadline(deadline)
+	} else {
+		e.conn.SetWriteDeadline(time.Time{})
+	}
+	e.seq++
+	if _, err := e.conn.Write(e.packet(e.seq, spans)); err != nil {
+		return fmt.Errorf("jaeger exporter: %v", err)
+	}
+	return nil
+}
+
+// packet encodes a oneway emitBatch call holding the encoded spans.
+func (e *Exporter) packet(seq int32, spans [][]byte) []byte {
+	enc := &encoder{}
+	enc.buf = append(enc.buf, 0x82, 0x81) // compact protocol version 1, oneway
+	enc.varint(uint64(uint32(seq)))
+	enc.binary("emitBatch")
+	enc.structBody(func(enc *encoder) {
+		enc.structField(1, func(enc *encoder) {
+			enc.fieldHeader(1, typeStruct)
+			enc.buf = append(enc.buf, e.process...)
+			enc.fieldHeader(2, typeList)
+			enc.listHeader(len(spans), typeStruct)
+			for _, s := range spans {
+				enc.buf = append(enc.buf, s...)
+			}
+		})
+	})
+	return enc.buf
+}
+
+// encodeSpan returns the encoding of the span as a struct list element.
+func encodeSpan(span *export.Span) []byte {
+	start, end := span.Start().At(), span.Finish().At()
+	tags := convertLabels(nil, span.Labels())
+	for i := 1; span.Start().Valid(i); i++ {
+		tags = convertLabels(tags, []label.Label{span.Start().Label(i)})
+	}
+	var logs [][]tag
+	var logTimes []time.Time
+	failed := false
+	for _, ev := range span.Events() {
+		if !event.IsLog(ev) {
+			continue
+		}
+		fields := []tag{{key: "event", kind: tagString, str: keys.Msg.From(ev.Label(0))}}
+		index := 1
+		if event.IsError(ev) {
+			failed = true
+			if err := keys.Err.From(ev.Label(1)); err != nil {
+				fields = append(fields, tag{key: "error", kind: tagString, str: err.Error()})
+			}
+			index = 2
+		}
+		for ; ev.Valid(index); index++ {
+			fields = convertLabels(fields, []label.Label{ev.Label(index)})
+		}
+		logs = append(logs, fields)
+		logTimes = append(logTimes, ev.At())
+	}
+	if failed {
+		tags = append(tags, tag{key: "error", kind: tagBool, b: true})
+	}
+
+	enc := &encoder{}
+	enc.structBody(func(e *encoder) {
+		trace := span.ID.TraceID
+		e.i64Field(1, int64(binary.BigEndian.Uint64(trace[8:])))
+		e.i64Field(2, int64(binary.BigEndian.Uint64(trace[:8])))
+		e.i64Field(3, int64(binary.BigEndian.Uint64(span.ID.SpanID[:])))
+		e.i64Field(4, int64(binary.BigEndian.Uint64(span.ParentID[:])))
+		e.stringField(5, span.Name)
+		e.i32Field(7, 1) // sampled
+		e.i64Field(8, start.UnixNano()/1000)
+		if !end.IsZero() {
+			e.i64Field(9, int64(end.Sub(start)/time.Microsecond))
+		}
+		e.tagsField(10, tags)
+		if len(logs) > 0 {
+			e.fieldHeader(11, typeList)
+			e.listHeader(len(logs), typeStruct)
+			for i := range logs {
+				e.structBody(func(e *encoder) {
+					e.i64Field(1, logTimes[i].UnixNano()/1000)
+					e.fieldHeader(2, typeList)
+					e.listHeader(len(logs[i]), typeStruct)
+					for j := range logs[i] {
+						e.structBody(logs[i][j].encode)
+					}
+				})
+			}
+		}
+	})
+	return enc.buf
+}
+
+// convertLabels appends the valid labels to tags.
+func convertLabels(tags []tag, labels []label.Label) []tag {
+	for _, l := range labels {
+		if !l.Valid() {
+			continue
+		}
+		t := tag{key: l.Key().Name()}
+		switch v := export.LabelValue(l).(type) {
+		case int64:
+			t.kind, t.long = tagLong, v
+		case uint64:
+			t.kind, t.long = tagLong, int64(v)
+		case float64:
+			t.kind, t.num = tagDouble, v
+		case bool:
+			t.kind, t.b = tagBool, v
+		case string:
+			t.kind, t.str = tagString, v
+		}
+		tags = append(tags, t)
+	}
+	return tags
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jaeger_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/jaeger"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// finished collects the spans handed to it.
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func makeSpans(names ...string) []*export.Span {
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	defer event.SetExporter(nil)
+	for _, name := range names {
+		ctx, done := event.Start(context.Background(), name)
+		event.Log(ctx, "working")
+		done()
+	}
+	return f.spans
+}
+
+func agent(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen for UDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn net.PacketConn, count int) [][]byte {
+	var packets [][]byte
+	buf := make([]byte, 65536)
+	for i := 0; i < count; i++ {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("reading packet %d: %v", i, err)
+		}
+		packets = append(packets, append([]byte(nil), buf[:n]...))
+	}
+	return packets
+}
+
+func TestExportSpans(t *testing.T) {
+	conn := agent(t)
+	exporter, err := jaeger.Connect(&jaeger.Config{
+		Address: conn.LocalAddr().String(),
+		Service: "jaeger-tests",
+		Tags:    []label.Label{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	if err := exporter.ExportSpans(context.Background(), makeSpans("first", "second")); err != nil {
+		t.Fatal(err)
+	}
+	packet := receive(t, conn, 1)[0]
+	if !bytes.HasPrefix(packet, []byte("\x82\x81\x01\x09emitBatch")) {
+		t.Errorf("packet does not start with an emitBatch call: % x", packet[:12])
+	}
+	for _, want := range []string{"jaeger-tests", "first", "second", "working"} {
+		if !strings.Contains(string(packet), want) {
+			t.Errorf("packet does not contain %q", want)
+		}
+	}
+}
+
+func TestMaxPacketSize(t *testing.T) {
+	conn := agent(t)
+	spans := makeSpans("first", "second", strings.Repeat("x", 500))
+	exporter, err := jaeger.Connect(&jaeger.Config{
+		Address:       conn.LocalAddr().String(),
+		Service:       "jaeger-tests",
+		Tags:          []label.Label{},
+		MaxPacketSize: 150,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	if err := exporter.ExportSpans(context.Background(), spans); err == nil {
+		t.Error("oversized span was not reported")
+	}
+	packets := receive(t, conn, 2)
+	for i, want := range []string{"first", "second"} {
+		if !strings.Contains(string(packets[i]), want) {
+			t.Errorf("packet %d does not contain %q", i, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jaeger
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// This file implements the subset of the thrift compact protocol needed to
+// encode the emitBatch call of the jaeger agent service, as described in
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+// and https://github.com/jaegertracing/jaeger-idl/blob/main/thrift/jaeger.thrift.
+
+// Compact protocol type identifiers.
+const (
+	typeBoolTrue  = 1
+	typeBoolFalse = 2
+	typeI32       = 5
+	typeI64       = 6
+	typeDouble    = 7
+	typeBinary    = 8
+	typeList      = 9
+	typeStruct    = 12
+)
+
+// Jaeger tag value types.
+const (
+	tagString = 0
+	tagDouble = 1
+	tagBool   = 2
+	tagLong   = 3
+)
+
+// tag is a jaeger key value pair, exactly one of the values is used as
+// selected by kind.
+type tag struct {
+	key  string
+	kind int32
+	str  string
+	num  float64
+	b    bool
+	long int64
+}
+
+// encoder appends the compact encoding of a value to buf.
+// It tracks the last field written to the struct being encoded, so that
+// field headers can be delta encoded.
+type encoder struct {
+	buf       []byte
+	lastField int16
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) zigzag(v int64) {
+	e.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (e *encoder) fieldHeader(id int16, typ byte) {
+	if delta := id - e.lastField; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.zigzag(int64(id))
+	}
+	e.lastField = id
+}
+
+func (e *encoder) binary(s string) {
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) stringField(id int16, s string) {
+	e.fieldHeader(id, typeBinary)
+	e.binary(s)
+}
+
+func (e *encoder) i32Field(id int16, v int32) {
+	e.fieldHeader(id, typeI32)
+	e.zigzag(int64(v))
+}
+
+func (e *encoder) i64Field(id int16, v int64) {
+	e.fieldHeader(id, typeI64)
+	e.zigzag(v)
+}
+
+func (e *encoder) doubleField(id int16, v float64) {
+	e.fieldHeader(id, typeDouble)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) boolField(id int16, v bool) {
+	if v {
+		e.fieldHeader(id, typeBoolTrue)
+	} else {
+		e.fieldHeader(id, typeBoolFalse)
+	}
+}
+
+// structField writes a nested struct whose fields are written by f.
+func (e *encoder) structField(id int16, f func(*encoder)) {
+	e.fieldHeader(id, typeStruct)
+	e.structBody(f)
+}
+
+// structBody writes the fields of a struct, followed by the stop byte.
+func (e *encoder) structBody(f func(*encoder)) {
+	saved := e.lastField
+	e.lastField = 0
+	f(e)
+	e.buf = append(e.buf, 0)
+	e.lastField = saved
+}
+
+func (e *encoder) listHeader(size int, elem byte) {
+	if size < 15 {
+		e.buf = append(e.buf, byte(size)<<4|elem)
+		return
+	}
+	e.buf = append(e.buf, 0xf0|elem)
+	e.varint(uint64(size))
+}
+
+func (e *encoder) tagsField(id int16, tags []tag) {
+	if len(tags) == 0 {
+		return
+	}
+	e.fieldHeader(id, typeList)
+	e.listHeader(len(tags), typeStruct)
+	for i := range tags {
+		e.structBody(tags[i].encode)
+	}
+}
+
+func (t *tag) encode(e *encoder) {
+	e.stringField(1, t.key)
+	e.i32Field(2, t.kind)
+	switch t.kind {
+	case tagString:
+		e.stringField(3, t.str)
+	case tagDouble:
+		e.doubleField(4, t.num)
+	case tagBool:
+		e.boolField(5, t.b)
+	case tagLong:
+		e.i64Field(6, t.long)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jaeger
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompactEncoding(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		encode func(e *encoder)
+		want   []byte
+	}{{
+		name: "tag",
+		encode: func(e *encoder) {
+			e.structBody((&tag{key: "k", kind: tagLong, long: -1}).encode)
+		},
+		want: []byte{0x18, 0x01, 'k', 0x15, 0x06, 0x46, 0x01, 0x00},
+	}, {
+		name: "long field delta",
+		encode: func(e *encoder) {
+			e.i32Field(20, 1)
+		},
+		want: []byte{0x05, 0x28, 0x02},
+	}, {
+		name: "long list",
+		encode: func(e *encoder) {
+			e.listHeader(20, typeStruct)
+		},
+		want: []byte{0xfc, 0x14},
+	}, {
+		name: "nested struct",
+		encode: func(e *encoder) {
+			e.structBody(func(e *encoder) {
+				e.structField(3, func(e *encoder) { e.boolField(1, true) })
+				e.boolField(4, false)
+			})
+		},
+		want: []byte{0x3c, 0x11, 0x00, 0x12, 0x00},
+	}} {
+		e := &encoder{}
+		test.encode(e)
+		if !bytes.Equal(e.buf, test.want) {
+			t.Errorf("%s: got % x, want % x", test.name, e.buf, test.want)
+		}
+	}
+}
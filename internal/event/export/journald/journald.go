@@ -0,0 +1,200 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package journald records log events in the systemd journal, using the
+// native protocol of its socket.
+//
+// Each event becomes a journal entry with the MESSAGE, PRIORITY and
+// SYSLOG_IDENTIFIER fields, the TRACE_ID, SPAN_ID and SPAN fields when it
+// happened within a span, and a field for each of its labels, whose name is
+// the upper cased label name. The entries can be queried with journalctl,
+// for example "journalctl SYSLOG_IDENTIFIER=gopls TRACE_ID=...".
+// The journal is only available on Linux, on other systems Dial fails.
+//
+// Importing the package registers a "journald" exporter whose options are
+// the path of the journal socket, which defaults to DefaultSocket.
+package journald
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultSocket is where journald listens for native protocol entries.
+const DefaultSocket = "/run/systemd/journal/socket"
+
+// Config configures an Exporter.
+type Config struct {
+	// Socket is the path of the journal socket.
+	Socket string
+	// Identifier is the SYSLOG_IDENTIFIER of every entry, it defaults to
+	// the name of the binary.
+	Identifier string
+	// FieldPrefix is prepended to the field names made from labels, to keep
+	// them apart from the fields of other programs.
+	FieldPrefix string
+}
+
+func init() {
+	export.Register("journald", func(socket string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := Dial(&Config{Socket: socket})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter writes log events to the journal.
+// It should be wrapped by export.Spans, so that entries can name the span
+// they happened in.
+type Exporter struct {
+	config Config
+	conn   *net.UnixConn
+	mu     sync.Mutex
+}
+
+// Dial returns an Exporter connected to the journal socket.
+func Dial(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Socket == "" {
+		resolved.Socket = DefaultSocket
+	}
+	if resolved.Identifier == "" {
+		resolved.Identifier = filepath.Base(os.Args[0])
+	}
+	if !supported {
+		return nil, fmt.Errorf("journald exporter is only available on Linux")
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: resolved.Socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("journald exporter: %v", err)
+	}
+	return &Exporter{config: resolved, conn: conn}, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if !event.IsLog(ev) {
+		return ctx
+	}
+	entry := e.entry(ctx, ev, lm)
+	e.mu.Lock()
+	err := e.send(entry)
+	e.mu.Unlock()
+	export.ReportError(err)
+	return ctx
+}
+
+// Shutdown closes the connection to the journal.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.conn.Close()
+}
+
+// send writes an entry as a single datagram, or if it is too large for one
+// passes it in a sealed memory file instead.
+func (e *Exporter) send(entry []byte) error {
+	_, err := e.conn.Write(entry)
+	if err != nil && tooLarge(err) {
+		err = sendFile(e.conn, entry)
+	}
+	if err != nil {
+		return fmt.Errorf("journald failed to write entry: %v", err)
+	}
+	return nil
+}
+
+// priorities maps the export severities to syslog priorities.
+var priorities = map[export.Severity]string{
+	export.SeverityDebug:   "7",
+	export.SeverityInfo:    "6",
+	export.SeverityWarning: "4",
+	export.SeverityError:   "3",
+}
+
+// entry returns the native protocol encoding of the fields of an event.
+func (e *Exporter) entry(ctx context.Context, ev core.Event, lm label.Map) []byte {
+	var buf bytes.Buffer
+	msg := keys.Msg.From(ev.Label(0))
+	first := 1
+	if event.IsError(ev) {
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			field(&buf, "ERROR", err.Error())
+			msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		first = 2
+	}
+	field(&buf, "MESSAGE", msg)
+	priority, ok := priorities[export.SeverityOf(ev, lm)]
+	if !ok {
+		priority = "5"
+	}
+	field(&buf, "PRIORITY", priority)
+	field(&buf, "SYSLOG_IDENTIFIER", e.config.Identifier)
+	if span := export.GetSpan(ctx); span != nil {
+		field(&buf, "TRACE_ID", span.ID.TraceID.String())
+		field(&buf, "SPAN_ID", span.ID.SpanID.String())
+		field(&buf, "SPAN", span.Name)
+	}
+	for i := first; ev.Valid(i); i++ {
+		l := ev.Label(i)
+		if !l.Valid() || l.Key() == export.SeverityKey {
+			continue
+		}
+		field(&buf, fieldName(e.config.FieldPrefix+l.Key().Name()), fmt.Sprint(export.LabelValue(l)))
+	}
+	return buf.Bytes()
+}
+
+// field appends a field to an entry, using the binary form for values that
+// contain newlines.
+func field(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// fieldName returns a valid journal field name: upper case letters, digits
+// and underscores, not starting with a digit or an underscore, as those are
+// reserved for the fields added by journald.
+func fieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || name[0] == '_' || ('0' <= name[0] && name[0] <= '9') {
+		name = "X" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package journald
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const supported = true
+
+func tooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendFile passes the entry to journald as a sealed memfd, which is how the
+// journal accepts entries larger than a datagram.
+func sendFile(conn *net.UnixConn, entry []byte) error {
+	fd, err := unix.MemfdCreate("journald-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "journald-entry")
+	defer f.Close()
+	if _, err := f.Write(entry); err != nil {
+		return err
+	}
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		return err
+	}
+	// WriteMsgUnix refuses connected datagram sockets, so the message is sent
+	// directly.
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := unix.UnixRights(int(f.Fd()))
+	if werr := raw.Write(func(fd uintptr) bool {
+		err = unix.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != unix.EAGAIN
+	}); werr != nil {
+		return werr
+	}
+	return err
+}
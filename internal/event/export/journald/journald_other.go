@@ -0,0 +1,21 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package journald
+
+import (
+	"errors"
+	"net"
+)
+
+const supported = false
+
+func tooLarge(err error) bool { return false }
+
+func sendFile(conn *net.UnixConn, entry []byte) error {
+	return errors.New("the journal is not available")
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package journald_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/journald"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// listen returns a fake journal socket and an exporter connected to it.
+func listen(t *testing.T) (*net.UnixConn, *journald.Exporter) {
+	socket := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	exporter, err := journald.Dial(&journald.Config{Socket: socket, Identifier: "gopls", FieldPrefix: "GOPLS_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { exporter.Shutdown(context.Background()) })
+	return conn, exporter
+}
+
+// receive returns the next entry, reading it from the passed file if there
+// is one.
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf, oob := make([]byte, 1<<16), make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oobn == 0 {
+		return string(buf[:n])
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("bad control message: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("bad unix rights: %v", err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "entry")
+	defer f.Close()
+	f.Seek(0, 0)
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEntry(t *testing.T) {
+	conn, exporter := listen(t)
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+	ctx, done := event.Start(context.Background(), "hover")
+	event.Log(ctx, "slow", export.SeverityKey.Of(int(export.SeverityWarning)), keys.NewString("file.name", "").Of("main.go"))
+	event.Error(ctx, "failed", errors.New("line one\nline two"))
+	done()
+	span := export.GetSpan(ctx)
+	ids := "TRACE_ID=" + span.ID.TraceID.String() + "\nSPAN_ID=" + span.ID.SpanID.String() + "\nSPAN=hover\n"
+
+	want := "MESSAGE=slow\nPRIORITY=4\nSYSLOG_IDENTIFIER=gopls\n" + ids + "GOPLS_FILE_NAME=main.go\n"
+	if got := receive(t, conn); got != want {
+		t.Errorf("got entry\n%q\nwant\n%q", got, want)
+	}
+	want = "ERROR\n\x11\x00\x00\x00\x00\x00\x00\x00line one\nline two\n" +
+		"MESSAGE\n\x19\x00\x00\x00\x00\x00\x00\x00failed: line one\nline two\n" +
+		"PRIORITY=3\nSYSLOG_IDENTIFIER=gopls\n" + ids
+	if got := receive(t, conn); got != want {
+		t.Errorf("got entry\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestLargeEntry(t *testing.T) {
+	conn, exporter := listen(t)
+	event.SetExporter(exporter.ProcessEvent)
+	defer event.SetExporter(nil)
+	huge := strings.Repeat("x", 1<<20)
+	event.Log(context.Background(), huge)
+	want := "MESSAGE=" + huge + "\nPRIORITY=6\nSYSLOG_IDENTIFIER=gopls\n"
+	if got := receive(t, conn); got != want {
+		t.Errorf("got entry of %d bytes, want %d", len(got), len(want))
+	}
+}
@@ -0,0 +1,535 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jsonl records telemetry in a local file, as one JSON object per
+// line, so that a session can be attached to a bug report or analyzed
+// offline.
+//
+// Every object has a time and a kind of "log", "error", "span" or "metric".
+// Log objects hold the message, severity, and the trace and span they
+// happened in; span objects are written when the span finishes, and hold the
+// name, the parent, the start and the duration in milliseconds; a metric
+// object is written for each row of a metric when it changes. The labels of
+// each are in the labels object.
+//
+// The file can be rotated once it reaches a size or age, the rotated files
+// are renamed with the time of the rotation and optionally compressed with
+// gzip.
+//
+// Importing the package registers a "jsonl" exporter whose options are the
+// name of the file to write, it rotates the file at DefaultMaxSize and keeps
+// DefaultMaxBackups compressed files.
+package jsonl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// The rotation used by the registered exporter.
+const (
+	DefaultMaxSize    = 64 << 20
+	DefaultMaxBackups = 5
+)
+
+// rotatedLayout is the time layout inserted into the names of rotated
+// files, it sorts in time order.
+const rotatedLayout = "2006-01-02T15-04-05.000"
+
+// Config configures an Exporter.
+type Config struct {
+	// Filename is the file the objects are appended to.
+	// A rotated file is renamed with the time of the rotation inserted
+	// before the extension, so gopls.jsonl becomes
+	// gopls-2006-01-02T15-04-05.000.jsonl.
+	Filename string
+	// MaxSize is the size in bytes at which the file is rotated, zero means
+	// no limit.
+	MaxSize int64
+	// MaxAge is how long a file is written to before it is rotated, zero
+	// means no limit.
+	MaxAge time.Duration
+	// Compress gzips rotated files, adding a .gz extension.
+	Compress bool
+	// MaxBackups is the number of rotated files kept, the oldest ones are
+	// deleted; zero keeps them all.
+	MaxBackups int
+}
+
+func init() {
+	export.Register("jsonl", func(filename string) (event.Exporter, export.Shutdowner, error) {
+		if filename == "" {
+			return nil, nil, fmt.Errorf("jsonl exporter needs the name of a file")
+		}
+		exporter, err := New(&Config{
+			Filename:   filename,
+			MaxSize:    DefaultMaxSize,
+			Compress:   true,
+			MaxBackups: DefaultMaxBackups,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter writes telemetry to a file.
+// It must be wrapped by export.Spans for span objects to be written.
+type Exporter struct {
+	config Config
+
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	size   int64     // the bytes written to file, including those buffered
+	opened time.Time // the time of the first object written to file
+	closed bool
+
+	// background tracks the compression and pruning of rotated files, which
+	// is serialized by backgroundMu.
+	background   sync.WaitGroup
+	backgroundMu sync.Mutex
+}
+
+// record is a single line of the file.
+type record struct {
+	at time.Time // the time of the telemetry, used for rotation
+
+	Time       string                 `json:"time"`
+	Kind       string                 `json:"kind"`
+	Name       string                 `json:"name,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Severity   string                 `json:"severity,omitempty"`
+	TraceID    string                 `json:"trace_id,omitempty"`
+	SpanID     string                 `json:"span_id,omitempty"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Start      string                 `json:"start,omitempty"`
+	DurationMS *float64               `json:"duration_ms,omitempty"`
+	Type       string                 `json:"type,omitempty"`
+	Value      interface{}            `json:"value,omitempty"`
+	Count      *int64                 `json:"count,omitempty"`
+	Sum        interface{}            `json:"sum,omitempty"`
+	Min        interface{}            `json:"min,omitempty"`
+	Max        interface{}            `json:"max,omitempty"`
+	Buckets    []bucket               `json:"buckets,omitempty"`
+	Labels     map[string]interface{} `json:"labels,omitempty"`
+}
+
+// line is an encoded record.
+type line struct {
+	at   time.Time
+	data []byte
+}
+
+// bucket is a single histogram bucket, holding the number of values that
+// were no more than its bound.
+type bucket struct {
+	LE    interface{} `json:"le"`
+	Count int64       `json:"count"`
+}
+
+// New opens the file and returns an Exporter that appends to it.
+// The exporter is managed, so the package level export.Flush and
+// export.Shutdown functions act on it.
+func New(config *Config) (*Exporter, error) {
+	if config.Filename == "" {
+		return nil, fmt.Errorf("jsonl exporter needs the name of a file")
+	}
+	e := &Exporter{config: *config}
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	export.Manage(e)
+	return e, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	switch {
+	case event.IsLog(ev):
+		e.write(logRecord(ctx, ev, lm))
+	case event.IsEnd(ev):
+		if span := export.GetSpan(ctx); span != nil {
+			e.write(spanRecord(span))
+		}
+	case event.IsMetric(ev):
+		e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	}
+	return ctx
+}
+
+// ProcessMetrics writes an object for each row of the metrics.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	var records []*record
+	for _, data := range metrics {
+		records = append(records, metricRecords(data)...)
+	}
+	e.write(records...)
+}
+
+// Flush writes any buffered objects to the file.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("jsonl failed to write %s: %v", e.config.Filename, err)
+	}
+	return nil
+}
+
+// Shutdown flushes and closes the file, and waits for the rotated files to
+// be compressed.
+// Events that arrive after it are dropped.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	var err error
+	if !e.closed {
+		e.closed = true
+		err = e.closeLocked()
+	}
+	e.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		e.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+func (e *Exporter) write(records ...*record) {
+	if len(records) == 0 {
+		return
+	}
+	lines := make([]line, 0, len(records))
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			export.ReportError(fmt.Errorf("jsonl failed to marshal %s: %v", r.Kind, err))
+			continue
+		}
+		lines = append(lines, line{at: r.at, data: append(data, '\n')})
+	}
+	e.mu.Lock()
+	err := e.writeLocked(lines)
+	e.mu.Unlock()
+	export.ReportError(err)
+}
+
+func (e *Exporter) writeLocked(lines []line) error {
+	if e.closed {
+		return nil
+	}
+	for _, l := range lines {
+		if e.shouldRotate(int64(len(l.data)), l.at) {
+			if err := e.rotateLocked(l.at); err != nil {
+				return err
+			}
+		}
+		if e.opened.IsZero() {
+			e.opened = l.at
+		}
+		n, err := e.w.Write(l.data)
+		e.size += int64(n)
+		if err != nil {
+			return fmt.Errorf("jsonl failed to write %s: %v", e.config.Filename, err)
+		}
+	}
+	return nil
+}
+
+// shouldRotate reports whether the file must be rotated before a line of n
+// bytes from time at is added to it. A file is never rotated while it is
+// empty, so a line larger than MaxSize is still written.
+// The age of the file is measured by the times of the telemetry in it.
+func (e *Exporter) shouldRotate(n int64, at time.Time) bool {
+	if e.size == 0 {
+		return false
+	}
+	if e.config.MaxSize > 0 && e.size+n > e.config.MaxSize {
+		return true
+	}
+	return e.config.MaxAge > 0 && !e.opened.IsZero() && at.Sub(e.opened) >= e.config.MaxAge
+}
+
+// open opens the file for appending, carrying on from its current size.
+func (e *Exporter) open() error {
+	f, err := os.OpenFile(e.config.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("jsonl exporter: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("jsonl exporter: %v", err)
+	}
+	e.file = f
+	e.w = bufio.NewWriter(f)
+	e.size = info.Size()
+	e.opened = time.Time{}
+	return nil
+}
+
+func (e *Exporter) closeLocked() error {
+	err := e.w.Flush()
+	if cerr := e.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("jsonl failed to close %s: %v", e.config.Filename, err)
+	}
+	return nil
+}
+
+// rotateLocked renames the current file out of the way and opens a new one,
+// leaving the rotated file to be compressed and pruned in the background.
+func (e *Exporter) rotateLocked(at time.Time) error {
+	if err := e.closeLocked(); err != nil {
+		return err
+	}
+	rotated := e.rotatedName(at)
+	renameErr := os.Rename(e.config.Filename, rotated)
+	// Carry on writing even if the rename failed, appending to the old file.
+	if err := e.open(); err != nil {
+		e.closed = true
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("jsonl failed to rotate %s: %v", e.config.Filename, renameErr)
+	}
+	e.background.Add(1)
+	go func() {
+		defer e.background.Done()
+		e.backgroundMu.Lock()
+		defer e.backgroundMu.Unlock()
+		if e.config.Compress {
+			export.ReportError(compress(rotated))
+		}
+		export.ReportError(e.prune())
+	}()
+	return nil
+}
+
+// rotatedName returns the name a file rotated at t is renamed to.
+func (e *Exporter) rotatedName(t time.Time) string {
+	ext := filepath.Ext(e.config.Filename)
+	base := strings.TrimSuffix(e.config.Filename, ext)
+	return base + "-" + t.UTC().Format(rotatedLayout) + ext
+}
+
+// compress replaces a file with a gzipped copy.
+func compress(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("jsonl failed to compress %s: %v", filename, err)
+	}
+	err = writeGzip(filename+".gz", in)
+	in.Close()
+	if err != nil {
+		os.Remove(filename + ".gz")
+		return fmt.Errorf("jsonl failed to compress %s: %v", filename, err)
+	}
+	return os.Remove(filename)
+}
+
+func writeGzip(filename string, r io.Reader) error {
+	out, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, r)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// prune deletes the oldest rotated files beyond MaxBackups.
+func (e *Exporter) prune() error {
+	if e.config.MaxBackups <= 0 {
+		return nil
+	}
+	ext := filepath.Ext(e.config.Filename)
+	base := strings.TrimSuffix(e.config.Filename, ext)
+	matches, err := filepath.Glob(base + "-*" + ext + "*")
+	if err != nil {
+		return fmt.Errorf("jsonl failed to list rotated files: %v", err)
+	}
+	var rotated []string
+	for _, m := range matches {
+		stamp := strings.TrimPrefix(m, base+"-")
+		stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".gz"), ext)
+		if _, err := time.Parse(rotatedLayout, stamp); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	if len(rotated) <= e.config.MaxBackups {
+		return nil
+	}
+	// The names sort by the time of the rotation.
+	sort.Strings(rotated)
+	for _, name := range rotated[:len(rotated)-e.config.MaxBackups] {
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("jsonl failed to delete %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func logRecord(ctx context.Context, ev core.Event, lm label.Map) *record {
+	r := &record{
+		at:       ev.At(),
+		Time:     formatTime(ev.At()),
+		Kind:     "log",
+		Message:  keys.Msg.From(ev.Label(0)),
+		Severity: export.SeverityOf(ev, lm).String(),
+	}
+	first := 1
+	if event.IsError(ev) {
+		r.Kind = "error"
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			r.Error = err.Error()
+		}
+		first = 2
+	}
+	if span := export.GetSpan(ctx); span != nil {
+		r.TraceID = span.ID.TraceID.String()
+		r.SpanID = span.ID.SpanID.String()
+	}
+	for i := first; ev.Valid(i); i++ {
+		if l := ev.Label(i); l.Key() != export.SeverityKey {
+			r.addLabel(l)
+		}
+	}
+	return r
+}
+
+func spanRecord(span *export.Span) *record {
+	start, end := span.Start().At(), span.Finish().At()
+	duration := float64(end.Sub(start)) / float64(time.Millisecond)
+	r := &record{
+		at:         end,
+		Time:       formatTime(end),
+		Kind:       "span",
+		Name:       span.Name,
+		TraceID:    span.ID.TraceID.String(),
+		SpanID:     span.ID.SpanID.String(),
+		Start:      formatTime(start),
+		DurationMS: &duration,
+	}
+	if span.ParentID.IsValid() {
+		r.ParentID = span.ParentID.String()
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		r.addLabel(span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		r.addLabel(l)
+	}
+	return r
+}
+
+func metricRecords(data metric.Data) []*record {
+	var records []*record
+	add := func(group []label.Label, at time.Time, kind string) *record {
+		r := &record{
+			at:   at,
+			Time: formatTime(at),
+			Kind: "metric",
+			Name: data.Handle(),
+			Type: kind,
+		}
+		for _, l := range group {
+			r.addLabel(l)
+		}
+		records = append(records, r)
+		return r
+	}
+	scalarType := func(isGauge, isUpDown bool) string {
+		switch {
+		case isGauge:
+			return "gauge"
+		case isUpDown:
+			return "updowncounter"
+		}
+		return "counter"
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			add(group, data.EndTime, scalarType(data.IsGauge, data.IsUpDown)).Value = data.Rows[i]
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			add(group, data.EndTime, scalarType(data.IsGauge, data.IsUpDown)).Value = data.Rows[i]
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			r := add(group, data.EndTime, "histogram")
+			count := row.Count
+			r.Count, r.Sum, r.Min, r.Max = &count, row.Sum, row.Min, row.Max
+			for j, b := range data.Info.Buckets {
+				r.Buckets = append(r.Buckets, bucket{LE: b, Count: row.Values[j]})
+			}
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			r := add(group, data.EndTime, "histogram")
+			count := row.Count
+			r.Count, r.Sum, r.Min, r.Max = &count, row.Sum, row.Min, row.Max
+			for j, b := range data.Info.Buckets {
+				r.Buckets = append(r.Buckets, bucket{LE: b, Count: row.Values[j]})
+			}
+		}
+	}
+	return records
+}
+
+func (r *record) addLabel(l label.Label) {
+	if !l.Valid() {
+		return
+	}
+	if r.Labels == nil {
+		r.Labels = make(map[string]interface{})
+	}
+	r.Labels[l.Key().Name()] = export.LabelValue(l)
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonl_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/jsonl"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// steppingClock moves forward by a millisecond every time it is read.
+type steppingClock struct {
+	now time.Time
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.now = c.now.Add(time.Millisecond)
+	return c.now
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRecords(t *testing.T) {
+	event.SetClock(&steppingClock{now: time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)})
+	defer event.SetClock(nil)
+	filename := filepath.Join(t.TempDir(), "gopls.jsonl")
+	exporter, err := jsonl.New(&jsonl.Config{Filename: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := keys.NewString("file", "")
+	latency := keys.NewInt64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "requests", Keys: []label.Key{file}}.Count(&m, latency)
+	metric.HistogramInt64{Name: "latency", Buckets: []int64{10, 100}}.Record(&m, latency)
+	event.SetExporter(export.Spans(m.Exporter(exporter.ProcessEvent)))
+	defer event.SetExporter(nil)
+
+	ctx, done := event.Start(context.Background(), "hover", file.Of("main.go"))
+	child, childDone := event.Start(ctx, "parse")
+	event.Error(child, "failed", errors.New("timeout"))
+	event.Log(child, "retrying", export.SeverityKey.Of(int(export.SeverityWarning)))
+	childDone()
+	done()
+	event.Metric(context.Background(), file.Of("main.go"), latency.Of(42))
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	span := export.GetSpan(ctx)
+	trace := span.ID.TraceID.String()
+	hover := span.ID.SpanID.String()
+	parse := export.GetSpan(child).ID.SpanID.String()
+	want := strings.Join([]string{
+		`{"time":"2020-03-05T14:27:48.003Z","kind":"error","message":"failed","error":"timeout","severity":"error","trace_id":"` + trace + `","span_id":"` + parse + `"}`,
+		`{"time":"2020-03-05T14:27:48.004Z","kind":"log","message":"retrying","severity":"warning","trace_id":"` + trace + `","span_id":"` + parse + `"}`,
+		`{"time":"2020-03-05T14:27:48.005Z","kind":"span","name":"parse","trace_id":"` + trace + `","span_id":"` + parse + `","parent_id":"` + hover + `","start":"2020-03-05T14:27:48.002Z","duration_ms":3}`,
+		`{"time":"2020-03-05T14:27:48.006Z","kind":"span","name":"hover","trace_id":"` + trace + `","span_id":"` + hover + `","start":"2020-03-05T14:27:48.001Z","duration_ms":5,"labels":{"file":"main.go"}}`,
+		`{"time":"2020-03-05T14:27:48.007Z","kind":"metric","name":"requests","type":"counter","value":1,"labels":{"file":"main.go"}}`,
+		`{"time":"2020-03-05T14:27:48.007Z","kind":"metric","name":"latency","type":"histogram","count":1,"sum":42,"min":42,"max":42,"buckets":[{"le":10,"count":0},{"le":100,"count":1}]}`,
+		``,
+	}, "\n")
+	if got := readFile(t, filename); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// rotated returns the names of the rotated files in dir, in order.
+func rotated(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "gopls-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func TestRotateSize(t *testing.T) {
+	event.SetClock(&steppingClock{now: time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)})
+	defer event.SetClock(nil)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "gopls.jsonl")
+	exporter, err := jsonl.New(&jsonl.Config{
+		Filename:   filename,
+		MaxSize:    120,
+		Compress:   true,
+		MaxBackups: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := event.WithExporter(context.Background(), exporter.ProcessEvent)
+	// Each of these lines is 85 bytes, so every one is written to a file of
+	// its own.
+	for _, msg := range []string{"first", "secnd", "third", "forth"} {
+		event.Log(ctx, msg)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filename); !strings.Contains(got, `"forth"`) || strings.Count(got, "\n") != 1 {
+		t.Errorf("current file holds\n%s", got)
+	}
+	files := rotated(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("rotated files are %v, want the 2 newest", files)
+	}
+	for i, want := range []string{`"secnd"`, `"third"`} {
+		if !strings.HasSuffix(files[i], ".jsonl.gz") {
+			t.Errorf("rotated file %s is not compressed", files[i])
+			continue
+		}
+		f, err := os.Open(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("rotated file %s holds %s, want %s", files[i], data, want)
+		}
+	}
+}
+
+func TestRotateAge(t *testing.T) {
+	event.SetClock(&steppingClock{now: time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)})
+	defer event.SetClock(nil)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "gopls.jsonl")
+	// The clock steps a millisecond for each event, so the file is rotated
+	// before the third one.
+	exporter, err := jsonl.New(&jsonl.Config{Filename: filename, MaxAge: 2 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := event.WithExporter(context.Background(), exporter.ProcessEvent)
+	for _, msg := range []string{"first", "second", "third", "fourth"} {
+		event.Log(ctx, msg)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	files := rotated(t, dir)
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".jsonl") {
+		t.Fatalf("rotated files are %v, want one uncompressed file", files)
+	}
+	old, current := readFile(t, files[0]), readFile(t, filename)
+	if !strings.Contains(old, `"second"`) || strings.Contains(old, `"third"`) {
+		t.Errorf("rotated file holds\n%s", old)
+	}
+	if !strings.Contains(current, `"third"`) || strings.Contains(current, `"second"`) {
+		t.Errorf("current file holds\n%s", current)
+	}
+}
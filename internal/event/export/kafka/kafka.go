@@ -0,0 +1,344 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package kafka publishes telemetry to a Kafka topic.
+//
+// Each record holds an OTLP request, encoded as protocol buffers or JSON.
+// The spans of each trace are published as a record of their own, keyed by
+// the trace ID, so that consumers of a partition see whole traces; the
+// metrics of each batch are published as a single record without a key.
+// Only the parts of the Kafka protocol needed to produce uncompressed record
+// batches are implemented, there is no support for SASL or TLS.
+//
+// Importing the package registers a "kafka" exporter whose options are a
+// comma separated list of brokers, a slash, and the topic, as in
+// "localhost:9092/telemetry".
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/otlp"
+)
+
+// Partitioning decides which partition a record is published to.
+type Partitioning int
+
+const (
+	// ByTraceID publishes all the spans of a trace to the same partition, using
+	// the same hash of the key as the Java client.
+	ByTraceID Partitioning = iota
+	// RoundRobin spreads the records evenly over the partitions.
+	RoundRobin
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Brokers are the addresses used to discover the cluster.
+	Brokers []string
+	// Topic is the topic the records are published to.
+	Topic string
+	// JSON selects the JSON encoding of the OTLP requests instead of
+	// protocol buffers.
+	JSON bool
+	// Partitioning decides which partition each trace is published to.
+	// Records without a trace are always spread over the partitions.
+	Partitioning Partitioning
+	// ClientID identifies the producer to the brokers, it defaults to the
+	// name of the binary.
+	ClientID string
+	// Acks is the number of acknowledgements the leader must have before it
+	// responds, 1 means only the leader and -1 all the in sync replicas.
+	// It defaults to 1.
+	Acks int16
+	// Timeout is how long the brokers may wait for the acknowledgements, it
+	// defaults to 10 seconds.
+	Timeout time.Duration
+	// Service is the service.name resource attribute of the requests.
+	Service string
+}
+
+func init() {
+	export.Register("kafka", func(options string) (event.Exporter, export.Shutdowner, error) {
+		slash := strings.LastIndexByte(options, '/')
+		if slash < 0 || slash == len(options)-1 {
+			return nil, nil, fmt.Errorf("kafka exporter needs options of the form broker[,broker]/topic")
+		}
+		exporter, err := New(&Config{
+			Brokers: strings.Split(options[:slash], ","),
+			Topic:   options[slash+1:],
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		// Managed after the batcher, so the connections are not closed until
+		// the last batch has been published.
+		export.Manage(exporter)
+		return batcher.ProcessEvent, export.ShutdownAll(batcher, exporter), nil
+	})
+}
+
+// Exporter is an export.BatchExporter that publishes to a Kafka topic.
+type Exporter struct {
+	config Config
+	otlp   *otlp.Exporter
+
+	// mu is held while publishing, it guards the fields below.
+	mu       sync.Mutex
+	meta     *metadata
+	conns    map[int32]*conn
+	next     int // the next partition for round robin publishing
+	sequence int32
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that publishes to the configured topic.
+// It does not connect to the brokers until the first records are published.
+func New(config *Config) (*Exporter, error) {
+	resolved := *config
+	if len(resolved.Brokers) == 0 || resolved.Topic == "" {
+		return nil, fmt.Errorf("kafka exporter needs brokers and a topic")
+	}
+	if resolved.ClientID == "" {
+		resolved.ClientID = filepath.Base(os.Args[0])
+	}
+	if resolved.Acks == 0 {
+		resolved.Acks = 1
+	}
+	if resolved.Timeout <= 0 {
+		resolved.Timeout = 10 * time.Second
+	}
+	return &Exporter{
+		config: resolved,
+		otlp:   otlp.New(&otlp.Config{Service: resolved.Service}),
+		conns:  make(map[int32]*conn),
+	}, nil
+}
+
+// ExportSpans publishes a record for each trace the spans belong to.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	var order []export.TraceID
+	traces := make(map[export.TraceID][]*export.Span)
+	for _, s := range spans {
+		if _, seen := traces[s.ID.TraceID]; !seen {
+			order = append(order, s.ID.TraceID)
+		}
+		traces[s.ID.TraceID] = append(traces[s.ID.TraceID], s)
+	}
+	messages := make([]message, 0, len(order))
+	for _, id := range order {
+		request := e.otlp.TracesRequest(traces[id])
+		value, err := e.encode(request, request.MarshalProto)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message{key: []byte(id.String()), value: value})
+	}
+	return e.publish(ctx, messages)
+}
+
+// ExportMetrics publishes the metrics as a single record.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	request := e.otlp.MetricsRequest(metrics)
+	value, err := e.encode(request, request.MarshalProto)
+	if err != nil {
+		return err
+	}
+	return e.publish(ctx, []message{{value: value}})
+}
+
+// Shutdown closes the connections to the brokers.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reset()
+	return nil
+}
+
+func (e *Exporter) encode(message interface{}, marshalProto func() []byte) ([]byte, error) {
+	if !e.config.JSON {
+		return marshalProto(), nil
+	}
+	blob, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("kafka failed to marshal record: %v", err)
+	}
+	return blob, nil
+}
+
+// publish sends the messages to the leaders of their partitions.
+// On failure the cluster metadata is forgotten, so that it is fetched again
+// on the next attempt in case the leadership has moved.
+func (e *Exporter) publish(ctx context.Context, messages []message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.publishLocked(ctx, messages); err != nil {
+		e.reset()
+		return err
+	}
+	return nil
+}
+
+func (e *Exporter) publishLocked(ctx context.Context, messages []message) error {
+	if e.meta == nil {
+		meta, err := e.fetchMetadata(ctx)
+		if err != nil {
+			return err
+		}
+		e.meta = meta
+	}
+	// Group the messages by leader and then partition.
+	leaders := make(map[int32]map[int32][]message)
+	for _, m := range messages {
+		p := e.partition(m.key)
+		if leaders[p.leader] == nil {
+			leaders[p.leader] = make(map[int32][]message)
+		}
+		leaders[p.leader][p.id] = append(leaders[p.leader][p.id], m)
+	}
+	now := core.Now().UnixNano() / int64(time.Millisecond)
+	for leader, partitions := range leaders {
+		c, err := e.connect(ctx, leader)
+		if err != nil {
+			return err
+		}
+		batches := make(map[int32][]byte, len(partitions))
+		for id, messages := range partitions {
+			batches[id] = recordBatch(messages, now)
+		}
+		body := produceRequest(e.config.Topic, e.config.Acks, int32(e.config.Timeout/time.Millisecond), batches)
+		response, err := e.roundTrip(ctx, c, apiProduce, apiProduceVersion, body)
+		if err != nil {
+			return err
+		}
+		if err := decodeProduce(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partition chooses the partition for a record with the given key.
+func (e *Exporter) partition(key []byte) partition {
+	partitions := e.meta.partitions
+	if key != nil && e.config.Partitioning == ByTraceID {
+		return partitions[int(murmur2(key)&0x7fffffff)%len(partitions)]
+	}
+	p := partitions[e.next%len(partitions)]
+	e.next++
+	return p
+}
+
+// fetchMetadata asks each of the configured brokers in turn for the
+// partitions of the topic.
+func (e *Exporter) fetchMetadata(ctx context.Context) (*metadata, error) {
+	var lastErr error
+	for _, address := range e.config.Brokers {
+		c, err := dial(ctx, address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		response, err := e.roundTrip(ctx, c, apiMetadata, apiMetadataVersion, metadataRequest(e.config.Topic))
+		c.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return decodeMetadata(response, e.config.Topic)
+	}
+	return nil, lastErr
+}
+
+func (e *Exporter) connect(ctx context.Context, id int32) (*conn, error) {
+	if c := e.conns[id]; c != nil {
+		return c, nil
+	}
+	b, ok := e.meta.brokers[id]
+	if !ok {
+		return nil, fmt.Errorf("kafka partition leader %d is not a known broker", id)
+	}
+	c, err := dial(ctx, net.JoinHostPort(b.host, strconv.Itoa(int(b.port))))
+	if err != nil {
+		return nil, err
+	}
+	e.conns[id] = c
+	return c, nil
+}
+
+// reset closes the connections and forgets the metadata.
+func (e *Exporter) reset() {
+	for id, c := range e.conns {
+		c.Close()
+		delete(e.conns, id)
+	}
+	e.meta = nil
+}
+
+func (e *Exporter) roundTrip(ctx context.Context, c *conn, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	e.sequence++
+	return c.roundTrip(ctx, request(apiKey, apiVersion, e.sequence, e.config.ClientID, body), e.sequence)
+}
+
+// maxResponse bounds the size of a response, well beyond that of any
+// response to the requests sent by this package.
+const maxResponse = 1 << 24
+
+// conn is a connection to a single broker.
+type conn struct {
+	net.Conn
+}
+
+func dial(ctx context.Context, address string) (*conn, error) {
+	c, err := export.Dial(ctx, address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("kafka failed to connect to %v: %v", address, err)
+	}
+	return &conn{c}, nil
+}
+
+// roundTrip sends a request and returns the body of its response.
+func (c *conn) roundTrip(ctx context.Context, request []byte, correlationID int32) ([]byte, error) {
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+	if _, err := c.Write(request); err != nil {
+		return nil, fmt.Errorf("kafka failed to send request: %v", err)
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(c, header[:]); err != nil {
+		return nil, fmt.Errorf("kafka failed to read response: %v", err)
+	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if got := int32(binary.BigEndian.Uint32(header[4:])); got != correlationID {
+		return nil, fmt.Errorf("kafka response is for request %d, want %d", got, correlationID)
+	}
+	if size < 4 || size > maxResponse {
+		return nil, fmt.Errorf("kafka response has invalid size %d", size)
+	}
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(c, body); err != nil {
+		return nil, fmt.Errorf("kafka failed to read response: %v", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,272 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestMurmur2(t *testing.T) {
+	// The expected values are those of the Java client.
+	for _, test := range []struct {
+		key  string
+		want int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	} {
+		if got := int32(murmur2([]byte(test.key))); got != test.want {
+			t.Errorf("murmur2(%q) = %d, want %d", test.key, got, test.want)
+		}
+	}
+}
+
+// record is a record received by a fakeBroker.
+type record struct {
+	partition int32
+	key       string
+	value     string
+}
+
+// fakeBroker is a single broker cluster that leads every partition of a
+// topic and remembers the records produced to it.
+type fakeBroker struct {
+	t          *testing.T
+	ln         net.Listener
+	topic      string
+	partitions int32
+
+	mu      sync.Mutex
+	records []record
+}
+
+func newFakeBroker(t *testing.T, topic string, partitions int32) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, ln: ln, topic: topic, partitions: partitions}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) serve(c net.Conn) {
+	defer c.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey, _, correlationID := d.int16(), d.int16(), d.int32()
+		d.string() // client id
+		var body []byte
+		switch apiKey {
+		case apiMetadata:
+			body = b.metadata()
+		case apiProduce:
+			body = b.produce(d)
+		default:
+			b.t.Errorf("unexpected request with api key %d", apiKey)
+			return
+		}
+		e := &encoder{}
+		e.int32(int32(len(body) + 4))
+		e.int32(correlationID)
+		e.buf = append(e.buf, body...)
+		c.Write(e.buf)
+	}
+}
+
+func (b *fakeBroker) metadata() []byte {
+	host, port, _ := net.SplitHostPort(b.ln.Addr().String())
+	e := &encoder{}
+	e.int32(1)
+	e.int32(0)
+	e.string(host)
+	p, _ := strconv.Atoi(port)
+	e.int32(int32(p))
+	e.nullableString("")
+	e.int32(0) // controller
+	e.int32(1)
+	e.int16(0)
+	e.string(b.topic)
+	e.int8(0)
+	e.int32(b.partitions)
+	for i := int32(0); i < b.partitions; i++ {
+		e.int16(0)
+		e.int32(i)
+		e.int32(0) // leader
+		e.int32(1)
+		e.int32(0)
+		e.int32(1)
+		e.int32(0)
+	}
+	return e.buf
+}
+
+func (b *fakeBroker) produce(d *decoder) []byte {
+	d.string() // transactional id
+	d.int16()  // acks
+	d.int32()  // timeout
+	e := &encoder{}
+	e.int32(int32(d.arrayLen()))
+	topic := d.string()
+	e.string(topic)
+	n := d.arrayLen()
+	e.int32(int32(n))
+	for ; n > 0; n-- {
+		id := d.int32()
+		b.decodeBatch(id, d.bytes())
+		e.int32(id)
+		e.int16(0)
+		e.int64(0)
+		e.int64(-1)
+	}
+	e.int32(0) // throttle time
+	if d.err != nil {
+		b.t.Error(d.err)
+	}
+	return e.buf
+}
+
+func (b *fakeBroker) decodeBatch(partition int32, batch []byte) {
+	d := &decoder{buf: batch}
+	d.int64() // base offset
+	if n := d.int32(); int(n) != len(batch)-12 {
+		b.t.Errorf("batch length is %d, want %d", n, len(batch)-12)
+	}
+	d.int32() // leader epoch
+	if magic := d.int8(); magic != 2 {
+		b.t.Errorf("batch has magic %d", magic)
+	}
+	if crc := uint32(d.int32()); crc != crc32.Checksum(d.buf, castagnoli) {
+		b.t.Error("batch has the wrong checksum")
+	}
+	d.take(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for n := d.int32(); n > 0; n-- {
+		r := &decoder{buf: d.take(int(d.varint()))}
+		r.int8()
+		r.varint()
+		r.varint()
+		var key string
+		if n := r.varint(); n >= 0 {
+			key = string(r.take(int(n)))
+		}
+		value := string(r.take(int(r.varint())))
+		b.records = append(b.records, record{partition: partition, key: key, value: value})
+	}
+	if d.err != nil {
+		b.t.Error(d.err)
+	}
+}
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestExportSpans(t *testing.T) {
+	broker := newFakeBroker(t, "telemetry", 3)
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	for _, name := range []string{"first", "second"} {
+		ctx, done := event.Start(context.Background(), name)
+		_, childDone := event.Start(ctx, name+".child")
+		childDone()
+		done()
+	}
+	event.SetExporter(nil)
+
+	exporter, err := New(&Config{Brokers: []string{broker.ln.Addr().String()}, Topic: "telemetry", JSON: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.records) != 2 {
+		t.Fatalf("got %d records, want one for each trace", len(broker.records))
+	}
+	for _, r := range broker.records {
+		if want := int32(murmur2([]byte(r.key))&0x7fffffff) % 3; r.partition != want {
+			t.Errorf("trace %s published to partition %d, want %d", r.key, r.partition, want)
+		}
+		if strings.Count(r.value, `"traceId":"`+r.key+`"`) != 2 {
+			t.Errorf("record for trace %s does not hold both its spans: %s", r.key, r.value)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	broker := newFakeBroker(t, "telemetry", 2)
+	exporter, err := New(&Config{Brokers: []string{broker.ln.Addr().String()}, Topic: "telemetry", Partitioning: RoundRobin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	for i := 0; i < 3; i++ {
+		if err := exporter.ExportMetrics(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	var got []int32
+	for _, r := range broker.records {
+		got = append(got, r.partition)
+	}
+	if len(got) != 3 || got[0] != 0 || got[1] != 1 || got[2] != 0 {
+		t.Errorf("records published to partitions %v, want [0 1 0]", got)
+	}
+}
+
+func TestUnknownTopic(t *testing.T) {
+	broker := newFakeBroker(t, "telemetry", 1)
+	exporter, err := New(&Config{Brokers: []string{broker.ln.Addr().String()}, Topic: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	if err := exporter.ExportMetrics(context.Background(), nil); err == nil {
+		t.Error("published to a topic the broker does not have")
+	}
+}
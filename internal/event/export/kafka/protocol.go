@@ -0,0 +1,389 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// This file implements the subset of the Kafka protocol needed to find the
+// leaders of the partitions of a topic, and to produce record batches to
+// them, as described in https://kafka.apache.org/protocol and
+// https://kafka.apache.org/documentation/#recordbatch.
+
+// API keys and the versions used.
+const (
+	apiProduce         = 0
+	apiProduceVersion  = 3
+	apiMetadata        = 3
+	apiMetadataVersion = 1
+)
+
+// encoder appends big endian Kafka primitives to buf.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8) { e.buf = append(e.buf, byte(v)) }
+
+func (e *encoder) int16(v int16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.int32(int32(v >> 32))
+	e.int32(int32(v))
+}
+
+// varint appends a zig-zag encoded variable length integer, as used within
+// records.
+func (e *encoder) varint(v int64) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for u >= 0x80 {
+		e.buf = append(e.buf, byte(u)|0x80)
+		u >>= 7
+	}
+	e.buf = append(e.buf, byte(u))
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// nullableString appends s, or the null string if it is empty.
+func (e *encoder) nullableString(s string) {
+	if s == "" {
+		e.int16(-1)
+		return
+	}
+	e.string(s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// decoder reads big endian Kafka primitives from buf.
+// The first error is remembered, and all reads after it return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errShort = errors.New("kafka response is truncated")
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errShort
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) varint() int64 {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b := d.take(1)
+		if b == nil {
+			return 0
+		}
+		u |= uint64(b[0]&0x7f) << shift
+		if b[0] < 0x80 {
+			return int64(u>>1) ^ -int64(u&1)
+		}
+	}
+	d.err = fmt.Errorf("kafka varint is too long")
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen reads the length of an array, treating a null array as empty.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 || d.err != nil {
+		return 0
+	}
+	// Every element takes at least a byte, which bounds the allocations a
+	// corrupt length can cause.
+	if int(n) > len(d.buf) {
+		d.err = errShort
+		return 0
+	}
+	return int(n)
+}
+
+// request returns a complete request, prefixed with its size.
+func request(apiKey, apiVersion int16, correlationID int32, clientID string, body []byte) []byte {
+	e := &encoder{buf: make([]byte, 4, 4+14+len(clientID)+len(body))}
+	e.int16(apiKey)
+	e.int16(apiVersion)
+	e.int32(correlationID)
+	e.nullableString(clientID)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	return e.buf
+}
+
+// metadataRequest asks for the partitions of a single topic.
+func metadataRequest(topic string) []byte {
+	e := &encoder{}
+	e.int32(1)
+	e.string(topic)
+	return e.buf
+}
+
+type broker struct {
+	id   int32
+	host string
+	port int32
+}
+
+type partition struct {
+	id     int32
+	leader int32
+}
+
+type metadata struct {
+	brokers    map[int32]broker
+	partitions []partition // sorted by id
+}
+
+// decodeMetadata decodes a version 1 metadata response for topic.
+func decodeMetadata(body []byte, topic string) (*metadata, error) {
+	d := &decoder{buf: body}
+	m := &metadata{brokers: make(map[int32]broker)}
+	for n := d.arrayLen(); n > 0; n-- {
+		b := broker{id: d.int32(), host: d.string(), port: d.int32()}
+		d.string() // rack
+		m.brokers[b.id] = b
+	}
+	d.int32() // controller id
+	var topicErr int16 = -1
+	for n := d.arrayLen(); n > 0; n-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		var partitions []partition
+		for p := d.arrayLen(); p > 0; p-- {
+			d.int16() // error code, a partition without a leader reports -1
+			part := partition{id: d.int32(), leader: d.int32()}
+			for r := d.arrayLen(); r > 0; r-- {
+				d.int32() // replicas
+			}
+			for r := d.arrayLen(); r > 0; r-- {
+				d.int32() // in sync replicas
+			}
+			partitions = append(partitions, part)
+		}
+		if name == topic {
+			topicErr = code
+			m.partitions = partitions
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	switch {
+	case topicErr == -1:
+		return nil, fmt.Errorf("kafka broker did not describe topic %v", topic)
+	case topicErr != 0:
+		return nil, fmt.Errorf("kafka cannot describe topic %v: error code %d", topic, topicErr)
+	case len(m.partitions) == 0:
+		return nil, fmt.Errorf("kafka topic %v has no partitions", topic)
+	}
+	sort.Slice(m.partitions, func(i, j int) bool { return m.partitions[i].id < m.partitions[j].id })
+	return m, nil
+}
+
+// message is a single record to produce.
+type message struct {
+	key   []byte // nil for no key
+	value []byte
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// recordBatch encodes the messages as a version 2 record batch with the
+// given timestamp in milliseconds.
+func recordBatch(messages []message, timestamp int64) []byte {
+	e := &encoder{}
+	e.int64(0)  // base offset, assigned by the broker
+	e.int32(0)  // batch length, filled in below
+	e.int32(-1) // partition leader epoch
+	e.int8(2)   // magic
+	e.int32(0)  // crc, filled in below
+	crcStart := len(e.buf)
+	e.int16(0) // attributes: no compression, create time
+	e.int32(int32(len(messages) - 1))
+	e.int64(timestamp)
+	e.int64(timestamp)
+	e.int64(-1) // producer id
+	e.int16(-1) // producer epoch
+	e.int32(-1) // base sequence
+	e.int32(int32(len(messages)))
+	for i, m := range messages {
+		r := &encoder{}
+		r.int8(0)   // attributes
+		r.varint(0) // timestamp delta
+		r.varint(int64(i))
+		if m.key == nil {
+			r.varint(-1)
+		} else {
+			r.varint(int64(len(m.key)))
+			r.buf = append(r.buf, m.key...)
+		}
+		r.varint(int64(len(m.value)))
+		r.buf = append(r.buf, m.value...)
+		r.varint(0) // headers
+		e.varint(int64(len(r.buf)))
+		e.buf = append(e.buf, r.buf...)
+	}
+	binary.BigEndian.PutUint32(e.buf[8:], uint32(len(e.buf)-12))
+	binary.BigEndian.PutUint32(e.buf[crcStart-4:], crc32.Checksum(e.buf[crcStart:], castagnoli))
+	return e.buf
+}
+
+// produceRequest encodes a version 3 produce request of batches to the
+// partitions of topic.
+func produceRequest(topic string, acks int16, timeoutMS int32, batches map[int32][]byte) []byte {
+	e := &encoder{}
+	e.nullableString("") // transactional id
+	e.int16(acks)
+	e.int32(timeoutMS)
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(batches)))
+	for _, id := range sortedPartitions(batches) {
+		e.int32(id)
+		e.bytes(batches[id])
+	}
+	return e.buf
+}
+
+// decodeProduce decodes a version 3 produce response, returning an error for
+// the first partition that failed.
+func decodeProduce(body []byte) error {
+	d := &decoder{buf: body}
+	var firstErr error
+	for n := d.arrayLen(); n > 0; n-- {
+		topic := d.string()
+		for p := d.arrayLen(); p > 0; p-- {
+			id := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 && firstErr == nil {
+				firstErr = fmt.Errorf("kafka failed to produce to %v partition %d: error code %d", topic, id, code)
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	return firstErr
+}
+
+func sortedPartitions(batches map[int32][]byte) []int32 {
+	ids := make([]int32, 0, len(batches))
+	for id := range batches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// murmur2 is the hash the Java client uses to choose the partition of a
+// key, so that records keyed by this package land on the same partitions as
+// those of other producers.
+func murmur2(data []byte) uint32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	h := uint32(seed) ^ uint32(len(data))
+	n := len(data) &^ 3
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch len(data) & 3 {
+	case 3:
+		h ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[n])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
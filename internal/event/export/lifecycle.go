@@ -0,0 +1,209 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+)
+
+// Flusher is implemented by exporters that hold on to telemetry before
+// delivering it.
+// Flush should deliver everything buffered so far, giving up when the context
+// is done.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Shutdowner is implemented by exporters that hold resources, such as
+// connections or goroutines, that must be released when they are no longer
+// needed.
+// Shutdown should deliver all buffered telemetry before releasing them.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	lifecycleMu sync.Mutex
+	managed     []interface{}
+
+	// exportTimeout is the duration set by SetExportTimeout, it is accessed
+	// atomically.
+	exportTimeout int64
+)
+
+// SetExportTimeout sets the longest that any single delivery, flush or
+// shutdown of an exporter in this package may take.
+// Zero, the default, means the only limit is the context supplied by the
+// caller.
+func SetExportTimeout(d time.Duration) {
+	atomic.StoreInt64(&exportTimeout, int64(d))
+}
+
+// TimeoutContext returns ctx bounded by the timeout set with
+// SetExportTimeout.
+// Exporters should use it for every delivery to a backend, so that a dead
+// backend cannot stall the program indefinitely.
+// The returned cancel function must be called once the delivery is complete.
+func TimeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := time.Duration(atomic.LoadInt64(&exportTimeout)); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Manage adds v to the set of exporters that are acted on by the package level
+// Flush and Shutdown functions.
+// Values that implement neither Flusher nor Shutdowner are ignored.
+func Manage(v interface{}) {
+	switch v.(type) {
+	case Flusher, Shutdowner:
+	default:
+		return
+	}
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	for _, m := range managed {
+		if m == v {
+			return
+		}
+	}
+	managed = append(managed, v)
+}
+
+// Unmanage removes v from the set of managed exporters.
+func Unmanage(v interface{}) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	for i, m := range managed {
+		if m == v {
+			managed = append(managed[:i:i], managed[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flush flushes all the managed exporters.
+// It returns the first error encountered, but always attempts to flush every
+// exporter unless the context is done.
+func Flush(ctx context.Context) error {
+	lifecycleMu.Lock()
+	list := append([]interface{}(nil), managed...)
+	lifecycleMu.Unlock()
+	var firstErr error
+	for _, m := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if f, ok := m.(Flusher); ok {
+			if err := flush(ctx, f); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Shutdown shuts down all the managed exporters, and then forgets them.
+// Exporters that can be flushed but not shut down are flushed instead.
+// It is intended to be called just before the process exits, to guarantee the
+// delivery of any buffered telemetry.
+func Shutdown(ctx context.Context) error {
+	lifecycleMu.Lock()
+	list := managed
+	managed = nil
+	lifecycleMu.Unlock()
+	var firstErr error
+	for _, m := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		switch m := m.(type) {
+		case Shutdowner:
+			timeoutCtx, cancel := TimeoutContext(ctx)
+			err = m.Shutdown(timeoutCtx)
+			cancel()
+		case Flusher:
+			err = flush(ctx, m)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Handover installs e as the global exporter, and then makes sure that
+// telemetry buffered by the exporters it replaces is delivered rather than
+// abandoned.
+// Each of the retired values is shut down if it is a Shutdowner, or flushed
+// if it is a Flusher. If none are supplied, all the managed exporters are
+// flushed instead, which is always safe but may deliver early.
+// The context bounds how long the handover may take; events already in
+// flight when the context is done may be lost.
+// It returns the exporter that was replaced.
+func Handover(ctx context.Context, e event.Exporter, retired ...interface{}) (event.Exporter, error) {
+	old := event.SwapExporter(e)
+	if len(retired) == 0 {
+		return old, Flush(ctx)
+	}
+	return old, retire(ctx, retired)
+}
+
+// ShutdownAll returns a Shutdowner that retires each of the values in turn,
+// as Handover does, so that a stage feeding another is shut down first.
+// Nil values are skipped, and if all of them are nil ShutdownAll returns nil.
+func ShutdownAll(values ...interface{}) Shutdowner {
+	var nonNil shutdownAll
+	for _, v := range values {
+		if v != nil {
+			nonNil = append(nonNil, v)
+		}
+	}
+	if len(nonNil) == 0 {
+		return nil
+	}
+	return nonNil
+}
+
+type shutdownAll []interface{}
+
+func (s shutdownAll) Shutdown(ctx context.Context) error {
+	return retire(ctx, s)
+}
+
+// retire shuts down or flushes each of the values, and returns the first
+// error encountered.
+func retire(ctx context.Context, retired []interface{}) error {
+	var firstErr error
+	for _, r := range retired {
+		var err error
+		switch r := r.(type) {
+		case Shutdowner:
+			Unmanage(r)
+			timeoutCtx, cancel := TimeoutContext(ctx)
+			err = r.Shutdown(timeoutCtx)
+			cancel()
+		case Flusher:
+			err = flush(ctx, r)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// flush calls f.Flush bounded by the export timeout.
+func flush(ctx context.Context, f Flusher) error {
+	ctx, cancel := TimeoutContext(ctx)
+	defer cancel()
+	return f.Flush(ctx)
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+type lifecycleRecorder struct {
+	flushed, shutdown int
+	err               error
+}
+
+func (r *lifecycleRecorder) Flush(ctx context.Context) error {
+	r.flushed++
+	return r.err
+}
+
+type shutdownRecorder struct {
+	lifecycleRecorder
+}
+
+func (r *shutdownRecorder) Shutdown(ctx context.Context) error {
+	r.shutdown++
+	return nil
+}
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	flusher := &lifecycleRecorder{err: errors.New("flush failed")}
+	shutdowner := &shutdownRecorder{}
+	export.Manage(flusher)
+	export.Manage(shutdowner)
+	export.Manage(flusher) // managing twice has no effect
+	export.Manage("not an exporter")
+
+	if err := export.Flush(ctx); err == nil {
+		t.Error("Flush did not report the failure")
+	}
+	if flusher.flushed != 1 || shutdowner.flushed != 1 {
+		t.Errorf("Flush flushed (%d, %d) times, want (1, 1)", flusher.flushed, shutdowner.flushed)
+	}
+
+	export.Shutdown(ctx)
+	if flusher.flushed != 2 {
+		t.Errorf("Shutdown did not flush the flusher")
+	}
+	if shutdowner.shutdown != 1 || shutdowner.flushed != 1 {
+		t.Errorf("Shutdown called (Shutdown, Flush) (%d, %d) times, want (1, 1)", shutdowner.shutdown, shutdowner.flushed)
+	}
+
+	// Shutdown forgets the exporters it has shut down.
+	export.Flush(ctx)
+	if flusher.flushed != 2 {
+		t.Errorf("Flush after Shutdown still flushed the exporter")
+	}
+}
+
+// stuckFlusher is a Flusher whose backend never responds.
+type stuckFlusher struct{}
+
+func (stuckFlusher) Flush(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestExportTimeout(t *testing.T) {
+	f := &stuckFlusher{}
+	export.Manage(f)
+	defer export.Unmanage(f)
+	export.SetExportTimeout(10 * time.Millisecond)
+	defer export.SetExportTimeout(0)
+
+	if err := export.Flush(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Flush of a stuck exporter returned %v, want a deadline error", err)
+	}
+	if _, err := export.Handover(context.Background(), nil, stuckShutdowner{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Handover of a stuck exporter returned %v, want a deadline error", err)
+	}
+}
+
+// stuckShutdowner is a Shutdowner whose backend never responds.
+type stuckShutdowner struct{}
+
+func (stuckShutdowner) Shutdown(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHandover(t *testing.T) {
+	ctx := context.Background()
+	r := &recorder{}
+	q := export.Buffered(r.ProcessEvent, 10, export.DropNewest)
+	event.SetExporter(q.ProcessEvent)
+	defer event.SetExporter(nil)
+	event.Log(ctx, "queued")
+
+	retired := &shutdownRecorder{}
+	old, err := export.Handover(ctx, nil, q, retired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old == nil {
+		t.Error("Handover did not return the replaced exporter")
+	}
+	r.check(t, "log queued")
+	if retired.shutdown != 1 {
+		t.Errorf("retired exporter was shut down %d times, want 1", retired.shutdown)
+	}
+	event.Log(ctx, "after handover")
+	r.check(t)
+}
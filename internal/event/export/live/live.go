@@ -0,0 +1,214 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package live pushes telemetry to WebSocket clients as it happens, for live
+// dashboards and telemetry viewers in editors.
+//
+// The Exporter is an http.Handler, normally mounted on the gopls debug
+// server. Each connected client is sent a text message for each log event,
+// finished span and metric row, holding a JSON streamreader.Frame.
+// A client that falls behind has messages dropped rather than slowing the
+// program down, and is told how many with a "dropped" frame.
+//
+// Only clients that send no Origin header, or one that matches the host
+// they connected to, are accepted, so that other web sites cannot read the
+// telemetry of a local server.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/websocket"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/stream"
+	"golang.org/x/tools/internal/event/export/stream/streamreader"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Buffer is the number of messages held for each client before messages
+	// are dropped, it defaults to 1024.
+	Buffer int
+}
+
+// Exporter sends telemetry to the connected WebSocket clients.
+// It must be wrapped by export.Spans for span frames to be sent.
+type Exporter struct {
+	config  Config
+	server  websocket.Server
+	clients int32 // the length of conns, read atomically on every event
+
+	mu     sync.Mutex
+	conns  map[*client]bool
+	closed bool
+}
+
+// client is a connected WebSocket client.
+type client struct {
+	ws       *websocket.Conn
+	messages chan string
+	done     chan struct{} // closed when serve returns
+	dropped  int64         // messages dropped since the last dropped frame, accessed atomically
+}
+
+// New returns an Exporter with no clients.
+// The Exporter is managed, so the package level export.Shutdown function
+// disconnects the clients.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.Buffer <= 0 {
+		resolved.Buffer = 1024
+	}
+	e := &Exporter{
+		config: resolved,
+		conns:  make(map[*client]bool),
+	}
+	e.server = websocket.Server{Handshake: sameOrigin, Handler: e.serve}
+	export.Manage(e)
+	return e
+}
+
+// ServeHTTP accepts a WebSocket client.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	e.server.ServeHTTP(w, req)
+}
+
+// Clients returns the number of connected clients.
+func (e *Exporter) Clients() int {
+	return int(atomic.LoadInt32(&e.clients))
+}
+
+// sameOrigin accepts clients that are not browsers, or are pages served by
+// the same host.
+func sameOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin != nil && origin.Host != req.Host {
+		return fmt.Errorf("origin %v does not match host %v", origin, req.Host)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// serve sends messages to a client until it disconnects or the exporter is
+// shut down.
+func (e *Exporter) serve(ws *websocket.Conn) {
+	c := &client{ws: ws, messages: make(chan string, e.config.Buffer), done: make(chan struct{})}
+	defer close(c.done)
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.conns[c] = true
+	atomic.AddInt32(&e.clients, 1)
+	e.mu.Unlock()
+	defer e.remove(c)
+
+	// Clients are not expected to send anything, but reading is how a
+	// disconnect is noticed, and how control frames are answered.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(gone)
+	}()
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				return
+			}
+			if n := atomic.SwapInt64(&c.dropped, 0); n > 0 {
+				if err := websocket.JSON.Send(ws, &streamreader.Frame{Time: core.Now(), Kind: "dropped", Count: n}); err != nil {
+					return
+				}
+			}
+			if err := websocket.Message.Send(ws, msg); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+func (e *Exporter) remove(c *client) {
+	e.mu.Lock()
+	if e.conns[c] {
+		delete(e.conns, c)
+		atomic.AddInt32(&e.clients, -1)
+	}
+	e.mu.Unlock()
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if e.Clients() == 0 {
+		return ctx
+	}
+	frames := stream.Frames(ctx, ev, lm)
+	if len(frames) == 0 {
+		return ctx
+	}
+	messages := make([]string, 0, len(frames))
+	for _, f := range frames {
+		data, err := json.Marshal(f)
+		if err != nil {
+			export.ReportError(fmt.Errorf("live failed to marshal %s: %v", f.Kind, err))
+			continue
+		}
+		messages = append(messages, string(data))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for c := range e.conns {
+		for _, msg := range messages {
+			select {
+			case c.messages <- msg:
+			default:
+				atomic.AddInt64(&c.dropped, 1)
+			}
+		}
+	}
+	return ctx
+}
+
+// Shutdown refuses new clients, and disconnects the connected ones once the
+// messages queued for them have been sent, or the context is done.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	conns := e.conns
+	e.conns = make(map[*client]bool)
+	atomic.StoreInt32(&e.clients, 0)
+	e.mu.Unlock()
+	for c := range conns {
+		close(c.messages)
+	}
+	export.Unmanage(e)
+	for c := range conns {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			// Closing the connection makes the pending send fail.
+			c.ws.Close()
+			<-c.done
+		}
+	}
+	return nil
+}
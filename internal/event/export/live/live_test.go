@@ -0,0 +1,104 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package live_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/live"
+	"golang.org/x/tools/internal/event/export/stream/streamreader"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// dial connects to the server and waits for the exporter to register the
+// client.
+func dial(t *testing.T, server *httptest.Server, exporter *live.Exporter, clients int) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for exporter.Clients() < clients {
+		time.Sleep(time.Millisecond)
+	}
+	return ws
+}
+
+func TestLive(t *testing.T) {
+	exporter := live.New(&live.Config{})
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	ws := dial(t, server, exporter, 1)
+	defer ws.Close()
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	event.Error(ctx, "failed", errors.New("timeout"))
+	done()
+
+	var got []string
+	for len(got) < 2 {
+		var f streamreader.Frame
+		if err := websocket.JSON.Receive(ws, &f); err != nil {
+			t.Fatal(err)
+		}
+		switch f.Kind {
+		case "error":
+			got = append(got, fmt.Sprintf("%s %s: %s %s", f.Kind, f.Message, f.Error, f.Severity))
+		case "span":
+			got = append(got, fmt.Sprintf("%s %s %v", f.Kind, f.Name, f.Labels))
+		}
+	}
+	if got, want := fmt.Sprint(got), "[error failed: timeout error span hover map[file:main.go]]"; got != want {
+		t.Errorf("client got %v, want %v", got, want)
+	}
+
+	// Shutting down disconnects the client.
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var msg string
+	if err := websocket.Message.Receive(ws, &msg); err == nil {
+		t.Errorf("client received %q after shutdown", msg)
+	}
+	if n := exporter.Clients(); n != 0 {
+		t.Errorf("%d clients after shutdown", n)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	exporter := live.New(&live.Config{})
+	defer exporter.Shutdown(context.Background())
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+	ws := dial(t, server, exporter, 1)
+	ws.Close()
+	for exporter.Clients() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	exporter := live.New(&live.Config{})
+	defer exporter.Shutdown(context.Background())
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	if ws, err := websocket.Dial(url, "", "http://example.com"); err == nil {
+		ws.Close()
+		t.Error("client from another origin was accepted")
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package loki pushes log events to Grafana Loki using its push API.
+//
+// Each event becomes a logfmt line holding the message, the error, the trace
+// and span it happened in, and its labels. The line is added to the stream
+// identified by its severity, the name of the enclosing span, the workspace,
+// and any static labels, which are kept to these few so that the number of
+// streams stays small.
+//
+// Lines are sent in batches. While Loki is unable to keep up, signalled by a
+// 429 or 5xx response, the batch is kept and sending is paused; lines that
+// arrive when the buffer is full are dropped, and the number dropped is
+// reported with the next successful push.
+//
+// Importing the package registers a "loki" exporter whose options are the
+// URL of the server, which may include the basic auth credentials. The
+// tenant is read from the LOKI_TENANT_ID environment variable, and the
+// workspace is the current directory.
+package loki
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultURL is the address a local server normally listens on.
+const DefaultURL = "http://localhost:3100"
+
+// TenantEnv is the environment variable the registered exporter reads the
+// tenant from.
+const TenantEnv = "LOKI_TENANT_ID"
+
+// pushPath is the path of the push API.
+const pushPath = "/loki/api/v1/push"
+
+// Config configures an Exporter.
+type Config struct {
+	// URL is the address of the server.
+	URL string
+	// Tenant is sent as the X-Scope-OrgID header, it may be left empty if
+	// Loki is not running in multi-tenant mode.
+	Tenant string
+	// Username and Password, if set, are sent as basic auth.
+	Username string
+	Password string
+	// TLS configures the connection to an https server.
+	// It is ignored if Client is set.
+	TLS *tls.Config
+	// Client sends the requests, it defaults to a client using TLS.
+	Client *http.Client
+	// Workspace is the value of the workspace label of every stream.
+	Workspace string
+	// Labels are added to every stream, for example to set a job.
+	Labels map[string]string
+	// MaxBatch is the number of lines that triggers a push, it defaults to
+	// 1000.
+	MaxBatch int
+	// MaxBuffer is the most lines held while Loki is not accepting them, it
+	// defaults to 10000.
+	MaxBuffer int
+	// Interval is the longest lines are held before they are pushed, it
+	// defaults to 2 seconds.
+	Interval time.Duration
+}
+
+func init() {
+	export.Register("loki", func(options string) (event.Exporter, export.Shutdowner, error) {
+		config := &Config{URL: options, Tenant: os.Getenv(TenantEnv)}
+		config.Workspace, _ = os.Getwd()
+		if options != "" {
+			u, err := url.Parse(options)
+			if err != nil {
+				return nil, nil, fmt.Errorf("loki exporter: %v", err)
+			}
+			if u.User != nil {
+				config.Username = u.User.Username()
+				config.Password, _ = u.User.Password()
+				u.User = nil
+				config.URL = u.String()
+			}
+		}
+		exporter := New(config)
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter collects log lines and pushes them to Loki.
+// It should be wrapped by export.Spans, so that lines are labelled with the
+// span they happened in.
+type Exporter struct {
+	config Config
+	full   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	entries []entry
+	dropped int
+	// pausedUntil is when the run loop may push again after Loki asked for
+	// the load to be reduced.
+	pausedUntil time.Time
+}
+
+// entry is a line and the stream it belongs to.
+type entry struct {
+	stream string // the labels of the stream, in the form Loki prints them
+	labels map[string]string
+	at     time.Time
+	line   string
+}
+
+// New returns an Exporter for the configured server.
+// The Exporter is managed, so the package level Flush and Shutdown functions
+// push the lines it is holding.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.URL == "" {
+		resolved.URL = DefaultURL
+	}
+	resolved.URL = strings.TrimSuffix(resolved.URL, "/")
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(resolved.TLS)
+	}
+	if resolved.MaxBatch <= 0 {
+		resolved.MaxBatch = 1000
+	}
+	if resolved.MaxBuffer <= 0 {
+		resolved.MaxBuffer = 10000
+	}
+	if resolved.Interval <= 0 {
+		resolved.Interval = 2 * time.Second
+	}
+	e := &Exporter{
+		config: resolved,
+		full:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	export.Manage(e)
+	return e
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if !event.IsLog(ev) {
+		return ctx
+	}
+	labels := map[string]string{"severity": export.SeverityOf(ev, lm).String()}
+	span := export.GetSpan(ctx)
+	if span != nil {
+		labels["span"] = span.Name
+	}
+	e.addStaticLabels(labels)
+	en := entry{
+		stream: streamOf(labels),
+		labels: labels,
+		at:     ev.At(),
+		line:   formatLine(ev, span),
+	}
+	e.mu.Lock()
+	if len(e.entries) >= e.config.MaxBuffer {
+		e.dropped++
+		e.mu.Unlock()
+		return ctx
+	}
+	e.entries = append(e.entries, en)
+	full := len(e.entries) >= e.config.MaxBatch
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+	return ctx
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.full:
+		case <-e.stop:
+			return
+		}
+		e.mu.Lock()
+		paused := time.Now().Before(e.pausedUntil)
+		e.mu.Unlock()
+		if paused {
+			continue
+		}
+		ctx, cancel := export.TimeoutContext(context.Background())
+		export.ReportError(e.Flush(ctx))
+		cancel()
+	}
+}
+
+// Flush pushes the lines collected so far in a single request.
+// If Loki asks for the load to be reduced the lines are kept for a later
+// push.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	entries, dropped := e.entries, e.dropped
+	e.entries, e.dropped = nil, 0
+	e.mu.Unlock()
+	if len(entries) == 0 {
+		return droppedError(dropped)
+	}
+	body, err := encodePush(entries)
+	if err != nil {
+		return err
+	}
+	retryAfter, err := e.push(ctx, body)
+	if err == nil {
+		return droppedError(dropped)
+	}
+	if retryAfter > 0 {
+		e.hold(entries, dropped, retryAfter)
+	} else {
+		// The lines were rejected, so they are lost, but the count of those
+		// dropped earlier still has to be reported.
+		e.mu.Lock()
+		e.dropped += dropped
+		e.mu.Unlock()
+	}
+	return err
+}
+
+// hold puts entries that could not be pushed back in front of those that have
+// arrived since, and pauses pushing for a while.
+func (e *Exporter) hold(entries []entry, dropped int, wait time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	all := append(entries, e.entries...)
+	if extra := len(all) - e.config.MaxBuffer; extra > 0 {
+		// Drop the oldest, the newest are usually the more interesting.
+		all = all[extra:]
+		dropped += extra
+	}
+	e.entries = all
+	e.dropped += dropped
+	e.pausedUntil = time.Now().Add(wait)
+}
+
+// push sends the request. If it fails because Loki is overloaded or
+// unavailable, it also returns how long to wait before trying again.
+func (e *Exporter) push(ctx context.Context, body []byte) (time.Duration, error) {
+	uri := e.config.URL + pushPath
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("loki failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.config.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", e.config.Tenant)
+	}
+	if e.config.Username != "" || e.config.Password != "" {
+		req.SetBasicAuth(e.config.Username, e.config.Password)
+	}
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return e.config.Interval, fmt.Errorf("loki failed to send lines: %v", err)
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return 0, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		wait := e.config.Interval
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return wait, fmt.Errorf("loki is not accepting lines, retrying in %v: %v", wait, res.Status)
+	default:
+		return 0, fmt.Errorf("loki rejected lines: %v", res.Status)
+	}
+}
+
+// Shutdown stops the periodic pushes, and then pushes the lines it is
+// holding.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	export.Unmanage(e)
+	return e.Flush(ctx)
+}
+
+func droppedError(dropped int) error {
+	if dropped == 0 {
+		return nil
+	}
+	return fmt.Errorf("loki dropped %d lines while the server was not accepting them", dropped)
+}
+
+// addStaticLabels adds the labels that are the same for every line.
+func (e *Exporter) addStaticLabels(labels map[string]string) {
+	if e.config.Workspace != "" {
+		labels["workspace"] = e.config.Workspace
+	}
+	for k, v := range e.config.Labels {
+		labels[k] = v
+	}
+}
+
+// streamOf returns the identity of the stream with the given labels.
+func streamOf(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// encodePush builds the body of a push request, with the lines of each
+// stream in time order.
+func encodePush(entries []entry) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].at.Before(entries[j].at) })
+	var streams []*stream
+	index := make(map[string]*stream)
+	for _, en := range entries {
+		s := index[en.stream]
+		if s == nil {
+			s = &stream{Stream: en.labels}
+			index[en.stream] = s
+			streams = append(streams, s)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(en.at.UnixNano(), 10), en.line})
+	}
+	data, err := json.Marshal(map[string]interface{}{"streams": streams})
+	if err != nil {
+		return nil, fmt.Errorf("loki failed to marshal lines: %v", err)
+	}
+	return data, nil
+}
+
+// formatLine renders an event as a logfmt line.
+func formatLine(ev core.Event, span *export.Span) string {
+	var b strings.Builder
+	addField(&b, "msg", keys.Msg.From(ev.Label(0)))
+	first := 1
+	if event.IsError(ev) {
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			addField(&b, "error", err.Error())
+		}
+		first = 2
+	}
+	if span != nil {
+		addField(&b, "trace_id", span.ID.TraceID.String())
+		addField(&b, "span_id", span.ID.SpanID.String())
+	}
+	for i := first; ev.Valid(i); i++ {
+		l := ev.Label(i)
+		if !l.Valid() || l.Key() == export.SeverityKey {
+			continue
+		}
+		addField(&b, l.Key().Name(), fmt.Sprint(export.LabelValue(l)))
+	}
+	return b.String()
+}
+
+// addField appends a logfmt key=value pair, quoting the value if needed.
+func addField(b *strings.Builder, key, value string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(key)
+	b.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"\t\n\\") {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(value)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loki_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/loki"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// server is a fake Loki that records the streams pushed to it, refusing them
+// with status while it is non-zero.
+type server struct {
+	t       *testing.T
+	mu      sync.Mutex
+	status  int
+	tenant  string
+	streams []stream
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path != "/loki/api/v1/push" {
+		s.t.Errorf("got request for %s", r.URL.Path)
+	}
+	if s.status != 0 {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(s.status)
+		return
+	}
+	s.tenant = r.Header.Get("X-Scope-OrgID")
+	var body struct {
+		Streams []stream `json:"streams"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.t.Error(err)
+	}
+	s.streams = append(s.streams, body.Streams...)
+}
+
+func (s *server) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func newExporter(t *testing.T, config *loki.Config) (*server, *loki.Exporter, context.Context) {
+	s := &server{t: t}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	config.URL = srv.URL
+	config.Interval = time.Hour
+	exporter := loki.New(config)
+	t.Cleanup(func() { exporter.Shutdown(context.Background()) })
+	ctx := event.WithExporter(context.Background(), export.Spans(exporter.ProcessEvent))
+	return s, exporter, ctx
+}
+
+func TestPush(t *testing.T) {
+	s, exporter, ctx := newExporter(t, &loki.Config{
+		Tenant:    "team-a",
+		Workspace: "/src/app",
+		Labels:    map[string]string{"job": "gopls"},
+	})
+	spanCtx, done := event.Start(ctx, "diagnose")
+	event.Error(spanCtx, "load failed", errors.New("no module"), keys.NewString("file", "").Of("a b.go"))
+	done()
+	event.Log(ctx, "idle")
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s.tenant != "team-a" {
+		t.Errorf("got tenant %q, want team-a", s.tenant)
+	}
+	if len(s.streams) != 2 {
+		t.Fatalf("got %d streams, want one per span and severity", len(s.streams))
+	}
+	for _, st := range s.streams {
+		if st.Stream["workspace"] != "/src/app" || st.Stream["job"] != "gopls" || len(st.Values) != 1 {
+			t.Errorf("got stream %v", st)
+			continue
+		}
+		line := st.Values[0][1]
+		switch st.Stream["severity"] {
+		case "error":
+			if st.Stream["span"] != "diagnose" {
+				t.Errorf("error stream has span %q, want diagnose", st.Stream["span"])
+			}
+			for _, want := range []string{`msg="load failed"`, `error="no module"`, `file="a b.go"`, "trace_id="} {
+				if !strings.Contains(line, want) {
+					t.Errorf("line %q does not contain %s", line, want)
+				}
+			}
+		case "info":
+			if _, found := st.Stream["span"]; found || line != "msg=idle" {
+				t.Errorf("got info stream %v", st)
+			}
+		default:
+			t.Errorf("got stream %v", st)
+		}
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	s, exporter, ctx := newExporter(t, &loki.Config{MaxBuffer: 3})
+	event.Log(ctx, "first")
+	event.Log(ctx, "second")
+	s.setStatus(http.StatusTooManyRequests)
+	if err := exporter.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded while the server was refusing lines")
+	}
+	event.Log(ctx, "third")
+	event.Log(ctx, "fourth")
+	s.setStatus(0)
+	err := exporter.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 lines") {
+		t.Errorf("got error %v, want one line dropped", err)
+	}
+	var got []string
+	for _, st := range s.streams {
+		for _, v := range st.Values {
+			got = append(got, v[1])
+		}
+	}
+	if strings.Join(got, ",") != "msg=first,msg=second,msg=third" {
+		t.Errorf("got lines %v, want the ones that fitted in the buffer", got)
+	}
+}
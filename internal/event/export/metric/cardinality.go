@@ -0,0 +1,126 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultCardinalityLimit is the most rows a metric has if neither it nor its
+// Config set a limit.
+const DefaultCardinalityLimit = 2000
+
+// Overflow labels the row that combines the values of a metric whose labels
+// would have exceeded its cardinality limit. It replaces all the other labels
+// of the row.
+var Overflow = keys.NewBoolean("otel.metric.overflow", "Whether a row combines the values beyond the cardinality limit.")
+
+// Keys for the warning logged when a metric first exceeds its cardinality
+// limit.
+var (
+	OverflowMetric = keys.NewString("metric", "The name of the metric that exceeded its cardinality limit.")
+	OverflowLimit  = keys.NewInt("limit", "The cardinality limit that was exceeded.")
+)
+
+// SetCardinalityLimit sets the cardinality limit of the metrics created on
+// the configuration afterwards that do not set their own. Zero restores
+// DefaultCardinalityLimit, and a negative limit removes it.
+// Labels such as file names or package paths can otherwise make a metric
+// grow without bound in a long running process.
+// It may be called while the configuration is in use, as when reloading it.
+func (e *Config) SetCardinalityLimit(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limit = n
+}
+
+// cardinalityLimitLocked returns the limit set by SetCardinalityLimit, or
+// the default. It must be called with the lock held.
+func (e *Config) cardinalityLimitLocked() int {
+	if e.limit == 0 {
+		return DefaultCardinalityLimit
+	}
+	return e.limit
+}
+
+// overflowGroup returns the labels of the overflow row of a metric with n
+// keys.
+func overflowGroup(n int) []label.Label {
+	group := make([]label.Label, n+1)
+	group[n] = Overflow.Of(true)
+	return group
+}
+
+// overflowed reports whether the data has an overflow row.
+func overflowed(data Data) bool {
+	for _, group := range data.Groups() {
+		for _, l := range group {
+			if l.Key() == Overflow {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// limitOf returns the cardinality limit of the data.
+func limitOf(data Data) int {
+	switch data := data.(type) {
+	case *Int64Data:
+		return data.Info.CardinalityLimit
+	case *Float64Data:
+		return data.Info.CardinalityLimit
+	case *HistogramInt64Data:
+		return data.Info.CardinalityLimit
+	case *HistogramFloat64Data:
+		return data.Info.CardinalityLimit
+	case *ExponentialHistogramData:
+		return data.Info.CardinalityLimit
+	}
+	return 0
+}
+
+// overflowWarnings remembers the metrics an exporter has already warned
+// about.
+type overflowWarnings struct {
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+// warn logs a warning the first time each of the metrics overflows.
+// No lock is held while logging, as the log event may come back to the same
+// exporter.
+func (w *overflowWarnings) warn(ctx context.Context, metrics []Data) {
+	for _, data := range metrics {
+		name := data.Handle()
+		// A metric only has an overflow row once it has more rows than
+		// its limit.
+		limit := limitOf(data)
+		if limit <= 0 || len(data.Groups()) <= limit || !overflowed(data) || !w.first(name) {
+			continue
+		}
+		event.Log(ctx, "metric exceeded its cardinality limit, further rows are combined",
+			OverflowMetric.Of(name), OverflowLimit.Of(limit))
+	}
+}
+
+// first reports whether this is the first warning about the named metric.
+func (w *overflowWarnings) first(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.warned[name] {
+		return false
+	}
+	if w.warned == nil {
+		w.warned = make(map[string]bool)
+	}
+	w.warned[name] = true
+	return true
+}
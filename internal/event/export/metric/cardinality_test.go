@@ -0,0 +1,97 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestCardinalityLimit(t *testing.T) {
+	file := keys.NewString("file", "")
+	opened := keys.NewInt64("opened", "")
+	parsed := keys.NewInt64("parsed", "")
+	checked := keys.NewInt64("checked", "")
+
+	var m metric.Config
+	m.SetCardinalityLimit(2)
+	m.AddView(metric.View{Match: "checked", CardinalityLimit: -1})
+	metric.Scalar{Name: "opened", Keys: []label.Key{file}}.SumInt64(&m, opened)
+	metric.Scalar{Name: "parsed", Keys: []label.Key{file}, CardinalityLimit: 3}.SumInt64(&m, parsed)
+	metric.Scalar{Name: "checked", Keys: []label.Key{file}}.SumInt64(&m, checked)
+
+	latest := make(map[string]*metric.Int64Data)
+	var warnings []string
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsMetric(ev):
+			for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+				latest[data.Handle()] = data.(*metric.Int64Data)
+			}
+		case event.IsLog(ev):
+			warnings = append(warnings, metric.OverflowMetric.Get(lm))
+		}
+		return ctx
+	}))
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.go", "a.go", "e.go"} {
+		event.Metric(ctx, file.Of(name), opened.Of(1), parsed.Of(1), checked.Of(1))
+	}
+
+	rows := func(name string) map[string]int64 {
+		got := make(map[string]int64)
+		data := latest[name]
+		for i, group := range data.Groups() {
+			var key string
+			for _, l := range group {
+				switch l.Key() {
+				case file:
+					key = file.From(l)
+				case metric.Overflow:
+					key = "overflow"
+				}
+			}
+			got[key] = data.Rows[i]
+		}
+		return got
+	}
+	for _, test := range []struct {
+		name string
+		want map[string]int64
+	}{
+		{"opened", map[string]int64{"a.go": 2, "b.go": 1, "overflow": 3}},
+		{"parsed", map[string]int64{"a.go": 2, "b.go": 1, "c.go": 1, "overflow": 2}},
+		{"checked", map[string]int64{"a.go": 2, "b.go": 1, "c.go": 1, "d.go": 1, "e.go": 1}},
+	} {
+		if got := rows(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s has rows %v, want %v", test.name, got, test.want)
+		}
+	}
+	if want := []string{"opened", "parsed"}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("got warnings for %v, want %v", warnings, want)
+	}
+}
+
+func TestSetCardinalityLimitConcurrently(t *testing.T) {
+	count := keys.NewInt64("count", "")
+	var m metric.Config
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			m.SetCardinalityLimit(i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		metric.Scalar{Name: "count"}.SumInt64(&m, count)
+	}
+	<-done
+}
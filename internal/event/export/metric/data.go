@@ -6,6 +6,7 @@ package metric
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"time"
 
@@ -32,10 +33,17 @@ type Int64Data struct {
 	Info *Scalar
 	// IsGauge is true for metrics that track values, rather than increasing over time.
 	IsGauge bool
+	// IsUpDown is true for sums that may decrease, which are neither gauges
+	// nor monotonic counters.
+	IsUpDown bool
 	// Rows holds the per group values for the metric.
 	Rows []int64
 	// End is the last time this metric was updated.
 	EndTime time.Time
+	// StartTime is when the interval covered by the rows began, if they hold
+	// the change computed by Deltas. For the totals kept by a Config it is
+	// when the Config was last Reset, or zero if it never was.
+	StartTime time.Time
 
 	groups [][]label.Label
 	key    *keys.Int64
@@ -47,10 +55,17 @@ type Float64Data struct {
 	Info *Scalar
 	// IsGauge is true for metrics that track values, rather than increasing over time.
 	IsGauge bool
+	// IsUpDown is true for sums that may decrease, which are neither gauges
+	// nor monotonic counters.
+	IsUpDown bool
 	// Rows holds the per group values for the metric.
 	Rows []float64
 	// End is the last time this metric was updated.
 	EndTime time.Time
+	// StartTime is when the interval covered by the rows began, if they hold
+	// the change computed by Deltas. For the totals kept by a Config it is
+	// when the Config was last Reset, or zero if it never was.
+	StartTime time.Time
 
 	groups [][]label.Label
 	key    *keys.Float64
@@ -64,9 +79,15 @@ type HistogramInt64Data struct {
 	Rows []*HistogramInt64Row
 	// End is the last time this metric was updated.
 	EndTime time.Time
+	// StartTime is when the interval covered by the rows began, if they hold
+	// the change computed by Deltas. For the totals kept by a Config it is
+	// when the Config was last Reset, or zero if it never was.
+	StartTime time.Time
 
 	groups [][]label.Label
 	key    *keys.Int64
+	// extremes holds the recent minima and maxima of each row.
+	extremes []*extremes
 }
 
 // HistogramInt64Row holds the values for a single row of a HistogramInt64Data.
@@ -77,10 +98,16 @@ type HistogramInt64Row struct {
 	Count int64
 	// Sum is the sum of all the values recorded.
 	Sum int64
-	// Min is the smallest recorded value.
+	// Min is the smallest recorded value, or in the change computed by
+	// Deltas the smallest recorded in the interval.
 	Min int64
-	// Max is the largest recorded value.
+	// Max is the largest recorded value, or in the change computed by Deltas
+	// the largest recorded in the interval.
 	Max int64
+	// Exemplars, if not empty, holds the latest value recorded in a sampled
+	// span for each bucket, followed by one for the values above the last
+	// bound. Buckets without such a value have a nil exemplar.
+	Exemplars []*Exemplar
 }
 
 // HistogramFloat64Data is a concrete implementation of Data for float64 histogram metrics.
@@ -91,9 +118,15 @@ type HistogramFloat64Data struct {
 	Rows []*HistogramFloat64Row
 	// End is the last time this metric was updated.
 	EndTime time.Time
+	// StartTime is when the interval covered by the rows began, if they hold
+	// the change computed by Deltas. For the totals kept by a Config it is
+	// when the Config was last Reset, or zero if it never was.
+	StartTime time.Time
 
 	groups [][]label.Label
 	key    *keys.Float64
+	// extremes holds the recent minima and maxima of each row.
+	extremes []*extremes
 }
 
 // HistogramFloat64Row holds the values for a single row of a HistogramFloat64Data.
@@ -104,10 +137,68 @@ type HistogramFloat64Row struct {
 	Count int64
 	// Sum is the sum of all the values recorded.
 	Sum float64
-	// Min is the smallest recorded value.
+	// Min is the smallest recorded value, or in the change computed by
+	// Deltas the smallest recorded in the interval.
 	Min float64
-	// Max is the largest recorded value.
+	// Max is the largest recorded value, or in the change computed by Deltas
+	// the largest recorded in the interval.
 	Max float64
+	// Exemplars, if not empty, holds the latest value recorded in a sampled
+	// span for each bucket, followed by one for the values above the last
+	// bound. Buckets without such a value have a nil exemplar.
+	Exemplars []*Exemplar
+}
+
+// ExponentialHistogramData is a concrete implementation of Data for
+// exponential histogram metrics.
+type ExponentialHistogramData struct {
+	// Info holds the original construction information.
+	Info *ExponentialHistogram
+	// Rows holds the per group values for the metric.
+	Rows []*ExponentialHistogramRow
+	// End is the last time this metric was updated.
+	EndTime time.Time
+	// StartTime is when the interval covered by the rows began, if they hold
+	// the change computed by Deltas. For the totals kept by a Config it is
+	// when the Config was last Reset, or zero if it never was.
+	StartTime time.Time
+
+	groups [][]label.Label
+	key    *keys.Float64
+	// extremes holds the recent minima and maxima of each row.
+	extremes []*extremes
+}
+
+// ExponentialHistogramRow holds the values for a single row of an
+// ExponentialHistogramData.
+type ExponentialHistogramRow struct {
+	// Scale sets the boundaries of the buckets, see ExponentialHistogram.
+	Scale int32
+	// ZeroCount is the count of values that were zero.
+	ZeroCount int64
+	// Positive holds the counts of positive values.
+	Positive ExponentialBuckets
+	// Negative holds the counts of negative values, by their absolute value.
+	Negative ExponentialBuckets
+	// Count is the total count.
+	Count int64
+	// Sum is the sum of all the values recorded.
+	Sum float64
+	// Min is the smallest recorded value, or in the change computed by
+	// Deltas the smallest recorded in the interval.
+	Min float64
+	// Max is the largest recorded value, or in the change computed by Deltas
+	// the largest recorded in the interval.
+	Max float64
+}
+
+// ExponentialBuckets holds the counts of a contiguous range of buckets.
+type ExponentialBuckets struct {
+	// Offset is the index of the bucket counted by the first entry of
+	// Counts.
+	Offset int32
+	// Counts is the counts per bucket.
+	Counts []int64
 }
 
 func labelListEqual(a, b []label.Label) bool {
@@ -120,7 +211,7 @@ func labelListLess(a, b []label.Label) bool {
 	return fmt.Sprint(a) < fmt.Sprint(b)
 }
 
-func getGroup(lm label.Map, g *[][]label.Label, keys []label.Key) (int, bool) {
+func getGroup(lm label.Map, g *[][]label.Label, keys []label.Key, limit int) (int, bool) {
 	group := make([]label.Label, len(keys))
 	for i, key := range keys {
 		l := lm.Find(key)
@@ -136,6 +227,17 @@ func getGroup(lm label.Map, g *[][]label.Label, keys []label.Key) (int, bool) {
 		// not a new group
 		return index, false
 	}
+	if limit > 0 && len(old) >= limit {
+		// There is no room for the group, so the value goes in the overflow
+		// row, which may already exist.
+		group = overflowGroup(len(keys))
+		index = sort.Search(len(old), func(i int) bool {
+			return !labelListLess(old[i], group)
+		})
+		if index < len(old) && labelListEqual(group, old[index]) {
+			return index, false
+		}
+	}
 	*g = make([][]label.Label, len(old)+1)
 	copy(*g, old[:index])
 	copy((*g)[index+1:], old[index:])
@@ -147,7 +249,7 @@ func (data *Int64Data) Handle() string          { return data.Info.Name }
 func (data *Int64Data) Groups() [][]label.Label { return data.groups }
 
 func (data *Int64Data) modify(at time.Time, lm label.Map, f func(v int64) int64) Data {
-	index, insert := getGroup(lm, &data.groups, data.Info.Keys)
+	index, insert := getGroup(lm, &data.groups, data.Info.Keys, data.Info.CardinalityLimit)
 	old := data.Rows
 	if insert {
 		data.Rows = make([]int64, len(old)+1)
@@ -185,7 +287,7 @@ func (data *Float64Data) Handle() string          { return data.Info.Name }
 func (data *Float64Data) Groups() [][]label.Label { return data.groups }
 
 func (data *Float64Data) modify(at time.Time, lm label.Map, f func(v float64) float64) Data {
-	index, insert := getGroup(lm, &data.groups, data.Info.Keys)
+	index, insert := getGroup(lm, &data.groups, data.Info.Keys, data.Info.CardinalityLimit)
 	old := data.Rows
 	if insert {
 		data.Rows = make([]float64, len(old)+1)
@@ -216,8 +318,11 @@ func (data *Float64Data) latest(at time.Time, lm label.Map, l label.Label) Data
 func (data *HistogramInt64Data) Handle() string          { return data.Info.Name }
 func (data *HistogramInt64Data) Groups() [][]label.Label { return data.groups }
 
-func (data *HistogramInt64Data) modify(at time.Time, lm label.Map, f func(v *HistogramInt64Row)) Data {
-	index, insert := getGroup(lm, &data.groups, data.Info.Keys)
+// Key returns the key whose values the histogram records.
+func (data *HistogramInt64Data) Key() *keys.Int64 { return data.key }
+
+func (data *HistogramInt64Data) modify(at time.Time, lm label.Map, value float64, f func(v *HistogramInt64Row)) Data {
+	index, insert := getGroup(lm, &data.groups, data.Info.Keys, data.Info.CardinalityLimit)
 	old := data.Rows
 	var v HistogramInt64Row
 	if insert {
@@ -234,14 +339,15 @@ func (data *HistogramInt64Data) modify(at time.Time, lm label.Map, f func(v *His
 	copy(v.Values, oldValues)
 	f(&v)
 	data.Rows[index] = &v
+	data.extremes = withExtreme(data.extremes, index, insert, v.Count, value)
 	data.EndTime = at
 	frozen := *data
 	return &frozen
 }
 
 func (data *HistogramInt64Data) record(at time.Time, lm label.Map, l label.Label) Data {
-	return data.modify(at, lm, func(v *HistogramInt64Row) {
-		value := data.key.From(l)
+	value := data.key.From(l)
+	return data.modify(at, lm, float64(value), func(v *HistogramInt64Row) {
 		v.Sum += value
 		if v.Min > value || v.Count == 0 {
 			v.Min = value
@@ -250,19 +356,27 @@ func (data *HistogramInt64Data) record(at time.Time, lm label.Map, l label.Label
 			v.Max = value
 		}
 		v.Count++
+		bucket := len(data.Info.Buckets)
 		for i, b := range data.Info.Buckets {
 			if value <= b {
 				v.Values[i]++
+				if i < bucket {
+					bucket = i
+				}
 			}
 		}
+		v.Exemplars = addExemplar(v.Exemplars, len(data.Info.Buckets)+1, bucket, at, lm, float64(value))
 	})
 }
 
 func (data *HistogramFloat64Data) Handle() string          { return data.Info.Name }
 func (data *HistogramFloat64Data) Groups() [][]label.Label { return data.groups }
 
-func (data *HistogramFloat64Data) modify(at time.Time, lm label.Map, f func(v *HistogramFloat64Row)) Data {
-	index, insert := getGroup(lm, &data.groups, data.Info.Keys)
+// Key returns the key whose values the histogram records.
+func (data *HistogramFloat64Data) Key() *keys.Float64 { return data.key }
+
+func (data *HistogramFloat64Data) modify(at time.Time, lm label.Map, value float64, f func(v *HistogramFloat64Row)) Data {
+	index, insert := getGroup(lm, &data.groups, data.Info.Keys, data.Info.CardinalityLimit)
 	old := data.Rows
 	var v HistogramFloat64Row
 	if insert {
@@ -279,14 +393,15 @@ func (data *HistogramFloat64Data) modify(at time.Time, lm label.Map, f func(v *H
 	copy(v.Values, oldValues)
 	f(&v)
 	data.Rows[index] = &v
+	data.extremes = withExtreme(data.extremes, index, insert, v.Count, value)
 	data.EndTime = at
 	frozen := *data
 	return &frozen
 }
 
 func (data *HistogramFloat64Data) record(at time.Time, lm label.Map, l label.Label) Data {
-	return data.modify(at, lm, func(v *HistogramFloat64Row) {
-		value := data.key.From(l)
+	value := data.key.From(l)
+	return data.modify(at, lm, value, func(v *HistogramFloat64Row) {
 		v.Sum += value
 		if v.Min > value || v.Count == 0 {
 			v.Min = value
@@ -295,10 +410,64 @@ func (data *HistogramFloat64Data) record(at time.Time, lm label.Map, l label.Lab
 			v.Max = value
 		}
 		v.Count++
+		bucket := len(data.Info.Buckets)
 		for i, b := range data.Info.Buckets {
 			if value <= b {
 				v.Values[i]++
+				if i < bucket {
+					bucket = i
+				}
 			}
 		}
+		v.Exemplars = addExemplar(v.Exemplars, len(data.Info.Buckets)+1, bucket, at, lm, value)
+	})
+}
+
+func (data *ExponentialHistogramData) Handle() string          { return data.Info.Name }
+func (data *ExponentialHistogramData) Groups() [][]label.Label { return data.groups }
+
+// Key returns the key whose values the histogram records.
+func (data *ExponentialHistogramData) Key() *keys.Float64 { return data.key }
+
+func (data *ExponentialHistogramData) modify(at time.Time, lm label.Map, value float64, f func(v *ExponentialHistogramRow)) Data {
+	index, insert := getGroup(lm, &data.groups, data.Info.Keys, data.Info.CardinalityLimit)
+	old := data.Rows
+	v := ExponentialHistogramRow{Scale: int32(data.Info.MaxScale)}
+	if insert {
+		data.Rows = make([]*ExponentialHistogramRow, len(old)+1)
+		copy(data.Rows, old[:index])
+		copy(data.Rows[index+1:], old[index:])
+	} else {
+		data.Rows = make([]*ExponentialHistogramRow, len(old))
+		copy(data.Rows, old)
+		v = *data.Rows[index]
+	}
+	v.Positive.Counts = append([]int64(nil), v.Positive.Counts...)
+	v.Negative.Counts = append([]int64(nil), v.Negative.Counts...)
+	f(&v)
+	data.Rows[index] = &v
+	data.extremes = withExtreme(data.extremes, index, insert, v.Count, value)
+	data.EndTime = at
+	frozen := *data
+	return &frozen
+}
+
+func (data *ExponentialHistogramData) record(at time.Time, lm label.Map, l label.Label) Data {
+	value := data.key.From(l)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		// Infinities and NaN have no bucket, and would make the sum useless.
+		frozen := *data
+		return &frozen
+	}
+	return data.modify(at, lm, value, func(v *ExponentialHistogramRow) {
+		v.Sum += value
+		if v.Min > value || v.Count == 0 {
+			v.Min = value
+		}
+		if v.Max < value || v.Count == 0 {
+			v.Max = value
+		}
+		v.Count++
+		v.add(value, data.Info.MaxSize)
 	})
 }
@@ -0,0 +1,220 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Temporality selects whether an exporter sends the totals of sums and
+// histograms, or the change in them since they were last sent.
+type Temporality int
+
+const (
+	// Cumulative sends the totals since the metric was created, which is
+	// what the data made by a Config holds.
+	Cumulative = Temporality(iota)
+	// Delta sends the change since the metric was last sent, as computed by
+	// Deltas.
+	Delta
+)
+
+// Deltas converts the cumulative data made by a Config into the change in each
+// row since the previous data for the same metric.
+// Gauges and up down counters, whose current value is what backends expect
+// of them, are passed through unchanged. The Min and Max of histogram rows
+// become those of the values recorded since the previous data, which are the
+// outliers that an interval is usually inspected for; they remain those of the
+// whole lifetime of the row in the rare case that a row recorded too many new
+// extremes to keep track of, or recorded nothing in the interval. Likewise
+// only the exemplars recorded since the previous data are kept.
+// If the data of a metric comes from a different aggregation than before,
+// for instance because the pipeline was rebuilt and the metric recreated, or
+// its Config was Reset since, its totals start again from zero, and are
+// converted whole.
+// The zero value is ready to use, a Deltas must not be used concurrently.
+type Deltas struct {
+	last map[string]Data
+}
+
+// Convert returns the change in each metric since the last time Convert saw
+// it. Data that is converted whole keeps its StartTime, which is zero unless
+// its Config was Reset, otherwise its StartTime is the EndTime of the data it
+// was compared against.
+func (d *Deltas) Convert(metrics []Data) []Data {
+	if d.last == nil {
+		d.last = make(map[string]Data)
+	}
+	result := make([]Data, len(metrics))
+	for i, data := range metrics {
+		result[i] = d.convert(data)
+		d.last[data.Handle()] = data
+	}
+	return result
+}
+
+// previousRows maps the labels of each row of the previous data of a metric
+// to its index.
+func previousRows(prev Data) map[string]int {
+	rows := make(map[string]int)
+	for i, group := range prev.Groups() {
+		rows[groupKey(group)] = i
+	}
+	return rows
+}
+
+func groupKey(group []label.Label) string {
+	return fmt.Sprint(group)
+}
+
+func (d *Deltas) convert(data Data) Data {
+	switch data := data.(type) {
+	case *Int64Data:
+		prev, ok := d.last[data.Handle()].(*Int64Data)
+		if data.IsGauge || data.IsUpDown || !ok || prev.Info != data.Info || !prev.StartTime.Equal(data.StartTime) {
+			return data
+		}
+		rows := previousRows(prev)
+		delta := *data
+		delta.StartTime = prev.EndTime
+		delta.Rows = make([]int64, len(data.Rows))
+		for i, group := range data.groups {
+			delta.Rows[i] = data.Rows[i]
+			if j, ok := rows[groupKey(group)]; ok {
+				delta.Rows[i] -= prev.Rows[j]
+			}
+		}
+		return &delta
+	case *Float64Data:
+		prev, ok := d.last[data.Handle()].(*Float64Data)
+		if data.IsGauge || data.IsUpDown || !ok || prev.Info != data.Info || !prev.StartTime.Equal(data.StartTime) {
+			return data
+		}
+		rows := previousRows(prev)
+		delta := *data
+		delta.StartTime = prev.EndTime
+		delta.Rows = make([]float64, len(data.Rows))
+		for i, group := range data.groups {
+			delta.Rows[i] = data.Rows[i]
+			if j, ok := rows[groupKey(group)]; ok {
+				delta.Rows[i] -= prev.Rows[j]
+			}
+		}
+		return &delta
+	case *HistogramInt64Data:
+		prev, ok := d.last[data.Handle()].(*HistogramInt64Data)
+		if !ok || prev.Info != data.Info || !prev.StartTime.Equal(data.StartTime) {
+			return data
+		}
+		rows := previousRows(prev)
+		delta := *data
+		delta.StartTime = prev.EndTime
+		delta.Rows = make([]*HistogramInt64Row, len(data.Rows))
+		for i, group := range data.groups {
+			row := *data.Rows[i]
+			if j, ok := rows[groupKey(group)]; ok {
+				before := prev.Rows[j]
+				row.Values = subtractCounts(row.Values, before.Values)
+				row.Count -= before.Count
+				row.Sum -= before.Sum
+				row.Exemplars = recentExemplars(row.Exemplars, prev.EndTime)
+				if min, max, ok := extremesOf(data.extremes, i).after(before.Count); ok {
+					row.Min, row.Max = int64(min), int64(max)
+				}
+			}
+			delta.Rows[i] = &row
+		}
+		return &delta
+	case *HistogramFloat64Data:
+		prev, ok := d.last[data.Handle()].(*HistogramFloat64Data)
+		if !ok || prev.Info != data.Info || !prev.StartTime.Equal(data.StartTime) {
+			return data
+		}
+		rows := previousRows(prev)
+		delta := *data
+		delta.StartTime = prev.EndTime
+		delta.Rows = make([]*HistogramFloat64Row, len(data.Rows))
+		for i, group := range data.groups {
+			row := *data.Rows[i]
+			if j, ok := rows[groupKey(group)]; ok {
+				before := prev.Rows[j]
+				row.Values = subtractCounts(row.Values, before.Values)
+				row.Count -= before.Count
+				row.Sum -= before.Sum
+				row.Exemplars = recentExemplars(row.Exemplars, prev.EndTime)
+				if min, max, ok := extremesOf(data.extremes, i).after(before.Count); ok {
+					row.Min, row.Max = min, max
+				}
+			}
+			delta.Rows[i] = &row
+		}
+		return &delta
+	case *ExponentialHistogramData:
+		prev, ok := d.last[data.Handle()].(*ExponentialHistogramData)
+		if !ok || prev.Info != data.Info || !prev.StartTime.Equal(data.StartTime) {
+			return data
+		}
+		rows := previousRows(prev)
+		delta := *data
+		delta.StartTime = prev.EndTime
+		delta.Rows = make([]*ExponentialHistogramRow, len(data.Rows))
+		for i, group := range data.groups {
+			row := *data.Rows[i]
+			if j, ok := rows[groupKey(group)]; ok {
+				before := prev.Rows[j]
+				// The scale of a row only ever decreases, so the earlier
+				// buckets can always be merged into the current ones.
+				change := int(before.Scale - row.Scale)
+				row.Positive = row.Positive.subtract(before.Positive, change)
+				row.Negative = row.Negative.subtract(before.Negative, change)
+				row.ZeroCount -= before.ZeroCount
+				row.Count -= before.Count
+				row.Sum -= before.Sum
+				if min, max, ok := extremesOf(data.extremes, i).after(before.Count); ok {
+					row.Min, row.Max = min, max
+				}
+			}
+			delta.Rows[i] = &row
+		}
+		return &delta
+	}
+	return data
+}
+
+// extremesOf returns the extremes of the row at index, or nil if they are not
+// known.
+func extremesOf(rows []*extremes, index int) *extremes {
+	if index < len(rows) {
+		return rows[index]
+	}
+	return nil
+}
+
+// subtractCounts returns the counts with the earlier counts removed.
+func subtractCounts(counts, earlier []int64) []int64 {
+	result := append([]int64(nil), counts...)
+	for i := range result {
+		if i < len(earlier) {
+			result[i] -= earlier[i]
+		}
+	}
+	return result
+}
+
+// subtract returns the buckets with the earlier buckets, from a scale that
+// was larger by change, removed.
+func (b ExponentialBuckets) subtract(earlier ExponentialBuckets, change int) ExponentialBuckets {
+	earlier.Counts = append([]int64(nil), earlier.Counts...)
+	earlier.downscale(change)
+	result := ExponentialBuckets{Offset: b.Offset, Counts: append([]int64(nil), b.Counts...)}
+	for i, c := range earlier.Counts {
+		if index := int(earlier.Offset-b.Offset) + i; index >= 0 && index < len(result.Counts) {
+			result.Counts[index] -= c
+		}
+	}
+	return result
+}
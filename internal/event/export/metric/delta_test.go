@@ -0,0 +1,142 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// snapshots returns a context whose metric events append the data they
+// produce to the returned slice.
+func snapshots(m *metric.Config) (context.Context, *[]metric.Data) {
+	var all []metric.Data
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			all = append(all, metric.Entries.Get(lm).([]metric.Data)...)
+		}
+		return ctx
+	}))
+	return ctx, &all
+}
+
+func TestDeltas(t *testing.T) {
+	method := keys.NewString("method", "")
+	calls := keys.NewInt64("calls", "")
+	open := keys.NewInt64("open", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "calls", Keys: []label.Key{method}}.SumInt64(&m, calls)
+	metric.Scalar{Name: "open"}.UpDownInt64(&m, open)
+	metric.HistogramFloat64{Name: "latency", Buckets: []float64{1, 10}}.Record(&m, latency)
+	ctx, all := snapshots(&m)
+
+	var d metric.Deltas
+	event.Metric(ctx, method.Of("hover"), calls.Of(2))
+	event.Metric(ctx, open.Of(3))
+	event.Metric(ctx, latency.Of(0.5))
+	first := d.Convert(*all)
+	*all = nil
+	event.Metric(ctx, method.Of("hover"), calls.Of(1))
+	event.Metric(ctx, method.Of("definition"), calls.Of(5))
+	event.Metric(ctx, open.Of(-1))
+	event.Metric(ctx, latency.Of(5))
+	second := d.Convert(*all)
+
+	if c := first[0].(*metric.Int64Data); !c.StartTime.IsZero() || !reflect.DeepEqual(c.Rows, []int64{2}) {
+		t.Errorf("first calls are %v starting at %v, want [2] with no start", c.Rows, c.StartTime)
+	}
+	if c := second[0].(*metric.Int64Data); c.StartTime != first[0].(*metric.Int64Data).EndTime || !reflect.DeepEqual(c.Rows, []int64{1}) {
+		t.Errorf("second calls are %v starting at %v, want [1]", c.Rows, c.StartTime)
+	}
+	// Each snapshot is compared with the one before it. Rows are ordered by
+	// their labels, and a new row is converted whole.
+	if c := second[1].(*metric.Int64Data); !reflect.DeepEqual(c.Rows, []int64{5, 0}) {
+		t.Errorf("third calls are %v, want [5 0]", c.Rows)
+	}
+	if o := second[2].(*metric.Int64Data); !reflect.DeepEqual(o.Rows, []int64{2}) {
+		t.Errorf("open is %v, want its total of [2]", o.Rows)
+	}
+	h := second[3].(*metric.HistogramFloat64Data).Rows[0]
+	if !reflect.DeepEqual(h.Values, []int64{0, 1}) || h.Count != 1 || h.Sum != 5 {
+		t.Errorf("latency change is %+v, want one value of 5", h)
+	}
+
+	// A recreated metric starts again from zero.
+	var restarted metric.Config
+	metric.Scalar{Name: "calls", Keys: []label.Key{method}}.SumInt64(&restarted, calls)
+	ctx, all = snapshots(&restarted)
+	event.Metric(ctx, method.Of("hover"), calls.Of(1))
+	if c := d.Convert(*all)[0].(*metric.Int64Data); !c.StartTime.IsZero() || !reflect.DeepEqual(c.Rows, []int64{1}) {
+		t.Errorf("restarted calls are %v starting at %v, want [1] with no start", c.Rows, c.StartTime)
+	}
+}
+
+func TestExponentialDeltas(t *testing.T) {
+	value := keys.NewFloat64("value", "")
+	var m metric.Config
+	metric.ExponentialHistogram{Name: "v", MaxScale: 1, MaxSize: 4}.Record(&m, value)
+	ctx, all := snapshots(&m)
+	var d metric.Deltas
+	event.Metric(ctx, value.Of(1.5))
+	event.Metric(ctx, value.Of(0))
+	d.Convert(*all)
+	*all = nil
+	// A value 16 times larger needs more buckets, so the row is rescaled.
+	event.Metric(ctx, value.Of(24))
+	row := d.Convert(*all)[0].(*metric.ExponentialHistogramData).Rows[0]
+	var total int64
+	for _, c := range row.Positive.Counts {
+		total += c
+	}
+	if row.Scale >= 1 || row.Count != 1 || row.ZeroCount != 0 || total != 1 || row.Sum != 24 {
+		t.Errorf("change is %+v, want a single value of 24 at a reduced scale", row)
+	}
+}
+
+func TestDeltaExtremes(t *testing.T) {
+	size := keys.NewInt64("extreme_size", "")
+	var m metric.Config
+	metric.HistogramInt64{Name: "size", Buckets: []int64{10, 100}}.Record(&m, size)
+	ctx, all := snapshots(&m)
+	var d metric.Deltas
+	latest := func() *metric.HistogramInt64Row {
+		return d.Convert((*all)[len(*all)-1:])[0].(*metric.HistogramInt64Data).Rows[0]
+	}
+
+	for _, v := range []int64{5, 50} {
+		event.Metric(ctx, size.Of(v))
+	}
+	if row := latest(); row.Min != 5 || row.Max != 50 {
+		t.Errorf("first interval has min %d and max %d, want 5 and 50", row.Min, row.Max)
+	}
+	// Later intervals report the extremes of their own values, even the ones
+	// recorded in the same clock tick as the previous interval ended.
+	for _, v := range []int64{30, 20, 40, 25} {
+		event.Metric(ctx, size.Of(v))
+	}
+	if row := latest(); row.Count != 4 || row.Min != 20 || row.Max != 40 {
+		t.Errorf("second interval has count %d, min %d and max %d, want 4, 20 and 40", row.Count, row.Min, row.Max)
+	}
+	// A row that recorded more new extremes than are kept falls back to the
+	// extremes of its lifetime.
+	for v := int64(100); v < 200; v++ {
+		event.Metric(ctx, size.Of(v))
+	}
+	if row := latest(); row.Min != 5 || row.Max != 199 {
+		t.Errorf("long interval has min %d and max %d, want the lifetime 5 and 199", row.Min, row.Max)
+	}
+	event.Metric(ctx, size.Of(150))
+	if row := latest(); row.Min != 150 || row.Max != 150 {
+		t.Errorf("last interval has min %d and max %d, want 150", row.Min, row.Max)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"time"
+
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// The labels that identify the span a metric event was emitted in.
+// Histograms keep the latest value recorded with them in each bucket as an
+// exemplar. They are added by export.Exemplars.
+var (
+	TraceID = keys.NewString("trace_id", "The hex encoded ID of the trace an exemplar was recorded in.")
+	SpanID  = keys.NewString("span_id", "The hex encoded ID of the span an exemplar was recorded in.")
+)
+
+// Exemplar is a value recorded by a histogram, along with the span it was
+// recorded in, so that a bucket can be traced to an example of its values.
+type Exemplar struct {
+	// Value is the recorded value.
+	Value float64
+	// Time is when the value was recorded.
+	Time time.Time
+	// TraceID and SpanID are the hex encoded IDs of the span.
+	TraceID string
+	SpanID  string
+}
+
+// addExemplar returns the exemplars of a histogram row with n buckets, the
+// last of which holds the values above every bound, after replacing the
+// exemplar of the bucket at index with the value if it was recorded in a
+// span. The exemplars are shared by the frozen copies of the row, so they are
+// never modified.
+func addExemplar(exemplars []*Exemplar, n, index int, at time.Time, lm label.Map, value float64) []*Exemplar {
+	traceID := TraceID.Get(lm)
+	if traceID == "" {
+		return exemplars
+	}
+	result := make([]*Exemplar, n)
+	copy(result, exemplars)
+	result[index] = &Exemplar{Value: value, Time: at, TraceID: traceID, SpanID: SpanID.Get(lm)}
+	return result
+}
+
+// recentExemplars returns the exemplars recorded after the given time.
+func recentExemplars(exemplars []*Exemplar, after time.Time) []*Exemplar {
+	var result []*Exemplar
+	for i, e := range exemplars {
+		if e != nil && e.Time.After(after) {
+			if result == nil {
+				result = make([]*Exemplar, len(exemplars))
+			}
+			result[i] = e
+		}
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import "math"
+
+// The limits on the scale of an exponential histogram. At the largest scale
+// bucket boundaries are about 0.00007% apart, at the smallest the whole range
+// of float64 fits in a few buckets.
+const (
+	MaxExponentialScale = 20
+	MinExponentialScale = -10
+)
+
+// DefaultExponentialSize is the number of buckets an exponential histogram
+// may use for each sign when none is configured. At a scale of 3, which
+// keeps boundaries within 10% of each other, 160 buckets cover a range of
+// a factor of 10^6, such as from microseconds to seconds.
+const DefaultExponentialSize = 160
+
+// exponentialIndex returns the index of the bucket that holds the positive
+// value at the given scale.
+func exponentialIndex(value float64, scale int) int32 {
+	frac, exp := math.Frexp(value)
+	// The value is in [2^(exp-1), 2^exp). An exact power of two is the
+	// inclusive upper bound of a bucket, so it belongs below the buckets of
+	// the other values with the same exponent.
+	exact := frac == 0.5
+	if scale <= 0 {
+		index := exp - 1
+		if exact {
+			index--
+		}
+		return int32(index >> uint(-scale))
+	}
+	if exact {
+		return int32((exp-1)<<uint(scale) - 1)
+	}
+	index := int32(math.Ceil(math.Log2(value)*math.Ldexp(1, scale))) - 1
+	// Keep rounding errors in the logarithm from moving the value outside
+	// the buckets of its power of two.
+	if low := int32((exp - 1) << uint(scale)); index < low {
+		index = low
+	}
+	if high := int32(exp<<uint(scale) - 1); index > high {
+		index = high
+	}
+	return index
+}
+
+// add counts a finite value in its bucket, reducing the scale of the row if
+// the buckets of its sign would otherwise exceed maxSize.
+func (v *ExponentialHistogramRow) add(value float64, maxSize int) {
+	if value == 0 {
+		v.ZeroCount++
+		return
+	}
+	buckets := &v.Positive
+	if value < 0 {
+		buckets, value = &v.Negative, -value
+	}
+	index := exponentialIndex(value, int(v.Scale))
+	if change := buckets.scaleChange(index, maxSize); change > 0 {
+		v.Scale -= int32(change)
+		v.Positive.downscale(change)
+		v.Negative.downscale(change)
+		index >>= uint(change)
+	}
+	buckets.increment(index)
+}
+
+// scaleChange returns how much the scale must be reduced for the buckets to
+// include index while holding at most maxSize buckets.
+func (b *ExponentialBuckets) scaleChange(index int32, maxSize int) int {
+	if len(b.Counts) == 0 {
+		return 0
+	}
+	low, high := b.Offset, b.Offset+int32(len(b.Counts))-1
+	if index < low {
+		low = index
+	}
+	if index > high {
+		high = index
+	}
+	change := 0
+	for int(high-low) >= maxSize {
+		low >>= 1
+		high >>= 1
+		change++
+	}
+	return change
+}
+
+// downscale merges the buckets into the buckets of a scale that is smaller
+// by change.
+func (b *ExponentialBuckets) downscale(change int) {
+	if len(b.Counts) == 0 || change == 0 {
+		return
+	}
+	offset := b.Offset >> uint(change)
+	last := (b.Offset + int32(len(b.Counts)) - 1) >> uint(change)
+	counts := make([]int64, last-offset+1)
+	for i, c := range b.Counts {
+		counts[(b.Offset+int32(i))>>uint(change)-offset] += c
+	}
+	b.Offset, b.Counts = offset, counts
+}
+
+// increment adds one to the count of the bucket at index, extending the
+// range of buckets to include it.
+func (b *ExponentialBuckets) increment(index int32) {
+	switch {
+	case len(b.Counts) == 0:
+		b.Offset, b.Counts = index, []int64{0}
+	case index < b.Offset:
+		counts := make([]int64, int(b.Offset-index)+len(b.Counts))
+		copy(counts[b.Offset-index:], b.Counts)
+		b.Offset, b.Counts = index, counts
+	case int(index-b.Offset) >= len(b.Counts):
+		b.Counts = append(b.Counts, make([]int64, int(index-b.Offset)-len(b.Counts)+1)...)
+	}
+	b.Counts[index-b.Offset]++
+}
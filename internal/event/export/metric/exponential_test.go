@@ -0,0 +1,135 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// recordExponential records the values in a new exponential histogram and
+// returns its only row.
+func recordExponential(t *testing.T, info metric.ExponentialHistogram, values ...float64) *metric.ExponentialHistogramRow {
+	t.Helper()
+	key := keys.NewFloat64("value", "")
+	var m metric.Config
+	recorder := info.Record(&m, key)
+	var latest *metric.ExponentialHistogramData
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			latest = metric.Entries.Get(lm).([]metric.Data)[0].(*metric.ExponentialHistogramData)
+		}
+		return ctx
+	}))
+	previous := make(map[*metric.ExponentialHistogramRow]metric.ExponentialHistogramRow)
+	for _, v := range values {
+		recorder.Record(ctx, v)
+		// Earlier snapshots must not be changed by later values.
+		for row, want := range previous {
+			if !reflect.DeepEqual(*row, want) {
+				t.Fatalf("recording %v changed an earlier row from %+v to %+v", v, want, *row)
+			}
+		}
+		if len(latest.Rows) > 0 {
+			row := latest.Rows[0]
+			previous[row] = metric.ExponentialHistogramRow{
+				Scale:     row.Scale,
+				ZeroCount: row.ZeroCount,
+				Positive:  metric.ExponentialBuckets{Offset: row.Positive.Offset, Counts: append([]int64(nil), row.Positive.Counts...)},
+				Negative:  metric.ExponentialBuckets{Offset: row.Negative.Offset, Counts: append([]int64(nil), row.Negative.Counts...)},
+				Count:     row.Count,
+				Sum:       row.Sum,
+				Min:       row.Min,
+				Max:       row.Max,
+			}
+		}
+	}
+	if latest == nil || len(latest.Rows) != 1 {
+		t.Fatalf("got %+v, want a single row", latest)
+	}
+	return latest.Rows[0]
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	for _, test := range []struct {
+		scale int
+		value float64
+		want  int32
+	}{
+		// At scale 1 bucket i holds (2^(i/2), 2^((i+1)/2)].
+		{1, 1, -1},
+		{1, 1.4, 0},
+		{1, 1.5, 1},
+		{1, 2, 1},
+		{1, 4, 3},
+		{1, 0.75, -1},
+		{1, 0.5, -3},
+		// At negative scales they are 2^(2^-scale) wide.
+		{-1, 4, 0},
+		{-1, 5, 1},
+		{-1, 0.25, -2},
+		{-2, 16, 0},
+		{-2, 17, 1},
+		{20, 1, -1},
+		{20, math.MaxFloat64, 1024<<20 - 1},
+		{20, math.SmallestNonzeroFloat64, -1074<<20 - 1},
+	} {
+		row := recordExponential(t, metric.ExponentialHistogram{Name: "v", MaxScale: test.scale}, test.value)
+		if row.Scale != int32(test.scale) || row.Positive.Offset != test.want || !reflect.DeepEqual(row.Positive.Counts, []int64{1}) {
+			t.Errorf("%v at scale %d landed at scale %d in %+v, want bucket %d", test.value, test.scale, row.Scale, row.Positive, test.want)
+		}
+	}
+}
+
+func TestExponentialRescale(t *testing.T) {
+	// Values from a microsecond to ten seconds, in milliseconds.
+	values := []float64{0.001, 0.05, 1, 0, 20, 300, 10000, -2, -0.5}
+	row := recordExponential(t, metric.ExponentialHistogram{Name: "latency", MaxSize: 20}, values...)
+	// A factor of 10^7 is about 2^23.3, which needs 24 buckets at scale 0, so
+	// the row must have been reduced to scale -1, with 12 buckets.
+	if row.Scale != -1 {
+		t.Errorf("scale is %d, want -1", row.Scale)
+	}
+	if len(row.Positive.Counts) > 20 || len(row.Negative.Counts) > 20 {
+		t.Errorf("row has %d positive and %d negative buckets, want at most 20", len(row.Positive.Counts), len(row.Negative.Counts))
+	}
+	var positive, negative int64
+	for _, c := range row.Positive.Counts {
+		positive += c
+	}
+	for _, c := range row.Negative.Counts {
+		negative += c
+	}
+	if positive != 6 || negative != 2 || row.ZeroCount != 1 || row.Count != 9 {
+		t.Errorf("got %d positive, %d negative, %d zero and %d in total, want 6, 2, 1 and 9", positive, negative, row.ZeroCount, row.Count)
+	}
+	if row.Min != -2 || row.Max != 10000 {
+		t.Errorf("got min %v and max %v, want -2 and 10000", row.Min, row.Max)
+	}
+	// Every value must still be in the bucket its index maps to at the final scale.
+	base := math.Pow(2, math.Pow(2, -float64(row.Scale)))
+	for _, v := range values {
+		if v <= 0 {
+			continue
+		}
+		i := int(row.Positive.Offset)
+		for ; i < int(row.Positive.Offset)+len(row.Positive.Counts); i++ {
+			if v <= math.Pow(base, float64(i+1)) {
+				break
+			}
+		}
+		if row.Positive.Counts[i-int(row.Positive.Offset)] == 0 {
+			t.Errorf("bucket %d, which should hold %v, is empty", i, v)
+		}
+	}
+}
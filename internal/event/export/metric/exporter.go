@@ -19,12 +19,28 @@ import (
 var Entries = keys.New("metric_entries", "The set of metrics calculated for an event")
 
 type Config struct {
+	// mu guards the state of the metrics, which all the exporters of the
+	// configuration share.
+	mu          sync.Mutex
 	subscribers map[interface{}][]subscriber
+	views       []View
+	// limit is the cardinality limit set by SetCardinalityLimit.
+	limit int
+	// metrics holds the state of every metric created on the configuration,
+	// in the order they were created.
+	metrics []state
 }
 
 type subscriber func(time.Time, label.Map, label.Label) Data
 
 func (e *Config) subscribe(key label.Key, s subscriber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribeLocked(key, s)
+}
+
+// subscribeLocked is subscribe for callers that hold the lock.
+func (e *Config) subscribeLocked(key label.Key, s subscriber) {
 	if e.subscribers == nil {
 		e.subscribers = make(map[interface{}][]subscriber)
 	}
@@ -32,13 +48,14 @@ func (e *Config) subscribe(key label.Key, s subscriber) {
 }
 
 func (e *Config) Exporter(output event.Exporter) event.Exporter {
-	var mu sync.Mutex
+	warned := &overflowWarnings{}
 	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
 		if !event.IsMetric(ev) {
 			return output(ctx, ev, lm)
 		}
-		mu.Lock()
-		defer mu.Unlock()
+		// Only the subscribers need the lock, the data they return is frozen,
+		// and output may well come back to the configuration.
+		e.mu.Lock()
 		var metrics []Data
 		for index := 0; ev.Valid(index); index++ {
 			l := ev.Label(index)
@@ -52,7 +69,10 @@ func (e *Config) Exporter(output event.Exporter) event.Exporter {
 				}
 			}
 		}
+		e.mu.Unlock()
 		lm = label.MergeMaps(label.NewMap(Entries.Of(metrics)), lm)
-		return output(ctx, ev, lm)
+		ctx = output(ctx, ev, lm)
+		warned.warn(ctx, metrics)
+		return ctx
 	}
 }
@@ -0,0 +1,103 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+// maxExtremes is the most values an extremes list keeps. The lists of random
+// values stay far shorter, as they only grow with each new minimum or maximum
+// of the values since some point in time.
+const maxExtremes = 64
+
+// extreme is a value recorded by a histogram row, and how many values the row
+// had recorded, including it, at the time.
+type extreme struct {
+	n     int64
+	value float64
+}
+
+// extremes holds what is needed to find the smallest and largest of the values
+// a histogram row recorded after any earlier count, so that Deltas can report
+// the Min and Max of each interval rather than of the lifetime of the row.
+// Counts, unlike times, tell apart values recorded in the same clock tick.
+// It is shared by the frozen copies of the row, so it is never modified.
+type extremes struct {
+	// minima holds, oldest first, every value smaller than all the values
+	// recorded after it, so the first one recorded after a count is the
+	// smallest since then. maxima does the same for the largest values.
+	minima, maxima []extreme
+	// since is the count of the latest value discarded to keep the lists
+	// short, they are only complete for the values after it.
+	since int64
+}
+
+// withExtreme returns the extremes of the rows of a histogram after the row at
+// index, which is a new row if insert is true, recorded its nth value.
+func withExtreme(rows []*extremes, index int, insert bool, n int64, value float64) []*extremes {
+	var result []*extremes
+	var x extremes
+	if insert {
+		result = make([]*extremes, len(rows)+1)
+		copy(result, rows[:index])
+		copy(result[index+1:], rows[index:])
+	} else {
+		result = make([]*extremes, len(rows))
+		copy(result, rows)
+		if old := result[index]; old != nil {
+			x = *old
+		}
+	}
+	var dropped int64
+	x.minima, dropped = addExtreme(x.minima, n, value, func(a, b float64) bool { return a < b })
+	if dropped > x.since {
+		x.since = dropped
+	}
+	x.maxima, dropped = addExtreme(x.maxima, n, value, func(a, b float64) bool { return a > b })
+	if dropped > x.since {
+		x.since = dropped
+	}
+	result[index] = &x
+	return result
+}
+
+// addExtreme returns a new list after recording the nth value, removing the
+// values that are no longer better than all the later ones by the ordering.
+// If the list is full its oldest value is discarded, and its count returned.
+func addExtreme(list []extreme, n int64, value float64, better func(a, b float64) bool) ([]extreme, int64) {
+	end := len(list)
+	for end > 0 && !better(list[end-1].value, value) {
+		end--
+	}
+	var dropped int64
+	start := 0
+	if end >= maxExtremes {
+		start = end - maxExtremes + 1
+		dropped = list[start-1].n
+	}
+	result := make([]extreme, end-start, end-start+1)
+	copy(result, list[start:end])
+	return append(result, extreme{n: n, value: value}), dropped
+}
+
+// after returns the smallest and largest of the values recorded after the
+// row had recorded count values, and whether they are known.
+func (x *extremes) after(count int64) (min, max float64, ok bool) {
+	if x == nil || count < x.since {
+		return 0, 0, false
+	}
+	minimum, ok := firstAfter(x.minima, count)
+	if !ok {
+		return 0, 0, false
+	}
+	maximum, _ := firstAfter(x.maxima, count)
+	return minimum, maximum, true
+}
+
+func firstAfter(list []extreme, count int64) (float64, bool) {
+	for _, e := range list {
+		if e.n > count {
+			return e.value, true
+		}
+	}
+	return 0, false
+}
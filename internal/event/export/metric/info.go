@@ -5,6 +5,12 @@
 package metric
 
 import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
 	"golang.org/x/tools/internal/event/keys"
 	"golang.org/x/tools/internal/event/label"
 )
@@ -15,8 +21,15 @@ type Scalar struct {
 	Name string
 	// Description can be used by observers to describe the metric to users.
 	Description string
+	// Unit is the unit of the values of the metric, such as UnitMilliseconds
+	// or UnitBytes, so that exporters can convey it. Empty if unknown.
+	Unit string
 	// Keys is the set of labels that collectively describe rows of the metric.
 	Keys []label.Key
+	// CardinalityLimit is the most rows the metric has, further rows are
+	// combined into a single row labelled with Overflow. Zero selects the
+	// limit of the Config, and a negative limit removes it.
+	CardinalityLimit int
 }
 
 // HistogramInt64 represents the construction information for an int64 histogram metric.
@@ -25,9 +38,17 @@ type HistogramInt64 struct {
 	Name string
 	// Description can be used by observers to describe the metric to users.
 	Description string
+	// Unit is the unit of the values of the metric, such as UnitMilliseconds
+	// or UnitBytes, so that exporters can convey it. Empty if unknown.
+	Unit string
 	// Keys is the set of labels that collectively describe rows of the metric.
 	Keys []label.Key
+	// CardinalityLimit is the most rows the metric has, further rows are
+	// combined into a single row labelled with Overflow. Zero selects the
+	// limit of the Config, and a negative limit removes it.
+	CardinalityLimit int
 	// Buckets holds the inclusive upper bound of each bucket in the histogram.
+	// They may be given in any order, duplicates are ignored.
 	Buckets []int64
 }
 
@@ -37,64 +58,364 @@ type HistogramFloat64 struct {
 	Name string
 	// Description can be used by observers to describe the metric to users.
 	Description string
+	// Unit is the unit of the values of the metric, such as UnitMilliseconds
+	// or UnitBytes, so that exporters can convey it. Empty if unknown.
+	Unit string
 	// Keys is the set of labels that collectively describe rows of the metric.
 	Keys []label.Key
+	// CardinalityLimit is the most rows the metric has, further rows are
+	// combined into a single row labelled with Overflow. Zero selects the
+	// limit of the Config, and a negative limit removes it.
+	CardinalityLimit int
 	// Buckets holds the inclusive upper bound of each bucket in the histogram.
+	// They may be given in any order, duplicates are ignored.
 	Buckets []float64
 }
 
+// ExponentialHistogram represents the construction information for a float64
+// histogram whose buckets grow exponentially, so that it needs no bucket
+// list to capture values of very different magnitudes.
+// Bucket i holds the values in (base^i, base^(i+1)], where base is
+// 2^(2^-scale). Each row starts at MaxScale, and its scale is reduced
+// whenever the values it has seen would need more than MaxSize buckets.
+type ExponentialHistogram struct {
+	// Name is the unique name of this metric.
+	Name string
+	// Description can be used by observers to describe the metric to users.
+	Description string
+	// Unit is the unit of the values of the metric, such as UnitMilliseconds
+	// or UnitBytes, so that exporters can convey it. Empty if unknown.
+	Unit string
+	// Keys is the set of labels that collectively describe rows of the metric.
+	Keys []label.Key
+	// CardinalityLimit is the most rows the metric has, further rows are
+	// combined into a single row labelled with Overflow. Zero selects the
+	// limit of the Config, and a negative limit removes it.
+	CardinalityLimit int
+	// MaxScale is the scale rows start at, between MinExponentialScale and
+	// MaxExponentialScale. Zero selects MaxExponentialScale, rows only reach
+	// a scale of zero by being rescaled.
+	MaxScale int
+	// MaxSize is the most buckets used for the positive values, and
+	// separately for the negative values, of a row.
+	// It defaults to DefaultExponentialSize, and is at least 2.
+	MaxSize int
+}
+
+// Summary represents the construction information for a metric that reports
+// quantiles of the values recorded over a recent window of time.
+type Summary struct {
+	// Name is the unique name of this metric.
+	Name string
+	// Description can be used by observers to describe the metric to users.
+	Description string
+	// Unit is the unit of the values of the metric, such as UnitMilliseconds
+	// or UnitBytes, so that exporters can convey it. Empty if unknown.
+	Unit string
+	// Keys is the set of labels that collectively describe rows of the metric.
+	Keys []label.Key
+	// CardinalityLimit is the most rows the metric has, further rows are
+	// combined into a single row labelled with Overflow. Zero selects the
+	// limit of the Config, and a negative limit removes it.
+	CardinalityLimit int
+	// Objectives maps each quantile to report, between 0 and 1 exclusive,
+	// to the error allowed in its rank. For example 0.99: 0.001 reports a
+	// value that lies between the 98.9th and the 99.1th percentiles.
+	// It defaults to DefaultObjectives.
+	Objectives map[float64]float64
+	// Window is how long a value contributes to the quantiles, it defaults
+	// to DefaultSummaryWindow.
+	Window time.Duration
+}
+
 // Count creates a new metric based on the Scalar information that counts
 // the number of times the supplied int64 measure is set.
 // Metrics of this type will use Int64Data.
 func (info Scalar) Count(e *Config, key label.Key) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
 	data := &Int64Data{Info: &info, key: nil}
 	e.subscribe(key, data.count)
+	e.track(data)
 }
 
 // SumInt64 creates a new metric based on the Scalar information that sums all
 // the values recorded on the int64 measure.
 // Metrics of this type will use Int64Data.
 func (info Scalar) SumInt64(e *Config, key *keys.Int64) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
 	data := &Int64Data{Info: &info, key: key}
 	e.subscribe(key, data.sum)
+	e.track(data)
 }
 
 // LatestInt64 creates a new metric based on the Scalar information that tracks
 // the most recent value recorded on the int64 measure.
 // Metrics of this type will use Int64Data.
 func (info Scalar) LatestInt64(e *Config, key *keys.Int64) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
 	data := &Int64Data{Info: &info, IsGauge: true, key: key}
 	e.subscribe(key, data.latest)
+	e.track(data)
+}
+
+// UpDownInt64 creates a new metric based on the Scalar information that sums
+// all the values recorded on the int64 measure, which may be negative.
+// Metrics of this type will use Int64Data, with IsUpDown set.
+func (info Scalar) UpDownInt64(e *Config, key *keys.Int64) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
+	data := &Int64Data{Info: &info, IsUpDown: true, key: key}
+	e.subscribe(key, data.sum)
+	e.track(data)
 }
 
 // SumFloat64 creates a new metric based on the Scalar information that sums all
 // the values recorded on the float64 measure.
 // Metrics of this type will use Float64Data.
 func (info Scalar) SumFloat64(e *Config, key *keys.Float64) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
 	data := &Float64Data{Info: &info, key: key}
 	e.subscribe(key, data.sum)
+	e.track(data)
+}
+
+// UpDownFloat64 creates a new metric based on the Scalar information that
+// sums all the values recorded on the float64 measure, which may be negative.
+// Metrics of this type will use Float64Data, with IsUpDown set.
+func (info Scalar) UpDownFloat64(e *Config, key *keys.Float64) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
+	data := &Float64Data{Info: &info, IsUpDown: true, key: key}
+	e.subscribe(key, data.sum)
+	e.track(data)
 }
 
 // LatestFloat64 creates a new metric based on the Scalar information that tracks
 // the most recent value recorded on the float64 measure.
 // Metrics of this type will use Float64Data.
 func (info Scalar) LatestFloat64(e *Config, key *keys.Float64) {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return
+	}
+	data := &Float64Data{Info: &info, IsGauge: true, key: key}
+	e.subscribe(key, data.latest)
+	e.track(data)
+}
+
+// GaugeInt64 creates a new metric based on the Scalar information that tracks
+// a value that is set, or moved up and down, with the returned Int64Gauge.
+// Setting the measure by any other metric event also sets the gauge.
+// Metrics of this type will use Int64Data.
+func (info Scalar) GaugeInt64(e *Config, key *keys.Int64) Int64Gauge {
+	g := Int64Gauge{key: key, delta: int64Delta(key)}
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return g
+	}
+	data := &Int64Data{Info: &info, IsGauge: true, key: key}
+	e.subscribe(key, data.latest)
+	e.track(data)
+	// sum reads the value of the delta label, as it is also an int64.
+	e.subscribe(g.delta, data.sum)
+	return g
+}
+
+// GaugeFloat64 creates a new metric based on the Scalar information that
+// tracks a value that is set, or moved up and down, with the returned
+// Float64Gauge.
+// Setting the measure by any other metric event also sets the gauge.
+// Metrics of this type will use Float64Data.
+func (info Scalar) GaugeFloat64(e *Config, key *keys.Float64) Float64Gauge {
+	g := Float64Gauge{key: key, delta: float64Delta(key)}
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return g
+	}
 	data := &Float64Data{Info: &info, IsGauge: true, key: key}
 	e.subscribe(key, data.latest)
+	e.track(data)
+	// sum reads the value of the delta label, as it is also a float64.
+	e.subscribe(g.delta, data.sum)
+	return g
 }
 
 // Record creates a new metric based on the HistogramInt64 information that
 // tracks the bucketized counts of values recorded on the int64 measure.
 // Metrics of this type will use HistogramInt64Data.
-func (info HistogramInt64) Record(e *Config, key *keys.Int64) {
+// Values can be recorded with the returned Int64Recorder, or by any metric
+// event that carries the measure.
+func (info HistogramInt64) Record(e *Config, key *keys.Int64) Int64Recorder {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return Int64Recorder{key: key}
+	}
+	buckets := append([]int64(nil), info.Buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	info.Buckets = buckets[:0]
+	for i, b := range buckets {
+		if i == 0 || b != buckets[i-1] {
+			info.Buckets = append(info.Buckets, b)
+		}
+	}
 	data := &HistogramInt64Data{Info: &info, key: key}
 	e.subscribe(key, data.record)
+	e.track(data)
+	return Int64Recorder{key: key}
 }
 
 // Record creates a new metric based on the HistogramFloat64 information that
 // tracks the bucketized counts of values recorded on the float64 measure.
 // Metrics of this type will use HistogramFloat64Data.
-func (info HistogramFloat64) Record(e *Config, key *keys.Float64) {
+// Values can be recorded with the returned Float64Recorder, or by any metric
+// event that carries the measure.
+func (info HistogramFloat64) Record(e *Config, key *keys.Float64) Float64Recorder {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return Float64Recorder{key: key}
+	}
+	info.Buckets = float64Buckets(info.Buckets)
 	data := &HistogramFloat64Data{Info: &info, key: key}
 	e.subscribe(key, data.record)
+	e.track(data)
+	return Float64Recorder{key: key}
+}
+
+// Record creates a new metric based on the ExponentialHistogram information
+// that tracks the distribution of values recorded on the float64 measure.
+// Metrics of this type will use ExponentialHistogramData.
+// Values can be recorded with the returned Float64Recorder, or by any metric
+// event that carries the measure.
+func (info ExponentialHistogram) Record(e *Config, key *keys.Float64) Float64Recorder {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return Float64Recorder{key: key}
+	}
+	switch {
+	case info.MaxScale == 0:
+		info.MaxScale = MaxExponentialScale
+	case info.MaxScale > MaxExponentialScale:
+		info.MaxScale = MaxExponentialScale
+	case info.MaxScale < MinExponentialScale:
+		info.MaxScale = MinExponentialScale
+	}
+	if info.MaxSize == 0 {
+		info.MaxSize = DefaultExponentialSize
+	} else if info.MaxSize < 2 {
+		info.MaxSize = 2
+	}
+	data := &ExponentialHistogramData{Info: &info, key: key}
+	e.subscribe(key, data.record)
+	e.track(data)
+	return Float64Recorder{key: key}
+}
+
+// Record creates a new metric based on the Summary information that tracks
+// quantiles of the values recorded on the float64 measure.
+// Metrics of this type will use Float64Data, holding a gauge for each
+// quantile of each row, with the quantile in its Quantile label.
+// Values can be recorded with the returned Float64Recorder, or by any metric
+// event that carries the measure.
+func (info Summary) Record(e *Config, key *keys.Float64) Float64Recorder {
+	if e.override(&info.Name, &info.Description, &info.Unit, &info.Keys, &info.CardinalityLimit, key) {
+		return Float64Recorder{key: key}
+	}
+	s := newSummary(info, key)
+	e.subscribe(key, s.record)
+	e.track(s)
+	return Float64Recorder{key: key}
+}
+
+// Int64Recorder records values on the measure of an int64 histogram.
+type Int64Recorder struct {
+	key *keys.Int64
+}
+
+// Record emits a metric event for the value, the labels select the row of
+// the histogram it is counted in.
+func (r Int64Recorder) Record(ctx context.Context, value int64, labels ...label.Label) {
+	event.Metric(ctx, append(labels, r.key.Of(value))...)
+}
+
+// Float64Recorder records values on the measure of a float64 histogram.
+type Float64Recorder struct {
+	key *keys.Float64
+}
+
+// Record emits a metric event for the value, the labels select the row of
+// the histogram it is counted in.
+func (r Float64Recorder) Record(ctx context.Context, value float64, labels ...label.Label) {
+	event.Metric(ctx, append(labels, r.key.Of(value))...)
+}
+
+// deltaKeys holds the key that the gauges of each measure carry their
+// changes in, so that the gauges of a measure registered on several Configs
+// all move together.
+var (
+	deltaKeysMu sync.Mutex
+	deltaKeys   = make(map[label.Key]label.Key)
+)
+
+// int64Delta returns the key that carries changes to gauges of key.
+func int64Delta(key *keys.Int64) *keys.Int64 {
+	deltaKeysMu.Lock()
+	defer deltaKeysMu.Unlock()
+	if delta, ok := deltaKeys[key]; ok {
+		return delta.(*keys.Int64)
+	}
+	delta := keys.NewInt64(key.Name()+"_delta", "The change in "+key.Name())
+	deltaKeys[key] = delta
+	return delta
+}
+
+// float64Delta returns the key that carries changes to gauges of key.
+func float64Delta(key *keys.Float64) *keys.Float64 {
+	deltaKeysMu.Lock()
+	defer deltaKeysMu.Unlock()
+	if delta, ok := deltaKeys[key]; ok {
+		return delta.(*keys.Float64)
+	}
+	delta := keys.NewFloat64(key.Name()+"_delta", "The change in "+key.Name())
+	deltaKeys[key] = delta
+	return delta
+}
+
+// Int64Gauge sets and adjusts the value of an int64 gauge.
+type Int64Gauge struct {
+	key, delta *keys.Int64
+}
+
+// Set emits a metric event that replaces the value of the gauge, the labels
+// select the row that is set.
+func (g Int64Gauge) Set(ctx context.Context, value int64, labels ...label.Label) {
+	event.Metric(ctx, append(labels, g.key.Of(value))...)
+}
+
+// Add emits a metric event that adds delta, which may be negative, to the
+// value of the gauge, the labels select the row that is changed.
+// Rows that have not been set start at zero.
+func (g Int64Gauge) Add(ctx context.Context, delta int64, labels ...label.Label) {
+	event.Metric(ctx, append(labels, g.delta.Of(delta))...)
+}
+
+// Float64Gauge sets and adjusts the value of a float64 gauge.
+type Float64Gauge struct {
+	key, delta *keys.Float64
+}
+
+// Set emits a metric event that replaces the value of the gauge, the labels
+// select the row that is set.
+func (g Float64Gauge) Set(ctx context.Context, value float64, labels ...label.Label) {
+	event.Metric(ctx, append(labels, g.key.Of(value))...)
+}
+
+// Add emits a metric event that adds delta, which may be negative, to the
+// value of the gauge, the labels select the row that is changed.
+// Rows that have not been set start at zero.
+func (g Float64Gauge) Add(ctx context.Context, delta float64, labels ...label.Label) {
+	event.Metric(ctx, append(labels, g.delta.Of(delta))...)
 }
@@ -0,0 +1,129 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestHistogramRecorder(t *testing.T) {
+	method := keys.NewString("method", "")
+	size := keys.NewInt64("size", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	sizes := metric.HistogramInt64{Name: "size", Keys: []label.Key{method}, Buckets: []int64{100, 10, 100, 1000}}.Record(&m, size)
+	latencies := metric.HistogramFloat64{Name: "latency", Buckets: []float64{5, 0.5}}.Record(&m, latency)
+
+	latest := make(map[string]metric.Data)
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+				latest[data.Handle()] = data
+			}
+		}
+		return ctx
+	}))
+	sizes.Record(ctx, 50, method.Of("hover"))
+	sizes.Record(ctx, 2000, method.Of("hover"))
+	sizes.Record(ctx, 5, method.Of("definition"))
+	latencies.Record(ctx, 0.25)
+	latencies.Record(ctx, 1.5)
+
+	s := latest["size"].(*metric.HistogramInt64Data)
+	if want := []int64{10, 100, 1000}; !reflect.DeepEqual(s.Info.Buckets, want) {
+		t.Errorf("size buckets are %v, want %v", s.Info.Buckets, want)
+	}
+	// Rows are ordered by their labels.
+	for i, want := range []metric.HistogramInt64Row{
+		{Values: []int64{1, 1, 1}, Count: 1, Sum: 5, Min: 5, Max: 5},
+		{Values: []int64{0, 1, 1}, Count: 2, Sum: 2050, Min: 50, Max: 2000},
+	} {
+		if got := *s.Rows[i]; !reflect.DeepEqual(got, want) {
+			t.Errorf("size row %v is %+v, want %+v", s.Groups()[i], got, want)
+		}
+	}
+
+	l := latest["latency"].(*metric.HistogramFloat64Data)
+	want := metric.HistogramFloat64Row{Values: []int64{1, 2}, Count: 2, Sum: 1.75, Min: 0.25, Max: 1.5}
+	if !reflect.DeepEqual(l.Info.Buckets, []float64{0.5, 5}) || !reflect.DeepEqual(*l.Rows[0], want) {
+		t.Errorf("latency has buckets %v and row %+v, want %+v", l.Info.Buckets, *l.Rows[0], want)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	kind := keys.NewString("kind", "")
+	open := keys.NewInt64("open", "")
+	memory := keys.NewFloat64("memory", "")
+	var m metric.Config
+	files := metric.Scalar{Name: "open", Keys: []label.Key{kind}}.GaugeInt64(&m, open)
+	heap := metric.Scalar{Name: "memory"}.GaugeFloat64(&m, memory)
+
+	latest := make(map[string]metric.Data)
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+				latest[data.Handle()] = data
+			}
+		}
+		return ctx
+	}))
+	files.Set(ctx, 3, kind.Of("file"))
+	files.Add(ctx, 2, kind.Of("file"))
+	files.Add(ctx, -1, kind.Of("file"))
+	files.Add(ctx, -2, kind.Of("dir"))
+	heap.Add(ctx, 1.5)
+	heap.Set(ctx, 10)
+	heap.Add(ctx, -0.25)
+	// Other metric events on the measure also set the gauge.
+	event.Metric(ctx, kind.Of("file"), open.Of(7))
+
+	f := latest["open"].(*metric.Int64Data)
+	if want := []int64{-2, 7}; !f.IsGauge || !reflect.DeepEqual(f.Rows, want) {
+		t.Errorf("open is %v for %v, want a gauge of %v", f.Rows, f.Groups(), want)
+	}
+	h := latest["memory"].(*metric.Float64Data)
+	if want := []float64{9.75}; !h.IsGauge || !reflect.DeepEqual(h.Rows, want) {
+		t.Errorf("memory is %v, want a gauge of %v", h.Rows, want)
+	}
+}
+
+func TestGaugeOnTwoConfigs(t *testing.T) {
+	open := keys.NewInt64("open", "")
+	var a, b metric.Config
+	fromA := metric.Scalar{Name: "open"}.GaugeInt64(&a, open)
+	fromB := metric.Scalar{Name: "open"}.GaugeInt64(&b, open)
+
+	latest := make(map[*metric.Config]metric.Data)
+	record := func(m *metric.Config) event.Exporter {
+		return m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsMetric(ev) {
+				latest[m] = metric.Entries.Get(lm).([]metric.Data)[0]
+			}
+			return ctx
+		})
+	}
+	toA, toB := record(&a), record(&b)
+	ctx := event.WithExporter(context.Background(), func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		toA(ctx, ev, lm)
+		return toB(ctx, ev, lm)
+	})
+	fromA.Set(ctx, 3)
+	fromA.Add(ctx, 2)
+	fromB.Add(ctx, -1)
+
+	for m, name := range map[*metric.Config]string{&a: "first", &b: "second"} {
+		if got := latest[m].(*metric.Int64Data).Rows; !reflect.DeepEqual(got, []int64{4}) {
+			t.Errorf("gauge on the %s config is %v, want [4]", name, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// observers holds the callbacks of the observable metrics of the process, in
+// the order they were first registered.
+var observers struct {
+	mu     sync.Mutex
+	keys   []label.Key
+	values map[label.Key]func() label.Label
+}
+
+// observe registers the callback that reads the value of key, replacing any
+// callback already registered for it, so that building a new Config with the
+// same metrics does not call both.
+func observe(key label.Key, f func() label.Label) {
+	observers.mu.Lock()
+	defer observers.mu.Unlock()
+	if observers.values == nil {
+		observers.values = make(map[label.Key]func() label.Label)
+	}
+	if _, seen := observers.values[key]; !seen {
+		observers.keys = append(observers.keys, key)
+	}
+	observers.values[key] = f
+}
+
+// ObservableInt64 creates a new metric based on the Scalar information whose
+// value is read by calling f at collection time, rather than recorded by
+// metric events, for values such as the size of a cache that are cheap to read
+// but would have to be recorded wherever they change.
+// Metrics of this type will use Int64Data, like LatestInt64.
+func (info Scalar) ObservableInt64(e *Config, key *keys.Int64, f func() int64) {
+	info.LatestInt64(e, key)
+	observe(key, func() label.Label { return key.Of(f()) })
+}
+
+// ObservableFloat64 creates a new metric based on the Scalar information whose
+// value is read by calling f at collection time.
+// Metrics of this type will use Float64Data, like LatestFloat64.
+func (info Scalar) ObservableFloat64(e *Config, key *keys.Float64, f func() float64) {
+	info.LatestFloat64(e, key)
+	observe(key, func() label.Label { return key.Of(f()) })
+}
+
+// Collect calls the callback of every observable metric, and emits their
+// values in a single metric event on ctx.
+// Exporters that read or push metrics at intervals call it first, so that the
+// values are current; it must not be called while holding a lock that the
+// exporter of ctx also takes.
+func Collect(ctx context.Context) {
+	if !event.EnabledContext(ctx) {
+		return
+	}
+	observers.mu.Lock()
+	callbacks := make([]func() label.Label, len(observers.keys))
+	for i, key := range observers.keys {
+		callbacks[i] = observers.values[key]
+	}
+	observers.mu.Unlock()
+	if len(callbacks) == 0 {
+		return
+	}
+	// The callbacks are called without the lock held, so that they may
+	// register observable metrics themselves.
+	labels := make([]label.Label, len(callbacks))
+	for i, f := range callbacks {
+		labels[i] = f()
+	}
+	event.Metric(ctx, labels...)
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestObservable(t *testing.T) {
+	size := keys.NewInt64("observable_size", "")
+	ratio := keys.NewFloat64("observable_ratio", "")
+	var m metric.Config
+	cache := []string{"a", "b"}
+	calls := 0
+	metric.Scalar{Name: "cache_size"}.ObservableInt64(&m, size, func() int64 {
+		calls++
+		return int64(len(cache))
+	})
+	metric.Scalar{Name: "cache_ratio"}.ObservableFloat64(&m, ratio, func() float64 {
+		return float64(len(cache)) / 4
+	})
+
+	latest := make(map[string]metric.Data)
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+				latest[data.Handle()] = data
+			}
+		}
+		return ctx
+	}))
+
+	// Nothing is read until the metrics are collected.
+	if calls != 0 || len(latest) != 0 {
+		t.Fatalf("callback called %d times before collection, got metrics %v", calls, latest)
+	}
+	metric.Collect(ctx)
+	cache = append(cache, "c")
+	metric.Collect(ctx)
+	if calls != 2 {
+		t.Errorf("callback called %d times, want 2", calls)
+	}
+	if got := latest["cache_size"].(*metric.Int64Data).Rows; len(got) != 1 || got[0] != 3 {
+		t.Errorf("got size rows %v, want [3]", got)
+	}
+	if got := latest["cache_ratio"].(*metric.Float64Data).Rows; len(got) != 1 || got[0] != 0.75 {
+		t.Errorf("got ratio rows %v, want [0.75]", got)
+	}
+
+	// Registering the metric again, as a new Config would, replaces the
+	// callback.
+	var m2 metric.Config
+	metric.Scalar{Name: "cache_size"}.ObservableInt64(&m2, size, func() int64 { return 10 })
+	metric.Collect(ctx)
+	if calls != 2 {
+		t.Errorf("replaced callback was called, %d calls", calls)
+	}
+	if got := latest["cache_size"].(*metric.Int64Data).Rows; len(got) != 1 || got[0] != 10 {
+		t.Errorf("got size rows %v, want [10]", got)
+	}
+}
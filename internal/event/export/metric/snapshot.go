@@ -0,0 +1,122 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"time"
+
+	"golang.org/x/tools/internal/event/core"
+)
+
+// state is the state of a metric created on a Config.
+type state interface {
+	// snapshot returns a frozen copy of the current data of the metric.
+	snapshot() Data
+	// reset discards every row of the metric, it starts again from nothing
+	// at the given time.
+	reset(at time.Time)
+}
+
+// track adds the state of a new metric to the configuration.
+func (e *Config) track(s state) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.trackLocked(s)
+}
+
+// trackLocked is track for callers that hold the lock.
+func (e *Config) trackLocked(s state) {
+	e.metrics = append(e.metrics, s)
+}
+
+// Snapshot returns the current data of every metric created on the
+// configuration, in the order they were created, including the metrics that
+// have not recorded anything yet.
+// The data is not changed by later events, so it can be inspected at leisure
+// by the debug pages and tests.
+func (e *Config) Snapshot() []Data {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make([]Data, len(e.metrics))
+	for i, s := range e.metrics {
+		result[i] = s.snapshot()
+	}
+	return result
+}
+
+// Reset discards every row of every metric created on the configuration, for
+// instance when a new session starts and the totals of the previous one are
+// no longer of interest.
+// The data of the metrics from then on has the time of the reset as its
+// StartTime, so that cumulative exporters can report that their totals
+// started again, and Deltas converts it whole rather than subtracting the
+// totals from before the reset.
+func (e *Config) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	at := core.Now()
+	for _, s := range e.metrics {
+		s.reset(at)
+	}
+}
+
+func (data *Int64Data) snapshot() Data {
+	frozen := *data
+	return &frozen
+}
+
+func (data *Int64Data) reset(at time.Time) {
+	data.Rows, data.groups = nil, nil
+	data.StartTime, data.EndTime = at, at
+}
+
+func (data *Float64Data) snapshot() Data {
+	frozen := *data
+	return &frozen
+}
+
+func (data *Float64Data) reset(at time.Time) {
+	data.Rows, data.groups = nil, nil
+	data.StartTime, data.EndTime = at, at
+}
+
+func (data *HistogramInt64Data) snapshot() Data {
+	frozen := *data
+	return &frozen
+}
+
+func (data *HistogramInt64Data) reset(at time.Time) {
+	data.Rows, data.groups, data.extremes = nil, nil, nil
+	data.StartTime, data.EndTime = at, at
+}
+
+func (data *HistogramFloat64Data) snapshot() Data {
+	frozen := *data
+	return &frozen
+}
+
+func (data *HistogramFloat64Data) reset(at time.Time) {
+	data.Rows, data.groups, data.extremes = nil, nil, nil
+	data.StartTime, data.EndTime = at, at
+}
+
+func (data *ExponentialHistogramData) snapshot() Data {
+	frozen := *data
+	return &frozen
+}
+
+func (data *ExponentialHistogramData) reset(at time.Time) {
+	data.Rows, data.groups, data.extremes = nil, nil, nil
+	data.StartTime, data.EndTime = at, at
+}
+
+func (s *summary) snapshot() Data {
+	return s.data()
+}
+
+func (s *summary) reset(at time.Time) {
+	s.groups, s.rows = nil, nil
+	s.start, s.end = at, at
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestSnapshotAndReset(t *testing.T) {
+	calls := keys.NewInt64("snapshot_calls", "")
+	latency := keys.NewFloat64("snapshot_latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "calls"}.SumInt64(&m, calls)
+	metric.HistogramFloat64{Name: "latency", Buckets: []float64{10}}.Record(&m, latency)
+	metric.Summary{Name: "latency_quantiles"}.Record(&m, latency)
+	ctx, all := snapshots(&m)
+
+	// Metrics that have recorded nothing are included.
+	if got := m.Snapshot(); len(got) != 3 || len(got[0].Groups()) != 0 {
+		t.Fatalf("got initial snapshot %v, want three empty metrics", got)
+	}
+	event.Metric(ctx, calls.Of(2), latency.Of(5))
+	event.Metric(ctx, calls.Of(3))
+	before := m.Snapshot()
+	if c := before[0].(*metric.Int64Data); !reflect.DeepEqual(c.Rows, []int64{5}) {
+		t.Errorf("got calls %v, want [5]", c.Rows)
+	}
+	if h := before[1].(*metric.HistogramFloat64Data); h.Rows[0].Count != 1 {
+		t.Errorf("got latency count %d, want 1", h.Rows[0].Count)
+	}
+	if s := before[2].(*metric.Float64Data); len(s.Rows) != len(metric.DefaultObjectives) {
+		t.Errorf("got %d quantiles, want %d", len(s.Rows), len(metric.DefaultObjectives))
+	}
+
+	var d metric.Deltas
+	d.Convert((*all)[len(*all)-1:])
+	at := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	event.SetClock(fixedClock(at))
+	defer event.SetClock(nil)
+	m.Reset()
+	for _, data := range m.Snapshot() {
+		if len(data.Groups()) != 0 {
+			t.Errorf("%s has rows %v after the reset", data.Handle(), data.Groups())
+		}
+	}
+	// The earlier snapshot is not changed by the reset.
+	if c := before[0].(*metric.Int64Data); !reflect.DeepEqual(c.Rows, []int64{5}) {
+		t.Errorf("got calls %v in the earlier snapshot, want [5]", c.Rows)
+	}
+
+	// The totals start again from the reset, and are not subtracted from
+	// those before it.
+	event.Metric(ctx, calls.Of(1))
+	c := d.Convert((*all)[len(*all)-1:])[0].(*metric.Int64Data)
+	if !c.StartTime.Equal(at) || !reflect.DeepEqual(c.Rows, []int64{1}) {
+		t.Errorf("got calls %v starting at %v after the reset, want [1] starting at %v", c.Rows, c.StartTime, at)
+	}
+}
+
+func TestSnapshotFromOutput(t *testing.T) {
+	calls := keys.NewInt64("snapshot_calls", "")
+	var m metric.Config
+	metric.Scalar{Name: "calls"}.SumInt64(&m, calls)
+	var got []metric.Data
+	// An exporter fed by the configuration may read it back.
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		got = m.Snapshot()
+		return ctx
+	}))
+	event.Metric(ctx, calls.Of(2))
+	if len(got) != 1 || !reflect.DeepEqual(got[0].(*metric.Int64Data).Rows, []int64{2}) {
+		t.Errorf("got snapshot %v from the output, want calls of [2]", got)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Quantile is the label that distinguishes the quantiles of a summary.
+var Quantile = keys.NewFloat64("quantile", "The quantile of a summary.")
+
+// DefaultObjectives are the quantiles a summary reports if none are
+// configured: the median, and the 90th and 99th percentiles.
+var DefaultObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// DefaultSummaryWindow is how long values contribute to a summary if no
+// window is configured.
+const DefaultSummaryWindow = 10 * time.Minute
+
+// summaryAges is the number of streams a window is divided into. Each stream
+// is started window/summaryAges after the previous one, so the quantiles
+// always cover between (summaryAges-1)/summaryAges of the window and all of
+// it.
+const summaryAges = 5
+
+// objective is a quantile, and the error allowed in its rank.
+type objective struct {
+	quantile, error float64
+}
+
+// summary holds the state of a summary metric, which is shared by all the
+// Float64Data it produces.
+type summary struct {
+	objectives []objective
+	window     time.Duration
+	info       *Scalar
+	keys       []label.Key
+	limit      int
+	key        *keys.Float64
+	groups     [][]label.Label
+	rows       []*summaryRow
+	// start is when the summary was last reset, and end when it last
+	// recorded a value.
+	start, end time.Time
+}
+
+// summaryRow tracks the recent values of a single row of a summary.
+type summaryRow struct {
+	streams []*quantileStream
+	// head is the oldest stream, which is used to answer queries.
+	head int
+	// expires is when the head stream is reset and becomes the youngest.
+	expires time.Time
+	// values holds the latest quantiles, in the order of the objectives.
+	values []float64
+}
+
+func newSummary(info Summary, key *keys.Float64) *summary {
+	s := &summary{window: info.Window, keys: info.Keys, limit: info.CardinalityLimit, key: key}
+	if s.window <= 0 {
+		s.window = DefaultSummaryWindow
+	}
+	objectives := info.Objectives
+	if len(objectives) == 0 {
+		objectives = DefaultObjectives
+	}
+	for q, e := range objectives {
+		if q > 0 && q < 1 && e > 0 {
+			s.objectives = append(s.objectives, objective{quantile: q, error: e})
+		}
+	}
+	sort.Slice(s.objectives, func(i, j int) bool { return s.objectives[i].quantile < s.objectives[j].quantile })
+	s.info = &Scalar{
+		Name:        info.Name,
+		Description: info.Description,
+		Unit:        info.Unit,
+		Keys:        append(append([]label.Key(nil), info.Keys...), Quantile),
+		// The limit applies to the rows of the summary before they are split
+		// by quantile.
+		CardinalityLimit: info.CardinalityLimit,
+	}
+	return s
+}
+
+func (s *summary) record(at time.Time, lm label.Map, l label.Label) Data {
+	value := s.key.From(l)
+	index, insert := getGroup(lm, &s.groups, s.keys, s.limit)
+	if insert {
+		row := &summaryRow{expires: at.Add(s.window / summaryAges)}
+		for i := 0; i < summaryAges; i++ {
+			row.streams = append(row.streams, &quantileStream{objectives: s.objectives})
+		}
+		s.rows = append(s.rows, nil)
+		copy(s.rows[index+1:], s.rows[index:])
+		s.rows[index] = row
+	}
+	row := s.rows[index]
+	if !math.IsNaN(value) {
+		row.add(at, value, s.window)
+	}
+	row.values = make([]float64, len(s.objectives))
+	head := row.streams[row.head]
+	for i, o := range s.objectives {
+		row.values[i] = head.query(o.quantile)
+	}
+	s.end = at
+	return s.data()
+}
+
+// data returns the latest quantiles of every row.
+func (s *summary) data() Data {
+	data := &Float64Data{Info: s.info, IsGauge: true, StartTime: s.start, EndTime: s.end, key: s.key}
+	for i, group := range s.groups {
+		for j, o := range s.objectives {
+			data.groups = append(data.groups, append(append([]label.Label(nil), group...), Quantile.Of(o.quantile)))
+			data.Rows = append(data.Rows, s.rows[i].values[j])
+		}
+	}
+	return data
+}
+
+// add inserts the value in every stream, after retiring the streams that
+// have grown older than the window.
+func (r *summaryRow) add(at time.Time, value float64, window time.Duration) {
+	if at.Sub(r.expires) >= window {
+		// Nothing recorded in the window is still current.
+		for _, stream := range r.streams {
+			stream.reset()
+		}
+		r.expires = at.Add(window / summaryAges)
+	}
+	for !at.Before(r.expires) {
+		r.streams[r.head].reset()
+		r.head = (r.head + 1) % len(r.streams)
+		r.expires = r.expires.Add(window / summaryAges)
+	}
+	for _, stream := range r.streams {
+		stream.insert(value)
+	}
+}
+
+// quantileStream estimates quantiles of a stream of values in bounded space,
+// using the targeted quantiles algorithm from "Effective Computation of
+// Biased Quantiles over Data Streams" by Cormode, Korn, Muthukrishnan and
+// Srivastava.
+type quantileStream struct {
+	objectives []objective
+	// n is the number of values inserted.
+	n float64
+	// samples are ordered by value.
+	samples []quantileSample
+	// buffer holds values not yet merged into samples.
+	buffer []float64
+}
+
+// quantileSample stands for width values, the smallest of which may rank up
+// to delta below the rank implied by the widths before it.
+type quantileSample struct {
+	value, width, delta float64
+}
+
+// maxQuantileBuffer is the number of values gathered before they are merged
+// into the samples.
+const maxQuantileBuffer = 500
+
+func (s *quantileStream) reset() {
+	s.n = 0
+	s.samples = s.samples[:0]
+	s.buffer = s.buffer[:0]
+}
+
+func (s *quantileStream) insert(value float64) {
+	s.buffer = append(s.buffer, value)
+	if len(s.buffer) >= maxQuantileBuffer {
+		s.flush()
+	}
+}
+
+// invariant returns the uncertainty in rank allowed for a sample at rank r.
+func (s *quantileStream) invariant(r float64) float64 {
+	allowed := math.MaxFloat64
+	for _, o := range s.objectives {
+		var f float64
+		if r >= o.quantile*s.n {
+			f = 2 * o.error * r / o.quantile
+		} else {
+			f = 2 * o.error * (s.n - r) / (1 - o.quantile)
+		}
+		if f < allowed {
+			allowed = f
+		}
+	}
+	return allowed
+}
+
+// flush merges the buffered values into the samples, and compresses them.
+func (s *quantileStream) flush() {
+	if len(s.buffer) == 0 {
+		return
+	}
+	sort.Float64s(s.buffer)
+	merged := make([]quantileSample, 0, len(s.samples)+len(s.buffer))
+	var r float64
+	i := 0
+	for _, v := range s.buffer {
+		for ; i < len(s.samples) && s.samples[i].value <= v; i++ {
+			merged = append(merged, s.samples[i])
+			r += s.samples[i].width
+		}
+		// A new minimum or maximum has an exact rank.
+		var delta float64
+		if len(merged) > 0 && i < len(s.samples) {
+			delta = math.Max(0, math.Floor(s.invariant(r))-1)
+		}
+		merged = append(merged, quantileSample{value: v, width: 1, delta: delta})
+		s.n++
+		r++
+	}
+	s.samples = append(merged, s.samples[i:]...)
+	s.buffer = s.buffer[:0]
+	s.compress()
+}
+
+// compress merges each sample into its successor while the invariant
+// allows, keeping the smallest sample so that the minimum stays exact.
+func (s *quantileStream) compress() {
+	if len(s.samples) < 3 {
+		return
+	}
+	kept := make([]quantileSample, 0, len(s.samples))
+	x := s.samples[len(s.samples)-1]
+	r := s.n - 1 - x.width
+	for i := len(s.samples) - 2; i > 0; i-- {
+		c := s.samples[i]
+		if c.width+x.width+x.delta <= s.invariant(r) {
+			x.width += c.width
+		} else {
+			kept = append(kept, x)
+			x = c
+		}
+		r -= c.width
+	}
+	kept = append(kept, x, s.samples[0])
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	s.samples = kept
+}
+
+// query returns the estimate of quantile q, or NaN if the stream is empty.
+func (s *quantileStream) query(q float64) float64 {
+	s.flush()
+	if len(s.samples) == 0 {
+		return math.NaN()
+	}
+	t := math.Ceil(q * s.n)
+	t += math.Ceil(s.invariant(t) / 2)
+	p := s.samples[0]
+	var r float64
+	for _, c := range s.samples[1:] {
+		r += p.width
+		if r+c.width+c.delta > t {
+			return p.value
+		}
+		p = c
+	}
+	return p.value
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// manualClock is a clock that only moves when the test advances it.
+type manualClock struct{ now time.Time }
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+// quantiles returns the latest value of each quantile of the row whose key
+// has the given value.
+func quantiles(data *metric.Float64Data, key *keys.String, value string) map[float64]float64 {
+	got := make(map[float64]float64)
+	for i, group := range data.Groups() {
+		var v string
+		var q float64
+		for _, l := range group {
+			switch l.Key() {
+			case key:
+				v = key.From(l)
+			case metric.Quantile:
+				q = metric.Quantile.From(l)
+			}
+		}
+		if v == value {
+			got[q] = data.Rows[i]
+		}
+	}
+	return got
+}
+
+func TestSummary(t *testing.T) {
+	clock := &manualClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	event.SetClock(clock)
+	defer event.SetClock(nil)
+
+	method := keys.NewString("method", "")
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	recorder := metric.Summary{Name: "latency", Keys: []label.Key{method}, Window: time.Minute}.Record(&m, latency)
+	var latest *metric.Float64Data
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			latest = metric.Entries.Get(lm).([]metric.Data)[0].(*metric.Float64Data)
+		}
+		return ctx
+	}))
+
+	const n = 10000
+	for _, v := range rand.New(rand.NewSource(1)).Perm(n) {
+		recorder.Record(ctx, float64(v+1), method.Of("hover"))
+	}
+	recorder.Record(ctx, 7, method.Of("definition"))
+	if !latest.IsGauge || len(latest.Rows) != 2*len(metric.DefaultObjectives) {
+		t.Fatalf("got %d rows, want a gauge for each default quantile of both methods", len(latest.Rows))
+	}
+	got := quantiles(latest, method, "hover")
+	for q, e := range metric.DefaultObjectives {
+		if v, ok := got[q]; !ok || math.Abs(v-q*n) > e*n {
+			t.Errorf("quantile %v of hover is %v, want within %v of %v", q, v, e*n, q*n)
+		}
+	}
+	for q, v := range quantiles(latest, method, "definition") {
+		if v != 7 {
+			t.Errorf("quantile %v of definition is %v, want 7", q, v)
+		}
+	}
+
+	// Once the window has passed only the new values count.
+	clock.now = clock.now.Add(2 * time.Minute)
+	for i := 0; i < 10; i++ {
+		recorder.Record(ctx, 1000, method.Of("hover"))
+		clock.now = clock.now.Add(time.Second)
+	}
+	for q, v := range quantiles(latest, method, "hover") {
+		if v != 1000 {
+			t.Errorf("quantile %v of hover after the window is %v, want 1000", q, v)
+		}
+	}
+
+	// The window slides in steps of a fifth, so values are dropped between
+	// four fifths of a window and a whole window after they were recorded.
+	clock.now = clock.now.Add(30 * time.Second)
+	recorder.Record(ctx, 1, method.Of("hover"))
+	if got := quantiles(latest, method, "hover"); got[0.5] != 1000 {
+		t.Errorf("median of hover is %v within the window, want 1000", got[0.5])
+	}
+	clock.now = clock.now.Add(20 * time.Second)
+	recorder.Record(ctx, 1, method.Of("hover"))
+	if got := quantiles(latest, method, "hover"); got[0.5] != 1 {
+		t.Errorf("median of hover is %v after the older values expired, want 1", got[0.5])
+	}
+}
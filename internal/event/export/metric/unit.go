@@ -0,0 +1,34 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+// Common units of metric values, as the UCUM codes used by OpenTelemetry.
+const (
+	// UnitDimensionless is the unit of counts and ratios.
+	UnitDimensionless = "1"
+	UnitBytes         = "By"
+	UnitSeconds       = "s"
+	UnitMilliseconds  = "ms"
+	UnitMicroseconds  = "us"
+	UnitNanoseconds   = "ns"
+)
+
+// UnitOf returns the unit of the data, or the empty string if its metric did
+// not declare one.
+func UnitOf(data Data) string {
+	switch data := data.(type) {
+	case *Int64Data:
+		return data.Info.Unit
+	case *Float64Data:
+		return data.Info.Unit
+	case *HistogramInt64Data:
+		return data.Info.Unit
+	case *HistogramFloat64Data:
+		return data.Info.Unit
+	case *ExponentialHistogramData:
+		return data.Info.Unit
+	}
+	return ""
+}
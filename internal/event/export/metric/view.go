@@ -0,0 +1,214 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Aggregation selects how a view combines the values recorded on a measure.
+type Aggregation int
+
+const (
+	// AggregateDefault keeps the aggregation the metric was created with.
+	AggregateDefault = Aggregation(iota)
+	// AggregateDrop disables the metric, nothing is recorded for it.
+	AggregateDrop
+	// AggregateSum sums the values, as SumInt64 and SumFloat64 do.
+	AggregateSum
+	// AggregateLastValue keeps the latest value, as LatestInt64 and
+	// LatestFloat64 do.
+	AggregateLastValue
+	// AggregateHistogram counts the values in the buckets of the view.
+	AggregateHistogram
+)
+
+// DefaultBuckets are the bucket bounds used by AggregateHistogram when a
+// view does not supply any.
+var DefaultBuckets = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// View changes a metric from the way it was declared by its instrumentation.
+// Views are added to a Config before the metrics are created on it, and the
+// first view that matches a metric applies to it.
+type View struct {
+	// Match is the name of the metrics the view applies to. If it ends in
+	// "*" it matches every metric whose name starts with the rest of it.
+	Match string
+	// Name, if set, is the name the metric is exported as.
+	Name string
+	// Description, if set, replaces the description of the metric.
+	Description string
+	// Unit, if set, replaces the unit of the metric.
+	Unit string
+	// DropKeys are the names of the label keys to remove from the metric.
+	// Rows that only differed in those labels are combined.
+	DropKeys []string
+	// Aggregation replaces the aggregation of the metric.
+	// Only AggregateDrop applies to metrics that count events, rather than
+	// recording the values of an int64 or float64 measure, and a gauge that
+	// is aggregated differently ignores its Add calls.
+	Aggregation Aggregation
+	// Buckets holds the inclusive upper bounds of the buckets used by
+	// AggregateHistogram, it defaults to DefaultBuckets.
+	// The bounds are rounded up for int64 measures.
+	Buckets []float64
+	// CardinalityLimit, if not zero, replaces the cardinality limit of the
+	// metric.
+	CardinalityLimit int
+}
+
+// AddView adds views to the configuration, they apply to the metrics created
+// on it afterwards.
+func (e *Config) AddView(views ...View) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.views = append(e.views, views...)
+}
+
+// matches reports whether the view applies to the named metric.
+func (v *View) matches(name string) bool {
+	if prefix := strings.TrimSuffix(v.Match, "*"); prefix != v.Match {
+		return strings.HasPrefix(name, prefix)
+	}
+	return v.Match == name
+}
+
+// override applies the first view that matches a new metric to its name,
+// description, unit, keys and cardinality limit, and resolves a limit of zero
+// to the limit of the configuration. If the view replaces the aggregation of
+// the metric it subscribes the replacement to the measure and returns true, in
+// which case the caller must not subscribe the metric itself.
+func (e *Config) override(name, description, unit *string, labelKeys *[]label.Key, limit *int, key label.Key) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.overrideLocked(name, description, unit, labelKeys, limit, key)
+}
+
+// overrideLocked is override for callers that hold the lock.
+func (e *Config) overrideLocked(name, description, unit *string, labelKeys *[]label.Key, limit *int, key label.Key) bool {
+	if *limit == 0 {
+		*limit = e.cardinalityLimitLocked()
+	}
+	var view *View
+	for i := range e.views {
+		if e.views[i].matches(*name) {
+			view = &e.views[i]
+			break
+		}
+	}
+	if view == nil {
+		return false
+	}
+	if view.Name != "" {
+		*name = view.Name
+	}
+	if view.Description != "" {
+		*description = view.Description
+	}
+	if view.Unit != "" {
+		*unit = view.Unit
+	}
+	if view.CardinalityLimit != 0 {
+		*limit = view.CardinalityLimit
+	}
+	if len(view.DropKeys) > 0 {
+		kept := make([]label.Key, 0, len(*labelKeys))
+		for _, k := range *labelKeys {
+			if !containsName(view.DropKeys, k.Name()) {
+				kept = append(kept, k)
+			}
+		}
+		*labelKeys = kept
+	}
+	if view.Aggregation == AggregateDrop {
+		return true
+	}
+	scalar := &Scalar{Name: *name, Description: *description, Unit: *unit, Keys: *labelKeys, CardinalityLimit: *limit}
+	buckets := view.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	switch key := key.(type) {
+	case *keys.Int64:
+		switch view.Aggregation {
+		case AggregateSum:
+			data := &Int64Data{Info: scalar, key: key}
+			e.subscribeLocked(key, data.sum)
+			e.trackLocked(data)
+			return true
+		case AggregateLastValue:
+			data := &Int64Data{Info: scalar, IsGauge: true, key: key}
+			e.subscribeLocked(key, data.latest)
+			e.trackLocked(data)
+			return true
+		case AggregateHistogram:
+			info := &HistogramInt64{Name: *name, Description: *description, Unit: *unit, Keys: *labelKeys, CardinalityLimit: *limit, Buckets: int64Buckets(buckets)}
+			data := &HistogramInt64Data{Info: info, key: key}
+			e.subscribeLocked(key, data.record)
+			e.trackLocked(data)
+			return true
+		}
+	case *keys.Float64:
+		switch view.Aggregation {
+		case AggregateSum:
+			data := &Float64Data{Info: scalar, key: key}
+			e.subscribeLocked(key, data.sum)
+			e.trackLocked(data)
+			return true
+		case AggregateLastValue:
+			data := &Float64Data{Info: scalar, IsGauge: true, key: key}
+			e.subscribeLocked(key, data.latest)
+			e.trackLocked(data)
+			return true
+		case AggregateHistogram:
+			info := &HistogramFloat64{Name: *name, Description: *description, Unit: *unit, Keys: *labelKeys, CardinalityLimit: *limit, Buckets: float64Buckets(buckets)}
+			data := &HistogramFloat64Data{Info: info, key: key}
+			e.subscribeLocked(key, data.record)
+			e.trackLocked(data)
+			return true
+		}
+	}
+	return false
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// float64Buckets returns the bounds in increasing order without duplicates.
+func float64Buckets(bounds []float64) []float64 {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	result := sorted[:0]
+	for i, b := range sorted {
+		if i == 0 || b != sorted[i-1] {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+// int64Buckets returns the bounds rounded up to integers, in increasing order
+// without duplicates.
+func int64Buckets(bounds []float64) []int64 {
+	var result []int64
+	for _, b := range float64Buckets(bounds) {
+		i := int64(math.Ceil(b))
+		if len(result) == 0 || i != result[len(result)-1] {
+			result = append(result, i)
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metric_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestViews(t *testing.T) {
+	method := keys.NewString("method", "")
+	status := keys.NewString("status", "")
+	calls := keys.NewInt64("calls", "")
+	latency := keys.NewFloat64("latency", "")
+	size := keys.NewInt64("size", "")
+	memory := keys.NewInt64("memory", "")
+
+	var m metric.Config
+	m.AddView(
+		metric.View{Match: "rpc.calls", Name: "calls", DropKeys: []string{"status"}},
+		metric.View{Match: "rpc.latency", Description: "latest latency", Unit: metric.UnitSeconds, Aggregation: metric.AggregateLastValue},
+		metric.View{Match: "rpc.size", Aggregation: metric.AggregateHistogram, Buckets: []float64{9.5, 100, 10}},
+		metric.View{Match: "debug.*", Aggregation: metric.AggregateDrop},
+	)
+	metric.Scalar{Name: "rpc.calls", Keys: []label.Key{method, status}}.SumInt64(&m, calls)
+	metric.HistogramFloat64{Name: "rpc.latency", Description: "latency", Unit: metric.UnitMilliseconds, Buckets: []float64{1, 10}}.Record(&m, latency)
+	metric.Scalar{Name: "rpc.size"}.SumInt64(&m, size)
+	metric.Scalar{Name: "debug.memory"}.LatestInt64(&m, memory)
+
+	latest := make(map[string]metric.Data)
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+				latest[data.Handle()] = data
+			}
+		}
+		return ctx
+	}))
+	event.Metric(ctx, method.Of("hover"), status.Of("ok"), calls.Of(2))
+	event.Metric(ctx, method.Of("hover"), status.Of("failed"), calls.Of(3))
+	event.Metric(ctx, latency.Of(4))
+	event.Metric(ctx, latency.Of(2.5))
+	event.Metric(ctx, size.Of(50))
+	event.Metric(ctx, memory.Of(100))
+
+	if len(latest) != 3 {
+		t.Errorf("got metrics %v, want calls, rpc.latency and rpc.size", latest)
+	}
+	// Calls is renamed, and the status no longer splits its rows.
+	c := latest["calls"].(*metric.Int64Data)
+	if len(c.Info.Keys) != 1 || !reflect.DeepEqual(c.Rows, []int64{5}) {
+		t.Errorf("calls has keys %v and rows %v, want [method] and [5]", c.Info.Keys, c.Rows)
+	}
+	l := latest["rpc.latency"].(*metric.Float64Data)
+	if !l.IsGauge || l.Info.Description != "latest latency" || l.Info.Unit != metric.UnitSeconds || !reflect.DeepEqual(l.Rows, []float64{2.5}) {
+		t.Errorf("rpc.latency is %+v, want a gauge of 2.5 seconds", l)
+	}
+	s := latest["rpc.size"].(*metric.HistogramInt64Data)
+	if want := []int64{10, 100}; !reflect.DeepEqual(s.Info.Buckets, want) || !reflect.DeepEqual(s.Rows[0].Values, []int64{0, 1}) {
+		t.Errorf("rpc.size has buckets %v and counts %v, want %v and [0 1]", s.Info.Buckets, s.Rows[0].Values, want)
+	}
+}
+
+func TestAddConcurrently(t *testing.T) {
+	count := keys.NewInt64("count", "")
+	var m metric.Config
+	metric.Scalar{Name: "count"}.SumInt64(&m, count)
+	ctx := event.WithExporter(context.Background(), m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		return ctx
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			event.Metric(ctx, count.Of(1))
+			m.Snapshot()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		m.AddView(metric.View{Match: "other"})
+		metric.Scalar{Name: "count"}.SumInt64(&m, count)
+	}
+	<-done
+}
@@ -0,0 +1,27 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"golang.org/x/tools/internal/event"
+)
+
+// Middleware decorates an Exporter with some additional behavior.
+// It is handed the exporter that should receive the events it chooses to
+// forward, and returns the exporter that should be called in its place.
+// Spans and Labels are both examples of middleware.
+type Middleware func(output event.Exporter) event.Exporter
+
+// Wrap applies the middleware to the exporter.
+// The middleware are listed in the order events flow through them, so
+// Wrap(e, a, b) is equivalent to a(b(e)).
+func Wrap(e event.Exporter, mw ...Middleware) event.Exporter {
+	for i := len(mw) - 1; i >= 0; i-- {
+		if mw[i] != nil {
+			e = mw[i](e)
+		}
+	}
+	return e
+}
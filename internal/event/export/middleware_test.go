@@ -0,0 +1,36 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestWrap(t *testing.T) {
+	var order []string
+	record := func(name string) export.Middleware {
+		return func(output event.Exporter) event.Exporter {
+			return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+				order = append(order, name)
+				return output(ctx, ev, lm)
+			}
+		}
+	}
+	e := export.Wrap(export.Multi(), record("a"), nil, record("b"), record("c"))
+	event.SetExporter(e)
+	defer event.SetExporter(nil)
+
+	event.Log(context.Background(), "message")
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware ran in order %v, want %v", order, want)
+	}
+}
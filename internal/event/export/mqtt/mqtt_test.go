@@ -0,0 +1,252 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mqtt_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/mqtt"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// packet is a control packet as seen by the fake broker.
+type packet struct {
+	kind, flags byte
+	body        []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	n, shift := 0, uint(0)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		n |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return packet{first >> 4, first & 0x0f, body}, err
+}
+
+// describe summarizes a packet, giving the topic and payload of a PUBLISH.
+func describe(p packet) string {
+	switch p.kind {
+	case 1:
+		// Skip the protocol name, level, flags and keep alive.
+		n := int(p.body[10])<<8 | int(p.body[11])
+		return "CONNECT " + string(p.body[12:12+n])
+	case 3:
+		n := int(p.body[0])<<8 | int(p.body[1])
+		topic, rest := string(p.body[2:2+n]), p.body[2+n:]
+		if qos := p.flags >> 1 & 3; qos > 0 {
+			rest = rest[2:]
+		}
+		return fmt.Sprintf("PUBLISH %s flags=%d %s", topic, p.flags, rest)
+	case 6:
+		return "PUBREL"
+	case 12:
+		return "PINGREQ"
+	case 14:
+		return "DISCONNECT"
+	}
+	return fmt.Sprintf("packet %d", p.kind)
+}
+
+// fakeBroker accepts connections and sends a description of every packet it
+// receives to packets. Publications are acknowledged unless ack is false,
+// in which case the connection is closed after the first one.
+func fakeBroker(t *testing.T, ack bool) (net.Listener, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	packets := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			serve(conn, ack, packets)
+			ack = true
+		}
+	}()
+	return ln, packets
+}
+
+func serve(conn net.Conn, ack bool, packets chan string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		packets <- describe(p)
+		switch p.kind {
+		case 1:
+			conn.Write([]byte{0x20, 2, 0, 0})
+		case 3:
+			if !ack {
+				return
+			}
+			switch p.flags >> 1 & 3 {
+			case 1:
+				n := int(p.body[0])<<8 | int(p.body[1])
+				conn.Write(append([]byte{0x40, 2}, p.body[2+n:4+n]...))
+			case 2:
+				n := int(p.body[0])<<8 | int(p.body[1])
+				conn.Write(append([]byte{0x50, 2}, p.body[2+n:4+n]...))
+			}
+		case 6:
+			conn.Write(append([]byte{0x70, 2}, p.body[:2]...))
+		case 12:
+			conn.Write([]byte{0xd0, 0})
+		case 14:
+			return
+		}
+	}
+}
+
+func next(t *testing.T, packets chan string) string {
+	t.Helper()
+	select {
+	case p := <-packets:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a packet")
+		return ""
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ln, packets := fakeBroker(t, true)
+	exporter, err := mqtt.New(&mqtt.Config{URL: "mqtt://" + ln.Addr().String() + "?qos=1", ClientID: "gopls-test", Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)))
+	defer event.SetClock(nil)
+	count := keys.NewInt64("count", "")
+	var m metric.Config
+	metric.Scalar{Name: "requests"}.SumInt64(&m, count)
+	event.SetExporter(export.Spans(m.Exporter(exporter.ProcessEvent)))
+	ctx, done := event.Start(context.Background(), "hover")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	done()
+	event.Metric(ctx, count.Of(3))
+	event.SetExporter(nil)
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := next(t, packets); got != "CONNECT gopls-test" {
+		t.Fatalf("got %s, want CONNECT", got)
+	}
+	for _, want := range []struct {
+		topic  string
+		fields map[string]interface{}
+	}{
+		{"telemetry/events", map[string]interface{}{"t": 1583418468000.0, "k": "error", "m": "failed", "e": "timeout"}},
+		{"telemetry/spans", map[string]interface{}{"k": "span", "n": "hover"}},
+		{"telemetry/metrics", map[string]interface{}{"k": "metric", "n": "requests"}},
+	} {
+		got := next(t, packets)
+		prefix := "PUBLISH " + want.topic + " flags=2 "
+		if !strings.HasPrefix(got, prefix) {
+			t.Fatalf("got %s, want a QoS 1 publication to %s", got, want.topic)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(got, prefix)), &fields); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range want.fields {
+			if fields[k] != v {
+				t.Errorf("%s: got %s=%v, want %v", want.topic, k, fields[k], v)
+			}
+		}
+	}
+	if got := next(t, packets); got != "DISCONNECT" {
+		t.Errorf("got %s, want DISCONNECT", got)
+	}
+}
+
+func TestExactlyOnce(t *testing.T) {
+	ln, packets := fakeBroker(t, true)
+	exporter, err := mqtt.New(&mqtt.Config{URL: ln.Addr().String(), QoS: 2, Prefix: "box", Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Log(event.WithExporter(context.Background(), export.Spans(exporter.ProcessEvent)), "hello")
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	next(t, packets)
+	for _, want := range []string{"PUBLISH box/events flags=4 ", "PUBREL", "DISCONNECT"} {
+		if got := next(t, packets); !strings.HasPrefix(got, want) {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestResend(t *testing.T) {
+	ln, packets := fakeBroker(t, false)
+	exporter, err := mqtt.New(&mqtt.Config{URL: ln.Addr().String(), QoS: 1, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := event.WithExporter(context.Background(), export.Spans(exporter.ProcessEvent))
+	event.Log(ctx, "unacknowledged")
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	next(t, packets)
+	if got := next(t, packets); !strings.HasPrefix(got, "PUBLISH telemetry/events flags=2 ") {
+		t.Fatalf("got %s, want the first publication", got)
+	}
+	// Wait for the exporter to notice the broker dropped the connection.
+	deadline := time.Now().Add(5 * time.Second)
+	for exporter.Flush(context.Background()) != nil || len(packets) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the exporter did not reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := next(t, packets); !strings.HasPrefix(got, "CONNECT ") {
+		t.Fatalf("got %s, want a new connection", got)
+	}
+	if got := next(t, packets); !strings.HasPrefix(got, "PUBLISH telemetry/events flags=10 ") || !strings.Contains(got, "unacknowledged") {
+		t.Errorf("got %s, want the publication resent with the DUP flag", got)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
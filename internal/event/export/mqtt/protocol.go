@@ -0,0 +1,140 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The control packet types of MQTT 3.1.1 used by the exporter.
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPubRec     = 5
+	packetPubRel     = 6
+	packetPubComp    = 7
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// flagDup marks a PUBLISH packet that is being sent again.
+const flagDup = 0x08
+
+// maxRemaining is the largest body a packet length can describe.
+const maxRemaining = 268435455
+
+// appendPacket appends a packet with the given first byte and body.
+func appendPacket(buf []byte, first byte, body []byte) []byte {
+	buf = append(buf, first)
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(buf, body...)
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(appendUint16(buf, uint16(len(s))), s...)
+}
+
+// connectPacket builds the CONNECT packet for a clean session.
+func connectPacket(clientID, username, password string, hasUser, hasPassword bool, keepAlive time.Duration) []byte {
+	flags := byte(0x02) // clean session
+	if hasUser {
+		flags |= 0x80
+	}
+	if hasPassword {
+		flags |= 0x40
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = appendUint16(body, uint16(keepAlive/time.Second))
+	body = appendString(body, clientID)
+	if hasUser {
+		body = appendString(body, username)
+	}
+	if hasPassword {
+		body = appendString(body, password)
+	}
+	return appendPacket(nil, packetConnect<<4, body)
+}
+
+// publishPacket builds a PUBLISH packet, the id is only sent for a qos above
+// zero.
+func publishPacket(topic string, payload []byte, qos byte, id uint16) []byte {
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = appendUint16(body, id)
+	}
+	body = append(body, payload...)
+	return appendPacket(nil, packetPublish<<4|qos<<1, body)
+}
+
+// ackPacket builds one of the packets that carry nothing but a packet id.
+func ackPacket(kind byte, id uint16) []byte {
+	first := kind << 4
+	if kind == packetPubRel {
+		first |= 0x02 // required by the specification
+	}
+	return appendPacket(nil, first, appendUint16(nil, id))
+}
+
+// readPacket reads a packet, returning its type and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, uint(0)
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed packet length")
+		}
+	}
+	if n > maxRemaining {
+		return 0, nil, fmt.Errorf("packet too long")
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return first >> 4, body, nil
+}
+
+// packetID returns the id carried by an acknowledgement.
+func packetID(body []byte) (uint16, bool) {
+	if len(body) < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(body), true
+}
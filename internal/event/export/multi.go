@@ -0,0 +1,64 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Multi returns an Exporter that delivers every event to each of the supplied
+// exporters in turn.
+// The context returned by each exporter is handed on to the next one, so
+// exporters that annotate the context should normally be wrapped around the
+// result of Multi rather than passed to it.
+// A panic in one exporter is recovered and passed to ReportError, so that the
+// remaining exporters still see the event.
+func Multi(exporters ...event.Exporter) event.Exporter {
+	var nonNil []event.Exporter
+	for _, e := range exporters {
+		if e != nil {
+			nonNil = append(nonNil, e)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return Null()
+	case 1:
+		return nonNil[0]
+	}
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		for _, e := range nonNil {
+			ctx = deliverIsolated(ctx, e, ev, lm)
+		}
+		return ctx
+	}
+}
+
+// deliverIsolated calls e, returning the unmodified context if it panics.
+func deliverIsolated(ctx context.Context, e event.Exporter, ev core.Event, lm label.Map) (result context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			ReportError(fmt.Errorf("exporter panicked: %v", r))
+			result = ctx
+		}
+	}()
+	return e(ctx, ev, lm)
+}
+
+// Null returns an exporter that discards every event.
+// It is useful where an exporter is required but no output is wanted, such as
+// at the end of a chain of middleware.
+// To turn telemetry off entirely, install a nil exporter instead, which also
+// makes event.Enabled report false.
+func Null() event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		return ctx
+	}
+}
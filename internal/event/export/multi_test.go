@@ -0,0 +1,39 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestMulti(t *testing.T) {
+	var first, second bytes.Buffer
+	panicky := func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		panic("broken exporter")
+	}
+	e := export.Multi(
+		export.LogWriter(&first, false),
+		panicky,
+		nil,
+		export.LogWriter(&second, false),
+	)
+	event.SetExporter(e)
+	defer event.SetExporter(nil)
+
+	event.Log(context.Background(), "hello")
+	for name, buf := range map[string]*bytes.Buffer{"first": &first, "second": &second} {
+		if got := buf.String(); !strings.Contains(got, "hello") {
+			t.Errorf("%s exporter got %q, want it to contain %q", name, got, "hello")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nats_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/nats"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// fakeServer accepts a single connection, pings it, and sends every command
+// it receives to lines, with each PUB followed by its payload.
+func fakeServer(t *testing.T) (net.Listener, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	lines := make(chan string, 100)
+	go func() {
+		defer close(lines)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\nPING\r\n"))
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\r\n")
+			lines <- line
+			if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "PUB" {
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				if _, err := io.ReadFull(r, payload); err != nil {
+					return
+				}
+				lines <- string(payload[:n])
+			}
+		}
+	}()
+	return ln, lines
+}
+
+func TestPublish(t *testing.T) {
+	ln, lines := fakeServer(t)
+	exporter, err := nats.New(&nats.Config{URL: "nats://token@" + ln.Addr().String(), Name: "gopls", Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)))
+	defer event.SetClock(nil)
+	count := keys.NewInt64("count", "")
+	var m metric.Config
+	metric.Scalar{Name: "requests"}.SumInt64(&m, count)
+	event.SetExporter(export.Spans(m.Exporter(exporter.ProcessEvent)))
+	ctx, done := event.Start(context.Background(), "hover")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	done()
+	event.Metric(ctx, count.Of(3))
+	event.SetExporter(nil)
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	span := export.GetSpan(ctx)
+	spanID, traceID := span.ID.SpanID.String(), span.ID.TraceID.String()
+	want := []string{
+		`CONNECT {"auth_token":"token","lang":"go","name":"gopls","pedantic":false,"protocol":0,"verbose":false}`,
+		`PUB telemetry.events 158`,
+		`{"error":"timeout","kind":"error","message":"failed","span_id":"` + spanID + `","time":"2020-03-05T14:27:48Z","trace_id":"` + traceID + `"}`,
+		`PUB telemetry.spans 167`,
+		`{"duration_ms":0,"end":"2020-03-05T14:27:48Z","name":"hover","span_id":"` + spanID + `","start":"2020-03-05T14:27:48Z","trace_id":"` + traceID + `"}`,
+		`PUB telemetry.metrics 89`,
+		`{"kind":"counter","name":"requests","series":[{"value":3}],"time":"2020-03-05T14:27:48Z"}`,
+	}
+	var got []string
+	for line := range lines {
+		// Whether the ping is answered before the connection is closed is a
+		// race.
+		if line != "PONG" {
+			got = append(got, line)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got commands\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got %s\nwant %s", got[i], want[i])
+		}
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	exporter, err := nats.New(&nats.Config{URL: addr, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	event.Log(context.Background(), "lost")
+	event.SetExporter(nil)
+	if err := exporter.Shutdown(context.Background()); err == nil {
+		t.Error("publishing to a closed port succeeded")
+	}
+}
+
+func TestPing(t *testing.T) {
+	ln, lines := fakeServer(t)
+	exporter, err := nats.New(&nats.Config{URL: ln.Addr().String(), Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	event.Log(context.Background(), "connect")
+	event.SetExporter(nil)
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			if line == "PONG" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the server's ping was not answered")
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package newrelic sends spans and metrics to the New Relic trace and metric
+// ingest APIs.
+//
+// Telemetry is gathered for a harvest cycle, five seconds by default, and
+// then sent gzip compressed.
+//
+// Importing the package registers a "newrelic" exporter whose options are the
+// API key; if they are empty the key is read from $NEW_RELIC_API_KEY.
+package newrelic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+const (
+	// DefaultTraceURL is the US endpoint of the trace API.
+	DefaultTraceURL = "https://trace-api.newrelic.com/trace/v1"
+	// DefaultMetricURL is the US endpoint of the metric API.
+	DefaultMetricURL = "https://metric-api.newrelic.com/metric/v1"
+	// DefaultHarvestPeriod is how long telemetry is gathered before it is sent.
+	DefaultHarvestPeriod = 5 * time.Second
+)
+
+// APIKeyEnv is the environment variable the registered exporter reads the API
+// key from when none is given.
+const APIKeyEnv = "NEW_RELIC_API_KEY"
+
+// Config configures an Exporter.
+type Config struct {
+	// APIKey is the license or insert key the data is sent with.
+	APIKey string
+	// Service is the service.name attribute of all the telemetry, it defaults
+	// to the name of the binary.
+	Service string
+	// TraceURL and MetricURL override the ingest endpoints, such as for the EU
+	// region.
+	TraceURL  string
+	MetricURL string
+	// HarvestPeriod is how often the gathered telemetry is sent.
+	HarvestPeriod time.Duration
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+func init() {
+	export.Register("newrelic", func(key string) (event.Exporter, export.Shutdowner, error) {
+		if key == "" {
+			key = os.Getenv(APIKeyEnv)
+		}
+		exporter, err := New(&Config{APIKey: key})
+		if err != nil {
+			return nil, nil, err
+		}
+		harvester := exporter.Harvester()
+		return harvester.ProcessEvent, harvester, nil
+	})
+}
+
+// Exporter is an export.BatchExporter that sends to the ingest APIs.
+type Exporter struct {
+	config Config
+	start  time.Time
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that sends with the configured key.
+func New(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.APIKey == "" {
+		return nil, fmt.Errorf("newrelic exporter needs an API key")
+	}
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	if resolved.TraceURL == "" {
+		resolved.TraceURL = DefaultTraceURL
+	}
+	if resolved.MetricURL == "" {
+		resolved.MetricURL = DefaultMetricURL
+	}
+	if resolved.HarvestPeriod <= 0 {
+		resolved.HarvestPeriod = DefaultHarvestPeriod
+	}
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(nil)
+	}
+	return &Exporter{config: resolved, start: core.Now()}, nil
+}
+
+// Harvester returns a Batcher that delivers to the exporter once every
+// harvest period.
+func (e *Exporter) Harvester() *export.Batcher {
+	// The trace API accepts up to a megabyte of compressed spans per request,
+	// which comfortably holds this many.
+	return export.Batch(e, 2000, e.config.HarvestPeriod)
+}
+
+type common struct {
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type spanBatch struct {
+	Common *common `json:"common"`
+	Spans  []*Span `json:"spans"`
+}
+
+// Span is a span in the New Relic format.
+type Span struct {
+	ID         string                 `json:"id"`
+	TraceID    string                 `json:"trace.id"`
+	Timestamp  int64                  `json:"timestamp"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type metricBatch struct {
+	Common  *metricCommon `json:"common"`
+	Metrics []*Metric     `json:"metrics"`
+}
+
+type metricCommon struct {
+	Timestamp  int64                  `json:"timestamp"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Metric is a metric in the New Relic format, its value is a number for
+// gauges and counts, and a summary for histograms.
+type Metric struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Value      interface{}            `json:"value"`
+	IntervalMS int64                  `json:"interval.ms,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type summary struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// ExportSpans sends the spans in a single request.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	batch := &spanBatch{
+		Common: &common{Attributes: map[string]interface{}{"service.name": e.config.Service}},
+		Spans:  make([]*Span, len(spans)),
+	}
+	for i, s := range spans {
+		batch.Spans[i] = convertSpan(s)
+	}
+	req, err := e.request(ctx, e.config.TraceURL, []*spanBatch{batch})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Data-Format", "newrelic")
+	req.Header.Set("Data-Format-Version", "1")
+	return e.send(req)
+}
+
+// ExportMetrics sends the metrics in a single request.
+// Counters are sent as gauges of their total, as the metric API expects
+// counts to be the change over an interval.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	batch := &metricBatch{
+		Common: &metricCommon{
+			Timestamp:  core.Now().UnixNano() / int64(time.Millisecond),
+			Attributes: map[string]interface{}{"service.name": e.config.Service},
+		},
+	}
+	for _, data := range metrics {
+		batch.Metrics = appendMetrics(batch.Metrics, data)
+	}
+	req, err := e.request(ctx, e.config.MetricURL, []*metricBatch{batch})
+	if err != nil {
+		return err
+	}
+	return e.send(req)
+}
+
+// request builds a gzip compressed JSON request.
+func (e *Exporter) request(ctx context.Context, uri string, message interface{}) (*http.Request, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(message); err != nil {
+		return nil, fmt.Errorf("newrelic failed to marshal telemetry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("newrelic failed to compress telemetry: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("newrelic failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Api-Key", e.config.APIKey)
+	return req, nil
+}
+
+func (e *Exporter) send(req *http.Request) error {
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("newrelic failed to send telemetry: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("newrelic rejected telemetry for %v: %v", req.URL, res.Status)
+	}
+	return nil
+}
+
+func convertSpan(span *export.Span) *Span {
+	start, end := span.Start().At(), span.Finish().At()
+	result := &Span{
+		ID:         span.ID.SpanID.String(),
+		TraceID:    span.ID.TraceID.String(),
+		Timestamp:  start.UnixNano() / int64(time.Millisecond),
+		Attributes: map[string]interface{}{"name": span.Name},
+	}
+	if span.ParentID.IsValid() {
+		result.Attributes["parent.id"] = span.ParentID.String()
+	}
+	if !end.IsZero() {
+		result.Attributes["duration.ms"] = float64(end.Sub(start)) / float64(time.Millisecond)
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		addAttribute(result.Attributes, span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		addAttribute(result.Attributes, l)
+	}
+	for _, ev := range span.Events() {
+		if !event.IsError(ev) {
+			continue
+		}
+		msg := keys.Msg.From(ev.Label(0))
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		result.Attributes["error.message"] = msg
+	}
+	return result
+}
+
+func appendMetrics(metrics []*Metric, data metric.Data) []*Metric {
+	add := func(group []label.Label, kind string, value interface{}) {
+		m := &Metric{Name: data.Handle(), Type: kind, Value: value}
+		for _, l := range group {
+			if m.Attributes == nil {
+				m.Attributes = make(map[string]interface{})
+			}
+			addAttribute(m.Attributes, l)
+		}
+		metrics = append(metrics, m)
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			add(group, "gauge", data.Rows[i])
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			add(group, "gauge", data.Rows[i])
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			add(group, "summary", &summary{Count: row.Count, Sum: float64(row.Sum), Min: float64(row.Min), Max: float64(row.Max)})
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			add(group, "summary", &summary{Count: row.Count, Sum: row.Sum, Min: row.Min, Max: row.Max})
+		}
+	}
+	return metrics
+}
+
+func addAttribute(attributes map[string]interface{}, l label.Label) {
+	if l.Valid() {
+		attributes[l.Key().Name()] = export.LabelValue(l)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package newrelic_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/newrelic"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// collector returns a server that records the decompressed bodies of the
+// requests sent to each path.
+func collector(t *testing.T) (*httptest.Server, map[string][]string) {
+	got := make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("Api-Key"); key != "secret" {
+			t.Errorf("got Api-Key %q", key)
+		}
+		if enc := r.Header.Get("Content-Encoding"); enc != "gzip" {
+			t.Errorf("got Content-Encoding %q", enc)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("request is not gzipped: %v", err)
+			return
+		}
+		body, _ := ioutil.ReadAll(zr)
+		got[r.URL.Path] = append(got[r.URL.Path], string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func newExporter(t *testing.T, srv *httptest.Server) *newrelic.Exporter {
+	exporter, err := newrelic.New(&newrelic.Config{
+		APIKey:    "secret",
+		Service:   "gopls",
+		TraceURL:  srv.URL + "/trace/v1",
+		MetricURL: srv.URL + "/metric/v1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exporter
+}
+
+func checkContains(t *testing.T, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("request %s\ndoes not contain %s", got, w)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	srv, got := collector(t)
+	f := &finished{}
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)))
+	defer event.SetClock(nil)
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	_, childDone := event.Start(ctx, "parse")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	childDone()
+	done()
+	event.SetExporter(nil)
+
+	if err := newExporter(t, srv).ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	requests := got["/trace/v1"]
+	if len(requests) != 1 {
+		t.Fatalf("got %d trace requests, want 1", len(requests))
+	}
+	child, parent := f.spans[0], f.spans[1]
+	checkContains(t, requests[0],
+		`[{"common":{"attributes":{"service.name":"gopls"}},"spans":[`,
+		`{"id":"`+child.ID.SpanID.String()+`","trace.id":"`+child.ID.TraceID.String()+`","timestamp":1583418468000,"attributes":{"duration.ms":0,"name":"parse","parent.id":"`+parent.ID.SpanID.String()+`"}}`,
+		`"attributes":{"duration.ms":0,"error.message":"failed: timeout","file":"main.go","name":"hover"}`,
+	)
+}
+
+func TestMetrics(t *testing.T) {
+	srv, got := collector(t)
+	latency := keys.NewFloat64("latency", "")
+	var m metric.Config
+	metric.HistogramFloat64{Name: "latency_ms", Buckets: []float64{1, 10}}.Record(&m, latency)
+	var data []metric.Data
+	event.SetExporter(m.Exporter(export.MetricsOnly(metricsFunc(func(metrics []metric.Data) { data = metrics }))))
+	defer event.SetExporter(nil)
+	event.Metric(context.Background(), latency.Of(2))
+	event.Metric(context.Background(), latency.Of(4))
+
+	if err := newExporter(t, srv).ExportMetrics(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	requests := got["/metric/v1"]
+	if len(requests) != 1 {
+		t.Fatalf("got %d metric requests, want 1", len(requests))
+	}
+	checkContains(t, requests[0],
+		`"metrics":[{"name":"latency_ms","type":"summary","value":{"count":2,"sum":6,"min":2,"max":4}}]`,
+	)
+}
+
+type metricsFunc func([]metric.Data)
+
+func (f metricsFunc) ProcessMetrics(ctx context.Context, metrics []metric.Data) { f(metrics) }
+
+func TestMissingKey(t *testing.T) {
+	if _, err := newrelic.New(&newrelic.Config{}); err == nil {
+		t.Error("exporter created without an API key")
+	}
+}
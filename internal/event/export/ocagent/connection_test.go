@@ -0,0 +1,256 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ocagent_test
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/ocagent"
+)
+
+// agent is a fake agent that records the bodies of the traces it receives,
+// and can be made to refuse them.
+type agent struct {
+	mu     sync.Mutex
+	down   bool
+	traces []string
+	check  func(*http.Request) string
+}
+
+func (a *agent) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.down {
+		http.Error(w, "restarting", http.StatusServiceUnavailable)
+		return
+	}
+	if a.check != nil {
+		if problem := a.check(req); problem != "" {
+			http.Error(w, problem, http.StatusBadRequest)
+			return
+		}
+	}
+	body := req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL.Path == "/v1/trace" {
+		a.traces = append(a.traces, string(data))
+	}
+}
+
+func (a *agent) setDown(down bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.down = down
+}
+
+func (a *agent) received() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.traces...)
+}
+
+// runSpan delivers a finished span named name to the exporter.
+func runSpan(exporter *ocagent.Exporter, name string) {
+	ctx := event.WithExporter(context.Background(), export.Spans(exporter.ProcessEvent))
+	_, done := event.Start(ctx, name)
+	done()
+}
+
+func TestReconnect(t *testing.T) {
+	export.SetErrorHandler(func(error) {})
+	defer export.SetErrorHandler(nil)
+	fake := &agent{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	exporter := ocagent.Connect(&ocagent.Config{
+		Address:   server.URL,
+		Rate:      time.Hour,
+		Reconnect: export.BackoffPolicy{Initial: time.Millisecond},
+	})
+	defer exporter.Shutdown(context.Background())
+	ctx := context.Background()
+
+	fake.setDown(true)
+	runSpan(exporter, "while-down")
+	if err := exporter.Flush(ctx); err == nil {
+		t.Fatal("Flush succeeded while the agent was down")
+	}
+	fake.setDown(false)
+	runSpan(exporter, "after-restart")
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatalf("Flush after the agent restarted: %v", err)
+	}
+	got := fake.received()
+	if len(got) != 1 {
+		t.Fatalf("agent received %d trace requests, want 1", len(got))
+	}
+	for _, name := range []string{"while-down", "after-restart"} {
+		if !strings.Contains(got[0], name) {
+			t.Errorf("span %q was not delivered after the agent restarted", name)
+		}
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	export.SetErrorHandler(func(error) {})
+	defer export.SetErrorHandler(nil)
+	fake := &agent{down: true}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	exporter := ocagent.Connect(&ocagent.Config{
+		Address:   server.URL,
+		Rate:      time.Hour,
+		Reconnect: export.BackoffPolicy{MaxElapsed: -1},
+	})
+	defer exporter.Shutdown(context.Background())
+	ctx := context.Background()
+
+	runSpan(exporter, "dropped")
+	exporter.Flush(ctx)
+	fake.setDown(false)
+	runSpan(exporter, "kept")
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := fake.received()
+	if len(got) != 1 || strings.Contains(got[0], "dropped") || !strings.Contains(got[0], "kept") {
+		t.Errorf("agent received %q, want only the span sent after it came back", got)
+	}
+}
+
+// settableClock is a clock that reads whatever time it was last set to.
+type settableClock struct{ at time.Time }
+
+func (c *settableClock) Now() time.Time { return c.at }
+
+func TestReconnectGivesUpAfterMaxElapsed(t *testing.T) {
+	export.SetErrorHandler(func(error) {})
+	defer export.SetErrorHandler(nil)
+	clock := &settableClock{at: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	event.SetClock(clock)
+	defer event.SetClock(nil)
+	fake := &agent{down: true}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	exporter := ocagent.Connect(&ocagent.Config{
+		Address:   server.URL,
+		Rate:      time.Hour,
+		Reconnect: export.BackoffPolicy{MaxElapsed: time.Minute},
+	})
+	defer exporter.Shutdown(context.Background())
+	ctx := context.Background()
+
+	runSpan(exporter, "held")
+	exporter.Flush(ctx)
+	clock.at = clock.at.Add(30 * time.Second)
+	runSpan(exporter, "dropped")
+	exporter.Flush(ctx)
+	// The agent has now been away for longer than MaxElapsed.
+	clock.at = clock.at.Add(time.Minute)
+	exporter.Flush(ctx)
+	fake.setDown(false)
+	runSpan(exporter, "kept")
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := fake.received()
+	if len(got) != 1 || strings.Contains(got[0], "held") || strings.Contains(got[0], "dropped") || !strings.Contains(got[0], "kept") {
+		t.Errorf("agent received %q, want only the span sent after it came back", got)
+	}
+}
+
+// closeCounter is a transport that counts the calls to CloseIdleConnections.
+type closeCounter struct {
+	http.RoundTripper
+	mu     sync.Mutex
+	closed int
+}
+
+func (c *closeCounter) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed++
+}
+
+func TestReconnectSharedClient(t *testing.T) {
+	export.SetErrorHandler(func(error) {})
+	defer export.SetErrorHandler(nil)
+	fake := &agent{down: true}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	transport := &closeCounter{RoundTripper: http.DefaultTransport}
+	exporter := ocagent.Connect(&ocagent.Config{
+		Address: server.URL,
+		Rate:    time.Hour,
+		Client:  &http.Client{Transport: transport},
+	})
+	defer exporter.Shutdown(context.Background())
+
+	runSpan(exporter, "while-down")
+	if err := exporter.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded while the agent was down")
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.closed != 0 {
+		t.Errorf("exporter closed the connections of the client it was given %d times", transport.closed)
+	}
+}
+
+func TestSecureConnection(t *testing.T) {
+	fake := &agent{check: func(req *http.Request) string {
+		if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+			return "bad Authorization header " + got
+		}
+		if got := req.Header.Get("Content-Encoding"); got != "gzip" {
+			return "bad Content-Encoding header " + got
+		}
+		return ""
+	}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	exporter := ocagent.Connect(&ocagent.Config{
+		Address:  server.URL,
+		Rate:     time.Hour,
+		TLS:      &tls.Config{RootCAs: roots},
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+		Compress: true,
+	})
+	defer exporter.Shutdown(context.Background())
+
+	runSpan(exporter, "secure")
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.received(); len(got) != 1 || !strings.Contains(got[0], "secure") {
+		t.Errorf("agent received %q, want the secure span", got)
+	}
+}
@@ -5,8 +5,10 @@
 package ocagent
 
 import (
+	"fmt"
 	"time"
 
+	"golang.org/x/tools/internal/event/export"
 	"golang.org/x/tools/internal/event/export/metric"
 	"golang.org/x/tools/internal/event/export/ocagent/wire"
 	"golang.org/x/tools/internal/event/label"
@@ -20,9 +22,9 @@ func dataToMetricDescriptor(data metric.Data) *wire.MetricDescriptor {
 	descriptor := &wire.MetricDescriptor{
 		Name:        data.Handle(),
 		Description: getDescription(data),
-		// TODO: Unit?
-		Type:      dataToMetricDescriptorType(data),
-		LabelKeys: getLabelKeys(data),
+		Unit:        metric.UnitOf(data),
+		Type:        dataToMetricDescriptorType(data),
+		LabelKeys:   getLabelKeys(data),
 	}
 
 	return descriptor
@@ -72,13 +74,13 @@ func getLabelKeys(data metric.Data) []*wire.LabelKey {
 func dataToMetricDescriptorType(data metric.Data) wire.MetricDescriptor_Type {
 	switch d := data.(type) {
 	case *metric.Int64Data:
-		if d.IsGauge {
+		if d.IsGauge || d.IsUpDown {
 			return wire.MetricDescriptor_GAUGE_INT64
 		}
 		return wire.MetricDescriptor_CUMULATIVE_INT64
 
 	case *metric.Float64Data:
-		if d.IsGauge {
+		if d.IsGauge || d.IsUpDown {
 			return wire.MetricDescriptor_GAUGE_DOUBLE
 		}
 		return wire.MetricDescriptor_CUMULATIVE_DOUBLE
@@ -103,12 +105,24 @@ func dataToTimeseries(data metric.Data, start time.Time) []*wire.TimeSeries {
 	numRows := numRows(data)
 	startTimestamp := convertTimestamp(start)
 	timeseries := make([]*wire.TimeSeries, 0, numRows)
+	groups := data.Groups()
+	numKeys := len(getLabelKeys(data))
 
 	for i := 0; i < numRows; i++ {
+		var labelValues []*wire.LabelValue
+		if i < len(groups) {
+			group := groups[i]
+			if len(group) > numKeys {
+				// The values must line up with the keys, so the overflow row
+				// of a metric is sent without its overflow label.
+				group = withoutOverflow(group)
+			}
+			labelValues = groupToLabelValues(group)
+		}
 		timeseries = append(timeseries, &wire.TimeSeries{
 			StartTimestamp: &startTimestamp,
-			// TODO: labels?
-			Points: dataToPoints(data, i),
+			LabelValues:    labelValues,
+			Points:         dataToPoints(data, i),
 		})
 	}
 
@@ -199,6 +213,33 @@ func distributionToPoints(counts []int64, count int64, sum float64, bucketBounds
 	}
 }
 
+// groupToLabelValues returns the label values that distinguish the time series
+// of a row, in the order of the label keys of its metric. Keys the row has no
+// label for are sent without a value.
+func groupToLabelValues(group []label.Label) []*wire.LabelValue {
+	labelValues := make([]*wire.LabelValue, len(group))
+	for i, l := range group {
+		labelValues[i] = &wire.LabelValue{}
+		if l.Valid() {
+			labelValues[i].Value = fmt.Sprint(export.LabelValue(l))
+			labelValues[i].HasValue = true
+		}
+	}
+
+	return labelValues
+}
+
+// withoutOverflow returns the group without its metric.Overflow label.
+func withoutOverflow(group []label.Label) []label.Label {
+	result := make([]label.Label, 0, len(group))
+	for _, l := range group {
+		if l.Key() != metric.Overflow {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
 // infoKeysToLabelKeys returns an array of *wire.LabelKeys containing the
 // string values of the elements of labelKeys.
 func infoKeysToLabelKeys(infoKeys []label.Key) []*wire.LabelKey {
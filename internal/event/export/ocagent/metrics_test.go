@@ -49,6 +49,13 @@ func TestEncodeMetric(t *testing.T) {
 				"timeseries": [
 					{
 						"start_timestamp": "1970-01-01T00:00:00Z",
+						"label_values": [
+							{
+								"value": "godoc.ServeHTTP",
+								"has_value": true
+							},
+							{}
+						],
 						"points": [
 							{
 								"timestamp": "1970-01-01T00:00:40Z",
@@ -96,6 +103,13 @@ func TestEncodeMetric(t *testing.T) {
 				"timeseries": [
 					{
 						"start_timestamp": "1970-01-01T00:00:00Z",
+						"label_values": [
+							{
+								"value": "godoc.ServeHTTP",
+								"has_value": true
+							},
+							{}
+						],
 						"points": [
 							{
 								"timestamp": "1970-01-01T00:00:40Z",
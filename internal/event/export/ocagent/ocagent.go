@@ -9,12 +9,16 @@ package ocagent
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,13 +39,63 @@ type Config struct {
 	Service string
 	Address string
 	Rate    time.Duration
+	// Retry controls how failed uploads are retried, the zero value means
+	// they are dropped after a single attempt.
+	Retry export.BackoffPolicy
+	// Headers are added to every request, normally for authentication.
+	Headers map[string]string
+	// TLS configures the connection to an https agent, RootCAs can be set to
+	// trust an agent with a private certificate.
+	// It is ignored if Client is set.
+	TLS *tls.Config
+	// Compress gzips the body of every request.
+	Compress bool
+	// Reconnect controls how the exporter waits for an agent that has gone
+	// away, for example while it restarts.
+	// Telemetry that could not be delivered is held, and the periodic flush
+	// is skipped until the next delay of the policy has passed.
+	// Held telemetry is dropped once the agent has been unreachable for
+	// MaxElapsed, a negative MaxElapsed drops it straight away.
+	// Fields left as zero take their value from DefaultReconnect.
+	Reconnect export.BackoffPolicy
 }
 
+// DefaultReconnect is the policy used for the unset fields of
+// Config.Reconnect.
+var DefaultReconnect = export.BackoffPolicy{
+	Initial:    time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+	MaxElapsed: 5 * time.Minute,
+}
+
+// maxHeld bounds the number of spans, and separately of metrics, held while
+// the agent is unreachable. The oldest are dropped first.
+const maxHeld = 10000
+
 var (
 	connectMu sync.Mutex
-	exporters = make(map[Config]*Exporter)
+	exporters []*Exporter
 )
 
+func init() {
+	export.Register("ocagent", func(address string) (event.Exporter, export.Shutdowner, error) {
+		config := Discover()
+		if address != "" {
+			if !strings.Contains(address, "://") {
+				address = "http://" + address
+			}
+			config.Address = address
+		}
+		exporter := Connect(config)
+		if exporter == nil {
+			return nil, nil, fmt.Errorf("ocagent exporter is disabled")
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
 // Discover finds the local agent to export to, it will return nil if there
 // is not one running.
 // TODO: Actually implement a discovery protocol rather than a hard coded address
@@ -52,10 +106,28 @@ func Discover() *Config {
 }
 
 type Exporter struct {
-	mu      sync.Mutex
+	mu sync.Mutex
+	// key is the configuration Connect was asked for, once defaults that do
+	// not allocate are filled in, it is used to share exporters.
+	key     Config
 	config  Config
 	spans   []*export.Span
 	metrics []metric.Data
+	stop    chan struct{}
+	stopped bool
+	// ownClient is set if the exporter built config.Client itself, and so
+	// may drop its connections.
+	ownClient bool
+	// upload delivers the batches gathered by Flush, retrying as configured.
+	upload export.BatchExporter
+	status export.StatusTracker
+
+	// downSince is when delivery first failed, it is zero while the agent is
+	// reachable. retryAt is when the run loop next tries to deliver, and
+	// backoff the delay that follows the next failure.
+	downSince time.Time
+	retryAt   time.Time
+	backoff   time.Duration
 }
 
 // Connect creates a process specific exporter with the specified
@@ -73,34 +145,98 @@ func Connect(config *Config) *Exporter {
 	if resolved.Process == 0 {
 		resolved.Process = uint32(os.Getpid())
 	}
-	if resolved.Client == nil {
-		resolved.Client = http.DefaultClient
-	}
 	if resolved.Service == "" {
 		resolved.Service = filepath.Base(os.Args[0])
 	}
 	if resolved.Rate == 0 {
 		resolved.Rate = 2 * time.Second
 	}
+	if resolved.Reconnect.Initial <= 0 {
+		resolved.Reconnect.Initial = DefaultReconnect.Initial
+	}
+	if resolved.Reconnect.Max <= 0 {
+		resolved.Reconnect.Max = DefaultReconnect.Max
+	}
+	if resolved.Reconnect.Multiplier < 1 {
+		resolved.Reconnect.Multiplier = DefaultReconnect.Multiplier
+	}
+	if resolved.Reconnect.Jitter == 0 {
+		resolved.Reconnect.Jitter = DefaultReconnect.Jitter
+	}
+	if resolved.Reconnect.MaxElapsed == 0 {
+		resolved.Reconnect.MaxElapsed = DefaultReconnect.MaxElapsed
+	}
 
 	connectMu.Lock()
 	defer connectMu.Unlock()
-	if exporter, found := exporters[resolved]; found {
-		return exporter
+	for _, exporter := range exporters {
+		if sameConfig(&exporter.key, &resolved) {
+			return exporter
+		}
+	}
+	exporter := &Exporter{key: resolved, config: resolved, stop: make(chan struct{})}
+	if exporter.config.Client == nil {
+		// Use a transport of our own, so dropping its connections when the
+		// agent goes away does not disturb anyone else.
+		exporter.config.Client = export.HTTPClient(resolved.TLS)
+		exporter.ownClient = true
 	}
-	exporter := &Exporter{config: resolved}
-	exporters[resolved] = exporter
+	exporter.upload = export.Retry(exporter, resolved.Retry)
+	exporters = append(exporters, exporter)
 	if exporter.config.Start.IsZero() {
-		exporter.config.Start = time.Now()
+		exporter.config.Start = core.Now()
 	}
-	go func() {
-		for range time.Tick(exporter.config.Rate) {
-			exporter.Flush()
-		}
-	}()
+	go exporter.run()
+	export.Manage(exporter)
 	return exporter
 }
 
+// sameConfig reports whether two configurations describe the same exporter.
+// Config cannot be compared with == because of its Headers.
+func sameConfig(a, b *Config) bool {
+	if len(a.Headers) != len(b.Headers) {
+		return false
+	}
+	for k, v := range a.Headers {
+		if other, found := b.Headers[k]; !found || other != v {
+			return false
+		}
+	}
+	return a.Start.Equal(b.Start) &&
+		a.Host == b.Host &&
+		a.Process == b.Process &&
+		a.Client == b.Client &&
+		a.Service == b.Service &&
+		a.Address == b.Address &&
+		a.Rate == b.Rate &&
+		a.Retry == b.Retry &&
+		a.TLS == b.TLS &&
+		a.Compress == b.Compress &&
+		a.Reconnect == b.Reconnect
+}
+
+// run periodically flushes the exporter until it is shut down.
+func (e *Exporter) run() {
+	ticker := time.NewTicker(e.config.Rate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !e.due(core.Now()) {
+				// The agent is away, wait for the backoff to expire.
+				continue
+			}
+			ctx, cancel := export.TimeoutContext(context.Background())
+			e.Flush(ctx)
+			cancel()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
 func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
 	switch {
 	case event.IsEnd(ev):
@@ -119,34 +255,171 @@ func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map
 	return ctx
 }
 
-func (e *Exporter) Flush() {
+// Flush sends all the spans and metrics gathered since the last flush to the
+// agent.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans, metrics := e.spans, e.metrics
+	e.spans, e.metrics = nil, nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 && len(metrics) == 0 {
+		return nil
+	}
+	var firstErr error
+	var failedSpans []*export.Span
+	var failedMetrics []metric.Data
+	if len(spans) > 0 {
+		if err := e.upload.ExportSpans(ctx, spans); err != nil {
+			firstErr, failedSpans = err, spans
+		}
+	}
+	if len(metrics) > 0 {
+		if err := e.upload.ExportMetrics(ctx, metrics); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failedMetrics = metrics
+		}
+	}
+	if firstErr == nil {
+		e.connected()
+	} else {
+		e.disconnected(failedSpans, failedMetrics)
+	}
+	return firstErr
+}
+
+// due reports whether the periodic flush should be attempted, which it is
+// unless the agent is unreachable and the backoff has not yet expired.
+func (e *Exporter) due(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !now.Before(e.retryAt)
+}
+
+// connected resets the backoff after a successful delivery.
+func (e *Exporter) connected() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	spans := make([]*wire.Span, len(e.spans))
-	for i, s := range e.spans {
-		spans[i] = convertSpan(s)
+	e.downSince, e.retryAt, e.backoff = time.Time{}, time.Time{}, 0
+}
+
+// disconnected extends the backoff after a failed delivery, and holds on to
+// the telemetry that was not delivered so that it can be offered again.
+func (e *Exporter) disconnected(spans []*export.Span, metrics []metric.Data) {
+	// The failure may have been on a connection to an agent that has since
+	// restarted, make sure the next attempt dials afresh. A client supplied
+	// by the caller may be shared, so its connections are left alone.
+	if e.ownClient {
+		e.config.Client.CloseIdleConnections()
+	}
+	policy := e.config.Reconnect
+	now := core.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.downSince.IsZero() {
+		e.downSince, e.backoff = now, policy.Initial
+	}
+	wait := e.backoff
+	if policy.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * policy.Jitter * float64(e.backoff))
+	}
+	e.retryAt = now.Add(wait)
+	e.backoff = time.Duration(float64(e.backoff) * policy.Multiplier)
+	if e.backoff > policy.Max {
+		e.backoff = policy.Max
 	}
-	e.spans = nil
-	metrics := make([]*wire.Metric, len(e.metrics))
-	for i, m := range e.metrics {
-		metrics[i] = convertMetric(m, e.config.Start)
+	if e.stopped || now.Sub(e.downSince) > policy.MaxElapsed {
+		// The failures have already been reported, give up on the telemetry.
+		return
 	}
-	e.metrics = nil
+	e.spans = hold(spans, e.spans)
+	e.metrics = holdMetrics(metrics, e.metrics)
+}
 
-	if len(spans) > 0 {
-		e.send("/v1/trace", &wire.ExportTraceServiceRequest{
-			Node:  e.config.buildNode(),
-			Spans: spans,
-			//TODO: Resource?
-		})
+// hold returns the failed spans followed by those gathered since, keeping the
+// newest maxHeld.
+func hold(failed, gathered []*export.Span) []*export.Span {
+	if len(failed) == 0 {
+		return gathered
 	}
-	if len(metrics) > 0 {
-		e.send("/v1/metrics", &wire.ExportMetricsServiceRequest{
-			Node:    e.config.buildNode(),
-			Metrics: metrics,
-			//TODO: Resource?
-		})
+	all := append(failed, gathered...)
+	if len(all) > maxHeld {
+		all = all[len(all)-maxHeld:]
 	}
+	return all
+}
+
+// holdMetrics is like hold for metrics.
+func holdMetrics(failed, gathered []metric.Data) []metric.Data {
+	if len(failed) == 0 {
+		return gathered
+	}
+	all := append(failed, gathered...)
+	if len(all) > maxHeld {
+		all = all[len(all)-maxHeld:]
+	}
+	return all
+}
+
+// ExportSpans sends the spans to the agent immediately.
+// It allows the exporter to be used as an export.BatchExporter.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	converted := make([]*wire.Span, len(spans))
+	for i, s := range spans {
+		converted[i] = convertSpan(s)
+	}
+	err := e.send(ctx, "/v1/trace", &wire.ExportTraceServiceRequest{
+		Node:  e.config.buildNode(),
+		Spans: converted,
+		//TODO: Resource?
+	})
+	e.status.Record(err)
+	return err
+}
+
+// ExportMetrics sends the metrics to the agent immediately.
+// It allows the exporter to be used as an export.BatchExporter.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	converted := make([]*wire.Metric, len(metrics))
+	for i, m := range metrics {
+		converted[i] = convertMetric(m, e.config.Start)
+	}
+	err := e.send(ctx, "/v1/metrics", &wire.ExportMetricsServiceRequest{
+		Node:    e.config.buildNode(),
+		Metrics: converted,
+		//TODO: Resource?
+	})
+	e.status.Record(err)
+	return err
+}
+
+// Status reports whether the agent is accepting telemetry.
+func (e *Exporter) Status() export.Status {
+	return e.status.Current("ocagent " + e.config.Address)
+}
+
+// Shutdown stops the periodic flushing of the exporter and delivers any
+// remaining telemetry.
+// The exporter should not be used after it has been shut down.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	connectMu.Lock()
+	for i, exporter := range exporters {
+		if exporter == e {
+			exporters = append(exporters[:i:i], exporters[i+1:]...)
+			break
+		}
+	}
+	connectMu.Unlock()
+	e.mu.Lock()
+	if !e.stopped {
+		e.stopped = true
+		close(e.stop)
+	}
+	e.mu.Unlock()
+	export.Unmanage(e)
+	return e.Flush(ctx)
 }
 
 func (cfg *Config) buildNode() *wire.Node {
@@ -167,32 +440,54 @@ func (cfg *Config) buildNode() *wire.Node {
 	}
 }
 
-func (e *Exporter) send(endpoint string, message interface{}) {
+func (e *Exporter) send(ctx context.Context, endpoint string, message interface{}) error {
 	blob, err := json.Marshal(message)
 	if err != nil {
-		errorInExport("ocagent failed to marshal message for %v: %v", endpoint, err)
-		return
+		return errorInExport("ocagent failed to marshal message for %v: %v", endpoint, err)
+	}
+	if e.config.Compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(blob); err != nil {
+			return errorInExport("ocagent failed to compress message for %v: %v", endpoint, err)
+		}
+		if err := zw.Close(); err != nil {
+			return errorInExport("ocagent failed to compress message for %v: %v", endpoint, err)
+		}
+		blob = buf.Bytes()
 	}
 	uri := e.config.Address + endpoint
-	req, err := http.NewRequest("POST", uri, bytes.NewReader(blob))
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(blob))
 	if err != nil {
-		errorInExport("ocagent failed to build request for %v: %v", uri, err)
-		return
+		return errorInExport("ocagent failed to build request for %v: %v", uri, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if e.config.Compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
 	res, err := e.config.Client.Do(req)
 	if err != nil {
-		errorInExport("ocagent failed to send message: %v \n", err)
-		return
+		return errorInExport("ocagent failed to send message: %v", err)
 	}
 	if res.Body != nil {
 		res.Body.Close()
 	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errorInExport("ocagent rejected message for %v: %v", uri, res.Status)
+	}
+	return nil
 }
 
-func errorInExport(message string, args ...interface{}) {
-	// This function is useful when debugging the exporter, but in general we
-	// want to just drop any export
+func errorInExport(message string, args ...interface{}) error {
+	// The failed telemetry may be held for another attempt or dropped, but we
+	// report the failure either way so that a broken pipeline does not go
+	// unnoticed.
+	err := fmt.Errorf(message, args...)
+	export.ReportError(err)
+	return err
 }
 
 func convertTimestamp(t time.Time) wire.Timestamp {
@@ -216,17 +511,75 @@ func convertSpan(span *export.Span) *wire.Span {
 		Kind:                    wire.UnspecifiedSpanKind,
 		StartTime:               convertTimestamp(span.Start().At()),
 		EndTime:                 convertTimestamp(span.Finish().At()),
-		Attributes:              convertAttributes(span.Start(), 1),
+		Attributes:              convertSpanAttributes(span),
 		TimeEvents:              convertEvents(span.Events()),
+		Links:                   convertLinks(span.Links()),
+		Status:                  convertStatus(span.Status()),
 		SameProcessAsParentSpan: true,
 		//TODO: StackTrace?
-		//TODO: Links?
-		//TODO: Status?
 		//TODO: Resource?
 	}
 	return result
 }
 
+// statusUnknown is the gRPC code of an unknown error, which OpenCensus uses
+// for failures that have no more specific code.
+const statusUnknown = 2
+
+// convertStatus returns the status of a failed span. A missing status means
+// the span succeeded, so one that is unset or OK has none.
+func convertStatus(status export.SpanStatus) *wire.Status {
+	if status.Code != export.SpanStatusError {
+		return nil
+	}
+	return &wire.Status{Code: statusUnknown, Message: status.Message}
+}
+
+func convertLinks(links []export.Link) *wire.Links {
+	if len(links) == 0 {
+		return nil
+	}
+	result := &wire.Links{}
+	for i := range links {
+		link := &links[i]
+		converted := &wire.Link{
+			TraceID: link.ID.TraceID[:],
+			SpanID:  link.ID.SpanID[:],
+			Type:    wire.UnspecifiedLinkType,
+		}
+		for _, l := range link.Labels {
+			if !l.Valid() {
+				continue
+			}
+			if converted.Attributes == nil {
+				converted.Attributes = &wire.Attributes{AttributeMap: make(map[string]wire.Attribute)}
+			}
+			converted.Attributes.AttributeMap[l.Key().Name()] = convertAttribute(l)
+		}
+		result.Link = append(result.Link, converted)
+	}
+	return result
+}
+
+// convertSpanAttributes merges the labels the span was started with and the
+// ones added by span processors.
+func convertSpanAttributes(span *export.Span) *wire.Attributes {
+	attributes := convertAttributes(span.Start(), 1)
+	extra := span.Labels()
+	if len(extra) == 0 {
+		return attributes
+	}
+	if attributes == nil {
+		attributes = &wire.Attributes{AttributeMap: make(map[string]wire.Attribute)}
+	}
+	for _, l := range extra {
+		if l.Valid() {
+			attributes.AttributeMap[l.Key().Name()] = convertAttribute(l)
+		}
+	}
+	return attributes
+}
+
 func convertMetric(data metric.Data, start time.Time) *wire.Metric {
 	descriptor := dataToMetricDescriptor(data)
 	timeseries := dataToTimeseries(data, start)
@@ -151,7 +151,7 @@ func spanFixer(output event.Exporter) event.Exporter {
 }
 
 func (e *testExporter) Output(route string) []byte {
-	e.ocagent.Flush()
+	e.ocagent.Flush(context.Background())
 	return e.sent.get(route)
 }
 
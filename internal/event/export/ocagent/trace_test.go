@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
 )
 
 func TestTrace(t *testing.T) {
@@ -29,6 +30,15 @@ func TestTrace(t *testing.T) {
 		"same_process_as_parent_span":true
 	}]
 }`
+	// A span that logged an error has failed.
+	failedSuffix := func(message string) string {
+		return `
+		},
+		"status":{"code":2,"message":"` + message + `"},
+		"same_process_as_parent_span":true
+	}]
+}`
+	}
 
 	tests := []struct {
 		name string
@@ -75,7 +85,7 @@ func TestTrace(t *testing.T) {
 		"error": { "stringValue": { "value": "no network connectivity" } }
 	}
 }
-}}]` + suffix,
+}}]` + failedSuffix("cache miss: no network connectivity"),
 		},
 		{
 			name: "no description, but error",
@@ -92,7 +102,17 @@ func TestTrace(t *testing.T) {
 		"db": { "stringValue": { "value": "godb" } }
 	}
 }
-}}]` + suffix,
+}}]` + failedSuffix("no network connectivity"),
+		},
+		{
+			name: "status set on the span",
+			run: func(ctx context.Context) {
+				event.Label(ctx)
+				export.GetSpan(ctx).SetStatus(export.SpanStatusError, "timed out")
+			},
+			want: prefix + `
+					"timeEvent":[{"time":"1970-01-01T00:00:40Z"}]
+		` + failedSuffix("timed out"),
 		},
 		{
 			name: "enumerate all attribute types",
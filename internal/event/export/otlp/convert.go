@@ -0,0 +1,313 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import (
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func convertTimestamp(t time.Time) Uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return Uint64(t.UnixNano())
+}
+
+func convertSpan(span *export.Span) *Span {
+	result := &Span{
+		TraceID:           span.ID.TraceID.String(),
+		SpanID:            span.ID.SpanID.String(),
+		Name:              span.Name,
+		Kind:              SpanKindInternal,
+		StartTimeUnixNano: convertTimestamp(span.Start().At()),
+		EndTimeUnixNano:   convertTimestamp(span.Finish().At()),
+		Attributes:        append(convertList(span.Start(), 1), convertLabels(span.Labels())...),
+	}
+	if span.ParentID.IsValid() {
+		result.ParentSpanID = span.ParentID.String()
+	}
+	for _, ev := range span.Events() {
+		if !event.IsLog(ev) {
+			continue
+		}
+		name, index := eventName(ev)
+		result.Events = append(result.Events, &SpanEvent{
+			TimeUnixNano: convertTimestamp(ev.At()),
+			Name:         name,
+			Attributes:   convertList(ev, index),
+		})
+	}
+	switch status := span.Status(); status.Code {
+	case export.SpanStatusOK:
+		result.Status = &Status{Code: StatusCodeOK}
+	case export.SpanStatusError:
+		result.Status = &Status{Code: StatusCodeError, Message: status.Message}
+	}
+	for _, link := range span.Links() {
+		result.Links = append(result.Links, &SpanLink{
+			TraceID:    link.ID.TraceID.String(),
+			SpanID:     link.ID.SpanID.String(),
+			Attributes: convertLabels(link.Labels),
+		})
+	}
+	return result
+}
+
+// eventName returns the name of a log event, and the index of the first label
+// that is not part of the name.
+func eventName(ev core.Event) (string, int) {
+	msg := keys.Msg.From(ev.Label(0))
+	if !event.IsError(ev) {
+		return msg, 1
+	}
+	err := keys.Err.From(ev.Label(1))
+	switch {
+	case err == nil:
+		return msg, 2
+	case msg == "":
+		return err.Error(), 2
+	default:
+		return msg + ": " + err.Error(), 2
+	}
+}
+
+func convertList(list label.List, index int) []KeyValue {
+	var result []KeyValue
+	for ; list.Valid(index); index++ {
+		if l := list.Label(index); l.Valid() {
+			result = append(result, convertLabel(l))
+		}
+	}
+	return result
+}
+
+func convertLabels(labels []label.Label) []KeyValue {
+	var result []KeyValue
+	for _, l := range labels {
+		if l.Valid() {
+			result = append(result, convertLabel(l))
+		}
+	}
+	return result
+}
+
+func convertLabel(l label.Label) KeyValue {
+	kv := KeyValue{Key: l.Key().Name()}
+	switch v := export.LabelValue(l).(type) {
+	case int64:
+		i := Int64(v)
+		kv.Value.IntValue = &i
+	case uint64:
+		i := Int64(v)
+		kv.Value.IntValue = &i
+	case float64:
+		kv.Value.DoubleValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case string:
+		kv.Value.StringValue = &v
+	}
+	return kv
+}
+
+// convertMetric converts data, whose sums and histograms are the change since
+// they were last exported if delta is set. Data without a StartTime of its own
+// starts at start.
+func convertMetric(data metric.Data, start time.Time, delta bool) *Metric {
+	groups := data.Groups()
+	temporality := TemporalityCumulative
+	if delta {
+		temporality = TemporalityDelta
+	}
+	switch d := data.(type) {
+	case *metric.Int64Data:
+		start = startTime(start, d.StartTime)
+		points := make([]*NumberDataPoint, len(d.Rows))
+		for i, v := range d.Rows {
+			value := Int64(v)
+			points[i] = numberPoint(groups, i, start, d.EndTime, d.IsGauge)
+			points[i].AsInt = &value
+		}
+		return numberMetric(d.Info, points, d.IsGauge, d.IsUpDown, temporality)
+	case *metric.Float64Data:
+		start = startTime(start, d.StartTime)
+		points := make([]*NumberDataPoint, len(d.Rows))
+		for i, v := range d.Rows {
+			value := v
+			points[i] = numberPoint(groups, i, start, d.EndTime, d.IsGauge)
+			points[i].AsDouble = &value
+		}
+		return numberMetric(d.Info, points, d.IsGauge, d.IsUpDown, temporality)
+	case *metric.HistogramInt64Data:
+		bounds := make([]float64, len(d.Info.Buckets))
+		for i, b := range d.Info.Buckets {
+			bounds[i] = float64(b)
+		}
+		start = startTime(start, d.StartTime)
+		points := make([]*HistogramDataPoint, len(d.Rows))
+		for i, row := range d.Rows {
+			sum, min, max := float64(row.Sum), float64(row.Min), float64(row.Max)
+			points[i] = histogramPoint(groups, i, start, d.EndTime, bounds, row.Values, row.Count)
+			points[i].Exemplars = convertExemplars(row.Exemplars)
+			points[i].Sum = &sum
+			if row.Count > 0 {
+				points[i].Min, points[i].Max = &min, &max
+			}
+		}
+		return histogramMetric(d.Info.Name, d.Info.Description, d.Info.Unit, points, temporality)
+	case *metric.HistogramFloat64Data:
+		start = startTime(start, d.StartTime)
+		points := make([]*HistogramDataPoint, len(d.Rows))
+		for i, row := range d.Rows {
+			sum, min, max := row.Sum, row.Min, row.Max
+			points[i] = histogramPoint(groups, i, start, d.EndTime, d.Info.Buckets, row.Values, row.Count)
+			points[i].Exemplars = convertExemplars(row.Exemplars)
+			points[i].Sum = &sum
+			if row.Count > 0 {
+				points[i].Min, points[i].Max = &min, &max
+			}
+		}
+		return histogramMetric(d.Info.Name, d.Info.Description, d.Info.Unit, points, temporality)
+	case *metric.ExponentialHistogramData:
+		start = startTime(start, d.StartTime)
+		points := make([]*ExponentialHistogramDataPoint, len(d.Rows))
+		for i, row := range d.Rows {
+			sum, min, max := row.Sum, row.Min, row.Max
+			points[i] = &ExponentialHistogramDataPoint{
+				StartTimeUnixNano: convertTimestamp(start),
+				TimeUnixNano:      convertTimestamp(d.EndTime),
+				Count:             Uint64(row.Count),
+				Sum:               &sum,
+				Scale:             row.Scale,
+				ZeroCount:         Uint64(row.ZeroCount),
+				Positive:          convertBuckets(row.Positive),
+				Negative:          convertBuckets(row.Negative),
+			}
+			if row.Count > 0 {
+				points[i].Min, points[i].Max = &min, &max
+			}
+			if i < len(groups) {
+				points[i].Attributes = convertLabels(groups[i])
+			}
+		}
+		return &Metric{
+			Name:        d.Info.Name,
+			Description: d.Info.Description,
+			Unit:        d.Info.Unit,
+			ExponentialHistogram: &ExponentialHistogram{
+				DataPoints:             points,
+				AggregationTemporality: temporality,
+			},
+		}
+	}
+	return nil
+}
+
+// startTime returns the start of the interval data covers.
+func startTime(start, dataStart time.Time) time.Time {
+	if !dataStart.IsZero() {
+		return dataStart
+	}
+	return start
+}
+
+func numberPoint(groups [][]label.Label, row int, start, end time.Time, isGauge bool) *NumberDataPoint {
+	point := &NumberDataPoint{TimeUnixNano: convertTimestamp(end)}
+	if row < len(groups) {
+		point.Attributes = convertLabels(groups[row])
+	}
+	if !isGauge {
+		point.StartTimeUnixNano = convertTimestamp(start)
+	}
+	return point
+}
+
+func numberMetric(info *metric.Scalar, points []*NumberDataPoint, isGauge, isUpDown bool, temporality int) *Metric {
+	m := &Metric{Name: info.Name, Description: info.Description, Unit: info.Unit}
+	if isGauge {
+		m.Gauge = &Gauge{DataPoints: points}
+	} else {
+		m.Sum = &Sum{
+			DataPoints:             points,
+			AggregationTemporality: temporality,
+			IsMonotonic:            !isUpDown,
+		}
+		if isUpDown {
+			// Up down counters are never converted to deltas.
+			m.Sum.AggregationTemporality = TemporalityCumulative
+		}
+	}
+	return m
+}
+
+// histogramPoint converts a histogram row, whose values count the recorded
+// values at or below each bound, into the separate bucket counts OTLP uses.
+func histogramPoint(groups [][]label.Label, row int, start, end time.Time, bounds []float64, values []int64, count int64) *HistogramDataPoint {
+	point := &HistogramDataPoint{
+		StartTimeUnixNano: convertTimestamp(start),
+		TimeUnixNano:      convertTimestamp(end),
+		Count:             Uint64(count),
+		ExplicitBounds:    bounds,
+		BucketCounts:      make([]Uint64, len(values)+1),
+	}
+	if row < len(groups) {
+		point.Attributes = convertLabels(groups[row])
+	}
+	var below int64
+	for i, v := range values {
+		point.BucketCounts[i] = Uint64(v - below)
+		below = v
+	}
+	point.BucketCounts[len(values)] = Uint64(count - below)
+	return point
+}
+
+// convertExemplars returns the exemplars of the buckets that have one.
+func convertExemplars(exemplars []*metric.Exemplar) []*Exemplar {
+	var result []*Exemplar
+	for _, ex := range exemplars {
+		if ex == nil {
+			continue
+		}
+		value := ex.Value
+		result = append(result, &Exemplar{
+			TimeUnixNano: convertTimestamp(ex.Time),
+			AsDouble:     &value,
+			SpanID:       ex.SpanID,
+			TraceID:      ex.TraceID,
+		})
+	}
+	return result
+}
+
+func histogramMetric(name, description, unit string, points []*HistogramDataPoint, temporality int) *Metric {
+	return &Metric{
+		Name:        name,
+		Description: description,
+		Unit:        unit,
+		Histogram: &Histogram{
+			DataPoints:             points,
+			AggregationTemporality: temporality,
+		},
+	}
+}
+
+func convertBuckets(b metric.ExponentialBuckets) *ExponentialBuckets {
+	if len(b.Counts) == 0 {
+		return nil
+	}
+	counts := make([]Uint64, len(b.Counts))
+	for i, c := range b.Counts {
+		counts[i] = Uint64(c)
+	}
+	return &ExponentialBuckets{Offset: b.Offset, BucketCounts: counts}
+}
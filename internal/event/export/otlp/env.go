@@ -0,0 +1,173 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Environment variables defined by the OpenTelemetry specification.
+// Values set in a Config take precedence over them.
+const (
+	// EndpointEnv is the base URL of the collector.
+	EndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// HeadersEnv holds headers added to every request, in the form accepted
+	// by ParseHeaders.
+	HeadersEnv = "OTEL_EXPORTER_OTLP_HEADERS"
+	// ServiceNameEnv is the service.name resource attribute.
+	ServiceNameEnv = "OTEL_SERVICE_NAME"
+	// SamplerEnv selects which traces are exported, see SampleFraction.
+	SamplerEnv = "OTEL_TRACES_SAMPLER"
+	// SamplerArgEnv is the ratio used by the traceidratio samplers.
+	SamplerArgEnv = "OTEL_TRACES_SAMPLER_ARG"
+	// TemporalityEnv selects the temporality of metrics, see
+	// TemporalityPreference.
+	TemporalityEnv = "OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE"
+	// IntervalEnv is the number of milliseconds between pushes of metrics,
+	// see ExportInterval.
+	IntervalEnv = "OTEL_METRIC_EXPORT_INTERVAL"
+)
+
+// DefaultExportInterval is the time between pushes of metrics required by the
+// specification when OTEL_METRIC_EXPORT_INTERVAL is not set.
+const DefaultExportInterval = time.Minute
+
+// ParseHeaders parses a comma separated list of key=value pairs whose values
+// are URL encoded, as found in OTEL_EXPORTER_OTLP_HEADERS.
+// On error it returns the headers parsed from the valid pairs, along with an
+// error describing the first invalid one.
+func ParseHeaders(list string) (map[string]string, error) {
+	headers := make(map[string]string)
+	var firstErr error
+	for _, pair := range strings.Split(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, '=')
+		var key, value string
+		var err error
+		if i > 0 {
+			key = strings.TrimSpace(pair[:i])
+			value, err = url.PathUnescape(strings.TrimSpace(pair[i+1:]))
+		}
+		if key == "" || err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("otlp: invalid header %q", pair)
+			}
+			continue
+		}
+		headers[key] = value
+	}
+	return headers, firstErr
+}
+
+// SampleFraction returns the fraction of traces selected by the sampler named
+// in OTEL_TRACES_SAMPLER.
+// The always_on and always_off samplers select every trace or none, and the
+// traceidratio sampler selects the fraction in OTEL_TRACES_SAMPLER_ARG,
+// which defaults to 1. Sampling decisions are made from the trace ID, so the
+// parentbased variants of these samplers behave the same way.
+// An unknown sampler, or an invalid fraction, is an error, and the
+// default of selecting every trace is returned along with it.
+func SampleFraction() (float64, error) {
+	switch sampler := os.Getenv(SamplerEnv); sampler {
+	case "", "always_on", "parentbased_always_on":
+		return 1, nil
+	case "always_off", "parentbased_always_off":
+		return 0, nil
+	case "traceidratio", "parentbased_traceidratio":
+		arg := os.Getenv(SamplerArgEnv)
+		if arg == "" {
+			return 1, nil
+		}
+		fraction, err := strconv.ParseFloat(arg, 64)
+		if err != nil || fraction < 0 || fraction > 1 {
+			return 1, fmt.Errorf("otlp: %s=%q is not a fraction between 0 and 1", SamplerArgEnv, arg)
+		}
+		return fraction, nil
+	default:
+		return 1, fmt.Errorf("otlp: unsupported sampler %s=%q", SamplerEnv, sampler)
+	}
+}
+
+// TemporalityPreference returns the temporality selected by
+// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE.
+// Both the delta and lowmemory preferences select metric.Delta, as every
+// counter and histogram is updated synchronously by metric events.
+// An unknown preference is an error, and metric.Cumulative is returned along
+// with it.
+func TemporalityPreference() (metric.Temporality, error) {
+	switch preference := strings.ToLower(os.Getenv(TemporalityEnv)); preference {
+	case "", "cumulative":
+		return metric.Cumulative, nil
+	case "delta", "lowmemory":
+		return metric.Delta, nil
+	default:
+		return metric.Cumulative, fmt.Errorf("otlp: unsupported temporality %s=%q", TemporalityEnv, preference)
+	}
+}
+
+// ExportInterval returns the time between pushes of metrics set by
+// OTEL_METRIC_EXPORT_INTERVAL, which is a number of milliseconds.
+// An invalid interval is an error, and DefaultExportInterval is returned
+// along with it.
+func ExportInterval() (time.Duration, error) {
+	value := os.Getenv(IntervalEnv)
+	if value == "" {
+		return DefaultExportInterval, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return DefaultExportInterval, fmt.Errorf("otlp: %s=%q is not a positive number of milliseconds", IntervalEnv, value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Sampled wraps output so that it only sees the traces selected by the
+// environment, see SampleFraction. Configuration errors are passed to
+// export.ReportError, and leave every trace selected.
+// Like export.Sampled, the result must be wrapped by export.Spans.
+func Sampled(output event.Exporter) event.Exporter {
+	fraction, err := SampleFraction()
+	export.ReportError(err)
+	return export.Sampled(output, fraction)
+}
+
+// Factory returns the export.Factory registered by a transport package,
+// newClient builds the Client for an endpoint. An endpoint without a scheme
+// is reached over http.
+// The exporters it builds deliver spans in batches, and push metrics once
+// per the interval set by OTEL_METRIC_EXPORT_INTERVAL from an
+// export.PeriodicReader, sampling traces as the environment selects.
+func Factory(newClient func(endpoint string) Client) export.Factory {
+	return func(endpoint string) (event.Exporter, export.Shutdowner, error) {
+		if endpoint != "" && !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		exporter := New(&Config{Client: newClient(endpoint)})
+		interval, err := ExportInterval()
+		export.ReportError(err)
+		spans := export.Batch(exporter, 512, 2*time.Second)
+		metrics := export.Periodic(exporter, interval, interval/10)
+		return Sampled(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsMetric(ev) {
+				return metrics.ProcessEvent(ctx, ev, lm)
+			}
+			return spans.ProcessEvent(ctx, ev, lm)
+		}), export.ShutdownAll(spans, metrics), nil
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/otlp"
+)
+
+func TestParseHeaders(t *testing.T) {
+	got, err := otlp.ParseHeaders("api-key=secret, Authorization=Basic%20dXNlcg%3D%3D,,bad,=x")
+	want := map[string]string{"api-key": "secret", "Authorization": "Basic dXNlcg=="}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got headers %v, want %v", got, want)
+	}
+	if err == nil {
+		t.Error("invalid headers were not reported")
+	}
+	if _, err := otlp.ParseHeaders("a=1,b=2"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSampleFraction(t *testing.T) {
+	for _, test := range []struct {
+		sampler, arg string
+		want         float64
+		ok           bool
+	}{
+		{"", "", 1, true},
+		{"always_on", "", 1, true},
+		{"parentbased_always_off", "", 0, true},
+		{"traceidratio", "0.25", 0.25, true},
+		{"parentbased_traceidratio", "", 1, true},
+		{"traceidratio", "2", 1, false},
+		{"jaeger_remote", "", 1, false},
+	} {
+		t.Setenv(otlp.SamplerEnv, test.sampler)
+		t.Setenv(otlp.SamplerArgEnv, test.arg)
+		got, err := otlp.SampleFraction()
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("%s=%q %s=%q: got %v, %v, want %v and ok %v", otlp.SamplerEnv, test.sampler, otlp.SamplerArgEnv, test.arg, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestTemporalityPreference(t *testing.T) {
+	for _, test := range []struct {
+		preference string
+		want       metric.Temporality
+		ok         bool
+	}{
+		{"", metric.Cumulative, true},
+		{"Cumulative", metric.Cumulative, true},
+		{"delta", metric.Delta, true},
+		{"lowmemory", metric.Delta, true},
+		{"sometimes", metric.Cumulative, false},
+	} {
+		t.Setenv(otlp.TemporalityEnv, test.preference)
+		got, err := otlp.TemporalityPreference()
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("%s=%q: got %v, %v, want %v and ok %v", otlp.TemporalityEnv, test.preference, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestExportInterval(t *testing.T) {
+	for _, test := range []struct {
+		interval string
+		want     time.Duration
+		ok       bool
+	}{
+		{"", otlp.DefaultExportInterval, true},
+		{"5000", 5 * time.Second, true},
+		{"0", otlp.DefaultExportInterval, false},
+		{"5s", otlp.DefaultExportInterval, false},
+	} {
+		t.Setenv(otlp.IntervalEnv, test.interval)
+		got, err := otlp.ExportInterval()
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("%s=%q: got %v, %v, want %v and ok %v", otlp.IntervalEnv, test.interval, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestServiceNameEnv(t *testing.T) {
+	t.Setenv(otlp.ServiceNameEnv, "checkout")
+	client := &fakeClient{}
+	exporter := otlp.New(&otlp.Config{Client: client})
+	if err := exporter.ExportSpans(context.Background(), []*export.Span{}); err != nil {
+		t.Fatal(err)
+	}
+	checkContains(t, client.sent[0], `{"key":"service.name","value":{"stringValue":"checkout"}}`)
+}
+
+func TestFactory(t *testing.T) {
+	client := &fakeClient{}
+	var endpoint string
+	factory := otlp.Factory(func(e string) otlp.Client {
+		endpoint = e
+		return client
+	})
+	exporter, shutdown, err := factory("collector:4317")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "http://collector:4317" {
+		t.Errorf("client was built for %q, want http://collector:4317", endpoint)
+	}
+	ctx := event.WithExporter(context.Background(), export.Spans(exporter))
+	_, end := event.Start(ctx, "factory-span")
+	end()
+	if err := shutdown.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sent) != 1 {
+		t.Fatalf("collector got %d requests, want the batched span", len(client.sent))
+	}
+	checkContains(t, client.sent[0], `"name":"factory-span"`)
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otlp converts telemetry into the OpenTelemetry Protocol data model.
+//
+// The Exporter is an export.BatchExporter that hands the converted spans and
+// metrics to a Client, which is responsible for the transport.
+// Package otlpgrpc provides a Client for OTLP over gRPC, and package otlphttp
+// one for OTLP over HTTP.
+// The Exporter should normally be wrapped by export.Batch.
+package otlp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Client delivers OTLP requests to a collector.
+type Client interface {
+	UploadTraces(ctx context.Context, request *TracesRequest) error
+	UploadMetrics(ctx context.Context, request *MetricsRequest) error
+}
+
+// Config describes the process that is exporting telemetry.
+type Config struct {
+	// Client delivers the requests.
+	Client Client
+	// Service is the service.name resource attribute, it defaults to the
+	// value of OTEL_SERVICE_NAME, or the name of the binary.
+	Service string
+	// Host is the host.name resource attribute, it defaults to the hostname.
+	Host string
+	// Process is the process.pid resource attribute, it defaults to the
+	// current process.
+	Process uint32
+	// Resource holds any extra resource attributes.
+	Resource []label.Label
+	// Start is the start time of cumulative metrics, it defaults to the time
+	// the exporter was created.
+	Start time.Time
+	// Temporality selects whether counters and histograms are sent as totals
+	// or as the change since they were last sent. If it is left as
+	// metric.Cumulative the preference in
+	// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE applies.
+	// Up down counters are always sent as totals.
+	Temporality metric.Temporality
+}
+
+// Resource attribute keys defined by the OpenTelemetry semantic conventions.
+var (
+	serviceName = keys.NewString("service.name", "")
+	hostName    = keys.NewString("host.name", "")
+	processPID  = keys.NewInt64("process.pid", "")
+)
+
+// scope identifies the instrumentation that produced the telemetry.
+var scope = &Scope{Name: "golang.org/x/tools/internal/event"}
+
+type Exporter struct {
+	client   Client
+	start    time.Time
+	resource *Resource
+	delta    bool
+
+	mu     sync.Mutex
+	deltas metric.Deltas
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that delivers telemetry using the configured
+// client.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.Service == "" {
+		resolved.Service = os.Getenv(ServiceNameEnv)
+	}
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	if resolved.Host == "" {
+		resolved.Host, _ = os.Hostname()
+	}
+	if resolved.Process == 0 {
+		resolved.Process = uint32(os.Getpid())
+	}
+	if resolved.Start.IsZero() {
+		resolved.Start = core.Now()
+	}
+	if resolved.Temporality == metric.Cumulative {
+		var err error
+		resolved.Temporality, err = TemporalityPreference()
+		export.ReportError(err)
+	}
+	attributes := append([]label.Label{
+		serviceName.Of(resolved.Service),
+		hostName.Of(resolved.Host),
+		processPID.Of(int64(resolved.Process)),
+	}, resolved.Resource...)
+	return &Exporter{
+		client:   resolved.Client,
+		start:    resolved.Start,
+		resource: &Resource{Attributes: convertLabels(attributes)},
+		delta:    resolved.Temporality == metric.Delta,
+	}
+}
+
+// ExportSpans converts the spans and uploads them.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	return e.client.UploadTraces(ctx, e.TracesRequest(spans))
+}
+
+// ExportMetrics converts the metrics and uploads them.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return e.client.UploadMetrics(ctx, e.MetricsRequest(metrics))
+}
+
+// TracesRequest converts spans to an OTLP request.
+func (e *Exporter) TracesRequest(spans []*export.Span) *TracesRequest {
+	converted := make([]*Span, len(spans))
+	for i, s := range spans {
+		converted[i] = convertSpan(s)
+	}
+	return &TracesRequest{ResourceSpans: []*ResourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []*ScopeSpans{{Scope: scope, Spans: converted}},
+	}}}
+}
+
+// MetricsRequest converts metrics to an OTLP request.
+// With delta temporality each call converts the change since the previous one.
+func (e *Exporter) MetricsRequest(metrics []metric.Data) *MetricsRequest {
+	if e.delta {
+		e.mu.Lock()
+		metrics = e.deltas.Convert(metrics)
+		e.mu.Unlock()
+	}
+	converted := make([]*Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if c := convertMetric(m, e.start, e.delta); c != nil {
+			converted = append(converted, c)
+		}
+	}
+	return &MetricsRequest{ResourceMetrics: []*ResourceMetrics{{
+		Resource:     e.resource,
+		ScopeMetrics: []*ScopeMetrics{{Scope: scope, Metrics: converted}},
+	}}}
+}
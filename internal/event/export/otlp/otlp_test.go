@@ -0,0 +1,326 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/otlp"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// fakeClient remembers the JSON encoding of every request it is sent.
+type fakeClient struct {
+	sent []string
+}
+
+func (c *fakeClient) UploadTraces(ctx context.Context, request *otlp.TracesRequest) error {
+	return c.record(request)
+}
+
+func (c *fakeClient) UploadMetrics(ctx context.Context, request *otlp.MetricsRequest) error {
+	return c.record(request)
+}
+
+func (c *fakeClient) record(request interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.sent = append(c.sent, string(data))
+	return nil
+}
+
+// direct hands each span and metric straight to the exporter.
+type direct struct {
+	t        *testing.T
+	exporter *otlp.Exporter
+}
+
+func (d direct) ProcessSpan(ctx context.Context, span *export.Span) {
+	if err := d.exporter.ExportSpans(ctx, []*export.Span{span}); err != nil {
+		d.t.Error(err)
+	}
+}
+
+func (d direct) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	if err := d.exporter.ExportMetrics(ctx, metrics); err != nil {
+		d.t.Error(err)
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+var (
+	keyDB      = keys.NewString("db", "the database name")
+	keyLatency = keys.NewFloat64("latency", "the latency in milliseconds")
+	keyCount   = keys.NewInt64("count", "the number of calls")
+)
+
+func setup(t *testing.T) (*fakeClient, direct) {
+	start := time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)
+	event.SetClock(fixedClock(start.Add(time.Second)))
+	t.Cleanup(func() {
+		event.SetClock(nil)
+		event.SetExporter(nil)
+	})
+	client := &fakeClient{}
+	exporter := otlp.New(&otlp.Config{
+		Client:  client,
+		Service: "otlp-tests",
+		Host:    "tester",
+		Process: 1,
+		Start:   start,
+	})
+	return client, direct{t: t, exporter: exporter}
+}
+
+func checkContains(t *testing.T, got string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("request %s\ndoes not contain %s", got, w)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	client, d := setup(t)
+	event.SetExporter(export.Spans(export.SpansOnly(d)))
+
+	ctx, done := event.Start(context.Background(), "query", keyDB.Of("godb"))
+	event.Log(ctx, "cache miss")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	done()
+
+	if len(client.sent) != 1 {
+		t.Fatalf("got %d requests, want 1", len(client.sent))
+	}
+	checkContains(t, client.sent[0],
+		`"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"otlp-tests"}},{"key":"host.name","value":{"stringValue":"tester"}},{"key":"process.pid","value":{"intValue":"1"}}]}`,
+		`"scope":{"name":"golang.org/x/tools/internal/event"}`,
+		`"name":"query","kind":1,"startTimeUnixNano":"1583418469000000000","endTimeUnixNano":"1583418469000000000"`,
+		`"attributes":[{"key":"db","value":{"stringValue":"godb"}}]`,
+		`{"timeUnixNano":"1583418469000000000","name":"cache miss"}`,
+		`"name":"failed: timeout"`,
+		`"status":{"message":"failed: timeout","code":2}`,
+	)
+}
+
+func TestSpanLinks(t *testing.T) {
+	client, d := setup(t)
+	var requests []*export.Span
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) && export.GetSpan(ctx).Name == "request" {
+			requests = append(requests, export.GetSpan(ctx))
+		}
+		return export.SpansOnly(d)(ctx, ev, lm)
+	}))
+
+	for i := 0; i < 2; i++ {
+		_, done := event.Start(context.Background(), "request")
+		done()
+	}
+	ctx, done := event.Start(context.Background(), "reload")
+	for _, request := range requests {
+		export.LinkSpan(ctx, request.ID, keyDB.Of("godb"))
+	}
+	done()
+
+	if len(client.sent) != 3 {
+		t.Fatalf("got %d requests, want 3", len(client.sent))
+	}
+	var want []string
+	for _, request := range requests {
+		want = append(want, fmt.Sprintf(`{"traceId":"%v","spanId":"%v","attributes":[{"key":"db","value":{"stringValue":"godb"}}]}`,
+			request.ID.TraceID, request.ID.SpanID))
+	}
+	checkContains(t, client.sent[2], want...)
+}
+
+func TestMetrics(t *testing.T) {
+	client, d := setup(t)
+	var m metric.Config
+	metric.Scalar{Name: "calls", Description: "number of calls", Keys: []label.Key{keyDB}}.SumInt64(&m, keyCount)
+	metric.HistogramFloat64{Name: "latency_ms", Unit: metric.UnitMilliseconds, Buckets: []float64{10, 50}}.Record(&m, keyLatency)
+	event.SetExporter(m.Exporter(export.MetricsOnly(d)))
+
+	ctx := context.Background()
+	event.Metric(ctx, keyDB.Of("godb"), keyCount.Of(3))
+	for _, v := range []float64{5, 20, 100} {
+		event.Metric(ctx, keyLatency.Of(v))
+	}
+
+	if len(client.sent) != 4 {
+		t.Fatalf("got %d requests, want 4", len(client.sent))
+	}
+	checkContains(t, client.sent[0],
+		`"name":"calls","description":"number of calls","sum":{"dataPoints":[{"attributes":[{"key":"db","value":{"stringValue":"godb"}}],"startTimeUnixNano":"1583418468000000000","timeUnixNano":"1583418469000000000","asInt":"3"}],"aggregationTemporality":2,"isMonotonic":true}`,
+	)
+	checkContains(t, client.sent[3],
+		`"name":"latency_ms","unit":"ms"`,
+		`"count":"3","sum":125,"bucketCounts":["1","1","1"],"explicitBounds":[10,50],"min":5,"max":100`,
+	)
+}
+
+func TestUpDownCounter(t *testing.T) {
+	client, d := setup(t)
+	var m metric.Config
+	metric.Scalar{Name: "active", Description: "active requests"}.UpDownInt64(&m, keyCount)
+	event.SetExporter(m.Exporter(export.MetricsOnly(d)))
+
+	ctx := context.Background()
+	event.Metric(ctx, keyCount.Of(2))
+	event.Metric(ctx, keyCount.Of(-1))
+
+	if len(client.sent) != 2 {
+		t.Fatalf("got %d requests, want 2", len(client.sent))
+	}
+	// A sum that may decrease is still cumulative, but not monotonic.
+	checkContains(t, client.sent[1],
+		`"name":"active","description":"active requests","sum":{"dataPoints":[{"startTimeUnixNano":"1583418468000000000","timeUnixNano":"1583418469000000000","asInt":"1"}],"aggregationTemporality":2}`,
+	)
+}
+
+func TestDeltaTemporality(t *testing.T) {
+	t.Setenv(otlp.TemporalityEnv, "delta")
+	client, d := setup(t)
+	var m metric.Config
+	metric.Scalar{Name: "calls"}.SumInt64(&m, keyCount)
+	metric.HistogramFloat64{Name: "latency_ms", Buckets: []float64{10}}.Record(&m, keyLatency)
+	event.SetExporter(m.Exporter(export.MetricsOnly(d)))
+
+	ctx := context.Background()
+	event.Metric(ctx, keyCount.Of(3))
+	event.Metric(ctx, keyCount.Of(4))
+	event.Metric(ctx, keyLatency.Of(5))
+	event.Metric(ctx, keyLatency.Of(20))
+
+	if len(client.sent) != 4 {
+		t.Fatalf("got %d requests, want 4", len(client.sent))
+	}
+	// The first interval starts with the exporter, the later ones where the
+	// previous one ended.
+	checkContains(t, client.sent[0],
+		`"startTimeUnixNano":"1583418468000000000","timeUnixNano":"1583418469000000000","asInt":"3"}],"aggregationTemporality":1,"isMonotonic":true`,
+	)
+	checkContains(t, client.sent[1],
+		`"startTimeUnixNano":"1583418469000000000","timeUnixNano":"1583418469000000000","asInt":"4"}],"aggregationTemporality":1,"isMonotonic":true`,
+	)
+	// The min and max are those of the interval.
+	checkContains(t, client.sent[3],
+		`"count":"1","sum":20,"bucketCounts":["0","1"],"explicitBounds":[10],"min":20,"max":20}],"aggregationTemporality":1`,
+	)
+}
+
+func TestExemplars(t *testing.T) {
+	client, d := setup(t)
+	var m metric.Config
+	metric.HistogramFloat64{Name: "latency_ms", Buckets: []float64{10}}.Record(&m, keyLatency)
+	event.SetExporter(export.Spans(export.Exemplars(m.Exporter(export.MetricsOnly(d)))))
+
+	ctx, done := event.Start(context.Background(), "query")
+	event.Metric(ctx, keyLatency.Of(20))
+	span := export.GetSpan(ctx)
+	done()
+
+	if len(client.sent) != 1 {
+		t.Fatalf("got %d requests, want 1", len(client.sent))
+	}
+	checkContains(t, client.sent[0],
+		`"exemplars":[{"timeUnixNano":"1583418469000000000","asDouble":20,"spanId":"`+span.ID.SpanID.String()+`","traceId":"`+span.ID.TraceID.String()+`"}]`,
+	)
+}
+
+func TestMarshalProto(t *testing.T) {
+	s := "b"
+	request := &otlp.TracesRequest{ResourceSpans: []*otlp.ResourceSpans{{
+		Resource: &otlp.Resource{Attributes: []otlp.KeyValue{{
+			Key:   "a",
+			Value: otlp.AnyValue{StringValue: &s},
+		}}},
+		ScopeSpans: []*otlp.ScopeSpans{{
+			Spans: []*otlp.Span{{Name: "s", StartTimeUnixNano: 1}},
+		}},
+	}}}
+	want := []byte{
+		0x0a, 0x1c, // resource_spans
+		0x0a, 0x0a, // resource
+		0x0a, 0x08, // attributes
+		0x0a, 0x01, 'a', // key
+		0x12, 0x03, 0x0a, 0x01, 'b', // value
+		0x12, 0x0e, // scope_spans
+		0x12, 0x0c, // spans
+		0x2a, 0x01, 's', // name
+		0x39, 1, 0, 0, 0, 0, 0, 0, 0, // start_time_unix_nano
+	}
+	if got := request.MarshalProto(); !bytes.Equal(got, want) {
+		t.Errorf("got % x\nwant % x", got, want)
+	}
+}
+
+func TestExponentialHistogram(t *testing.T) {
+	client, d := setup(t)
+	var m metric.Config
+	metric.ExponentialHistogram{Name: "latency_ms", MaxScale: 1}.Record(&m, keyLatency)
+	event.SetExporter(m.Exporter(export.MetricsOnly(d)))
+
+	ctx := context.Background()
+	for _, v := range []float64{1.5, 2, -4, 0} {
+		event.Metric(ctx, keyLatency.Of(v))
+	}
+	if len(client.sent) != 4 {
+		t.Fatalf("got %d requests, want 4", len(client.sent))
+	}
+	checkContains(t, client.sent[3],
+		`"name":"latency_ms","exponentialHistogram":{"dataPoints":[{`,
+		`"count":"4","sum":-0.5,"scale":1,"zeroCount":"1","positive":{"offset":1,"bucketCounts":["2"]},"negative":{"offset":3,"bucketCounts":["1"]},"min":-4,"max":2}],"aggregationTemporality":2}`,
+	)
+
+	request := &otlp.MetricsRequest{ResourceMetrics: []*otlp.ResourceMetrics{{
+		ScopeMetrics: []*otlp.ScopeMetrics{{
+			Metrics: []*otlp.Metric{{
+				Name: "e",
+				ExponentialHistogram: &otlp.ExponentialHistogram{
+					DataPoints: []*otlp.ExponentialHistogramDataPoint{{
+						Scale:    -1,
+						Positive: &otlp.ExponentialBuckets{Offset: -2, BucketCounts: []otlp.Uint64{3}},
+					}},
+					AggregationTemporality: otlp.TemporalityCumulative,
+				},
+			}},
+		}},
+	}}}
+	want := []byte{
+		0x0a, 0x16, // resource_metrics
+		0x12, 0x14, // scope_metrics
+		0x12, 0x12, // metrics
+		0x0a, 0x01, 'e', // name
+		0x52, 0x0d, // exponential_histogram
+		0x0a, 0x09, // data_points
+		0x30, 0x01, // scale, zigzag encoded
+		0x42, 0x05, // positive
+		0x08, 0x03, // offset, zigzag encoded
+		0x12, 0x01, 0x03, // bucket_counts
+		0x10, 0x02, // aggregation_temporality
+	}
+	if got := request.MarshalProto(); !bytes.Equal(got, want) {
+		t.Errorf("got % x\nwant % x", got, want)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otlpgrpc delivers OTLP requests to a collector using gRPC, which is
+// the transport collectors listen on by default.
+//
+// Only the unary Export calls of the trace and metrics services are needed,
+// so rather than depending on google.golang.org/grpc the package frames the
+// requests itself and sends them over HTTP/2.
+//
+// Importing the package registers an "otlpgrpc" exporter whose options are
+// the address of the collector, such as "collector:4317" or
+// "https://collector:4317". An address without a scheme is reached without
+// TLS. The same environment variables as for the otlphttp package are
+// honored, see the otlp package. Spans are delivered in batches, and metrics
+// are pushed once per interval by an export.PeriodicReader.
+package otlpgrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/otlp"
+)
+
+// DefaultEndpoint is the address of a collector running on the local machine.
+const DefaultEndpoint = "http://localhost:4317"
+
+// The methods of the collector services that the requests are sent to.
+const (
+	TraceExportMethod   = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	MetricsExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+)
+
+// Config describes how to reach the collector.
+type Config struct {
+	// Endpoint is the URL of the collector, an http URL is reached without
+	// TLS and an https one with it. It defaults to the value of
+	// OTEL_EXPORTER_OTLP_ENDPOINT, or DefaultEndpoint.
+	Endpoint string
+	// Headers are sent as metadata with every call, normally for
+	// authentication. Headers listed in OTEL_EXPORTER_OTLP_HEADERS are added
+	// to them.
+	Headers map[string]string
+	// TLS configures the connection to an https endpoint.
+	// It is ignored if Client is set.
+	TLS *tls.Config
+	// Client sends the requests, it defaults to a client that speaks HTTP/2,
+	// with or without TLS as the endpoint requires, and connects as
+	// configured by export.TransportFromEnv.
+	Client *http.Client
+}
+
+func init() {
+	export.Register("otlpgrpc", otlp.Factory(func(endpoint string) otlp.Client {
+		return New(&Config{Endpoint: endpoint})
+	}))
+}
+
+// Client is an otlp.Client that uses gRPC.
+// Failed calls are returned rather than passed to export.ReportError, as
+// the batcher or periodic reader driving the exporter reports them.
+type Client struct {
+	config Config
+}
+
+var _ otlp.Client = (*Client)(nil)
+
+// New returns a Client for the configured collector.
+func New(config *Config) *Client {
+	resolved := *config
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = os.Getenv(otlp.EndpointEnv)
+	}
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = DefaultEndpoint
+	}
+	if list := os.Getenv(otlp.HeadersEnv); list != "" {
+		headers, err := otlp.ParseHeaders(list)
+		export.ReportError(err)
+		for k, v := range resolved.Headers {
+			headers[k] = v
+		}
+		resolved.Headers = headers
+	}
+	resolved.Endpoint = strings.TrimSuffix(resolved.Endpoint, "/")
+	if resolved.Client == nil {
+		resolved.Client = &http.Client{Transport: transport(resolved.TLS, strings.HasPrefix(resolved.Endpoint, "http://"))}
+	}
+	return &Client{config: resolved}
+}
+
+// transport returns an HTTP/2 transport that dials as configured by
+// export.TransportFromEnv, using TLS unless plain is set, in which case it
+// speaks HTTP/2 from the start, as gRPC servers do not upgrade connections.
+func transport(tlsConfig *tls.Config, plain bool) *http2.Transport {
+	return &http2.Transport{
+		TLSClientConfig: tlsConfig,
+		AllowHTTP:       plain,
+		DialTLS: func(network, address string, cfg *tls.Config) (net.Conn, error) {
+			// The transport asks for TLS even for http URLs.
+			if plain {
+				cfg = nil
+			}
+			return export.Dial(context.Background(), address, cfg)
+		},
+	}
+}
+
+// UploadTraces calls the Export method of the trace service.
+func (c *Client) UploadTraces(ctx context.Context, request *otlp.TracesRequest) error {
+	return c.call(ctx, TraceExportMethod, request.MarshalProto())
+}
+
+// UploadMetrics calls the Export method of the metrics service.
+func (c *Client) UploadMetrics(ctx context.Context, request *otlp.MetricsRequest) error {
+	return c.call(ctx, MetricsExportMethod, request.MarshalProto())
+}
+
+// call makes a unary gRPC call of method with the encoded request, and
+// returns an error unless the call succeeded.
+// The response message is discarded, a partial success is still a success.
+func (c *Client) call(ctx context.Context, method string, message []byte) error {
+	uri := c.config.Endpoint + method
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(frame(message)))
+	if err != nil {
+		return fmt.Errorf("otlp failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", timeout(time.Until(deadline)))
+	}
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := c.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp failed to send message: %v", err)
+	}
+	// The status is in the trailers, which are only read with the body.
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("otlp collector rejected message for %v: %v", uri, res.Status)
+	}
+	if err != nil {
+		return fmt.Errorf("otlp failed to read response for %v: %v", uri, err)
+	}
+	// A call that fails before any response is made has only headers.
+	status, grpcMessage := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, grpcMessage = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return fmt.Errorf("otlp collector sent no status for %v", uri)
+	default:
+		if unescaped, err := url.PathUnescape(grpcMessage); err == nil {
+			grpcMessage = unescaped
+		}
+		return fmt.Errorf("otlp collector rejected message for %v: code %s: %s", uri, status, grpcMessage)
+	}
+}
+
+// frame returns message in the length prefixed form that gRPC sends, without
+// compression.
+func frame(message []byte) []byte {
+	framed := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(framed[1:5], uint32(len(message)))
+	copy(framed[5:], message)
+	return framed
+}
+
+// timeout formats d as a gRPC timeout, in whole milliseconds.
+func timeout(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return fmt.Sprintf("%dm", ms)
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlpgrpc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/tools/internal/event/export/otlp"
+	"golang.org/x/tools/internal/event/export/otlp/otlpgrpc"
+)
+
+type received struct {
+	method, contentType, auth string
+	proto                     int
+	message                   []byte
+}
+
+// collector is an in-process gRPC server that answers every call with the
+// given status code, over TLS if secure is set and without it otherwise.
+func collector(t *testing.T, secure bool, status string) (*httptest.Server, func() []received) {
+	var mu sync.Mutex
+	var got []received
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var message []byte
+		if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("got badly framed message %q", body)
+		} else {
+			message = body[5:]
+		}
+		mu.Lock()
+		got = append(got, received{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization"), r.ProtoMajor, message})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		if status == "0" {
+			// An empty response message.
+			w.Write([]byte{0, 0, 0, 0, 0})
+		}
+		w.Header().Set("Grpc-Status", status)
+		if status != "0" {
+			w.Header().Set("Grpc-Message", "collector%20is%20full")
+		}
+	})
+	var srv *httptest.Server
+	if secure {
+		srv = httptest.NewUnstartedServer(handler)
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+	} else {
+		srv = httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	}
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), got...)
+	}
+}
+
+func request() *otlp.TracesRequest {
+	return &otlp.TracesRequest{ResourceSpans: []*otlp.ResourceSpans{{
+		ScopeSpans: []*otlp.ScopeSpans{{Spans: []*otlp.Span{{Name: "s"}}}},
+	}}}
+}
+
+func TestUpload(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		srv, got := collector(t, secure, "0")
+		config := &otlpgrpc.Config{
+			Endpoint: srv.URL + "/",
+			Headers:  map[string]string{"Authorization": "Bearer token"},
+		}
+		if secure {
+			roots := x509.NewCertPool()
+			roots.AddCert(srv.Certificate())
+			config.TLS = &tls.Config{RootCAs: roots}
+		}
+		client := otlpgrpc.New(config)
+		if err := client.UploadTraces(context.Background(), request()); err != nil {
+			t.Fatalf("secure %v: %v", secure, err)
+		}
+		if err := client.UploadMetrics(context.Background(), &otlp.MetricsRequest{}); err != nil {
+			t.Fatalf("secure %v: %v", secure, err)
+		}
+		calls := got()
+		if len(calls) != 2 {
+			t.Fatalf("secure %v: collector got %d calls, want 2", secure, len(calls))
+		}
+		r := calls[0]
+		if r.method != otlpgrpc.TraceExportMethod || r.contentType != "application/grpc" || r.auth != "Bearer token" || r.proto != 2 {
+			t.Errorf("secure %v: got call of %s with %s over HTTP/%d with auth %q", secure, r.method, r.contentType, r.proto, r.auth)
+		}
+		if !bytes.Equal(r.message, request().MarshalProto()) {
+			t.Errorf("secure %v: got message %q, want %q", secure, r.message, request().MarshalProto())
+		}
+		if calls[1].method != otlpgrpc.MetricsExportMethod {
+			t.Errorf("secure %v: got metrics call of %s", secure, calls[1].method)
+		}
+	}
+}
+
+func TestRejected(t *testing.T) {
+	srv, _ := collector(t, false, "8")
+	client := otlpgrpc.New(&otlpgrpc.Config{Endpoint: srv.URL})
+	err := client.UploadMetrics(context.Background(), &otlp.MetricsRequest{})
+	if err == nil || !strings.Contains(err.Error(), "code 8: collector is full") {
+		t.Errorf("call rejected by the collector returned %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otlphttp delivers OTLP requests to a collector using HTTP POST, for
+// environments where gRPC cannot be used.
+//
+// Importing the package registers an "otlp" exporter whose options are the
+// base URL of the collector, such as "https://collector:4318".
+// The standard OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS,
+// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE, OTEL_METRIC_EXPORT_INTERVAL,
+// OTEL_SERVICE_NAME and OTEL_TRACES_SAMPLER environment variables are honored,
+// see the otlp package. Spans are delivered in batches, and metrics are
+// pushed once per interval by an export.PeriodicReader.
+package otlphttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/otlp"
+)
+
+// DefaultEndpoint is the address of a collector running on the local machine.
+const DefaultEndpoint = "http://localhost:4318"
+
+// Config describes how to reach the collector.
+type Config struct {
+	// Endpoint is the base URL of the collector, the signal paths such as
+	// /v1/traces are appended to it. It defaults to the value of
+	// OTEL_EXPORTER_OTLP_ENDPOINT, or DefaultEndpoint.
+	Endpoint string
+	// Headers are added to every request, normally for authentication.
+	// Headers listed in OTEL_EXPORTER_OTLP_HEADERS are added to them.
+	Headers map[string]string
+	// JSON selects the JSON encoding rather than protocol buffers.
+	JSON bool
+	// TLS configures the connection to an https endpoint.
+	// It is ignored if Client is set.
+	TLS *tls.Config
+	// Client sends the requests, it defaults to a client using TLS.
+	Client *http.Client
+}
+
+func init() {
+	export.Register("otlp", otlp.Factory(func(endpoint string) otlp.Client {
+		return New(&Config{Endpoint: endpoint})
+	}))
+}
+
+// Client is an otlp.Client that uses HTTP.
+// Failed uploads are returned rather than passed to export.ReportError, as
+// the batcher or periodic reader driving the exporter reports them.
+type Client struct {
+	config Config
+}
+
+var _ otlp.Client = (*Client)(nil)
+
+// New returns a Client for the configured collector.
+func New(config *Config) *Client {
+	resolved := *config
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = os.Getenv(otlp.EndpointEnv)
+	}
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = DefaultEndpoint
+	}
+	if list := os.Getenv(otlp.HeadersEnv); list != "" {
+		headers, err := otlp.ParseHeaders(list)
+		export.ReportError(err)
+		for k, v := range resolved.Headers {
+			headers[k] = v
+		}
+		resolved.Headers = headers
+	}
+	resolved.Endpoint = strings.TrimSuffix(resolved.Endpoint, "/")
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(resolved.TLS)
+	}
+	return &Client{config: resolved}
+}
+
+// UploadTraces sends the request to the traces endpoint.
+func (c *Client) UploadTraces(ctx context.Context, request *otlp.TracesRequest) error {
+	return c.send(ctx, "/v1/traces", request, request.MarshalProto)
+}
+
+// UploadMetrics sends the request to the metrics endpoint.
+func (c *Client) UploadMetrics(ctx context.Context, request *otlp.MetricsRequest) error {
+	return c.send(ctx, "/v1/metrics", request, request.MarshalProto)
+}
+
+func (c *Client) send(ctx context.Context, path string, message interface{}, marshalProto func() []byte) error {
+	contentType := "application/x-protobuf"
+	var blob []byte
+	if c.config.JSON {
+		var err error
+		if blob, err = json.Marshal(message); err != nil {
+			return fmt.Errorf("otlp failed to marshal message for %v: %v", path, err)
+		}
+		contentType = "application/json"
+	} else {
+		blob = marshalProto()
+	}
+	uri := c.config.Endpoint + path
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("otlp failed to build request for %v: %v", uri, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := c.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp failed to send message: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("otlp collector rejected message for %v: %v", uri, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlphttp_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/internal/event/export/otlp"
+	"golang.org/x/tools/internal/event/export/otlp/otlphttp"
+)
+
+type received struct {
+	path, contentType, auth string
+	body                    []byte
+}
+
+func collector(t *testing.T, status int) (*httptest.Server, *[]received) {
+	var got []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		got = append(got, received{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization"), body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func request() *otlp.TracesRequest {
+	return &otlp.TracesRequest{ResourceSpans: []*otlp.ResourceSpans{{
+		ScopeSpans: []*otlp.ScopeSpans{{Spans: []*otlp.Span{{Name: "s"}}}},
+	}}}
+}
+
+func TestUpload(t *testing.T) {
+	srv, got := collector(t, http.StatusOK)
+	for _, test := range []struct {
+		json        bool
+		contentType string
+		body        []byte
+	}{
+		{false, "application/x-protobuf", request().MarshalProto()},
+		{true, "application/json", []byte(`{"resourceSpans":[{"scopeSpans":[{"spans":[{"traceId":"","spanId":"","name":"s","kind":0,"startTimeUnixNano":"0","endTimeUnixNano":"0"}]}]}]}`)},
+	} {
+		*got = nil
+		client := otlphttp.New(&otlphttp.Config{
+			Endpoint: srv.URL + "/",
+			Headers:  map[string]string{"Authorization": "Bearer token"},
+			JSON:     test.json,
+		})
+		if err := client.UploadTraces(context.Background(), request()); err != nil {
+			t.Fatal(err)
+		}
+		if len(*got) != 1 {
+			t.Fatalf("collector got %d requests, want 1", len(*got))
+		}
+		r := (*got)[0]
+		if r.path != "/v1/traces" || r.contentType != test.contentType || r.auth != "Bearer token" {
+			t.Errorf("got request for %s of %s with auth %q", r.path, r.contentType, r.auth)
+		}
+		if !bytes.Equal(r.body, test.body) {
+			t.Errorf("got body %q, want %q", r.body, test.body)
+		}
+	}
+}
+
+func TestRejected(t *testing.T) {
+	srv, _ := collector(t, http.StatusBadRequest)
+	client := otlphttp.New(&otlphttp.Config{Endpoint: srv.URL})
+	if err := client.UploadMetrics(context.Background(), &otlp.MetricsRequest{}); err == nil {
+		t.Error("upload rejected by the collector did not fail")
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	srv, got := collector(t, http.StatusOK)
+	t.Setenv(otlp.EndpointEnv, srv.URL)
+	t.Setenv(otlp.HeadersEnv, "Authorization=Bearer%20env")
+	client := otlphttp.New(&otlphttp.Config{})
+	if err := client.UploadTraces(context.Background(), request()); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("collector got %d requests, want 1", len(*got))
+	}
+	if r := (*got)[0]; r.path != "/v1/traces" || r.auth != "Bearer env" {
+		t.Errorf("got request for %s with auth %q", r.path, r.auth)
+	}
+}
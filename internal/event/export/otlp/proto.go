@@ -0,0 +1,345 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+)
+
+// This file encodes the data model in the protocol buffer wire format, using
+// the field numbers of the OTLP definitions. Fields holding their zero value
+// are omitted, except for the members of a oneof.
+
+// MarshalProto returns the protocol buffer encoding of the request.
+func (r *TracesRequest) MarshalProto() []byte {
+	var e protoEncoder
+	for _, rs := range r.ResourceSpans {
+		e.message(1, func(e *protoEncoder) {
+			if rs.Resource != nil {
+				e.message(1, rs.Resource.encode)
+			}
+			for _, ss := range rs.ScopeSpans {
+				e.message(2, ss.encode)
+			}
+		})
+	}
+	return e.buf
+}
+
+// MarshalProto returns the protocol buffer encoding of the request.
+func (r *MetricsRequest) MarshalProto() []byte {
+	var e protoEncoder
+	for _, rm := range r.ResourceMetrics {
+		e.message(1, func(e *protoEncoder) {
+			if rm.Resource != nil {
+				e.message(1, rm.Resource.encode)
+			}
+			for _, sm := range rm.ScopeMetrics {
+				e.message(2, sm.encode)
+			}
+		})
+	}
+	return e.buf
+}
+
+func (r *Resource) encode(e *protoEncoder) {
+	e.attributes(1, r.Attributes)
+}
+
+func (s *Scope) encode(e *protoEncoder) {
+	e.string(1, s.Name)
+	e.string(2, s.Version)
+}
+
+func (kv *KeyValue) encode(e *protoEncoder) {
+	e.string(1, kv.Key)
+	e.message(2, func(e *protoEncoder) {
+		v := &kv.Value
+		switch {
+		case v.StringValue != nil:
+			e.tag(1, wireBytes)
+			e.bytes([]byte(*v.StringValue))
+		case v.BoolValue != nil:
+			e.tag(2, wireVarint)
+			if *v.BoolValue {
+				e.varint(1)
+			} else {
+				e.varint(0)
+			}
+		case v.IntValue != nil:
+			e.tag(3, wireVarint)
+			e.varint(uint64(*v.IntValue))
+		case v.DoubleValue != nil:
+			e.tag(4, wireFixed64)
+			e.fixed64(math.Float64bits(*v.DoubleValue))
+		}
+	})
+}
+
+func (ss *ScopeSpans) encode(e *protoEncoder) {
+	if ss.Scope != nil {
+		e.message(1, ss.Scope.encode)
+	}
+	for _, s := range ss.Spans {
+		e.message(2, s.encode)
+	}
+}
+
+func (s *Span) encode(e *protoEncoder) {
+	e.hexBytes(1, s.TraceID)
+	e.hexBytes(2, s.SpanID)
+	e.hexBytes(4, s.ParentSpanID)
+	e.string(5, s.Name)
+	e.uint(6, uint64(s.Kind))
+	e.fixed(7, s.StartTimeUnixNano)
+	e.fixed(8, s.EndTimeUnixNano)
+	e.attributes(9, s.Attributes)
+	for _, ev := range s.Events {
+		e.message(11, ev.encode)
+	}
+	for _, l := range s.Links {
+		e.message(13, l.encode)
+	}
+	if s.Status != nil {
+		e.message(15, s.Status.encode)
+	}
+}
+
+func (ev *SpanEvent) encode(e *protoEncoder) {
+	e.fixed(1, ev.TimeUnixNano)
+	e.string(2, ev.Name)
+	e.attributes(3, ev.Attributes)
+}
+
+func (l *SpanLink) encode(e *protoEncoder) {
+	e.hexBytes(1, l.TraceID)
+	e.hexBytes(2, l.SpanID)
+	e.attributes(4, l.Attributes)
+}
+
+func (s *Status) encode(e *protoEncoder) {
+	e.string(2, s.Message)
+	e.uint(3, uint64(s.Code))
+}
+
+func (sm *ScopeMetrics) encode(e *protoEncoder) {
+	if sm.Scope != nil {
+		e.message(1, sm.Scope.encode)
+	}
+	for _, m := range sm.Metrics {
+		e.message(2, m.encode)
+	}
+}
+
+func (m *Metric) encode(e *protoEncoder) {
+	e.string(1, m.Name)
+	e.string(2, m.Description)
+	e.string(3, m.Unit)
+	switch {
+	case m.Gauge != nil:
+		e.message(5, func(e *protoEncoder) {
+			for _, p := range m.Gauge.DataPoints {
+				e.message(1, p.encode)
+			}
+		})
+	case m.Sum != nil:
+		e.message(7, func(e *protoEncoder) {
+			for _, p := range m.Sum.DataPoints {
+				e.message(1, p.encode)
+			}
+			e.uint(2, uint64(m.Sum.AggregationTemporality))
+			if m.Sum.IsMonotonic {
+				e.uint(3, 1)
+			}
+		})
+	case m.Histogram != nil:
+		e.message(9, func(e *protoEncoder) {
+			for _, p := range m.Histogram.DataPoints {
+				e.message(1, p.encode)
+			}
+			e.uint(2, uint64(m.Histogram.AggregationTemporality))
+		})
+	case m.ExponentialHistogram != nil:
+		e.message(10, func(e *protoEncoder) {
+			for _, p := range m.ExponentialHistogram.DataPoints {
+				e.message(1, p.encode)
+			}
+			e.uint(2, uint64(m.ExponentialHistogram.AggregationTemporality))
+		})
+	}
+}
+
+func (p *NumberDataPoint) encode(e *protoEncoder) {
+	e.fixed(2, p.StartTimeUnixNano)
+	e.fixed(3, p.TimeUnixNano)
+	switch {
+	case p.AsDouble != nil:
+		e.tag(4, wireFixed64)
+		e.fixed64(math.Float64bits(*p.AsDouble))
+	case p.AsInt != nil:
+		// as_int is an sfixed64.
+		e.tag(6, wireFixed64)
+		e.fixed64(uint64(*p.AsInt))
+	}
+	e.attributes(7, p.Attributes)
+}
+
+func (p *HistogramDataPoint) encode(e *protoEncoder) {
+	e.fixed(2, p.StartTimeUnixNano)
+	e.fixed(3, p.TimeUnixNano)
+	e.fixed(4, p.Count)
+	e.double(5, p.Sum)
+	if len(p.BucketCounts) > 0 {
+		e.tag(6, wireBytes)
+		e.varint(uint64(8 * len(p.BucketCounts)))
+		for _, c := range p.BucketCounts {
+			e.fixed64(uint64(c))
+		}
+	}
+	if len(p.ExplicitBounds) > 0 {
+		e.tag(7, wireBytes)
+		e.varint(uint64(8 * len(p.ExplicitBounds)))
+		for _, b := range p.ExplicitBounds {
+			e.fixed64(math.Float64bits(b))
+		}
+	}
+	for _, ex := range p.Exemplars {
+		e.message(8, ex.encode)
+	}
+	e.attributes(9, p.Attributes)
+	e.double(11, p.Min)
+	e.double(12, p.Max)
+}
+
+func (ex *Exemplar) encode(e *protoEncoder) {
+	e.fixed(2, ex.TimeUnixNano)
+	e.double(3, ex.AsDouble)
+	e.hexBytes(4, ex.SpanID)
+	e.hexBytes(5, ex.TraceID)
+}
+
+func (p *ExponentialHistogramDataPoint) encode(e *protoEncoder) {
+	e.attributes(1, p.Attributes)
+	e.fixed(2, p.StartTimeUnixNano)
+	e.fixed(3, p.TimeUnixNano)
+	e.fixed(4, p.Count)
+	e.double(5, p.Sum)
+	e.sint(6, int64(p.Scale))
+	e.fixed(7, p.ZeroCount)
+	if p.Positive != nil {
+		e.message(8, p.Positive.encode)
+	}
+	if p.Negative != nil {
+		e.message(9, p.Negative.encode)
+	}
+	e.double(12, p.Min)
+	e.double(13, p.Max)
+}
+
+func (b *ExponentialBuckets) encode(e *protoEncoder) {
+	e.sint(1, int64(b.Offset))
+	if len(b.BucketCounts) > 0 {
+		var packed protoEncoder
+		for _, c := range b.BucketCounts {
+			packed.varint(uint64(c))
+		}
+		e.tag(2, wireBytes)
+		e.bytes(packed.buf)
+	}
+}
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// protoEncoder appends the protocol buffer encoding of fields to buf.
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *protoEncoder) fixed64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *protoEncoder) bytes(b []byte) {
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// message encodes a nested message, whose fields are written by f.
+func (e *protoEncoder) message(field int, f func(*protoEncoder)) {
+	var nested protoEncoder
+	f(&nested)
+	e.tag(field, wireBytes)
+	e.bytes(nested.buf)
+}
+
+func (e *protoEncoder) string(field int, s string) {
+	if s != "" {
+		e.tag(field, wireBytes)
+		e.bytes([]byte(s))
+	}
+}
+
+// hexBytes writes a hex encoded identifier as raw bytes.
+func (e *protoEncoder) hexBytes(field int, s string) {
+	if b, err := hex.DecodeString(s); err == nil && len(b) > 0 {
+		e.tag(field, wireBytes)
+		e.bytes(b)
+	}
+}
+
+func (e *protoEncoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.varint(v)
+	}
+}
+
+// sint writes a zigzag encoded sint32 or sint64 field.
+func (e *protoEncoder) sint(field int, v int64) {
+	e.uint(field, uint64(v<<1)^uint64(v>>63))
+}
+
+// fixed writes a fixed64 field, as used for timestamps and counts.
+func (e *protoEncoder) fixed(field int, v Uint64) {
+	if v != 0 {
+		e.tag(field, wireFixed64)
+		e.fixed64(uint64(v))
+	}
+}
+
+// double writes an optional double field.
+func (e *protoEncoder) double(field int, v *float64) {
+	if v != nil {
+		e.tag(field, wireFixed64)
+		e.fixed64(math.Float64bits(*v))
+	}
+}
+
+func (e *protoEncoder) attributes(field int, attributes []KeyValue) {
+	for i := range attributes {
+		e.message(field, attributes[i].encode)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import "strconv"
+
+// This file holds the subset of the OTLP data model produced by the
+// exporter. The JSON tags follow the OTLP/JSON mapping of the protocol
+// buffer definitions at
+// https://github.com/open-telemetry/opentelemetry-proto.
+
+// Uint64 is a 64 bit unsigned integer, encoded as a decimal string in JSON.
+type Uint64 uint64
+
+func (u Uint64) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, strconv.FormatUint(uint64(u), 10)), nil
+}
+
+// Int64 is a 64 bit signed integer, encoded as a decimal string in JSON.
+type Int64 int64
+
+func (i Int64) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, strconv.FormatInt(int64(i), 10)), nil
+}
+
+// TracesRequest is the body of an ExportTraceServiceRequest.
+type TracesRequest struct {
+	ResourceSpans []*ResourceSpans `json:"resourceSpans"`
+}
+
+// MetricsRequest is the body of an ExportMetricsServiceRequest.
+type MetricsRequest struct {
+	ResourceMetrics []*ResourceMetrics `json:"resourceMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+type Scope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue holds exactly one of its fields.
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *Int64   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type ResourceSpans struct {
+	Resource   *Resource     `json:"resource,omitempty"`
+	ScopeSpans []*ScopeSpans `json:"scopeSpans"`
+}
+
+type ScopeSpans struct {
+	Scope *Scope  `json:"scope,omitempty"`
+	Spans []*Span `json:"spans"`
+}
+
+// SpanKind values.
+const (
+	SpanKindUnspecified = 0
+	SpanKindInternal    = 1
+	SpanKindServer      = 2
+	SpanKindClient      = 3
+)
+
+type Span struct {
+	// TraceID, SpanID and ParentSpanID are hex encoded.
+	TraceID           string       `json:"traceId"`
+	SpanID            string       `json:"spanId"`
+	ParentSpanID      string       `json:"parentSpanId,omitempty"`
+	Name              string       `json:"name"`
+	Kind              int          `json:"kind"`
+	StartTimeUnixNano Uint64       `json:"startTimeUnixNano"`
+	EndTimeUnixNano   Uint64       `json:"endTimeUnixNano"`
+	Attributes        []KeyValue   `json:"attributes,omitempty"`
+	Events            []*SpanEvent `json:"events,omitempty"`
+	Links             []*SpanLink  `json:"links,omitempty"`
+	Status            *Status      `json:"status,omitempty"`
+}
+
+type SpanEvent struct {
+	TimeUnixNano Uint64     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []KeyValue `json:"attributes,omitempty"`
+}
+
+type SpanLink struct {
+	// TraceID and SpanID are hex encoded.
+	TraceID    string     `json:"traceId"`
+	SpanID     string     `json:"spanId"`
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// Status codes.
+const (
+	StatusCodeUnset = 0
+	StatusCodeOK    = 1
+	StatusCodeError = 2
+)
+
+type Status struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+type ResourceMetrics struct {
+	Resource     *Resource       `json:"resource,omitempty"`
+	ScopeMetrics []*ScopeMetrics `json:"scopeMetrics"`
+}
+
+type ScopeMetrics struct {
+	Scope   *Scope    `json:"scope,omitempty"`
+	Metrics []*Metric `json:"metrics"`
+}
+
+// Metric holds exactly one of Gauge, Sum, Histogram or
+// ExponentialHistogram.
+type Metric struct {
+	Name                 string                `json:"name"`
+	Description          string                `json:"description,omitempty"`
+	Unit                 string                `json:"unit,omitempty"`
+	Gauge                *Gauge                `json:"gauge,omitempty"`
+	Sum                  *Sum                  `json:"sum,omitempty"`
+	Histogram            *Histogram            `json:"histogram,omitempty"`
+	ExponentialHistogram *ExponentialHistogram `json:"exponentialHistogram,omitempty"`
+}
+
+// AggregationTemporality values.
+const (
+	TemporalityUnspecified = 0
+	TemporalityDelta       = 1
+	TemporalityCumulative  = 2
+)
+
+type Gauge struct {
+	DataPoints []*NumberDataPoint `json:"dataPoints"`
+}
+
+type Sum struct {
+	DataPoints             []*NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                `json:"aggregationTemporality"`
+	IsMonotonic            bool               `json:"isMonotonic,omitempty"`
+}
+
+type Histogram struct {
+	DataPoints             []*HistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+}
+
+// NumberDataPoint holds exactly one of AsDouble or AsInt.
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64     `json:"timeUnixNano"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+	AsInt             *Int64     `json:"asInt,omitempty"`
+}
+
+type HistogramDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64     `json:"timeUnixNano"`
+	Count             Uint64     `json:"count"`
+	Sum               *float64   `json:"sum,omitempty"`
+	// BucketCounts has one more entry than ExplicitBounds, for the values
+	// above the last bound.
+	BucketCounts   []Uint64  `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64 `json:"explicitBounds,omitempty"`
+	Min            *float64  `json:"min,omitempty"`
+	Max            *float64  `json:"max,omitempty"`
+	// Exemplars holds example values of the buckets, with the span they were
+	// recorded in.
+	Exemplars []*Exemplar `json:"exemplars,omitempty"`
+}
+
+type Exemplar struct {
+	TimeUnixNano Uint64   `json:"timeUnixNano"`
+	AsDouble     *float64 `json:"asDouble,omitempty"`
+	// SpanID and TraceID are hex encoded.
+	SpanID  string `json:"spanId,omitempty"`
+	TraceID string `json:"traceId,omitempty"`
+}
+
+type ExponentialHistogram struct {
+	DataPoints             []*ExponentialHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                              `json:"aggregationTemporality"`
+}
+
+type ExponentialHistogramDataPoint struct {
+	Attributes        []KeyValue          `json:"attributes,omitempty"`
+	StartTimeUnixNano Uint64              `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      Uint64              `json:"timeUnixNano"`
+	Count             Uint64              `json:"count"`
+	Sum               *float64            `json:"sum,omitempty"`
+	Scale             int32               `json:"scale"`
+	ZeroCount         Uint64              `json:"zeroCount"`
+	Positive          *ExponentialBuckets `json:"positive,omitempty"`
+	Negative          *ExponentialBuckets `json:"negative,omitempty"`
+	Min               *float64            `json:"min,omitempty"`
+	Max               *float64            `json:"max,omitempty"`
+}
+
+type ExponentialBuckets struct {
+	Offset       int32    `json:"offset"`
+	BucketCounts []Uint64 `json:"bucketCounts,omitempty"`
+}
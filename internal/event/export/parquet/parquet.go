@@ -0,0 +1,427 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package parquet writes finished spans to Parquet files, so that the
+// telemetry of many sessions can be analyzed in bulk with tools such as
+// DuckDB or Spark.
+//
+// Each batch of spans becomes a row group of the file for the day it is
+// written, with the columns
+//
+//	trace_id, span_id, parent_id, name  strings, parent_id is empty for roots
+//	start                               timestamp in microseconds
+//	duration_ns                         int64
+//	tags                                the labels of the span as JSON
+//
+// A Parquet file is only readable once its footer has been written, which
+// happens when the day changes and when the exporter is shut down.
+// The columns are written with the plain encoding, optionally compressed with
+// gzip.
+//
+// Importing the package registers a "parquet" exporter whose options are the
+// directory to write the files in.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Codec is the compression applied to the column data.
+type Codec int
+
+// The codecs, with the values that the Parquet format gives them.
+const (
+	Uncompressed Codec = 0
+	Gzip         Codec = 2
+)
+
+func (c Codec) String() string {
+	switch c {
+	case Uncompressed:
+		return "uncompressed"
+	case Gzip:
+		return "gzip"
+	}
+	return "Codec(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Config configures an Exporter.
+type Config struct {
+	// Dir is the directory the files are written in, it defaults to the
+	// current directory.
+	Dir string
+	// Prefix starts the name of each file, which is followed by the date, it
+	// defaults to "spans".
+	Prefix string
+	// Codec is the compression of the columns.
+	Codec Codec
+}
+
+func init() {
+	export.Register("parquet", func(dir string) (event.Exporter, export.Shutdowner, error) {
+		exporter := New(&Config{Dir: dir, Codec: Gzip})
+		batcher := export.Batch(exporter, 10000, time.Minute)
+		// Managed after the batcher, so the footer is not written until the
+		// last batch has been.
+		export.Manage(exporter)
+		return batcher.ProcessEvent, export.ShutdownAll(batcher, exporter), nil
+	})
+}
+
+// Exporter is an export.BatchExporter that writes each batch of spans as a
+// row group.
+// Metrics are ignored.
+type Exporter struct {
+	config Config
+
+	mu   sync.Mutex
+	file *file
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that writes files to the configured directory.
+// No file is created until the first batch of spans is written.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.Dir == "" {
+		resolved.Dir = "."
+	}
+	if resolved.Prefix == "" {
+		resolved.Prefix = "spans"
+	}
+	return &Exporter{config: resolved}
+}
+
+// ExportSpans writes the spans as a row group of the file for the current
+// day, finishing the file of the previous day if there is one.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	day := core.Now().UTC().Format("2006-01-02")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file != nil && e.file.day != day {
+		err := e.file.close()
+		e.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	if e.file == nil {
+		f, err := e.create(day)
+		if err != nil {
+			return err
+		}
+		e.file = f
+	}
+	return e.file.writeRowGroup(spans, e.config.Codec)
+}
+
+// ExportMetrics implements export.BatchExporter, it does nothing.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+// Shutdown finishes the file being written.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.close()
+	e.file = nil
+	return err
+}
+
+// create creates the file for day, adding a number to the name if the
+// file of a previous session already exists, as a finished Parquet file
+// cannot be appended to.
+func (e *Exporter) create(day string) (*file, error) {
+	base := filepath.Join(e.config.Dir, e.config.Prefix+"-"+day)
+	for i := 0; ; i++ {
+		name := base + ".parquet"
+		if i > 0 {
+			name = base + "-" + strconv.Itoa(i) + ".parquet"
+		}
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parquet failed to create file: %v", err)
+		}
+		if _, err := f.Write([]byte(magic)); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("parquet failed to write %s: %v", name, err)
+		}
+		return &file{f: f, day: day, offset: int64(len(magic))}, nil
+	}
+}
+
+// magic starts and ends every Parquet file.
+const magic = "PAR1"
+
+// The Parquet physical types, repetition types, converted types and
+// encodings used by the columns.
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	required = 0
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+	convertedJSON            = 19
+
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+// column describes a column of the file, and how its value is taken from a
+// span.
+type column struct {
+	name      string
+	typ       int32
+	converted int32
+	value     func(*export.Span) interface{} // a string or an int64
+}
+
+var columns = []column{
+	{"trace_id", typeByteArray, convertedUTF8, func(s *export.Span) interface{} {
+		return s.ID.TraceID.String()
+	}},
+	{"span_id", typeByteArray, convertedUTF8, func(s *export.Span) interface{} {
+		return s.ID.SpanID.String()
+	}},
+	{"parent_id", typeByteArray, convertedUTF8, func(s *export.Span) interface{} {
+		if !s.ParentID.IsValid() {
+			return ""
+		}
+		return s.ParentID.String()
+	}},
+	{"name", typeByteArray, convertedUTF8, func(s *export.Span) interface{} {
+		return s.Name
+	}},
+	{"start", typeInt64, convertedTimestampMicros, func(s *export.Span) interface{} {
+		return s.Start().At().UnixNano() / int64(time.Microsecond)
+	}},
+	{"duration_ns", typeInt64, -1, func(s *export.Span) interface{} {
+		return int64(s.Finish().At().Sub(s.Start().At()))
+	}},
+	{"tags", typeByteArray, convertedJSON, func(s *export.Span) interface{} {
+		return tags(s)
+	}},
+}
+
+// file is a Parquet file being written.
+type file struct {
+	f         *os.File
+	day       string
+	offset    int64 // the size of the file so far
+	rowGroups []rowGroup
+}
+
+type rowGroup struct {
+	rows    int64
+	columns []columnChunk
+}
+
+// columnChunk records where the single page of a column in a row group was
+// written.
+type columnChunk struct {
+	offset       int64
+	uncompressed int64 // the sizes include the page header
+	compressed   int64
+	codec        Codec
+}
+
+func (f *file) writeRowGroup(spans []*export.Span, codec Codec) error {
+	group := rowGroup{rows: int64(len(spans))}
+	var buf bytes.Buffer
+	for _, c := range columns {
+		data := plain(c, spans)
+		page := data
+		if codec == Gzip {
+			var compressed bytes.Buffer
+			zw := gzip.NewWriter(&compressed)
+			zw.Write(data)
+			if err := zw.Close(); err != nil {
+				return fmt.Errorf("parquet failed to compress column %s: %v", c.name, err)
+			}
+			page = compressed.Bytes()
+		}
+		header := pageHeader(len(spans), len(data), len(page))
+		group.columns = append(group.columns, columnChunk{
+			offset:       f.offset + int64(buf.Len()),
+			uncompressed: int64(len(header) + len(data)),
+			compressed:   int64(len(header) + len(page)),
+			codec:        codec,
+		})
+		buf.Write(header)
+		buf.Write(page)
+	}
+	if _, err := f.f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("parquet failed to write row group: %v", err)
+	}
+	f.offset += int64(buf.Len())
+	f.rowGroups = append(f.rowGroups, group)
+	return nil
+}
+
+// close writes the footer and closes the file.
+func (f *file) close() error {
+	footer := f.metadata()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	footer = append(footer, length[:]...)
+	footer = append(footer, magic...)
+	_, err := f.f.Write(footer)
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("parquet failed to finish file: %v", err)
+	}
+	return nil
+}
+
+// plain encodes the values of a column with the plain encoding. As every
+// column is required, there are no repetition or definition levels.
+func plain(c column, spans []*export.Span) []byte {
+	var buf []byte
+	var scratch [8]byte
+	for _, s := range spans {
+		switch v := c.value(s).(type) {
+		case int64:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			buf = append(buf, scratch[:8]...)
+		case string:
+			binary.LittleEndian.PutUint32(scratch[:], uint32(len(v)))
+			buf = append(buf, scratch[:4]...)
+			buf = append(buf, v...)
+		}
+	}
+	return buf
+}
+
+// pageHeader encodes the PageHeader of a data page.
+func pageHeader(values, uncompressed, compressed int) []byte {
+	var w compactWriter
+	w.i32(1, 0) // DATA_PAGE
+	w.i32(2, int32(uncompressed))
+	w.i32(3, int32(compressed))
+	w.beginStruct(5)
+	w.i32(1, int32(values))
+	w.i32(2, encodingPlain)
+	w.i32(3, encodingRLE)
+	w.i32(4, encodingRLE)
+	w.endStruct()
+	w.buf = append(w.buf, 0)
+	return w.buf
+}
+
+// metadata encodes the FileMetaData of the file.
+func (f *file) metadata() []byte {
+	var w compactWriter
+	var rows int64
+	for _, g := range f.rowGroups {
+		rows += g.rows
+	}
+	w.i32(1, 1) // version
+	w.list(2, compactStruct, len(columns)+1)
+	w.beginElement()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(columns)))
+	w.endStruct()
+	for _, c := range columns {
+		w.beginElement()
+		w.i32(1, c.typ)
+		w.i32(3, required)
+		w.binary(4, c.name)
+		if c.converted >= 0 {
+			w.i32(6, c.converted)
+		}
+		w.endStruct()
+	}
+	w.i64(3, rows)
+	w.list(4, compactStruct, len(f.rowGroups))
+	for _, g := range f.rowGroups {
+		w.beginElement()
+		w.list(1, compactStruct, len(g.columns))
+		var total int64
+		for i, chunk := range g.columns {
+			c := columns[i]
+			total += chunk.uncompressed
+			w.beginElement()
+			w.i64(2, chunk.offset)
+			w.beginStruct(3)
+			w.i32(1, c.typ)
+			w.list(2, compactI32, 2)
+			w.i32Element(encodingPlain)
+			w.i32Element(encodingRLE)
+			w.list(3, compactBinary, 1)
+			w.binaryElement(c.name)
+			w.i32(4, int32(chunk.codec))
+			w.i64(5, g.rows)
+			w.i64(6, chunk.uncompressed)
+			w.i64(7, chunk.compressed)
+			w.i64(9, chunk.offset)
+			w.endStruct()
+			w.endStruct()
+		}
+		w.i64(2, total)
+		w.i64(3, g.rows)
+		w.endStruct()
+	}
+	w.binary(6, "golang.org/x/tools/internal/event/export/parquet")
+	w.buf = append(w.buf, 0)
+	return w.buf
+}
+
+// tags returns the labels of a span as a JSON object.
+func tags(s *export.Span) string {
+	values := make(map[string]interface{})
+	add := func(l label.Label) {
+		if !l.Valid() {
+			return
+		}
+		v := export.LabelValue(l)
+		// JSON cannot represent these, so they are written as strings.
+		if f, ok := v.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			v = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		values[l.Key().Name()] = v
+	}
+	for i := 1; s.Start().Valid(i); i++ {
+		add(s.Start().Label(i))
+	}
+	for _, l := range s.Labels() {
+		add(l)
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
@@ -0,0 +1,262 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/parquet"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// finished collects spans as they finish.
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	if span.Finish().At().IsZero() {
+		return
+	}
+	f.spans = append(f.spans, span)
+}
+
+// compactReader decodes Thrift compact protocol structs into maps from field
+// id to value, which is enough to check the structure of a Parquet file.
+type compactReader struct {
+	data []byte
+}
+
+func (r *compactReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *compactReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case 5, 6:
+		return r.zigzag()
+	case 8:
+		n := r.varint()
+		v := string(r.data[:n])
+		r.data = r.data[n:]
+		return v
+	case 9:
+		header := r.data[0]
+		r.data = r.data[1:]
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case 12:
+		fields := make(map[int]interface{})
+		last := 0
+		for {
+			header := r.data[0]
+			r.data = r.data[1:]
+			if header == 0 {
+				return fields
+			}
+			if delta := int(header >> 4); delta != 0 {
+				last += delta
+			} else {
+				last = int(r.zigzag())
+			}
+			fields[last] = r.value(header & 0x0f)
+		}
+	}
+	panic(fmt.Sprintf("unsupported compact type %d", typ))
+}
+
+func (r *compactReader) readStruct() map[int]interface{} {
+	return r.value(12).(map[int]interface{})
+}
+
+// readFile decodes a Parquet file written by the exporter, returning the
+// schema and the values of each column.
+func readFile(t *testing.T, filename string) (schema []string, values map[string][]interface{}) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("%s does not start and end with the magic number", filename)
+	}
+	length := binary.LittleEndian.Uint32(data[len(data)-8:])
+	footer := &compactReader{data: data[len(data)-8-int(length) : len(data)-8]}
+	meta := footer.readStruct()
+	if len(footer.data) != 0 {
+		t.Fatalf("%d bytes left over after the footer", len(footer.data))
+	}
+	elements := meta[2].([]interface{})
+	if root := elements[0].(map[int]interface{}); root[5] != int64(len(elements)-1) {
+		t.Fatalf("root schema element %v does not count its %d children", root, len(elements)-1)
+	}
+	types := make(map[string]int64)
+	for _, e := range elements[1:] {
+		e := e.(map[int]interface{})
+		name := e[4].(string)
+		schema = append(schema, fmt.Sprintf("%s:%v:%v", name, e[1], e[6]))
+		types[name] = e[1].(int64)
+	}
+	values = make(map[string][]interface{})
+	var rows int64
+	for _, g := range meta[4].([]interface{}) {
+		g := g.(map[int]interface{})
+		rows += g[3].(int64)
+		for _, c := range g[1].([]interface{}) {
+			c := c.(map[int]interface{})[3].(map[int]interface{})
+			name := c[3].([]interface{})[0].(string)
+			offset := c[9].(int64)
+			page := &compactReader{data: data[offset:]}
+			header := page.readStruct()
+			headerSize := len(data[offset:]) - len(page.data)
+			if got, want := int64(headerSize)+int64(header[3].(int64)), c[7].(int64); got != want {
+				t.Errorf("column %s is %d bytes, metadata says %d", name, got, want)
+			}
+			body := page.data[:header[3].(int64)]
+			if c[4] == int64(parquet.Gzip) {
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if int64(len(body)) != header[2].(int64) {
+				t.Errorf("column %s page is %d bytes, header says %d", name, len(body), header[2])
+			}
+			for n := header[5].(map[int]interface{})[1].(int64); n > 0; n-- {
+				switch types[name] {
+				case 2:
+					values[name] = append(values[name], int64(binary.LittleEndian.Uint64(body)))
+					body = body[8:]
+				case 6:
+					l := binary.LittleEndian.Uint32(body)
+					values[name] = append(values[name], string(body[4:4+l]))
+					body = body[4+l:]
+				}
+			}
+		}
+	}
+	if meta[3] != rows {
+		t.Errorf("file has %v rows, row groups have %d", meta[3], rows)
+	}
+	return schema, values
+}
+
+func TestExportSpans(t *testing.T) {
+	for _, codec := range []parquet.Codec{parquet.Uncompressed, parquet.Gzip} {
+		t.Run(fmt.Sprint(codec), func(t *testing.T) {
+			start := time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)
+			event.SetClock(fixedClock(start))
+			defer event.SetClock(nil)
+			f := &finished{}
+			event.SetExporter(export.Spans(export.SpansOnly(f)))
+			defer event.SetExporter(nil)
+			ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+			_, childDone := event.Start(ctx, "parse")
+			childDone()
+			done()
+			_, otherDone := event.Start(context.Background(), "completion")
+			otherDone()
+
+			dir := t.TempDir()
+			exporter := parquet.New(&parquet.Config{Dir: dir, Codec: codec})
+			// Two batches make two row groups.
+			if err := exporter.ExportSpans(context.Background(), f.spans[:2]); err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.ExportSpans(context.Background(), f.spans[2:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			schema, values := readFile(t, filepath.Join(dir, "spans-2020-03-05.parquet"))
+			if got, want := fmt.Sprint(schema), "[trace_id:6:0 span_id:6:0 parent_id:6:0 name:6:0 start:2:10 duration_ns:2:<nil> tags:6:19]"; got != want {
+				t.Errorf("schema is %s, want %s", got, want)
+			}
+			hover, parse := f.spans[1], f.spans[0]
+			for name, want := range map[string][]interface{}{
+				"name":        {"parse", "hover", "completion"},
+				"trace_id":    {parse.ID.TraceID.String(), hover.ID.TraceID.String(), f.spans[2].ID.TraceID.String()},
+				"parent_id":   {hover.ID.SpanID.String(), "", ""},
+				"start":       {start.UnixNano() / 1000, start.UnixNano() / 1000, start.UnixNano() / 1000},
+				"duration_ns": {int64(0), int64(0), int64(0)},
+				"tags":        {"{}", `{"file":"main.go"}`, "{}"},
+			} {
+				if got := fmt.Sprint(values[name]); got != fmt.Sprint(want) {
+					t.Errorf("column %s is %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDatedFiles(t *testing.T) {
+	day := time.Date(2020, 3, 5, 23, 59, 0, 0, time.UTC)
+	event.SetClock(fixedClock(day))
+	defer event.SetClock(nil)
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	defer event.SetExporter(nil)
+	_, done := event.Start(context.Background(), "hover")
+	done()
+
+	dir := t.TempDir()
+	exporter := parquet.New(&parquet.Config{Dir: dir, Prefix: "gopls"})
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	event.SetClock(fixedClock(day.Add(time.Hour)))
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// A second session on the same day must not overwrite the first.
+	exporter = parquet.New(&parquet.Config{Dir: dir, Prefix: "gopls"})
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"gopls-2020-03-05.parquet", "gopls-2020-03-06.parquet", "gopls-2020-03-06-1.parquet"} {
+		if _, values := readFile(t, filepath.Join(dir, name)); len(values["name"]) != 1 {
+			t.Errorf("%s holds spans %v, want 1", name, values["name"])
+		}
+	}
+}
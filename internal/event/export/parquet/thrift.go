@@ -0,0 +1,100 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import "encoding/binary"
+
+// The Thrift compact protocol field types.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes Thrift structs with the compact protocol, which is
+// how Parquet encodes its page headers and file metadata.
+// Fields must be written in increasing order of id within each struct.
+type compactWriter struct {
+	buf   []byte
+	last  int16   // the id of the last field written in the current struct
+	stack []int16 // the last field ids of the enclosing structs
+}
+
+func (w *compactWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (w *compactWriter) zigzag(v int64) {
+	w.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *compactWriter) field(id int16, typ byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.zigzag(int64(id))
+	}
+	w.last = id
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.field(id, compactI32)
+	w.zigzag(int64(v))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.field(id, compactI64)
+	w.zigzag(v)
+}
+
+func (w *compactWriter) binary(id int16, v string) {
+	w.field(id, compactBinary)
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// list writes the header of a list of n elements of type elem, which must
+// then be written with the element methods.
+func (w *compactWriter) list(id int16, elem byte, n int) {
+	w.field(id, compactList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elem)
+	} else {
+		w.buf = append(w.buf, 0xf0|elem)
+		w.varint(uint64(n))
+	}
+}
+
+// beginStruct starts a struct valued field, which is ended by endStruct.
+func (w *compactWriter) beginStruct(id int16) {
+	w.field(id, compactStruct)
+	w.beginElement()
+}
+
+// beginElement starts a struct that is an element of a list.
+func (w *compactWriter) beginElement() {
+	w.stack = append(w.stack, w.last)
+	w.last = 0
+}
+
+// endStruct writes the stop field of the current struct.
+func (w *compactWriter) endStruct() {
+	w.buf = append(w.buf, 0)
+	w.last = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+func (w *compactWriter) i32Element(v int32) {
+	w.zigzag(int64(v))
+}
+
+func (w *compactWriter) binaryElement(v string) {
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
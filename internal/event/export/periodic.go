@@ -0,0 +1,165 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultPeriodicInterval is how often a PeriodicReader pushes metrics if no
+// interval is given.
+const DefaultPeriodicInterval = time.Minute
+
+// PeriodicReader is an exporter that keeps the latest data of every metric,
+// and pushes all of it to a BatchExporter on a fixed interval.
+// Unlike a Batcher, which delivers the data attached to every metric event, it
+// delivers each metric at most once per interval, which is what push based
+// backends such as OTLP collectors, InfluxDB and statsd daemons expect.
+type PeriodicReader struct {
+	exporter BatchExporter
+	interval time.Duration
+	jitter   time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	status StatusTracker
+
+	mu     sync.Mutex
+	latest map[string]metric.Data
+	// order holds the handles of the metrics in the order they were first
+	// seen, so that they are pushed in a stable order.
+	order []string
+}
+
+var _ MetricExporter = (*PeriodicReader)(nil)
+
+// Periodic returns a PeriodicReader that pushes to exporter every interval,
+// which defaults to DefaultPeriodicInterval.
+// Each wait is moved by a random amount of up to jitter either way, so that
+// many processes started together do not all push at the same moment.
+// It must be wrapped by a metric.Config exporter, all events other than
+// metric events are ignored.
+// The PeriodicReader is managed, so the package level Flush and Shutdown
+// functions push the current values, and its status is reported by Statuses
+// until it is shut down.
+func Periodic(exporter BatchExporter, interval, jitter time.Duration) *PeriodicReader {
+	if interval <= 0 {
+		interval = DefaultPeriodicInterval
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > interval/2 {
+		jitter = interval / 2
+	}
+	r := &PeriodicReader{
+		exporter: exporter,
+		interval: interval,
+		jitter:   jitter,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		latest:   make(map[string]metric.Data),
+	}
+	go r.run()
+	Manage(r)
+	AddStatusReporter(r)
+	return r
+}
+
+// ProcessEvent implements event.Exporter.
+func (r *PeriodicReader) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if event.IsMetric(ev) {
+		if data, ok := metric.Entries.Get(lm).([]metric.Data); ok && len(data) > 0 {
+			r.ProcessMetrics(ctx, data)
+		}
+	}
+	return ctx
+}
+
+// ProcessMetrics records the latest data of the metrics, so that they are
+// pushed on the next interval.
+func (r *PeriodicReader) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, data := range metrics {
+		handle := data.Handle()
+		if _, seen := r.latest[handle]; !seen {
+			r.order = append(r.order, handle)
+		}
+		r.latest[handle] = data
+	}
+}
+
+// Flush collects the observable metrics, and then pushes the latest data of
+// every metric seen so far.
+func (r *PeriodicReader) Flush(ctx context.Context) error {
+	metric.Collect(ctx)
+	r.mu.Lock()
+	metrics := make([]metric.Data, len(r.order))
+	for i, handle := range r.order {
+		metrics[i] = r.latest[handle]
+	}
+	r.mu.Unlock()
+	if len(metrics) == 0 {
+		return nil
+	}
+	start := core.Now()
+	err := r.exporter.ExportMetrics(ctx, metrics)
+	r.status.Record(err)
+	self.observe(
+		ExporterKind.Of("periodic"),
+		BatchSize.Of(int64(len(metrics))),
+		ExportLatency.Of(float64(core.Now().Sub(start))/float64(time.Millisecond)),
+	)
+	return err
+}
+
+// Status implements StatusReporter.
+func (r *PeriodicReader) Status() Status {
+	return r.status.Current("periodic")
+}
+
+// Shutdown stops the periodic push, and then pushes the current values.
+func (r *PeriodicReader) Shutdown(ctx context.Context) error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+	Unmanage(r)
+	RemoveStatusReporter(r)
+	return r.Flush(ctx)
+}
+
+func (r *PeriodicReader) run() {
+	defer close(r.done)
+	timer := time.NewTimer(r.wait())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-r.stop:
+			return
+		}
+		ctx, cancel := TimeoutContext(context.Background())
+		ReportError(r.Flush(ctx))
+		cancel()
+		timer.Reset(r.wait())
+	}
+}
+
+// wait returns the time until the next push.
+func (r *PeriodicReader) wait() time.Duration {
+	if r.jitter == 0 {
+		return r.interval
+	}
+	return r.interval - r.jitter + time.Duration(rand.Int63n(int64(2*r.jitter)+1))
+}
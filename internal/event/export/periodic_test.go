@@ -0,0 +1,102 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// pushRecorder is a BatchExporter that records the value of a counter in
+// each push.
+type pushRecorder struct {
+	mu     sync.Mutex
+	values []int64
+	pushed chan struct{}
+}
+
+func (r *pushRecorder) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	return nil
+}
+
+func (r *pushRecorder) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	r.mu.Lock()
+	for _, data := range metrics {
+		r.values = append(r.values, data.(*metric.Int64Data).Rows[0])
+	}
+	r.mu.Unlock()
+	if r.pushed != nil {
+		r.pushed <- struct{}{}
+	}
+	return nil
+}
+
+func (r *pushRecorder) pushes() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.values...)
+}
+
+func TestPeriodic(t *testing.T) {
+	count := keys.NewInt64("periodic_count", "")
+	var m metric.Config
+	metric.Scalar{Name: "periodic"}.SumInt64(&m, count)
+
+	ctx := context.Background()
+	r := &pushRecorder{pushed: make(chan struct{}, 10)}
+	reader := export.Periodic(r, time.Hour, time.Minute)
+	event.SetExporter(m.Exporter(reader.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	// Nothing is pushed before the interval, and only the latest value of
+	// the metric is kept.
+	event.Metric(ctx, count.Of(1))
+	event.Metric(ctx, count.Of(2))
+	if got := r.pushes(); len(got) != 0 {
+		t.Errorf("got pushes %v before the interval, want none", got)
+	}
+	if err := export.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Every metric is pushed again even if it has not changed.
+	if err := reader.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	event.Metric(ctx, count.Of(4))
+	if err := reader.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.pushes(), []int64{3, 3, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got pushes %v, want %v", got, want)
+	}
+}
+
+func TestPeriodicInterval(t *testing.T) {
+	count := keys.NewInt64("periodic_interval_count", "")
+	var m metric.Config
+	metric.Scalar{Name: "periodic_interval"}.SumInt64(&m, count)
+
+	r := &pushRecorder{pushed: make(chan struct{}, 100)}
+	reader := export.Periodic(r, 10*time.Millisecond, 5*time.Millisecond)
+	defer reader.Shutdown(context.Background())
+	exporter := m.Exporter(reader.ProcessEvent)
+	ctx := event.WithExporter(context.Background(), exporter)
+	event.Metric(ctx, count.Of(1))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-r.pushed:
+		case <-time.After(10 * time.Second):
+			t.Fatal("metrics were not pushed on the interval")
+		}
+	}
+}
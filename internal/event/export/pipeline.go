@@ -0,0 +1,294 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Option configures a pipeline built by NewPipeline.
+type Option func(*pipelineConfig)
+
+// pipelineConfig holds the options given to NewPipeline.
+type pipelineConfig struct {
+	filter         *FilterOptions
+	sampling       float64
+	sampler        Sampler
+	maxBatch       int
+	maxDelay       time.Duration
+	retry          BackoffPolicy
+	tail           *TailOptions
+	metrics        *metric.Config
+	profile        bool
+	baggage        []string
+	baggageLabels  bool
+	runtime        bool
+	runtimeMetrics bool
+	processMetrics bool
+	timers         []spanTimer
+	spanMetrics    []spanMetrics
+	backends       []event.Exporter
+	batched        []BatchExporter
+}
+
+// WithFilter restricts the telemetry delivered to the backends, as described
+// by Filter.
+func WithFilter(opts FilterOptions) Option {
+	return func(p *pipelineConfig) { p.filter = &opts }
+}
+
+// WithSampling delivers only the given fraction of traces, as described by
+// Sampled.
+func WithSampling(fraction float64) Option {
+	return func(p *pipelineConfig) { p.sampling = fraction }
+}
+
+// WithSampler delivers only the spans kept by the sampler, as described by
+// ApplySampler. It is applied along with any fraction set by WithSampling.
+func WithSampler(s Sampler) Option {
+	return func(p *pipelineConfig) { p.sampler = s }
+}
+
+// WithBatching sets the size and delay of the batches handed to the batch
+// backends, as described by Batch.
+func WithBatching(maxBatch int, maxDelay time.Duration) Option {
+	return func(p *pipelineConfig) { p.maxBatch, p.maxDelay = maxBatch, maxDelay }
+}
+
+// WithRetry retries failed deliveries to the batch backends, as described by
+// Retry.
+func WithRetry(policy BackoffPolicy) Option {
+	return func(p *pipelineConfig) { p.retry = policy }
+}
+
+// WithTailSampling delivers only the slow or failed traces to the batch
+// backends, as described by TailSample.
+func WithTailSampling(opts TailOptions) Option {
+	return func(p *pipelineConfig) { p.tail = &opts }
+}
+
+// WithMetrics aggregates metric events using m before they are delivered.
+func WithMetrics(m *metric.Config) Option {
+	return func(p *pipelineConfig) { p.metrics = m }
+}
+
+// WithProfileLabels sets pprof labels for the active span, as described by
+// ProfileLabels.
+func WithProfileLabels() Option {
+	return func(p *pipelineConfig) { p.profile = true }
+}
+
+// WithBaggageLabels copies the baggage entries with the given keys, or all of
+// them if none are given, onto every span, as described by BaggageLabels.
+func WithBaggageLabels(names ...string) Option {
+	return func(p *pipelineConfig) { p.baggage, p.baggageLabels = names, true }
+}
+
+// WithRuntimeTrace mirrors spans and log events into runtime/trace, as
+// described by RuntimeTrace.
+func WithRuntimeTrace() Option {
+	return func(p *pipelineConfig) { p.runtime = true }
+}
+
+// WithRuntimeMetrics adds the metrics describing the Go runtime, as described
+// by RegisterRuntimeMetrics, to the metric aggregation. If there is no
+// aggregation configured with WithMetrics, one is created for them.
+func WithRuntimeMetrics() Option {
+	return func(p *pipelineConfig) { p.runtimeMetrics = true }
+}
+
+// WithProcessMetrics adds the metrics describing the resources used by the
+// process, as described by RegisterProcessMetrics, to the metric aggregation.
+// If there is no aggregation configured with WithMetrics, one is created for
+// them.
+func WithProcessMetrics() Option {
+	return func(p *pipelineConfig) { p.processMetrics = true }
+}
+
+// WithSpanTimer records the durations of the spans whose names match pattern
+// into the histogram described by info, as described by TimeSpans. If there
+// is no aggregation configured with WithMetrics, one is created for it.
+func WithSpanTimer(info metric.HistogramFloat64, pattern string) Option {
+	return func(p *pipelineConfig) { p.timers = append(p.timers, spanTimer{info, pattern}) }
+}
+
+// spanTimer holds the arguments of a WithSpanTimer option.
+type spanTimer struct {
+	info    metric.HistogramFloat64
+	pattern string
+}
+
+// WithSpanMetrics derives the rate, errors and duration metrics of the spans
+// whose names match pattern, as described by SpanMetrics. If there is no
+// aggregation configured with WithMetrics, one is created for them.
+func WithSpanMetrics(prefix, pattern string, buckets []float64) Option {
+	return func(p *pipelineConfig) {
+		p.spanMetrics = append(p.spanMetrics, spanMetrics{prefix, pattern, buckets})
+	}
+}
+
+// spanMetrics holds the arguments of a WithSpanMetrics option.
+type spanMetrics struct {
+	prefix  string
+	pattern string
+	buckets []float64
+}
+
+// WithBackend adds an exporter that is handed every event that passes the
+// filter and sampler.
+func WithBackend(e event.Exporter) Option {
+	return func(p *pipelineConfig) { p.backends = append(p.backends, e) }
+}
+
+// WithBatchBackend adds a backend that is handed batches of finished spans
+// and metrics.
+func WithBatchBackend(b BatchExporter) Option {
+	return func(p *pipelineConfig) { p.batched = append(p.batched, b) }
+}
+
+// Pipeline is an exporter assembled by NewPipeline.
+// It owns the batchers and tail samplers it creates for its batch backends,
+// so that it can be flushed and shut down on its own, as when it is replaced
+// by a new pipeline.
+type Pipeline struct {
+	exporter event.Exporter
+	// owned holds the stages created for the batch backends, each batcher
+	// before the tail sampler it delivers to, so that what a batcher flushes
+	// is then flushed by the stage after it.
+	owned []interface{}
+}
+
+// NewPipeline assembles an exporter from the supplied options.
+// Events pass through the stages in a fixed order: label and span tracking,
+// baggage labelling, profile labelling, runtime tracing, span timing and span
+// metrics, metric aggregation with exemplars, filtering and sampling, with the
+// batch backends additionally wrapped in retries, tail sampling and then
+// batching.
+// Batching defaults to batches of 512 items or 2 seconds.
+// The Pipeline is managed in place of the stages it owns, so the package
+// level Flush and Shutdown functions deliver whatever they hold, until the
+// Pipeline is shut down.
+func NewPipeline(opts ...Option) *Pipeline {
+	p := &pipelineConfig{
+		sampling: 1,
+		maxBatch: 512,
+		maxDelay: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if (p.runtimeMetrics || p.processMetrics || len(p.timers) > 0 || len(p.spanMetrics) > 0) && p.metrics == nil {
+		p.metrics = &metric.Config{}
+	}
+	if p.runtimeMetrics {
+		RegisterRuntimeMetrics(p.metrics)
+	}
+	if p.processMetrics {
+		RegisterProcessMetrics(p.metrics)
+	}
+	pipeline := &Pipeline{}
+	backends := p.backends
+	for _, b := range p.batched {
+		b = Retry(b, p.retry)
+		var tail *TailSampler
+		if p.tail != nil {
+			tail = TailSample(b, *p.tail)
+			Unmanage(tail)
+			b = tail
+		}
+		batcher := Batch(b, p.maxBatch, p.maxDelay)
+		Unmanage(batcher)
+		pipeline.owned = append(pipeline.owned, batcher)
+		if tail != nil {
+			pipeline.owned = append(pipeline.owned, tail)
+		}
+		backends = append(backends, batcher.ProcessEvent)
+	}
+	middleware := []Middleware{Labels, Spans}
+	if p.baggageLabels {
+		middleware = append(middleware, BaggageLabels(p.baggage...))
+	}
+	if p.profile {
+		middleware = append(middleware, ProfileLabels)
+	}
+	if p.runtime {
+		middleware = append(middleware, RuntimeTrace)
+	}
+	for _, t := range p.timers {
+		middleware = append(middleware, TimeSpans(p.metrics, t.info, t.pattern))
+	}
+	for _, s := range p.spanMetrics {
+		middleware = append(middleware, SpanMetrics(p.metrics, s.prefix, s.pattern, s.buckets))
+	}
+	if p.metrics != nil {
+		middleware = append(middleware, Exemplars, p.metrics.Exporter)
+	}
+	if p.filter != nil {
+		opts := *p.filter
+		middleware = append(middleware, func(output event.Exporter) event.Exporter {
+			return Filter(output, opts)
+		})
+	}
+	if p.sampler != nil {
+		middleware = append(middleware, ApplySampler(p.sampler))
+	}
+	if p.sampling < 1 {
+		fraction := p.sampling
+		middleware = append(middleware, func(output event.Exporter) event.Exporter {
+			return Sampled(output, fraction)
+		})
+	}
+	pipeline.exporter = Wrap(Multi(backends...), middleware...)
+	Manage(pipeline)
+	return pipeline
+}
+
+// ProcessEvent implements event.Exporter.
+func (p *Pipeline) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	return p.exporter(ctx, ev, lm)
+}
+
+// Flush delivers everything held by the stages the Pipeline owns.
+// It returns the first error encountered, but always attempts to flush every
+// stage unless the context is done.
+func (p *Pipeline) Flush(ctx context.Context) error {
+	var firstErr error
+	for _, o := range p.owned {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := flush(ctx, o.(Flusher)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Shutdown stops managing the Pipeline, and then shuts down the stages it
+// owns, which delivers everything they hold.
+// Events that reach the Pipeline afterwards are not delivered to its batch
+// backends.
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	Unmanage(p)
+	var firstErr error
+	for _, o := range p.owned {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		timeoutCtx, cancel := TimeoutContext(ctx)
+		err := o.(Shutdowner).Shutdown(timeoutCtx)
+		cancel()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
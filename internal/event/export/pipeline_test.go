@@ -0,0 +1,58 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestPipeline(t *testing.T) {
+	r := &recorder{}
+	batched := &batchRecorder{}
+	pipeline := export.NewPipeline(
+		export.WithFilter(export.FilterOptions{DenySpans: []string{"noisy"}}),
+		export.WithBatching(100, time.Hour),
+		export.WithRetry(export.BackoffPolicy{Initial: time.Millisecond, MaxElapsed: time.Second}),
+		export.WithBackend(r.ProcessEvent),
+		export.WithBatchBackend(batched),
+	)
+	defer pipeline.Shutdown(context.Background())
+	event.SetExporter(pipeline.ProcessEvent)
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	for _, name := range []string{"kept", "noisy", "kept"} {
+		_, done := event.Start(ctx, name)
+		done()
+	}
+	r.check(t, "start kept", "end kept", "start kept", "end kept")
+	if err := export.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := batched.sizes(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("got batches of %v, want a single batch of 2", got)
+	}
+
+	// Shutting the pipeline down delivers what it holds, and it is no longer
+	// managed.
+	_, done := event.Start(ctx, "last")
+	done()
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, done = event.Start(ctx, "late")
+	done()
+	if err := export.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := batched.sizes(); len(got) != 2 || got[1] != 1 {
+		t.Errorf("got batches of %v after shutdown, want a final batch of 1", got)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// SpanProcessor is notified as spans start and end, before they reach the
+// exporter.
+// It can enrich a span with AddLabels, or drop it with DropSpan, without
+// having to handle any other kind of event.
+type SpanProcessor interface {
+	// OnStart is called when span starts, and may return a modified context.
+	OnStart(ctx context.Context, span *Span) context.Context
+	// OnEnd is called when span ends.
+	OnEnd(ctx context.Context, span *Span)
+}
+
+// DropSpan marks the span being started in ctx as dropped, so that neither
+// its start nor its end event is delivered.
+// It is intended to be called from SpanProcessor.OnStart.
+func DropSpan(ctx context.Context) context.Context {
+	return markSpan(ctx, true)
+}
+
+// Process returns an exporter that calls each of the processors in turn for
+// every span, before delivering the span events to output.
+// It must be wrapped by Spans.
+func Process(output event.Exporter, processors ...SpanProcessor) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		span := GetSpan(ctx)
+		switch {
+		case span == nil:
+		case event.IsStart(ev):
+			ctx = markSpan(ctx, false)
+			for _, p := range processors {
+				ctx = p.OnStart(ctx, span)
+			}
+			if spanDropped(ctx) {
+				return ctx
+			}
+		case event.IsEnd(ev):
+			if spanDropped(ctx) {
+				return ctx
+			}
+			for _, p := range processors {
+				p.OnEnd(ctx, span)
+			}
+		}
+		return output(ctx, ev, lm)
+	}
+}
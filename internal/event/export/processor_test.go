@@ -0,0 +1,54 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+var resource = keys.NewString("resource", "")
+
+// enricher is a SpanProcessor that drops secret spans and labels the rest.
+type enricher struct {
+	ended []*export.Span
+}
+
+func (e *enricher) OnStart(ctx context.Context, span *export.Span) context.Context {
+	if strings.HasPrefix(span.Name, "secret") {
+		return export.DropSpan(ctx)
+	}
+	span.AddLabels(resource.Of("gopls"))
+	return ctx
+}
+
+func (e *enricher) OnEnd(ctx context.Context, span *export.Span) {
+	e.ended = append(e.ended, span)
+}
+
+func TestProcess(t *testing.T) {
+	r := &recorder{}
+	p := &enricher{}
+	event.SetExporter(export.Spans(export.Process(r.ProcessEvent, p)))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	outer, done := event.Start(ctx, "outer")
+	_, secretDone := event.Start(outer, "secret work")
+	secretDone()
+	done()
+	r.check(t, "start outer", "end outer")
+	if len(p.ended) != 1 {
+		t.Fatalf("OnEnd called for %d spans, want 1", len(p.ended))
+	}
+	if labels := p.ended[0].Labels(); len(labels) != 1 || resource.From(labels[0]) != "gopls" {
+		t.Errorf("got span labels %v, want resource=gopls", labels)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Keys for the metric events that describe the resources used by the process.
+var (
+	ProcessCPUTime = keys.NewFloat64("process.cpu.time", "CPU time used since the last sample, in seconds.")
+	ProcessRSS     = keys.NewInt64("process.memory.rss", "Bytes of physical memory held by the process.")
+	ProcessOpenFDs = keys.NewInt64("process.open_fds", "File descriptors held open by the process.")
+	ProcessThreads = keys.NewInt64("process.threads", "Operating system threads of the process.")
+)
+
+var (
+	processCPUMetric = metric.Scalar{
+		Name:        "process.cpu.time",
+		Description: "Total CPU time used by the process in seconds.",
+		Unit:        metric.UnitSeconds,
+	}
+
+	processRSSMetric = metric.Scalar{
+		Name:        "process.memory.rss",
+		Description: "Resident set size of the process in bytes.",
+		Unit:        metric.UnitBytes,
+	}
+
+	processFDsMetric = metric.Scalar{
+		Name:        "process.open_fds",
+		Description: "Number of open file descriptors.",
+	}
+
+	processThreadsMetric = metric.Scalar{
+		Name:        "process.threads",
+		Description: "Number of operating system threads.",
+	}
+)
+
+// RegisterProcessMetrics adds metrics describing the resources used by the
+// process to m: the total CPU time, the resident set size, the number of open
+// file descriptors and the number of threads.
+// Like the runtime metrics they are sampled every ten seconds from the first
+// call on, until the package level Shutdown function is called.
+// The values that a platform cannot supply are left out; all of them are
+// available on Linux, while only some are on other systems.
+func RegisterProcessMetrics(m *metric.Config) {
+	processCPUMetric.SumFloat64(m, ProcessCPUTime)
+	processRSSMetric.LatestInt64(m, ProcessRSS)
+	processFDsMetric.LatestInt64(m, ProcessOpenFDs)
+	processThreadsMetric.LatestInt64(m, ProcessThreads)
+	processMetrics.enable()
+}
+
+var processMetrics = &collector{sampler: &processSampler{}}
+
+// processStats holds the resource usage of the process, values a platform
+// cannot supply are negative.
+type processStats struct {
+	cpu     time.Duration
+	rss     int64
+	fds     int64
+	threads int64
+}
+
+// processSampler reads the resource usage of the process.
+type processSampler struct {
+	// cpu is the CPU time already reported.
+	cpu time.Duration
+}
+
+// begin implements sampler, the CPU time used before the first sample is
+// reported by it.
+func (s *processSampler) begin() {}
+
+// sample emits the current usage, and the CPU time used since the last
+// sample, as the CPU time metric sums them.
+func (s *processSampler) sample(ctx context.Context) {
+	stats, err := readProcessStats()
+	if err != nil {
+		ReportError(err)
+		return
+	}
+	var labels []label.Label
+	if stats.cpu >= 0 {
+		labels = append(labels, ProcessCPUTime.Of((stats.cpu - s.cpu).Seconds()))
+		s.cpu = stats.cpu
+	}
+	if stats.rss >= 0 {
+		labels = append(labels, ProcessRSS.Of(stats.rss))
+	}
+	if stats.fds >= 0 {
+		labels = append(labels, ProcessOpenFDs.Of(stats.fds))
+	}
+	if stats.threads >= 0 {
+		labels = append(labels, ProcessThreads.Of(stats.threads))
+	}
+	if len(labels) > 0 {
+		event.Metric(ctx, labels...)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package export
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// readProcessStats reads the CPU time of the process, and counts its file
+// descriptors in /dev/fd.
+// The resident set size reported by getrusage is the largest it has ever
+// been rather than the current one, so it is left out along with the threads.
+func readProcessStats() (processStats, error) {
+	stats := processStats{cpu: -1, rss: -1, fds: -1, threads: -1}
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return stats, fmt.Errorf("process metrics failed to read the CPU time: %v", err)
+	}
+	stats.cpu = time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	fds, err := countFDs("/dev/fd")
+	if err != nil {
+		return stats, err
+	}
+	stats.fds = fds
+	return stats, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// readProcessStats reads the resource usage of the process from /proc.
+func readProcessStats() (processStats, error) {
+	stats := processStats{cpu: -1, rss: -1, fds: -1, threads: -1}
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return stats, fmt.Errorf("process metrics failed to read the CPU time: %v", err)
+	}
+	stats.cpu = time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+
+	// The second field of statm is the resident set size in pages.
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return stats, fmt.Errorf("process metrics failed to read the memory usage: %v", err)
+	}
+	if fields := bytes.Fields(statm); len(fields) > 1 {
+		if pages, err := strconv.ParseInt(string(fields[1]), 10, 64); err == nil {
+			stats.rss = pages * int64(os.Getpagesize())
+		}
+	}
+
+	// The name of the executable, in parentheses, may hold spaces, and the
+	// number of threads is the eighteenth field after it.
+	stat, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return stats, fmt.Errorf("process metrics failed to read the thread count: %v", err)
+	}
+	if i := bytes.LastIndexByte(stat, ')'); i >= 0 {
+		if fields := bytes.Fields(stat[i+1:]); len(fields) > 17 {
+			if threads, err := strconv.ParseInt(string(fields[17]), 10, 64); err == nil {
+				stats.threads = threads
+			}
+		}
+	}
+
+	fds, err := countFDs("/proc/self/fd")
+	if err != nil {
+		return stats, err
+	}
+	stats.fds = fds
+	return stats, nil
+}
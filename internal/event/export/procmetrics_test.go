@@ -0,0 +1,57 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	var mu sync.Mutex
+	latest := make(map[string]metric.Data)
+	event.SetExporter(export.NewPipeline(
+		export.WithProcessMetrics(),
+		export.WithBackend(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsMetric(ev) {
+				mu.Lock()
+				for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+					latest[data.Handle()] = data
+				}
+				mu.Unlock()
+			}
+			return ctx
+		}),
+	).ProcessEvent)
+	defer event.SetExporter(nil)
+
+	// Use enough CPU for it to register.
+	for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+	}
+	export.SampleProcessMetrics(context.Background())
+	mu.Lock()
+	defer mu.Unlock()
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if cpu, ok := latest["process.cpu.time"].(*metric.Float64Data); !ok || cpu.IsGauge || cpu.Rows[0] <= 0 {
+		t.Errorf("process.cpu.time is %v, want a positive counter", latest["process.cpu.time"])
+	}
+	for _, name := range []string{"process.memory.rss", "process.open_fds", "process.threads"} {
+		data, ok := latest[name].(*metric.Int64Data)
+		if !ok || !data.IsGauge || data.Rows[0] <= 0 {
+			t.Errorf("%s is %v, want a positive gauge", name, latest[name])
+		}
+	}
+}
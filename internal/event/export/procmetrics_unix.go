@@ -0,0 +1,28 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package export
+
+import (
+	"fmt"
+	"os"
+)
+
+// countFDs returns the number of open file descriptors listed in dir, not
+// counting the one used to read it.
+func countFDs(dir string) (int64, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return -1, fmt.Errorf("process metrics failed to count file descriptors: %v", err)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return -1, fmt.Errorf("process metrics failed to count file descriptors: %v", err)
+	}
+	return int64(len(names)) - 1, nil
+}
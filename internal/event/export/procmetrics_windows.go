@@ -0,0 +1,51 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetProcessMemoryInfo = windows.NewLazySystemDLL("psapi.dll").NewProc("GetProcessMemoryInfo")
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+// readProcessStats reads the CPU time and working set of the process.
+// Windows has handles rather than file descriptors, so they are left out
+// along with the threads.
+func readProcessStats() (processStats, error) {
+	stats := processStats{cpu: -1, rss: -1, fds: -1, threads: -1}
+	process := windows.CurrentProcess()
+	var creation, exit, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return stats, fmt.Errorf("process metrics failed to read the CPU time: %v", err)
+	}
+	// Filetimes count 100 nanosecond intervals.
+	ticks := func(t windows.Filetime) int64 { return int64(t.HighDateTime)<<32 | int64(t.LowDateTime) }
+	stats.cpu = time.Duration(ticks(kernel)+ticks(user)) * 100
+
+	counters := processMemoryCounters{cb: uint32(unsafe.Sizeof(processMemoryCounters{}))}
+	if r, _, err := procGetProcessMemoryInfo.Call(uintptr(process), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb)); r == 0 {
+		return stats, fmt.Errorf("process metrics failed to read the memory usage: %v", err)
+	}
+	stats.rss = int64(counters.workingSetSize)
+	return stats, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// The pprof labels set by ProfileLabels.
+const (
+	ProfileSpanLabel  = "span"
+	ProfileTraceLabel = "trace_id"
+)
+
+// ProfileLabels returns an exporter that sets pprof labels naming the span
+// and trace on the goroutine that starts a span, so that CPU profiles can be
+// broken down by the span that was active.
+// The labels are also set in the context of the span, so goroutines started
+// within it with pprof.Do or pprof.SetGoroutineLabels are labelled too.
+// When the span ends, the goroutine that ends it is given back the labels
+// that the span was started with, as pprof.Do would.
+// It must be wrapped by Spans.
+func ProfileLabels(output event.Exporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsStart(ev):
+			if span := GetSpan(ctx); span != nil {
+				parent := ctx
+				ctx = pprof.WithLabels(ctx, pprof.Labels(
+					ProfileSpanLabel, span.Name,
+					ProfileTraceLabel, span.ID.TraceID.String(),
+				))
+				ctx = context.WithValue(ctx, profileParentKey, parent)
+				pprof.SetGoroutineLabels(ctx)
+			}
+		case event.IsEnd(ev):
+			ctx = output(ctx, ev, lm)
+			if parent, ok := ctx.Value(profileParentKey).(context.Context); ok {
+				pprof.SetGoroutineLabels(parent)
+			}
+			return ctx
+		}
+		return output(ctx, ev, lm)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+// goroutineLabels returns the pprof labels of the goroutines, as listed by
+// the goroutine profile.
+func goroutineLabels(t *testing.T) string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "# labels: ") {
+			labels = append(labels, strings.TrimPrefix(line, "# labels: "))
+		}
+	}
+	return strings.Join(labels, "\n")
+}
+
+func TestProfileLabels(t *testing.T) {
+	event.SetExporter(export.NewPipeline(export.WithProfileLabels()).ProcessEvent)
+	defer event.SetExporter(nil)
+
+	ctx, done := event.Start(context.Background(), "hover")
+	trace := export.GetSpan(ctx).ID.TraceID.String()
+	if got, _ := pprof.Label(ctx, export.ProfileTraceLabel); got != trace {
+		t.Errorf("span context has trace label %q, want %q", got, trace)
+	}
+	if got := goroutineLabels(t); !strings.Contains(got, `"span":"hover"`) || !strings.Contains(got, trace) {
+		t.Errorf("goroutine labels during the span are %s", got)
+	}
+	child, childDone := event.Start(ctx, "parse")
+	if got, _ := pprof.Label(child, export.ProfileSpanLabel); got != "parse" {
+		t.Errorf("child span context has span label %q", got)
+	}
+	childDone()
+	if got := goroutineLabels(t); !strings.Contains(got, `"span":"hover"`) {
+		t.Errorf("goroutine labels after the child span are %s, want those of its parent", got)
+	}
+	done()
+	if got := goroutineLabels(t); strings.Contains(got, "hover") {
+		t.Errorf("goroutine labels after the span are %s", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// openMetricsType is the media type of the OpenMetrics text format.
+const openMetricsType = "application/openmetrics-text"
+
+// prefersOpenMetrics reports whether an Accept header gives OpenMetrics at
+// least the quality of the classic text format.
+func prefersOpenMetrics(accept string) bool {
+	best, text := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case openMetricsType:
+			if q > best {
+				best = q
+			}
+		case "text/plain", "*/*":
+			if q > text {
+				text = q
+			}
+		}
+	}
+	return best > 0 && best >= text
+}
+
+// seriesKey identifies a series of a metric, grouping labels are compared the
+// same way as in the metric package.
+func seriesKey(name string, group []label.Label) string {
+	return name + fmt.Sprint(group)
+}
+
+func endTime(data metric.Data) time.Time {
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		return data.EndTime
+	case *metric.Float64Data:
+		return data.EndTime
+	case *metric.HistogramInt64Data:
+		return data.EndTime
+	case *metric.HistogramFloat64Data:
+		return data.EndTime
+	}
+	return time.Time{}
+}
+
+// exemplarText returns the exemplar of a bucket, if it has one, in the form
+// it follows the bucket's value.
+func exemplarText(exemplars []*metric.Exemplar, bucket int) string {
+	if bucket >= len(exemplars) || exemplars[bucket] == nil {
+		return ""
+	}
+	ex := exemplars[bucket]
+	return fmt.Sprintf(` # {trace_id="%s",span_id="%s"} %v %s`, ex.TraceID, ex.SpanID, ex.Value, timestamp(ex.Time))
+}
+
+// timestamp formats a time as the seconds since the Unix epoch.
+func timestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/float64(time.Second), 'f', 3, 64)
+}
+
+// serveOpenMetrics writes the latest value of every metric in the OpenMetrics
+// text format. It must be called with the lock held.
+func (e *Exporter) serveOpenMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", openMetricsType+"; version=1.0.0; charset=utf-8")
+	for _, data := range e.metrics {
+		name := metricName(data)
+		unit := unitSuffixes[metric.UnitOf(data)]
+		switch data := data.(type) {
+		case *metric.Int64Data:
+			family := e.openMetricsHeader(w, name, data.Info.Description, unit, data.IsGauge || data.IsUpDown, false)
+			for i, group := range data.Groups() {
+				e.scalarRows(w, family, data.Handle(), group, data.IsGauge || data.IsUpDown, data.Rows[i])
+			}
+
+		case *metric.Float64Data:
+			family := e.openMetricsHeader(w, name, data.Info.Description, unit, data.IsGauge || data.IsUpDown, false)
+			for i, group := range data.Groups() {
+				e.scalarRows(w, family, data.Handle(), group, data.IsGauge || data.IsUpDown, data.Rows[i])
+			}
+
+		case *metric.HistogramInt64Data:
+			e.openMetricsHeader(w, name, data.Info.Description, unit, false, true)
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for j, b := range data.Info.Buckets {
+					e.exemplarRow(w, name+"_bucket", group, fmt.Sprintf(`le="%v"`, b), row.Values[j], exemplarText(row.Exemplars, j))
+				}
+				e.exemplarRow(w, name+"_bucket", group, `le="+Inf"`, row.Count, exemplarText(row.Exemplars, len(data.Info.Buckets)))
+				e.row(w, name+"_count", group, "", row.Count)
+				e.row(w, name+"_sum", group, "", row.Sum)
+				e.createdRow(w, name, data.Handle(), group)
+			}
+
+		case *metric.HistogramFloat64Data:
+			e.openMetricsHeader(w, name, data.Info.Description, unit, false, true)
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for j, b := range data.Info.Buckets {
+					e.exemplarRow(w, name+"_bucket", group, fmt.Sprintf(`le="%v"`, b), row.Values[j], exemplarText(row.Exemplars, j))
+				}
+				e.exemplarRow(w, name+"_bucket", group, `le="+Inf"`, row.Count, exemplarText(row.Exemplars, len(data.Info.Buckets)))
+				e.row(w, name+"_count", group, "", row.Count)
+				e.row(w, name+"_sum", group, "", row.Sum)
+				e.createdRow(w, name, data.Handle(), group)
+			}
+
+		case *metric.ExponentialHistogramData:
+			e.openMetricsHeader(w, name, data.Info.Description, unit, false, true)
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for _, b := range exponentialBuckets(row) {
+					e.row(w, name+"_bucket", group, fmt.Sprintf(`le="%v"`, b.le), b.count)
+				}
+				e.row(w, name+"_bucket", group, `le="+Inf"`, row.Count)
+				e.row(w, name+"_count", group, "", row.Count)
+				e.row(w, name+"_sum", group, "", row.Sum)
+				e.createdRow(w, name, data.Handle(), group)
+			}
+		}
+	}
+	fmt.Fprint(w, "# EOF\n")
+}
+
+// openMetricsHeader writes the TYPE, UNIT and HELP metadata of a metric
+// family, and returns the name of the family. Counter samples carry a _total
+// suffix that is not part of the family name.
+func (e *Exporter) openMetricsHeader(w io.Writer, name, description, unit string, isGauge, isHistogram bool) string {
+	kind := "counter"
+	switch {
+	case isHistogram:
+		kind = "histogram"
+	case isGauge:
+		kind = "gauge"
+	default:
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	if unit != "" {
+		fmt.Fprintf(w, "# UNIT %s %s\n", name, unit)
+	}
+	if description != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, valueEscaper.Replace(description))
+	}
+	return name
+}
+
+// scalarRows writes the sample of a gauge, or the _total and _created samples
+// of a counter.
+func (e *Exporter) scalarRows(w io.Writer, family, handle string, group []label.Label, isGauge bool, value interface{}) {
+	if isGauge {
+		e.row(w, family, group, "", value)
+		return
+	}
+	e.row(w, family+"_total", group, "", value)
+	e.createdRow(w, family, handle, group)
+}
+
+// createdRow writes the time a series was first seen.
+func (e *Exporter) createdRow(w io.Writer, family, handle string, group []label.Label) {
+	if created, found := e.created[seriesKey(handle, group)]; found {
+		e.row(w, family+"_created", group, "", timestamp(created))
+	}
+}
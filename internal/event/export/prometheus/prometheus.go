@@ -2,22 +2,62 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package prometheus serves metrics in the prometheus text exposition format.
+//
+// The Exporter is an http.Handler, so it can be mounted on any mux. Each
+// metric is served with its HELP and TYPE metadata, one series per group of
+// label values, and histograms with their configured buckets. Exponential
+// histograms are served as classic histograms, with a bucket bounded by each
+// of their boundaries.
+// Scrapers that ask for it in their Accept header are served the OpenMetrics
+// text format instead, which adds _created series and the exemplars that
+// export.Exemplars attaches to histogram buckets.
+// Processes that cannot be scraped can push the same series with RemoteWrite.
 package prometheus
 
 import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/tools/internal/event"
 	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
 	"golang.org/x/tools/internal/event/export/metric"
 	"golang.org/x/tools/internal/event/label"
 )
 
+func init() {
+	export.Register("prometheus", func(address string) (event.Exporter, export.Shutdowner, error) {
+		if address == "" {
+			return nil, nil, fmt.Errorf("prometheus exporter needs an address to serve metrics on")
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, nil, fmt.Errorf("prometheus exporter: %w", err)
+		}
+		exporter := New()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", exporter)
+		server := &http.Server{Handler: mux}
+		go func() {
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				export.ReportError(err)
+			}
+		}()
+		// Shutting the server down closes the listener.
+		return exporter.ProcessEvent, server, nil
+	})
+}
+
 func New() *Exporter {
 	return &Exporter{}
 }
@@ -25,15 +65,30 @@ func New() *Exporter {
 type Exporter struct {
 	mu      sync.Mutex
 	metrics []metric.Data
+	// created holds the time each series was first seen, keyed by seriesKey.
+	// It is allocated on first use, so that the zero Exporter is ready to
+	// use.
+	created map[string]time.Time
 }
 
+var (
+	_ export.MetricExporter = (*Exporter)(nil)
+	_ http.Handler          = (*Exporter)(nil)
+)
+
 func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
 	if !event.IsMetric(ev) {
 		return ctx
 	}
+	e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	return ctx
+}
+
+// ProcessMetrics records the latest values of the metrics, so that they are
+// served on the next scrape.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	metrics := metric.Entries.Get(lm).([]metric.Data)
 	for _, data := range metrics {
 		name := data.Handle()
 		// We keep the metrics in name sorted order so the page is stable and easy
@@ -50,8 +105,16 @@ func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map
 			copy(e.metrics[index+1:], old[index:])
 		}
 		e.metrics[index] = data
+		if e.created == nil {
+			e.created = make(map[string]time.Time)
+		}
+		for _, group := range data.Groups() {
+			key := seriesKey(name, group)
+			if _, found := e.created[key]; !found {
+				e.created[key] = endTime(data)
+			}
+		}
 	}
-	return ctx
 }
 
 func (e *Exporter) header(w http.ResponseWriter, name, description string, isGauge, isHistogram bool) {
@@ -62,14 +125,28 @@ func (e *Exporter) header(w http.ResponseWriter, name, description string, isGau
 	if isHistogram {
 		kind = "histogram"
 	}
-	fmt.Fprintf(w, "# HELP %s %s\n", name, description)
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(description))
 	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
 }
 
-func (e *Exporter) row(w http.ResponseWriter, name string, group []label.Label, extra string, value interface{}) {
+func (e *Exporter) row(w io.Writer, name string, group []label.Label, extra string, value interface{}) {
+	e.exemplarRow(w, name, group, extra, value, "")
+}
+
+// exemplarRow writes a row followed by an OpenMetrics exemplar, if there is
+// one.
+func (e *Exporter) exemplarRow(w io.Writer, name string, group []label.Label, extra string, value interface{}, exemplar string) {
 	fmt.Fprint(w, name)
 	buf := &bytes.Buffer{}
-	fmt.Fprint(buf, group)
+	for _, l := range group {
+		if !l.Valid() {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%s=\"%s\"", export.PrometheusLabels.Name(l.Key().Name()), valueEscaper.Replace(labelValue(l)))
+	}
 	if extra != "" {
 		if buf.Len() > 0 {
 			fmt.Fprint(buf, ",")
@@ -81,49 +158,147 @@ func (e *Exporter) row(w http.ResponseWriter, name string, group []label.Label,
 		buf.WriteTo(w)
 		fmt.Fprint(w, "}")
 	}
-	fmt.Fprintf(w, " %v\n", value)
+	fmt.Fprintf(w, " %v%s\n", value, exemplar)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func labelValue(l label.Label) string {
+	if s, ok := export.LabelValue(l).(string); ok {
+		return s
+	}
+	return fmt.Sprint(export.LabelValue(l))
+}
+
+// unitSuffixes maps the units of metrics to the names that Prometheus
+// conventionally ends metric names with. The values are not converted to base
+// units, so the suffix always describes them as they were recorded.
+var unitSuffixes = map[string]string{
+	metric.UnitBytes:        "bytes",
+	metric.UnitSeconds:      "seconds",
+	metric.UnitMilliseconds: "milliseconds",
+	metric.UnitMicroseconds: "microseconds",
+	metric.UnitNanoseconds:  "nanoseconds",
+}
+
+// metricName returns the sanitized name of the metric, ending in the suffix of
+// its unit if it has one and the name does not already end in it. The suffix
+// goes before the _total suffix of a counter.
+func metricName(data metric.Data) string {
+	name := export.PrometheusNames.Name(data.Handle())
+	suffix := unitSuffixes[metric.UnitOf(data)]
+	if suffix == "" {
+		return name
+	}
+	base := strings.TrimSuffix(name, "_total")
+	if strings.HasSuffix(base, "_"+suffix) {
+		return name
+	}
+	return base + "_" + suffix + name[len(base):]
+}
+
+// ServeHTTP writes the latest value of every metric.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Serve(w, r)
 }
 
+// Serve writes the latest value of every metric in the text exposition
+// format, or the OpenMetrics format if the request prefers it.
+// The observable metrics are collected first, so that the scrape sees their
+// current values.
 func (e *Exporter) Serve(w http.ResponseWriter, r *http.Request) {
+	metric.Collect(r.Context())
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if prefersOpenMetrics(r.Header.Get("Accept")) {
+		e.serveOpenMetrics(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 	for _, data := range e.metrics {
+		name := metricName(data)
 		switch data := data.(type) {
 		case *metric.Int64Data:
-			e.header(w, data.Info.Name, data.Info.Description, data.IsGauge, false)
+			e.header(w, name, data.Info.Description, data.IsGauge || data.IsUpDown, false)
 			for i, group := range data.Groups() {
-				e.row(w, data.Info.Name, group, "", data.Rows[i])
+				e.row(w, name, group, "", data.Rows[i])
 			}
 
 		case *metric.Float64Data:
-			e.header(w, data.Info.Name, data.Info.Description, data.IsGauge, false)
+			e.header(w, name, data.Info.Description, data.IsGauge || data.IsUpDown, false)
 			for i, group := range data.Groups() {
-				e.row(w, data.Info.Name, group, "", data.Rows[i])
+				e.row(w, name, group, "", data.Rows[i])
 			}
 
 		case *metric.HistogramInt64Data:
-			e.header(w, data.Info.Name, data.Info.Description, false, true)
+			e.header(w, name, data.Info.Description, false, true)
 			for i, group := range data.Groups() {
 				row := data.Rows[i]
 				for j, b := range data.Info.Buckets {
-					e.row(w, data.Info.Name+"_bucket", group, fmt.Sprintf(`le="%v"`, b), row.Values[j])
+					e.row(w, name+"_bucket", group, fmt.Sprintf(`le="%v"`, b), row.Values[j])
 				}
-				e.row(w, data.Info.Name+"_bucket", group, `le="+Inf"`, row.Count)
-				e.row(w, data.Info.Name+"_count", group, "", row.Count)
-				e.row(w, data.Info.Name+"_sum", group, "", row.Sum)
+				e.row(w, name+"_bucket", group, `le="+Inf"`, row.Count)
+				e.row(w, name+"_count", group, "", row.Count)
+				e.row(w, name+"_sum", group, "", row.Sum)
 			}
 
 		case *metric.HistogramFloat64Data:
-			e.header(w, data.Info.Name, data.Info.Description, false, true)
+			e.header(w, name, data.Info.Description, false, true)
 			for i, group := range data.Groups() {
 				row := data.Rows[i]
 				for j, b := range data.Info.Buckets {
-					e.row(w, data.Info.Name+"_bucket", group, fmt.Sprintf(`le="%v"`, b), row.Values[j])
+					e.row(w, name+"_bucket", group, fmt.Sprintf(`le="%v"`, b), row.Values[j])
 				}
-				e.row(w, data.Info.Name+"_bucket", group, `le="+Inf"`, row.Count)
-				e.row(w, data.Info.Name+"_count", group, "", row.Count)
-				e.row(w, data.Info.Name+"_sum", group, "", row.Sum)
+				e.row(w, name+"_bucket", group, `le="+Inf"`, row.Count)
+				e.row(w, name+"_count", group, "", row.Count)
+				e.row(w, name+"_sum", group, "", row.Sum)
+			}
+
+		case *metric.ExponentialHistogramData:
+			e.header(w, name, data.Info.Description, false, true)
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for _, b := range exponentialBuckets(row) {
+					e.row(w, name+"_bucket", group, fmt.Sprintf(`le="%v"`, b.le), b.count)
+				}
+				e.row(w, name+"_bucket", group, `le="+Inf"`, row.Count)
+				e.row(w, name+"_count", group, "", row.Count)
+				e.row(w, name+"_sum", group, "", row.Sum)
 			}
 		}
 	}
 }
+
+// bucket is a cumulative bucket of a classic histogram.
+type bucket struct {
+	le    float64
+	count int64
+}
+
+// exponentialBuckets returns the cumulative buckets of a classic histogram
+// holding the same counts as a row of an exponential histogram, without the
+// +Inf bucket. They are bounded by the boundaries of the negative buckets,
+// then zero, then the boundaries of the positive buckets.
+func exponentialBuckets(row *metric.ExponentialHistogramRow) []bucket {
+	// The bucket at index i holds the absolute values in
+	// (base^i, base^(i+1)], where base is 2^(2^-scale).
+	boundary := func(i int32) float64 {
+		return math.Exp2(math.Ldexp(float64(i), -int(row.Scale)))
+	}
+	buckets := make([]bucket, 0, len(row.Negative.Counts)+1+len(row.Positive.Counts))
+	var count int64
+	for j := len(row.Negative.Counts) - 1; j >= 0; j-- {
+		count += row.Negative.Counts[j]
+		buckets = append(buckets, bucket{-boundary(row.Negative.Offset + int32(j)), count})
+	}
+	count += row.ZeroCount
+	buckets = append(buckets, bucket{0, count})
+	for j, c := range row.Positive.Counts {
+		count += c
+		buckets = append(buckets, bucket{boundary(row.Positive.Offset + int32(j) + 1), count})
+	}
+	return buckets
+}
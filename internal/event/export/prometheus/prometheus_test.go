@@ -0,0 +1,216 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prometheus_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/prometheus"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestServe(t *testing.T) {
+	method := keys.NewString("method", "")
+	route := keys.NewString("http.route", "")
+	count := keys.NewInt64("calls", "")
+	latency := keys.NewFloat64("latency", "")
+
+	var m metric.Config
+	metric.Scalar{
+		Name:        "rpc.calls",
+		Description: "calls by method\nand route",
+		Keys:        []label.Key{method, route},
+	}.SumInt64(&m, count)
+	metric.HistogramFloat64{
+		Name:    "latency_ms",
+		Keys:    []label.Key{method},
+		Buckets: []float64{1, 10},
+	}.Record(&m, latency)
+	exporter := prometheus.New()
+	event.SetExporter(m.Exporter(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	event.Metric(ctx, method.Of("get"), route.Of(`/a"b`), count.Of(2))
+	event.Metric(ctx, method.Of("put"), route.Of("/c"), count.Of(1))
+	for _, v := range []float64{0.5, 5, 50} {
+		event.Metric(ctx, method.Of("get"), latency.Of(v))
+	}
+
+	w := httptest.NewRecorder()
+	exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", ct)
+	}
+	want := `# HELP latency_ms 
+# TYPE latency_ms histogram
+latency_ms_bucket{method="get",le="1"} 1
+latency_ms_bucket{method="get",le="10"} 2
+latency_ms_bucket{method="get",le="+Inf"} 3
+latency_ms_count{method="get"} 3
+latency_ms_sum{method="get"} 55.5
+# HELP rpc_calls calls by method\nand route
+# TYPE rpc_calls counter
+rpc_calls{method="get",http_route="/a\"b"} 2
+rpc_calls{method="put",http_route="/c"} 1
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestServeOpenMetrics(t *testing.T) {
+	method := keys.NewString("method", "")
+	count := keys.NewInt64("calls", "")
+	latency := keys.NewInt64("latency", "")
+	queued := keys.NewInt64("queued", "")
+
+	var m metric.Config
+	metric.Scalar{
+		Name:        "rpc.calls_total",
+		Description: `calls by "method"`,
+		Keys:        []label.Key{method},
+	}.SumInt64(&m, count)
+	metric.HistogramInt64{
+		Name:    "latency_ms",
+		Buckets: []int64{10},
+	}.Record(&m, latency)
+	metric.Scalar{Name: "queue_depth", Description: "queued tasks"}.UpDownInt64(&m, queued)
+	exporter := prometheus.New()
+	event.SetExporter(export.Spans(export.Exemplars(m.Exporter(exporter.ProcessEvent))))
+	defer event.SetExporter(nil)
+	event.SetClock(fixedClock(time.Unix(1583418468, 0)))
+	defer event.SetClock(nil)
+
+	ctx, done := event.Start(context.Background(), "request")
+	event.Metric(ctx, method.Of("get"), count.Of(2))
+	event.Metric(ctx, latency.Of(5))
+	event.Metric(ctx, queued.Of(3))
+	event.Metric(ctx, queued.Of(-1))
+	done()
+	span := export.GetSpan(ctx)
+
+	for _, accept := range []string{
+		"",
+		"text/plain;version=0.0.4",
+		"application/openmetrics-text;version=1.0.0;q=0.5,text/plain;q=0.9",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		exporter.ServeHTTP(w, req)
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("Accept %q: got content type %q, want the text format", accept, ct)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	exporter.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "application/openmetrics-text; version=1.0.0; charset=utf-8" {
+		t.Errorf("got content type %q", ct)
+	}
+	want := `# TYPE latency_ms histogram
+latency_ms_bucket{le="10"} 1 # {trace_id="` + span.ID.TraceID.String() + `",span_id="` + span.ID.SpanID.String() + `"} 5 1583418468.000
+latency_ms_bucket{le="+Inf"} 1
+latency_ms_count 1
+latency_ms_sum 5
+latency_ms_created 1583418468.000
+# TYPE queue_depth gauge
+# HELP queue_depth queued tasks
+queue_depth 2
+# TYPE rpc_calls counter
+# HELP rpc_calls calls by \"method\"
+rpc_calls_total{method="get"} 2
+rpc_calls_created{method="get"} 1583418468.000
+# EOF
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnitSuffix(t *testing.T) {
+	busy := keys.NewFloat64("busy", "")
+	heap := keys.NewInt64("heap", "")
+	count := keys.NewInt64("count", "")
+
+	var m metric.Config
+	metric.Scalar{Name: "worker.busy_total", Unit: metric.UnitMilliseconds}.SumFloat64(&m, busy)
+	metric.Scalar{Name: "heap_bytes", Unit: metric.UnitBytes}.LatestInt64(&m, heap)
+	metric.Scalar{Name: "items", Unit: metric.UnitDimensionless}.LatestInt64(&m, count)
+	exporter := prometheus.New()
+	ctx := event.WithExporter(context.Background(), m.Exporter(exporter.ProcessEvent))
+	event.Metric(ctx, busy.Of(1.5), heap.Of(4096), count.Of(3))
+
+	w := httptest.NewRecorder()
+	exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"worker_busy_milliseconds_total 1.5\n",
+		"heap_bytes 4096\n",
+		"items 3\n",
+	} {
+		if got := w.Body.String(); !strings.Contains(got, want) {
+			t.Errorf("text format is missing %q, got:\n%s", want, got)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	exporter.ServeHTTP(w, req)
+	for _, want := range []string{
+		"# TYPE worker_busy_milliseconds counter\n# UNIT worker_busy_milliseconds milliseconds\n",
+		"# TYPE heap_bytes gauge\n# UNIT heap_bytes bytes\n",
+		"# TYPE items gauge\nitems 3\n",
+	} {
+		if got := w.Body.String(); !strings.Contains(got, want) {
+			t.Errorf("OpenMetrics format is missing %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestServeExponential(t *testing.T) {
+	latency := keys.NewFloat64("latency", "")
+
+	var m metric.Config
+	// At scale -1 the bucket boundaries are the powers of 4.
+	metric.ExponentialHistogram{Name: "latency", MaxScale: -1}.Record(&m, latency)
+	exporter := prometheus.New()
+	ctx := event.WithExporter(context.Background(), m.Exporter(exporter.ProcessEvent))
+	for _, v := range []float64{-3, 0, 1.5, 10, 20} {
+		event.Metric(ctx, latency.Of(v))
+	}
+
+	w := httptest.NewRecorder()
+	exporter.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `# HELP latency 
+# TYPE latency histogram
+latency_bucket{le="-1"} 1
+latency_bucket{le="0"} 2
+latency_bucket{le="4"} 3
+latency_bucket{le="16"} 4
+latency_bucket{le="64"} 5
+latency_bucket{le="+Inf"} 5
+latency_count 5
+latency_sum 28.5
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func init() {
+	export.Register("remotewrite", func(url string) (event.Exporter, export.Shutdowner, error) {
+		if url == "" {
+			return nil, nil, fmt.Errorf("remotewrite exporter needs the URL to push metrics to")
+		}
+		if !strings.Contains(url, "://") {
+			url = "http://" + url
+		}
+		pusher := RemoteWrite(&RemoteWriteConfig{URL: url})
+		return pusher.ProcessEvent, pusher, nil
+	})
+}
+
+// RemoteWriteConfig describes where a Pusher sends metrics.
+type RemoteWriteConfig struct {
+	// URL is the remote write endpoint.
+	URL string
+	// Interval is how often the metrics are pushed, it defaults to 15 seconds.
+	Interval time.Duration
+	// Headers are added to every request, normally for authentication.
+	Headers map[string]string
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+// Pusher periodically pushes the latest value of every metric using the
+// prometheus remote write protocol, for processes that cannot be scraped.
+type Pusher struct {
+	config RemoteWriteConfig
+	latest Exporter
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+var _ export.MetricExporter = (*Pusher)(nil)
+
+// RemoteWrite returns a Pusher for the configured endpoint.
+// The Pusher is managed, so the package level Flush and Shutdown functions
+// push the current values.
+func RemoteWrite(config *RemoteWriteConfig) *Pusher {
+	resolved := *config
+	if resolved.Interval <= 0 {
+		resolved.Interval = 15 * time.Second
+	}
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(nil)
+	}
+	p := &Pusher{
+		config: resolved,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	export.Manage(p)
+	return p
+}
+
+func (p *Pusher) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	return p.latest.ProcessEvent(ctx, ev, lm)
+}
+
+// ProcessMetrics records the latest values of the metrics, so that they are
+// sent on the next push.
+func (p *Pusher) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	p.latest.ProcessMetrics(ctx, metrics)
+}
+
+func (p *Pusher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := export.TimeoutContext(context.Background())
+			export.ReportError(p.Flush(ctx))
+			cancel()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Flush collects the observable metrics, and then pushes the current value of
+// every metric.
+func (p *Pusher) Flush(ctx context.Context) error {
+	metric.Collect(ctx)
+	p.latest.mu.Lock()
+	body := encodeWriteRequest(p.latest.metrics, core.Now())
+	p.latest.mu.Unlock()
+	if len(body) == 0 {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.config.URL, bytes.NewReader(snappyEncode(body)))
+	if err != nil {
+		return fmt.Errorf("remotewrite failed to build request for %v: %v", p.config.URL, err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range p.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := p.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remotewrite failed to push metrics: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("remotewrite rejected metrics for %v: %v", p.config.URL, res.Status)
+	}
+	return nil
+}
+
+// Shutdown stops the periodic push, and then pushes the current values.
+func (p *Pusher) Shutdown(ctx context.Context) error {
+	p.once.Do(func() { close(p.stop) })
+	<-p.done
+	export.Unmanage(p)
+	return p.Flush(ctx)
+}
+
+// sample is a single value of a time series.
+type sample struct {
+	labels [][2]string // name value pairs, sorted by name
+	value  float64
+}
+
+// encodeWriteRequest returns the protocol buffer encoding of a WriteRequest
+// holding one sample for every series of the metrics.
+func encodeWriteRequest(metrics []metric.Data, at time.Time) []byte {
+	var samples []sample
+	add := func(name string, group []label.Label, le string, value float64) {
+		labels := [][2]string{{"__name__", name}}
+		for _, l := range group {
+			if l.Valid() {
+				labels = append(labels, [2]string{export.PrometheusLabels.Name(l.Key().Name()), labelValue(l)})
+			}
+		}
+		if le != "" {
+			labels = append(labels, [2]string{"le", le})
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+		samples = append(samples, sample{labels: labels, value: value})
+	}
+	for _, data := range metrics {
+		name := metricName(data)
+		switch data := data.(type) {
+		case *metric.Int64Data:
+			for i, group := range data.Groups() {
+				add(name, group, "", float64(data.Rows[i]))
+			}
+		case *metric.Float64Data:
+			for i, group := range data.Groups() {
+				add(name, group, "", data.Rows[i])
+			}
+		case *metric.HistogramInt64Data:
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for j, b := range data.Info.Buckets {
+					add(name+"_bucket", group, fmt.Sprint(b), float64(row.Values[j]))
+				}
+				add(name+"_bucket", group, "+Inf", float64(row.Count))
+				add(name+"_count", group, "", float64(row.Count))
+				add(name+"_sum", group, "", float64(row.Sum))
+			}
+		case *metric.HistogramFloat64Data:
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for j, b := range data.Info.Buckets {
+					add(name+"_bucket", group, fmt.Sprint(b), float64(row.Values[j]))
+				}
+				add(name+"_bucket", group, "+Inf", float64(row.Count))
+				add(name+"_count", group, "", float64(row.Count))
+				add(name+"_sum", group, "", row.Sum)
+			}
+		case *metric.ExponentialHistogramData:
+			for i, group := range data.Groups() {
+				row := data.Rows[i]
+				for _, b := range exponentialBuckets(row) {
+					add(name+"_bucket", group, fmt.Sprint(b.le), float64(b.count))
+				}
+				add(name+"_bucket", group, "+Inf", float64(row.Count))
+				add(name+"_count", group, "", float64(row.Count))
+				add(name+"_sum", group, "", row.Sum)
+			}
+		}
+	}
+
+	ms := at.UnixNano() / int64(time.Millisecond)
+	var request []byte
+	for _, s := range samples {
+		var series []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = appendBytesField(lb, 1, l[0])
+			lb = appendBytesField(lb, 2, l[1])
+			series = appendBytesField(series, 1, string(lb))
+		}
+		var sb []byte
+		sb = append(appendVarint(sb, 1<<3|1), 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(sb[len(sb)-8:], math.Float64bits(s.value))
+		sb = appendVarint(appendVarint(sb, 2<<3), uint64(ms))
+		series = appendBytesField(series, 2, string(sb))
+		request = appendBytesField(request, 1, string(series))
+	}
+	return request
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendBytesField appends a length delimited protocol buffer field.
+func appendBytesField(b []byte, field int, value string) []byte {
+	b = appendVarint(b, uint64(field<<3|2))
+	b = appendVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// snappyEncode returns data in the snappy block format.
+// It only emits literals, which every snappy decoder accepts, trading the
+// compression for not needing a dependency; remote write bodies are small
+// enough that this does not matter.
+func snappyEncode(data []byte) []byte {
+	b := appendVarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > 1<<16 {
+			chunk = chunk[:1<<16]
+		}
+		data = data[len(chunk):]
+		n := len(chunk) - 1
+		switch {
+		case n < 60:
+			b = append(b, byte(n)<<2)
+		case n < 1<<8:
+			b = append(b, 60<<2, byte(n))
+		default:
+			b = append(b, 61<<2, byte(n), byte(n>>8))
+		}
+		b = append(b, chunk...)
+	}
+	return b
+}
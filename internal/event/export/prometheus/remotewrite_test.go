@@ -0,0 +1,98 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package prometheus_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/prometheus"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// unsnappy decodes a snappy block made up only of literals.
+func unsnappy(t *testing.T, b []byte) []byte {
+	size, n := binary.Uvarint(b)
+	b = b[n:]
+	var out []byte
+	for len(b) > 0 {
+		tag := b[0]
+		if tag&3 != 0 {
+			t.Fatalf("unexpected snappy copy element %x", tag)
+		}
+		length, skip := int(tag>>2)+1, 1
+		switch tag >> 2 {
+		case 60:
+			length, skip = int(b[1])+1, 2
+		case 61:
+			length, skip = int(b[1])|int(b[2])<<8+1, 3
+		}
+		out = append(out, b[skip:skip+length]...)
+		b = b[skip+length:]
+	}
+	if len(out) != int(size) {
+		t.Fatalf("decoded %d bytes, header says %d", len(out), size)
+	}
+	return out
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		body = unsnappy(t, compressed)
+	}))
+	defer srv.Close()
+
+	method := keys.NewString("method", "")
+	count := keys.NewInt64("calls", "")
+	var m metric.Config
+	metric.Scalar{Name: "rpc.calls", Keys: []label.Key{method}}.SumInt64(&m, count)
+	pusher := prometheus.RemoteWrite(&prometheus.RemoteWriteConfig{
+		URL:      srv.URL,
+		Interval: time.Hour,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+	})
+	event.SetExporter(m.Exporter(pusher.ProcessEvent))
+	defer event.SetExporter(nil)
+	event.Metric(context.Background(), method.Of("get"), count.Of(2))
+
+	if err := pusher.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer token",
+	} {
+		if got := header.Get(k); got != want {
+			t.Errorf("header %s is %q, want %q", k, got, want)
+		}
+	}
+	for _, want := range []string{
+		"\x0a\x08__name__\x12\x09rpc_calls",
+		"\x0a\x06method\x12\x03get",
+		"\x09\x00\x00\x00\x00\x00\x00\x00\x40", // the value 2
+	} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("request %q does not contain %q", body, want)
+		}
+	}
+}
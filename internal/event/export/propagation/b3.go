@@ -0,0 +1,117 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package propagation
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+// The header names of Zipkin's B3 propagation.
+const (
+	B3Header             = "b3"
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+)
+
+// B3 is the Propagator of Zipkin's B3 headers, for the tracing systems that
+// predate W3C Trace Context.
+// It extracts both the single b3 header and the multiple X-B3 headers,
+// preferring the single header, and injects the one selected by SingleHeader.
+// A span whose headers carry no sampling decision is taken to have been
+// sampled.
+type B3 struct {
+	// SingleHeader injects the single b3 header instead of the X-B3 headers.
+	SingleHeader bool
+}
+
+func (p B3) Inject(ctx context.Context, c Carrier) {
+	span := export.GetSpan(ctx)
+	if span == nil {
+		return
+	}
+	sampled := "0"
+	if span.Sampled() {
+		sampled = "1"
+	}
+	if p.SingleHeader {
+		header := fmt.Sprintf("%v-%v-%s", span.ID.TraceID, span.ID.SpanID, sampled)
+		if span.ParentID.IsValid() {
+			header += "-" + span.ParentID.String()
+		}
+		c.Set(B3Header, header)
+		return
+	}
+	c.Set(B3TraceIDHeader, span.ID.TraceID.String())
+	c.Set(B3SpanIDHeader, span.ID.SpanID.String())
+	if span.ParentID.IsValid() {
+		c.Set(B3ParentSpanIDHeader, span.ParentID.String())
+	}
+	c.Set(B3SampledHeader, sampled)
+}
+
+func (p B3) Extract(ctx context.Context, c Carrier) context.Context {
+	var id export.SpanContext
+	var err error
+	var sampling string
+	if header := c.Get(B3Header); header != "" {
+		id, err = ParseB3(header)
+		if fields := strings.Split(strings.TrimSpace(header), "-"); len(fields) > 2 {
+			sampling = fields[2]
+		}
+	} else {
+		id, err = parseB3IDs(c.Get(B3TraceIDHeader), c.Get(B3SpanIDHeader))
+		sampling = c.Get(B3SampledHeader)
+	}
+	if err != nil {
+		return ctx
+	}
+	return export.WithRemoteParent(ctx, export.RemoteParent{
+		ID:      id,
+		Sampled: sampling != "0" && sampling != "false",
+	})
+}
+
+// ParseB3 returns the span described by a single b3 header, which holds the
+// trace and span IDs followed by the optional sampling state and parent span
+// ID, all separated by dashes.
+// A header holding only a sampling state does not describe a span, and is an
+// error.
+func ParseB3(header string) (export.SpanContext, error) {
+	fields := strings.Split(strings.TrimSpace(header), "-")
+	if len(fields) < 2 || len(fields) > 4 {
+		return export.SpanContext{}, fmt.Errorf("b3 header %q does not describe a span", header)
+	}
+	return parseB3IDs(fields[0], fields[1])
+}
+
+// parseB3IDs returns the span with the given B3 trace and span IDs. The trace
+// ID may have either 16 or 32 hexadecimal digits, the short form holding the
+// low 64 bits of the ID.
+func parseB3IDs(traceID, spanID string) (export.SpanContext, error) {
+	var id export.SpanContext
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if len(traceID) != 32 || len(spanID) != 16 {
+		return id, fmt.Errorf("B3 IDs %q and %q have the wrong length", traceID, spanID)
+	}
+	if _, err := hex.Decode(id.TraceID[:], []byte(traceID)); err != nil {
+		return id, fmt.Errorf("B3 trace ID %q: %w", traceID, err)
+	}
+	if _, err := hex.Decode(id.SpanID[:], []byte(spanID)); err != nil {
+		return id, fmt.Errorf("B3 span ID %q: %w", spanID, err)
+	}
+	if id.TraceID == (export.TraceID{}) || !id.SpanID.IsValid() {
+		return export.SpanContext{}, fmt.Errorf("B3 IDs %q and %q include a zero ID", traceID, spanID)
+	}
+	return id, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package propagation_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/propagation"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestParseB3(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		trace  string
+	}{
+		{traceID + "-" + spanID, traceID},
+		{traceID + "-" + spanID + "-1", traceID},
+		{traceID + "-" + spanID + "-d-05e3ac9a4f6e3b90", traceID},
+		{"a3ce929d0e0e4736-" + spanID + "-0", "0000000000000000a3ce929d0e0e4736"},
+		{"0", ""},
+		{traceID + "-" + spanID + "-1-05e3ac9a4f6e3b90-extra", ""},
+		{traceID[1:] + "-" + spanID, ""},
+		{traceID + "-000000000000000z", ""},
+		{"00000000000000000000000000000000-" + spanID, ""},
+	} {
+		id, err := propagation.ParseB3(test.header)
+		if test.trace == "" {
+			if err == nil {
+				t.Errorf("ParseB3(%q) = %v, want an error", test.header, &id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseB3(%q) failed: %v", test.header, err)
+			continue
+		}
+		if id.TraceID.String() != test.trace || id.SpanID.String() != spanID {
+			t.Errorf("ParseB3(%q) = %v, want %s:%s", test.header, &id, test.trace, spanID)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	var spans []*export.Span
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			spans = append(spans, export.GetSpan(ctx))
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	propagator := propagation.Composite{propagation.TraceContext{}, propagation.B3{}}
+	for _, incoming := range []propagation.MapCarrier{
+		{propagation.TraceParentHeader: parent},
+		{propagation.B3Header: traceID + "-" + spanID + "-1"},
+		{propagation.B3TraceIDHeader: traceID, propagation.B3SpanIDHeader: spanID},
+	} {
+		spans = nil
+		ctx, done := event.Start(propagator.Extract(context.Background(), incoming), "request")
+		done()
+		if len(spans) != 1 {
+			t.Fatalf("%v: got %d spans, want 1", incoming, len(spans))
+		}
+		span := spans[0]
+		if span.ID.TraceID.String() != traceID || span.ParentID.String() != spanID {
+			t.Errorf("%v: span has trace %v and parent %v, want %s and %s",
+				incoming, span.ID.TraceID, span.ParentID, traceID, spanID)
+		}
+
+		outgoing := propagation.MapCarrier{}
+		propagator.Inject(ctx, outgoing)
+		self := span.ID.SpanID.String()
+		want := propagation.MapCarrier{
+			propagation.TraceParentHeader:    "00-" + traceID + "-" + self + "-01",
+			propagation.B3TraceIDHeader:      traceID,
+			propagation.B3SpanIDHeader:       self,
+			propagation.B3ParentSpanIDHeader: spanID,
+			propagation.B3SampledHeader:      "1",
+		}
+		if len(outgoing) != len(want) {
+			t.Errorf("%v: injected %v, want %v", incoming, outgoing, want)
+		}
+		for k, v := range want {
+			if outgoing[k] != v {
+				t.Errorf("%v: injected %s %q, want %q", incoming, k, outgoing[k], v)
+			}
+		}
+
+		single := propagation.MapCarrier{}
+		propagation.B3{SingleHeader: true}.Inject(ctx, single)
+		if got, want := single[propagation.B3Header], traceID+"-"+self+"-1-"+spanID; got != want {
+			t.Errorf("%v: injected b3 %q, want %q", incoming, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package propagation
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+// BaggageHeader is the header name defined by W3C Baggage.
+const BaggageHeader = "baggage"
+
+// Baggage is the Propagator of the baggage header of W3C Baggage, which
+// carries the entries set by export.WithBaggage.
+// The properties of the entries are not supported, and are dropped when they
+// are extracted.
+type Baggage struct{}
+
+func (Baggage) Inject(ctx context.Context, c Carrier) {
+	names := export.BaggageKeys(ctx)
+	if len(names) == 0 {
+		return
+	}
+	members := make([]string, len(names))
+	for i, name := range names {
+		value, _ := export.BaggageValue(ctx, name)
+		members[i] = name + "=" + url.PathEscape(value)
+	}
+	c.Set(BaggageHeader, strings.Join(members, ","))
+}
+
+func (Baggage) Extract(ctx context.Context, c Carrier) context.Context {
+	header := c.Get(BaggageHeader)
+	if header == "" {
+		return ctx
+	}
+	for _, member := range strings.Split(header, ",") {
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i]
+		}
+		i := strings.IndexByte(member, '=')
+		if i < 0 {
+			continue
+		}
+		name := strings.TrimSpace(member[:i])
+		value, err := url.PathUnescape(strings.TrimSpace(member[i+1:]))
+		if name == "" || err != nil {
+			continue
+		}
+		ctx = export.WithBaggage(ctx, name, value)
+	}
+	return ctx
+}
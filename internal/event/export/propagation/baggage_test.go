@@ -0,0 +1,44 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package propagation_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/propagation"
+)
+
+func TestBaggage(t *testing.T) {
+	incoming := propagation.MapCarrier{
+		propagation.TraceParentHeader: parent,
+		propagation.BaggageHeader:     " client = vscode ;prop=1, workspace=a%2Cb%20c,invalid",
+	}
+	ctx := propagation.Extract(context.Background(), incoming)
+	for key, want := range map[string]string{"client": "vscode", "workspace": "a,b c"} {
+		if got, _ := export.BaggageValue(ctx, key); got != want {
+			t.Errorf("baggage %s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := export.BaggageValue(ctx, "invalid"); ok {
+		t.Errorf("extracted a baggage entry without a value")
+	}
+
+	outgoing := propagation.MapCarrier{}
+	propagation.Inject(ctx, outgoing)
+	if got, want := outgoing[propagation.BaggageHeader], "client=vscode,workspace=a%2Cb%20c"; got != want {
+		t.Errorf("injected baggage %q, want %q", got, want)
+	}
+
+	// Baggage is extracted along with the span of any other format.
+	ctx = propagation.Composite{propagation.B3{}, propagation.Baggage{}}.Extract(context.Background(), propagation.MapCarrier{
+		propagation.B3Header:      traceID + "-" + spanID,
+		propagation.BaggageHeader: "client=vim",
+	})
+	if got, _ := export.BaggageValue(ctx, "client"); got != "vim" {
+		t.Errorf("baggage with a B3 span has client %q, want %q", got, "vim")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package propagation carries span contexts across process boundaries in the
+// traceparent and tracestate headers of W3C Trace Context, so that the spans
+// of gopls link up with those of its callers, such as a remote LSP forwarder
+// or a CI runner.
+//
+// Extract returns a context in which the next span started by event.Start is
+// a child of the caller's span, and Inject passes the current span on to a
+// request made to another process, along with the baggage set by
+// export.WithBaggage. Other formats, such as Zipkin's B3, are supported by
+// Propagators, and several can be accepted at once by a Composite.
+// The spans must be tracked by export.Spans.
+package propagation
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+// The header names defined by W3C Trace Context.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// Carrier is the set of headers of a request, or anything else that can hold
+// string values by name.
+type Carrier interface {
+	// Get returns the value of the header, or the empty string if it is not
+	// set.
+	Get(key string) string
+	// Set replaces the value of the header.
+	Set(key, value string)
+}
+
+// HeaderCarrier adapts an http.Header to a Carrier.
+type HeaderCarrier http.Header
+
+func (h HeaderCarrier) Get(key string) string { return http.Header(h).Get(key) }
+func (h HeaderCarrier) Set(key, value string) { http.Header(h).Set(key, value) }
+
+// MapCarrier is a Carrier held in a map, such as the environment of a child
+// process or the metadata of a message.
+type MapCarrier map[string]string
+
+func (m MapCarrier) Get(key string) string { return m[key] }
+func (m MapCarrier) Set(key, value string) { m[key] = value }
+
+// Propagator passes span contexts on in a particular format.
+type Propagator interface {
+	// Inject sets the headers that describe the current span of ctx in c.
+	// It does nothing if there is no current span.
+	Inject(ctx context.Context, c Carrier)
+	// Extract returns a context in which the spans started without a local
+	// parent are children of the span described by the headers in c, as set
+	// by export.WithRemoteParent, or which holds what else the headers carry.
+	// If c holds none of the headers it understands, it returns ctx itself.
+	Extract(ctx context.Context, c Carrier) context.Context
+}
+
+// Composite is a Propagator that injects the headers of all its propagators,
+// so that a process can talk to peers that have not all moved to the same
+// format, and extracts with all of them, so that each adds what it finds.
+// If more than one of them finds a span, the first one's is the parent.
+type Composite []Propagator
+
+func (p Composite) Inject(ctx context.Context, c Carrier) {
+	for _, propagator := range p {
+		propagator.Inject(ctx, c)
+	}
+}
+
+func (p Composite) Extract(ctx context.Context, c Carrier) context.Context {
+	// The remote parent set last is the one that is found, so the first
+	// propagator extracts last.
+	for i := len(p) - 1; i >= 0; i-- {
+		ctx = p[i].Extract(ctx, c)
+	}
+	return ctx
+}
+
+// TraceContext is the Propagator of the W3C Trace Context headers.
+type TraceContext struct{}
+
+// W3C is the Propagator of both the W3C Trace Context and W3C Baggage
+// headers.
+var W3C = Composite{TraceContext{}, Baggage{}}
+
+// Inject sets the W3C headers that describe the current span and the baggage
+// of ctx in c.
+func Inject(ctx context.Context, c Carrier) {
+	W3C.Inject(ctx, c)
+}
+
+// Extract returns a context in which new spans are children of the span
+// described by the W3C headers in c, and which holds the baggage they carry.
+func Extract(ctx context.Context, c Carrier) context.Context {
+	return W3C.Extract(ctx, c)
+}
+
+func (TraceContext) Inject(ctx context.Context, c Carrier) {
+	span := export.GetSpan(ctx)
+	if span == nil {
+		return
+	}
+	c.Set(TraceParentHeader, FormatTraceParent(span.ID, span.Sampled()))
+	if span.TraceState != "" {
+		c.Set(TraceStateHeader, span.TraceState)
+	}
+}
+
+// Extract ignores the tracestate header if there is no valid traceparent
+// header, and the spans start new traces, as the specification requires.
+func (TraceContext) Extract(ctx context.Context, c Carrier) context.Context {
+	id, flags, err := parseTraceParent(c.Get(TraceParentHeader))
+	if err != nil {
+		return ctx
+	}
+	return export.WithRemoteParent(ctx, export.RemoteParent{
+		ID:         id,
+		TraceState: c.Get(TraceStateHeader),
+		Sampled:    flags&sampledFlag != 0,
+	})
+}
+
+// InjectHeader sets the W3C headers that describe the current span and the
+// baggage of ctx in h.
+func InjectHeader(ctx context.Context, h http.Header) {
+	Inject(ctx, HeaderCarrier(h))
+}
+
+// ExtractHeader returns a context in which new spans are children of the span
+// described by the W3C headers in h, as described by Extract.
+func ExtractHeader(ctx context.Context, h http.Header) context.Context {
+	return Extract(ctx, HeaderCarrier(h))
+}
+
+// sampledFlag is the trace flag set for spans that were sampled.
+const sampledFlag = 0x01
+
+// FormatTraceParent returns the traceparent header describing the span, and
+// whether it was sampled.
+func FormatTraceParent(id export.SpanContext, sampled bool) string {
+	var flags byte
+	if sampled {
+		flags |= sampledFlag
+	}
+	return fmt.Sprintf("00-%v-%v-%02x", id.TraceID, id.SpanID, flags)
+}
+
+// ParseTraceParent returns the span described by a traceparent header.
+// Headers of later versions than 00 are accepted as long as they start with
+// the fields of version 00, as the specification requires.
+func ParseTraceParent(header string) (export.SpanContext, error) {
+	id, _, err := parseTraceParent(header)
+	return id, err
+}
+
+// parseTraceParent returns the span described by a traceparent header, and
+// its trace flags.
+func parseTraceParent(header string) (export.SpanContext, byte, error) {
+	var id export.SpanContext
+	header = strings.TrimSpace(header)
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	const length = 2 + 1 + 32 + 1 + 16 + 1 + 2
+	if len(header) < length {
+		return id, 0, fmt.Errorf("traceparent %q is too short", header)
+	}
+	version := header[:2]
+	switch {
+	case !isLowerHex(version) || version == "ff":
+		return id, 0, fmt.Errorf("traceparent %q has an invalid version", header)
+	case version == "00" && len(header) != length:
+		return id, 0, fmt.Errorf("traceparent %q is too long for version 00", header)
+	case len(header) > length && header[length] != '-':
+		return id, 0, fmt.Errorf("traceparent %q has an invalid extension", header)
+	case header[2] != '-' || header[35] != '-' || header[52] != '-':
+		return id, 0, fmt.Errorf("traceparent %q is not separated by dashes", header)
+	}
+	traceID, spanID, flags := header[3:35], header[36:52], header[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return id, 0, fmt.Errorf("traceparent %q is not lowercase hexadecimal", header)
+	}
+	var flagBytes [1]byte
+	hex.Decode(id.TraceID[:], []byte(traceID))
+	hex.Decode(id.SpanID[:], []byte(spanID))
+	hex.Decode(flagBytes[:], []byte(flags))
+	if id.TraceID == (export.TraceID{}) || !id.SpanID.IsValid() {
+		return export.SpanContext{}, 0, fmt.Errorf("traceparent %q has a zero ID", header)
+	}
+	return id, flagBytes[0], nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
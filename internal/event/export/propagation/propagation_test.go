@@ -0,0 +1,131 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package propagation_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/propagation"
+	"golang.org/x/tools/internal/event/label"
+)
+
+const (
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID  = "00f067aa0ba902b7"
+	parent  = "00-" + traceID + "-" + spanID + "-01"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		valid  bool
+	}{
+		{parent, true},
+		{" " + parent + " ", true},
+		{"00-" + traceID + "-" + spanID + "-00", true},
+		{"01-" + traceID + "-" + spanID + "-01-future", true},
+		{"01-" + traceID + "-" + spanID + "-01", true},
+		{"", false},
+		{"ff-" + traceID + "-" + spanID + "-01", false},
+		{parent + "-extra", false},
+		{"01-" + traceID + "-" + spanID + "-01.future", false},
+		{"00-" + "4BF92F3577B34DA6A3CE929D0E0E4736" + "-" + spanID + "-01", false},
+		{"00-00000000000000000000000000000000-" + spanID + "-01", false},
+		{"00-" + traceID + "-0000000000000000-01", false},
+		{"00_" + traceID + "_" + spanID + "_01", false},
+	} {
+		id, err := propagation.ParseTraceParent(test.header)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseTraceParent(%q) returned error %v, want valid %v", test.header, err, test.valid)
+			continue
+		}
+		if test.valid && (id.TraceID.String() != traceID || id.SpanID.String() != spanID) {
+			t.Errorf("ParseTraceParent(%q) = %v, want %s:%s", test.header, &id, traceID, spanID)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var spans []*export.Span
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			spans = append(spans, export.GetSpan(ctx))
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	incoming := http.Header{}
+	incoming.Set(propagation.TraceParentHeader, parent)
+	incoming.Set(propagation.TraceStateHeader, "vendor=value")
+	ctx := propagation.ExtractHeader(context.Background(), incoming)
+
+	ctx, done := event.Start(ctx, "request")
+	defer done()
+	child, doneChild := event.Start(ctx, "child")
+	defer doneChild()
+	// A detached span starts a new trace.
+	_, doneDetached := event.Start(event.Detach(ctx), "detached")
+	defer doneDetached()
+
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	request, nested, detached := spans[0], spans[1], spans[2]
+	if got := request.ID.TraceID.String(); got != traceID {
+		t.Errorf("request span has trace %s, want %s", got, traceID)
+	}
+	if got := request.ParentID.String(); got != spanID {
+		t.Errorf("request span has parent %s, want %s", got, spanID)
+	}
+	if nested.ID.TraceID != request.ID.TraceID || nested.ParentID != request.ID.SpanID {
+		t.Errorf("child span is not a child of the request span")
+	}
+	if detached.ID.TraceID == request.ID.TraceID || detached.ParentID.IsValid() {
+		t.Errorf("detached span continued the remote trace")
+	}
+
+	outgoing := propagation.MapCarrier{}
+	propagation.Inject(child, outgoing)
+	want := "00-" + traceID + "-" + nested.ID.SpanID.String() + "-01"
+	if got := outgoing[propagation.TraceParentHeader]; got != want {
+		t.Errorf("injected traceparent %q, want %q", got, want)
+	}
+	if got := outgoing[propagation.TraceStateHeader]; got != "vendor=value" {
+		t.Errorf("injected tracestate %q, want %q", got, "vendor=value")
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	ctx := context.Background()
+	if got := propagation.Extract(ctx, propagation.MapCarrier{propagation.TraceParentHeader: "garbage"}); got != ctx {
+		t.Errorf("Extract changed the context for an invalid traceparent")
+	}
+}
+
+func TestSampledFlag(t *testing.T) {
+	sampler := export.ApplySampler(export.ParentBased(export.AlwaysOn))
+	event.SetExporter(export.Wrap(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		return ctx
+	}, export.Spans, sampler))
+	defer event.SetExporter(nil)
+
+	for _, flags := range []string{"00", "01"} {
+		incoming := propagation.MapCarrier{propagation.TraceParentHeader: "00-" + traceID + "-" + spanID + "-" + flags}
+		ctx, done := event.Start(propagation.Extract(context.Background(), incoming), "request")
+		outgoing := propagation.MapCarrier{}
+		propagation.Inject(ctx, outgoing)
+		done()
+		if got := outgoing[propagation.TraceParentHeader]; !strings.HasSuffix(got, "-"+flags) {
+			t.Errorf("span with a parent with flags %s injected %q", flags, got)
+		}
+	}
+}
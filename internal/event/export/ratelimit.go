@@ -0,0 +1,91 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// RateLimiter is an exporter that caps the rate at which log events and spans
+// are delivered to another exporter.
+type RateLimiter struct {
+	output  event.Exporter
+	dropped int64 // accessed atomically
+
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // maximum number of tokens
+	tokens float64
+	last   time.Time
+}
+
+// RateLimit returns a RateLimiter that delivers at most perSecond log events
+// and spans each second to output, allowing bursts of up to burst items.
+// Items over the limit are dropped. When a span is dropped its end event is
+// dropped too. Metrics and label events are never limited.
+func RateLimit(output event.Exporter, perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		output: output,
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// ProcessEvent implements event.Exporter.
+func (r *RateLimiter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	switch {
+	case event.IsStart(ev):
+		if !r.take() {
+			atomic.AddInt64(&r.dropped, 1)
+			return markSpan(ctx, true)
+		}
+		ctx = markSpan(ctx, false)
+	case event.IsEnd(ev):
+		if spanDropped(ctx) {
+			return ctx
+		}
+	case event.IsLog(ev):
+		if !r.take() {
+			atomic.AddInt64(&r.dropped, 1)
+			return ctx
+		}
+	}
+	return r.output(ctx, ev, lm)
+}
+
+// Dropped returns the number of log events and spans dropped so far.
+func (r *RateLimiter) Dropped() int64 {
+	return atomic.LoadInt64(&r.dropped)
+}
+
+// take removes a token from the bucket, reporting false if there was not one.
+func (r *RateLimiter) take() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := core.Now()
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+	}
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
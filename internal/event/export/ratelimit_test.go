@@ -0,0 +1,35 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestRateLimit(t *testing.T) {
+	r := &recorder{}
+	// a rate this low means no tokens are added while the test runs
+	limiter := export.RateLimit(r.ProcessEvent, 1e-9, 3)
+	event.SetExporter(export.Spans(limiter.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	event.Log(ctx, "one")
+	_, done := event.Start(ctx, "two")
+	done()
+	event.Log(ctx, "three")
+	event.Log(ctx, "four")
+	_, done = event.Start(ctx, "five")
+	done()
+
+	r.check(t, "log one", "start two", "end two", "log three")
+	if got := limiter.Dropped(); got != 2 {
+		t.Errorf("Dropped() = %d, want 2", got)
+	}
+}
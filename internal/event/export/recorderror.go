@@ -0,0 +1,121 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+var (
+	// ErrorChain labels the events logged by RecordError with the type and
+	// message of every error in the chain of the recorded error, one per line
+	// starting with the error itself.
+	ErrorChain = keys.NewString("error.chain", "The errors wrapped by the recorded error.")
+	// ErrorStack labels the events logged by RecordErrorStack with the stack
+	// of the goroutine that recorded the error.
+	ErrorStack = keys.NewString("error.stack", "The stack trace of the recorded error.")
+)
+
+// RecordError marks the current span of ctx as failed with err, and logs err
+// on it labelled with its ErrorChain, so that the span exporters show what
+// went wrong with the span and the metrics derived from spans count it as an
+// error. It does nothing if err is nil.
+func RecordError(ctx context.Context, err error, labels ...label.Label) {
+	recordError(ctx, err, 0, labels)
+}
+
+// RecordErrorStack is like RecordError, but also labels the error with the
+// stack of its caller as ErrorStack.
+func RecordErrorStack(ctx context.Context, err error, labels ...label.Label) {
+	// Skip runtime.Callers, callers, recordError and RecordErrorStack.
+	recordError(ctx, err, 4, labels)
+}
+
+// RecordPanic records a panic on the current span of ctx, as an error labelled
+// with the stack of the panic as ErrorStack, and then lets the panic continue,
+// so that crashes of instrumented code show up in the telemetry. It must be
+// deferred:
+//
+//	defer export.RecordPanic(ctx)
+func RecordPanic(ctx context.Context) {
+	if r := recover(); r != nil {
+		recordPanic(ctx, r)
+		panic(r)
+	}
+}
+
+// recordPanic records the value of a panic as described by RecordPanic. It
+// must be called by the deferred function that recovered the value.
+func recordPanic(ctx context.Context, value interface{}) {
+	err, ok := value.(error)
+	if ok {
+		err = fmt.Errorf("panic: %w", err)
+	} else {
+		err = fmt.Errorf("panic: %v", value)
+	}
+	// Skip runtime.Callers, callers, recordError, recordPanic and the deferred
+	// function, which leaves the frames of the panic itself.
+	recordError(ctx, err, 5, nil)
+}
+
+// recordError records err as described by RecordError, labelled with the
+// stack of the caller if stack is the number of frames to skip to reach it.
+func recordError(ctx context.Context, err error, stack int, labels []label.Label) {
+	if err == nil {
+		return
+	}
+	if span := GetSpan(ctx); span != nil {
+		span.SetStatus(SpanStatusError, err.Error())
+	}
+	labels = append(labels, ErrorChain.Of(errorChain(err)))
+	if stack > 0 {
+		labels = append(labels, ErrorStack.Of(callers(stack)))
+	}
+	event.Error(ctx, "", err, labels...)
+}
+
+// errorChain describes err and every error it wraps, one per line.
+func errorChain(err error) string {
+	var b strings.Builder
+	for ; err != nil; err = errors.Unwrap(err) {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%T: %v", err, err)
+	}
+	return b.String()
+}
+
+// callers formats the stack of the calling goroutine, skipping the given
+// number of frames and then any frames of the runtime, such as those that
+// raise a panic, in the form used by panics.
+func callers(skip int) string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	if n == 0 {
+		return ""
+	}
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if b.Len() == 0 && more && strings.HasPrefix(frame.Function, "runtime.") {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestRecordError(t *testing.T) {
+	var spans []*export.Span
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			spans = append(spans, export.GetSpan(ctx))
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	inner := errors.New("connection refused")
+	outer := fmt.Errorf("loading packages: %w", inner)
+
+	ctx, done := event.Start(context.Background(), "recorded")
+	export.RecordErrorStack(ctx, outer)
+	done()
+	recorded := spans[0]
+	if got, want := recorded.Status(), (export.SpanStatus{Code: export.SpanStatusError, Message: outer.Error()}); got != want {
+		t.Errorf("got status %+v, want %+v", got, want)
+	}
+	events := recorded.Events()
+	if len(events) != 1 || !event.IsError(events[0]) {
+		t.Fatalf("got events %v, want the recorded error", events)
+	}
+	wantChain := "*fmt.wrapError: loading packages: connection refused\n*errors.errorString: connection refused"
+	if got := export.ErrorChain.Get(events[0]); got != wantChain {
+		t.Errorf("got chain %q, want %q", got, wantChain)
+	}
+	if got := export.ErrorStack.Get(events[0]); !strings.HasPrefix(got, "golang.org/x/tools/internal/event/export_test.TestRecordError\n") {
+		t.Errorf("stack does not start with the caller of RecordErrorStack:\n%s", got)
+	}
+
+	// A span that only logs an error has failed, unless it says otherwise.
+	ctx, done = event.Start(context.Background(), "logged")
+	event.Error(ctx, "failed", inner)
+	done()
+	ctx, done = event.Start(context.Background(), "succeeded")
+	event.Error(ctx, "retrying", inner)
+	export.GetSpan(ctx).SetStatus(export.SpanStatusOK, "")
+	done()
+	if got, want := spans[1].Status(), (export.SpanStatus{Code: export.SpanStatusError, Message: "failed: connection refused"}); got != want {
+		t.Errorf("got status %+v for a logged error, want %+v", got, want)
+	}
+	if got := spans[2].Status().Code; got != export.SpanStatusOK {
+		t.Errorf("got status code %v after setting it to OK, want %v", got, export.SpanStatusOK)
+	}
+}
+
+func TestRecordPanic(t *testing.T) {
+	var spans []*export.Span
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			spans = append(spans, export.GetSpan(ctx))
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	crash := func(value interface{}) (recovered interface{}) {
+		defer func() { recovered = recover() }()
+		ctx, done := event.Start(context.Background(), "crash")
+		defer done()
+		defer export.RecordPanic(ctx)
+		panic(value)
+	}
+	inner := errors.New("nil map")
+	for i, value := range []interface{}{"out of range", inner} {
+		if got := crash(value); got != value {
+			t.Errorf("recovered %v, want the original panic value %v", got, value)
+		}
+		events := spans[i].Events()
+		if len(events) != 1 || !event.IsError(events[0]) {
+			t.Fatalf("got events %v, want the recorded panic", events)
+		}
+		err := keys.Err.Get(events[0])
+		if want := fmt.Sprintf("panic: %v", value); err == nil || err.Error() != want {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+		if value == inner && !errors.Is(err, inner) {
+			t.Errorf("recorded error %v does not wrap the panic value", err)
+		}
+		if got := spans[i].Status().Code; got != export.SpanStatusError {
+			t.Errorf("got status code %v, want %v", got, export.SpanStatusError)
+		}
+		if got := export.ErrorStack.Get(events[0]); !strings.HasPrefix(got, "golang.org/x/tools/internal/event/export_test.TestRecordPanic.func") {
+			t.Errorf("stack does not start with the function that panicked:\n%s", got)
+		}
+	}
+
+	// Without a panic it does nothing.
+	ctx, done := event.Start(context.Background(), "calm")
+	func() {
+		defer export.RecordPanic(ctx)
+	}()
+	done()
+	if events := spans[2].Events(); len(events) != 0 {
+		t.Errorf("got events %v without a panic", events)
+	}
+}
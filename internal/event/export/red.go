@@ -0,0 +1,81 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// SpanMetrics adds the rate, errors and duration metrics of the spans whose
+// names match pattern to m, and returns middleware that records them when
+// each span ends, so that every operation gets the standard service metrics
+// without any instrumentation beyond its span. The pattern is matched as by
+// TimeSpans.
+// The metrics are named by prefix followed by "requests", the number of spans
+// that ended, "errors", the number of those with an error status,
+// and "duration", a histogram of their durations in milliseconds with the
+// given buckets. All three are grouped by SpanName.
+// The middleware must be wrapped by Spans, and must wrap the exporter of m.
+func SpanMetrics(m *metric.Config, prefix, pattern string, buckets []float64) Middleware {
+	requests := keys.NewInt64(prefix+"requests", "The number of spans that ended.")
+	failures := keys.NewInt64(prefix+"errors", "The number of spans that ended after an error.")
+	duration := keys.NewFloat64(prefix+"duration", "The durations of the spans.")
+	group := []label.Key{SpanName}
+	metric.Scalar{
+		Name:        requests.Name(),
+		Description: requests.Description(),
+		Unit:        metric.UnitDimensionless,
+		Keys:        group,
+	}.SumInt64(m, requests)
+	metric.Scalar{
+		Name:        failures.Name(),
+		Description: failures.Description(),
+		Unit:        metric.UnitDimensionless,
+		Keys:        group,
+	}.SumInt64(m, failures)
+	metric.HistogramFloat64{
+		Name:        duration.Name(),
+		Description: duration.Description(),
+		Unit:        metric.UnitMilliseconds,
+		Keys:        group,
+		Buckets:     buckets,
+	}.Record(m, duration)
+	match := spanPattern(pattern)
+	return func(output event.Exporter) event.Exporter {
+		return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsEnd(ev) {
+				if span := GetSpan(ctx); span != nil && match(span.Name) {
+					elapsed := float64(ev.At().Sub(span.Start().At())) / float64(time.Millisecond)
+					// The errors are recorded even when there are none, so that
+					// every span with requests has an error rate.
+					var failed int64
+					if spanFailed(span) {
+						failed = 1
+					}
+					measure := core.CloneEvent(core.MakeEvent([3]label.Label{
+						keys.Metric.New(),
+						requests.Of(1),
+						duration.Of(elapsed),
+					}, []label.Label{failures.Of(failed)}), ev.At())
+					output(ctx, measure, label.NewMap(SpanName.Of(span.Name)))
+				}
+			}
+			return output(ctx, ev, lm)
+		}
+	}
+}
+
+// spanFailed reports whether the span has an error status, which is what the
+// trace exporters report as the span failing.
+func spanFailed(span *Span) bool {
+	return span.Status().Code == SpanStatusError
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestSpanMetrics(t *testing.T) {
+	clock := &settableClock{at: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	event.SetClock(clock)
+	defer event.SetClock(nil)
+
+	var m metric.Config
+	red := export.SpanMetrics(&m, "rpc_", "rpc.*", []float64{10, 100})
+	event.SetExporter(export.Wrap(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		return ctx
+	}, export.Spans, red, m.Exporter))
+	defer event.SetExporter(nil)
+
+	span := func(name string, d time.Duration, fail bool) {
+		ctx, done := event.Start(context.Background(), name)
+		clock.at = clock.at.Add(d)
+		if fail {
+			event.Error(ctx, "failed", errors.New("boom"))
+		}
+		done()
+	}
+	span("rpc.hover", 20*time.Millisecond, false)
+	span("rpc.hover", 40*time.Millisecond, true)
+	span("rpc.format", 5*time.Millisecond, false)
+	// Spans that do not match are not measured.
+	span("other", time.Second, true)
+
+	metrics := m.Snapshot()
+	if len(metrics) != 3 {
+		t.Fatalf("got %d metrics, want requests, errors and duration", len(metrics))
+	}
+	requests := metrics[0].(*metric.Int64Data)
+	failures := metrics[1].(*metric.Int64Data)
+	duration := metrics[2].(*metric.HistogramFloat64Data)
+	for i, want := range []struct {
+		name     string
+		requests int64
+		errors   int64
+		sum      float64
+	}{
+		{"rpc.format", 1, 0, 5},
+		{"rpc.hover", 2, 1, 60},
+	} {
+		if got := export.SpanName.From(requests.Groups()[i][0]); got != want.name {
+			t.Errorf("row %d is for %q, want %q", i, got, want.name)
+		}
+		if got := requests.Rows[i]; got != want.requests {
+			t.Errorf("%s: got %d requests, want %d", want.name, got, want.requests)
+		}
+		if got := failures.Rows[i]; got != want.errors {
+			t.Errorf("%s: got %d errors, want %d", want.name, got, want.errors)
+		}
+		if got := duration.Rows[i].Sum; got != want.sum {
+			t.Errorf("%s: got a total duration of %vms, want %vms", want.name, got, want.sum)
+		}
+	}
+	if got := metric.UnitOf(duration); got != metric.UnitMilliseconds {
+		t.Errorf("duration has unit %q, want %q", got, metric.UnitMilliseconds)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+)
+
+// Factory builds an exporter from an options string.
+// The meaning of the options is entirely up to the factory, for network
+// exporters it is normally the address to connect to.
+// Along with the exporter it returns the Shutdowner that delivers what the
+// exporter holds and releases its listeners, files, goroutines and
+// connections, or nil if there is nothing to release.
+type Factory func(options string) (event.Exporter, Shutdowner, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("log", func(options string) (event.Exporter, Shutdowner, error) {
+		switch options {
+		case "", "all":
+			return LogWriter(os.Stderr, false), nil, nil
+		case "errors":
+			return LogWriter(os.Stderr, true), nil, nil
+		default:
+			return nil, nil, fmt.Errorf("log exporter: unknown option %q", options)
+		}
+	})
+}
+
+// Register makes an exporter factory available under the given name.
+// It is normally called from the init function of the package that
+// implements the exporter.
+// It panics if the name is empty, or already has a factory registered.
+func Register(name string, factory Factory) {
+	if name == "" || strings.ContainsAny(name, ":,=") {
+		panic(fmt.Sprintf("invalid exporter name %q", name))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, found := registry[name]; found {
+		panic(fmt.Sprintf("exporter %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New builds an exporter using the factory registered with the given name.
+// The Shutdowner, if not nil, must be shut down once the exporter is no
+// longer needed.
+func New(name, options string) (event.Exporter, Shutdowner, error) {
+	registryMu.Lock()
+	factory, found := registry[name]
+	registryMu.Unlock()
+	if !found {
+		return nil, nil, fmt.Errorf("no exporter named %q, available exporters are %v", name, Names())
+	}
+	return factory(options)
+}
+
+// TelemetryEnv is the environment variable read by FromEnv.
+const TelemetryEnv = "GOTOOLS_TELEMETRY"
+
+// Parse builds an exporter from a specification of the form "name",
+// "name:options" or "name=options", as might be supplied on a command line.
+// The Shutdowner is the one returned by New.
+func Parse(spec string) (event.Exporter, Shutdowner, error) {
+	name, options := spec, ""
+	if i := strings.IndexAny(spec, ":="); i >= 0 {
+		name, options = spec[:i], spec[i+1:]
+	}
+	return New(name, options)
+}
+
+// ParseList builds an exporter from a comma separated list of
+// specifications in the form accepted by Parse, which delivers every event to
+// all of them, and the Shutdowner that shuts them all down.
+// An entry of "off" overrides all the others, and an empty list selects no
+// exporters, in both cases ParseList returns a nil exporter.
+// If any of the specifications fails, the exporters already built are shut
+// down before the error is returned.
+func ParseList(list string) (event.Exporter, Shutdowner, error) {
+	var specs []string
+	for _, spec := range strings.Split(list, ",") {
+		switch spec = strings.TrimSpace(spec); spec {
+		case "":
+		case "off":
+			return nil, nil, nil
+		default:
+			specs = append(specs, spec)
+		}
+	}
+	exporters := make([]event.Exporter, 0, len(specs))
+	var shutdowners []interface{}
+	for _, spec := range specs {
+		e, s, err := Parse(spec)
+		if err != nil {
+			if built := ShutdownAll(shutdowners...); built != nil {
+				ctx, cancel := TimeoutContext(context.Background())
+				ReportError(built.Shutdown(ctx))
+				cancel()
+			}
+			return nil, nil, err
+		}
+		exporters = append(exporters, e)
+		if s != nil {
+			shutdowners = append(shutdowners, s)
+		}
+	}
+	if len(exporters) == 0 {
+		return nil, nil, nil
+	}
+	return Multi(exporters...), ShutdownAll(shutdowners...), nil
+}
+
+// FromEnv builds the exporters listed in the GOTOOLS_TELEMETRY environment
+// variable, for example
+//
+//	GOTOOLS_TELEMETRY=ocagent=localhost:55678,prometheus=:9090
+//
+// It returns a nil exporter if the variable is unset or "off", and the
+// Shutdowner as ParseList does.
+// Like any other backend, the result must be wrapped by Spans and Labels,
+// and by a metric.Config exporter to see metrics.
+func FromEnv() (event.Exporter, Shutdowner, error) {
+	e, s, err := ParseList(os.Getenv(TelemetryEnv))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", TelemetryEnv, err)
+	}
+	return e, s, nil
+}
+
+// Names returns the sorted names of all the registered exporters.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
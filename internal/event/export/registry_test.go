@@ -0,0 +1,101 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestRegistry(t *testing.T) {
+	var gotOptions string
+	export.Register("registry-test", func(options string) (event.Exporter, export.Shutdowner, error) {
+		gotOptions = options
+		return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			return ctx
+		}, nil, nil
+	})
+
+	found := false
+	for _, name := range export.Names() {
+		if name == "registry-test" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Names() = %v, missing registry-test", export.Names())
+	}
+
+	if _, _, err := export.Parse("registry-test:localhost:1234"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "localhost:1234"; gotOptions != want {
+		t.Errorf("factory got options %q, want %q", gotOptions, want)
+	}
+	if _, _, err := export.New("no-such-exporter", ""); err == nil {
+		t.Error("New of an unregistered exporter succeeded")
+	}
+	if _, _, err := export.Parse("log:bogus"); err == nil {
+		t.Error("Parse with invalid log options succeeded")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	for _, test := range []struct {
+		value   string
+		enabled bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"off", false, false},
+		{"log=errors, log:all", true, false},
+		{"log,off", false, false},
+		{"log,no-such-exporter", false, true},
+	} {
+		t.Setenv(export.TelemetryEnv, test.value)
+		e, _, err := export.FromEnv()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: got error %v, want error %v", test.value, err, test.wantErr)
+		}
+		if (e != nil) != test.enabled {
+			t.Errorf("%q: got exporter %v, want %v", test.value, e != nil, test.enabled)
+		}
+	}
+}
+
+func TestParseListShutdown(t *testing.T) {
+	var built []*shutdownRecorder
+	export.Register("registry-held", func(options string) (event.Exporter, export.Shutdowner, error) {
+		r := &shutdownRecorder{}
+		built = append(built, r)
+		return export.Null(), r, nil
+	})
+
+	_, shutdown, err := export.ParseList("registry-held,registry-held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range built {
+		if r.shutdown != 1 {
+			t.Errorf("exporter %d was shut down %d times, want 1", i, r.shutdown)
+		}
+	}
+
+	built = nil
+	if _, _, err := export.ParseList("registry-held,no-such-exporter"); err == nil {
+		t.Fatal("ParseList with an unregistered exporter succeeded")
+	}
+	if len(built) != 1 || built[0].shutdown != 1 {
+		t.Errorf("ParseList did not shut down the exporter it built before failing")
+	}
+}
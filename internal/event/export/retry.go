@@ -0,0 +1,101 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"golang.org/x/tools/internal/event/export/metric"
+)
+
+// BackoffPolicy controls how Retry spaces out delivery attempts.
+type BackoffPolicy struct {
+	// Initial is the delay before the first retry, it defaults to 100ms.
+	Initial time.Duration
+	// Max is the longest delay between two retries, it defaults to 5s.
+	Max time.Duration
+	// Multiplier is the factor the delay grows by after each retry, it
+	// defaults to 2.
+	Multiplier float64
+	// Jitter is the fraction by which each delay is randomly lengthened or
+	// shortened, so that many clients do not retry in lock step.
+	Jitter float64
+	// MaxElapsed is how long after the first attempt Retry gives up and
+	// returns the last error.
+	// A policy with no MaxElapsed does not retry at all.
+	MaxElapsed time.Duration
+}
+
+// Retry returns a BatchExporter that calls exporter again whenever it fails,
+// waiting longer between each attempt as described by the policy.
+// Each call blocks until the batch is delivered, the policy gives up or the
+// context is done, so the result is normally wrapped by Batch to keep the
+// retries off the path of the code producing the telemetry.
+func Retry(exporter BatchExporter, policy BackoffPolicy) BatchExporter {
+	if policy.MaxElapsed <= 0 {
+		return exporter
+	}
+	if policy.Initial <= 0 {
+		policy.Initial = 100 * time.Millisecond
+	}
+	if policy.Max <= 0 {
+		policy.Max = 5 * time.Second
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	return &retrier{exporter: exporter, policy: policy}
+}
+
+type retrier struct {
+	exporter BatchExporter
+	policy   BackoffPolicy
+}
+
+func (r *retrier) ExportSpans(ctx context.Context, spans []*Span) error {
+	return r.retry(ctx, func() error { return r.exporter.ExportSpans(ctx, spans) })
+}
+
+func (r *retrier) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return r.retry(ctx, func() error { return r.exporter.ExportMetrics(ctx, metrics) })
+}
+
+func (r *retrier) retry(ctx context.Context, attempt func() error) error {
+	deadline := time.Now().Add(r.policy.MaxElapsed)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		// There is no point waiting for a retry the context will not allow.
+		deadline = d
+	}
+	interval := r.policy.Initial
+	for retries := int64(0); ; retries++ {
+		err := attempt()
+		if retries > 0 {
+			self.observe(ExporterKind.Of("retry"), ExportRetries.Of(1))
+		}
+		if err == nil {
+			return nil
+		}
+		wait := interval
+		if r.policy.Jitter > 0 {
+			wait += time.Duration((rand.Float64()*2 - 1) * r.policy.Jitter * float64(interval))
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		interval = time.Duration(float64(interval) * r.policy.Multiplier)
+		if interval > r.policy.Max {
+			interval = r.policy.Max
+		}
+	}
+}
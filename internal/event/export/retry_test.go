@@ -0,0 +1,74 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+)
+
+// flakyExporter is a BatchExporter that fails a fixed number of times before
+// it starts succeeding.
+type flakyExporter struct {
+	failures int
+	attempts int
+}
+
+func (f *flakyExporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return errors.New("collector unavailable")
+	}
+	return nil
+}
+
+func (f *flakyExporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return f.ExportSpans(ctx, nil)
+}
+
+func TestRetry(t *testing.T) {
+	policy := export.BackoffPolicy{
+		Initial:    time.Millisecond,
+		Max:        2 * time.Millisecond,
+		Jitter:     0.5,
+		MaxElapsed: 10 * time.Second,
+	}
+	ctx := context.Background()
+
+	f := &flakyExporter{failures: 3}
+	if err := export.Retry(f, policy).ExportSpans(ctx, nil); err != nil {
+		t.Fatalf("retried export failed: %v", err)
+	}
+	if f.attempts != 4 {
+		t.Errorf("got %d attempts, want 4", f.attempts)
+	}
+
+	policy.Initial, policy.MaxElapsed = time.Hour, time.Minute
+	f = &flakyExporter{failures: 3}
+	if err := export.Retry(f, policy).ExportMetrics(ctx, nil); err == nil {
+		t.Fatal("export succeeded, want it to give up before the first retry")
+	}
+	if f.attempts != 1 {
+		t.Errorf("got %d attempts, want 1", f.attempts)
+	}
+
+	policy.MaxElapsed = 2 * time.Hour
+	f = &flakyExporter{failures: 3}
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := export.Retry(f, policy).ExportSpans(cancelled, nil); err == nil {
+		t.Fatal("export succeeded, want it to stop when the context is done")
+	}
+
+	f = &flakyExporter{failures: 3}
+	if err := export.Retry(f, export.BackoffPolicy{}).ExportSpans(ctx, nil); err == nil || f.attempts != 1 {
+		t.Errorf("zero policy made %d attempts, want 1", f.attempts)
+	}
+}
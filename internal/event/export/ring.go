@@ -0,0 +1,101 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// FlightRecorder is an exporter that keeps the most recent spans and log
+// events in memory, so that they can be inspected after something has gone
+// wrong.
+type FlightRecorder struct {
+	mu         sync.Mutex
+	spans      []*Span
+	nextSpan   int
+	events     []core.Event
+	nextEvent  int
+	spansFull  bool
+	eventsFull bool
+}
+
+// Recording is a snapshot of the contents of a FlightRecorder.
+type Recording struct {
+	// Spans holds the most recently finished spans, oldest first.
+	Spans []*Span
+	// Events holds the most recent log events, oldest first.
+	Events []core.Event
+}
+
+// RingBuffer returns a FlightRecorder that holds the last n finished spans
+// and the last n log events.
+// It must be wrapped by Spans to see any spans.
+func RingBuffer(n int) *FlightRecorder {
+	if n < 1 {
+		n = 1
+	}
+	return &FlightRecorder{
+		spans:  make([]*Span, n),
+		events: make([]core.Event, n),
+	}
+}
+
+// ProcessEvent implements event.Exporter.
+func (r *FlightRecorder) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	switch {
+	case event.IsEnd(ev):
+		span := GetSpan(ctx)
+		if span == nil {
+			return ctx
+		}
+		r.mu.Lock()
+		r.spans[r.nextSpan] = span
+		r.nextSpan = (r.nextSpan + 1) % len(r.spans)
+		r.spansFull = r.spansFull || r.nextSpan == 0
+		r.mu.Unlock()
+	case event.IsLog(ev):
+		r.mu.Lock()
+		r.events[r.nextEvent] = ev
+		r.nextEvent = (r.nextEvent + 1) % len(r.events)
+		r.eventsFull = r.eventsFull || r.nextEvent == 0
+		r.mu.Unlock()
+	}
+	return ctx
+}
+
+// Snapshot returns a copy of the telemetry currently held by the recorder.
+func (r *FlightRecorder) Snapshot() Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rec Recording
+	if r.spansFull {
+		rec.Spans = append(rec.Spans, r.spans[r.nextSpan:]...)
+	}
+	rec.Spans = append(rec.Spans, r.spans[:r.nextSpan]...)
+	if r.eventsFull {
+		rec.Events = append(rec.Events, r.events[r.nextEvent:]...)
+	}
+	rec.Events = append(rec.Events, r.events[:r.nextEvent]...)
+	return rec
+}
+
+// Dump writes a human readable form of the recording to w, for example
+// when dumping it on a crash.
+func (rec Recording) Dump(w io.Writer) {
+	var p Printer
+	for _, span := range rec.Spans {
+		fmt.Fprintf(w, "span: %v\n", span)
+	}
+	for _, ev := range rec.Events {
+		p.WriteEvent(w, ev, ev)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := export.RingBuffer(3)
+	event.SetExporter(export.Spans(r.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	if rec := r.Snapshot(); len(rec.Spans) != 0 || len(rec.Events) != 0 {
+		t.Fatalf("new recorder holds %v", rec)
+	}
+	event.Log(ctx, "first")
+	_, done := event.Start(ctx, "only")
+	done()
+	rec := r.Snapshot()
+	if len(rec.Spans) != 1 || rec.Spans[0].Name != "only" || len(rec.Events) != 1 {
+		t.Fatalf("got %v, want a single span and event", rec)
+	}
+
+	for i := 0; i < 5; i++ {
+		event.Log(ctx, fmt.Sprint("log ", i))
+		_, done := event.Start(ctx, fmt.Sprint("span ", i))
+		done()
+	}
+	rec = r.Snapshot()
+	var got []string
+	for _, span := range rec.Spans {
+		got = append(got, span.Name)
+	}
+	for _, ev := range rec.Events {
+		got = append(got, keys.Msg.Get(ev))
+	}
+	want := "span 2,span 3,span 4,log 2,log 3,log 4"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var buf strings.Builder
+	rec.Dump(&buf)
+	if !strings.Contains(buf.String(), "span 4") || !strings.Contains(buf.String(), "log 4\n") {
+		t.Errorf("dump is missing recent telemetry:\n%s", buf.String())
+	}
+}
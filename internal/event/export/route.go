@@ -0,0 +1,46 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// RouteConfig names the exporter for each kind of telemetry.
+// A nil exporter discards that kind of telemetry.
+type RouteConfig struct {
+	// Spans receives start, end, detach and label events.
+	Spans event.Exporter
+	// Metrics receives metric events.
+	Metrics event.Exporter
+	// Events receives log events.
+	Events event.Exporter
+}
+
+// Route returns an exporter that delivers each event only to the exporter
+// configured for its kind.
+// The span and label structure is shared by all the routes, so Spans and
+// Labels should be wrapped around the result of Route.
+func Route(cfg RouteConfig) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		var output event.Exporter
+		switch {
+		case event.IsLog(ev):
+			output = cfg.Events
+		case event.IsMetric(ev):
+			output = cfg.Metrics
+		case event.IsStart(ev), event.IsEnd(ev), event.IsDetach(ev), event.IsLabel(ev):
+			output = cfg.Spans
+		}
+		if output == nil {
+			return ctx
+		}
+		return output(ctx, ev, lm)
+	}
+}
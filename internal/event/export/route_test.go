@@ -0,0 +1,38 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestRoute(t *testing.T) {
+	spans, metrics, logs := &recorder{}, &recorder{}, &recorder{}
+	event.SetExporter(export.Spans(export.Route(export.RouteConfig{
+		Spans:   spans.ProcessEvent,
+		Metrics: metrics.ProcessEvent,
+		Events:  logs.ProcessEvent,
+	})))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	ctx, done := event.Start(ctx, "work")
+	event.Log(ctx, "message")
+	event.Metric(ctx)
+	done()
+	spans.check(t, "start work", "end work")
+	metrics.check(t, "metric")
+	logs.check(t, "log message")
+
+	// Unconfigured routes are dropped.
+	event.SetExporter(export.Route(export.RouteConfig{Events: logs.ProcessEvent}))
+	event.Metric(ctx)
+	event.Log(ctx, "still delivered")
+	logs.check(t, "log still delivered")
+}
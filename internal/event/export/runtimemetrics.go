@@ -0,0 +1,187 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+// Keys for the metric events that describe the health of the Go runtime.
+var (
+	HeapInUse  = keys.NewInt64("go.memory.heap_in_use", "Bytes in in-use heap spans.")
+	Goroutines = keys.NewInt64("go.goroutines", "Goroutines that currently exist.")
+	GOMAXPROCS = keys.NewInt64("go.gomaxprocs", "Operating system threads that can execute Go code simultaneously.")
+	GCPause    = keys.NewFloat64("go.gc.pause", "Time the world was stopped by a garbage collection, in milliseconds.")
+)
+
+var (
+	heapInUseMetric = metric.Scalar{
+		Name:        "go.memory.heap_in_use",
+		Description: "Bytes in in-use heap spans.",
+		Unit:        metric.UnitBytes,
+	}
+
+	goroutinesMetric = metric.Scalar{
+		Name:        "go.goroutines",
+		Description: "Number of goroutines that currently exist.",
+	}
+
+	gomaxprocsMetric = metric.Scalar{
+		Name:        "go.gomaxprocs",
+		Description: "Number of operating system threads that can execute Go code simultaneously.",
+	}
+
+	gcPauseMetric = metric.Summary{
+		Name:        "go.gc.pause",
+		Description: "Quantiles of recent garbage collection pauses in milliseconds.",
+		Unit:        metric.UnitMilliseconds,
+	}
+)
+
+// RegisterRuntimeMetrics adds metrics describing the Go runtime to m: the
+// bytes of heap in use, the number of goroutines, GOMAXPROCS, and quantiles
+// of the recent garbage collection pauses.
+// The values are sampled every ten seconds from the first call on, until the
+// package level Shutdown function is called. Flushing does not take a sample,
+// as a collector holds nothing to deliver, and the extra samples would skew
+// the metrics.
+func RegisterRuntimeMetrics(m *metric.Config) {
+	heapInUseMetric.LatestInt64(m, HeapInUse)
+	goroutinesMetric.LatestInt64(m, Goroutines)
+	gomaxprocsMetric.LatestInt64(m, GOMAXPROCS)
+	gcPauseMetric.Record(m, GCPause)
+	runtimeMetrics.enable()
+}
+
+// runtimeMetrics samples the runtime for the whole process, however many
+// metric configurations it has been registered with.
+var runtimeMetrics = &collector{sampler: &runtimeSampler{}}
+
+// collectorInterval is how often a collector emits its metrics.
+const collectorInterval = 10 * time.Second
+
+// sampler emits metric events describing the current state of the process.
+type sampler interface {
+	// begin is called once, before the first sample.
+	begin()
+	sample(ctx context.Context)
+}
+
+// collector calls a sampler from its own goroutine every collectorInterval.
+// It is managed while sampling, so that the package level Shutdown function
+// stops it.
+type collector struct {
+	// mu serializes samples, as samplers hold on to what they last saw, and
+	// guards the fields below.
+	mu      sync.Mutex
+	sampler sampler
+	begun   bool
+	// stop and done are the channels of the sampling goroutine while it runs.
+	stop chan struct{}
+	done chan struct{}
+}
+
+// enable starts the sampling goroutine if it is not running.
+func (c *collector) enable() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	if !c.begun {
+		c.sampler.begin()
+		c.begun = true
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.stop, c.done = stop, done
+	Manage(c)
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(collectorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.sample(context.Background())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown implements Shutdowner, it stops the sampling goroutine, which is
+// started again if the metrics are registered again.
+func (c *collector) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	Unmanage(c)
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *collector) sample(ctx context.Context) {
+	if !event.EnabledContext(ctx) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sampler.sample(ctx)
+}
+
+// runtimeSampler reads the statistics of the Go runtime.
+type runtimeSampler struct {
+	// numGC is the number of garbage collections whose pauses have been
+	// reported.
+	numGC uint32
+}
+
+func (s *runtimeSampler) begin() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	// Only pauses from now on are reported, those from before would all be
+	// reported in the same instant.
+	s.numGC = mem.NumGC
+}
+
+// sample emits the current values of the runtime metrics, and the pauses of
+// the garbage collections since the last sample.
+func (s *runtimeSampler) sample(ctx context.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	event.Metric(ctx,
+		HeapInUse.Of(int64(mem.HeapInuse)),
+		Goroutines.Of(int64(runtime.NumGoroutine())),
+		GOMAXPROCS.Of(int64(runtime.GOMAXPROCS(0))),
+	)
+	// PauseNs is a circular buffer holding the most recent pauses, the older
+	// ones are lost if there have been more collections than it can hold.
+	first := s.numGC
+	if mem.NumGC-first > uint32(len(mem.PauseNs)) {
+		first = mem.NumGC - uint32(len(mem.PauseNs))
+	}
+	for n := first; n < mem.NumGC; n++ {
+		pause := mem.PauseNs[n%uint32(len(mem.PauseNs))]
+		event.Metric(ctx, GCPause.Of(float64(pause)/float64(time.Millisecond)))
+	}
+	s.numGC = mem.NumGC
+}
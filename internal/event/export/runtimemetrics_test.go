@@ -0,0 +1,72 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	var mu sync.Mutex
+	latest := make(map[string]metric.Data)
+	event.SetExporter(export.NewPipeline(
+		export.WithRuntimeMetrics(),
+		export.WithBackend(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsMetric(ev) {
+				mu.Lock()
+				for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+					latest[data.Handle()] = data
+				}
+				mu.Unlock()
+			}
+			return ctx
+		}),
+	).ProcessEvent)
+	defer event.SetExporter(nil)
+
+	// Flushing does not take a sample.
+	if err := export.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if data, found := latest["go.goroutines"]; found {
+		t.Errorf("flush sampled the runtime metrics: %v", data)
+	}
+	mu.Unlock()
+
+	runtime.GC()
+	export.SampleRuntimeMetrics(context.Background())
+	mu.Lock()
+	defer mu.Unlock()
+	gauge := func(name string) int64 {
+		data, ok := latest[name].(*metric.Int64Data)
+		if !ok || !data.IsGauge || len(data.Rows) != 1 {
+			t.Fatalf("%s is %v, want a gauge with a single row", name, latest[name])
+		}
+		return data.Rows[0]
+	}
+	if got := gauge("go.memory.heap_in_use"); got <= 0 {
+		t.Errorf("heap in use is %d, want more than zero", got)
+	}
+	if got := gauge("go.goroutines"); got < 1 {
+		t.Errorf("goroutines is %d, want at least 1", got)
+	}
+	if got, want := gauge("go.gomaxprocs"), int64(runtime.GOMAXPROCS(0)); got != want {
+		t.Errorf("gomaxprocs is %d, want %d", got, want)
+	}
+	pauses, ok := latest["go.gc.pause"].(*metric.Float64Data)
+	if !ok || len(pauses.Rows) != len(metric.DefaultObjectives) {
+		t.Errorf("go.gc.pause is %v, want a row for each default quantile", latest["go.gc.pause"])
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"runtime/trace"
+	"strings"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// The runtime/trace log categories used by RuntimeTrace.
+const (
+	RuntimeTraceLogCategory   = "log"
+	RuntimeTraceErrorCategory = "error"
+)
+
+// RuntimeTrace returns an exporter that mirrors spans and log events into the
+// execution trace collected by runtime/trace, so that the operations seen by
+// telemetry are marked in the output of go tool trace.
+//
+// Each span becomes a task, nested within the task of its parent span.
+// Tasks rather than regions are used because a span may end on a different
+// goroutine from the one that started it, which a region does not permit.
+// The task is carried in the context of the span, and is ended by the end
+// event of that span; spans started while no trace was being collected are
+// not mirrored, even if a trace is started before they end.
+// Log and error events are written with trace.Log against the task of the
+// span they occur in, with the categories RuntimeTraceLogCategory and
+// RuntimeTraceErrorCategory.
+func RuntimeTrace(output event.Exporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsStart(ev):
+			if trace.IsEnabled() {
+				var task *trace.Task
+				ctx, task = trace.NewTask(ctx, keys.Start.Get(lm))
+				ctx = context.WithValue(ctx, runtimeTaskKey, task)
+			}
+		case event.IsEnd(ev):
+			ctx = output(ctx, ev, lm)
+			if task, ok := ctx.Value(runtimeTaskKey).(*trace.Task); ok {
+				task.End()
+			}
+			return ctx
+		case event.IsLog(ev):
+			if trace.IsEnabled() {
+				category := RuntimeTraceLogCategory
+				if event.IsError(ev) {
+					category = RuntimeTraceErrorCategory
+				}
+				trace.Log(ctx, category, runtimeTraceMessage(ev, lm))
+			}
+		}
+		return output(ctx, ev, lm)
+	}
+}
+
+// runtimeTraceMessage formats a log event as a single line, the message
+// followed by the error and the other labels of the event.
+func runtimeTraceMessage(ev core.Event, lm label.Map) string {
+	var b strings.Builder
+	b.WriteString(keys.Msg.Get(lm))
+	if err := keys.Err.Get(lm); err != nil {
+		if b.Len() > 0 {
+			b.WriteString(": ")
+		}
+		b.WriteString(err.Error())
+	}
+	var buf [128]byte
+	for i := 0; ev.Valid(i); i++ {
+		l := ev.Label(i)
+		if !l.Valid() || l.Key() == keys.Msg || l.Key() == keys.Err {
+			continue
+		}
+		b.WriteString(" ")
+		b.WriteString(l.Key().Name())
+		b.WriteString("=")
+		l.Key().Format(&b, buf[:0], l)
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/trace"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+func TestRuntimeTrace(t *testing.T) {
+	event.SetExporter(export.NewPipeline(export.WithRuntimeTrace()).ProcessEvent)
+	defer event.SetExporter(nil)
+
+	// A span started before tracing is not mirrored, but must still end
+	// cleanly.
+	_, earlyDone := event.Start(context.Background(), "early")
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("cannot start runtime trace: %v", err)
+	}
+	ctx, done := event.Start(context.Background(), "hover")
+	event.Log(ctx, "cache miss", keys.NewString("file", "").Of("file.go"))
+	child, childDone := event.Start(ctx, "parse")
+	event.Error(child, "parse failed", errors.New("unexpected EOF"))
+	// The child ends on another goroutine, which a task permits.
+	ended := make(chan struct{})
+	go func() {
+		childDone()
+		close(ended)
+	}()
+	<-ended
+	done()
+	earlyDone()
+	trace.Stop()
+
+	// The trace format is not parsed here, but the strings it records are
+	// stored verbatim.
+	for _, want := range []string{
+		"hover",
+		"parse",
+		export.RuntimeTraceLogCategory,
+		`cache miss file="file.go"`,
+		export.RuntimeTraceErrorCategory,
+		"parse failed: unexpected EOF",
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("runtime trace does not contain %q", want)
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("early")) {
+		t.Error("runtime trace contains a span started before tracing")
+	}
+}
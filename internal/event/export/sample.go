@@ -0,0 +1,157 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// SamplingParameters describes a span that is starting to a Sampler.
+type SamplingParameters struct {
+	Name    string
+	TraceID TraceID
+	// HasParent is whether the span has a parent, in this process or a remote
+	// one, and ParentSampled whether that parent was sampled.
+	HasParent     bool
+	ParentSampled bool
+	// Labels are the labels of the start event.
+	Labels label.Map
+}
+
+// Sampler decides whether the spans that start are kept.
+type Sampler interface {
+	ShouldSample(p SamplingParameters) bool
+}
+
+// SamplerFunc is a Sampler implemented by a function.
+type SamplerFunc func(p SamplingParameters) bool
+
+func (f SamplerFunc) ShouldSample(p SamplingParameters) bool { return f(p) }
+
+var (
+	// AlwaysOn keeps every span.
+	AlwaysOn Sampler = SamplerFunc(func(SamplingParameters) bool { return true })
+	// AlwaysOff drops every span.
+	AlwaysOff Sampler = SamplerFunc(func(SamplingParameters) bool { return false })
+)
+
+// TraceIDRatio returns a Sampler that keeps the given fraction of traces.
+// The decision is made from the trace ID, so every span of a trace is either
+// kept or dropped together, and separate processes sampling at the same rate
+// agree on which traces to keep.
+func TraceIDRatio(fraction float64) Sampler {
+	if fraction >= 1 {
+		return AlwaysOn
+	}
+	var threshold uint64
+	if fraction > 0 {
+		threshold = uint64(fraction * math.MaxUint64)
+	}
+	return SamplerFunc(func(p SamplingParameters) bool {
+		return binary.BigEndian.Uint64(p.TraceID[8:]) < threshold
+	})
+}
+
+// ParentBased returns a Sampler that follows the decision made for the parent
+// of a span, so that traces are never broken up, and leaves the decision for
+// root spans to root.
+func ParentBased(root Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParameters) bool {
+		if p.HasParent {
+			return p.ParentSampled
+		}
+		return root.ShouldSample(p)
+	})
+}
+
+// SamplingRule applies a Sampler to the spans whose names match Pattern, which
+// is matched as by TimeSpans.
+type SamplingRule struct {
+	Pattern string
+	Sampler Sampler
+}
+
+// RuleBased returns a Sampler that applies the sampler of the first rule that
+// matches the name of a span, or fallback if none does, so that noisy
+// operations can be sampled less than rare ones.
+func RuleBased(fallback Sampler, rules ...SamplingRule) Sampler {
+	matches := make([]func(string) bool, len(rules))
+	for i, rule := range rules {
+		matches[i] = spanPattern(rule.Pattern)
+	}
+	return SamplerFunc(func(p SamplingParameters) bool {
+		for i, match := range matches {
+			if match(p.Name) {
+				return rules[i].Sampler.ShouldSample(p)
+			}
+		}
+		return fallback.ShouldSample(p)
+	})
+}
+
+// ApplySampler returns middleware that asks the sampler whether to keep each
+// span as it starts, and only delivers the spans it keeps, and their events,
+// to the output. The decision is recorded on the span, where it can be read
+// with Span.Sampled, and is what ParentBased samplers of its children follow.
+// It must be wrapped by Spans, as it needs the span structure to find the
+// span of an event. Events outside of any span, and metrics, are always
+// delivered.
+func ApplySampler(sampler Sampler) Middleware {
+	return func(output event.Exporter) event.Exporter {
+		return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			switch {
+			case event.IsStart(ev):
+				span := GetSpan(ctx)
+				if span == nil {
+					break
+				}
+				keep := sampler.ShouldSample(SamplingParameters{
+					Name:          span.Name,
+					TraceID:       span.ID.TraceID,
+					HasParent:     span.ParentID.IsValid(),
+					ParentSampled: span.parentSampled,
+					Labels:        lm,
+				})
+				span.mu.Lock()
+				span.unsampled = !keep
+				span.mu.Unlock()
+				if !keep {
+					return markSpan(ctx, true)
+				}
+				ctx = markSpan(ctx, false)
+			case event.IsEnd(ev):
+				if spanDropped(ctx) {
+					return ctx
+				}
+			case event.IsLog(ev), event.IsLabel(ev):
+				if span := GetSpan(ctx); span != nil && !span.Sampled() {
+					return ctx
+				}
+			}
+			return output(ctx, ev, lm)
+		}
+	}
+}
+
+// Sampled returns an exporter that only delivers the given fraction of traces
+// to output.
+// The decision is made from the trace ID, so every span and event of a trace
+// is either delivered or dropped together, and separate processes sampling at
+// the same rate agree on which traces to keep.
+// It must be wrapped by Spans, as it needs the span structure to find the
+// trace of an event. Events outside of any span, and metrics, are always
+// delivered.
+func Sampled(output event.Exporter, fraction float64) event.Exporter {
+	if fraction >= 1 {
+		return output
+	}
+	return ApplySampler(TraceIDRatio(fraction))(output)
+}
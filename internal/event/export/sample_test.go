@@ -0,0 +1,118 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestSampled(t *testing.T) {
+	const traces = 2000
+	starts, ends, logs := 0, 0, 0
+	count := func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsStart(ev):
+			starts++
+		case event.IsEnd(ev):
+			ends++
+		case event.IsLog(ev):
+			logs++
+		}
+		return ctx
+	}
+	event.SetExporter(export.Spans(export.Sampled(count, 0.25)))
+	defer event.SetExporter(nil)
+
+	for i := 0; i < traces; i++ {
+		ctx, done := event.Start(context.Background(), "root")
+		child, childDone := event.Start(ctx, "child")
+		event.Log(child, "inside")
+		childDone()
+		done()
+	}
+	event.Log(context.Background(), "outside")
+
+	// each kept trace has two spans and one log event
+	kept := ends / 2
+	if starts != ends || logs != kept+1 {
+		t.Fatalf("traces were split: %d starts, %d ends, %d logs", starts, ends, logs)
+	}
+	if kept < traces/8 || kept > traces*3/8 {
+		t.Errorf("kept %d of %d traces, want about a quarter", kept, traces)
+	}
+}
+
+func TestSamplers(t *testing.T) {
+	var delivered []string
+	sampler := export.RuleBased(export.ParentBased(export.AlwaysOn),
+		export.SamplingRule{Pattern: "noisy.*", Sampler: export.AlwaysOff},
+		export.SamplingRule{Pattern: "forced", Sampler: export.AlwaysOn},
+	)
+	var spans []*export.Span
+	record := func(output event.Exporter) event.Exporter {
+		return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsStart(ev) {
+				spans = append(spans, export.GetSpan(ctx))
+			}
+			return output(ctx, ev, lm)
+		}
+	}
+	event.SetExporter(export.Wrap(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsStart(ev) {
+			delivered = append(delivered, export.GetSpan(ctx).Name)
+		}
+		return ctx
+	}, export.Spans, record, export.ApplySampler(sampler)))
+	defer event.SetExporter(nil)
+
+	trace := func(root string, children ...string) {
+		ctx, done := event.Start(context.Background(), root)
+		for _, child := range children {
+			_, childDone := event.Start(ctx, child)
+			childDone()
+		}
+		done()
+	}
+	trace("quiet", "child")
+	// Children follow the decision for their parent, unless a rule says
+	// otherwise.
+	trace("noisy.poll", "child", "forced")
+
+	want := []string{"quiet", "child", "forced"}
+	if len(delivered) != len(want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+	for i := range want {
+		if delivered[i] != want[i] {
+			t.Errorf("delivered %v, want %v", delivered, want)
+			break
+		}
+	}
+	// The decisions are recorded on the spans, in the order they started.
+	for i, kept := range []bool{true, true, false, false, true} {
+		if got := spans[i].Sampled(); got != kept {
+			t.Errorf("span %d (%s): Sampled() = %v, want %v", i, spans[i].Name, got, kept)
+		}
+	}
+}
+
+func TestTraceIDRatio(t *testing.T) {
+	var id export.TraceID
+	if export.TraceIDRatio(0).ShouldSample(export.SamplingParameters{TraceID: id}) {
+		t.Error("a ratio of 0 kept a trace")
+	}
+	for i := range id {
+		id[i] = 0xff
+	}
+	if !export.TraceIDRatio(1).ShouldSample(export.SamplingParameters{TraceID: id}) {
+		t.Error("a ratio of 1 dropped a trace")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// Sanitizer maps arbitrary metric and label names to those a backend allows.
+// Each character that is not allowed becomes an underscore, as does an empty
+// name, and a name that must not start with its first character is prefixed
+// with one.
+// As this can map different names to the same one, a Sanitizer remembers the
+// names it has produced: a name that would take one already produced for a
+// different name has a hash of the original appended instead, so the series of
+// two metrics are never merged by the backend. The name produced for a name
+// never changes afterwards, but which of two colliding names keeps the plain
+// form depends on which is seen first.
+// Names are remembered forever, so label values, which are not bound by the
+// instrumentation, are cleaned with Clean instead.
+type Sanitizer struct {
+	allowed func(r rune, first bool) bool
+
+	mu sync.Mutex
+	// names maps each name to the one produced for it, and owners each
+	// produced name back to the name it was produced for.
+	names  map[string]string
+	owners map[string]string
+}
+
+// NewSanitizer returns a Sanitizer that keeps the characters for which
+// allowed returns true. first is set for the first character of a name.
+func NewSanitizer(allowed func(r rune, first bool) bool) *Sanitizer {
+	return &Sanitizer{allowed: allowed}
+}
+
+// The sanitizers of the backends that restrict their names.
+var (
+	// PrometheusNames produces Prometheus metric names.
+	PrometheusNames = NewSanitizer(func(r rune, first bool) bool {
+		return isLetter(r) || r == '_' || r == ':' || (!first && isDigit(r))
+	})
+	// PrometheusLabels produces Prometheus label names.
+	PrometheusLabels = NewSanitizer(func(r rune, first bool) bool {
+		return isLetter(r) || r == '_' || (!first && isDigit(r))
+	})
+	// GraphiteNames produces Graphite metric paths, in which dots separate
+	// the components.
+	GraphiteNames = NewSanitizer(func(r rune, first bool) bool {
+		return isLetter(r) || isDigit(r) || r == '_' || r == '-' || r == '.'
+	})
+	// GraphiteComponents produces single components of Graphite metric
+	// paths, and Graphite tag names.
+	GraphiteComponents = NewSanitizer(func(r rune, first bool) bool {
+		return isLetter(r) || isDigit(r) || r == '_' || r == '-'
+	})
+	// StatsdNames produces names for the statsd line format, and its tags.
+	StatsdNames = NewSanitizer(func(r rune, first bool) bool {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return false
+		}
+		return true
+	})
+)
+
+func isLetter(r rune) bool { return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' }
+func isDigit(r rune) bool  { return '0' <= r && r <= '9' }
+
+// Name returns the name the backend uses for name, which is distinct from the
+// name returned for any other name.
+func (s *Sanitizer) Name(name string) string {
+	clean := s.Clean(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if produced, ok := s.names[name]; ok {
+		return produced
+	}
+	if s.names == nil {
+		s.names = make(map[string]string)
+		s.owners = make(map[string]string)
+	}
+	produced := clean
+	for attempt := 0; ; attempt++ {
+		if _, taken := s.owners[produced]; !taken {
+			break
+		}
+		produced = fmt.Sprintf("%s_%08x", clean, nameHash(name, attempt))
+	}
+	s.names[name] = produced
+	s.owners[produced] = name
+	return produced
+}
+
+// Clean returns name with the characters the backend does not allow
+// replaced, without checking for collisions or remembering the name.
+func (s *Sanitizer) Clean(name string) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	first := true
+	for _, r := range name {
+		switch {
+		case s.allowed(r, first):
+			b.WriteRune(r)
+		case first && s.allowed(r, false):
+			// A character that may only follow others is kept after an
+			// underscore.
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+		first = false
+	}
+	return b.String()
+}
+
+// nameHash returns a hash of the name, which is different for each attempt
+// at finding an unused name.
+func nameHash(name string, attempt int) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%s", attempt, name)
+	return h.Sum32()
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestSanitizerClean(t *testing.T) {
+	for _, test := range []struct {
+		sanitizer *export.Sanitizer
+		name      string
+		want      string
+	}{
+		{export.PrometheusNames, "gopls/latency.ms", "gopls_latency_ms"},
+		{export.PrometheusNames, "rpc:count", "rpc:count"},
+		{export.PrometheusNames, "9lives", "_9lives"},
+		{export.PrometheusNames, "", "_"},
+		{export.PrometheusLabels, "rpc:method", "rpc_method"},
+		{export.GraphiteNames, "gopls.latency ms", "gopls.latency_ms"},
+		{export.GraphiteComponents, "text/document.hover", "text_document_hover"},
+		{export.StatsdNames, "a:b|c@d#e,f g", "a_b_c_d_e_f_g"},
+		{export.StatsdNames, "gopls/latency.ms", "gopls/latency.ms"},
+	} {
+		if got := test.sanitizer.Clean(test.name); got != test.want {
+			t.Errorf("Clean(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitizerCollisions(t *testing.T) {
+	s := export.NewSanitizer(func(r rune, first bool) bool { return r != '.' })
+	first := s.Name("a.b")
+	second := s.Name("a_b")
+	if first != "a_b" {
+		t.Errorf("Name(%q) = %q, want %q", "a.b", first, "a_b")
+	}
+	if second == first || !strings.HasPrefix(second, "a_b_") {
+		t.Errorf("Name(%q) = %q, want a distinct name starting with a_b_", "a_b", second)
+	}
+	if got := s.Name("a_b"); got != second {
+		t.Errorf("Name(%q) changed from %q to %q", "a_b", second, got)
+	}
+	if got := s.Name("a.b"); got != first {
+		t.Errorf("Name(%q) changed from %q to %q", "a.b", first, got)
+	}
+	// Clean neither checks for nor takes part in collisions.
+	if got := s.Clean("a_b"); got != "a_b" {
+		t.Errorf("Clean(%q) = %q, want %q", "a_b", got, "a_b")
+	}
+	if got := s.Name("c.d"); got != "c_d" {
+		t.Errorf("Name(%q) = %q, want %q", "c.d", got, "c_d")
+	}
+}
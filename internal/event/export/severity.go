@@ -0,0 +1,74 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Severity describes how important a log event is.
+type Severity int
+
+// The severities, from the least important to the most.
+const (
+	SeverityDebug = Severity(iota)
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+// SeverityKey labels a log event with its Severity.
+var SeverityKey = keys.NewInt("severity", "The severity of a log event.")
+
+// SeverityOf returns the severity of a log event.
+// This is the value of its SeverityKey label if it has one, otherwise
+// events built by event.Error are errors and all other events are
+// informational.
+func SeverityOf(ev core.Event, lm label.Map) Severity {
+	if l := lm.Find(SeverityKey); l.Valid() {
+		return Severity(SeverityKey.From(l))
+	}
+	if event.IsError(ev) {
+		return SeverityError
+	}
+	return SeverityInfo
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityDebug:
+		return "debug"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// RouteBySeverity returns an exporter that delivers log events of at least
+// min severity to high, and all other events to low.
+// This allows important events to go to a durable backend, while the rest
+// of the telemetry is kept somewhere cheap, such as a RingBuffer.
+// A nil exporter discards its share of the events.
+func RouteBySeverity(min Severity, high, low event.Exporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		output := low
+		if event.IsLog(ev) && SeverityOf(ev, lm) >= min {
+			output = high
+		}
+		if output == nil {
+			return ctx
+		}
+		return output(ctx, ev, lm)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestRouteBySeverity(t *testing.T) {
+	high, low := &recorder{}, &recorder{}
+	event.SetExporter(export.RouteBySeverity(export.SeverityWarning, high.ProcessEvent, low.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	event.Log(ctx, "chatter")
+	event.Log(ctx, "disk nearly full", export.SeverityKey.Of(int(export.SeverityWarning)))
+	event.Error(ctx, "failed", errors.New("boom"))
+	event.Log(ctx, "noise", export.SeverityKey.Of(int(export.SeverityDebug)))
+	event.Metric(ctx)
+	high.check(t, "log disk nearly full", "log failed")
+	low.check(t, "log chatter", "log noise", "metric")
+}
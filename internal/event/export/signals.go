@@ -0,0 +1,71 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// SpanExporter is implemented by backends that are only interested in
+// finished spans.
+type SpanExporter interface {
+	ProcessSpan(ctx context.Context, span *Span)
+}
+
+// MetricExporter is implemented by backends that are only interested in
+// metrics.
+type MetricExporter interface {
+	ProcessMetrics(ctx context.Context, metrics []metric.Data)
+}
+
+// EventExporter is implemented by backends that are only interested in log
+// events.
+type EventExporter interface {
+	ProcessLog(ctx context.Context, ev core.Event, lm label.Map)
+}
+
+// SpansOnly returns an exporter that hands each span to s when it ends, and
+// ignores all other events.
+// It must be wrapped by Spans.
+func SpansOnly(s SpanExporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsEnd(ev) {
+			if span := GetSpan(ctx); span != nil {
+				s.ProcessSpan(ctx, span)
+			}
+		}
+		return ctx
+	}
+}
+
+// MetricsOnly returns an exporter that hands the metrics attached to each
+// metric event to m, and ignores all other events.
+// It must be wrapped by a metric.Config exporter.
+func MetricsOnly(m MetricExporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			if data, ok := metric.Entries.Get(lm).([]metric.Data); ok && len(data) > 0 {
+				m.ProcessMetrics(ctx, data)
+			}
+		}
+		return ctx
+	}
+}
+
+// EventsOnly returns an exporter that hands log events to e, and ignores all
+// other events.
+func EventsOnly(e EventExporter) event.Exporter {
+	return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsLog(ev) {
+			e.ProcessLog(ctx, ev, lm)
+		}
+		return ctx
+	}
+}
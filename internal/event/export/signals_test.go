@@ -0,0 +1,64 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// signalRecorder implements all three of the single signal interfaces.
+type signalRecorder struct {
+	seen []string
+}
+
+func (r *signalRecorder) ProcessSpan(ctx context.Context, span *export.Span) {
+	r.seen = append(r.seen, "span "+span.Name)
+}
+
+func (r *signalRecorder) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	for _, m := range metrics {
+		r.seen = append(r.seen, "metric "+m.Handle())
+	}
+}
+
+func (r *signalRecorder) ProcessLog(ctx context.Context, ev core.Event, lm label.Map) {
+	r.seen = append(r.seen, "log "+keys.Msg.Get(lm))
+}
+
+func TestSignalAdapters(t *testing.T) {
+	count := keys.NewInt64("signal_count", "")
+	var m metric.Config
+	metric.Scalar{Name: "signals"}.SumInt64(&m, count)
+
+	ctx := context.Background()
+	for _, test := range []struct {
+		name  string
+		adapt func(*signalRecorder) event.Exporter
+		want  string
+	}{
+		{"spans", func(r *signalRecorder) event.Exporter { return export.SpansOnly(r) }, "span work"},
+		{"metrics", func(r *signalRecorder) event.Exporter { return export.MetricsOnly(r) }, "metric signals"},
+		{"events", func(r *signalRecorder) event.Exporter { return export.EventsOnly(r) }, "log message"},
+	} {
+		r := &signalRecorder{}
+		event.SetExporter(export.Spans(m.Exporter(test.adapt(r))))
+		_, done := event.Start(ctx, "work")
+		event.Log(ctx, "message")
+		event.Metric(ctx, count.Of(1))
+		done()
+		if len(r.seen) != 1 || r.seen[0] != test.want {
+			t.Errorf("%s: got %v, want [%v]", test.name, r.seen, test.want)
+		}
+	}
+	event.SetExporter(nil)
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeDriver is a database/sql driver that understands just the statements
+// the exporter uses, so that the tests do not need a real SQLite driver.
+// It keeps a database in memory for each name it is opened with.
+type fakeDriver struct {
+	mu        sync.Mutex
+	databases map[string]*fakeDB
+}
+
+func init() {
+	sql.Register("sqlite3", &fakeDriver{databases: make(map[string]*fakeDB)})
+}
+
+type fakeDB struct {
+	mu     sync.Mutex
+	schema []string
+	tables map[string][]map[string]driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.databases[name]
+	if !ok {
+		db = &fakeDB{tables: make(map[string][]map[string]driver.Value)}
+		d.databases[name] = db
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return strings.Count(s.query, "?") }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE "):
+		s.db.schema = append(s.db.schema, s.query)
+	case strings.HasPrefix(s.query, "INSERT INTO "):
+		// INSERT INTO table (columns) VALUES (...)
+		rest := strings.TrimPrefix(s.query, "INSERT INTO ")
+		table := rest[:strings.IndexByte(rest, ' ')]
+		columns := rest[strings.IndexByte(rest, '(')+1 : strings.IndexByte(rest, ')')]
+		row := make(map[string]driver.Value)
+		for i, column := range strings.Split(columns, ", ") {
+			row[column] = args[i]
+		}
+		s.db.tables[table] = append(s.db.tables[table], row)
+	default:
+		return nil, fmt.Errorf("fake database cannot execute %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// Query handles statements of the form
+//
+//	SELECT columns FROM table [WHERE column op ? [AND ...]] ORDER BY column [LIMIT n]
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	query := strings.TrimPrefix(s.query, "SELECT ")
+	from := strings.Index(query, " FROM ")
+	columns := strings.Split(query[:from], ", ")
+	query = query[from+len(" FROM "):]
+	orderBy := strings.Index(query, " ORDER BY ")
+	selection, order := query[:orderBy], query[orderBy+len(" ORDER BY "):]
+	limit := -1
+	if i := strings.Index(order, " LIMIT "); i >= 0 {
+		limit, _ = strconv.Atoi(order[i+len(" LIMIT "):])
+		order = order[:i]
+	}
+	table := selection
+	var conditions []string
+	if i := strings.Index(selection, " WHERE "); i >= 0 {
+		table = selection[:i]
+		conditions = strings.Split(selection[i+len(" WHERE "):], " AND ")
+	}
+	var selected []map[string]driver.Value
+	for _, row := range s.db.tables[table] {
+		match := true
+		for i, condition := range conditions {
+			fields := strings.Fields(condition)
+			if !compare(row[fields[0]], fields[1], args[i]) {
+				match = false
+			}
+		}
+		if match {
+			selected = append(selected, row)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return compare(selected[i][order], "<", selected[j][order])
+	})
+	if limit >= 0 && limit < len(selected) {
+		selected = selected[:limit]
+	}
+	return &fakeRows{columns: columns, rows: selected}, nil
+}
+
+// compare compares two values of the same type with op.
+func compare(a interface{}, op string, b interface{}) bool {
+	var c int
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	case string:
+		c = strings.Compare(a, b.(string))
+	default:
+		return false
+	}
+	switch op {
+	case "=":
+		return c == 0
+	case "<":
+		return c < 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type fakeRows struct {
+	columns []string
+	rows    []map[string]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, column := range r.columns {
+		dest[i] = r.rows[0][column]
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query selects the rows returned by Spans, Events and Metrics.
+// Zero fields select everything, and the rows are returned in time order.
+type Query struct {
+	// TraceID selects the spans or events of a single trace.
+	// It is ignored by Metrics.
+	TraceID string
+	// Name selects the spans or metrics with the name, or the events with the
+	// message.
+	Name string
+	// Since and Until select the rows at or after Since and before Until.
+	// Spans are selected by their start time.
+	Since, Until time.Time
+	// Limit is the most rows returned.
+	Limit int
+}
+
+// SpanRecord is a span read back from the database.
+type SpanRecord struct {
+	TraceID, SpanID, ParentID string
+	Name                      string
+	Start, End                time.Time
+	Labels                    map[string]interface{}
+}
+
+// EventRecord is a log event read back from the database.
+type EventRecord struct {
+	Time            time.Time
+	Kind            string // "log" or "error"
+	Message, Error  string
+	Severity        string
+	TraceID, SpanID string
+	Labels          map[string]interface{}
+}
+
+// MetricPoint is a metric row read back from the database.
+// Counters, up down counters and gauges have a Value, histograms a Count and Sum.
+type MetricPoint struct {
+	Time   time.Time
+	Name   string
+	Kind   string // "counter", "updowncounter", "gauge" or "histogram"
+	Labels map[string]interface{}
+	Value  float64
+	Count  int64
+	Sum    float64
+}
+
+// Spans returns the stored spans selected by q.
+// The rows the exporter is holding are written first, so they are included.
+func (e *Exporter) Spans(ctx context.Context, q Query) ([]SpanRecord, error) {
+	where, args := q.where("trace_id", "name", "start_time")
+	rows, err := e.query(ctx, "SELECT trace_id, span_id, parent_id, name, start_time, end_time, labels FROM spans"+where+" ORDER BY start_time"+q.limit(), args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []SpanRecord
+	for rows.Next() {
+		var s SpanRecord
+		var parent, labels sql.NullString
+		var start, end int64
+		if err := rows.Scan(&s.TraceID, &s.SpanID, &parent, &s.Name, &start, &end, &labels); err != nil {
+			return nil, fmt.Errorf("sqlite failed to read span: %v", err)
+		}
+		s.ParentID = parent.String
+		s.Start, s.End = time.Unix(0, start), time.Unix(0, end)
+		s.Labels = parseLabels(labels)
+		result = append(result, s)
+	}
+	if err := rowsError(rows); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Events returns the stored log events selected by q.
+// The rows the exporter is holding are written first, so they are included.
+func (e *Exporter) Events(ctx context.Context, q Query) ([]EventRecord, error) {
+	where, args := q.where("trace_id", "message", "time")
+	rows, err := e.query(ctx, "SELECT time, kind, message, error, severity, trace_id, span_id, labels FROM events"+where+" ORDER BY time"+q.limit(), args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []EventRecord
+	for rows.Next() {
+		var ev EventRecord
+		var at int64
+		var errText, traceID, spanID, labels sql.NullString
+		if err := rows.Scan(&at, &ev.Kind, &ev.Message, &errText, &ev.Severity, &traceID, &spanID, &labels); err != nil {
+			return nil, fmt.Errorf("sqlite failed to read event: %v", err)
+		}
+		ev.Time = time.Unix(0, at)
+		ev.Error, ev.TraceID, ev.SpanID = errText.String, traceID.String, spanID.String
+		ev.Labels = parseLabels(labels)
+		result = append(result, ev)
+	}
+	if err := rowsError(rows); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Metrics returns the stored metric points selected by q.
+// The rows the exporter is holding are written first, so they are included.
+func (e *Exporter) Metrics(ctx context.Context, q Query) ([]MetricPoint, error) {
+	where, args := q.where("", "name", "time")
+	rows, err := e.query(ctx, "SELECT time, name, kind, labels, value, count, sum FROM metrics"+where+" ORDER BY time"+q.limit(), args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []MetricPoint
+	for rows.Next() {
+		var m MetricPoint
+		var at int64
+		var labels sql.NullString
+		var value, sum sql.NullFloat64
+		var count sql.NullInt64
+		if err := rows.Scan(&at, &m.Name, &m.Kind, &labels, &value, &count, &sum); err != nil {
+			return nil, fmt.Errorf("sqlite failed to read metric: %v", err)
+		}
+		m.Time = time.Unix(0, at)
+		m.Labels = parseLabels(labels)
+		m.Value, m.Count, m.Sum = value.Float64, count.Int64, sum.Float64
+		result = append(result, m)
+	}
+	if err := rowsError(rows); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *Exporter) query(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
+	if err := e.Flush(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := e.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite failed to query: %v", err)
+	}
+	return rows, nil
+}
+
+// where returns the WHERE clause selecting the rows of q, using the named
+// columns. A column with an empty name is not selected on.
+func (q Query) where(traceColumn, nameColumn, timeColumn string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if q.TraceID != "" && traceColumn != "" {
+		conditions = append(conditions, traceColumn+" = ?")
+		args = append(args, q.TraceID)
+	}
+	if q.Name != "" {
+		conditions = append(conditions, nameColumn+" = ?")
+		args = append(args, q.Name)
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, timeColumn+" >= ?")
+		args = append(args, nanos(q.Since))
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, timeColumn+" < ?")
+		args = append(args, nanos(q.Until))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (q Query) limit() string {
+	if q.Limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", q.Limit)
+}
+
+func parseLabels(s sql.NullString) map[string]interface{} {
+	if !s.Valid {
+		return nil
+	}
+	var labels map[string]interface{}
+	if err := json.Unmarshal([]byte(s.String), &labels); err != nil {
+		return nil
+	}
+	return labels
+}
+
+func rowsError(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("sqlite failed to read rows: %v", err)
+	}
+	return nil
+}
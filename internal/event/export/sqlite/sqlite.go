@@ -0,0 +1,391 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlite stores finished spans, log events and metric points in a
+// SQLite database, so that a long session can be analyzed with SQL after the
+// fact.
+//
+// The database has three tables:
+//
+//	spans(trace_id, span_id, parent_id, name, start_time, end_time, labels)
+//	events(time, kind, message, error, severity, trace_id, span_id, labels)
+//	metrics(time, name, kind, labels, value, count, sum)
+//
+// Times are integer nanoseconds since the Unix epoch, IDs are hex strings and
+// labels are JSON objects, which SQLite's json functions can take apart.
+// The trace IDs, span names and times are indexed.
+//
+// The package uses database/sql and does not depend on a particular SQLite
+// driver, the program must link one in, such as github.com/mattn/go-sqlite3
+// or modernc.org/sqlite. Importing the package registers a "sqlite" exporter
+// whose options are the name of the database file.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DriverNames are the database/sql driver names that Open looks for, in
+// order.
+var DriverNames = []string{"sqlite3", "sqlite"}
+
+// schema creates the tables and indexes if they do not already exist.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS spans (trace_id TEXT, span_id TEXT, parent_id TEXT, name TEXT, start_time INTEGER, end_time INTEGER, labels TEXT)`,
+	`CREATE INDEX IF NOT EXISTS spans_trace_id ON spans (trace_id)`,
+	`CREATE INDEX IF NOT EXISTS spans_name ON spans (name)`,
+	`CREATE INDEX IF NOT EXISTS spans_start_time ON spans (start_time)`,
+	`CREATE TABLE IF NOT EXISTS events (time INTEGER, kind TEXT, message TEXT, error TEXT, severity TEXT, trace_id TEXT, span_id TEXT, labels TEXT)`,
+	`CREATE INDEX IF NOT EXISTS events_trace_id ON events (trace_id)`,
+	`CREATE INDEX IF NOT EXISTS events_time ON events (time)`,
+	`CREATE TABLE IF NOT EXISTS metrics (time INTEGER, name TEXT, kind TEXT, labels TEXT, value REAL, count INTEGER, sum REAL)`,
+	`CREATE INDEX IF NOT EXISTS metrics_name_time ON metrics (name, time)`,
+}
+
+// The statements that add a row to each table.
+const (
+	insertSpan   = `INSERT INTO spans (trace_id, span_id, parent_id, name, start_time, end_time, labels) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	insertEvent  = `INSERT INTO events (time, kind, message, error, severity, trace_id, span_id, labels) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	insertMetric = `INSERT INTO metrics (time, name, kind, labels, value, count, sum) VALUES (?, ?, ?, ?, ?, ?, ?)`
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// MaxBatch is the number of rows that triggers a write, it defaults to
+	// 1000.
+	MaxBatch int
+	// Interval is the longest rows are held before they are written, it
+	// defaults to 5 seconds.
+	Interval time.Duration
+}
+
+func init() {
+	export.Register("sqlite", func(filename string) (event.Exporter, export.Shutdowner, error) {
+		if filename == "" {
+			return nil, nil, fmt.Errorf("sqlite exporter needs the name of a database file")
+		}
+		exporter, err := Open(filename, &Config{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// Exporter writes telemetry to a database.
+// It must be wrapped by export.Spans for spans to be stored.
+type Exporter struct {
+	db     *sql.DB
+	owned  bool // whether Shutdown closes db
+	config Config
+	full   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu   sync.Mutex
+	rows []row
+}
+
+// row is a row waiting to be inserted.
+type row struct {
+	insert string
+	args   []interface{}
+}
+
+// Open opens the database file with the first of the DriverNames that is
+// registered, and returns an Exporter that writes to it.
+// The database is closed by Shutdown.
+func Open(filename string, config *Config) (*Exporter, error) {
+	registered := make(map[string]bool)
+	for _, name := range sql.Drivers() {
+		registered[name] = true
+	}
+	for _, name := range DriverNames {
+		if !registered[name] {
+			continue
+		}
+		db, err := sql.Open(name, filename)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite exporter: %v", err)
+		}
+		e, err := New(db, config)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		e.owned = true
+		return e, nil
+	}
+	return nil, fmt.Errorf("sqlite exporter: no SQLite driver is linked into the program (looked for %v)", strings.Join(DriverNames, ", "))
+}
+
+// New creates the tables in db if they do not exist, and returns an Exporter
+// that writes to them.
+// The Exporter is managed, so the package level Flush and Shutdown functions
+// write the rows it is holding.
+func New(db *sql.DB, config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.MaxBatch <= 0 {
+		resolved.MaxBatch = 1000
+	}
+	if resolved.Interval <= 0 {
+		resolved.Interval = 5 * time.Second
+	}
+	ctx, cancel := export.TimeoutContext(context.Background())
+	defer cancel()
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("sqlite failed to create schema: %v", err)
+		}
+	}
+	e := &Exporter{
+		db:     db,
+		config: resolved,
+		full:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	export.Manage(e)
+	return e, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	switch {
+	case event.IsLog(ev):
+		e.add(eventRow(ctx, ev, lm))
+	case event.IsEnd(ev):
+		if span := export.GetSpan(ctx); span != nil {
+			e.add(spanRow(span))
+		}
+	case event.IsMetric(ev):
+		e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	}
+	return ctx
+}
+
+// ProcessMetrics stores a point for each row of the metrics.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	var rows []row
+	for _, data := range metrics {
+		rows = append(rows, metricRows(data)...)
+	}
+	e.add(rows...)
+}
+
+func (e *Exporter) add(rows ...row) {
+	e.mu.Lock()
+	e.rows = append(e.rows, rows...)
+	full := len(e.rows) >= e.config.MaxBatch
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.full:
+		case <-e.stop:
+			return
+		}
+		ctx, cancel := export.TimeoutContext(context.Background())
+		export.ReportError(e.Flush(ctx))
+		cancel()
+	}
+}
+
+// Flush writes the rows collected so far in a single transaction.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	rows := e.rows
+	e.rows = nil
+	e.mu.Unlock()
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite failed to begin transaction: %v", err)
+	}
+	stmts := make(map[string]*sql.Stmt)
+	for _, r := range rows {
+		stmt, ok := stmts[r.insert]
+		if !ok {
+			stmt, err = tx.PrepareContext(ctx, r.insert)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("sqlite failed to prepare insert: %v", err)
+			}
+			stmts[r.insert] = stmt
+		}
+		if _, err := stmt.ExecContext(ctx, r.args...); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite failed to insert %d rows: %v", len(rows), err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite failed to insert %d rows: %v", len(rows), err)
+	}
+	return nil
+}
+
+// Shutdown stops the periodic writes, and then writes the rows it is
+// holding. If the database was opened by Open, it is then closed.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	export.Unmanage(e)
+	err := e.Flush(ctx)
+	if e.owned {
+		if cerr := e.db.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("sqlite failed to close database: %v", cerr)
+		}
+	}
+	return err
+}
+
+func nanos(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+// labelsJSON returns the labels as a JSON object, or nil if there are none.
+func labelsJSON(labels []label.Label) interface{} {
+	values := make(map[string]interface{})
+	for _, l := range labels {
+		if l.Valid() && l.Key() != export.SeverityKey {
+			values[l.Key().Name()] = export.LabelValue(l)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// nullString returns s, or nil if it is empty, so that absent values are
+// stored as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func eventRow(ctx context.Context, ev core.Event, lm label.Map) row {
+	kind, errText := "log", ""
+	first := 1
+	if event.IsError(ev) {
+		kind = "error"
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			errText = err.Error()
+		}
+		first = 2
+	}
+	var traceID, spanID string
+	if span := export.GetSpan(ctx); span != nil {
+		traceID, spanID = span.ID.TraceID.String(), span.ID.SpanID.String()
+	}
+	var labels []label.Label
+	for i := first; ev.Valid(i); i++ {
+		labels = append(labels, ev.Label(i))
+	}
+	return row{insert: insertEvent, args: []interface{}{
+		nanos(ev.At()),
+		kind,
+		keys.Msg.From(ev.Label(0)),
+		nullString(errText),
+		export.SeverityOf(ev, lm).String(),
+		nullString(traceID),
+		nullString(spanID),
+		labelsJSON(labels),
+	}}
+}
+
+func spanRow(span *export.Span) row {
+	var labels []label.Label
+	for i := 1; span.Start().Valid(i); i++ {
+		labels = append(labels, span.Start().Label(i))
+	}
+	labels = append(labels, span.Labels()...)
+	var parent string
+	if span.ParentID.IsValid() {
+		parent = span.ParentID.String()
+	}
+	return row{insert: insertSpan, args: []interface{}{
+		span.ID.TraceID.String(),
+		span.ID.SpanID.String(),
+		nullString(parent),
+		span.Name,
+		nanos(span.Start().At()),
+		nanos(span.Finish().At()),
+		labelsJSON(labels),
+	}}
+}
+
+func metricRows(data metric.Data) []row {
+	var rows []row
+	add := func(group []label.Label, at time.Time, kind string, value, count, sum interface{}) {
+		rows = append(rows, row{insert: insertMetric, args: []interface{}{
+			nanos(at), data.Handle(), kind, labelsJSON(group), value, count, sum,
+		}})
+	}
+	scalarKind := func(isGauge, isUpDown bool) string {
+		switch {
+		case isGauge:
+			return "gauge"
+		case isUpDown:
+			return "updowncounter"
+		}
+		return "counter"
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			add(group, data.EndTime, scalarKind(data.IsGauge, data.IsUpDown), float64(data.Rows[i]), nil, nil)
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			add(group, data.EndTime, scalarKind(data.IsGauge, data.IsUpDown), data.Rows[i], nil, nil)
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			add(group, data.EndTime, "histogram", nil, row.Count, float64(row.Sum))
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			row := data.Rows[i]
+			add(group, data.EndTime, "histogram", nil, row.Count, row.Sum)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,177 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/sqlite"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// steppingClock moves forward by a millisecond every time it is read.
+type steppingClock struct {
+	now time.Time
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.now = c.now.Add(time.Millisecond)
+	return c.now
+}
+
+var epoch = time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)
+
+func at(ms int) time.Time {
+	return epoch.Add(time.Duration(ms) * time.Millisecond)
+}
+
+var databases int32
+
+// newDatabase returns the name of a database that has not been used before.
+func newDatabase(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), atomic.AddInt32(&databases, 1))
+}
+
+func TestQuery(t *testing.T) {
+	event.SetClock(&steppingClock{now: epoch})
+	defer event.SetClock(nil)
+	exporter, err := sqlite.Open(newDatabase(t), &sqlite.Config{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	file := keys.NewString("file", "")
+	latency := keys.NewInt64("latency", "")
+	var m metric.Config
+	metric.Scalar{Name: "requests", Keys: []label.Key{file}}.Count(&m, latency)
+	metric.HistogramInt64{Name: "latency", Buckets: []int64{10, 100}}.Record(&m, latency)
+	event.SetExporter(export.Spans(m.Exporter(exporter.ProcessEvent)))
+	defer event.SetExporter(nil)
+
+	ctx, done := event.Start(context.Background(), "hover", file.Of("main.go"))
+	child, childDone := event.Start(ctx, "parse")
+	event.Error(child, "failed", errors.New("timeout"))
+	childDone()
+	done()
+	other, otherDone := event.Start(context.Background(), "completion")
+	event.Log(other, "cached")
+	otherDone()
+	event.Metric(context.Background(), file.Of("main.go"), latency.Of(42))
+
+	ctx = context.Background()
+	trace := export.GetSpan(child).ID.TraceID.String()
+	spans, err := exporter.Spans(ctx, sqlite.Query{TraceID: trace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(spanSummaries(spans)), "[hover@1 file=main.go parse@2 ]"; got != want {
+		t.Errorf("spans of the trace are %v, want %v", got, want)
+	}
+	if spans[1].ParentID != spans[0].SpanID || !spans[1].End.Equal(at(4)) {
+		t.Errorf("got child span %+v", spans[1])
+	}
+
+	spans, err = exporter.Spans(ctx, sqlite.Query{Since: at(2), Until: at(6)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(spanSummaries(spans)), "[parse@2 ]"; got != want {
+		t.Errorf("spans started in the interval are %v, want %v", got, want)
+	}
+	spans, err = exporter.Spans(ctx, sqlite.Query{Name: "completion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 1 || spans[0].TraceID == trace {
+		t.Errorf("spans named completion are %+v", spans)
+	}
+
+	events, err := exporter.Events(ctx, sqlite.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got events %+v, want 2", events)
+	}
+	if e := events[0]; e.Kind != "error" || e.Message != "failed" || e.Error != "timeout" || e.Severity != "error" || e.TraceID != trace || !e.Time.Equal(at(3)) {
+		t.Errorf("got error event %+v", e)
+	}
+	if e := events[1]; e.Kind != "log" || e.Message != "cached" || e.Error != "" || e.TraceID == trace {
+		t.Errorf("got log event %+v", e)
+	}
+	events, err = exporter.Events(ctx, sqlite.Query{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Message != "failed" {
+		t.Errorf("limited events are %+v", events)
+	}
+
+	points, err := exporter.Metrics(ctx, sqlite.Query{Name: "requests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Kind != "counter" || points[0].Value != 1 || points[0].Labels["file"] != "main.go" {
+		t.Errorf("requests points are %+v", points)
+	}
+	points, err = exporter.Metrics(ctx, sqlite.Query{Name: "latency"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Kind != "histogram" || points[0].Count != 1 || points[0].Sum != 42 {
+		t.Errorf("latency points are %+v", points)
+	}
+}
+
+// spanSummaries describes each span by its name, start and labels.
+func spanSummaries(spans []sqlite.SpanRecord) []string {
+	var result []string
+	for _, s := range spans {
+		summary := fmt.Sprintf("%s@%d ", s.Name, s.Start.Sub(epoch)/time.Millisecond)
+		for k, v := range s.Labels {
+			summary += fmt.Sprintf("%s=%v", k, v)
+		}
+		result = append(result, summary)
+	}
+	return result
+}
+
+func TestBatch(t *testing.T) {
+	database := newDatabase(t)
+	exporter, err := sqlite.Open(database, &sqlite.Config{MaxBatch: 2, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := event.WithExporter(context.Background(), exporter.ProcessEvent)
+	event.Log(ctx, "one")
+	event.Log(ctx, "two")
+	event.Log(ctx, "three")
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the database to check that everything was written.
+	exporter, err = sqlite.Open(database, &sqlite.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	events, err := exporter.Events(context.Background(), sqlite.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Errorf("got %d events after shutdown, want 3", len(events))
+	}
+}
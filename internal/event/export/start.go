@@ -0,0 +1,98 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// FinishOption changes a span started by Start as it ends.
+type FinishOption struct {
+	// apply is given the context of the span.
+	apply func(ctx context.Context)
+	// capturePanic is set by FinishOnPanic.
+	capturePanic bool
+}
+
+// Start starts a span, as event.Start does, and returns the context of the
+// span along with the function that ends it, so that call sites read
+//
+//	ctx, end := export.Start(ctx, "load")
+//	defer end()
+//
+// The end function can be given options that record the outcome of the span,
+// such as FinishWithError. Only its first call ends the span, later calls do
+// nothing, so a deferred end is harmless after an early one.
+func Start(ctx context.Context, name string, labels ...label.Label) (context.Context, func(options ...FinishOption)) {
+	ctx, done := event.Start(ctx, name, labels...)
+	var once sync.Once
+	return ctx, func(options ...FinishOption) {
+		var panicked interface{}
+		for _, option := range options {
+			if option.capturePanic {
+				// This only recovers when the end function is deferred, as
+				// recover must be called by the deferred function itself.
+				panicked = recover()
+				break
+			}
+		}
+		if panicked != nil {
+			recordPanic(ctx, panicked)
+		}
+		once.Do(func() {
+			for _, option := range options {
+				if option.apply != nil {
+					option.apply(ctx)
+				}
+			}
+			done()
+		})
+		if panicked != nil {
+			panic(panicked)
+		}
+	}
+}
+
+// FinishWithError records err on the span as it ends, as described by
+// RecordError. It does nothing if err is nil, so it can be given whatever
+// error the operation returned:
+//
+//	defer func() { end(export.FinishWithError(err)) }()
+func FinishWithError(err error) FinishOption {
+	return FinishOption{apply: func(ctx context.Context) { RecordError(ctx, err) }}
+}
+
+// FinishWithStatus sets the status of the span as it ends.
+func FinishWithStatus(code SpanStatusCode, message string) FinishOption {
+	return FinishOption{apply: func(ctx context.Context) {
+		if span := GetSpan(ctx); span != nil {
+			span.SetStatus(code, message)
+		}
+	}}
+}
+
+// FinishWithLabels adds labels describing the outcome of the operation to the
+// span as it ends.
+func FinishWithLabels(labels ...label.Label) FinishOption {
+	return FinishOption{apply: func(ctx context.Context) {
+		if span := GetSpan(ctx); span != nil {
+			span.AddLabels(labels...)
+		}
+	}}
+}
+
+// FinishOnPanic records a panic that unwinds through a deferred end function
+// on the span, as described by RecordPanic, before ending the span and letting
+// the panic continue:
+//
+//	ctx, end := export.Start(ctx, "load")
+//	defer end(export.FinishOnPanic())
+func FinishOnPanic() FinishOption {
+	return FinishOption{capturePanic: true}
+}
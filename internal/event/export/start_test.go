@@ -0,0 +1,73 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+func TestStart(t *testing.T) {
+	var spans []*export.Span
+	ends := 0
+	event.SetExporter(export.Spans(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		switch {
+		case event.IsStart(ev):
+			spans = append(spans, export.GetSpan(ctx))
+		case event.IsEnd(ev):
+			ends++
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	result := keys.NewInt("start_result", "")
+	load := func() (err error) {
+		_, end := export.Start(context.Background(), "load")
+		defer func() { end(export.FinishWithError(err), export.FinishWithLabels(result.Of(3))) }()
+		return errors.New("no packages")
+	}
+	load()
+	ctx, end := export.Start(context.Background(), "ok")
+	end(export.FinishWithStatus(export.SpanStatusOK, ""))
+	// Only the first call ends the span.
+	end(export.FinishWithError(errors.New("too late")))
+
+	if len(spans) != 2 || ends != 2 {
+		t.Fatalf("got %d spans and %d ends, want 2 of each", len(spans), ends)
+	}
+	if got := spans[0].Status(); got.Code != export.SpanStatusError || got.Message != "no packages" {
+		t.Errorf("load has status %+v, want the error", got)
+	}
+	if labels := spans[0].Labels(); len(labels) != 1 || result.From(labels[0]) != 3 {
+		t.Errorf("load has labels %v, want the result", labels)
+	}
+	if got := export.GetSpan(ctx).Status().Code; got != export.SpanStatusOK {
+		t.Errorf("ok has status code %v, want %v", got, export.SpanStatusOK)
+	}
+
+	crash := func() (recovered interface{}) {
+		defer func() { recovered = recover() }()
+		_, end := export.Start(context.Background(), "crash")
+		defer end(export.FinishOnPanic())
+		panic("out of range")
+	}
+	if got := crash(); got != "out of range" {
+		t.Errorf("recovered %v, want the original panic value", got)
+	}
+	if len(spans) != 3 || ends != 3 {
+		t.Fatalf("got %d spans and %d ends, want 3 of each", len(spans), ends)
+	}
+	if got := spans[2].Status(); got.Code != export.SpanStatusError || got.Message != "panic: out of range" {
+		t.Errorf("crash has status %+v, want the panic", got)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package statsd sends metrics to a statsd daemon over UDP.
+//
+// Counters are sent as the change since the last value sent, gauges as their
+// current value, reset to zero first when it is negative, and each value
+// recorded by a histogram as a timing.
+// With the DogStatsD extensions the metric labels are sent as tags, otherwise
+// their values are appended to the metric name.
+//
+// Importing the package registers "statsd" and "dogstatsd" exporters whose
+// options are the address of the daemon. They send the metrics that have
+// changed about every ten seconds, as statsd daemons normally do.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultAddress is the address a statsd daemon normally listens on.
+const DefaultAddress = "localhost:8125"
+
+// DefaultMaxPacketSize keeps packets within the MTU of most networks.
+const DefaultMaxPacketSize = 1432
+
+type Config struct {
+	// Address is the UDP address of the daemon.
+	Address string
+	// Prefix is prepended to every metric name.
+	Prefix string
+	// DogStatsD enables the tag extension.
+	DogStatsD bool
+	// MaxPacketSize bounds the size of each packet, metrics are split across
+	// as many packets as needed.
+	MaxPacketSize int
+}
+
+func init() {
+	for name, dog := range map[string]bool{"statsd": false, "dogstatsd": true} {
+		dog := dog
+		export.Register(name, func(address string) (event.Exporter, export.Shutdowner, error) {
+			exporter, err := Dial(&Config{Address: address, DogStatsD: dog})
+			if err != nil {
+				return nil, nil, err
+			}
+			reader := export.Periodic(exporter, 10*time.Second, time.Second)
+			return reader.ProcessEvent, export.ShutdownAll(reader, exporter), nil
+		})
+	}
+}
+
+// Exporter is an export.MetricExporter and export.BatchExporter that sends
+// metrics to a statsd daemon.
+type Exporter struct {
+	config Config
+	conn   net.Conn
+
+	mu sync.Mutex
+	// deltas turns the totals of counters and histograms into the change
+	// since they were last sent.
+	deltas metric.Deltas
+	// last holds the value last sent for each gauge, so that only the gauges
+	// that have changed are sent.
+	last map[string]float64
+}
+
+var (
+	_ export.MetricExporter = (*Exporter)(nil)
+	_ export.BatchExporter  = (*Exporter)(nil)
+)
+
+// Dial returns an Exporter that sends to the configured daemon.
+func Dial(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Address == "" {
+		resolved.Address = DefaultAddress
+	}
+	if resolved.MaxPacketSize <= 0 {
+		resolved.MaxPacketSize = DefaultMaxPacketSize
+	}
+	conn, err := net.Dial("udp", resolved.Address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd exporter: %v", err)
+	}
+	return &Exporter{config: resolved, conn: conn, last: make(map[string]float64)}, nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if event.IsMetric(ev) {
+		e.ProcessMetrics(ctx, metric.Entries.Get(lm).([]metric.Data))
+	}
+	return ctx
+}
+
+// ProcessMetrics sends the series of the metrics that have changed.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	export.ReportError(e.ExportMetrics(ctx, metrics))
+}
+
+// ExportSpans implements export.BatchExporter, it does nothing.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	return nil
+}
+
+// ExportMetrics sends the series of the metrics that have changed.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	e.mu.Lock()
+	var lines []string
+	for _, data := range e.deltas.Convert(metrics) {
+		lines = e.appendLines(lines, data)
+	}
+	e.mu.Unlock()
+	return e.send(lines)
+}
+
+// Shutdown closes the connection to the daemon.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.conn.Close()
+}
+
+func (e *Exporter) appendLines(lines []string, data metric.Data) []string {
+	name := e.config.Prefix + export.StatsdNames.Name(data.Handle())
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			lines = e.scalar(lines, name, group, float64(data.Rows[i]), data.IsGauge || data.IsUpDown)
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			lines = e.scalar(lines, name, group, data.Rows[i], data.IsGauge || data.IsUpDown)
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			lines = e.timing(lines, name, group, float64(data.Rows[i].Sum), data.Rows[i].Count)
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			lines = e.timing(lines, name, group, data.Rows[i].Sum, data.Rows[i].Count)
+		}
+	}
+	return lines
+}
+
+// scalar sends the value of a gauge if it has changed, or the change in a
+// counter if there is one.
+func (e *Exporter) scalar(lines []string, name string, group []label.Label, value float64, isGauge bool) []string {
+	name, tags := e.series(name, group)
+	if !isGauge {
+		if value == 0 {
+			return lines
+		}
+		return append(lines, e.line(name, value, "c", tags))
+	}
+	id := name + tags
+	if last, seen := e.last[id]; seen && value == last {
+		return lines
+	}
+	e.last[id] = value
+	if value < 0 {
+		// A signed gauge value is a change to the gauge, so a negative
+		// value must be sent as a change from zero.
+		lines = append(lines, e.line(name, 0, "g", tags))
+	}
+	return append(lines, e.line(name, value, "g", tags))
+}
+
+// timing sends the values recorded by a histogram since it was last sent, of
+// which there are count, adding up to sum.
+// The individual values are not available, so each is sent as their mean.
+func (e *Exporter) timing(lines []string, name string, group []label.Label, sum float64, count int64) []string {
+	if count <= 0 {
+		return lines
+	}
+	name, tags := e.series(name, group)
+	line := e.line(name, sum/float64(count), "ms", tags)
+	for n := count; n > 0; n-- {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// series returns the name and tags to send for a group.
+func (e *Exporter) series(name string, group []label.Label) (string, string) {
+	var tags strings.Builder
+	for _, l := range group {
+		if !l.Valid() {
+			continue
+		}
+		value := export.StatsdNames.Clean(fmt.Sprint(export.LabelValue(l)))
+		if !e.config.DogStatsD {
+			name += "." + value
+			continue
+		}
+		if tags.Len() == 0 {
+			tags.WriteString("|#")
+		} else {
+			tags.WriteByte(',')
+		}
+		tags.WriteString(export.StatsdNames.Name(l.Key().Name()))
+		tags.WriteByte(':')
+		tags.WriteString(value)
+	}
+	return name, tags.String()
+}
+
+func (e *Exporter) line(name string, value float64, kind, tags string) string {
+	return name + ":" + strconv.FormatFloat(value, 'g', -1, 64) + "|" + kind + tags
+}
+
+// send writes the lines in as few packets as possible.
+func (e *Exporter) send(lines []string) error {
+	var packet bytes.Buffer
+	var firstErr error
+	flush := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := e.conn.Write(packet.Bytes()); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("statsd exporter: %v", err)
+		}
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > e.config.MaxPacketSize {
+			flush()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	flush()
+	return firstErr
+}
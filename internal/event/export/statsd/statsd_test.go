@@ -0,0 +1,97 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package statsd_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/statsd"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+var (
+	method  = keys.NewString("method", "")
+	calls   = keys.NewInt64("calls", "")
+	memory  = keys.NewInt64("memory", "")
+	open    = keys.NewInt64("open", "")
+	latency = keys.NewFloat64("latency", "")
+)
+
+func TestExporter(t *testing.T) {
+	for _, test := range []struct {
+		dog  bool
+		want string
+	}{
+		{false, `
+			gopls.calls.get:2|c
+			gopls.calls.get:3|c
+			gopls.memory:100|g
+			gopls.latency.get:1.5|ms
+			gopls.open:1|g
+			gopls.open:0|g
+			gopls.open:-1|g`},
+		{true, `
+			gopls.calls:2|c|#method:get
+			gopls.calls:3|c|#method:get
+			gopls.memory:100|g
+			gopls.latency:1.5|ms|#method:get
+			gopls.open:1|g
+			gopls.open:0|g
+			gopls.open:-1|g`},
+	} {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Skipf("cannot listen for UDP: %v", err)
+		}
+		defer conn.Close()
+		exporter, err := statsd.Dial(&statsd.Config{
+			Address:   conn.LocalAddr().String(),
+			Prefix:    "gopls.",
+			DogStatsD: test.dog,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m metric.Config
+		metric.Scalar{Name: "calls", Keys: []label.Key{method}}.SumInt64(&m, calls)
+		metric.Scalar{Name: "memory"}.LatestInt64(&m, memory)
+		metric.HistogramFloat64{Name: "latency", Keys: []label.Key{method}, Buckets: []float64{1, 10}}.Record(&m, latency)
+		files := metric.Scalar{Name: "open"}.GaugeInt64(&m, open)
+		event.SetExporter(m.Exporter(exporter.ProcessEvent))
+
+		ctx := context.Background()
+		event.Metric(ctx, method.Of("get"), calls.Of(2))
+		event.Metric(ctx, method.Of("get"), calls.Of(3))
+		event.Metric(ctx, memory.Of(100))
+		event.Metric(ctx, memory.Of(100))
+		event.Metric(ctx, method.Of("get"), latency.Of(1.5))
+		files.Add(ctx, 1)
+		files.Add(ctx, -2)
+		event.SetExporter(nil)
+		exporter.Shutdown(ctx)
+
+		want := strings.Fields(test.want)
+		var got []string
+		buf := make([]byte, 2048)
+		for len(got) < len(want) {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("after %v: %v", got, err)
+			}
+			got = append(got, strings.Split(string(buf[:n]), "\n")...)
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("dogstatsd %v: got %v, want %v", test.dog, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event/core"
+)
+
+// Status describes the health of an exporter.
+type Status struct {
+	// Name identifies the exporter, for example by kind and address.
+	Name string
+	// LastExport is when telemetry was last delivered successfully.
+	LastExport time.Time
+	// LastError is the most recent delivery failure, and LastErrorTime is
+	// when it happened.
+	LastError     error
+	LastErrorTime time.Time
+	// Connected reports whether the most recent delivery succeeded.
+	Connected bool
+}
+
+// StatusReporter is implemented by exporters that can describe their health.
+type StatusReporter interface {
+	Status() Status
+}
+
+var (
+	reportersMu sync.Mutex
+	reporters   []StatusReporter
+)
+
+// AddStatusReporter adds r to the exporters described by Statuses.
+// Managed exporters that implement StatusReporter are described without it,
+// it is for exporters that have nothing to flush or shut down, and for those
+// whose lifecycle is handled by their owner rather than the package level
+// functions.
+func AddStatusReporter(r StatusReporter) {
+	reportersMu.Lock()
+	defer reportersMu.Unlock()
+	for _, e := range reporters {
+		if e == r {
+			return
+		}
+	}
+	reporters = append(reporters, r)
+}
+
+// RemoveStatusReporter removes r from the exporters added by
+// AddStatusReporter.
+func RemoveStatusReporter(r StatusReporter) {
+	reportersMu.Lock()
+	defer reportersMu.Unlock()
+	for i, e := range reporters {
+		if e == r {
+			reporters = append(reporters[:i:i], reporters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Statuses returns the status of every exporter added by AddStatusReporter,
+// and of every managed exporter that implements StatusReporter.
+func Statuses() []Status {
+	reportersMu.Lock()
+	list := append([]StatusReporter(nil), reporters...)
+	reportersMu.Unlock()
+	lifecycleMu.Lock()
+	for _, m := range managed {
+		if r, ok := m.(StatusReporter); ok && !hasReporter(list, r) {
+			list = append(list, r)
+		}
+	}
+	lifecycleMu.Unlock()
+	statuses := make([]Status, 0, len(list))
+	for _, r := range list {
+		statuses = append(statuses, r.Status())
+	}
+	return statuses
+}
+
+// hasReporter reports whether list holds r.
+func hasReporter(list []StatusReporter, r StatusReporter) bool {
+	for _, e := range list {
+		if e == r {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusTracker maintains a Status from the results of deliveries.
+// It is intended to be embedded in exporters that implement StatusReporter.
+type StatusTracker struct {
+	mu     sync.Mutex
+	status Status
+}
+
+// Record updates the status with the result of a delivery.
+func (t *StatusTracker) Record(err error) {
+	now := core.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Connected = err == nil
+	if err == nil {
+		t.status.LastExport = now
+	} else {
+		t.status.LastError, t.status.LastErrorTime = err, now
+	}
+}
+
+// Current returns the status recorded so far, with the given name.
+func (t *StatusTracker) Current(name string) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.status
+	status.Name = name
+	return status
+}
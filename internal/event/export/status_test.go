@@ -0,0 +1,69 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+func TestStatuses(t *testing.T) {
+	r := &batchRecorder{}
+	b := export.Batch(r, 10, time.Hour)
+	defer b.Shutdown(context.Background())
+
+	if s := b.Status(); s.Name != "batch" || s.Connected || !s.LastExport.IsZero() {
+		t.Errorf("status before any export is %+v", s)
+	}
+	found := false
+	for _, s := range export.Statuses() {
+		found = found || s.Name == "batch"
+	}
+	if !found {
+		t.Error("batcher status missing from Statuses")
+	}
+
+	// An exporter that is not managed is reported once it is added.
+	plain := &plainReporter{}
+	export.AddStatusReporter(plain)
+	if got := countStatuses("plain"); got != 1 {
+		t.Errorf("added exporter reported %d times, want once", got)
+	}
+	export.RemoveStatusReporter(plain)
+	if got := countStatuses("plain"); got != 0 {
+		t.Errorf("removed exporter reported %d times, want none", got)
+	}
+
+	var tracker export.StatusTracker
+	tracker.Record(nil)
+	if s := tracker.Current("t"); !s.Connected || s.LastExport.IsZero() || s.LastError != nil {
+		t.Errorf("status after a success is %+v", s)
+	}
+	failure := errors.New("collector down")
+	tracker.Record(failure)
+	if s := tracker.Current("t"); s.Connected || s.LastError != failure || s.LastExport.IsZero() {
+		t.Errorf("status after a failure is %+v", s)
+	}
+}
+
+// plainReporter is a StatusReporter that cannot be managed.
+type plainReporter struct{}
+
+func (*plainReporter) Status() export.Status { return export.Status{Name: "plain"} }
+
+// countStatuses returns the number of reported statuses with the given name.
+func countStatuses(name string) int {
+	n := 0
+	for _, s := range export.Statuses() {
+		if s.Name == name {
+			n++
+		}
+	}
+	return n
+}
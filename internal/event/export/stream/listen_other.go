@@ -0,0 +1,42 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package stream
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+type unixListener struct {
+	l net.Listener
+}
+
+func listen(address string) (listener, error) {
+	l, err := net.Listen("unix", address)
+	if err != nil && errors.Is(err, syscall.EADDRINUSE) {
+		// The socket may have been left behind by a process that exited
+		// without closing it; take it over unless something is still
+		// listening.
+		if conn, dialErr := net.Dial("unix", address); dialErr == nil {
+			conn.Close()
+			return nil, err
+		}
+		os.Remove(address)
+		l, err = net.Listen("unix", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return unixListener{l}, nil
+}
+
+func (u unixListener) Accept() (io.WriteCloser, error) { return u.l.Accept() }
+func (u unixListener) Close() error                    { return u.l.Close() }
@@ -0,0 +1,91 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stream
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+var errListenerClosed = errors.New("listener closed")
+
+// pipeListener accepts consumers on a named pipe.
+// Each consumer is connected to its own instance of the pipe, and a new
+// instance is created to wait for the next one.
+type pipeListener struct {
+	name string
+
+	mu     sync.Mutex
+	next   windows.Handle // the instance waiting for a consumer
+	closed bool
+}
+
+func listen(address string) (listener, error) {
+	// The first instance fails if another process already owns the name.
+	h, err := createPipe(address, windows.FILE_FLAG_FIRST_PIPE_INSTANCE)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeListener{name: address, next: h}, nil
+}
+
+func createPipe(name string, flags uint32) (windows.Handle, error) {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	return windows.CreateNamedPipe(p,
+		windows.PIPE_ACCESS_OUTBOUND|flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_WAIT,
+		windows.PIPE_UNLIMITED_INSTANCES,
+		64<<10, 0, 0, nil)
+}
+
+func (l *pipeListener) Accept() (io.WriteCloser, error) {
+	l.mu.Lock()
+	h := l.next
+	l.mu.Unlock()
+	err := windows.ConnectNamedPipe(h, nil)
+	if err == windows.ERROR_PIPE_CONNECTED {
+		// The consumer connected before we started waiting.
+		err = nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		windows.CloseHandle(h)
+		return nil, errListenerClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	next, err := createPipe(l.name, 0)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, err
+	}
+	l.next = next
+	return os.NewFile(uintptr(h), l.name), nil
+}
+
+// Close stops the listener. Accept owns the waiting instance, so Close
+// connects to it to wake Accept up, which then closes it.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+	if f, err := os.Open(l.name); err == nil {
+		f.Close()
+	}
+	return nil
+}
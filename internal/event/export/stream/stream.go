@@ -0,0 +1,358 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stream serves telemetry live over a unix socket, or a named pipe on
+// Windows, so that a sidecar process can consume it without any network
+// configuration.
+//
+// Every consumer that connects is sent a frame for each log event, finished
+// span and metric row from then on, in the format read by the streamreader
+// package. A consumer that falls behind has frames dropped rather than
+// slowing the program down, and is told how many with a "dropped" frame.
+//
+// Importing the package registers a "stream" exporter whose options are the
+// address to listen on, it defaults to streamreader.DefaultAddress of the
+// current process.
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/stream/streamreader"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Address is the path of the unix socket, or the name of the pipe on
+	// Windows. It defaults to streamreader.DefaultAddress of the current
+	// process.
+	Address string
+	// Buffer is the number of frames held for each consumer before frames
+	// are dropped, it defaults to 1024.
+	Buffer int
+}
+
+func init() {
+	export.Register("stream", func(address string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := Listen(&Config{Address: address})
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// listener accepts consumers.
+// It is implemented with a unix socket, or a named pipe on Windows.
+type listener interface {
+	Accept() (io.WriteCloser, error)
+	Close() error
+}
+
+// Exporter sends telemetry to the consumers connected to its address.
+// It must be wrapped by export.Spans for span frames to be sent.
+type Exporter struct {
+	config   Config
+	listener listener
+	done     chan struct{} // closed when the accept loop exits
+	closing  int32         // set atomically when Shutdown starts
+
+	mu      sync.Mutex
+	clients map[*client]bool
+}
+
+// client is a connected consumer.
+type client struct {
+	conn    io.WriteCloser
+	frames  chan []byte
+	done    chan struct{} // closed when the writer exits
+	dropped int64         // frames dropped since the last dropped frame, accessed atomically
+}
+
+// Listen starts serving telemetry on the configured address.
+// The Exporter is managed, so the package level export.Shutdown function
+// stops it.
+func Listen(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Address == "" {
+		resolved.Address = streamreader.DefaultAddress(os.Getpid())
+	}
+	if resolved.Buffer <= 0 {
+		resolved.Buffer = 1024
+	}
+	l, err := listen(resolved.Address)
+	if err != nil {
+		return nil, fmt.Errorf("stream exporter: %v", err)
+	}
+	e := &Exporter{
+		config:   resolved,
+		listener: l,
+		done:     make(chan struct{}),
+		clients:  make(map[*client]bool),
+	}
+	go e.accept()
+	export.Manage(e)
+	return e, nil
+}
+
+// Address returns the address the exporter is listening on.
+func (e *Exporter) Address() string {
+	return e.config.Address
+}
+
+// Clients returns the number of connected consumers.
+func (e *Exporter) Clients() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.clients)
+}
+
+func (e *Exporter) accept() {
+	defer close(e.done)
+	for {
+		conn, err := e.listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&e.closing) == 0 {
+				export.ReportError(fmt.Errorf("stream failed to accept consumer: %v", err))
+			}
+			return
+		}
+		c := &client{
+			conn:   conn,
+			frames: make(chan []byte, e.config.Buffer),
+			done:   make(chan struct{}),
+		}
+		e.mu.Lock()
+		e.clients[c] = true
+		e.mu.Unlock()
+		go e.write(c)
+	}
+}
+
+// write sends the frames queued for a client until its queue is closed by
+// Shutdown or the connection fails. A consumer that goes away is simply
+// forgotten.
+func (e *Exporter) write(c *client) {
+	defer close(c.done)
+	defer c.conn.Close()
+	for frame := range c.frames {
+		if n := atomic.SwapInt64(&c.dropped, 0); n > 0 {
+			dropped, err := streamreader.Encode(&streamreader.Frame{Time: core.Now(), Kind: "dropped", Count: n})
+			if err == nil {
+				if _, err := c.conn.Write(dropped); err != nil {
+					break
+				}
+			}
+		}
+		if _, err := c.conn.Write(frame); err != nil {
+			break
+		}
+	}
+	// Once the client is forgotten nothing more is queued for it.
+	e.mu.Lock()
+	delete(e.clients, c)
+	e.mu.Unlock()
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if e.Clients() == 0 {
+		return ctx
+	}
+	e.send(Frames(ctx, ev, lm)...)
+	return ctx
+}
+
+// ProcessMetrics sends a frame for each row of the metrics.
+func (e *Exporter) ProcessMetrics(ctx context.Context, metrics []metric.Data) {
+	var frames []*streamreader.Frame
+	for _, data := range metrics {
+		frames = append(frames, metricFrames(data)...)
+	}
+	e.send(frames...)
+}
+
+// Frames returns the frames that describe an event: one for a log event,
+// one for the end of a span if the context holds it, and one for each row
+// of the metrics of a metric event.
+// It is used by other exporters that send the same frames.
+func Frames(ctx context.Context, ev core.Event, lm label.Map) []*streamreader.Frame {
+	switch {
+	case event.IsLog(ev):
+		return []*streamreader.Frame{logFrame(ctx, ev, lm)}
+	case event.IsEnd(ev):
+		if span := export.GetSpan(ctx); span != nil {
+			return []*streamreader.Frame{spanFrame(span)}
+		}
+	case event.IsMetric(ev):
+		var frames []*streamreader.Frame
+		for _, data := range metric.Entries.Get(lm).([]metric.Data) {
+			frames = append(frames, metricFrames(data)...)
+		}
+		return frames
+	}
+	return nil
+}
+
+func (e *Exporter) send(frames ...*streamreader.Frame) {
+	var encoded [][]byte
+	for _, f := range frames {
+		data, err := streamreader.Encode(f)
+		if err != nil {
+			export.ReportError(fmt.Errorf("stream failed to encode %s: %v", f.Kind, err))
+			continue
+		}
+		encoded = append(encoded, data)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for c := range e.clients {
+		for _, data := range encoded {
+			select {
+			case c.frames <- data:
+			default:
+				atomic.AddInt64(&c.dropped, 1)
+			}
+		}
+	}
+}
+
+// Shutdown stops listening, and then waits for the queued frames to be sent
+// to each consumer before disconnecting it.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&e.closing, 0, 1) {
+		return nil
+	}
+	err := e.listener.Close()
+	<-e.done
+	export.Unmanage(e)
+	e.mu.Lock()
+	clients := make([]*client, 0, len(e.clients))
+	for c := range e.clients {
+		clients = append(clients, c)
+		close(c.frames)
+	}
+	e.clients = nil
+	e.mu.Unlock()
+	for _, c := range clients {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			// Closing the connection makes the pending write fail.
+			c.conn.Close()
+			<-c.done
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("stream failed to close %s: %v", e.config.Address, err)
+	}
+	return nil
+}
+
+func logFrame(ctx context.Context, ev core.Event, lm label.Map) *streamreader.Frame {
+	f := &streamreader.Frame{
+		Time:     ev.At(),
+		Kind:     "log",
+		Message:  keys.Msg.From(ev.Label(0)),
+		Severity: export.SeverityOf(ev, lm).String(),
+	}
+	first := 1
+	if event.IsError(ev) {
+		f.Kind = "error"
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			f.Error = err.Error()
+		}
+		first = 2
+	}
+	if span := export.GetSpan(ctx); span != nil {
+		f.TraceID = span.ID.TraceID.String()
+		f.SpanID = span.ID.SpanID.String()
+	}
+	for i := first; ev.Valid(i); i++ {
+		if l := ev.Label(i); l.Key() != export.SeverityKey {
+			addLabel(f, l)
+		}
+	}
+	return f
+}
+
+func spanFrame(span *export.Span) *streamreader.Frame {
+	start, end := span.Start().At(), span.Finish().At()
+	f := &streamreader.Frame{
+		Time:     end,
+		Kind:     "span",
+		Name:     span.Name,
+		TraceID:  span.ID.TraceID.String(),
+		SpanID:   span.ID.SpanID.String(),
+		Start:    &start,
+		Duration: end.Sub(start),
+	}
+	if span.ParentID.IsValid() {
+		f.ParentID = span.ParentID.String()
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		addLabel(f, span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		addLabel(f, l)
+	}
+	return f
+}
+
+func metricFrames(data metric.Data) []*streamreader.Frame {
+	var frames []*streamreader.Frame
+	add := func(group []label.Label, at time.Time) *streamreader.Frame {
+		f := &streamreader.Frame{Time: at, Kind: "metric", Name: data.Handle()}
+		for _, l := range group {
+			addLabel(f, l)
+		}
+		frames = append(frames, f)
+		return f
+	}
+	groups := data.Groups()
+	switch data := data.(type) {
+	case *metric.Int64Data:
+		for i, group := range groups {
+			v := float64(data.Rows[i])
+			add(group, data.EndTime).Value = &v
+		}
+	case *metric.Float64Data:
+		for i, group := range groups {
+			v := data.Rows[i]
+			add(group, data.EndTime).Value = &v
+		}
+	case *metric.HistogramInt64Data:
+		for i, group := range groups {
+			f := add(group, data.EndTime)
+			f.Count, f.Sum = data.Rows[i].Count, float64(data.Rows[i].Sum)
+		}
+	case *metric.HistogramFloat64Data:
+		for i, group := range groups {
+			f := add(group, data.EndTime)
+			f.Count, f.Sum = data.Rows[i].Count, data.Rows[i].Sum
+		}
+	}
+	return frames
+}
+
+func addLabel(f *streamreader.Frame, l label.Label) {
+	if !l.Valid() {
+		return
+	}
+	if f.Labels == nil {
+		f.Labels = make(map[string]interface{})
+	}
+	f.Labels[l.Key().Name()] = export.LabelValue(l)
+}
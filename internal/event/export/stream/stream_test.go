@@ -0,0 +1,127 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/stream"
+	"golang.org/x/tools/internal/event/export/stream/streamreader"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+func testAddress(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf(`\\.\pipe\%s-%d`, t.Name(), time.Now().UnixNano())
+	}
+	return filepath.Join(t.TempDir(), "telemetry.sock")
+}
+
+// connect dials the exporter and waits for it to accept the connection.
+func connect(t *testing.T, exporter *stream.Exporter, clients int) *streamreader.Reader {
+	t.Helper()
+	r, err := streamreader.Dial(exporter.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for exporter.Clients() < clients {
+		time.Sleep(time.Millisecond)
+	}
+	return r
+}
+
+func TestStream(t *testing.T) {
+	exporter, err := stream.Listen(&stream.Config{Address: testAddress(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+
+	// Nothing is sent before a consumer connects.
+	event.Log(context.Background(), "unseen")
+	first := connect(t, exporter, 1)
+	defer first.Close()
+	second := connect(t, exporter, 2)
+	defer second.Close()
+
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file", "").Of("main.go"))
+	event.Error(ctx, "failed", errors.New("timeout"))
+	done()
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []*streamreader.Reader{first, second} {
+		var got []string
+		for {
+			f, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch f.Kind {
+			case "error":
+				got = append(got, fmt.Sprintf("%s %s: %s", f.Kind, f.Message, f.Error))
+			case "span":
+				got = append(got, fmt.Sprintf("%s %s %v", f.Kind, f.Name, f.Labels))
+			default:
+				got = append(got, f.Kind)
+			}
+		}
+		if got, want := fmt.Sprint(got), "[error failed: timeout span hover map[file:main.go]]"; got != want {
+			t.Errorf("consumer got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDropped(t *testing.T) {
+	exporter, err := stream.Listen(&stream.Config{Address: testAddress(t), Buffer: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	r := connect(t, exporter, 1)
+	defer r.Close()
+
+	// The consumer is not reading, so at most the queue and whatever the
+	// connection buffers can be held; the rest are dropped.
+	ctx := event.WithExporter(context.Background(), exporter.ProcessEvent)
+	const sent = 20000
+	for i := 0; i < sent; i++ {
+		event.Log(ctx, "flood")
+	}
+	// Read until the notice of the dropped frames, which comes before the
+	// next frame sent.
+	event.Log(ctx, "last")
+	received, dropped := 0, int64(0)
+	for dropped == 0 {
+		f, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f.Kind {
+		case "dropped":
+			dropped = f.Count
+		case "log":
+			received++
+		}
+	}
+	if received+int(dropped) > sent+1 || dropped == 0 {
+		t.Errorf("received %d and dropped %d of %d frames", received, dropped, sent+1)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package streamreader
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// DefaultAddress returns the address the stream of the process with the
+// given pid is served on if no other is configured.
+func DefaultAddress(pid int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gopls-telemetry-%d.sock", pid))
+}
+
+func dial(address string) (io.ReadCloser, error) {
+	return net.Dial("unix", address)
+}
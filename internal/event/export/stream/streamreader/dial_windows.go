@@ -0,0 +1,22 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamreader
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultAddress returns the address the stream of the process with the
+// given pid is served on if no other is configured.
+func DefaultAddress(pid int) string {
+	return fmt.Sprintf(`\\.\pipe\gopls-telemetry-%d`, pid)
+}
+
+func dial(address string) (io.ReadCloser, error) {
+	// The server end of the pipe is write only.
+	return os.Open(address)
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package streamreader reads the telemetry streamed by the
+// golang.org/x/tools/internal/event/export/stream exporter, so that a
+// sidecar process can consume it live.
+//
+// The stream is a sequence of frames, each a four byte big-endian length
+// followed by that many bytes of JSON encoding a Frame.
+// The package does not depend on the event packages, so a consumer only
+// needs this package and the address of the socket.
+package streamreader
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MaxFrameSize is the largest frame that is written or read.
+const MaxFrameSize = 16 << 20
+
+// Frame is a single item of telemetry.
+type Frame struct {
+	// Time is when the event happened, or the span finished.
+	Time time.Time `json:"time"`
+	// Kind is one of "log", "error", "span" or "metric", or "dropped" if
+	// frames were discarded because the consumer could not keep up.
+	Kind string `json:"kind"`
+	// Name is the name of a span or metric.
+	Name string `json:"name,omitempty"`
+	// Message and Error are the text of a log event.
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Severity is the severity of a log event.
+	Severity string `json:"severity,omitempty"`
+	// TraceID and SpanID identify the span a log event happened in, or the
+	// span itself. ParentID is the parent of a span.
+	TraceID  string `json:"trace_id,omitempty"`
+	SpanID   string `json:"span_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	// Start is when a span started.
+	Start *time.Time `json:"start,omitempty"`
+	// Duration is the length of a span.
+	Duration time.Duration `json:"duration_ns,omitempty"`
+	// Value is the value of a counter or gauge.
+	Value *float64 `json:"value,omitempty"`
+	// Count is the number of values recorded by a histogram, or the number of
+	// frames that were dropped.
+	Count int64 `json:"count,omitempty"`
+	// Sum is the sum of the values recorded by a histogram.
+	Sum float64 `json:"sum,omitempty"`
+	// Labels holds the labels of the event, span or metric row.
+	Labels map[string]interface{} `json:"labels,omitempty"`
+}
+
+// Encode returns the framed encoding of f.
+func Encode(f *Frame) ([]byte, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes is larger than %d", len(data), MaxFrameSize)
+	}
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	return append(frame, data...), nil
+}
+
+// Reader reads frames from a stream.
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+}
+
+// Dial connects to the stream at address, which is the path of a unix
+// socket, or on Windows the name of a pipe such as \\.\pipe\gopls.
+func Dial(address string) (*Reader, error) {
+	conn, err := dial(address)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReader(conn)
+	r.closer = conn
+	return r, nil
+}
+
+// NewReader returns a Reader that reads frames from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next frame of the stream.
+// It returns io.EOF when the stream ends cleanly between frames.
+func (r *Reader) Next() (*Frame, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes is larger than %d", n, MaxFrameSize)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	f := &Frame{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("invalid frame: %v", err)
+	}
+	return f, nil
+}
+
+// Close closes the connection of a Reader returned by Dial.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
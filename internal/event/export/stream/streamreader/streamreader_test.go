@@ -0,0 +1,66 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package streamreader_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event/export/stream/streamreader"
+)
+
+func TestRoundTrip(t *testing.T) {
+	start := time.Date(2020, 3, 5, 14, 27, 48, 0, time.UTC)
+	frames := []*streamreader.Frame{
+		{Time: start, Kind: "log", Message: "hello", Severity: "info"},
+		{Time: start.Add(time.Second), Kind: "span", Name: "hover", Start: &start, Duration: time.Second, Labels: map[string]interface{}{"file": "main.go"}},
+	}
+	var buf bytes.Buffer
+	for _, f := range frames {
+		data, err := streamreader.Encode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+	}
+	r := streamreader.NewReader(&buf)
+	var span *streamreader.Frame
+	for _, want := range frames {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Kind != want.Kind || !got.Time.Equal(want.Time) || got.Message != want.Message || got.Name != want.Name || got.Duration != want.Duration {
+			t.Errorf("got frame %+v, want %+v", got, want)
+		}
+		if got.Kind == "span" {
+			span = got
+		}
+	}
+	if span == nil || span.Start == nil || !span.Start.Equal(start) || span.Labels["file"] != "main.go" {
+		t.Errorf("span frame decoded as %+v", span)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v at the end of the stream, want io.EOF", err)
+	}
+}
+
+func TestInvalidFrames(t *testing.T) {
+	for _, test := range []struct {
+		name, stream, want string
+	}{
+		{"truncated", "\x00\x00\x00\x10{}", "unexpected EOF"},
+		{"oversized", "\x7f\x00\x00\x00", "larger than"},
+		{"not json", "\x00\x00\x00\x03abc", "invalid frame"},
+	} {
+		_, err := streamreader.NewReader(strings.NewReader(test.stream)).Next()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.want)
+		}
+	}
+}
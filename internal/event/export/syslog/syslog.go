@@ -0,0 +1,291 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package syslog forwards log events as RFC 5424 syslog messages.
+//
+// The syslog severity comes from export.SeverityOf, and the labels of each
+// event, along with its severity and the trace and span it happened in, are
+// sent as the parameters of a single structured data element.
+// Messages are sent over UDP, TCP using the octet counting framing of
+// RFC 6587, or a unix socket.
+//
+// Importing the package registers a "syslog" exporter whose options are the
+// address of the server as network://address, such as udp://localhost:514 or
+// unix:///dev/log; if they are empty the local syslog socket is used.
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Facility is a syslog facility code.
+type Facility int
+
+// The facilities most likely to be useful for tools, see RFC 5424 for the
+// rest.
+const (
+	FacilityUser   = Facility(1)
+	FacilityDaemon = Facility(3)
+	FacilityLocal0 = Facility(16)
+)
+
+// DefaultSDID is the identifier of the structured data element, it uses the
+// enterprise number reserved for documentation by RFC 5612.
+const DefaultSDID = "event@32473"
+
+// Config configures an Exporter.
+type Config struct {
+	// Network is one of "udp", "tcp", "unix" or "unixgram".
+	Network string
+	// Address is the address of the server, or the name of the socket.
+	Address string
+	// Facility is the facility of every message, it defaults to
+	// FacilityUser.
+	Facility Facility
+	// AppName and Hostname identify the sender, they default to the name of
+	// the binary and the hostname.
+	AppName  string
+	Hostname string
+	// SDID is the identifier of the structured data element, it defaults to
+	// DefaultSDID.
+	SDID string
+}
+
+func init() {
+	export.Register("syslog", func(options string) (event.Exporter, export.Shutdowner, error) {
+		config := &Config{}
+		if options != "" {
+			i := strings.Index(options, "://")
+			if i < 0 {
+				return nil, nil, fmt.Errorf("syslog exporter needs options of the form network://address")
+			}
+			config.Network, config.Address = options[:i], options[i+3:]
+		}
+		exporter, err := Dial(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter.ProcessEvent, exporter, nil
+	})
+}
+
+// localSockets are the names the local syslog socket usually has.
+var localSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Exporter sends log events to a syslog server.
+// It should be wrapped by export.Spans, so that messages can name the span
+// they happened in.
+type Exporter struct {
+	config Config
+	procID string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Dial returns an Exporter connected to the configured server.
+// If no network is configured, it connects to the local syslog socket.
+func Dial(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Facility == 0 {
+		resolved.Facility = FacilityUser
+	}
+	if resolved.AppName == "" {
+		resolved.AppName = filepath.Base(os.Args[0])
+	}
+	if resolved.Hostname == "" {
+		resolved.Hostname, _ = os.Hostname()
+	}
+	if resolved.SDID == "" {
+		resolved.SDID = DefaultSDID
+	}
+	e := &Exporter{config: resolved, procID: strconv.Itoa(os.Getpid())}
+	var err error
+	if resolved.Network == "" {
+		err = e.dialLocal()
+	} else {
+		err = e.dial()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("syslog exporter: %v", err)
+	}
+	return e, nil
+}
+
+func (e *Exporter) dialLocal() error {
+	var err error
+	for _, path := range localSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			e.config.Network, e.config.Address = network, path
+			if err = e.dial(); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+func (e *Exporter) dial() error {
+	conn, err := net.Dial(e.config.Network, e.config.Address)
+	if err != nil {
+		return err
+	}
+	e.conn = conn
+	return nil
+}
+
+func (e *Exporter) ProcessEvent(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+	if !event.IsLog(ev) {
+		return ctx
+	}
+	message := e.format(ctx, ev, lm)
+	e.mu.Lock()
+	err := e.send(message)
+	e.mu.Unlock()
+	export.ReportError(err)
+	return ctx
+}
+
+// Shutdown closes the connection to the server.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// send writes a message, redialing once if the connection has been lost.
+func (e *Exporter) send(message []byte) error {
+	switch e.config.Network {
+	case "tcp":
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	case "unix":
+		// Stream sockets of local daemons separate the messages with newlines.
+		message = append(message, '\n')
+	}
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if e.conn == nil {
+			if err = e.dial(); err != nil {
+				continue
+			}
+		}
+		if _, err = e.conn.Write(message); err == nil {
+			return nil
+		}
+		e.conn.Close()
+		e.conn = nil
+	}
+	return fmt.Errorf("syslog failed to send message: %v", err)
+}
+
+// severities maps the export severities to syslog ones.
+var severities = map[export.Severity]int{
+	export.SeverityDebug:   7,
+	export.SeverityInfo:    6,
+	export.SeverityWarning: 4,
+	export.SeverityError:   3,
+}
+
+// format returns the RFC 5424 message for a log event.
+func (e *Exporter) format(ctx context.Context, ev core.Event, lm label.Map) []byte {
+	severity := export.SeverityOf(ev, lm)
+	code, ok := severities[severity]
+	if !ok {
+		code = 5
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		int(e.config.Facility)*8+code,
+		ev.At().Format("2006-01-02T15:04:05.000000Z07:00"),
+		header(e.config.Hostname, 255),
+		header(e.config.AppName, 48),
+		header(e.procID, 128),
+		"log",
+	)
+	b.WriteByte('[')
+	b.WriteString(e.config.SDID)
+	param(&b, "severity", severity.String())
+	if span := export.GetSpan(ctx); span != nil {
+		param(&b, "trace", span.ID.TraceID.String())
+		param(&b, "span", span.ID.SpanID.String())
+	}
+	msg := keys.Msg.From(ev.Label(0))
+	first := 1
+	if event.IsError(ev) {
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			param(&b, "error", err.Error())
+			msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		first = 2
+	}
+	for i := first; ev.Valid(i); i++ {
+		l := ev.Label(i)
+		if !l.Valid() || l.Key() == export.SeverityKey {
+			continue
+		}
+		param(&b, l.Key().Name(), fmt.Sprint(export.LabelValue(l)))
+	}
+	b.WriteByte(']')
+	if msg != "" {
+		b.WriteByte(' ')
+		b.WriteString(msg)
+	}
+	return []byte(b.String())
+}
+
+// header returns a header field, which must be printable ASCII without
+// spaces and no longer than max, with "-" standing for an empty value.
+func header(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// param writes an SD-PARAM, sanitizing the name and escaping the value.
+func param(b *strings.Builder, name, value string) {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	b.WriteByte(' ')
+	b.WriteString(name)
+	b.WriteString(`="`)
+	b.WriteString(valueEscaper.Replace(value))
+	b.WriteByte('"')
+}
+
+var valueEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
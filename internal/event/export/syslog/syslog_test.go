@@ -0,0 +1,132 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syslog_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/syslog"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// logEvents sends a warning and an error inside a span to the exporter, and
+// returns the span.
+func logEvents(t *testing.T, exporter *syslog.Exporter) *export.Span {
+	event.SetClock(fixedClock(time.Date(2020, 3, 5, 14, 27, 48, 123456789, time.UTC)))
+	defer event.SetClock(nil)
+	event.SetExporter(export.Spans(exporter.ProcessEvent))
+	defer event.SetExporter(nil)
+	ctx, done := event.Start(context.Background(), "hover")
+	defer done()
+	event.Log(ctx, "slow", export.SeverityKey.Of(int(export.SeverityWarning)), keys.NewString("file", "").Of(`a "quoted] \name`))
+	event.Error(ctx, "failed", errors.New("timeout"))
+	return export.GetSpan(ctx)
+}
+
+func wantMessages(span *export.Span) []string {
+	ids := ` trace="` + span.ID.TraceID.String() + `" span="` + span.ID.SpanID.String() + `"`
+	return []string{
+		`<132>1 2020-03-05T14:27:48.123456Z host gopls 1 log [event@32473 severity="warning"` + ids + ` file="a \"quoted\] \\name"] slow`,
+		`<131>1 2020-03-05T14:27:48.123456Z host gopls 1 log [event@32473 severity="error"` + ids + ` error="timeout"] failed: timeout`,
+	}
+}
+
+// withoutProcID replaces the process id, which varies, with 1.
+func withoutProcID(message string) string {
+	fields := strings.SplitN(message, " ", 6)
+	if len(fields) < 6 {
+		return message
+	}
+	fields[4] = "1"
+	return strings.Join(fields, " ")
+}
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	exporter, err := syslog.Dial(&syslog.Config{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: syslog.FacilityLocal0,
+		AppName:  "gopls",
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	span := logEvents(t, exporter)
+	buf := make([]byte, 4096)
+	for _, want := range wantMessages(span) {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := withoutProcID(string(buf[:n])); got != want {
+			t.Errorf("got message\n%s\nwant\n%s", got, want)
+		}
+	}
+}
+
+func TestTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	exporter, err := syslog.Dial(&syslog.Config{
+		Network:  "tcp",
+		Address:  ln.Addr().String(),
+		Facility: syslog.FacilityLocal0,
+		AppName:  "gopls",
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	span := logEvents(t, exporter)
+	exporter.Shutdown(context.Background())
+	r := bufio.NewReader(conn)
+	for _, want := range wantMessages(span) {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+		if err != nil {
+			t.Fatalf("message is not octet counted: %v", err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := withoutProcID(string(buf)); got != want {
+			t.Errorf("got message\n%s\nwant\n%s", got, want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+)
+
+// TailOptions configures a TailSampler.
+type TailOptions struct {
+	// Latency is the duration of the root span above which a trace is kept.
+	Latency time.Duration
+	// Window is how long the spans of a trace are held waiting for its root
+	// span to end, and how long the decision for a trace is remembered for
+	// the spans that end after it. It defaults to 30 seconds.
+	Window time.Duration
+	// MaxTraces is the most traces held at once, when there are more the
+	// oldest is decided early. It defaults to 1000.
+	MaxTraces int
+}
+
+// TailSampler is a BatchExporter that holds the finished spans of each trace
+// until the trace is complete, and only hands the traces that were slow or
+// failed to the exporter it wraps, as those are the ones anyone looks at and
+// head sampling usually misses them.
+type TailSampler struct {
+	exporter BatchExporter
+	opts     TailOptions
+	dropped  int64 // accessed atomically
+
+	mu      sync.Mutex
+	pending map[TraceID]*heldTrace
+	decided map[TraceID]decision
+}
+
+// heldTrace is the finished spans of a trace that has not been decided yet,
+// and when the first of them arrived.
+type heldTrace struct {
+	spans   []*Span
+	arrived time.Time
+}
+
+// decision is whether a trace was kept, and when that was decided.
+type decision struct {
+	keep bool
+	at   time.Time
+}
+
+// TailSample returns a TailSampler that delivers to exporter the traces whose
+// root span lasted at least opts.Latency, or that had a span with an error
+// status.
+// A trace is complete when the span that has no parent in this process ends,
+// and spans of the trace that end later follow the decision made then.
+// A trace that is still incomplete once its spans have been held for the
+// window is decided on the spans held, and kept if one of them failed or it
+// has already lasted longer than the latency.
+// As the spans are held until their trace is complete, the exporter it wraps
+// should not care when they finished. Metrics are passed straight through.
+// The TailSampler is managed, so the package level Flush and Shutdown
+// functions decide and deliver the traces it is holding.
+func TailSample(exporter BatchExporter, opts TailOptions) *TailSampler {
+	if opts.Window <= 0 {
+		opts.Window = 30 * time.Second
+	}
+	if opts.MaxTraces < 1 {
+		opts.MaxTraces = 1000
+	}
+	t := &TailSampler{
+		exporter: exporter,
+		opts:     opts,
+		pending:  make(map[TraceID]*heldTrace),
+		decided:  make(map[TraceID]decision),
+	}
+	Manage(t)
+	return t
+}
+
+// ExportSpans implements BatchExporter.
+func (t *TailSampler) ExportSpans(ctx context.Context, spans []*Span) error {
+	var kept []*Span
+	t.mu.Lock()
+	now := core.Now()
+	for _, span := range spans {
+		id := span.ID.TraceID
+		if d, ok := t.decided[id]; ok {
+			if d.keep {
+				kept = append(kept, span)
+			} else {
+				atomic.AddInt64(&t.dropped, 1)
+			}
+			continue
+		}
+		held := t.pending[id]
+		if held == nil {
+			held = &heldTrace{arrived: now}
+			t.pending[id] = held
+		}
+		held.spans = append(held.spans, span)
+		if span.localRoot {
+			kept = t.decide(kept, id, held, span, now)
+		}
+	}
+	kept = t.expire(kept, now)
+	t.mu.Unlock()
+	if len(kept) == 0 {
+		return nil
+	}
+	return t.exporter.ExportSpans(ctx, kept)
+}
+
+// ExportMetrics implements BatchExporter.
+func (t *TailSampler) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return t.exporter.ExportMetrics(ctx, metrics)
+}
+
+// Flush decides every trace being held, complete or not, and delivers the
+// ones that are kept.
+func (t *TailSampler) Flush(ctx context.Context) error {
+	var kept []*Span
+	t.mu.Lock()
+	now := core.Now()
+	for id, held := range t.pending {
+		kept = t.decide(kept, id, held, nil, now)
+	}
+	t.mu.Unlock()
+	if len(kept) == 0 {
+		return nil
+	}
+	return t.exporter.ExportSpans(ctx, kept)
+}
+
+// Shutdown delivers the traces being held, as Flush does, and stops managing
+// the TailSampler.
+func (t *TailSampler) Shutdown(ctx context.Context) error {
+	Unmanage(t)
+	return t.Flush(ctx)
+}
+
+// Dropped returns the number of spans dropped so far.
+func (t *TailSampler) Dropped() int64 {
+	return atomic.LoadInt64(&t.dropped)
+}
+
+// decide makes the decision for a held trace, whose root span is given if it
+// has ended, and appends its spans to kept if it is kept.
+// It must be called with the lock held.
+func (t *TailSampler) decide(kept []*Span, id TraceID, held *heldTrace, root *Span, now time.Time) []*Span {
+	delete(t.pending, id)
+	keep := false
+	var first time.Time
+	for _, span := range held.spans {
+		if span.Status().Code == SpanStatusError {
+			keep = true
+		}
+		if start := span.Start().At(); first.IsZero() || start.Before(first) {
+			first = start
+		}
+	}
+	if root != nil {
+		keep = keep || root.Finish().At().Sub(root.Start().At()) >= t.opts.Latency
+	} else {
+		keep = keep || now.Sub(first) >= t.opts.Latency
+	}
+	t.decided[id] = decision{keep: keep, at: now}
+	if !keep {
+		atomic.AddInt64(&t.dropped, int64(len(held.spans)))
+		return kept
+	}
+	return append(kept, held.spans...)
+}
+
+// expire decides the traces that have been held for the window, and the
+// oldest ones while too many are held, and forgets the decisions older than
+// the window.
+// It must be called with the lock held.
+func (t *TailSampler) expire(kept []*Span, now time.Time) []*Span {
+	for id, held := range t.pending {
+		if now.Sub(held.arrived) >= t.opts.Window {
+			kept = t.decide(kept, id, held, nil, now)
+		}
+	}
+	for len(t.pending) > t.opts.MaxTraces {
+		var oldest TraceID
+		var arrived time.Time
+		for id, held := range t.pending {
+			if arrived.IsZero() || held.arrived.Before(arrived) {
+				oldest, arrived = id, held.arrived
+			}
+		}
+		kept = t.decide(kept, oldest, t.pending[oldest], nil, now)
+	}
+	for id, d := range t.decided {
+		if now.Sub(d.at) >= t.opts.Window {
+			delete(t.decided, id)
+		}
+	}
+	return kept
+}
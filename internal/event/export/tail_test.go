@@ -0,0 +1,92 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+)
+
+// spanNames is a BatchExporter that records the names of the spans it is
+// handed.
+type spanNames struct{ names []string }
+
+func (r *spanNames) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	for _, span := range spans {
+		r.names = append(r.names, span.Name)
+	}
+	return nil
+}
+
+func (r *spanNames) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+// tailProcessor hands each span to a TailSampler as soon as it ends.
+type tailProcessor struct{ tail *export.TailSampler }
+
+func (p tailProcessor) ProcessSpan(ctx context.Context, span *export.Span) {
+	p.tail.ExportSpans(ctx, []*export.Span{span})
+}
+
+func TestTailSample(t *testing.T) {
+	clock := &settableClock{at: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	event.SetClock(clock)
+	defer event.SetClock(nil)
+
+	r := &spanNames{}
+	tail := export.TailSample(r, export.TailOptions{Latency: 100 * time.Millisecond, Window: time.Minute})
+	defer tail.Shutdown(context.Background())
+	event.SetExporter(export.Spans(export.SpansOnly(tailProcessor{tail})))
+	defer event.SetExporter(nil)
+
+	trace := func(name string, d time.Duration, fail bool) {
+		ctx, done := event.Start(context.Background(), name)
+		child, childDone := event.Start(ctx, name+".child")
+		clock.at = clock.at.Add(d)
+		if fail {
+			export.RecordError(child, errors.New("failed"))
+		}
+		childDone()
+		done()
+	}
+	trace("fast", 10*time.Millisecond, false)
+	trace("slow", 200*time.Millisecond, false)
+	trace("failed", 10*time.Millisecond, true)
+
+	// A span that ends after its root follows the decision for its trace.
+	ctx, done := event.Start(context.Background(), "slow.async")
+	_, lateDone := event.Start(ctx, "slow.async.late")
+	clock.at = clock.at.Add(time.Second)
+	done()
+	lateDone()
+
+	// A trace that never completes is decided when it is flushed.
+	ctx, _ = event.Start(context.Background(), "unfinished")
+	_, unfinishedDone := event.Start(ctx, "unfinished.child")
+	clock.at = clock.at.Add(time.Second)
+	unfinishedDone()
+	if err := export.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := append([]string(nil), r.names...)
+	sort.Strings(got)
+	want := []string{"failed", "failed.child", "slow", "slow.async", "slow.async.late", "slow.child", "unfinished.child"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if got := tail.Dropped(); got != 2 {
+		t.Errorf("dropped %d spans, want the 2 of the fast trace", got)
+	}
+}
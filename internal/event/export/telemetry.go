@@ -0,0 +1,175 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// Keys for the metric events that the exporters in this package emit about
+// their own performance.
+var (
+	ExporterKind  = keys.NewString("telemetry.exporter.kind", "The kind of exporter reporting on itself.")
+	QueueDepth    = keys.NewInt64("telemetry.exporter.queue_depth", "Events waiting to be delivered.")
+	DroppedEvents = keys.NewInt64("telemetry.exporter.dropped", "Events dropped since the last report.")
+	BatchSize     = keys.NewInt64("telemetry.exporter.batch_size", "Items delivered in a single batch.")
+	ExportLatency = keys.NewFloat64("telemetry.exporter.latency", "Time taken to deliver a batch, in milliseconds.")
+	ExportRetries = keys.NewInt64("telemetry.exporter.retries", "Attempts needed to deliver a batch beyond the first.")
+)
+
+var (
+	queueDepthMetric = metric.Scalar{
+		Name:        "telemetry.exporter.queue_depth",
+		Description: "Number of events waiting in exporter queues, by kind.",
+		Keys:        []label.Key{ExporterKind},
+	}
+
+	droppedMetric = metric.Scalar{
+		Name:        "telemetry.exporter.dropped",
+		Description: "Count of events dropped by exporters, by kind.",
+		Keys:        []label.Key{ExporterKind},
+	}
+
+	retriesMetric = metric.Scalar{
+		Name:        "telemetry.exporter.retries",
+		Description: "Count of delivery retries, by kind.",
+		Keys:        []label.Key{ExporterKind},
+	}
+
+	batchSizeMetric = metric.HistogramInt64{
+		Name:        "telemetry.exporter.batch_size",
+		Description: "Distribution of delivered batch sizes, by kind.",
+		Keys:        []label.Key{ExporterKind},
+		Buckets:     []int64{1, 10, 100, 1000, 10000},
+	}
+
+	latencyMetric = metric.HistogramFloat64{
+		Name:        "telemetry.exporter.latency",
+		Description: "Distribution of batch delivery latency in milliseconds, by kind.",
+		Unit:        metric.UnitMilliseconds,
+		Keys:        []label.Key{ExporterKind},
+		Buckets:     []float64{1, 5, 10, 50, 100, 500, 1000, 5000, 10000},
+	}
+)
+
+// RegisterMetrics adds the metrics that exporters report about themselves to
+// m, so that they can be delivered alongside the application's own metrics.
+// The exporters do not report on themselves until it has been called.
+func RegisterMetrics(m *metric.Config) {
+	self.enable()
+	queueDepthMetric.LatestInt64(m, QueueDepth)
+	droppedMetric.SumInt64(m, DroppedEvents)
+	retriesMetric.SumInt64(m, ExportRetries)
+	batchSizeMetric.Record(m, BatchSize)
+	latencyMetric.Record(m, ExportLatency)
+}
+
+const (
+	// selfReportInterval is how often the exporters' own metrics are emitted.
+	selfReportInterval = time.Second
+	// maxPendingObservations bounds the observations held between reports.
+	maxPendingObservations = 100
+)
+
+// self collects the observations of all the exporters in the process.
+var self selfReporter
+
+// selfReporter emits the metrics of the exporters from its own goroutine, at
+// most once every selfReportInterval.
+// Emitting them directly would risk an exporter recursively handling its
+// own metric events, possibly with its lock held, and an asynchronous
+// exporter could end up reporting on the delivery of its own reports forever.
+type selfReporter struct {
+	// reporting serializes calls to report, so samplers are never called
+	// concurrently.
+	reporting sync.Mutex
+
+	mu       sync.Mutex
+	enabled  bool
+	started  bool
+	pending  [][]label.Label
+	samplers map[interface{}]func() []label.Label
+}
+
+// enable starts the reporting goroutine the first time it is called.
+func (r *selfReporter) enable() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = true
+	if r.started {
+		return
+	}
+	r.started = true
+	go func() {
+		ticker := time.NewTicker(selfReportInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.report(context.Background())
+		}
+	}()
+}
+
+// observe queues a metric event with the supplied labels for the next report.
+func (r *selfReporter) observe(labels ...label.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enabled && len(r.pending) < maxPendingObservations {
+		r.pending = append(r.pending, labels)
+	}
+}
+
+// addSampler arranges for f to be called at each report, to supply the labels
+// for a metric event that describes the current state of owner.
+// f may return nil if nothing has changed since it was last called.
+func (r *selfReporter) addSampler(owner interface{}, f func() []label.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.samplers == nil {
+		r.samplers = make(map[interface{}]func() []label.Label)
+	}
+	r.samplers[owner] = f
+}
+
+func (r *selfReporter) removeSampler(owner interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.samplers, owner)
+}
+
+// report emits all the pending observations and samples.
+func (r *selfReporter) report(ctx context.Context) {
+	r.reporting.Lock()
+	defer r.reporting.Unlock()
+	r.mu.Lock()
+	if !r.enabled {
+		r.mu.Unlock()
+		return
+	}
+	pending := r.pending
+	r.pending = nil
+	samplers := make([]func() []label.Label, 0, len(r.samplers))
+	for _, f := range r.samplers {
+		samplers = append(samplers, f)
+	}
+	r.mu.Unlock()
+	if !event.EnabledContext(ctx) {
+		return
+	}
+	for _, f := range samplers {
+		if labels := f(); labels != nil {
+			event.Metric(ctx, labels...)
+		}
+	}
+	for _, labels := range pending {
+		event.Metric(ctx, labels...)
+	}
+}
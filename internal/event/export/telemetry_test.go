@@ -0,0 +1,73 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/label"
+)
+
+type nullBatchExporter struct{}
+
+func (nullBatchExporter) ExportSpans(context.Context, []*Span) error         { return nil }
+func (nullBatchExporter) ExportMetrics(context.Context, []metric.Data) error { return nil }
+
+func TestSelfMetrics(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string]bool)
+	var m metric.Config
+	RegisterMetrics(&m)
+	defer func() {
+		self.mu.Lock()
+		self.enabled = false
+		self.mu.Unlock()
+	}()
+	event.SetExporter(m.Exporter(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		mu.Lock()
+		defer mu.Unlock()
+		if data, ok := metric.Entries.Get(lm).([]metric.Data); ok {
+			for _, d := range data {
+				got[d.Handle()] = true
+			}
+		}
+		return ctx
+	}))
+	defer event.SetExporter(nil)
+
+	ctx := context.Background()
+	q := Buffered(Null(), 1, DropNewest)
+	defer q.Shutdown(ctx)
+	atomic.AddInt64(&q.dropped, 1)
+	b := Batch(nullBatchExporter{}, 10, time.Hour)
+	defer b.Shutdown(ctx)
+	b.mu.Lock()
+	b.spans = append(b.spans, &Span{Name: "span"})
+	b.mu.Unlock()
+	if err := b.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	self.report(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{
+		"telemetry.exporter.queue_depth",
+		"telemetry.exporter.dropped",
+		"telemetry.exporter.batch_size",
+		"telemetry.exporter.latency",
+	} {
+		if !got[name] {
+			t.Errorf("metric %s was not reported", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tempo sends spans to Grafana Tempo.
+//
+// Tempo ingests traces through the OTLP receiver of its distributor, so the
+// spans are sent as OTLP over HTTP. In a multi-tenant installation the tenant
+// is named by the X-Scope-OrgID header of every request.
+// Tempo does not store metrics, so they are ignored.
+//
+// Importing the package registers a "tempo" exporter whose options are the
+// address of the distributor, the tenant is read from the TEMPO_TENANT_ID
+// environment variable. OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME and
+// OTEL_TRACES_SAMPLER are honored as they are by the otlp exporter.
+package tempo
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/otlp"
+	"golang.org/x/tools/internal/event/export/otlp/otlphttp"
+)
+
+// DefaultEndpoint is the OTLP HTTP receiver of a distributor running on the
+// local machine.
+const DefaultEndpoint = "http://localhost:4318"
+
+// TenantEnv is the environment variable the registered exporter reads the
+// tenant from.
+const TenantEnv = "TEMPO_TENANT_ID"
+
+// TenantHeader is the header Tempo reads the tenant from.
+const TenantHeader = "X-Scope-OrgID"
+
+type Config struct {
+	// Endpoint is the base URL of the OTLP receiver.
+	Endpoint string
+	// Tenant is sent as the X-Scope-OrgID header, it may be left empty if
+	// Tempo is not running in multi-tenant mode.
+	Tenant string
+	// Headers are added to every request, normally for authentication with a
+	// gateway in front of Tempo.
+	Headers map[string]string
+	// TLS configures the connection to an https endpoint.
+	// It is ignored if Client is set.
+	TLS *tls.Config
+	// Client sends the requests, it defaults to a client using TLS.
+	Client *http.Client
+	// Service is the service.name resource attribute, it defaults to the
+	// value of OTEL_SERVICE_NAME, or the name of the binary.
+	Service string
+}
+
+func init() {
+	export.Register("tempo", func(endpoint string) (event.Exporter, export.Shutdowner, error) {
+		if endpoint != "" && !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		exporter := New(&Config{Endpoint: endpoint, Tenant: os.Getenv(TenantEnv)})
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return otlp.Sampled(batcher.ProcessEvent), batcher, nil
+	})
+}
+
+// Exporter is an export.BatchExporter that sends spans to Tempo.
+type Exporter struct {
+	otlp *otlp.Exporter
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that sends to the configured endpoint.
+func New(config *Config) *Exporter {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	headers := make(map[string]string, len(config.Headers)+1)
+	for k, v := range config.Headers {
+		headers[k] = v
+	}
+	if config.Tenant != "" {
+		headers[TenantHeader] = config.Tenant
+	}
+	client := otlphttp.New(&otlphttp.Config{
+		Endpoint: endpoint,
+		Headers:  headers,
+		TLS:      config.TLS,
+		Client:   config.Client,
+	})
+	return &Exporter{otlp: otlp.New(&otlp.Config{Client: client, Service: config.Service})}
+}
+
+// ExportSpans sends the spans to Tempo.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	return e.otlp.ExportSpans(ctx, spans)
+}
+
+// ExportMetrics does nothing, as Tempo only stores traces.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tempo_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/export/tempo"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestExportSpans(t *testing.T) {
+	var paths, tenants []string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		tenants = append(tenants, r.Header.Get(tempo.TenantHeader))
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	_, done := event.Start(context.Background(), "completion")
+	done()
+	event.SetExporter(nil)
+
+	exporter := tempo.New(&tempo.Config{Endpoint: srv.URL, Tenant: "team-a"})
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.ExportMetrics(context.Background(), []metric.Data{nil}); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/v1/traces" || tenants[0] != "team-a" {
+		t.Fatalf("got requests for %v with tenants %q, want one trace request for team-a", paths, tenants)
+	}
+	if !bytes.Contains(body, []byte("completion")) {
+		t.Errorf("span name missing from request body %q", body)
+	}
+}
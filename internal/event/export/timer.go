@@ -0,0 +1,63 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// SpanName labels the durations recorded by TimeSpans with the name of the
+// span, so that a histogram timing several spans can be grouped by it.
+var SpanName = keys.NewString("span.name", "The name of the span that was timed.")
+
+// TimeSpans adds the histogram described by info to m, and returns middleware
+// that records the duration, in milliseconds, of every span whose name
+// matches pattern into it when the span ends. If the pattern ends in "*" it
+// matches every span whose name starts with the rest of it.
+// The unit of the histogram is always metric.UnitMilliseconds.
+// The histogram is grouped by its Keys as found in the labels of the end
+// event, the labels the span was started with, and SpanName, so most latency
+// metrics need no instrumentation beyond the span itself.
+// The middleware must be wrapped by Spans, and must wrap the exporter of m.
+func TimeSpans(m *metric.Config, info metric.HistogramFloat64, pattern string) Middleware {
+	key := keys.NewFloat64(info.Name, info.Description)
+	info.Unit = metric.UnitMilliseconds
+	info.Record(m, key)
+	match := spanPattern(pattern)
+	return func(output event.Exporter) event.Exporter {
+		return func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+			if event.IsEnd(ev) {
+				if span := GetSpan(ctx); span != nil && match(span.Name) {
+					start := span.Start()
+					duration := float64(ev.At().Sub(start.At())) / float64(time.Millisecond)
+					timing := core.CloneEvent(core.MakeEvent([3]label.Label{
+						keys.Metric.New(),
+						key.Of(duration),
+					}, nil), ev.At())
+					output(ctx, timing, label.MergeMaps(label.NewMap(SpanName.Of(span.Name)), lm, start))
+				}
+			}
+			return output(ctx, ev, lm)
+		}
+	}
+}
+
+// spanPattern returns a function that reports whether a span name matches
+// pattern, which matches every name starting with the rest of it if it ends in
+// "*", and only itself otherwise.
+func spanPattern(pattern string) func(name string) bool {
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+		return func(name string) bool { return strings.HasPrefix(name, prefix) }
+	}
+	return func(name string) bool { return name == pattern }
+}
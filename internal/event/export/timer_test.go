@@ -0,0 +1,77 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// settableClock is a clock that reads whatever time it was last set to.
+type settableClock struct{ at time.Time }
+
+func (c *settableClock) Now() time.Time { return c.at }
+
+func TestTimeSpans(t *testing.T) {
+	method := keys.NewString("timer_method", "")
+	clock := &settableClock{at: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	event.SetClock(clock)
+	defer event.SetClock(nil)
+
+	var m metric.Config
+	timer := export.TimeSpans(&m, metric.HistogramFloat64{
+		Name:    "request_latency",
+		Keys:    []label.Key{method},
+		Buckets: []float64{10, 100},
+	}, "request.*")
+	var latest *metric.HistogramFloat64Data
+	event.SetExporter(export.Wrap(func(ctx context.Context, ev core.Event, lm label.Map) context.Context {
+		if event.IsMetric(ev) {
+			latest = metric.Entries.Get(lm).([]metric.Data)[0].(*metric.HistogramFloat64Data)
+		}
+		return ctx
+	}, export.Spans, timer, m.Exporter))
+	defer event.SetExporter(nil)
+
+	span := func(name string, d time.Duration, labels ...label.Label) {
+		_, done := event.Start(context.Background(), name, labels...)
+		clock.at = clock.at.Add(d)
+		done()
+	}
+	span("request.get", 50*time.Millisecond, method.Of("get"))
+	span("request.put", 5*time.Millisecond, method.Of("put"))
+	span("request.get", 500*time.Millisecond, method.Of("get"))
+	// Spans that do not match are not timed.
+	span("other", time.Second)
+
+	if latest == nil {
+		t.Fatal("no durations were recorded")
+	}
+	if len(latest.Rows) != 2 {
+		t.Fatalf("got %d rows, want one per method", len(latest.Rows))
+	}
+	for i, want := range []struct {
+		method string
+		count  int64
+		sum    float64
+	}{
+		{"get", 2, 550},
+		{"put", 1, 5},
+	} {
+		row := latest.Rows[i]
+		if got := method.From(latest.Groups()[i][0]); got != want.method || row.Count != want.count || row.Sum != want.sum {
+			t.Errorf("row %d: got %v with count %d and sum %v, want %v with count %d and sum %v",
+				i, got, row.Count, row.Sum, want.method, want.count, want.sum)
+		}
+	}
+}
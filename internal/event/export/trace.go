@@ -24,10 +24,53 @@ type Span struct {
 	Name     string
 	ID       SpanContext
 	ParentID SpanID
-	mu       sync.Mutex
-	start    core.Event
-	finish   core.Event
-	events   []core.Event
+	// TraceState is the vendor specific trace state received with a remote
+	// parent, which the spans of the trace pass on unchanged.
+	TraceState string
+	mu         sync.Mutex
+	start      core.Event
+	finish     core.Event
+	events     []core.Event
+	labels     []label.Label
+	links      []Link
+	status     SpanStatus
+	// unsampled records that a sampler decided not to keep the span.
+	unsampled bool
+	// parentSampled is whether the parent of the span, if it has one, was
+	// sampled, for the samplers that follow the decision of the parent.
+	parentSampled bool
+	// localRoot is whether the span has no parent in this process, so that
+	// the end of the trace, as far as this process is concerned, is known.
+	localRoot bool
+}
+
+// SpanStatusCode is whether a span succeeded.
+type SpanStatusCode int
+
+// The status codes of spans.
+const (
+	// SpanStatusUnset is the status of a span that has not reported one.
+	SpanStatusUnset = SpanStatusCode(iota)
+	// SpanStatusOK is the status of a span that is known to have succeeded.
+	SpanStatusOK
+	// SpanStatusError is the status of a span that failed.
+	SpanStatusError
+)
+
+// SpanStatus is the outcome of the operation a span describes, so that the
+// backends can mark failed operations and compute error rates.
+type SpanStatus struct {
+	Code SpanStatusCode
+	// Message describes the failure of a span with SpanStatusError.
+	Message string
+}
+
+// Link is a reference from a span to a span it is related to without being
+// its child, such as from a batch operation to each of the requests that it
+// serves, with labels describing the relationship.
+type Link struct {
+	ID     SpanContext
+	Labels []label.Label
 }
 
 type contextKeyType int
@@ -35,8 +78,36 @@ type contextKeyType int
 const (
 	spanContextKey = contextKeyType(iota)
 	labelContextKey
+	droppedSpanKey
+	// profileParentKey holds the context a span was started from, so that
+	// ProfileLabels can restore the labels it had when the span ends.
+	profileParentKey
+	// runtimeTaskKey holds the runtime/trace task that RuntimeTrace started for
+	// a span, so that it can be ended with the span.
+	runtimeTaskKey
+	// remoteParentKey holds the RemoteParent set by WithRemoteParent.
+	remoteParentKey
+	// baggageKey holds the entries set by WithBaggage.
+	baggageKey
 )
 
+// RemoteParent is a span in another process, such as one whose context was
+// received with a request, that can be the parent of local spans.
+type RemoteParent struct {
+	ID SpanContext
+	// TraceState is the vendor specific trace state received with the span.
+	TraceState string
+	// Sampled is whether the remote span was sampled.
+	Sampled bool
+}
+
+// WithRemoteParent returns a context in which the spans started without a
+// local parent are children of the remote span, so that the trace continues
+// the one of the caller.
+func WithRemoteParent(ctx context.Context, parent RemoteParent) context.Context {
+	return context.WithValue(ctx, remoteParentKey, &parent)
+}
+
 func GetSpan(ctx context.Context) *Span {
 	v := ctx.Value(spanContextKey)
 	if v == nil {
@@ -67,7 +138,16 @@ func Spans(output event.Exporter) event.Exporter {
 			if parent := GetSpan(ctx); parent != nil {
 				span.ID.TraceID = parent.ID.TraceID
 				span.ParentID = parent.ID.SpanID
+				span.TraceState = parent.TraceState
+				span.parentSampled = parent.Sampled()
+			} else if remote, _ := ctx.Value(remoteParentKey).(*RemoteParent); remote != nil {
+				span.ID.TraceID = remote.ID.TraceID
+				span.ParentID = remote.ID.SpanID
+				span.TraceState = remote.TraceState
+				span.parentSampled = remote.Sampled
+				span.localRoot = true
 			} else {
+				span.localRoot = true
 				span.ID.TraceID = newTraceID()
 			}
 			span.ID.SpanID = newSpanID()
@@ -80,6 +160,7 @@ func Spans(output event.Exporter) event.Exporter {
 			}
 		case event.IsDetach(ev):
 			ctx = context.WithValue(ctx, spanContextKey, nil)
+			ctx = context.WithValue(ctx, remoteParentKey, nil)
 		}
 		return output(ctx, ev, lm)
 	}
@@ -106,6 +187,93 @@ func (s *Span) Events() []core.Event {
 	return s.events
 }
 
+// AddLabels attaches extra labels to the span, in addition to the ones
+// supplied when it was started.
+// It is intended for span processors that enrich spans.
+func (s *Span) AddLabels(labels ...label.Label) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels = append(s.labels, labels...)
+}
+
+// Labels returns the labels added by AddLabels.
+func (s *Span) Labels() []label.Label {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]label.Label(nil), s.labels...)
+}
+
+// AddLinks attaches links to other spans to the span.
+func (s *Span) AddLinks(links ...Link) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = append(s.links, links...)
+}
+
+// Links returns the links added by AddLinks.
+func (s *Span) Links() []Link {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Link(nil), s.links...)
+}
+
+// LinkSpan links the current span of ctx to the span identified by target,
+// for instance a batch span to the span of each request that it serves,
+// rather than making one a child of the other. The labels describe the link.
+// It does nothing if ctx has no current span.
+func LinkSpan(ctx context.Context, target SpanContext, labels ...label.Label) {
+	if span := GetSpan(ctx); span != nil {
+		span.AddLinks(Link{ID: target, Labels: labels})
+	}
+}
+
+// SetStatus sets the status of the span, replacing any it already has.
+func (s *Span) SetStatus(code SpanStatusCode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = SpanStatus{Code: code, Message: message}
+}
+
+// Status returns the status set by SetStatus. If none was set, a span that
+// had an error logged on it has SpanStatusError with the message of the
+// latest error, so that instrumentation that only logs errors still reports
+// the spans that failed.
+func (s *Span) Status() SpanStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Code != SpanStatusUnset {
+		return s.status
+	}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if ev := s.events[i]; event.IsError(ev) {
+			return SpanStatus{Code: SpanStatusError, Message: errorMessage(ev)}
+		}
+	}
+	return SpanStatus{}
+}
+
+// Sampled reports whether the span is to be kept, which it is unless a
+// Sampler applied by ApplySampler decided otherwise.
+func (s *Span) Sampled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.unsampled
+}
+
+// errorMessage returns the message of an error event followed by its error.
+func errorMessage(ev core.Event) string {
+	msg := keys.Msg.From(ev.Label(0))
+	err := keys.Err.From(ev.Label(1))
+	switch {
+	case err == nil:
+		return msg
+	case msg == "":
+		return err.Error()
+	default:
+		return msg + ": " + err.Error()
+	}
+}
+
 func (s *Span) Format(f fmt.State, r rune) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,289 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Environment variables read by TransportFromEnv.
+const (
+	ProxyEnv      = "GOTOOLS_TELEMETRY_PROXY"
+	CAFileEnv     = "GOTOOLS_TELEMETRY_CA_FILE"
+	CertFileEnv   = "GOTOOLS_TELEMETRY_CERT_FILE"
+	KeyFileEnv    = "GOTOOLS_TELEMETRY_KEY_FILE"
+	ServerNameEnv = "GOTOOLS_TELEMETRY_SERVER_NAME"
+)
+
+// TransportConfig describes how network exporters reach their backends, for
+// networks that only allow connections through a proxy, or that require
+// clients to present a certificate.
+// It is applied on top of the TLS configuration of each exporter.
+type TransportConfig struct {
+	// Proxy is the URL of an HTTP proxy that connections are made through,
+	// hosts listed in NO_PROXY are still reached directly. A Proxy of
+	// "direct" disables proxies altogether.
+	// If it is empty, HTTP requests use the proxy selected by HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY, and other connections are made directly.
+	Proxy string
+	// CAFile is a file of PEM encoded certificates that are trusted instead
+	// of the system roots.
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded certificate and private key
+	// presented to servers that ask for one.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name that is sent in the TLS handshake and
+	// that the certificate of the server is verified against.
+	ServerName string
+}
+
+// TransportFromEnv returns the transport configuration held in the
+// GOTOOLS_TELEMETRY_PROXY, GOTOOLS_TELEMETRY_CA_FILE,
+// GOTOOLS_TELEMETRY_CERT_FILE, GOTOOLS_TELEMETRY_KEY_FILE and
+// GOTOOLS_TELEMETRY_SERVER_NAME environment variables.
+func TransportFromEnv() *TransportConfig {
+	return &TransportConfig{
+		Proxy:      os.Getenv(ProxyEnv),
+		CAFile:     os.Getenv(CAFileEnv),
+		CertFile:   os.Getenv(CertFileEnv),
+		KeyFile:    os.Getenv(KeyFileEnv),
+		ServerName: os.Getenv(ServerNameEnv),
+	}
+}
+
+// TLS returns a copy of base with the certificates and server name of the
+// transport applied. It returns base itself if the transport does not
+// change it.
+func (c *TransportConfig) TLS(base *tls.Config) (*tls.Config, error) {
+	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && c.ServerName == "" {
+		return base, nil
+	}
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("a client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if c.ServerName != "" {
+		config.ServerName = c.ServerName
+	}
+	return config, nil
+}
+
+// proxy returns the function that selects the proxy for a request, or nil
+// if connections are made directly. If environment is true, and no proxy was
+// configured, the one chosen by the standard environment variables is used.
+func (c *TransportConfig) proxy(environment bool) (func(*url.URL) (*url.URL, error), error) {
+	switch c.Proxy {
+	case "direct":
+		return nil, nil
+	case "":
+		if !environment {
+			return nil, nil
+		}
+		return httpproxy.FromEnvironment().ProxyFunc(), nil
+	}
+	if _, err := url.Parse(c.Proxy); err != nil {
+		return nil, fmt.Errorf("invalid proxy: %v", err)
+	}
+	config := httpproxy.Config{
+		HTTPProxy:  c.Proxy,
+		HTTPSProxy: c.Proxy,
+		NoProxy:    httpproxy.FromEnvironment().NoProxy,
+	}
+	return config.ProxyFunc(), nil
+}
+
+// HTTPClient returns a client that sends requests as the transport is
+// configured, using base as its TLS configuration.
+func (c *TransportConfig) HTTPClient(base *tls.Config) (*http.Client, error) {
+	config, err := c.TLS(base)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := c.proxy(true)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	transport.Proxy = nil
+	if proxy != nil {
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// Dial connects to a TCP address, through the proxy if one is configured.
+// If tlsConfig is not nil the connection is secured with TLS, using
+// tlsConfig with the certificates and server name of the transport applied.
+func (c *TransportConfig) Dial(ctx context.Context, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig != nil {
+		var err error
+		if tlsConfig, err = c.TLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	proxy, err := c.proxy(false)
+	if err != nil {
+		return nil, err
+	}
+	var proxyURL *url.URL
+	if proxy != nil {
+		scheme := "http"
+		if tlsConfig != nil {
+			scheme = "https"
+		}
+		if proxyURL, err = proxy(&url.URL{Scheme: scheme, Host: address}); err != nil {
+			return nil, err
+		}
+	}
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = tunnel(ctx, proxyURL, address)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", address)
+	}
+	if err != nil || tlsConfig == nil {
+		return conn, err
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		if tlsConfig.ServerName, _, err = net.SplitHostPort(address); err != nil {
+			tlsConfig.ServerName = address
+		}
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// tunnel connects to address with the CONNECT method of an HTTP proxy.
+func tunnel(ctx context.Context, proxyURL *url.URL, address string) (net.Conn, error) {
+	proxyAddress := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddress = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	var d net.Dialer
+	var conn net.Conn
+	var err error
+	switch proxyURL.Scheme {
+	case "http":
+		conn, err = d.DialContext(ctx, "tcp", proxyAddress)
+	case "https":
+		td := &tls.Dialer{NetDialer: &d}
+		conn, err = td.DialContext(ctx, "tcp", proxyAddress)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %v: %v", proxyAddress, err)
+	}
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	r := bufio.NewReader(conn)
+	err = req.Write(conn)
+	var res *http.Response
+	if err == nil {
+		res, err = http.ReadResponse(r, req)
+	}
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("%v", res.Status)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v failed to connect to %v: %v", proxyAddress, address, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+// bufferedConn is a connection whose first bytes may already have been read
+// into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// HTTPClient returns a client configured by TransportFromEnv, using
+// tlsConfig as its TLS configuration. It is the default client of the
+// exporters that send telemetry over HTTP.
+// If the environment holds an invalid configuration the error is passed to
+// ReportError, and the client ignores the environment.
+func HTTPClient(tlsConfig *tls.Config) *http.Client {
+	client, err := TransportFromEnv().HTTPClient(tlsConfig)
+	if err != nil {
+		ReportError(fmt.Errorf("telemetry transport: %v", err))
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client = &http.Client{Transport: transport}
+	}
+	return client
+}
+
+// Dial connects to a TCP address as configured by TransportFromEnv, see
+// TransportConfig.Dial.
+func Dial(ctx context.Context, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	return TransportFromEnv().Dial(ctx, address, tlsConfig)
+}
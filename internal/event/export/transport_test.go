@@ -0,0 +1,216 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event/export"
+)
+
+// issue creates a certificate signed by parent, or a self signed CA
+// certificate if parent is nil, and writes it and its key to PEM files.
+func issue(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca, caKey, caFile, _ := issue(t, "test CA", nil, nil)
+	_, _, serverCert, serverKey := issue(t, "collector.internal", ca, caKey)
+	_, _, clientCert, clientKey := issue(t, "client", ca, caKey)
+	pair, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The server is reached by IP address, so its certificate only verifies
+	// with the server name overridden.
+	config := &export.TransportConfig{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey}
+	for _, serverName := range []string{"", "collector.internal"} {
+		config.ServerName = serverName
+		client, err := config.HTTPClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Get(srv.URL)
+		if serverName == "" {
+			if err == nil {
+				res.Body.Close()
+				t.Error("server certificate verified without the server name")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "client" {
+			t.Errorf("server saw client %q, want %q", body, "client")
+		}
+	}
+
+	if _, err := (&export.TransportConfig{CertFile: clientCert}).TLS(nil); err == nil {
+		t.Error("a certificate without a key was accepted")
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+	t.Setenv("NO_PROXY", "skipped.test")
+
+	client, err := (&export.TransportConfig{Proxy: proxy.URL}).HTTPClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Get("http://backend.test/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	// Hosts in NO_PROXY are dialed directly, and do not exist.
+	if res, err := client.Get("http://skipped.test/"); err == nil {
+		res.Body.Close()
+	}
+	if len(proxied) != 1 || proxied[0] != "http://backend.test/v1/traces" {
+		t.Errorf("proxy saw %v", proxied)
+	}
+}
+
+func TestDialTunnel(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Like many brokers, speak first.
+		io.WriteString(conn, "INFO {}\r\n")
+		io.Copy(conn, conn)
+	}()
+
+	var target, auth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, auth = r.Host, r.Header.Get("Proxy-Authorization")
+		if r.Method != "CONNECT" {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		up, err := net.Dial("tcp", backend.Addr().String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			up.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() {
+			io.Copy(up, rw)
+			up.Close()
+		}()
+		io.Copy(conn, up)
+		conn.Close()
+	}))
+	defer proxy.Close()
+
+	config := &export.TransportConfig{Proxy: "http://user:secret@" + proxy.Listener.Addr().String()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := config.Dial(ctx, "broker.test:4222", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if target != "broker.test:4222" || auth != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("proxy was asked for %s with authorization %q", target, auth)
+	}
+	r := bufio.NewReader(conn)
+	if line, err := r.ReadString('\n'); err != nil || line != "INFO {}\r\n" {
+		t.Fatalf("read %q, %v", line, err)
+	}
+	io.WriteString(conn, "PING\r\n")
+	if line, err := r.ReadString('\n'); err != nil || line != "PING\r\n" {
+		t.Errorf("read %q, %v", line, err)
+	}
+}
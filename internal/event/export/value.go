@@ -0,0 +1,61 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// LabelValue returns the value of l as an int64, uint64, float64, bool or
+// string, for backends that need to encode the value themselves.
+// Errors are converted to their message, and values of keys this package does
+// not know are formatted with fmt.
+func LabelValue(l label.Label) interface{} {
+	switch key := l.Key().(type) {
+	case *keys.Int:
+		return int64(key.From(l))
+	case *keys.Int8:
+		return int64(key.From(l))
+	case *keys.Int16:
+		return int64(key.From(l))
+	case *keys.Int32:
+		return int64(key.From(l))
+	case *keys.Int64:
+		return key.From(l)
+	case *keys.UInt:
+		return uint64(key.From(l))
+	case *keys.UInt8:
+		return uint64(key.From(l))
+	case *keys.UInt16:
+		return uint64(key.From(l))
+	case *keys.UInt32:
+		return uint64(key.From(l))
+	case *keys.UInt64:
+		return key.From(l)
+	case *keys.Float32:
+		return float64(key.From(l))
+	case *keys.Float64:
+		return key.From(l)
+	case *keys.Boolean:
+		return key.From(l)
+	case *keys.String:
+		return key.From(l)
+	case *keys.Error:
+		if err := key.From(l); err != nil {
+			return err.Error()
+		}
+		return ""
+	case *keys.Value:
+		return fmt.Sprint(key.From(l))
+	}
+	var b strings.Builder
+	var buf [128]byte
+	l.Key().Format(&b, buf[:0], l)
+	return b.String()
+}
@@ -0,0 +1,248 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xray sends spans to the AWS X-Ray daemon as segment documents over
+// UDP.
+//
+// X-Ray only accepts trace IDs that begin with the time the trace started, so
+// NewTraceID must be installed with export.SetTraceIDGenerator before any
+// spans are started; the registered exporter does this itself.
+// A span without a parent becomes a segment named after the service, with
+// the span name recorded in its metadata, and every other span becomes a
+// subsegment of its parent.
+//
+// Importing the package registers an "xray" exporter whose options are the
+// address of the daemon.
+package xray
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/core"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultAddress is the address the X-Ray daemon listens on.
+const DefaultAddress = "127.0.0.1:2000"
+
+type Config struct {
+	// Address is the UDP address of the daemon.
+	Address string
+	// Service is the name of the segments, it defaults to the name of the
+	// binary.
+	Service string
+}
+
+func init() {
+	export.Register("xray", func(address string) (event.Exporter, export.Shutdowner, error) {
+		exporter, err := Dial(&Config{Address: address})
+		if err != nil {
+			return nil, nil, err
+		}
+		export.SetTraceIDGenerator(NewTraceID)
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, export.ShutdownAll(batcher, exporter), nil
+	})
+}
+
+// NewTraceID returns a trace ID whose first four bytes are the current time in
+// seconds since the epoch, followed by random bytes, as X-Ray requires.
+func NewTraceID() export.TraceID {
+	var id export.TraceID
+	binary.BigEndian.PutUint32(id[:4], uint32(core.Now().Unix()))
+	crand.Read(id[4:])
+	return id
+}
+
+// TraceID formats id as an X-Ray trace ID.
+func TraceID(id export.TraceID) string {
+	return fmt.Sprintf("1-%x-%x", id[:4], id[4:])
+}
+
+// Exporter is an export.BatchExporter that sends spans to the daemon.
+// Metrics are ignored.
+type Exporter struct {
+	service string
+	mu      sync.Mutex
+	conn    net.Conn
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// Dial returns an Exporter that sends to the configured daemon.
+func Dial(config *Config) (*Exporter, error) {
+	resolved := *config
+	if resolved.Address == "" {
+		resolved.Address = DefaultAddress
+	}
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	conn, err := net.Dial("udp", resolved.Address)
+	if err != nil {
+		return nil, fmt.Errorf("xray exporter: %v", err)
+	}
+	return &Exporter{service: resolved.Service, conn: conn}, nil
+}
+
+// header precedes every segment document sent to the daemon.
+const header = `{"format": "json", "version": 1}` + "\n"
+
+// Segment is an X-Ray segment or subsegment document.
+type Segment struct {
+	Name        string                            `json:"name"`
+	ID          string                            `json:"id"`
+	TraceID     string                            `json:"trace_id"`
+	ParentID    string                            `json:"parent_id,omitempty"`
+	Type        string                            `json:"type,omitempty"`
+	StartTime   float64                           `json:"start_time"`
+	EndTime     float64                           `json:"end_time,omitempty"`
+	InProgress  bool                              `json:"in_progress,omitempty"`
+	Error       bool                              `json:"error,omitempty"`
+	Cause       *Cause                            `json:"cause,omitempty"`
+	Annotations map[string]interface{}            `json:"annotations,omitempty"`
+	Metadata    map[string]map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Cause describes the errors recorded in a segment.
+type Cause struct {
+	Exceptions []Exception `json:"exceptions"`
+}
+
+type Exception struct {
+	Message string `json:"message"`
+}
+
+// ExportSpans sends each span as a separate packet.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		e.conn.SetWriteDeadline(deadline)
+	} else {
+		e.conn.SetWriteDeadline(time.Time{})
+	}
+	var firstErr error
+	for _, s := range spans {
+		blob, err := json.Marshal(e.convertSpan(s))
+		if err == nil {
+			_, err = e.conn.Write(append([]byte(header), blob...))
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("xray exporter: %v", err)
+		}
+	}
+	return firstErr
+}
+
+// ExportMetrics does nothing, as X-Ray only accepts traces.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+// Shutdown closes the connection to the daemon.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.conn.Close()
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func (e *Exporter) convertSpan(span *export.Span) *Segment {
+	start, end := span.Start().At(), span.Finish().At()
+	seg := &Segment{
+		Name:      sanitizeName(span.Name),
+		ID:        span.ID.SpanID.String(),
+		TraceID:   TraceID(span.ID.TraceID),
+		StartTime: seconds(start),
+	}
+	if span.ParentID.IsValid() {
+		seg.ParentID = span.ParentID.String()
+		seg.Type = "subsegment"
+	} else {
+		seg.Name = sanitizeName(e.service)
+		seg.Metadata = map[string]map[string]interface{}{"default": {"span": span.Name}}
+	}
+	if end.IsZero() {
+		seg.InProgress = true
+	} else {
+		seg.EndTime = seconds(end)
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		seg.annotate(span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		seg.annotate(l)
+	}
+	for _, ev := range span.Events() {
+		if !event.IsError(ev) {
+			continue
+		}
+		msg := keys.Msg.From(ev.Label(0))
+		if err := keys.Err.From(ev.Label(1)); err != nil {
+			msg = strings.TrimPrefix(msg+": "+err.Error(), ": ")
+		}
+		seg.Error = true
+		if seg.Cause == nil {
+			seg.Cause = &Cause{}
+		}
+		seg.Cause.Exceptions = append(seg.Cause.Exceptions, Exception{Message: msg})
+	}
+	return seg
+}
+
+// annotate records the label as an annotation, which X-Ray indexes for
+// searching.
+func (seg *Segment) annotate(l label.Label) {
+	if !l.Valid() {
+		return
+	}
+	if seg.Annotations == nil {
+		seg.Annotations = make(map[string]interface{})
+	}
+	seg.Annotations[sanitizeKey(l.Key().Name())] = export.LabelValue(l)
+}
+
+// sanitizeKey replaces the characters not allowed in annotation keys with
+// underscores.
+func sanitizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// sanitizeName removes the characters not allowed in segment names.
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`"<>&;`, r) || r < ' ' {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return name
+}
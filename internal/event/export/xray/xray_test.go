@@ -0,0 +1,97 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xray_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/xray"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestExportSpans(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen for UDP: %v", err)
+	}
+	defer conn.Close()
+
+	export.SetTraceIDGenerator(xray.NewTraceID)
+	defer export.SetTraceIDGenerator(nil)
+	f := &finished{}
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, done := event.Start(context.Background(), "hover", keys.NewString("file.name", "").Of("main.go"))
+	_, childDone := event.Start(ctx, "parse")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	childDone()
+	done()
+	event.SetExporter(nil)
+
+	exporter, err := xray.Dial(&xray.Config{Address: conn.LocalAddr().String(), Service: "gopls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+
+	var segments []xray.Segment
+	buf := make([]byte, 65536)
+	for len(segments) < 2 {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.SplitN(string(buf[:n]), "\n", 2)
+		if lines[0] != `{"format": "json", "version": 1}` {
+			t.Fatalf("got header %q", lines[0])
+		}
+		var seg xray.Segment
+		if err := json.Unmarshal([]byte(lines[1]), &seg); err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, seg)
+	}
+
+	child, root := segments[0], segments[1]
+	epoch := fmt.Sprintf("1-%08x-", time.Now().Unix())[:7] // allow the low digits to tick over
+	if !strings.HasPrefix(root.TraceID, epoch) || len(root.TraceID) != 35 {
+		t.Errorf("trace ID %s is not an X-Ray ID for the current time", root.TraceID)
+	}
+	if root.Name != "gopls" || root.Type != "" || root.Metadata["default"]["span"] != "hover" {
+		t.Errorf("got root segment %+v", root)
+	}
+	if !root.Error || root.Cause == nil || root.Cause.Exceptions[0].Message != "failed: timeout" {
+		t.Errorf("root segment does not record the error: %+v", root)
+	}
+	if root.Annotations["file_name"] != "main.go" {
+		t.Errorf("got annotations %v", root.Annotations)
+	}
+	if child.Name != "parse" || child.Type != "subsegment" || child.ParentID != root.ID || child.TraceID != root.TraceID {
+		t.Errorf("got subsegment %+v of %+v", child, root)
+	}
+	if child.EndTime < child.StartTime || child.StartTime < root.StartTime {
+		t.Errorf("got times %v-%v within %v-%v", child.StartTime, child.EndTime, root.StartTime, root.EndTime)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zipkin posts spans to a zipkin collector using the v2 JSON API.
+//
+// Importing the package registers a "zipkin" exporter whose options are the
+// URL of the collector's span endpoint.
+package zipkin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/metric"
+	"golang.org/x/tools/internal/event/keys"
+	"golang.org/x/tools/internal/event/label"
+)
+
+// DefaultURL is the span endpoint of a collector running on the local machine.
+const DefaultURL = "http://localhost:9411/api/v2/spans"
+
+type Config struct {
+	// URL is the collector endpoint the spans are posted to.
+	URL string
+	// Service is the service name of the local endpoint, it defaults to the
+	// name of the binary.
+	Service string
+	// Client sends the requests, it defaults to export.HTTPClient(nil).
+	Client *http.Client
+}
+
+func init() {
+	export.Register("zipkin", func(url string) (event.Exporter, export.Shutdowner, error) {
+		if url != "" && !strings.Contains(url, "://") {
+			url = "http://" + url
+		}
+		exporter := New(&Config{URL: url})
+		batcher := export.Batch(exporter, 512, 2*time.Second)
+		return batcher.ProcessEvent, batcher, nil
+	})
+}
+
+// Exporter is an export.BatchExporter that posts spans to the collector.
+// Metrics are ignored.
+type Exporter struct {
+	config Config
+}
+
+var _ export.BatchExporter = (*Exporter)(nil)
+
+// New returns an Exporter that posts to the configured collector.
+func New(config *Config) *Exporter {
+	resolved := *config
+	if resolved.URL == "" {
+		resolved.URL = DefaultURL
+	}
+	if resolved.Service == "" {
+		resolved.Service = filepath.Base(os.Args[0])
+	}
+	if resolved.Client == nil {
+		resolved.Client = export.HTTPClient(nil)
+	}
+	return &Exporter{config: resolved}
+}
+
+// ExportSpans posts the spans to the collector in a single request.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*export.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	converted := make([]*Span, len(spans))
+	for i, s := range spans {
+		converted[i] = e.convertSpan(s)
+	}
+	blob, err := json.Marshal(converted)
+	if err != nil {
+		return fmt.Errorf("zipkin failed to marshal spans: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.config.URL, bytes.NewReader(blob))
+	if err != nil {
+		return fmt.Errorf("zipkin failed to build request for %v: %v", e.config.URL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("zipkin failed to send spans: %v", err)
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("zipkin rejected spans for %v: %v", e.config.URL, res.Status)
+	}
+	return nil
+}
+
+// ExportMetrics does nothing, as zipkin only accepts spans.
+func (e *Exporter) ExportMetrics(ctx context.Context, metrics []metric.Data) error {
+	return nil
+}
+
+// Span is a span in the zipkin v2 data model.
+type Span struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration,omitempty"`
+	LocalEndpoint *Endpoint         `json:"localEndpoint,omitempty"`
+	Annotations   []Annotation      `json:"annotations,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type Endpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// Annotation is a timestamped event within a span.
+type Annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+func (e *Exporter) convertSpan(span *export.Span) *Span {
+	start, end := span.Start().At(), span.Finish().At()
+	result := &Span{
+		TraceID:       span.ID.TraceID.String(),
+		ID:            span.ID.SpanID.String(),
+		Name:          span.Name,
+		Timestamp:     start.UnixNano() / 1000,
+		LocalEndpoint: &Endpoint{ServiceName: e.config.Service},
+	}
+	if span.ParentID.IsValid() {
+		result.ParentID = span.ParentID.String()
+	}
+	if !end.IsZero() {
+		result.Duration = int64(end.Sub(start) / time.Microsecond)
+	}
+	for i := 1; span.Start().Valid(i); i++ {
+		result.addTag(span.Start().Label(i))
+	}
+	for _, l := range span.Labels() {
+		result.addTag(l)
+	}
+	for _, ev := range span.Events() {
+		if !event.IsLog(ev) {
+			continue
+		}
+		value := keys.Msg.From(ev.Label(0))
+		if event.IsError(ev) {
+			if err := keys.Err.From(ev.Label(1)); err != nil {
+				value = strings.TrimPrefix(value+": "+err.Error(), ": ")
+			}
+			// A span with an error tag is shown as failed.
+			result.addTagValue("error", value)
+		}
+		result.Annotations = append(result.Annotations, Annotation{
+			Timestamp: ev.At().UnixNano() / 1000,
+			Value:     value,
+		})
+	}
+	return result
+}
+
+func (s *Span) addTag(l label.Label) {
+	if l.Valid() {
+		s.addTagValue(l.Key().Name(), fmt.Sprint(export.LabelValue(l)))
+	}
+}
+
+func (s *Span) addTagValue(key, value string) {
+	if s.Tags == nil {
+		s.Tags = make(map[string]string)
+	}
+	s.Tags[key] = value
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipkin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/internal/event"
+	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/zipkin"
+	"golang.org/x/tools/internal/event/keys"
+)
+
+type finished struct {
+	spans []*export.Span
+}
+
+func (f *finished) ProcessSpan(ctx context.Context, span *export.Span) {
+	f.spans = append(f.spans, span)
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestExportSpans(t *testing.T) {
+	var got []zipkin.Span
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/spans" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got request for %s of %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	f := &finished{}
+	event.SetClock(fixedClock(time.Unix(1583418468, 0)))
+	defer event.SetClock(nil)
+	event.SetExporter(export.Spans(export.SpansOnly(f)))
+	ctx, parentDone := event.Start(context.Background(), "parent", keys.NewString("db", "").Of("godb"))
+	_, childDone := event.Start(ctx, "child")
+	event.Error(ctx, "failed", errors.New("timeout"))
+	childDone()
+	parentDone()
+	event.SetExporter(nil)
+
+	exporter := zipkin.New(&zipkin.Config{URL: srv.URL + "/api/v2/spans", Service: "zipkin-tests"})
+	if err := exporter.ExportSpans(context.Background(), f.spans); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("collector got %d spans, want 2", len(got))
+	}
+	child, parent := got[0], got[1]
+	if child.Name != "child" || parent.Name != "parent" {
+		t.Fatalf("got spans %q and %q, want child and parent", child.Name, parent.Name)
+	}
+	if child.ParentID != parent.ID || child.TraceID != parent.TraceID || parent.ParentID != "" {
+		t.Errorf("child %s/%s (parent %s) is not a child of %s/%s", child.TraceID, child.ID, child.ParentID, parent.TraceID, parent.ID)
+	}
+	if parent.Timestamp != 1583418468000000 || parent.LocalEndpoint.ServiceName != "zipkin-tests" {
+		t.Errorf("got timestamp %d and service %q", parent.Timestamp, parent.LocalEndpoint.ServiceName)
+	}
+	if parent.Tags["db"] != "godb" || parent.Tags["error"] != "failed: timeout" {
+		t.Errorf("got tags %v", parent.Tags)
+	}
+	if len(parent.Annotations) != 1 || parent.Annotations[0].Value != "failed: timeout" {
+		t.Errorf("got annotations %v", parent.Annotations)
+	}
+}
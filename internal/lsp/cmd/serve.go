@@ -13,6 +13,7 @@ import (
 	"os"
 	"time"
 
+	"golang.org/x/tools/internal/event/export"
 	"golang.org/x/tools/internal/fakenet"
 	"golang.org/x/tools/internal/jsonrpc2"
 	"golang.org/x/tools/internal/lsp/cache"
@@ -81,6 +82,13 @@ func (s *Serve) Run(ctx context.Context, args ...string) error {
 		return tool.CommandLineErrorf("server does not take arguments, got %v", args)
 	}
 
+	// Make sure any buffered telemetry is delivered before the server exits.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		export.Shutdown(ctx)
+	}()
+
 	di := debug.GetInstance(ctx)
 	isDaemon := s.Address != "" || s.Port != 0
 	if di != nil {
@@ -0,0 +1,47 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package allexporters registers every exporter in internal/event/export
+// with the export package, so that any of them can be selected with the
+// GOTOOLS_TELEMETRY environment variable.
+//
+// Only the ocagent, prometheus and otlp exporters are linked into gopls by
+// default, as the others are rarely used and each adds to the size of every
+// binary. Building gopls with the allexporters tag imports this package, and
+// other programs can import it for its side effects.
+package allexporters
+
+import (
+	_ "golang.org/x/tools/internal/event/export/appinsights"
+	_ "golang.org/x/tools/internal/event/export/chrometrace"
+	_ "golang.org/x/tools/internal/event/export/csv"
+	_ "golang.org/x/tools/internal/event/export/datadog"
+	_ "golang.org/x/tools/internal/event/export/elasticsearch"
+	_ "golang.org/x/tools/internal/event/export/etw"
+	_ "golang.org/x/tools/internal/event/export/expvar"
+	_ "golang.org/x/tools/internal/event/export/gcp"
+	_ "golang.org/x/tools/internal/event/export/graphite"
+	_ "golang.org/x/tools/internal/event/export/honeycomb"
+	_ "golang.org/x/tools/internal/event/export/influx"
+	_ "golang.org/x/tools/internal/event/export/jaeger"
+	_ "golang.org/x/tools/internal/event/export/journald"
+	_ "golang.org/x/tools/internal/event/export/jsonl"
+	_ "golang.org/x/tools/internal/event/export/kafka"
+	_ "golang.org/x/tools/internal/event/export/loki"
+	_ "golang.org/x/tools/internal/event/export/mqtt"
+	_ "golang.org/x/tools/internal/event/export/nats"
+	_ "golang.org/x/tools/internal/event/export/newrelic"
+	_ "golang.org/x/tools/internal/event/export/ocagent"
+	_ "golang.org/x/tools/internal/event/export/otlp/otlpgrpc"
+	_ "golang.org/x/tools/internal/event/export/otlp/otlphttp"
+	_ "golang.org/x/tools/internal/event/export/parquet"
+	_ "golang.org/x/tools/internal/event/export/prometheus"
+	_ "golang.org/x/tools/internal/event/export/sqlite"
+	_ "golang.org/x/tools/internal/event/export/statsd"
+	_ "golang.org/x/tools/internal/event/export/stream"
+	_ "golang.org/x/tools/internal/event/export/syslog"
+	_ "golang.org/x/tools/internal/event/export/tempo"
+	_ "golang.org/x/tools/internal/event/export/xray"
+	_ "golang.org/x/tools/internal/event/export/zipkin"
+)
@@ -0,0 +1,14 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+// The exporters below register themselves with the export package, so that
+// they can be selected with the GOTOOLS_TELEMETRY environment variable.
+// The ocagent and prometheus exporters are registered by the imports of
+// serve.go, the rest are only linked in when building with the allexporters
+// tag, see exporters_all.go.
+import (
+	_ "golang.org/x/tools/internal/event/export/otlp/otlphttp"
+)
@@ -0,0 +1,12 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build allexporters
+// +build allexporters
+
+package debug
+
+import (
+	_ "golang.org/x/tools/internal/lsp/debug/allexporters"
+)
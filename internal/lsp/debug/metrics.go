@@ -18,6 +18,7 @@ var (
 	receivedBytes = metric.HistogramInt64{
 		Name:        "received_bytes",
 		Description: "Distribution of received bytes, by method.",
+		Unit:        metric.UnitBytes,
 		Keys:        []label.Key{tag.RPCDirection, tag.Method},
 		Buckets:     bytesDistribution,
 	}
@@ -25,6 +26,7 @@ var (
 	sentBytes = metric.HistogramInt64{
 		Name:        "sent_bytes",
 		Description: "Distribution of sent bytes, by method.",
+		Unit:        metric.UnitBytes,
 		Keys:        []label.Key{tag.RPCDirection, tag.Method},
 		Buckets:     bytesDistribution,
 	}
@@ -32,6 +34,7 @@ var (
 	latency = metric.HistogramFloat64{
 		Name:        "latency",
 		Description: "Distribution of latency in milliseconds, by method.",
+		Unit:        metric.UnitMilliseconds,
 		Keys:        []label.Key{tag.RPCDirection, tag.Method},
 		Buckets:     millisecondsDistribution,
 	}
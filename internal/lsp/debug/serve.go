@@ -29,6 +29,7 @@ import (
 	"golang.org/x/tools/internal/event"
 	"golang.org/x/tools/internal/event/core"
 	"golang.org/x/tools/internal/event/export"
+	"golang.org/x/tools/internal/event/export/live"
 	"golang.org/x/tools/internal/event/export/metric"
 	"golang.org/x/tools/internal/event/export/ocagent"
 	"golang.org/x/tools/internal/event/export/prometheus"
@@ -63,6 +64,7 @@ type Instance struct {
 
 	ocagent    *ocagent.Exporter
 	prometheus *prometheus.Exporter
+	live       *live.Exporter
 	rpcs       *Rpcs
 	traces     *traces
 	State      *State
@@ -378,13 +380,30 @@ func (i *Instance) AddService(s protocol.Server, session *cache.Session) {
 	stdlog.Printf("unable to find a Client to add the protocol.Server to")
 }
 
+// TelemetryStatuses returns the health of the telemetry exporters, for the
+// main debug page.
+func (i *Instance) TelemetryStatuses() []export.Status {
+	return export.Statuses()
+}
+
 func getMemory(_ *http.Request) interface{} {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 	return m
 }
 
+// envExporter holds the exporters selected by the GOTOOLS_TELEMETRY
+// environment variable, which are fed the telemetry of every instance.
+var envExporter event.Exporter
+
 func init() {
+	var shutdown export.Shutdowner
+	var err error
+	if envExporter, shutdown, err = export.FromEnv(); err != nil {
+		stdlog.Print(err)
+	}
+	// They are shut down along with the rest when the server exits.
+	export.Manage(shutdown)
 	event.SetExporter(makeGlobalExporter(os.Stderr))
 }
 
@@ -413,6 +432,7 @@ func WithInstance(ctx context.Context, workdir, agent string) context.Context {
 	ocConfig.Address = i.OCAgentConfig
 	i.ocagent = ocagent.Connect(ocConfig)
 	i.prometheus = prometheus.New()
+	i.live = live.New(&live.Config{})
 	i.rpcs = &Rpcs{}
 	i.traces = &traces{}
 	i.State = &State{}
@@ -486,7 +506,10 @@ func (i *Instance) Serve(ctx context.Context, addr string) (string, error) {
 		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 		if i.prometheus != nil {
-			mux.HandleFunc("/metrics/", i.prometheus.Serve)
+			mux.Handle("/metrics/", i.prometheus)
+		}
+		if i.live != nil {
+			mux.Handle("/telemetry/live", i.live)
 		}
 		if i.rpcs != nil {
 			mux.HandleFunc("/rpc/", render(RPCTmpl, i.rpcs.getData))
@@ -642,12 +665,18 @@ func makeInstanceExporter(i *Instance) event.Exporter {
 		if i.prometheus != nil {
 			ctx = i.prometheus.ProcessEvent(ctx, ev, lm)
 		}
+		if i.live != nil {
+			ctx = i.live.ProcessEvent(ctx, ev, lm)
+		}
 		if i.rpcs != nil {
 			ctx = i.rpcs.ProcessEvent(ctx, ev, lm)
 		}
 		if i.traces != nil {
 			ctx = i.traces.ProcessEvent(ctx, ev, lm)
 		}
+		if envExporter != nil {
+			ctx = envExporter(ctx, ev, lm)
+		}
 		if event.IsLog(ev) {
 			if s := cache.KeyCreateSession.Get(ev); s != nil {
 				i.State.addClient(s)
@@ -687,6 +716,7 @@ func makeInstanceExporter(i *Instance) event.Exporter {
 	metrics := metric.Config{}
 	registerMetrics(&metrics)
 	exporter = metrics.Exporter(exporter)
+	exporter = export.Exemplars(exporter)
 	exporter = export.Spans(exporter)
 	exporter = export.Labels(exporter)
 	return exporter
@@ -811,6 +841,8 @@ var MainTmpl = template.Must(template.Must(BaseTemplate.Clone()).Parse(`
 <ul>{{range .State.Servers}}<li>{{template "serverlink" .ID}}</li>{{end}}</ul>
 <h2>Known bugs encountered</h2>
 <dl>{{range .State.Bugs}}<dt>{{.Description}}</dt><dd>{{.Event}}</dd>{{end}}</dl>
+<h2>Telemetry exporters</h2>
+<ul>{{range .TelemetryStatuses}}<li>{{.Name}} is {{if .Connected}}connected{{else}}not connected{{end}}{{if not .LastExport.IsZero}}, last export at {{.LastExport}}{{end}}{{with .LastError}}, last error: {{.}}{{end}}</li>{{end}}</ul>
 {{end}}
 `))
 